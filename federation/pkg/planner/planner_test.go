@@ -78,7 +78,7 @@ func TestPlanner_OptimizePlan_NilPlan(t *testing.T) {
 	plannerInstance := planner.NewPlanner(logger)
 
 	// 测试 nil 计划
-	_, err := plannerInstance.OptimizePlan(nil)
+	_, err := plannerInstance.OptimizePlan(context.Background(), nil)
 	if err == nil {
 		t.Error("Expected error for nil plan")
 	}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
@@ -15,7 +16,9 @@ import (
 type Cache interface {
 	// 查询结果缓存
 	GetQuery(key string) (*federationtypes.GraphQLResponse, bool)
+	GetQueryEntry(key string) (*CacheEntry, bool)
 	SetQuery(key string, response *federationtypes.GraphQLResponse, ttl time.Duration) error
+	SetQueryForServices(key string, response *federationtypes.GraphQLResponse, ttl time.Duration, services []string) error
 	InvalidateQuery(pattern string) error
 
 	// 模式缓存
@@ -28,6 +31,9 @@ type Cache interface {
 	SetPlan(key string, plan *federationtypes.ExecutionPlan, ttl time.Duration) error
 	InvalidatePlan(pattern string) error
 
+	// 按服务失效：模式、路由到该服务的计划和标记了该服务的查询结果
+	InvalidateService(serviceName string) error
+
 	// 通用操作
 	Clear() error
 	Size() int
@@ -62,6 +68,8 @@ type QueryCacheConfig struct {
 	TTL        time.Duration `json:"ttl"`
 	MaxSize    int           `json:"maxSize"`
 	MaxKeySize int           `json:"maxKeySize"`
+
+	MaxValueBytes int `json:"maxValueBytes,omitempty"` // 单个查询结果的大小上限，超出时不缓存，0 表示不限制
 }
 
 // SchemaCacheConfig 模式缓存配置
@@ -90,6 +98,7 @@ type CacheStats struct {
 	QueryHits   int64 `json:"queryHits"`
 	QueryMisses int64 `json:"queryMisses"`
 	QuerySets   int64 `json:"querySets"`
+	QuerySkips  int64 `json:"querySkips"` // 超过 MaxValueBytes 而未缓存的查询结果
 
 	// 模式缓存统计
 	SchemaHits   int64 `json:"schemaHits"`
@@ -105,6 +114,76 @@ type CacheStats struct {
 	HitRate     float64   `json:"hitRate"`
 	Size        int       `json:"size"`
 	LastCleanup time.Time `json:"lastCleanup"`
+
+	// 命中时条目年龄分布，用于调整 TTL
+	QueryHitAges  CacheAgeHistogram `json:"queryHitAges"`
+	SchemaHitAges CacheAgeHistogram `json:"schemaHitAges"`
+	PlanHitAges   CacheAgeHistogram `json:"planHitAges"`
+}
+
+// cacheAgeBounds 年龄直方图各桶的上界，超过最大上界的命中计入最后一个桶
+var cacheAgeBounds = [...]time.Duration{
+	time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+// CacheAgeHistogram 命中时条目年龄（命中时刻减 CreatedAt）的分布。
+// 命中大多落在低位桶说明 TTL 可以缩短，接近 TTL 的桶占比高说明 TTL 在起作用
+type CacheAgeHistogram struct {
+	Buckets []CacheAgeBucket `json:"buckets"`
+	Count   int64            `json:"count"`
+	Sum     time.Duration    `json:"sum"` // 年龄总和，除以 Count 得到平均年龄
+}
+
+// CacheAgeBucket 年龄直方图的一个桶，统计年龄大于前一个桶上界且不超过 UpperBound 的命中
+type CacheAgeBucket struct {
+	UpperBound time.Duration `json:"upperBound"` // 最后一个桶为 0，表示没有上界
+	Count      int64         `json:"count"`
+}
+
+// ageHistogram 单个缓存类别的命中年龄计数。命中路径只持有读锁，计数使用原子操作
+type ageHistogram struct {
+	counts [len(cacheAgeBounds) + 1]atomic.Int64
+	sum    atomic.Int64
+}
+
+// observe 记录一次命中时的条目年龄
+func (h *ageHistogram) observe(age time.Duration) {
+	if age < 0 {
+		age = 0
+	}
+
+	bucket := len(cacheAgeBounds)
+	for i, bound := range cacheAgeBounds {
+		if age <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.counts[bucket].Add(1)
+	h.sum.Add(int64(age))
+}
+
+// snapshot 返回直方图的副本
+func (h *ageHistogram) snapshot() CacheAgeHistogram {
+	histogram := CacheAgeHistogram{
+		Buckets: make([]CacheAgeBucket, len(h.counts)),
+		Sum:     time.Duration(h.sum.Load()),
+	}
+	for i := range h.counts {
+		count := h.counts[i].Load()
+		if i < len(cacheAgeBounds) {
+			histogram.Buckets[i].UpperBound = cacheAgeBounds[i]
+		}
+		histogram.Buckets[i].Count = count
+		histogram.Count += count
+	}
+	return histogram
 }
 
 // CacheEntry 缓存条目
@@ -116,6 +195,7 @@ type CacheEntry struct {
 	AccessedAt  time.Time   `json:"accessedAt"`
 	AccessCount int64       `json:"accessCount"`
 	Size        int         `json:"size"`
+	Services    []string    `json:"services,omitempty"` // 条目依赖的服务，用于按服务失效
 }
 
 // MemoryCache 内存缓存实现
@@ -130,7 +210,10 @@ type MemoryCache struct {
 	planCache   map[string]*CacheEntry
 
 	// 统计信息
-	stats CacheStats
+	stats      CacheStats
+	queryAges  ageHistogram
+	schemaAges ageHistogram
+	planAges   ageHistogram
 
 	// 清理相关
 	cleanupTicker *time.Ticker
@@ -191,6 +274,15 @@ func DefaultCacheConfig() *CacheConfig {
 
 // GetQuery 获取查询结果
 func (c *MemoryCache) GetQuery(key string) (*federationtypes.GraphQLResponse, bool) {
+	entry, ok := c.GetQueryEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.Value.(*federationtypes.GraphQLResponse), true
+}
+
+// GetQueryEntry 获取查询缓存条目的副本，包含创建和过期时间，命中统计与 GetQuery 相同
+func (c *MemoryCache) GetQueryEntry(key string) (*CacheEntry, bool) {
 	if !c.config.Enabled || !c.config.QueryCache.Enabled {
 		return nil, false
 	}
@@ -220,10 +312,12 @@ func (c *MemoryCache) GetQuery(key string) (*federationtypes.GraphQLResponse, bo
 	// 统计命中
 	c.stats.QueryHits++
 	c.stats.TotalHits++
+	c.queryAges.observe(time.Since(entry.CreatedAt))
 
-	if response, ok := entry.Value.(*federationtypes.GraphQLResponse); ok {
+	if _, ok := entry.Value.(*federationtypes.GraphQLResponse); ok {
 		c.logger.Debug("Query cache hit", "key", c.truncateKey(key))
-		return response, true
+		snapshot := *entry
+		return &snapshot, true
 	}
 
 	return nil, false
@@ -231,6 +325,11 @@ func (c *MemoryCache) GetQuery(key string) (*federationtypes.GraphQLResponse, bo
 
 // SetQuery 设置查询结果
 func (c *MemoryCache) SetQuery(key string, response *federationtypes.GraphQLResponse, ttl time.Duration) error {
+	return c.SetQueryForServices(key, response, ttl, nil)
+}
+
+// SetQueryForServices 设置查询结果并标记参与解析的服务，InvalidateService 按该标记失效
+func (c *MemoryCache) SetQueryForServices(key string, response *federationtypes.GraphQLResponse, ttl time.Duration, services []string) error {
 	if !c.config.Enabled || !c.config.QueryCache.Enabled {
 		return nil
 	}
@@ -239,6 +338,18 @@ func (c *MemoryCache) SetQuery(key string, response *federationtypes.GraphQLResp
 		return fmt.Errorf("key size %d exceeds maximum %d", len(key), c.config.QueryCache.MaxKeySize)
 	}
 
+	// 过大的结果会挤占大量小条目，不缓存并删除同键的旧结果
+	size := c.calculateSize(response)
+	if maxValueBytes := c.config.QueryCache.MaxValueBytes; maxValueBytes > 0 && size > maxValueBytes {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		delete(c.queryCache, key)
+		c.stats.QuerySkips++
+		c.logger.Debug("Query result too large to cache", "key", c.truncateKey(key), "size", size, "maxValueBytes", maxValueBytes)
+		return nil
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -260,7 +371,8 @@ func (c *MemoryCache) SetQuery(key string, response *federationtypes.GraphQLResp
 		CreatedAt:   time.Now(),
 		AccessedAt:  time.Now(),
 		AccessCount: 0,
-		Size:        c.calculateSize(response),
+		Size:        size,
+		Services:    append([]string(nil), services...),
 	}
 
 	c.queryCache[key] = entry
@@ -326,6 +438,7 @@ func (c *MemoryCache) GetSchema(serviceName string) (*federationtypes.Schema, bo
 	// 统计命中
 	c.stats.SchemaHits++
 	c.stats.TotalHits++
+	c.schemaAges.observe(time.Since(entry.CreatedAt))
 
 	if schema, ok := entry.Value.(*federationtypes.Schema); ok {
 		c.logger.Debug("Schema cache hit", "service", serviceName)
@@ -421,6 +534,7 @@ func (c *MemoryCache) GetPlan(key string) (*federationtypes.ExecutionPlan, bool)
 	// 统计命中
 	c.stats.PlanHits++
 	c.stats.TotalHits++
+	c.planAges.observe(time.Since(entry.CreatedAt))
 
 	if plan, ok := entry.Value.(*federationtypes.ExecutionPlan); ok {
 		c.logger.Debug("Plan cache hit", "key", c.truncateKey(key))
@@ -458,6 +572,7 @@ func (c *MemoryCache) SetPlan(key string, plan *federationtypes.ExecutionPlan, t
 		AccessedAt:  time.Now(),
 		AccessCount: 0,
 		Size:        c.calculateSize(plan),
+		Services:    PlanServices(plan),
 	}
 
 	c.planCache[key] = entry
@@ -493,6 +608,83 @@ func (c *MemoryCache) InvalidatePlan(pattern string) error {
 	return nil
 }
 
+// InvalidateService 在一次加锁中删除服务的模式条目、路由到该服务的计划以及标记了该服务的查询结果，
+// 用于服务发布后一次性丢弃其相关缓存。未启用的类别跳过
+func (c *MemoryCache) InvalidateService(serviceName string) error {
+	if !c.config.Enabled {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	schemaCount := 0
+	if c.config.SchemaCache.Enabled {
+		if _, exists := c.schemaCache[serviceName]; exists {
+			delete(c.schemaCache, serviceName)
+			schemaCount = 1
+		}
+	}
+
+	planCount := 0
+	if c.config.PlanCache.Enabled {
+		planCount = deleteServiceEntries(c.planCache, serviceName)
+	}
+
+	queryCount := 0
+	if c.config.QueryCache.Enabled {
+		queryCount = deleteServiceEntries(c.queryCache, serviceName)
+	}
+
+	c.stats.TotalEvicts += int64(schemaCount + planCount + queryCount)
+
+	c.logger.Info("Service cache invalidated",
+		"service", serviceName,
+		"schemaEntries", schemaCount,
+		"planEntries", planCount,
+		"queryEntries", queryCount,
+	)
+	return nil
+}
+
+// deleteServiceEntries 删除依赖指定服务的条目并返回删除数量，调用方需持有写锁
+func deleteServiceEntries(entries map[string]*CacheEntry, serviceName string) int {
+	count := 0
+	for key, entry := range entries {
+		for _, service := range entry.Services {
+			if service == serviceName {
+				delete(entries, key)
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// PlanServices 返回计划中子查询和实体查询路由到的服务，去重并保持首次出现的顺序
+func PlanServices(plan *federationtypes.ExecutionPlan) []string {
+	if plan == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var services []string
+	add := func(service string) {
+		if service != "" && !seen[service] {
+			seen[service] = true
+			services = append(services, service)
+		}
+	}
+	for _, subQuery := range plan.SubQueries {
+		add(subQuery.ServiceName)
+	}
+	for _, fetch := range plan.EntityFetches {
+		add(fetch.ServiceName)
+	}
+	return services
+}
+
 // Clear 清空所有缓存
 func (c *MemoryCache) Clear() error {
 	c.mutex.Lock()
@@ -548,6 +740,7 @@ func (c *MemoryCache) Stats() CacheStats {
 		QueryHits:    c.stats.QueryHits,
 		QueryMisses:  c.stats.QueryMisses,
 		QuerySets:    c.stats.QuerySets,
+		QuerySkips:   c.stats.QuerySkips,
 		SchemaHits:   c.stats.SchemaHits,
 		SchemaMisses: c.stats.SchemaMisses,
 		SchemaSets:   c.stats.SchemaSets,
@@ -557,6 +750,10 @@ func (c *MemoryCache) Stats() CacheStats {
 		HitRate:      c.stats.HitRate,
 		Size:         c.stats.Size,
 		LastCleanup:  c.stats.LastCleanup,
+
+		QueryHitAges:  c.queryAges.snapshot(),
+		SchemaHitAges: c.schemaAges.snapshot(),
+		PlanHitAges:   c.planAges.snapshot(),
 	}
 }
 
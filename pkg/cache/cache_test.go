@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"strings"
 	"testing"
 	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
 
 // MockLogger 实现 Logger 接口用于测试
@@ -299,7 +302,144 @@ func TestMemoryCache_Interfaces(t *testing.T) {
 	_ = cache.GetPlan
 	_ = cache.SetPlan
 	_ = cache.InvalidatePlan
+	_ = cache.InvalidateService
 	_ = cache.Clear
 	_ = cache.Size
 	_ = cache.Stats
 }
+
+func TestMemoryCache_InvalidateService(t *testing.T) {
+	cache := NewMemoryCache(nil, &MockLogger{})
+	response := &federationtypes.GraphQLResponse{Data: map[string]interface{}{"ok": true}}
+
+	cache.SetSchema("products", &federationtypes.Schema{SDL: "type Query { a: Int }"}, time.Minute)
+	cache.SetSchema("users", &federationtypes.Schema{SDL: "type Query { b: Int }"}, time.Minute)
+	cache.SetPlan("plan-products", &federationtypes.ExecutionPlan{
+		SubQueries:    []federationtypes.SubQuery{{ServiceName: "users"}},
+		EntityFetches: []federationtypes.EntityFetch{{ServiceName: "products"}},
+	}, time.Minute)
+	cache.SetPlan("plan-users", &federationtypes.ExecutionPlan{
+		SubQueries: []federationtypes.SubQuery{{ServiceName: "users"}},
+	}, time.Minute)
+	cache.SetQueryForServices("query-products", response, time.Minute, []string{"users", "products"})
+	cache.SetQueryForServices("query-users", response, time.Minute, []string{"users"})
+	cache.SetQuery("query-untagged", response, time.Minute)
+
+	if err := cache.InvalidateService("products"); err != nil {
+		t.Fatalf("InvalidateService() error = %v", err)
+	}
+
+	if _, ok := cache.GetSchema("products"); ok {
+		t.Error("Expected products schema to be invalidated")
+	}
+	if _, ok := cache.GetPlan("plan-products"); ok {
+		t.Error("Expected plan routing to products to be invalidated")
+	}
+	if _, ok := cache.GetQuery("query-products"); ok {
+		t.Error("Expected query result tagged with products to be invalidated")
+	}
+
+	if _, ok := cache.GetSchema("users"); !ok {
+		t.Error("Expected users schema to be kept")
+	}
+	if _, ok := cache.GetPlan("plan-users"); !ok {
+		t.Error("Expected plan not routing to products to be kept")
+	}
+	for _, key := range []string{"query-users", "query-untagged"} {
+		if _, ok := cache.GetQuery(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+
+	if evicts := cache.Stats().TotalEvicts; evicts != 3 {
+		t.Errorf("Expected 3 evictions, got %d", evicts)
+	}
+}
+
+func TestMemoryCache_HitAgeHistogram(t *testing.T) {
+	c := NewMemoryCache(nil, &MockLogger{})
+	memoryCache := c.(*MemoryCache)
+	response := &federationtypes.GraphQLResponse{Data: map[string]interface{}{"ok": true}}
+
+	ages := map[string]time.Duration{
+		"fresh":   0,
+		"recent":  5 * time.Second,
+		"older":   45 * time.Second,
+		"stale":   90 * time.Second,
+		"ancient": 2 * time.Hour,
+	}
+	for key, age := range ages {
+		c.SetQuery(key, response, 3*time.Hour)
+		memoryCache.queryCache[key].CreatedAt = time.Now().Add(-age)
+	}
+	c.SetPlan("plan", &federationtypes.ExecutionPlan{}, time.Minute)
+
+	for key := range ages {
+		if _, ok := c.GetQuery(key); !ok {
+			t.Fatalf("Expected %s to hit", key)
+		}
+	}
+	c.GetQuery("fresh")
+	c.GetQuery("missing")
+	c.GetPlan("plan")
+
+	stats := c.Stats()
+	want := []int64{2, 1, 0, 1, 1, 0, 0, 1}
+	if len(stats.QueryHitAges.Buckets) != len(want) {
+		t.Fatalf("Expected %d buckets, got %d", len(want), len(stats.QueryHitAges.Buckets))
+	}
+	for i, bucket := range stats.QueryHitAges.Buckets {
+		if bucket.Count != want[i] {
+			t.Errorf("Bucket %d (<= %v): expected %d hits, got %d", i, bucket.UpperBound, want[i], bucket.Count)
+		}
+	}
+	if last := stats.QueryHitAges.Buckets[len(want)-1]; last.UpperBound != 0 {
+		t.Errorf("Expected the last bucket to be unbounded, got %v", last.UpperBound)
+	}
+	if stats.QueryHitAges.Count != 6 || stats.QueryHitAges.Sum < 2*time.Hour {
+		t.Errorf("Unexpected query hit age totals: count=%d sum=%v", stats.QueryHitAges.Count, stats.QueryHitAges.Sum)
+	}
+
+	if stats.PlanHitAges.Count != 1 || stats.PlanHitAges.Buckets[0].Count != 1 {
+		t.Errorf("Expected one fresh plan hit, got %+v", stats.PlanHitAges)
+	}
+	if stats.SchemaHitAges.Count != 0 {
+		t.Errorf("Expected no schema hits, got %+v", stats.SchemaHitAges)
+	}
+}
+
+func TestMemoryCache_MaxValueBytes(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.CleanupInterval = 0
+	config.QueryCache.MaxValueBytes = 256
+	cache := NewMemoryCache(config, &MockLogger{})
+
+	small := &federationtypes.GraphQLResponse{Data: map[string]interface{}{"id": "1"}}
+	large := &federationtypes.GraphQLResponse{Data: map[string]interface{}{"blob": strings.Repeat("x", 1024)}}
+
+	for _, key := range []string{"small-1", "small-2"} {
+		if err := cache.SetQuery(key, small, time.Minute); err != nil {
+			t.Fatalf("SetQuery(%s) error = %v", key, err)
+		}
+	}
+	if err := cache.SetQuery("large", large, time.Minute); err != nil {
+		t.Fatalf("Expected oversized response to be skipped without error, got %v", err)
+	}
+	// 同键的旧结果被过大的新结果替换时一并删除
+	cache.SetQuery("small-2", large, time.Minute)
+
+	if _, ok := cache.GetQuery("large"); ok {
+		t.Error("Expected oversized response not to be cached")
+	}
+	if _, ok := cache.GetQuery("small-2"); ok {
+		t.Error("Expected stale entry to be dropped when its replacement is oversized")
+	}
+	if _, ok := cache.GetQuery("small-1"); !ok {
+		t.Error("Expected small response to remain cached")
+	}
+
+	stats := cache.Stats()
+	if stats.QuerySkips != 2 || stats.QuerySets != 2 || cache.Size() != 1 {
+		t.Errorf("Unexpected stats: skips=%d sets=%d size=%d", stats.QuerySkips, stats.QuerySets, cache.Size())
+	}
+}
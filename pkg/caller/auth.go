@@ -0,0 +1,286 @@
+package caller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+const (
+	// DefaultAuthScheme Authorization 头默认使用的认证方案
+	DefaultAuthScheme = "Bearer"
+	// DefaultTokenTimeout 令牌请求的默认超时
+	DefaultTokenTimeout = 5 * time.Second
+	// DefaultTokenRefreshBefore 默认在令牌过期前多久刷新
+	DefaultTokenRefreshBefore = 30 * time.Second
+	// DefaultTokenTTL 令牌响应未给出 expires_in 时的默认有效期
+	DefaultTokenTTL = 5 * time.Minute
+	// TokenFailureBackoff 令牌刷新失败后再次请求令牌端点前的等待时间
+	TokenFailureBackoff = 5 * time.Second
+)
+
+// tokenFetchFunc 从令牌端点获取令牌，返回令牌及其有效期（0 表示未给出）
+type tokenFetchFunc func(ctx context.Context, service string, auth *federationtypes.ServiceAuthConfig) (string, time.Duration, error)
+
+// cachedToken 服务令牌缓存，mu 保证同一服务同时只有一个刷新请求，其余调用等待其结果
+type cachedToken struct {
+	mu        sync.Mutex
+	endpoint  string
+	token     string
+	ttl       time.Duration // 令牌的有效期，用于限制提前刷新的时间
+	expiresAt time.Time
+
+	retryAt   time.Time // 刷新失败后，在此之前不再请求令牌端点
+	lastError error
+}
+
+// authorizationHeader 返回服务调用需要注入的 Authorization 头值，未配置认证时返回空串
+func (c *WASMCaller) authorizationHeader(ctx context.Context, service *federationtypes.ServiceConfig) (string, error) {
+	auth := service.Auth
+	if auth == nil {
+		return "", nil
+	}
+
+	scheme := auth.Scheme
+	if scheme == "" {
+		scheme = DefaultAuthScheme
+	}
+
+	if auth.TokenEndpoint == "" {
+		if auth.Token == "" {
+			return "", nil
+		}
+		return scheme + " " + auth.Token, nil
+	}
+
+	token, err := c.serviceToken(ctx, service.Name, auth)
+	if err != nil {
+		return "", err
+	}
+	return scheme + " " + token, nil
+}
+
+// serviceToken 返回缓存的令牌，临近过期时刷新，提前刷新的时间不超过令牌有效期的一半；
+// 刷新失败后 TokenFailureBackoff 内不再请求令牌端点，期间令牌已过期时直接返回认证错误
+func (c *WASMCaller) serviceToken(ctx context.Context, service string, auth *federationtypes.ServiceAuthConfig) (string, error) {
+	value, _ := c.tokens.LoadOrStore(service, &cachedToken{})
+	entry := value.(*cachedToken)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// 令牌端点变更后丢弃旧令牌
+	if entry.endpoint != auth.TokenEndpoint {
+		entry.endpoint = auth.TokenEndpoint
+		entry.token = ""
+		entry.ttl = 0
+		entry.expiresAt = time.Time{}
+		entry.retryAt = time.Time{}
+		entry.lastError = nil
+	}
+
+	refreshBefore := auth.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultTokenRefreshBefore
+	}
+	// 有效期较短的令牌不能一取到就进入刷新窗口
+	if entry.ttl > 0 && refreshBefore > entry.ttl/2 {
+		refreshBefore = entry.ttl / 2
+	}
+
+	now := time.Now()
+	if entry.token != "" && now.Add(refreshBefore).Before(entry.expiresAt) {
+		return entry.token, nil
+	}
+
+	var err error
+	var token string
+	var ttl time.Duration
+	if now.Before(entry.retryAt) {
+		err = entry.lastError
+	} else {
+		token, ttl, err = c.fetchToken(ctx, service, auth)
+		if err == nil && token == "" {
+			err = fmt.Errorf("token endpoint returned an empty token")
+		}
+		if err != nil {
+			entry.retryAt = now.Add(TokenFailureBackoff)
+			entry.lastError = err
+		}
+	}
+	if err != nil {
+		// 提前刷新失败时，尚未过期的令牌仍可使用，绝不发送已过期的令牌
+		if entry.token != "" && now.Before(entry.expiresAt) {
+			c.logger.Warn("Token refresh failed, using unexpired token", "service", service, "error", err)
+			return entry.token, nil
+		}
+		entry.token = ""
+		return "", errors.NewServiceCallError(service,
+			fmt.Sprintf("failed to obtain auth token: %v", err),
+			errors.WithExtension("reason", "AUTH_TOKEN_UNAVAILABLE"),
+		)
+	}
+
+	if ttl <= 0 {
+		ttl = auth.DefaultTTL
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	entry.token = token
+	entry.ttl = ttl
+	entry.expiresAt = now.Add(ttl)
+	entry.retryAt = time.Time{}
+	entry.lastError = nil
+	c.logger.Debug("Refreshed auth token", "service", service, "ttl", ttl)
+	return token, nil
+}
+
+// tokenResponse 令牌端点的响应，兼容 OAuth2 与简单的 {"token": ...} 格式
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	Token       string      `json:"token"`
+	ExpiresIn   interface{} `json:"expires_in"`
+}
+
+// parseTokenResponse 解析令牌端点的响应体
+func parseTokenResponse(body []byte) (string, time.Duration, error) {
+	var response tokenResponse
+	if err := jsonutil.Unmarshal(body, &response); err != nil {
+		return "", 0, fmt.Errorf("invalid token response: %v", err)
+	}
+
+	token := response.AccessToken
+	if token == "" {
+		token = response.Token
+	}
+
+	var seconds float64
+	switch v := response.ExpiresIn.(type) {
+	case int64:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	case string:
+		seconds, _ = strconv.ParseFloat(v, 64)
+	}
+	return token, time.Duration(seconds * float64(time.Second)), nil
+}
+
+// endpointPath 返回端点地址中的路径部分，未包含路径时为 /
+func endpointPath(endpoint string) string {
+	if idx := strings.Index(endpoint, "://"); idx >= 0 {
+		endpoint = endpoint[idx+3:]
+	}
+	if idx := strings.Index(endpoint, "/"); idx >= 0 {
+		return endpoint[idx:]
+	}
+	return "/"
+}
+
+// fetchTokenHTTP 通过宿主 HTTP 调用向令牌端点请求令牌
+func (c *WASMCaller) fetchTokenHTTP(ctx context.Context, service string, auth *federationtypes.ServiceAuthConfig) (string, time.Duration, error) {
+	clusterName := utils.ClusterName(auth.TokenEndpoint)
+	if !c.isClusterAllowed(clusterName) {
+		return "", 0, fmt.Errorf("token cluster %q is not allowed", clusterName)
+	}
+
+	timeout := auth.TokenTimeout
+	if timeout <= 0 {
+		timeout = DefaultTokenTimeout
+	}
+
+	method := "GET"
+	if auth.TokenRequestBody != "" {
+		method = "POST"
+	}
+	headers := [][2]string{
+		{":method", method},
+		{":path", endpointPath(auth.TokenEndpoint)},
+		{":authority", clusterName},
+		{"accept", "application/json"},
+	}
+	for key, value := range auth.TokenRequestHeaders {
+		headers = append(headers, [2]string{key, value})
+	}
+
+	type tokenResult struct {
+		token string
+		ttl   time.Duration
+		err   error
+	}
+	results := make(chan tokenResult, 1)
+
+	_, err := c.dispatchWithBackoff(ctx, service, func() (uint32, error) {
+		return c.dispatch(clusterName, headers, []byte(auth.TokenRequestBody), [][2]string{}, uint32(timeout.Milliseconds()),
+			func(numHeaders, bodySize, numTrailers int) {
+				var result tokenResult
+				defer func() { results <- result }()
+
+				responseHeaders, err := proxywasm.GetHttpCallResponseHeaders()
+				if err != nil {
+					result.err = fmt.Errorf("failed to get token response headers: %v", err)
+					return
+				}
+				for _, header := range responseHeaders {
+					if header[0] == ":status" && !strings.HasPrefix(header[1], "2") {
+						result.err = fmt.Errorf("token endpoint returned status %s", header[1])
+						return
+					}
+				}
+
+				body, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
+				if err != nil {
+					result.err = fmt.Errorf("failed to get token response body: %v", err)
+					return
+				}
+				result.token, result.ttl, result.err = parseTokenResponse(body)
+			},
+		)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	select {
+	case result := <-results:
+		return result.token, result.ttl, result.err
+	case <-ctx.Done():
+		return "", 0, ctx.Err()
+	case <-time.After(timeout):
+		return "", 0, fmt.Errorf("token request timed out after %v", timeout)
+	}
+}
+
+// authClusters 返回服务令牌端点所在的集群
+func authClusters(config *federationtypes.FederationConfig) []string {
+	var clusters []string
+	for _, service := range config.Services {
+		if service.Auth != nil && service.Auth.TokenEndpoint != "" {
+			clusters = append(clusters, utils.ClusterName(service.Auth.TokenEndpoint))
+		}
+	}
+	return clusters
+}
+
+// setHeader 设置头部，替换已有的同名头部（不区分大小写）
+func setHeader(headers [][2]string, name, value string) [][2]string {
+	result := headers[:0]
+	for _, header := range headers {
+		if !strings.EqualFold(header[0], name) {
+			result = append(result, header)
+		}
+	}
+	return append(result, [2]string{name, value})
+}
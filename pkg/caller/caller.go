@@ -2,27 +2,47 @@ package caller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	stderrors "errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	proxytypes "github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 
 	"envoy-wasm-graphql-federation/pkg/errors"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
 )
 
 // WASMCaller 实现基于WASM代理的服务调用器
 type WASMCaller struct {
 	logger      federationtypes.Logger
-	healthCache sync.Map // 健康状态缓存
+	healthCache sync.Map   // 健康状态缓存
+	healthMutex sync.Mutex // 串行化健康状态的读取-修改-写入，避免并发调用丢失计数
+	latencies   sync.Map   // 服务延迟样本 map[string]*latencyTracker
 	metrics     *CallerMetrics
 	config      *CallerConfig
+	dispatch    dispatchFunc      // 发起宿主 HTTP 调用，默认为 proxywasm.DispatchHttpCall
+	workerPool  *utils.WorkerPool // 批量调用使用的共享协程池，为空时每个调用单独启动 goroutine
+	lastReap    int64             // 上次清理空闲健康状态的时间（UnixNano）
+
+	allowedClusters atomic.Pointer[map[string]bool] // 允许分发的上游集群，为空表示尚未加载配置，不做限制
+
+	tokens     sync.Map       // 服务认证令牌缓存 map[string]*cachedToken
+	fetchToken tokenFetchFunc // 从令牌端点获取令牌，默认通过宿主 HTTP 调用
 }
 
+// dispatchFunc 与 proxywasm.DispatchHttpCall 签名一致的调用分发函数
+type dispatchFunc func(cluster string, headers [][2]string, body []byte, trailers [][2]string, timeoutMillisecond uint32, callBack func(numHeaders, bodySize, numTrailers int)) (uint32, error)
+
 // CallerConfig 调用器配置
 type CallerConfig struct {
 	DefaultTimeout   time.Duration
@@ -34,8 +54,31 @@ type CallerConfig struct {
 	MaxIdleConns     int
 	MaxConnsPerHost  int
 	IdleConnTimeout  time.Duration
+	HedgePercentile  float64 // 对冲延迟使用的延迟百分位，如 0.95
+	HedgeMinSamples  int     // 使用百分位前所需的最少样本数
+
+	DebugBodyMaxLength int          // 调试记录请求/响应体的最大长度
+	BodyRedactor       BodyRedactor // 调试记录前对请求/响应体的额外脱敏处理，可为空
+
+	DispatchRetries int           // 宿主调用队列已满时的本地重试次数，与上游失败重试无关
+	DispatchBackoff time.Duration // 本地重试的初始退避时间，每次重试翻倍
+
+	RetryBackoff time.Duration // 上游失败重试前的初始退避时间，每次重试翻倍，0 表示立即重试
+
+	UnhealthyThreshold int // 连续失败多少次后将服务标记为不健康，在 HealthCheckCache 时间内有效
+
+	HealthIdleTimeout time.Duration // 健康状态条目超过该时间未更新即移除，0 表示不按空闲时间清理
 }
 
+// BodyRedactor 调试记录请求/响应体前的脱敏钩子
+type BodyRedactor func(serviceName string, body string) string
+
+// redactedValue 脱敏后的占位值
+const redactedValue = utils.RedactedValue
+
+// idempotencyKeyHeader 变更调用携带的幂等键头部，子图需据此去重以保证重试安全
+const idempotencyKeyHeader = "idempotency-key"
+
 // CallerMetrics 调用器指标
 type CallerMetrics struct {
 	TotalCalls      int64
@@ -43,7 +86,12 @@ type CallerMetrics struct {
 	FailedCalls     int64
 	AvgLatency      int64 // 纳秒
 	TimeoutCount    int64
-	RetryCount      int64
+	RetryCount      int64 // 重发上游请求的次数，包括重试和对冲请求
+	HedgedCalls     int64 // 发出对冲请求的次数
+	HedgeWins       int64 // 对冲请求先于原请求返回的次数
+
+	DispatchRetries  int64 // 因宿主调用队列已满而进行的本地重试次数
+	DispatchRejected int64 // 退避后仍无法分发而放弃的调用次数
 }
 
 // HealthStatus 健康状态
@@ -54,6 +102,8 @@ type HealthStatus struct {
 	Error      error
 	CheckCount int64
 	FailCount  int64
+
+	ConsecutiveFailures int64 // 连续失败次数，成功调用后清零
 }
 
 // NewHTTPCaller 创建新的WASM调用器
@@ -62,11 +112,14 @@ func NewHTTPCaller(config *CallerConfig, logger federationtypes.Logger) federati
 		config = DefaultCallerConfig()
 	}
 
-	return &WASMCaller{
-		logger:  logger,
-		metrics: &CallerMetrics{},
-		config:  config,
+	caller := &WASMCaller{
+		logger:   logger,
+		metrics:  &CallerMetrics{},
+		config:   config,
+		dispatch: proxywasm.DispatchHttpCall,
 	}
+	caller.fetchToken = caller.fetchTokenHTTP
+	return caller
 }
 
 // DefaultCallerConfig 返回默认配置
@@ -81,6 +134,19 @@ func DefaultCallerConfig() *CallerConfig {
 		MaxIdleConns:     100,
 		MaxConnsPerHost:  10,
 		IdleConnTimeout:  90 * time.Second,
+		HedgePercentile:  0.95,
+		HedgeMinSamples:  20,
+
+		DebugBodyMaxLength: 2048,
+
+		DispatchRetries: 3,
+		DispatchBackoff: 5 * time.Millisecond,
+
+		RetryBackoff: 50 * time.Millisecond,
+
+		UnhealthyThreshold: 3,
+
+		HealthIdleTimeout: 10 * time.Minute,
 	}
 }
 
@@ -116,7 +182,66 @@ func (c *WASMCaller) Call(ctx context.Context, call *federationtypes.ServiceCall
 		return nil, errors.NewServiceError("failed to marshal request: " + err.Error())
 	}
 
+	if c.shouldLogBodies(call.Service) {
+		c.logRequestBody(call.Service, request)
+	}
+
 	// 构建HTTP头
+	headers, err := c.requestHeaders(ctx, call, requestBody)
+	if err != nil {
+		c.recordFailure()
+		return nil, err
+	}
+
+	// 使用WASM HTTP调用
+	// 注意：在实际的WASM环境中，我们需要使用适当的cluster名称
+	// 这里我们简化处理，假设endpoint就是cluster名称
+	clusterName := c.extractClusterName(call.Service.Endpoint)
+
+	// 发起HTTP调用（这是一个简化版本，实际中需要更复杂的实现）
+	// 在WASM环境中，我们通常通过配置的upstream cluster来调用
+	attempt := func(attemptCtx context.Context, attemptStart time.Time) (*federationtypes.ServiceResponse, error) {
+		return c.makeWASMHTTPCall(attemptCtx, clusterName, requestBody, headers, call, attemptStart, 0)
+	}
+
+	var response *federationtypes.ServiceResponse
+	maxRetries := c.maxRetries(call)
+	for retry := 0; ; retry++ {
+		if c.shouldHedge(call) {
+			response, err = c.hedgedCall(ctx, c.hedgeDelay(call.Service), attempt)
+		} else {
+			response, err = attempt(ctx, startTime)
+		}
+
+		if err == nil || retry >= maxRetries || ctx.Err() != nil || !isRetryableCallError(err) {
+			break
+		}
+
+		if !c.waitRetryBackoff(ctx, retry) {
+			break
+		}
+		atomic.AddInt64(&c.metrics.RetryCount, 1)
+		c.logger.Debug("Retrying service call",
+			"service", call.Service.Name,
+			"retry", retry+1,
+			"error", err,
+		)
+	}
+
+	c.recordCallHealth(call.Service.Name, err)
+
+	if err == nil {
+		response.RequestSize = int64(len(requestBody))
+		c.recordServiceLatency(call.Service.Name, response.Latency)
+		if c.shouldLogBodies(call.Service) {
+			c.logResponseBody(call.Service, response)
+		}
+	}
+	return response, err
+}
+
+// requestHeaders 构建服务调用的HTTP头，获取认证令牌失败时返回错误
+func (c *WASMCaller) requestHeaders(ctx context.Context, call *federationtypes.ServiceCall, requestBody []byte) ([][2]string, error) {
 	headers := [][2]string{
 		{"content-type", "application/json"},
 		{"user-agent", "envoy-wasm-graphql-federation"},
@@ -129,14 +254,379 @@ func (c *WASMCaller) Call(ctx context.Context, call *federationtypes.ServiceCall
 		}
 	}
 
-	// 使用WASM HTTP调用
-	// 注意：在实际的WASM环境中，我们需要使用适当的cluster名称
-	// 这里我们简化处理，假设endpoint就是cluster名称
-	clusterName := c.extractClusterName(call.Service.Endpoint)
+	// 添加子查询的头部，如每个子查询独立的 traceparent
+	for key, value := range call.SubQuery.Headers {
+		headers = append(headers, [2]string{key, value})
+	}
 
-	// 发起HTTP调用（这是一个简化版本，实际中需要更复杂的实现）
-	// 在WASM环境中，我们通常通过配置的upstream cluster来调用
-	return c.makeWASMHTTPCall(clusterName, requestBody, headers, call, startTime)
+	// 注入服务间认证令牌，获取失败时不发起调用
+	authorization, err := c.authorizationHeader(ctx, call.Service)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		headers = setHeader(headers, "authorization", authorization)
+	}
+
+	// 变更操作携带幂等键，同一逻辑调用的每次尝试使用相同的键
+	if operationType(call.SubQuery.Query) == "mutation" {
+		if key := idempotencyKey(call, requestBody); key != "" {
+			headers = append(headers, [2]string{idempotencyKeyHeader, key})
+		}
+	}
+
+	return headers, nil
+}
+
+// shouldLogBodies 判断是否记录服务的请求/响应体，仅在服务开启且日志启用 debug 时记录
+func (c *WASMCaller) shouldLogBodies(service *federationtypes.ServiceConfig) bool {
+	return service.DebugLogBodies && utils.IsDebugEnabled(c.logger)
+}
+
+// logRequestBody 以 debug 级别记录脱敏后的子请求
+func (c *WASMCaller) logRequestBody(service *federationtypes.ServiceConfig, request *federationtypes.GraphQLRequest) {
+	redacted := &federationtypes.GraphQLRequest{
+		Query:         request.Query,
+		Variables:     utils.RedactVariables(request.Variables, service.DebugRedactVariables),
+		OperationName: request.OperationName,
+	}
+
+	body, err := jsonutil.Marshal(redacted)
+	if err != nil {
+		c.logger.Debug("Failed to marshal request body for logging", "service", service.Name, "error", err)
+		return
+	}
+
+	c.logger.Debug("Service request body",
+		"service", service.Name,
+		"headers", redactHeaders(service.Headers, service.DebugRedactHeaders),
+		"body", c.formatDebugBody(service.Name, string(body)),
+	)
+}
+
+// logResponseBody 以 debug 级别记录子请求的响应
+func (c *WASMCaller) logResponseBody(service *federationtypes.ServiceConfig, response *federationtypes.ServiceResponse) {
+	if response == nil {
+		return
+	}
+
+	body, err := jsonutil.Marshal(&federationtypes.GraphQLResponse{
+		Data:   response.Data,
+		Errors: response.Errors,
+	})
+	if err != nil {
+		c.logger.Debug("Failed to marshal response body for logging", "service", service.Name, "error", err)
+		return
+	}
+
+	c.logger.Debug("Service response body",
+		"service", service.Name,
+		"body", c.formatDebugBody(service.Name, string(body)),
+	)
+}
+
+// formatDebugBody 应用脱敏钩子并截断调试输出
+func (c *WASMCaller) formatDebugBody(serviceName, body string) string {
+	if c.config.BodyRedactor != nil {
+		body = c.config.BodyRedactor(serviceName, body)
+	}
+
+	if c.config.DebugBodyMaxLength > 0 {
+		body = utils.TruncateString(body, c.config.DebugBodyMaxLength)
+	}
+
+	return body
+}
+
+// redactHeaders 返回将指定头部替换为占位值的副本，头部名称不区分大小写
+func redactHeaders(headers map[string]string, names []string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if containsFold(names, key) {
+			redacted[key] = redactedValue
+		} else {
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+// containsFold 不区分大小写地判断名称是否在列表中
+func containsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRetries 返回调用允许的上游失败重试次数。
+// 变更操作可能在子图重复执行，只有服务声明 IdempotentMutations 时才重试
+func (c *WASMCaller) maxRetries(call *federationtypes.ServiceCall) int {
+	if call.SubQuery == nil {
+		return 0
+	}
+	if operationType(call.SubQuery.Query) == "mutation" && !call.Service.IdempotentMutations {
+		return 0
+	}
+
+	retries := call.SubQuery.RetryCount
+	if retries > c.config.MaxRetries {
+		retries = c.config.MaxRetries
+	}
+	if retries < 0 {
+		return 0
+	}
+	return retries
+}
+
+// waitRetryBackoff 在第 retry+1 次上游重试前退避，退避时间从 RetryBackoff 开始每次翻倍；
+// 上下文在等待期间结束时返回 false，调用方放弃重试并返回上一次的错误
+func (c *WASMCaller) waitRetryBackoff(ctx context.Context, retry int) bool {
+	backoff := c.config.RetryBackoff << uint(retry)
+	if backoff <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// recordCallHealth 根据调用结果更新健康状态，连续上游失败达到阈值时标记为不健康；
+// 本地队列已满等非上游错误不计入
+func (c *WASMCaller) recordCallHealth(serviceName string, err error) {
+	if err != nil && !isRetryableCallError(err) {
+		return
+	}
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+
+	status := &HealthStatus{Healthy: true, LastCheck: time.Now()}
+	if cached, ok := c.healthCache.Load(serviceName); ok {
+		previous := cached.(*HealthStatus)
+		status.CheckCount = previous.CheckCount
+		status.FailCount = previous.FailCount
+		status.ConsecutiveFailures = previous.ConsecutiveFailures
+	}
+
+	status.CheckCount++
+	if err != nil {
+		status.FailCount++
+		status.ConsecutiveFailures++
+		status.Error = err
+		threshold := int64(c.config.UnhealthyThreshold)
+		status.Healthy = threshold <= 0 || status.ConsecutiveFailures < threshold
+	} else {
+		status.ConsecutiveFailures = 0
+	}
+
+	if !status.Healthy {
+		c.logger.Warn("Service marked unhealthy after consecutive failures",
+			"service", serviceName,
+			"consecutiveFailures", status.ConsecutiveFailures,
+		)
+	}
+	c.storeHealth(serviceName, status)
+}
+
+// isRetryableCallError 判断上游调用失败是否可重试，本地分发能力不足不属于上游故障，不再重试
+func isRetryableCallError(err error) bool {
+	if fedErr, ok := err.(*errors.FederationError); ok {
+		switch fedErr.Extensions["reason"] {
+		case "LOCAL_DISPATCH_QUEUE_FULL", "CLUSTER_NOT_ALLOWED":
+			return false
+		}
+	}
+	return errors.IsRetryableError(err)
+}
+
+// idempotencyKey 根据请求 ID、服务名和请求体生成稳定的幂等键，缺少请求 ID 时不生成
+func idempotencyKey(call *federationtypes.ServiceCall, requestBody []byte) string {
+	if call.Context == nil || call.Context.RequestID == "" {
+		return ""
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(call.Context.RequestID))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(call.Service.Name))
+	hasher.Write([]byte{0})
+	hasher.Write(requestBody)
+	return hex.EncodeToString(hasher.Sum(nil))[:32]
+}
+
+// shouldHedge 判断是否对调用启用对冲，只对冲幂等的查询操作
+func (c *WASMCaller) shouldHedge(call *federationtypes.ServiceCall) bool {
+	if call.Service.HedgeAfter <= 0 || call.SubQuery == nil {
+		return false
+	}
+
+	return operationType(call.SubQuery.Query) == "query"
+}
+
+// operationType 返回查询文本的操作类型，匿名简写视为 query
+func operationType(query string) string {
+	query = strings.TrimSpace(query)
+
+	// 跳过前导注释
+	for strings.HasPrefix(query, "#") {
+		if idx := strings.Index(query, "\n"); idx != -1 {
+			query = strings.TrimSpace(query[idx+1:])
+		} else {
+			return ""
+		}
+	}
+
+	for _, operation := range []string{"mutation", "subscription", "query"} {
+		if strings.HasPrefix(query, operation) {
+			return operation
+		}
+	}
+
+	if strings.HasPrefix(query, "{") {
+		return "query"
+	}
+
+	return ""
+}
+
+// hedgeResult 对冲调用的结果
+type hedgeResult struct {
+	response *federationtypes.ServiceResponse
+	err      error
+	hedge    bool
+}
+
+// hedgedCall 在延迟后发出第二个相同请求，返回先成功的结果并取消另一个
+func (c *WASMCaller) hedgedCall(ctx context.Context, delay time.Duration, attempt func(context.Context, time.Time) (*federationtypes.ServiceResponse, error)) (*federationtypes.ServiceResponse, error) {
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // 取消落后的请求
+
+	results := make(chan hedgeResult, 2)
+	launch := func(hedge bool) {
+		go func() {
+			response, err := attempt(hedgeCtx, time.Now())
+			results <- hedgeResult{response: response, err: err, hedge: hedge}
+		}()
+	}
+
+	launch(false)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	hedged := false
+	pending := 1
+	var firstErr error
+
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				atomic.AddInt64(&c.metrics.HedgedCalls, 1)
+				atomic.AddInt64(&c.metrics.RetryCount, 1) // 对冲请求是对同一调用的再次发送
+				launch(true)
+			}
+
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				if result.hedge {
+					atomic.AddInt64(&c.metrics.HedgeWins, 1)
+				}
+				return result.response, nil
+			}
+
+			// 对冲只针对慢请求，原请求在对冲前失败时直接返回错误
+			if !hedged {
+				return nil, result.err
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// latencyTracker 记录服务最近的延迟样本
+type latencyTracker struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// latencySampleSize 每个服务保留的延迟样本数
+const latencySampleSize = 100
+
+// record 记录延迟样本
+func (t *latencyTracker) record(latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.samples) < latencySampleSize {
+		t.samples = append(t.samples, latency)
+		return
+	}
+	t.samples[t.next] = latency
+	t.next = (t.next + 1) % latencySampleSize
+}
+
+// percentile 返回延迟百分位及样本数
+func (t *latencyTracker) percentile(p float64) (time.Duration, int) {
+	t.mutex.Lock()
+	sorted := make([]time.Duration, len(t.samples))
+	copy(sorted, t.samples)
+	t.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(p * float64(len(sorted)-1))
+	return sorted[index], len(sorted)
+}
+
+// recordServiceLatency 记录服务延迟
+func (c *WASMCaller) recordServiceLatency(serviceName string, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	value, _ := c.latencies.LoadOrStore(serviceName, &latencyTracker{})
+	value.(*latencyTracker).record(latency)
+}
+
+// hedgeDelay 计算对冲延迟：样本充足时使用观测到的百分位延迟，否则使用 HedgeAfter
+func (c *WASMCaller) hedgeDelay(service *federationtypes.ServiceConfig) time.Duration {
+	value, ok := c.latencies.Load(service.Name)
+	if !ok || c.config.HedgePercentile <= 0 {
+		return service.HedgeAfter
+	}
+
+	delay, samples := value.(*latencyTracker).percentile(c.config.HedgePercentile)
+	if samples < c.config.HedgeMinSamples || delay <= 0 {
+		return service.HedgeAfter
+	}
+	return delay
 }
 
 // CallBatch 批量调用服务（使用channel实现并发控制）
@@ -145,6 +635,11 @@ func (c *WASMCaller) CallBatch(ctx context.Context, calls []*federationtypes.Ser
 		return nil, nil
 	}
 
+	// 发往同一个支持批量请求的服务时合并为一次 HTTP 调用
+	if isNativeBatch(calls) {
+		return c.callNativeBatch(ctx, calls)
+	}
+
 	c.logger.Debug("Executing batch calls with channel-based concurrency", "count", len(calls))
 
 	// 使用channel收集结果
@@ -157,11 +652,12 @@ func (c *WASMCaller) CallBatch(ctx context.Context, calls []*federationtypes.Ser
 	resultChan := make(chan callResult, len(calls))
 	responses := make([]*federationtypes.ServiceResponse, len(calls))
 
-	// 使用goroutine并发执行调用
+	// 通过共享协程池并发执行调用
 	var wg sync.WaitGroup
 	for i, call := range calls {
+		idx, serviceCall := i, call
 		wg.Add(1)
-		go func(idx int, serviceCall *federationtypes.ServiceCall) {
+		c.submit(func() {
 			defer wg.Done()
 
 			resp, err := c.Call(ctx, serviceCall)
@@ -173,7 +669,7 @@ func (c *WASMCaller) CallBatch(ctx context.Context, calls []*federationtypes.Ser
 				// 上下文取消，直接返回
 				return
 			}
-		}(i, call)
+		})
 	}
 
 	// 等待所有goroutine完成
@@ -217,7 +713,9 @@ func (c *WASMCaller) IsHealthy(ctx context.Context, service *federationtypes.Ser
 	}
 
 	// 在WASM环境中，我们简化健康检查逻辑
-	// 检查缓存
+	// 检查缓存，与 recordCallHealth 的更新串行执行
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
 	if cached, ok := c.healthCache.Load(service.Name); ok {
 		status := cached.(*HealthStatus)
 		if time.Since(status.LastCheck) < c.config.HealthCheckCache {
@@ -233,41 +731,88 @@ func (c *WASMCaller) IsHealthy(ctx context.Context, service *federationtypes.Ser
 		Healthy:   healthy,
 		LastCheck: time.Now(),
 	}
-	c.healthCache.Store(service.Name, status)
+	c.storeHealth(service.Name, status)
 
 	return healthy
 }
 
 // extractClusterName 从Domain或URL中提取cluster名称
 func (c *WASMCaller) extractClusterName(endpoint string) string {
-	// 简化处理：移除http://或https://前缀
-	if strings.HasPrefix(endpoint, "http://") {
-		endpoint = endpoint[7:]
-	} else if strings.HasPrefix(endpoint, "https://") {
-		endpoint = endpoint[8:]
-	}
+	return utils.ClusterName(endpoint)
+}
 
-	// 移除路径部分
-	if idx := strings.Index(endpoint, "/"); idx > 0 {
-		endpoint = endpoint[:idx]
-	}
+// dispatchWithBackoff 分发 HTTP 调用，宿主调用队列已满时短暂退避后重试。
+// 重试耗尽后返回 SERVICE_UNAVAILABLE，表明是本地分发能力不足而非上游故障
+func (c *WASMCaller) dispatchWithBackoff(ctx context.Context, serviceName string, dispatch func() (uint32, error)) (uint32, error) {
+	backoff := c.config.DispatchBackoff
+	for attempt := 0; ; attempt++ {
+		calloutID, err := dispatch()
+		if err == nil || !isDispatchQueueFull(err) {
+			return calloutID, err
+		}
 
-	// 移除端口号（如果有）
-	if idx := strings.Index(endpoint, ":"); idx > 0 {
-		endpoint = endpoint[:idx]
+		if attempt >= c.config.DispatchRetries {
+			atomic.AddInt64(&c.metrics.DispatchRejected, 1)
+			c.logger.Warn("HTTP call dispatch rejected, local callout queue is full",
+				"service", serviceName,
+				"attempts", attempt+1,
+			)
+			return 0, errors.NewUnavailableError(serviceName,
+				"local dispatch capacity exhausted: callout queue is full",
+				errors.WithCause(err),
+				errors.WithExtension("reason", "LOCAL_DISPATCH_QUEUE_FULL"),
+			)
+		}
+
+		atomic.AddInt64(&c.metrics.DispatchRetries, 1)
+		c.logger.Debug("HTTP call dispatch queue full, backing off",
+			"service", serviceName,
+			"attempt", attempt+1,
+			"backoff", backoff,
+		)
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
+}
+
+// isDispatchQueueFull 判断分发失败是否因为宿主的待处理调用已满。
+// Envoy 在无法启动异步调用（如超出待处理请求上限）时返回 InternalFailure；
+// 未知状态码和 BadArgument 等其他错误原样返回，不重试
+func isDispatchQueueFull(err error) bool {
+	return stderrors.Is(err, proxytypes.ErrorInternalFailure)
+}
 
-	return endpoint
+// upstreamAuthority 返回上游请求的 :authority，服务配置了 Authority 时优先使用
+func upstreamAuthority(service *federationtypes.ServiceConfig, clusterName string) string {
+	if service != nil && service.Authority != "" {
+		return service.Authority
+	}
+	return clusterName
 }
 
-// makeWASMHTTPCall 使用WASM进行HTTP调用
-func (c *WASMCaller) makeWASMHTTPCall(clusterName string, requestBody []byte, headers [][2]string, call *federationtypes.ServiceCall, startTime time.Time) (*federationtypes.ServiceResponse, error) {
+// makeWASMHTTPCall 使用WASM进行HTTP调用，batchSize 大于 0 时按批量请求解析数组响应
+func (c *WASMCaller) makeWASMHTTPCall(ctx context.Context, clusterName string, requestBody []byte, headers [][2]string, call *federationtypes.ServiceCall, startTime time.Time, batchSize int) (*federationtypes.ServiceResponse, error) {
 	c.logger.Debug("Making WASM HTTP call",
 		"cluster", clusterName,
 		"service", call.Service.Name,
 		"bodySize", len(requestBody),
 	)
 
+	// 只向允许列表中的集群分发，防止错误的服务配置把请求发往非预期的上游
+	if !c.isClusterAllowed(clusterName) {
+		c.logger.Warn("Blocked dispatch to cluster not in allowlist", "cluster", clusterName, "service", call.Service.Name)
+		return nil, errors.NewServiceError(
+			fmt.Sprintf("upstream cluster %q is not allowed", clusterName),
+			errors.WithService(call.Service.Name),
+			errors.WithExtension("reason", "CLUSTER_NOT_ALLOWED"),
+		)
+	}
+
 	// 构建HTTP调用的路径（通常是GraphQL端点）
 	path := "/graphql"
 	if call.Service.Path != "" {
@@ -278,7 +823,7 @@ func (c *WASMCaller) makeWASMHTTPCall(clusterName string, requestBody []byte, he
 	methodHeaders := [][2]string{
 		{":method", "POST"},
 		{":path", path},
-		{":authority", clusterName},
+		{":authority", upstreamAuthority(call.Service, clusterName)},
 	}
 	// 合并头部
 	allHeaders := append(methodHeaders, headers...)
@@ -286,30 +831,36 @@ func (c *WASMCaller) makeWASMHTTPCall(clusterName string, requestBody []byte, he
 	// 记录调用开始
 	atomic.AddInt64(&c.metrics.TotalCalls, 1)
 
-	proxywasm.LogDebugf("Dispatching HTTP call to cluster: %s, path: %s", clusterName, path)
-
 	// 使用proxywasm.DispatchHttpCall进行实际的HTTP调用
 	// 创建处理器
 	var handler *WASMHTTPCallHandler
-	calloutID, err := proxywasm.DispatchHttpCall(
-		clusterName,   // 上游集群名称
-		allHeaders,    // HTTP头部（包括方法和路径）
-		requestBody,   // 请求体
-		[][2]string{}, // 跟踪头（通常为空）
-		uint32(call.Service.Timeout.Milliseconds()), // 超时时间（毫秒）
-		func(numHeaders, bodySize, numTrailers int) {
-			// HTTP调用响应回调
-			if handler != nil {
-				handler.OnHttpCallResponse(numHeaders, bodySize, numTrailers)
-			}
-		},
-	)
+	calloutID, err := c.dispatchWithBackoff(ctx, call.Service.Name, func() (uint32, error) {
+		return c.dispatch(
+			clusterName,   // 上游集群名称
+			allHeaders,    // HTTP头部（包括方法和路径）
+			requestBody,   // 请求体
+			[][2]string{}, // 跟踪头（通常为空）
+			uint32(call.Service.Timeout.Milliseconds()), // 超时时间（毫秒）
+			func(numHeaders, bodySize, numTrailers int) {
+				// HTTP调用响应回调
+				if handler != nil {
+					handler.OnHttpCallResponse(numHeaders, bodySize, numTrailers)
+				}
+			},
+		)
+	})
 
 	// 初始化处理器
 	handler = NewWASMHTTPCallHandler(calloutID)
+	handler.service = call.Service.Name
+	handler.batchSize = batchSize
+	handler.maxDecompressedBytes = call.Service.MaxDecompressedBytes
 
 	if err != nil {
 		c.recordFailure()
+		if _, ok := err.(*errors.FederationError); ok {
+			return nil, err
+		}
 		return nil, errors.NewServiceError(fmt.Sprintf("failed to dispatch HTTP call: %v", err))
 	}
 
@@ -317,7 +868,7 @@ func (c *WASMCaller) makeWASMHTTPCall(clusterName string, requestBody []byte, he
 
 	// 由于proxy-wasm的HTTP调用是异步的，我们使用channel进行同步等待
 	// 通过handler的Wait方法等待响应，该方法使用channel实现异步通信
-	response, err := handler.Wait(call.Service.Timeout)
+	response, err := handler.WaitContext(ctx, call.Service.Timeout)
 
 	// 清理资源
 	defer handler.Close()
@@ -325,6 +876,9 @@ func (c *WASMCaller) makeWASMHTTPCall(clusterName string, requestBody []byte, he
 	if err != nil {
 		c.recordFailure()
 		proxywasm.LogErrorf("HTTP call failed, calloutID=%d, error=%v", calloutID, err)
+		if _, ok := err.(*errors.FederationError); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("HTTP call failed: %v", err)
 	}
 
@@ -346,6 +900,10 @@ type WASMHTTPCallHandler struct {
 	errorChan    chan error
 	processed    bool
 	mutex        sync.Mutex
+
+	service              string
+	batchSize            int   // 批量请求包含的操作数，0 表示单个操作
+	maxDecompressedBytes int64 // 解压后响应体的字节上限
 }
 
 // NewWASMHTTPCallHandler 创建新的HTTP调用处理器
@@ -396,15 +954,27 @@ func (h *WASMHTTPCallHandler) OnHttpCallResponse(numHeaders, bodySize, numTraile
 		if header[0] == ":status" {
 			status = header[1]
 		} else {
-			headerMap[header[0]] = header[1]
+			appendHeader(headerMap, header[0], header[1])
 		}
 	}
 
 	proxywasm.LogInfof("HTTP call response: status=%s, bodySize=%d, calloutID=%d", status, bodySize, h.calloutID)
 
+	// 按 Content-Encoding 解压，解压后的响应体不再带编码
+	if len(responseBody) > 0 && headerMap["content-encoding"] != "" {
+		responseBody, err = decompressResponseBody(h.service, headerMap["content-encoding"], responseBody, h.maxDecompressedBytes)
+		if err != nil {
+			proxywasm.LogErrorf("Failed to decompress response body: %v", err)
+			h.sendError(err)
+			return
+		}
+		delete(headerMap, "content-encoding")
+	}
+
 	// 创建响应对象
 	response := &federationtypes.ServiceResponse{
-		Headers: headerMap,
+		Headers:  headerMap,
+		BodySize: int64(bodySize),
 		Metadata: map[string]interface{}{
 			"status_code":    status,
 			"callout_id":     h.calloutID,
@@ -414,23 +984,30 @@ func (h *WASMHTTPCallHandler) OnHttpCallResponse(numHeaders, bodySize, numTraile
 		},
 	}
 
-	// 解析GraphQL响应体
-	if bodySize > 0 && len(responseBody) > 0 {
-		var graphqlResponse federationtypes.GraphQLResponse
-		if err := jsonutil.Unmarshal(responseBody, &graphqlResponse); err != nil {
+	// 解析GraphQL响应体，非 JSON 响应（如错误页）作为服务错误返回，不当作空的成功响应
+	if bodySize > 0 && len(responseBody) > 0 && h.batchSize > 0 {
+		batch, err := decodeGraphQLBatchResponse(h.service, status, headerMap["content-type"], responseBody, h.batchSize)
+		if err != nil {
+			proxywasm.LogErrorf("Failed to parse GraphQL batch response: %v", err)
+			h.sendError(err)
+			return
+		}
+		response.Metadata[batchResponsesMetadataKey] = batch
+	} else if bodySize > 0 && len(responseBody) > 0 {
+		graphqlResponse, err := decodeGraphQLResponse(h.service, status, headerMap["content-type"], responseBody)
+		if err != nil {
 			proxywasm.LogErrorf("Failed to parse GraphQL response: %v", err)
-			// 即使解析失败，也要返回原始响应数据
-			response.Metadata["raw_body"] = string(responseBody)
-			response.Metadata["parse_error"] = err.Error()
-		} else {
-			proxywasm.LogDebugf("GraphQL response parsed successfully, calloutID=%d", h.calloutID)
-			response.Data = graphqlResponse.Data
-			response.Errors = graphqlResponse.Errors
-			// 合并extensions到metadata
-			if graphqlResponse.Extensions != nil {
-				for k, v := range graphqlResponse.Extensions {
-					response.Metadata[k] = v
-				}
+			h.sendError(err)
+			return
+		}
+
+		proxywasm.LogDebugf("GraphQL response parsed successfully, calloutID=%d", h.calloutID)
+		response.Data = graphqlResponse.Data
+		response.Errors = graphqlResponse.Errors
+		// 合并extensions到metadata
+		if graphqlResponse.Extensions != nil {
+			for k, v := range graphqlResponse.Extensions {
+				response.Metadata[k] = v
 			}
 		}
 	} else {
@@ -441,6 +1018,66 @@ func (h *WASMHTTPCallHandler) OnHttpCallResponse(numHeaders, bodySize, numTraile
 	h.sendResponse(response)
 }
 
+// maxResponseSnippetBytes 响应格式错误中附带的响应体片段上限
+const maxResponseSnippetBytes = 256
+
+// decodeGraphQLResponse 解析子图响应体。Content-Type 明确不是 JSON 或响应体无法解析为
+// GraphQL 响应对象时返回 INVALID_RESPONSE_FORMAT 错误，附带状态码、Content-Type 和截断的响应体片段
+func decodeGraphQLResponse(service, status, contentType string, body []byte) (*federationtypes.GraphQLResponse, error) {
+	invalid := func(message string, cause error) error {
+		opts := []errors.ErrorOption{
+			errors.WithExtension("statusCode", status),
+			errors.WithExtension("contentType", contentType),
+			errors.WithExtension("bodySnippet", responseSnippet(body)),
+		}
+		if cause != nil {
+			opts = append(opts, errors.WithCause(cause))
+		}
+		return errors.NewInvalidResponseFormatError(service, message, opts...)
+	}
+
+	if mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0])); mediaType != "" && !strings.Contains(mediaType, "json") {
+		return nil, invalid(fmt.Sprintf("subgraph returned non-JSON content type %q", mediaType), nil)
+	}
+
+	// jsonutil.Unmarshal 对非法输入较宽松，先校验响应体是合法的 JSON 对象
+	if trimmed := strings.TrimSpace(string(body)); !strings.HasPrefix(trimmed, "{") || !jsonutil.Valid(body) {
+		return nil, invalid("subgraph response is not a JSON object", nil)
+	}
+
+	var graphqlResponse federationtypes.GraphQLResponse
+	if err := jsonutil.Unmarshal(body, &graphqlResponse); err != nil {
+		return nil, invalid("subgraph response is not a valid JSON GraphQL response", err)
+	}
+	return &graphqlResponse, nil
+}
+
+// responseSnippet 截取响应体开头用于诊断，不截断多字节字符
+func responseSnippet(body []byte) string {
+	if len(body) <= maxResponseSnippetBytes {
+		return string(body)
+	}
+
+	end := maxResponseSnippetBytes
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return string(body[:end]) + "..."
+}
+
+// appendHeader 记录上游响应头，重复的 set-cookie 以换行分隔（其值可能包含逗号），其余按 HTTP 语义以逗号拼接
+func appendHeader(headers map[string]string, name, value string) {
+	existing, exists := headers[name]
+	switch {
+	case !exists:
+		headers[name] = value
+	case strings.EqualFold(name, "set-cookie"):
+		headers[name] = existing + "\n" + value
+	default:
+		headers[name] = existing + ", " + value
+	}
+}
+
 // sendResponse 通过channel发送响应
 func (h *WASMHTTPCallHandler) sendResponse(response *federationtypes.ServiceResponse) {
 	select {
@@ -465,10 +1102,19 @@ func (h *WASMHTTPCallHandler) sendError(err error) {
 
 // Wait 通过channel等待响应完成
 func (h *WASMHTTPCallHandler) Wait(timeout time.Duration) (*federationtypes.ServiceResponse, error) {
+	return h.WaitContext(context.Background(), timeout)
+}
+
+// WaitContext 等待响应完成，上下文取消时提前返回
+func (h *WASMHTTPCallHandler) WaitContext(ctx context.Context, timeout time.Duration) (*federationtypes.ServiceResponse, error) {
 	proxywasm.LogDebugf("Waiting for HTTP response via channel, calloutID=%d, timeout=%v", h.calloutID, timeout)
 
-	// 使用select语句同时等待响应、错误和超时
+	// 使用select语句同时等待响应、错误、取消和超时
 	select {
+	case <-ctx.Done():
+		proxywasm.LogDebugf("HTTP call wait cancelled, calloutID=%d", h.calloutID)
+		return nil, ctx.Err()
+
 	case response := <-h.responseChan:
 		proxywasm.LogDebugf("Received response via channel, calloutID=%d", h.calloutID)
 		return response, nil
@@ -517,6 +1163,20 @@ func (c *WASMCaller) updateLatency(latency time.Duration) {
 	atomic.StoreInt64(&c.metrics.AvgLatency, newAvg)
 }
 
+// SetWorkerPool 设置批量调用使用的共享协程池
+func (c *WASMCaller) SetWorkerPool(pool *utils.WorkerPool) {
+	c.workerPool = pool
+}
+
+// submit 将任务提交到协程池，未设置时单独启动 goroutine
+func (c *WASMCaller) submit(task func()) {
+	if c.workerPool == nil {
+		go task()
+		return
+	}
+	c.workerPool.Submit(task)
+}
+
 // GetMetrics 获取调用器指标
 func (c *WASMCaller) GetMetrics() *CallerMetrics {
 	return &CallerMetrics{
@@ -526,6 +1186,11 @@ func (c *WASMCaller) GetMetrics() *CallerMetrics {
 		AvgLatency:      atomic.LoadInt64(&c.metrics.AvgLatency),
 		TimeoutCount:    atomic.LoadInt64(&c.metrics.TimeoutCount),
 		RetryCount:      atomic.LoadInt64(&c.metrics.RetryCount),
+		HedgedCalls:     atomic.LoadInt64(&c.metrics.HedgedCalls),
+		HedgeWins:       atomic.LoadInt64(&c.metrics.HedgeWins),
+
+		DispatchRetries:  atomic.LoadInt64(&c.metrics.DispatchRetries),
+		DispatchRejected: atomic.LoadInt64(&c.metrics.DispatchRejected),
 	}
 }
 
@@ -541,6 +1206,8 @@ func (c *WASMCaller) GetHealthStatus(serviceName string) *HealthStatus {
 			Error:      status.Error,
 			CheckCount: status.CheckCount,
 			FailCount:  status.FailCount,
+
+			ConsecutiveFailures: status.ConsecutiveFailures,
 		}
 	}
 	return nil
@@ -553,3 +1220,115 @@ func (c *WASMCaller) ClearHealthCache() {
 		return true
 	})
 }
+
+// storeHealth 写入健康状态，距上次清理超过 HealthIdleTimeout 时顺带清理空闲条目
+func (c *WASMCaller) storeHealth(serviceName string, status *HealthStatus) {
+	c.healthCache.Store(serviceName, status)
+
+	idle := c.config.HealthIdleTimeout
+	if idle <= 0 {
+		return
+	}
+	now := status.LastCheck.UnixNano()
+	last := atomic.LoadInt64(&c.lastReap)
+	if now-last >= int64(idle) && atomic.CompareAndSwapInt64(&c.lastReap, last, now) {
+		c.ReapHealthCache(nil)
+	}
+}
+
+// ReapHealthCache 移除不在 activeServices 中的服务以及超过 HealthIdleTimeout 未更新的健康状态，返回移除的条目数；
+// activeServices 为 nil 时只按空闲时间清理
+func (c *WASMCaller) ReapHealthCache(activeServices []string) int {
+	var active map[string]bool
+	if activeServices != nil {
+		active = make(map[string]bool, len(activeServices))
+		for _, name := range activeServices {
+			active[name] = true
+		}
+	}
+
+	idle := c.config.HealthIdleTimeout
+	removed := 0
+	c.healthCache.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		status := value.(*HealthStatus)
+		if (active != nil && !active[name]) || (idle > 0 && time.Since(status.LastCheck) > idle) {
+			c.healthCache.Delete(key)
+			removed++
+		}
+		return true
+	})
+
+	return removed
+}
+
+// OnConfigReload 配置重载后移除已不在配置中的服务的健康状态
+func (c *WASMCaller) OnConfigReload(oldConfig, newConfig *federationtypes.FederationConfig) error {
+	if newConfig == nil {
+		return nil
+	}
+
+	activeServices := make([]string, 0, len(newConfig.Services))
+	for _, service := range newConfig.Services {
+		activeServices = append(activeServices, service.Name)
+	}
+
+	if removed := c.ReapHealthCache(activeServices); removed > 0 {
+		c.logger.Info("Reaped stale health entries", "removed", removed, "services", len(activeServices))
+	}
+
+	// 移除已不在配置中的服务的令牌缓存
+	active := make(map[string]bool, len(activeServices))
+	for _, name := range activeServices {
+		active[name] = true
+	}
+	c.tokens.Range(func(key, _ interface{}) bool {
+		if !active[key.(string)] {
+			c.tokens.Delete(key)
+		}
+		return true
+	})
+
+	c.SetAllowedClusters(AllowedClusters(newConfig))
+	return nil
+}
+
+// AllowedClusters 返回配置允许分发的上游集群：配置了 allowedClusters 时使用该列表，
+// 否则由各服务的 endpoint、镜像端点、认证令牌端点及持久化查询注册中心推导
+func AllowedClusters(config *federationtypes.FederationConfig) []string {
+	if len(config.AllowedClusters) > 0 {
+		return config.AllowedClusters
+	}
+
+	clusters := make([]string, 0, len(config.Services))
+	for _, service := range config.Services {
+		clusters = append(clusters, utils.ClusterName(service.Endpoint))
+		if service.ShadowEndpoint != "" {
+			clusters = append(clusters, utils.ClusterName(service.ShadowEndpoint))
+		}
+	}
+	if config.PersistedQueryRegistry != nil && config.PersistedQueryRegistry.Endpoint != "" {
+		clusters = append(clusters, utils.ClusterName(config.PersistedQueryRegistry.Endpoint))
+	}
+	return append(clusters, authClusters(config)...)
+}
+
+// SetAllowedClusters 设置允许分发的上游集群
+func (c *WASMCaller) SetAllowedClusters(clusters []string) {
+	allowed := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		allowed[cluster] = true
+	}
+	c.allowedClusters.Store(&allowed)
+}
+
+// isClusterAllowed 检查集群是否在允许列表中，未设置允许列表时不限制
+func (c *WASMCaller) isClusterAllowed(cluster string) bool {
+	allowed := c.allowedClusters.Load()
+	return allowed == nil || (*allowed)[cluster]
+}
+
+// GetName 返回重载处理器名称
+func (c *WASMCaller) GetName() string {
+	return "WASMCaller"
+}
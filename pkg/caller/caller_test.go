@@ -1,11 +1,22 @@
 package caller
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	proxytypes "github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/persisted"
 	"envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
 )
 
 // MockLogger 实现 Logger 接口用于测试
@@ -280,3 +291,778 @@ func TestWASMCaller_ClearHealthCache(t *testing.T) {
 		t.Errorf("Expected health cache to be empty, but found %d entries", count)
 	}
 }
+
+func TestWASMCaller_hedgedCall(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+
+	// 原请求较慢，对冲请求先返回，原请求被取消
+	var calls int32
+	primaryCancelled := make(chan struct{})
+	attempt := func(ctx context.Context, start time.Time) (*types.ServiceResponse, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			close(primaryCancelled)
+			return nil, ctx.Err()
+		}
+		return &types.ServiceResponse{Service: "hedge"}, nil
+	}
+
+	response, err := caller.hedgedCall(context.Background(), 10*time.Millisecond, attempt)
+	if err != nil {
+		t.Fatalf("hedgedCall() error = %v", err)
+	}
+	if response.Service != "hedge" {
+		t.Errorf("Expected hedged response, got %s", response.Service)
+	}
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected losing request to be cancelled")
+	}
+
+	// 原请求在延迟内返回，不发出对冲请求
+	fast := func(ctx context.Context, start time.Time) (*types.ServiceResponse, error) {
+		return &types.ServiceResponse{Service: "primary"}, nil
+	}
+	if _, err := caller.hedgedCall(context.Background(), time.Second, fast); err != nil {
+		t.Fatalf("hedgedCall() error = %v", err)
+	}
+
+	metrics := caller.GetMetrics()
+	if metrics.HedgedCalls != 1 || metrics.HedgeWins != 1 {
+		t.Errorf("Expected 1 hedged call and 1 hedge win, got %d and %d", metrics.HedgedCalls, metrics.HedgeWins)
+	}
+	if metrics.RetryCount != 1 {
+		t.Errorf("Expected hedged request to be counted as a retry, got RetryCount %d", metrics.RetryCount)
+	}
+}
+
+func TestWASMCaller_shouldHedge(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	service := &types.ServiceConfig{Name: "users", HedgeAfter: 50 * time.Millisecond}
+
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"{ users { id } }", true},
+		{"query GetUsers { users { id } }", true},
+		{"# comment\nquery { users { id } }", true},
+		{"mutation { createUser { id } }", false},
+		{"subscription { userAdded { id } }", false},
+	}
+
+	for _, tt := range tests {
+		call := &types.ServiceCall{Service: service, SubQuery: &types.SubQuery{Query: tt.query}}
+		if got := caller.shouldHedge(call); got != tt.expected {
+			t.Errorf("shouldHedge(%q) = %v, want %v", tt.query, got, tt.expected)
+		}
+	}
+
+	disabled := &types.ServiceCall{Service: &types.ServiceConfig{Name: "users"}, SubQuery: &types.SubQuery{Query: "{ users { id } }"}}
+	if caller.shouldHedge(disabled) {
+		t.Error("Expected hedging to be disabled without HedgeAfter")
+	}
+}
+
+func TestWASMCaller_hedgeDelay(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	service := &types.ServiceConfig{Name: "users", HedgeAfter: 200 * time.Millisecond}
+
+	// 样本不足时使用配置的延迟
+	if delay := caller.hedgeDelay(service); delay != service.HedgeAfter {
+		t.Errorf("Expected configured delay, got %v", delay)
+	}
+
+	for i := 1; i <= 100; i++ {
+		caller.recordServiceLatency("users", time.Duration(i)*time.Millisecond)
+	}
+
+	// 样本充足时使用观测到的 p95 延迟
+	if delay := caller.hedgeDelay(service); delay != 95*time.Millisecond {
+		t.Errorf("Expected p95 delay of 95ms, got %v", delay)
+	}
+}
+
+func TestWASMCaller_logRequestBody_Redaction(t *testing.T) {
+	config := DefaultCallerConfig()
+	config.DebugBodyMaxLength = 200
+	config.BodyRedactor = func(serviceName string, body string) string {
+		return strings.ReplaceAll(body, "alice@example.com", "***")
+	}
+
+	logger := &MockLogger{}
+	caller := NewHTTPCaller(config, logger).(*WASMCaller)
+
+	service := &types.ServiceConfig{
+		Name:                 "users",
+		DebugLogBodies:       true,
+		Headers:              map[string]string{"Authorization": "Bearer secret", "X-Trace": "abc"},
+		DebugRedactHeaders:   []string{"authorization"},
+		DebugRedactVariables: []string{"token"},
+	}
+	request := &types.GraphQLRequest{
+		Query:     "query($token: String, $email: String) { me { id } }",
+		Variables: map[string]interface{}{"token": "t-123", "email": "alice@example.com"},
+	}
+
+	if !caller.shouldLogBodies(service) {
+		t.Fatal("Expected body logging to be enabled")
+	}
+	caller.logRequestBody(service, request)
+
+	if len(logger.logs) != 1 {
+		t.Fatalf("Expected 1 log entry, got %d", len(logger.logs))
+	}
+	fields := logger.logs[0].Fields
+	headers := fields[3].(map[string]string)
+	if headers["Authorization"] != redactedValue || headers["X-Trace"] != "abc" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	body := fields[5].(string)
+	if strings.Contains(body, "t-123") || strings.Contains(body, "alice@example.com") {
+		t.Errorf("Expected body to be redacted, got %s", body)
+	}
+	if request.Variables["token"] != "t-123" {
+		t.Error("Expected original variables to be untouched")
+	}
+}
+
+func TestWASMCaller_shouldLogBodies(t *testing.T) {
+	service := &types.ServiceConfig{Name: "users", DebugLogBodies: true}
+
+	caller := NewHTTPCaller(nil, utils.NewLoggerWithDebug("test", false)).(*WASMCaller)
+	if caller.shouldLogBodies(service) {
+		t.Error("Expected body logging to be disabled when debug level is off")
+	}
+
+	caller = NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	if caller.shouldLogBodies(&types.ServiceConfig{Name: "users"}) {
+		t.Error("Expected body logging to be off by default")
+	}
+}
+
+func TestWASMCaller_formatDebugBody_Truncates(t *testing.T) {
+	config := DefaultCallerConfig()
+	config.DebugBodyMaxLength = 10
+	caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+
+	body := caller.formatDebugBody("users", strings.Repeat("x", 50))
+	if len(body) != 10 || !strings.HasSuffix(body, "...") {
+		t.Errorf("Expected truncated body, got %q", body)
+	}
+}
+
+func TestUpstreamAuthority(t *testing.T) {
+	if got := upstreamAuthority(&types.ServiceConfig{Name: "users"}, "users-cluster"); got != "users-cluster" {
+		t.Errorf("Expected cluster name fallback, got %s", got)
+	}
+
+	service := &types.ServiceConfig{Name: "reviews", Authority: "reviews.internal.example.com"}
+	if got := upstreamAuthority(service, "shared-ingress"); got != "reviews.internal.example.com" {
+		t.Errorf("Expected authority override, got %s", got)
+	}
+}
+
+func TestWASMCaller_dispatchWithBackoff(t *testing.T) {
+	config := DefaultCallerConfig()
+	config.DispatchRetries = 2
+	config.DispatchBackoff = time.Millisecond
+
+	t.Run("recovers after queue drains", func(t *testing.T) {
+		caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+		attempts := 0
+		calloutID, err := caller.dispatchWithBackoff(context.Background(), "users", func() (uint32, error) {
+			attempts++
+			if attempts < 3 {
+				return 0, proxytypes.ErrorInternalFailure
+			}
+			return 42, nil
+		})
+		if err != nil || calloutID != 42 {
+			t.Fatalf("Expected dispatch to succeed after retries, got %d, %v", calloutID, err)
+		}
+		if metrics := caller.GetMetrics(); metrics.DispatchRetries != 2 || metrics.DispatchRejected != 0 {
+			t.Errorf("Unexpected dispatch metrics: %+v", metrics)
+		}
+	})
+
+	t.Run("reports local capacity", func(t *testing.T) {
+		caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+		_, err := caller.dispatchWithBackoff(context.Background(), "users", func() (uint32, error) {
+			return 0, proxytypes.ErrorInternalFailure
+		})
+
+		var fedErr *errors.FederationError
+		if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeUnavailable {
+			t.Fatalf("Expected SERVICE_UNAVAILABLE, got %v", err)
+		}
+		if fedErr.Extensions["reason"] != "LOCAL_DISPATCH_QUEUE_FULL" {
+			t.Errorf("Expected local capacity reason, got %+v", fedErr.Extensions)
+		}
+		if metrics := caller.GetMetrics(); metrics.DispatchRetries != 2 || metrics.DispatchRejected != 1 {
+			t.Errorf("Unexpected dispatch metrics: %+v", metrics)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		for _, dispatchErr := range []error{proxytypes.ErrorStatusBadArgument, stderrors.New("unknown status code: 99")} {
+			caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+			attempts := 0
+			_, err := caller.dispatchWithBackoff(context.Background(), "users", func() (uint32, error) {
+				attempts++
+				return 0, dispatchErr
+			})
+			if err != dispatchErr || attempts != 1 {
+				t.Errorf("Expected single attempt with original error %v, got %d attempts, %v", dispatchErr, attempts, err)
+			}
+		}
+	})
+}
+
+func TestWASMCaller_maxRetries_Mutations(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+
+	query := &types.ServiceCall{
+		Service:  &types.ServiceConfig{Name: "users"},
+		SubQuery: &types.SubQuery{Query: "query { users { id } }", RetryCount: 2},
+	}
+	if got := caller.maxRetries(query); got != 2 {
+		t.Errorf("Expected queries to retry twice, got %d", got)
+	}
+
+	mutation := &types.ServiceCall{
+		Service:  &types.ServiceConfig{Name: "payments"},
+		SubQuery: &types.SubQuery{Query: "mutation { charge(amount: 10) { id } }", RetryCount: 2},
+	}
+	if got := caller.maxRetries(mutation); got != 0 {
+		t.Errorf("Expected mutations not to retry by default, got %d", got)
+	}
+
+	mutation.Service.IdempotentMutations = true
+	if got := caller.maxRetries(mutation); got != 2 {
+		t.Errorf("Expected idempotent mutations to retry, got %d", got)
+	}
+
+	mutation.SubQuery.RetryCount = 10
+	if got := caller.maxRetries(mutation); got != caller.config.MaxRetries {
+		t.Errorf("Expected retries capped at MaxRetries, got %d", got)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	body := []byte(`{"query":"mutation { charge(amount: 10) { id } }"}`)
+	call := &types.ServiceCall{
+		Service: &types.ServiceConfig{Name: "payments"},
+		Context: &types.QueryContext{RequestID: "req-1"},
+	}
+
+	key := idempotencyKey(call, body)
+	if key == "" || key != idempotencyKey(call, body) {
+		t.Fatalf("Expected deterministic idempotency key, got %q", key)
+	}
+
+	other := &types.ServiceCall{
+		Service: call.Service,
+		Context: &types.QueryContext{RequestID: "req-2"},
+	}
+	if idempotencyKey(other, body) == key {
+		t.Error("Expected different requests to use different keys")
+	}
+
+	if idempotencyKey(&types.ServiceCall{Service: call.Service}, body) != "" {
+		t.Error("Expected no key without a request ID")
+	}
+}
+
+func TestIsRetryableCallError(t *testing.T) {
+	if !isRetryableCallError(errors.NewTimeoutError("users", "timed out")) {
+		t.Error("Expected upstream timeout to be retryable")
+	}
+
+	local := errors.NewUnavailableError("users", "queue full", errors.WithExtension("reason", "LOCAL_DISPATCH_QUEUE_FULL"))
+	if isRetryableCallError(local) {
+		t.Error("Expected local dispatch capacity errors not to be retried upstream")
+	}
+}
+
+func TestWASMCaller_AllowedClusters(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	dispatched := 0
+	caller.dispatch = func(cluster string, headers [][2]string, body []byte, trailers [][2]string, timeoutMillisecond uint32, callBack func(numHeaders, bodySize, numTrailers int)) (uint32, error) {
+		dispatched++
+		return 1, nil
+	}
+
+	if !caller.isClusterAllowed("anything") {
+		t.Error("Expected no restriction before the allowlist is loaded")
+	}
+
+	// 默认由服务 endpoint 推导
+	config := &types.FederationConfig{
+		Services: []types.ServiceConfig{{Name: "users", Endpoint: "http://users:8080/graphql"}},
+	}
+	if err := caller.OnConfigReload(nil, config); err != nil {
+		t.Fatalf("OnConfigReload() error = %v", err)
+	}
+	if !caller.isClusterAllowed("users") || caller.isClusterAllowed("internal-admin") {
+		t.Errorf("Expected allowlist derived from endpoints, got %v", *caller.allowedClusters.Load())
+	}
+
+	call := &types.ServiceCall{
+		Service:  &types.ServiceConfig{Name: "users", Endpoint: "http://internal-admin/graphql", Timeout: time.Second},
+		SubQuery: &types.SubQuery{ServiceName: "users", Query: "{ users { id } }"},
+	}
+	_, err := caller.Call(context.Background(), call)
+
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeServiceCall || fedErr.Extensions["reason"] != "CLUSTER_NOT_ALLOWED" {
+		t.Fatalf("Expected CLUSTER_NOT_ALLOWED service error, got %v", err)
+	}
+	if dispatched != 0 {
+		t.Errorf("Expected dispatch to unlisted cluster to be blocked, got %d dispatches", dispatched)
+	}
+
+	// 显式配置的允许列表优先
+	config.AllowedClusters = []string{"users", "internal-admin"}
+	if err := caller.OnConfigReload(nil, config); err != nil {
+		t.Fatalf("OnConfigReload() error = %v", err)
+	}
+	if !caller.isClusterAllowed("internal-admin") {
+		t.Error("Expected configured cluster to be allowed")
+	}
+}
+
+func TestWASMCaller_AllowedClustersPersistedQueryRegistry(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	var dispatchedClusters []string
+	var mutex sync.Mutex
+	caller.dispatch = func(cluster string, headers [][2]string, body []byte, trailers [][2]string, timeoutMillisecond uint32, callBack func(numHeaders, bodySize, numTrailers int)) (uint32, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dispatchedClusters = append(dispatchedClusters, cluster)
+		return 0, proxytypes.ErrorStatusBadArgument
+	}
+
+	config := &types.FederationConfig{
+		Services: []types.ServiceConfig{{Name: "users", Endpoint: "http://users:8080/graphql"}},
+		PersistedQueryRegistry: &types.PersistedQueryRegistryConfig{
+			Endpoint: "http://pq-registry/graphql",
+		},
+	}
+	if err := caller.OnConfigReload(nil, config); err != nil {
+		t.Fatalf("OnConfigReload() error = %v", err)
+	}
+	if !caller.isClusterAllowed("pq-registry") {
+		t.Errorf("Expected registry cluster in derived allowlist, got %v", *caller.allowedClusters.Load())
+	}
+
+	// 注册中心查询经允许列表分发，而不是被 CLUSTER_NOT_ALLOWED 拦截
+	store := persisted.NewRemoteStore(config.PersistedQueryRegistry, nil, caller, &MockLogger{})
+	store.Get(persisted.HashQuery("{ users { id } }"))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(dispatchedClusters) != 1 || dispatchedClusters[0] != "pq-registry" {
+		t.Errorf("Expected registry lookup to be dispatched to pq-registry, got %v", dispatchedClusters)
+	}
+}
+
+func TestWASMCaller_recordCallHealth(t *testing.T) {
+	config := DefaultCallerConfig()
+	config.UnhealthyThreshold = 2
+	caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+	service := &types.ServiceConfig{Name: "users"}
+
+	upstreamErr := errors.NewUnavailableError("users", "connection refused")
+
+	caller.recordCallHealth("users", upstreamErr)
+	if !caller.IsHealthy(context.Background(), service) {
+		t.Fatal("Expected service to stay healthy below the threshold")
+	}
+
+	caller.recordCallHealth("users", upstreamErr)
+	if caller.IsHealthy(context.Background(), service) {
+		t.Fatal("Expected service to be unhealthy after consecutive failures")
+	}
+	if status := caller.GetHealthStatus("users"); status.ConsecutiveFailures != 2 || status.FailCount != 2 {
+		t.Errorf("Unexpected health status: %+v", status)
+	}
+
+	// 本地队列已满不计入上游健康
+	local := errors.NewUnavailableError("users", "queue full", errors.WithExtension("reason", "LOCAL_DISPATCH_QUEUE_FULL"))
+	caller.recordCallHealth("users", local)
+	if status := caller.GetHealthStatus("users"); status.ConsecutiveFailures != 2 {
+		t.Errorf("Local dispatch failures should not count, got %+v", status)
+	}
+
+	caller.recordCallHealth("users", nil)
+	if !caller.IsHealthy(context.Background(), service) {
+		t.Error("Expected a successful call to restore health")
+	}
+	if status := caller.GetHealthStatus("users"); status.ConsecutiveFailures != 0 {
+		t.Errorf("Expected consecutive failures to reset, got %+v", status)
+	}
+}
+
+func TestWASMCaller_ReapHealthCache(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	ctx := context.Background()
+
+	oldConfig := &types.FederationConfig{Services: []types.ServiceConfig{{Name: "users"}, {Name: "orders"}}}
+	for i := range oldConfig.Services {
+		caller.IsHealthy(ctx, &oldConfig.Services[i])
+	}
+
+	// 移除 orders 服务后重载
+	newConfig := &types.FederationConfig{Services: []types.ServiceConfig{{Name: "users"}}}
+	if err := caller.OnConfigReload(oldConfig, newConfig); err != nil {
+		t.Fatalf("OnConfigReload() error = %v", err)
+	}
+	if caller.GetHealthStatus("orders") != nil {
+		t.Error("Expected health entry of removed service to be reaped")
+	}
+	if caller.GetHealthStatus("users") == nil {
+		t.Error("Expected health entry of active service to be kept")
+	}
+
+	// 超过空闲时间未更新的条目被移除
+	caller.healthCache.Store("users", &HealthStatus{Healthy: true, LastCheck: time.Now().Add(-2 * caller.config.HealthIdleTimeout)})
+	if removed := caller.ReapHealthCache(nil); removed != 1 {
+		t.Errorf("Expected 1 idle entry reaped, got %d", removed)
+	}
+	if caller.GetHealthStatus("users") != nil {
+		t.Error("Expected idle health entry to be reaped")
+	}
+}
+
+func TestAppendHeader(t *testing.T) {
+	headers := make(map[string]string)
+	for _, header := range [][2]string{
+		{"set-cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT"},
+		{"set-cookie", "b=2"},
+		{"cache-tag", "product"},
+		{"cache-tag", "user"},
+	} {
+		appendHeader(headers, header[0], header[1])
+	}
+
+	if headers["set-cookie"] != "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\nb=2" {
+		t.Errorf("Expected set-cookie values separated by newline, got %q", headers["set-cookie"])
+	}
+	if headers["cache-tag"] != "product, user" {
+		t.Errorf("Expected repeated headers joined by comma, got %q", headers["cache-tag"])
+	}
+}
+
+func TestDecodeGraphQLResponse_NonJSON(t *testing.T) {
+	html := "<html><head><title>502 Bad Gateway</title></head><body>" + strings.Repeat("upstream unavailable ", 20) + "</body></html>"
+
+	for _, contentType := range []string{"text/html; charset=utf-8", ""} {
+		_, err := decodeGraphQLResponse("users", "200", contentType, []byte(html))
+		var fedErr *errors.FederationError
+		if !stderrors.As(err, &fedErr) {
+			t.Fatalf("Content-Type %q: expected federation error, got %v", contentType, err)
+		}
+		if fedErr.Code != errors.ErrCodeInvalidResponseFormat || fedErr.Service != "users" {
+			t.Errorf("Content-Type %q: unexpected error %v", contentType, fedErr)
+		}
+		snippet, _ := fedErr.Extensions["bodySnippet"].(string)
+		if !strings.HasPrefix(snippet, "<html><head><title>502") || !strings.HasSuffix(snippet, "...") || len(snippet) > maxResponseSnippetBytes+3 {
+			t.Errorf("Content-Type %q: expected truncated body snippet, got %q", contentType, snippet)
+		}
+		if fedErr.Extensions["statusCode"] != "200" {
+			t.Errorf("Expected status code in extensions, got %v", fedErr.Extensions)
+		}
+	}
+
+	response, err := decodeGraphQLResponse("users", "200", "application/graphql-response+json", []byte(`{"data":{"users":[]}}`))
+	if err != nil || response.Data == nil {
+		t.Errorf("Expected valid GraphQL response to decode, got %v, %v", response, err)
+	}
+	if isRetryableCallError(errors.NewInvalidResponseFormatError("users", "bad body")) {
+		t.Error("Expected invalid response format not to be retried")
+	}
+}
+
+func TestDecompressResponseBody(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"data":{"users":[{"id":"1"}]}}`))
+	writer.Close()
+
+	body, err := decompressResponseBody("users", "gzip", compressed.Bytes(), 0)
+	if err != nil {
+		t.Fatalf("decompressResponseBody() error = %v", err)
+	}
+	response, err := decodeGraphQLResponse("users", "200", "application/json", body)
+	if err != nil {
+		t.Fatalf("decodeGraphQLResponse() error = %v", err)
+	}
+	if users, _ := response.Data.(map[string]interface{})["users"].([]interface{}); len(users) != 1 {
+		t.Errorf("Expected decoded users, got %v", response.Data)
+	}
+
+	// 解压后超过上限时拒绝
+	var bomb bytes.Buffer
+	writer = gzip.NewWriter(&bomb)
+	writer.Write(bytes.Repeat([]byte{'a'}, 4096))
+	writer.Close()
+	_, err = decompressResponseBody("users", "gzip", bomb.Bytes(), 1024)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeResponseTooLarge {
+		t.Errorf("Expected RESPONSE_TOO_LARGE for oversized decompressed body, got %v", err)
+	}
+
+	_, err = decompressResponseBody("users", "br", []byte("..."), 0)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeInvalidResponseFormat || fedErr.Extensions["contentEncoding"] != "br" {
+		t.Errorf("Expected INVALID_RESPONSE_FORMAT for unsupported encoding, got %v", err)
+	}
+}
+
+func TestNativeBatch(t *testing.T) {
+	service := &types.ServiceConfig{Name: "products", SupportsBatching: true}
+	calls := []*types.ServiceCall{
+		{Service: service, SubQuery: &types.SubQuery{Query: "query { product }"}},
+		{Service: service, SubQuery: &types.SubQuery{Query: "query Top($n: Int) { top(n: $n) }", Variables: map[string]interface{}{"n": 3}}},
+	}
+	if !isNativeBatch(calls) {
+		t.Fatal("Expected same-service calls to a batching subgraph to be batched")
+	}
+	if isNativeBatch(calls[:1]) || isNativeBatch([]*types.ServiceCall{calls[0], {Service: &types.ServiceConfig{Name: "products"}, SubQuery: calls[1].SubQuery}}) {
+		t.Error("Expected single calls and non-batching services to be called individually")
+	}
+
+	body, err := encodeBatchRequest(calls)
+	if err != nil {
+		t.Fatalf("encodeBatchRequest() error = %v", err)
+	}
+	if !strings.HasPrefix(string(body), "[{") || !strings.Contains(string(body), `"query":"query { product }"`) {
+		t.Errorf("Expected JSON array of operations, got %s", body)
+	}
+
+	batch, err := decodeGraphQLBatchResponse("products", "200", "application/json", []byte(`[{"data":{"product":"p1"}},{"errors":[{"message":"boom"}]}]`), 2)
+	if err != nil {
+		t.Fatalf("decodeGraphQLBatchResponse() error = %v", err)
+	}
+	responses, err := splitBatchResponse(&types.ServiceResponse{
+		Service:  "products",
+		BodySize: 64,
+		Metadata: map[string]interface{}{batchResponsesMetadataKey: batch},
+	}, 2)
+	if err != nil {
+		t.Fatalf("splitBatchResponse() error = %v", err)
+	}
+	if data, _ := responses[0].Data.(map[string]interface{}); data["product"] != "p1" || responses[0].BodySize != 64 {
+		t.Errorf("Unexpected first response: %+v", responses[0])
+	}
+	if len(responses[1].Errors) != 1 || responses[1].Errors[0].Message != "boom" || responses[1].BodySize != 0 {
+		t.Errorf("Unexpected second response: %+v", responses[1])
+	}
+
+	_, err = decodeGraphQLBatchResponse("products", "200", "application/json", []byte(`[{"data":{}}]`), 2)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeInvalidResponseFormat {
+		t.Errorf("Expected INVALID_RESPONSE_FORMAT for a short batch response, got %v", err)
+	}
+}
+
+func TestWASMCaller_StaticAuthToken(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	call := &types.ServiceCall{
+		Service: &types.ServiceConfig{
+			Name:     "users",
+			Endpoint: "http://users/graphql",
+			Headers:  map[string]string{"Authorization": "Basic stale"},
+			Auth:     &types.ServiceAuthConfig{Token: "s3cret"},
+		},
+		SubQuery: &types.SubQuery{ServiceName: "users", Query: "{ users { id } }"},
+	}
+
+	headers, err := caller.requestHeaders(context.Background(), call, nil)
+	if err != nil {
+		t.Fatalf("requestHeaders() error = %v", err)
+	}
+
+	var values []string
+	for _, header := range headers {
+		if strings.EqualFold(header[0], "authorization") {
+			values = append(values, header[1])
+		}
+	}
+	if len(values) != 1 || values[0] != "Bearer s3cret" {
+		t.Errorf("Expected a single injected bearer token, got %v", values)
+	}
+}
+
+func TestWASMCaller_AuthTokenRefresh(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	var fetches int32
+	caller.fetchToken = func(ctx context.Context, service string, auth *types.ServiceAuthConfig) (string, time.Duration, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "token-" + string(rune('0'+n)), time.Minute, nil
+	}
+
+	service := &types.ServiceConfig{
+		Name: "users",
+		Auth: &types.ServiceAuthConfig{TokenEndpoint: "http://auth/token", Scheme: "Token", RefreshBefore: 10 * time.Second},
+	}
+
+	// 并发调用共享一次刷新
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = caller.authorizationHeader(context.Background(), service)
+		}(i)
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Fatalf("Expected a single token fetch for concurrent calls, got %d", fetches)
+	}
+	for _, result := range results {
+		if result != "Token token-1" {
+			t.Fatalf("Expected cached token, got %q", result)
+		}
+	}
+
+	// 进入提前刷新窗口后获取新令牌
+	value, _ := caller.tokens.Load("users")
+	value.(*cachedToken).expiresAt = time.Now().Add(5 * time.Second)
+	if header, err := caller.authorizationHeader(context.Background(), service); err != nil || header != "Token token-2" {
+		t.Fatalf("Expected refreshed token, got %q, %v", header, err)
+	}
+
+	// 刷新失败但令牌未过期时继续使用
+	caller.fetchToken = func(ctx context.Context, service string, auth *types.ServiceAuthConfig) (string, time.Duration, error) {
+		return "", 0, stderrors.New("auth server down")
+	}
+	value.(*cachedToken).expiresAt = time.Now().Add(5 * time.Second)
+	if header, err := caller.authorizationHeader(context.Background(), service); err != nil || header != "Token token-2" {
+		t.Fatalf("Expected unexpired token while refresh fails, got %q, %v", header, err)
+	}
+
+	// 令牌已过期且刷新失败时调用失败，不发送过期令牌
+	value.(*cachedToken).expiresAt = time.Now().Add(-time.Second)
+	dispatched := 0
+	caller.dispatch = func(cluster string, headers [][2]string, body []byte, trailers [][2]string, timeoutMillisecond uint32, callBack func(numHeaders, bodySize, numTrailers int)) (uint32, error) {
+		dispatched++
+		return 1, nil
+	}
+	service.Endpoint = "http://users/graphql"
+	_, err := caller.Call(context.Background(), &types.ServiceCall{
+		Service:  service,
+		SubQuery: &types.SubQuery{ServiceName: "users", Query: "{ users { id } }"},
+	})
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Extensions["reason"] != "AUTH_TOKEN_UNAVAILABLE" {
+		t.Fatalf("Expected AUTH_TOKEN_UNAVAILABLE error, got %v", err)
+	}
+	if dispatched != 0 {
+		t.Errorf("Expected no dispatch without a valid token, got %d", dispatched)
+	}
+}
+
+func TestWASMCaller_AuthTokenRefreshLimits(t *testing.T) {
+	caller := NewHTTPCaller(nil, &MockLogger{}).(*WASMCaller)
+	var fetches int32
+	caller.fetchToken = func(ctx context.Context, service string, auth *types.ServiceAuthConfig) (string, time.Duration, error) {
+		atomic.AddInt32(&fetches, 1)
+		return "short-lived", 20 * time.Second, nil
+	}
+
+	// 有效期短于默认提前刷新时间的令牌不会每次调用都刷新
+	service := &types.ServiceConfig{
+		Name: "users",
+		Auth: &types.ServiceAuthConfig{TokenEndpoint: "http://auth/token"},
+	}
+	for i := 0; i < 3; i++ {
+		if header, err := caller.authorizationHeader(context.Background(), service); err != nil || header != "Bearer short-lived" {
+			t.Fatalf("Expected cached token, got %q, %v", header, err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("Expected refreshBefore to be clamped to the token TTL, got %d fetches", fetches)
+	}
+
+	// 刷新失败后在退避时间内不再请求令牌端点
+	caller.fetchToken = func(ctx context.Context, service string, auth *types.ServiceAuthConfig) (string, time.Duration, error) {
+		atomic.AddInt32(&fetches, 1)
+		return "", 0, stderrors.New("auth server down")
+	}
+	value, _ := caller.tokens.Load("users")
+	value.(*cachedToken).expiresAt = time.Now().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		if _, err := caller.authorizationHeader(context.Background(), service); err == nil {
+			t.Fatal("Expected an error without a valid token")
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("Expected a single failed refresh within the backoff, got %d fetches", fetches-1)
+	}
+
+	value.(*cachedToken).retryAt = time.Now().Add(-time.Second)
+	caller.authorizationHeader(context.Background(), service)
+	if fetches != 3 {
+		t.Errorf("Expected a retry after the backoff, got %d fetches", fetches)
+	}
+}
+
+func TestParseTokenResponse(t *testing.T) {
+	token, ttl, err := parseTokenResponse([]byte(`{"access_token":"abc","expires_in":3600}`))
+	if err != nil || token != "abc" || ttl != time.Hour {
+		t.Errorf("Unexpected OAuth2 result: %q %v %v", token, ttl, err)
+	}
+
+	token, ttl, err = parseTokenResponse([]byte(`{"token":"xyz"}`))
+	if err != nil || token != "xyz" || ttl != 0 {
+		t.Errorf("Unexpected simple result: %q %v %v", token, ttl, err)
+	}
+
+	if _, _, err := parseTokenResponse([]byte(`not json`)); err == nil {
+		t.Error("Expected error for invalid token response")
+	}
+}
+
+func TestWASMCaller_waitRetryBackoff(t *testing.T) {
+	config := DefaultCallerConfig()
+	config.RetryBackoff = 5 * time.Millisecond
+	caller := NewHTTPCaller(config, &MockLogger{}).(*WASMCaller)
+
+	// 退避时间每次翻倍
+	start := time.Now()
+	if !caller.waitRetryBackoff(context.Background(), 1) {
+		t.Fatal("Expected backoff to complete")
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected second retry to wait at least 10ms, waited %v", elapsed)
+	}
+
+	// 上下文结束时放弃重试
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if caller.waitRetryBackoff(ctx, 0) {
+		t.Error("Expected cancelled context to abort the retry")
+	}
+}
+
+func TestWASMCaller_recordCallHealthConcurrent(t *testing.T) {
+	caller := NewHTTPCaller(DefaultCallerConfig(), &MockLogger{}).(*WASMCaller)
+	upstreamErr := errors.NewUnavailableError("users", "connection refused")
+
+	const calls = 100
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			caller.recordCallHealth("users", upstreamErr)
+		}()
+	}
+	wg.Wait()
+
+	if status := caller.GetHealthStatus("users"); status.CheckCount != calls || status.FailCount != calls || status.ConsecutiveFailures != calls {
+		t.Errorf("Expected every concurrent call to be counted, got %+v", status)
+	}
+}
@@ -0,0 +1,77 @@
+package caller
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+)
+
+// DefaultMaxDecompressedBytes 未配置 maxDecompressedBytes 时解压后响应体的字节上限
+const DefaultMaxDecompressedBytes int64 = 16 << 20
+
+// decompressResponseBody 按 Content-Encoding 解压子图响应体，多个编码按应用顺序的逆序解码。
+// 解压结果超过 maxBytes 时返回 RESPONSE_TOO_LARGE，不支持的编码返回 INVALID_RESPONSE_FORMAT
+func decompressResponseBody(service, contentEncoding string, body []byte, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxDecompressedBytes
+	}
+
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+
+		var reader io.Reader
+		var err error
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			// HTTP 的 deflate 应为 zlib 格式，部分实现发送不带 zlib 头的原始 deflate 流
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				reader, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		default:
+			return nil, errors.NewInvalidResponseFormatError(service,
+				fmt.Sprintf("subgraph response uses unsupported content encoding %q", encoding),
+				errors.WithExtension("contentEncoding", encoding),
+			)
+		}
+		if err != nil {
+			return nil, decompressionError(service, encoding, err)
+		}
+
+		// 多读一个字节判断是否超过上限，不把超限的内容整体读入内存
+		decoded, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+		if err != nil {
+			return nil, decompressionError(service, encoding, err)
+		}
+		if int64(len(decoded)) > maxBytes {
+			return nil, errors.NewResponseTooLargeError(
+				fmt.Sprintf("decompressed response from service %s exceeds %d bytes", service, maxBytes),
+				errors.WithService(service),
+				errors.WithExtension("contentEncoding", encoding),
+				errors.WithExtension("limit", maxBytes),
+			)
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+// decompressionError 构建响应体无法按声明的编码解压时的错误
+func decompressionError(service, encoding string, cause error) error {
+	return errors.NewInvalidResponseFormatError(service,
+		fmt.Sprintf("failed to decode %s subgraph response: %v", encoding, cause),
+		errors.WithCause(cause),
+		errors.WithExtension("contentEncoding", encoding),
+	)
+}
@@ -0,0 +1,161 @@
+package caller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// batchResponsesMetadataKey 批量调用的原始响应中保存按下标解析的各操作响应
+const batchResponsesMetadataKey = "batch_responses"
+
+// isNativeBatch 判断一组调用能否作为子图原生批量请求发送：至少两个调用，目标是同一个
+// 开启 SupportsBatching 的服务，且都不是变更
+func isNativeBatch(calls []*federationtypes.ServiceCall) bool {
+	if len(calls) < 2 {
+		return false
+	}
+
+	for _, call := range calls {
+		if call == nil || call.Service == nil || call.SubQuery == nil {
+			return false
+		}
+		if !call.Service.SupportsBatching || call.Service.Name != calls[0].Service.Name {
+			return false
+		}
+		if operationType(call.SubQuery.Query) == "mutation" {
+			return false
+		}
+	}
+	return true
+}
+
+// callNativeBatch 将多个调用合并为一次 HTTP 请求，请求体为操作数组，响应数组按下标拆回各调用。
+// 批量请求整体成功或失败，请求头、超时和重试次数取第一个调用
+func (c *WASMCaller) callNativeBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	service := calls[0].Service
+	startTime := time.Now()
+
+	c.logger.Debug("Calling service with native batch",
+		"service", service.Name,
+		"operations", len(calls),
+	)
+
+	requestBody, err := encodeBatchRequest(calls)
+	if err != nil {
+		c.recordFailure()
+		return nil, errors.NewServiceError("failed to marshal batch request: " + err.Error())
+	}
+
+	headers, err := c.requestHeaders(ctx, calls[0], requestBody)
+	if err != nil {
+		c.recordFailure()
+		return nil, err
+	}
+
+	clusterName := c.extractClusterName(service.Endpoint)
+
+	var response *federationtypes.ServiceResponse
+	maxRetries := c.maxRetries(calls[0])
+	for retry := 0; ; retry++ {
+		response, err = c.makeWASMHTTPCall(ctx, clusterName, requestBody, headers, calls[0], startTime, len(calls))
+		if err == nil || retry >= maxRetries || ctx.Err() != nil || !isRetryableCallError(err) {
+			break
+		}
+
+		if !c.waitRetryBackoff(ctx, retry) {
+			break
+		}
+		atomic.AddInt64(&c.metrics.RetryCount, 1)
+		c.logger.Debug("Retrying native batch call",
+			"service", service.Name,
+			"retry", retry+1,
+			"error", err,
+		)
+	}
+
+	c.recordCallHealth(service.Name, err)
+	if err != nil {
+		return nil, err
+	}
+
+	response.RequestSize = int64(len(requestBody))
+	c.recordServiceLatency(service.Name, response.Latency)
+	return splitBatchResponse(response, len(calls))
+}
+
+// encodeBatchRequest 按调用顺序序列化操作数组
+func encodeBatchRequest(calls []*federationtypes.ServiceCall) ([]byte, error) {
+	requests := make([]*federationtypes.GraphQLRequest, len(calls))
+	for i, call := range calls {
+		requests[i] = &federationtypes.GraphQLRequest{
+			Query:         call.SubQuery.Query,
+			Variables:     call.SubQuery.Variables,
+			OperationName: call.SubQuery.OperationName,
+		}
+	}
+	return jsonutil.Marshal(requests)
+}
+
+// decodeGraphQLBatchResponse 解析批量请求的数组响应，响应不是与请求等长的 JSON 数组时返回 INVALID_RESPONSE_FORMAT 错误
+func decodeGraphQLBatchResponse(service, status, contentType string, body []byte, size int) ([]*federationtypes.GraphQLResponse, error) {
+	invalid := func(message string) error {
+		return errors.NewInvalidResponseFormatError(service, message,
+			errors.WithExtension("statusCode", status),
+			errors.WithExtension("contentType", contentType),
+			errors.WithExtension("bodySnippet", responseSnippet(body)),
+		)
+	}
+
+	if mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0])); mediaType != "" && !strings.Contains(mediaType, "json") {
+		return nil, invalid(fmt.Sprintf("subgraph returned non-JSON content type %q", mediaType))
+	}
+	if trimmed := strings.TrimSpace(string(body)); !strings.HasPrefix(trimmed, "[") || !jsonutil.Valid(body) {
+		return nil, invalid("subgraph batch response is not a JSON array")
+	}
+
+	var responses []*federationtypes.GraphQLResponse
+	if err := jsonutil.Unmarshal(body, &responses); err != nil {
+		return nil, invalid("subgraph batch response is not a valid GraphQL response array")
+	}
+	if len(responses) != size {
+		return nil, invalid(fmt.Sprintf("subgraph batch response has %d results for %d operations", len(responses), size))
+	}
+	return responses, nil
+}
+
+// splitBatchResponse 将批量调用的响应拆为各调用的响应。整个批量请求的字节数计入第一个响应，
+// 避免服务用量重复统计
+func splitBatchResponse(response *federationtypes.ServiceResponse, size int) ([]*federationtypes.ServiceResponse, error) {
+	batch, ok := response.Metadata[batchResponsesMetadataKey].([]*federationtypes.GraphQLResponse)
+	if !ok || len(batch) != size {
+		return nil, errors.NewInvalidResponseFormatError(response.Service, "subgraph returned an empty batch response")
+	}
+
+	responses := make([]*federationtypes.ServiceResponse, size)
+	for i, result := range batch {
+		split := &federationtypes.ServiceResponse{
+			Service:    response.Service,
+			Latency:    response.Latency,
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Metadata:   map[string]interface{}{"batch_index": i, "batch_size": size},
+		}
+		if result != nil {
+			split.Data = result.Data
+			split.Errors = result.Errors
+		}
+		if i == 0 {
+			split.BodySize = response.BodySize
+			split.RequestSize = response.RequestSize
+		}
+		responses[i] = split
+	}
+	return responses, nil
+}
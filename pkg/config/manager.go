@@ -3,6 +3,7 @@ package config
 import (
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,7 @@ type Manager struct {
 	lastUpdate      time.Time
 	version         string
 	metrics         *ConfigMetrics
+	healthChecker   func(serviceName string) bool // 服务健康检查，为空时视为健康
 }
 
 // ValidationLevel 验证级别
@@ -539,57 +541,839 @@ func (m *Manager) validateServiceConfig(service *federationtypes.ServiceConfig,
 		return errors.NewConfigError(fmt.Sprintf("%s: invalid endpoint URL '%s'", prefix, service.Endpoint))
 	}
 
+	// 验证 authority 覆盖
+	if service.Authority != "" && !utils.IsValidAuthority(service.Authority) {
+		return errors.NewConfigError(fmt.Sprintf("%s: invalid authority '%s'", prefix, service.Authority))
+	}
+
 	// 验证模式
 	if strings.TrimSpace(service.Schema) == "" {
 		return errors.NewConfigError(fmt.Sprintf("%s: schema is required", prefix))
 	}
 
-	// 验证权重
-	if service.Weight < 0 {
-		return errors.NewConfigError(fmt.Sprintf("%s: weight cannot be negative", prefix))
+	// 验证权重
+	if service.Weight < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s: weight cannot be negative", prefix))
+	}
+
+	// 验证超时
+	if service.Timeout < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s: timeout cannot be negative", prefix))
+	}
+
+	// 验证重试次数
+	if service.MaxRetries < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s: maxRetries cannot be negative", prefix))
+	}
+
+	// 验证对冲延迟
+	if service.HedgeAfter < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s: hedgeAfter cannot be negative", prefix))
+	}
+
+	// 验证解压后响应体上限
+	if service.MaxDecompressedBytes < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s: maxDecompressedBytes cannot be negative", prefix))
+	}
+
+	// 验证 ID 转换方式
+	if err := validateIDCoercion(service.IDCoercion); err != nil {
+		return errors.NewConfigError(fmt.Sprintf("%s: %s", prefix, err.Message))
+	}
+
+	// 验证健康检查配置
+	if service.HealthCheck != nil {
+		if err := m.validateHealthCheckConfig(service.HealthCheck, prefix); err != nil {
+			return err
+		}
+	}
+
+	// 验证镜像流量配置
+	if err := validateShadowConfig(service); err != nil {
+		return errors.NewConfigError(fmt.Sprintf("%s: %s", prefix, err.Message))
+	}
+
+	// 验证认证配置
+	if service.Auth != nil {
+		if err := validateServiceAuthConfig(service.Auth); err != nil {
+			return errors.NewConfigError(fmt.Sprintf("%s: %s", prefix, err.Message))
+		}
+	}
+
+	return nil
+}
+
+// validateIDCoercion 验证实体表示中 ID 键字段的转换方式
+func validateIDCoercion(coercion string) *errors.FederationError {
+	switch coercion {
+	case "", federationtypes.IDCoercionString, federationtypes.IDCoercionNumber:
+		return nil
+	}
+	return errors.NewConfigError(fmt.Sprintf("invalid idCoercion '%s', must be %s or %s",
+		coercion, federationtypes.IDCoercionString, federationtypes.IDCoercionNumber))
+}
+
+// validateShadowConfig 验证服务的镜像端点和镜像比例
+func validateShadowConfig(service *federationtypes.ServiceConfig) *errors.FederationError {
+	if service.ShadowPercent < 0 || service.ShadowPercent > 100 {
+		return errors.NewConfigError("shadowPercent must be between 0 and 100")
+	}
+
+	if service.ShadowEndpoint == "" {
+		if service.ShadowPercent > 0 {
+			return errors.NewConfigError("shadowPercent requires shadowEndpoint")
+		}
+		return nil
+	}
+
+	if !utils.IsValidURL(service.ShadowEndpoint) {
+		return errors.NewConfigError(fmt.Sprintf("invalid shadowEndpoint URL '%s'", service.ShadowEndpoint))
+	}
+
+	if service.ShadowEndpoint == service.Endpoint {
+		return errors.NewConfigError("shadowEndpoint must differ from endpoint")
+	}
+
+	return nil
+}
+
+// validateServiceAuthConfig 验证服务认证配置
+func validateServiceAuthConfig(auth *federationtypes.ServiceAuthConfig) *errors.FederationError {
+	if auth.Token != "" && auth.TokenEndpoint != "" {
+		return errors.NewConfigError("auth.token and auth.tokenEndpoint are mutually exclusive")
+	}
+
+	if auth.Token == "" && auth.TokenEndpoint == "" {
+		return errors.NewConfigError("auth requires either token or tokenEndpoint")
+	}
+
+	if auth.TokenEndpoint != "" && !utils.IsValidURL(auth.TokenEndpoint) {
+		return errors.NewConfigError(fmt.Sprintf("invalid auth.tokenEndpoint URL '%s'", auth.TokenEndpoint))
+	}
+
+	if auth.TokenTimeout < 0 || auth.RefreshBefore < 0 || auth.DefaultTTL < 0 {
+		return errors.NewConfigError("auth durations cannot be negative")
+	}
+
+	if strings.ContainsAny(auth.Scheme, " \t\r\n") {
+		return errors.NewConfigError("auth.scheme must be a single token")
+	}
+
+	return nil
+}
+
+// validateBatchingConfig 验证批处理相似度配置，只检查设置了的字段，未设置的字段使用默认值
+func validateBatchingConfig(batching *federationtypes.BatchingConfig) *errors.FederationError {
+	if batching.MaxComplexity != nil && *batching.MaxComplexity <= 0 {
+		return errors.NewConfigError("batching.maxComplexity must be positive")
+	}
+
+	if (batching.FieldOverlapWeight != nil && *batching.FieldOverlapWeight < 0) ||
+		(batching.VariableWeight != nil && *batching.VariableWeight < 0) {
+		return errors.NewConfigError("batching weights cannot be negative")
+	}
+
+	// 两个权重都为 0 时相似度没有意义
+	if batching.FieldOverlapWeight != nil && *batching.FieldOverlapWeight == 0 &&
+		batching.VariableWeight != nil && *batching.VariableWeight == 0 {
+		return errors.NewConfigError("batching.fieldOverlapWeight and variableWeight cannot both be 0")
+	}
+
+	if batching.MinVariableRatio != nil && (*batching.MinVariableRatio < 0 || *batching.MinVariableRatio > 1) {
+		return errors.NewConfigError("batching.minVariableRatio must be between 0 and 1")
+	}
+
+	if batching.SimilarityThreshold != nil && (*batching.SimilarityThreshold <= 0 || *batching.SimilarityThreshold > 1) {
+		return errors.NewConfigError("batching.similarityThreshold must be greater than 0 and at most 1")
+	}
+
+	return nil
+}
+
+// validateErrorRateConfig 验证服务滚动错误率配置
+func validateErrorRateConfig(errorRate *federationtypes.ErrorRateConfig) *errors.FederationError {
+	if errorRate.Window < 0 || errorRate.Buckets < 0 || errorRate.MinRequests < 0 {
+		return errors.NewConfigError("errorRate.window, buckets and minRequests cannot be negative")
+	}
+
+	if errorRate.Threshold < 0 || errorRate.Threshold > 1 {
+		return errors.NewConfigError("errorRate.threshold must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// validateEntityBatchConfig 验证实体查询表示列表上限
+func validateEntityBatchConfig(entityBatch *federationtypes.EntityBatchConfig) *errors.FederationError {
+	if entityBatch.MaxRepresentations < 0 || entityBatch.MaxRepresentationBytes < 0 {
+		return errors.NewConfigError("entityBatch.maxRepresentations and maxRepresentationBytes cannot be negative")
+	}
+
+	return nil
+}
+
+// validateParseCacheConfig 验证查询解析缓存配置
+func validateParseCacheConfig(parseCache *federationtypes.ParseCacheConfig) *errors.FederationError {
+	if parseCache.MaxSize < 0 || parseCache.TTL < 0 {
+		return errors.NewConfigError("parseCache.maxSize and ttl cannot be negative")
+	}
+
+	return nil
+}
+
+// validatePreParseLimitsConfig 验证解析前检查上限
+func validatePreParseLimitsConfig(limits *federationtypes.PreParseLimitsConfig) *errors.FederationError {
+	if limits.MaxBytes < 0 || limits.MaxNesting < 0 || limits.MaxCost < 0 {
+		return errors.NewConfigError("preParseLimits.maxBytes, maxNesting and maxCost cannot be negative")
+	}
+
+	return nil
+}
+
+// validateSoftHardTimeouts 验证软、硬查询超时：不能为负数，同时配置时软超时必须小于硬超时；
+// 子查询受 queryTimeout 限制，软超时必须小于 queryTimeout，硬超时不能超过 queryTimeout，否则永远不会生效
+func validateSoftHardTimeouts(soft, hard, queryTimeout time.Duration) *errors.FederationError {
+	if soft < 0 || hard < 0 {
+		return errors.NewConfigError("softQueryTimeout and hardQueryTimeout cannot be negative")
+	}
+	if soft > 0 && hard > 0 && soft >= hard {
+		return errors.NewConfigError(fmt.Sprintf("softQueryTimeout (%s) must be less than hardQueryTimeout (%s)", soft, hard))
+	}
+	if queryTimeout > 0 && soft >= queryTimeout {
+		return errors.NewConfigError(fmt.Sprintf("softQueryTimeout (%s) must be less than queryTimeout (%s)", soft, queryTimeout))
+	}
+	if queryTimeout > 0 && hard > queryTimeout {
+		return errors.NewConfigError(fmt.Sprintf("hardQueryTimeout (%s) cannot exceed queryTimeout (%s)", hard, queryTimeout))
+	}
+	return nil
+}
+
+// validateMergeHeadroom 验证为响应合并预留的查询超时比例，必须小于 1 以给上游调用留出时间
+func validateMergeHeadroom(headroom float64) *errors.FederationError {
+	if headroom < 0 || headroom >= 1 {
+		return errors.NewConfigError(fmt.Sprintf("mergeHeadroom must be at least 0 and less than 1, got %g", headroom))
+	}
+	return nil
+}
+
+// validateTraceSamplingConfig 验证详细执行追踪的采样配置
+func validateTraceSamplingConfig(traceSampling *federationtypes.TraceSamplingConfig) *errors.FederationError {
+	if traceSampling.Rate < 0 || traceSampling.Rate > 1 {
+		return errors.NewConfigError("traceSampling.rate must be between 0 and 1")
+	}
+
+	if strings.ContainsAny(traceSampling.ForceHeader, " \t:") {
+		return errors.NewConfigError(fmt.Sprintf("invalid traceSampling.forceHeader %q", traceSampling.ForceHeader))
+	}
+
+	return nil
+}
+
+// validateLoadSheddingConfig 验证查询过载保护配置
+func validateLoadSheddingConfig(loadShedding *federationtypes.LoadSheddingConfig) *errors.FederationError {
+	if loadShedding.MaxConcurrent <= 0 {
+		return errors.NewConfigError("loadShedding.maxConcurrent must be positive")
+	}
+
+	if loadShedding.QueueDepth < 0 || loadShedding.QueueTimeout < 0 || loadShedding.RetryAfter < 0 {
+		return errors.NewConfigError("loadShedding.queueDepth, queueTimeout and retryAfter cannot be negative")
+	}
+
+	switch loadShedding.Policy {
+	case "", federationtypes.LoadSheddingShed, federationtypes.LoadSheddingWait:
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid loadShedding.policy %q, expected shed or wait", loadShedding.Policy))
+	}
+
+	return nil
+}
+
+// validateResponseSizeConfig 验证响应大小直方图配置，桶上界必须为正数且严格递增
+func validateResponseSizeConfig(responseSize *federationtypes.ResponseSizeConfig) *errors.FederationError {
+	if responseSize.MaxOperations < 0 {
+		return errors.NewConfigError("responseSize.maxOperations cannot be negative")
+	}
+
+	for i, bound := range responseSize.Buckets {
+		if bound <= 0 || (i > 0 && bound <= responseSize.Buckets[i-1]) {
+			return errors.NewConfigError(fmt.Sprintf("responseSize.buckets must be positive and strictly increasing, got %v", responseSize.Buckets))
+		}
+	}
+
+	return nil
+}
+
+// validateResponseHeadersConfig 验证上游响应头转发配置，不允许转发伪头部和由网关生成的头部
+func validateResponseHeadersConfig(responseHeaders *federationtypes.ResponseHeadersConfig) *errors.FederationError {
+	switch responseHeaders.ConflictPolicy {
+	case "", federationtypes.HeaderConflictFirst, federationtypes.HeaderConflictLast, federationtypes.HeaderConflictCombine:
+	default:
+		return errors.NewConfigError(fmt.Sprintf("responseHeaders: invalid conflictPolicy %q", responseHeaders.ConflictPolicy))
+	}
+
+	for _, name := range responseHeaders.Allowlist {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "" || strings.ContainsAny(name, " \t:"):
+			return errors.NewConfigError(fmt.Sprintf("responseHeaders: %q is not a valid header name", name))
+		case name == "content-type" || name == "content-length" || name == "transfer-encoding" || name == "x-request-id":
+			return errors.NewConfigError(fmt.Sprintf("responseHeaders: %q is set by the gateway and cannot be forwarded", name))
+		}
+	}
+
+	return nil
+}
+
+// validatePersistedQueryRegistry 验证远程持久化查询注册中心配置
+func validatePersistedQueryRegistry(registry *federationtypes.PersistedQueryRegistryConfig) *errors.FederationError {
+	if registry.Endpoint == "" {
+		return errors.NewConfigError("persistedQueryRegistry.endpoint is required")
+	}
+
+	if !utils.IsValidURL(registry.Endpoint) {
+		return errors.NewConfigError(fmt.Sprintf("persistedQueryRegistry: invalid endpoint URL '%s'", registry.Endpoint))
+	}
+
+	if registry.CacheTTL < 0 || registry.Timeout < 0 || registry.NegativeCacheTTL < 0 {
+		return errors.NewConfigError("persistedQueryRegistry cacheTTL, negativeCacheTTL and timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateFieldTimeouts 验证根字段超时预算，只支持 Query 根字段
+func validateFieldTimeouts(fieldTimeouts map[string]time.Duration) *errors.FederationError {
+	fields := make([]string, 0, len(fieldTimeouts))
+	for field := range fieldTimeouts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		name := strings.TrimPrefix(field, "Query.")
+		if name == field || name == "" || strings.Contains(name, ".") {
+			return errors.NewConfigError(fmt.Sprintf("fieldTimeouts: %s must be a Query root field like Query.field", field))
+		}
+		if fieldTimeouts[field] <= 0 {
+			return errors.NewConfigError(fmt.Sprintf("fieldTimeouts: timeout for %s must be positive", field))
+		}
+	}
+
+	return nil
+}
+
+// validateAllowedDirectives 验证查询指令允许列表中的名称，可带 @ 前缀
+func validateAllowedDirectives(directives []string) *errors.FederationError {
+	for _, directive := range directives {
+		name := strings.TrimPrefix(strings.TrimSpace(directive), "@")
+		if !isGraphQLName(name) {
+			return errors.NewConfigError(fmt.Sprintf("allowedDirectives: %q is not a valid directive name", directive))
+		}
+	}
+
+	return nil
+}
+
+// validateAllowedClusters 验证上游集群允许列表：名称不能为空，且需包含所有服务 endpoint、镜像端点、令牌端点及持久化查询注册中心对应的集群
+func validateAllowedClusters(config *federationtypes.FederationConfig) *errors.FederationError {
+	if len(config.AllowedClusters) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(config.AllowedClusters))
+	for _, cluster := range config.AllowedClusters {
+		if strings.TrimSpace(cluster) == "" {
+			return errors.NewConfigError("allowedClusters: cluster name cannot be empty")
+		}
+		allowed[cluster] = true
+	}
+
+	for _, service := range config.Services {
+		if cluster := utils.ClusterName(service.Endpoint); !allowed[cluster] {
+			return errors.NewConfigError(fmt.Sprintf("allowedClusters: cluster %q of service %s is not allowed", cluster, service.Name))
+		}
+		if service.ShadowEndpoint != "" {
+			if cluster := utils.ClusterName(service.ShadowEndpoint); !allowed[cluster] {
+				return errors.NewConfigError(fmt.Sprintf("allowedClusters: shadow cluster %q of service %s is not allowed", cluster, service.Name))
+			}
+		}
+		if service.Auth != nil && service.Auth.TokenEndpoint != "" {
+			if cluster := utils.ClusterName(service.Auth.TokenEndpoint); !allowed[cluster] {
+				return errors.NewConfigError(fmt.Sprintf("allowedClusters: token cluster %q of service %s is not allowed", cluster, service.Name))
+			}
+		}
+	}
+
+	if config.PersistedQueryRegistry != nil && config.PersistedQueryRegistry.Endpoint != "" {
+		if cluster := utils.ClusterName(config.PersistedQueryRegistry.Endpoint); !allowed[cluster] {
+			return errors.NewConfigError(fmt.Sprintf("allowedClusters: persisted query registry cluster %q is not allowed", cluster))
+		}
+	}
+
+	return nil
+}
+
+// validateListMerge 验证列表合并策略：策略名需为 concat、unionByKey 或 zipByIndex，使用 unionByKey 时需配置键字段
+func validateListMerge(config *federationtypes.FederationConfig) *errors.FederationError {
+	policies := map[string]string{"listMergePolicy": config.ListMergePolicy}
+	for path, policy := range config.ListMergePaths {
+		if strings.TrimSpace(path) == "" {
+			return errors.NewConfigError("listMergePaths: path cannot be empty")
+		}
+		policies[fmt.Sprintf("listMergePaths[%s]", path)] = policy
+	}
+
+	unionByKey := false
+	for name, policy := range policies {
+		switch policy {
+		case "", "concat", "zipByIndex":
+		case "unionByKey":
+			unionByKey = true
+		default:
+			return errors.NewConfigError(fmt.Sprintf("%s: invalid list merge policy %q, expected concat, unionByKey or zipByIndex", name, policy))
+		}
+	}
+
+	for _, key := range config.ListMergeKeys {
+		if strings.TrimSpace(key) == "" {
+			return errors.NewConfigError("listMergeKeys: key field cannot be empty")
+		}
+	}
+	if unionByKey && len(config.ListMergeKeys) == 0 {
+		return errors.NewConfigError("listMergeKeys is required when a list merge policy is unionByKey")
+	}
+
+	return nil
+}
+
+// validateAllowedOperationTypes 验证允许的操作类型
+func validateAllowedOperationTypes(operationTypes []string) *errors.FederationError {
+	for _, operationType := range operationTypes {
+		switch operationType {
+		case "query", "mutation", "subscription":
+		default:
+			return errors.NewConfigError(fmt.Sprintf("allowedOperationTypes: %q must be query, mutation or subscription", operationType))
+		}
+	}
+
+	return nil
+}
+
+// validateHTTPStatusMapping 验证错误码到 HTTP 状态码的映射
+func validateHTTPStatusMapping(mapping map[string]int) *errors.FederationError {
+	for code, status := range mapping {
+		if strings.TrimSpace(code) == "" {
+			return errors.NewConfigError("httpStatusMapping: error code cannot be empty")
+		}
+		if !errors.IsValidHTTPStatus(status) {
+			return errors.NewConfigError(fmt.Sprintf("httpStatusMapping: %d is not a valid HTTP status for %s", status, code))
+		}
+	}
+
+	return nil
+}
+
+// validateSchemaExportPath 验证组合 SDL 的导出路径
+func validateSchemaExportPath(path string) *errors.FederationError {
+	return validateEndpointPath("schemaExportPath", path)
+}
+
+// validateHealthPath 验证就绪状态的路径
+func validateHealthPath(path string) *errors.FederationError {
+	return validateEndpointPath("healthPath", path)
+}
+
+// validateAdminEndpoints 验证状态、指标和依赖图端点的路径及指标输出上限
+func validateAdminEndpoints(config *federationtypes.FederationConfig) *errors.FederationError {
+	if err := validateEndpointPath("statusPath", config.StatusPath); err != nil {
+		return err
+	}
+	if err := validateEndpointPath("metricsPath", config.MetricsPath); err != nil {
+		return err
+	}
+	if err := validateEndpointPath("dependencyGraphPath", config.DependencyGraphPath); err != nil {
+		return err
+	}
+	if config.MetricsMaxServices < 0 {
+		return errors.NewConfigError("metricsMaxServices cannot be negative")
+	}
+
+	return nil
+}
+
+// validateResponseEnvelopes 验证自定义响应包装规则，模板中以 $ 开头的字符串只能引用标准响应字段
+func validateResponseEnvelopes(envelopes []federationtypes.ResponseEnvelopeConfig) *errors.FederationError {
+	for i, envelope := range envelopes {
+		if len(envelope.Template) == 0 {
+			return errors.NewConfigError(fmt.Sprintf("responseEnvelopes[%d]: template cannot be empty", i))
+		}
+		if envelope.HeaderValue != "" && envelope.Header == "" {
+			return errors.NewConfigError(fmt.Sprintf("responseEnvelopes[%d]: headerValue requires header", i))
+		}
+		if envelope.PathPrefix != "" && !strings.HasPrefix(envelope.PathPrefix, "/") {
+			return errors.NewConfigError(fmt.Sprintf("responseEnvelopes[%d]: pathPrefix %q must start with /", i, envelope.PathPrefix))
+		}
+		if err := validateEnvelopeTemplate(fmt.Sprintf("responseEnvelopes[%d].template", i), envelope.Template); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateEnvelopeTemplate 递归检查模板中的字段引用
+func validateEnvelopeTemplate(path string, value interface{}) *errors.FederationError {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if err := validateEnvelopeTemplate(path+"."+key, item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := validateEnvelopeTemplate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case string:
+		if !strings.HasPrefix(v, "$") {
+			return nil
+		}
+		switch v {
+		case federationtypes.EnvelopeFieldData, federationtypes.EnvelopeFieldErrors, federationtypes.EnvelopeFieldExtensions:
+		default:
+			return errors.NewConfigError(fmt.Sprintf("%s: unknown field reference %q, expected $data, $errors or $extensions", path, v))
+		}
+	}
+
+	return nil
+}
+
+// validateEndpointPath 验证网关直接应答的端点路径，空字符串表示使用默认值
+func validateEndpointPath(field, path string) *errors.FederationError {
+	if path == "" {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "? \t") {
+		return errors.NewConfigError(fmt.Sprintf("%s: %q must be an absolute path without query string", field, path))
+	}
+
+	return nil
+}
+
+// validateReadinessQuorum 验证就绪所需的健康服务数，整数不能超过服务数量
+func validateReadinessQuorum(config *federationtypes.FederationConfig) *errors.FederationError {
+	quorum, err := utils.ParseQuorum(config.ReadinessQuorum)
+	if err != nil {
+		return errors.NewConfigError("readinessQuorum: " + err.Error())
+	}
+	if quorum.Count > len(config.Services) {
+		return errors.NewConfigError(fmt.Sprintf("readinessQuorum: %d exceeds the %d configured services", quorum.Count, len(config.Services)))
+	}
+
+	return nil
+}
+
+// isGraphQLName 判断是否为合法的 GraphQL 名称
+func isGraphQLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validateClientCacheBounds 验证客户端缓存提示的 maxAge 上下限
+func validateClientCacheBounds(config *federationtypes.FederationConfig) *errors.FederationError {
+	if config.ClientCacheMinAge < 0 || config.ClientCacheMaxAge < 0 {
+		return errors.NewConfigError("clientCacheMinAge and clientCacheMaxAge cannot be negative")
+	}
+
+	if config.DefaultCacheMaxAge < 0 {
+		return errors.NewConfigError("defaultCacheMaxAge cannot be negative")
+	}
+
+	if config.ClientCacheMaxAge > 0 && config.ClientCacheMinAge > config.ClientCacheMaxAge {
+		return errors.NewConfigError("clientCacheMinAge cannot be greater than clientCacheMaxAge")
+	}
+
+	return nil
+}
+
+// validateFallbackResponse 验证兜底响应是合法的 JSON 对象
+func validateFallbackResponse(fallback string) *errors.FederationError {
+	if !jsonutil.Valid([]byte(fallback)) || !strings.HasPrefix(strings.TrimSpace(fallback), "{") {
+		return errors.NewConfigError("fallbackResponse must be a valid JSON object")
+	}
+	return nil
+}
+
+// validateHealthCheckConfig 验证健康检查配置
+func (m *Manager) validateHealthCheckConfig(hc *federationtypes.HealthCheck, prefix string) error {
+	if hc.Interval < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: interval cannot be negative", prefix))
+	}
+
+	if hc.Timeout < 0 {
+		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: timeout cannot be negative", prefix))
+	}
+
+	if hc.Timeout > hc.Interval {
+		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: timeout cannot be greater than interval", prefix))
+	}
+
+	return nil
+}
+
+// validateGlobalConfig 验证全局配置
+func (m *Manager) validateGlobalConfig(config *federationtypes.FederationConfig) error {
+	// 验证查询深度限制
+	if config.MaxQueryDepth < 0 {
+		return errors.NewConfigError("maxQueryDepth cannot be negative")
+	}
+
+	if config.MaxQueryDepth > 100 {
+		return errors.NewConfigError("maxQueryDepth cannot exceed 100")
+	}
+
+	// 验证实体批量上限
+	if config.MaxEntitiesPerRequest < 0 {
+		return errors.NewConfigError("maxEntitiesPerRequest cannot be negative")
+	}
+
+	// 验证实体字段别名上限
+	if config.MaxEntityFieldAliases < 0 {
+		return errors.NewConfigError("maxEntityFieldAliases cannot be negative")
+	}
+
+	// 验证片段数量和总大小上限
+	if config.MaxFragments < 0 {
+		return errors.NewConfigError("maxFragments cannot be negative")
+	}
+	if config.MaxFragmentBytes < 0 {
+		return errors.NewConfigError("maxFragmentBytes cannot be negative")
+	}
+
+	// 验证选择集广度上限
+	if config.MaxSelectionBreadth < 0 {
+		return errors.NewConfigError("maxSelectionBreadth cannot be negative")
+	}
+
+	// 验证上游响应总字节上限
+	if config.MaxTotalResponseBytes < 0 {
+		return errors.NewConfigError("maxTotalResponseBytes cannot be negative")
+	}
+
+	// 验证 @timeout 指令的超时上限
+	if config.MaxDirectiveTimeout < 0 {
+		return errors.NewConfigError("maxDirectiveTimeout cannot be negative")
+	}
+
+	// 验证变量冲突策略
+	switch config.VariableConflictPolicy {
+	case "", "namespace", "refuse":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid variableConflictPolicy: %s", config.VariableConflictPolicy))
+	}
+
+	// 验证未选择字段处理策略
+	switch config.UnknownFieldPolicy {
+	case "", "keep", "drop":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid unknownFieldPolicy: %s", config.UnknownFieldPolicy))
+	}
+
+	// 验证批量操作重名处理策略
+	switch config.DuplicateOperationNames {
+	case "", "reject", "index":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid duplicateOperationNames: %s", config.DuplicateOperationNames))
+	}
+
+	// 验证缺失根字段处理策略
+	switch config.MissingRootFieldPolicy {
+	case "", "ignore", "null", "error":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid missingRootFieldPolicy: %s", config.MissingRootFieldPolicy))
+	}
+
+	// 验证未定义字段处理策略
+	switch config.UndefinedFieldPolicy {
+	case "", "ignore", "prune", "error":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid undefinedFieldPolicy: %s", config.UndefinedFieldPolicy))
+	}
+
+	// 验证日志格式
+	switch config.LogFormat {
+	case "", "text", "ndjson":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid logFormat: %s", config.LogFormat))
+	}
+
+	// 验证日志级别
+	switch config.LogLevel {
+	case "", "info", "debug":
+	default:
+		return errors.NewConfigError(fmt.Sprintf("invalid logLevel: %s", config.LogLevel))
+	}
+
+	// 验证子查询协程池大小
+	if config.WorkerPoolSize < 0 {
+		return errors.NewConfigError("workerPoolSize cannot be negative")
+	}
+
+	// 验证查询缓存结果大小上限
+	if config.MaxCacheValueBytes < 0 {
+		return errors.NewConfigError("maxCacheValueBytes cannot be negative")
+	}
+
+	// 验证客户端缓存提示上下限
+	if err := validateClientCacheBounds(config); err != nil {
+		return err
+	}
+
+	// 验证规划超时
+	if config.PlanningTimeout < 0 {
+		return errors.NewConfigError("planningTimeout cannot be negative")
+	}
+
+	// 验证软、硬查询超时
+	if err := validateSoftHardTimeouts(config.SoftQueryTimeout, config.HardQueryTimeout, config.QueryTimeout); err != nil {
+		return err
+	}
+
+	// 验证合并预留比例
+	if err := validateMergeHeadroom(config.MergeHeadroom); err != nil {
+		return err
+	}
+
+	// 验证批处理相似度参数
+	if config.Batching != nil {
+		if err := validateBatchingConfig(config.Batching); err != nil {
+			return err
+		}
+	}
+
+	if config.ErrorRate != nil {
+		if err := validateErrorRateConfig(config.ErrorRate); err != nil {
+			return err
+		}
+	}
+
+	if config.EntityBatch != nil {
+		if err := validateEntityBatchConfig(config.EntityBatch); err != nil {
+			return err
+		}
+	}
+
+	// 验证查询解析缓存
+	if config.ParseCache != nil {
+		if err := validateParseCacheConfig(config.ParseCache); err != nil {
+			return err
+		}
+	}
+
+	// 验证解析前检查上限
+	if config.PreParseLimits != nil {
+		if err := validatePreParseLimitsConfig(config.PreParseLimits); err != nil {
+			return err
+		}
+	}
+
+	// 验证过载保护
+	if config.LoadShedding != nil {
+		if err := validateLoadSheddingConfig(config.LoadShedding); err != nil {
+			return err
+		}
 	}
 
-	// 验证超时
-	if service.Timeout < 0 {
-		return errors.NewConfigError(fmt.Sprintf("%s: timeout cannot be negative", prefix))
+	// 验证追踪采样
+	if config.TraceSampling != nil {
+		if err := validateTraceSamplingConfig(config.TraceSampling); err != nil {
+			return err
+		}
 	}
 
-	// 验证健康检查配置
-	if service.HealthCheck != nil {
-		if err := m.validateHealthCheckConfig(service.HealthCheck, prefix); err != nil {
+	// 验证响应大小直方图
+	if config.ResponseSize != nil {
+		if err := validateResponseSizeConfig(config.ResponseSize); err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
+	// 验证上游响应头转发
+	if config.ResponseHeaders != nil {
+		if err := validateResponseHeadersConfig(config.ResponseHeaders); err != nil {
+			return err
+		}
+	}
 
-// validateHealthCheckConfig 验证健康检查配置
-func (m *Manager) validateHealthCheckConfig(hc *federationtypes.HealthCheck, prefix string) error {
-	if hc.Interval < 0 {
-		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: interval cannot be negative", prefix))
+	// 验证远程持久化查询注册中心
+	if config.PersistedQueryRegistry != nil {
+		if err := validatePersistedQueryRegistry(config.PersistedQueryRegistry); err != nil {
+			return err
+		}
 	}
 
-	if hc.Timeout < 0 {
-		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: timeout cannot be negative", prefix))
+	// 验证字段超时预算
+	if err := validateFieldTimeouts(config.FieldTimeouts); err != nil {
+		return err
 	}
 
-	if hc.Timeout > hc.Interval {
-		return errors.NewConfigError(fmt.Sprintf("%s.healthCheck: timeout cannot be greater than interval", prefix))
+	if err := validateAllowedDirectives(config.AllowedDirectives); err != nil {
+		return err
 	}
 
-	return nil
-}
+	if err := validateAllowedOperationTypes(config.AllowedOperationTypes); err != nil {
+		return err
+	}
 
-// validateGlobalConfig 验证全局配置
-func (m *Manager) validateGlobalConfig(config *federationtypes.FederationConfig) error {
-	// 验证查询深度限制
-	if config.MaxQueryDepth < 0 {
-		return errors.NewConfigError("maxQueryDepth cannot be negative")
+	if err := validateAllowedClusters(config); err != nil {
+		return err
 	}
 
-	if config.MaxQueryDepth > 100 {
-		return errors.NewConfigError("maxQueryDepth cannot exceed 100")
+	if err := validateListMerge(config); err != nil {
+		return err
+	}
+
+	if err := validateSchemaExportPath(config.SchemaExportPath); err != nil {
+		return err
+	}
+
+	if err := validateHealthPath(config.HealthPath); err != nil {
+		return err
+	}
+
+	if err := validateAdminEndpoints(config); err != nil {
+		return err
+	}
+
+	if err := validateResponseEnvelopes(config.ResponseEnvelopes); err != nil {
+		return err
+	}
+
+	if err := validateReadinessQuorum(config); err != nil {
+		return err
+	}
+
+	if err := validateHTTPStatusMapping(config.HTTPStatusMapping); err != nil {
+		return err
+	}
+
+	// 验证兜底响应
+	if config.FallbackResponse != "" {
+		if err := validateFallbackResponse(config.FallbackResponse); err != nil {
+			return err
+		}
 	}
 
 	// 验证查询超时
@@ -677,6 +1461,10 @@ func (m *Manager) compareServiceConfigs(old, new *federationtypes.ServiceConfig)
 		changes = append(changes, "endpoint")
 	}
 
+	if old.Authority != new.Authority {
+		changes = append(changes, "authority")
+	}
+
 	if old.Schema != new.Schema {
 		changes = append(changes, "schema")
 	}
@@ -805,6 +1593,17 @@ func (v *DefaultValidator) Validate(config *federationtypes.FederationConfig) []
 			})
 		}
 
+		// 检查 authority 覆盖
+		if service.Authority != "" && !utils.IsValidAuthority(service.Authority) {
+			errors = append(errors, ValidationError{
+				Path:       path + ".authority",
+				Message:    "Invalid authority format",
+				Severity:   SeverityError,
+				Code:       "INVALID_AUTHORITY",
+				Suggestion: "Use host or host:port, e.g. 'users.internal:443'",
+			})
+		}
+
 		// 检查超时设置
 		if service.Timeout <= 0 {
 			errors = append(errors, ValidationError{
@@ -826,6 +1625,384 @@ func (v *DefaultValidator) Validate(config *federationtypes.FederationConfig) []
 				Suggestion: "Set weight to a positive integer like 1",
 			})
 		}
+
+		// 检查重试次数
+		if service.MaxRetries < 0 {
+			errors = append(errors, ValidationError{
+				Path:       path + ".maxRetries",
+				Message:    "Service maxRetries cannot be negative",
+				Severity:   SeverityError,
+				Code:       "INVALID_MAX_RETRIES",
+				Suggestion: "Set maxRetries to 0 to disable retries",
+			})
+		}
+
+		// 检查 ID 转换方式
+		if err := validateIDCoercion(service.IDCoercion); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     path + ".idCoercion",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_ID_COERCION",
+			})
+		}
+
+		// 检查镜像流量配置
+		if err := validateShadowConfig(&service); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     path + ".shadowEndpoint",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_SHADOW_CONFIG",
+			})
+		}
+
+		// 检查认证配置
+		if service.Auth != nil {
+			if err := validateServiceAuthConfig(service.Auth); err != nil {
+				errors = append(errors, ValidationError{
+					Path:     path + ".auth",
+					Message:  err.Message,
+					Severity: SeverityError,
+					Code:     "INVALID_SERVICE_AUTH",
+				})
+			}
+		}
+	}
+
+	// 检查批处理相似度参数
+	if config.Batching != nil {
+		if err := validateBatchingConfig(config.Batching); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "batching",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_BATCHING_CONFIG",
+			})
+		}
+	}
+
+	// 检查服务错误率窗口
+	if config.ErrorRate != nil {
+		if err := validateErrorRateConfig(config.ErrorRate); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "errorRate",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_ERROR_RATE_CONFIG",
+			})
+		}
+	}
+
+	// 检查实体查询表示列表上限
+	if config.EntityBatch != nil {
+		if err := validateEntityBatchConfig(config.EntityBatch); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "entityBatch",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_ENTITY_BATCH_CONFIG",
+			})
+		}
+	}
+
+	// 检查查询解析缓存
+	if config.ParseCache != nil {
+		if err := validateParseCacheConfig(config.ParseCache); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "parseCache",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_PARSE_CACHE_CONFIG",
+			})
+		}
+	}
+
+	// 检查解析前检查上限
+	if config.PreParseLimits != nil {
+		if err := validatePreParseLimitsConfig(config.PreParseLimits); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "preParseLimits",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_PRE_PARSE_LIMITS",
+			})
+		}
+	}
+
+	// 检查过载保护
+	if config.LoadShedding != nil {
+		if err := validateLoadSheddingConfig(config.LoadShedding); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "loadShedding",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_LOAD_SHEDDING_CONFIG",
+			})
+		}
+	}
+
+	// 检查追踪采样
+	if config.TraceSampling != nil {
+		if err := validateTraceSamplingConfig(config.TraceSampling); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "traceSampling",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_TRACE_SAMPLING_CONFIG",
+			})
+		}
+	}
+
+	// 检查响应大小直方图
+	if config.ResponseSize != nil {
+		if err := validateResponseSizeConfig(config.ResponseSize); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "responseSize",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_RESPONSE_SIZE_CONFIG",
+			})
+		}
+	}
+
+	// 检查上游响应头转发
+	if config.ResponseHeaders != nil {
+		if err := validateResponseHeadersConfig(config.ResponseHeaders); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "responseHeaders",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_RESPONSE_HEADERS_CONFIG",
+			})
+		}
+	}
+
+	// 检查远程持久化查询注册中心
+	if config.PersistedQueryRegistry != nil {
+		if err := validatePersistedQueryRegistry(config.PersistedQueryRegistry); err != nil {
+			errors = append(errors, ValidationError{
+				Path:     "persistedQueryRegistry",
+				Message:  err.Message,
+				Severity: SeverityError,
+				Code:     "INVALID_PERSISTED_QUERY_REGISTRY",
+			})
+		}
+	}
+
+	// 检查字段超时预算
+	if err := validateFieldTimeouts(config.FieldTimeouts); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "fieldTimeouts",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_FIELD_TIMEOUT",
+			Suggestion: "Use keys like Query.field with a positive duration",
+		})
+	}
+
+	if err := validateAllowedDirectives(config.AllowedDirectives); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "allowedDirectives",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_ALLOWED_DIRECTIVE",
+			Suggestion: "Use directive names like skip or @include",
+		})
+	}
+
+	if err := validateAllowedOperationTypes(config.AllowedOperationTypes); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "allowedOperationTypes",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_ALLOWED_OPERATION_TYPE",
+			Suggestion: "Use a subset of query, mutation and subscription",
+		})
+	}
+
+	if err := validateAllowedClusters(config); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "allowedClusters",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_ALLOWED_CLUSTERS",
+			Suggestion: "List the upstream cluster of every configured service, token endpoint and persisted query registry",
+		})
+	}
+
+	if err := validateListMerge(config); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "listMergePolicy",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_LIST_MERGE",
+			Suggestion: "Use concat, unionByKey or zipByIndex and set listMergeKeys for unionByKey",
+		})
+	}
+
+	if err := validateSchemaExportPath(config.SchemaExportPath); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "schemaExportPath",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_SCHEMA_EXPORT_PATH",
+			Suggestion: "Use an absolute path like /federation/schema.graphql",
+		})
+	}
+
+	if err := validateHealthPath(config.HealthPath); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "healthPath",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_HEALTH_PATH",
+			Suggestion: "Use an absolute path like /federation/health",
+		})
+	}
+
+	if err := validateAdminEndpoints(config); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "statusPath",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_ADMIN_ENDPOINT",
+			Suggestion: "Use absolute paths like /federation/status and a non-negative metricsMaxServices",
+		})
+	}
+
+	if err := validateSoftHardTimeouts(config.SoftQueryTimeout, config.HardQueryTimeout, config.QueryTimeout); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "softQueryTimeout",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_SOFT_HARD_TIMEOUT",
+			Suggestion: "Set softQueryTimeout below hardQueryTimeout and both within queryTimeout, e.g. 2s, 5s and 5s",
+		})
+	}
+
+	if err := validateMergeHeadroom(config.MergeHeadroom); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "mergeHeadroom",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_MERGE_HEADROOM",
+			Suggestion: "Use a fraction such as 0.1 to reserve 10% of queryTimeout for merging",
+		})
+	}
+
+	if err := validateResponseEnvelopes(config.ResponseEnvelopes); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "responseEnvelopes",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_RESPONSE_ENVELOPE",
+			Suggestion: "Reference only $data, $errors or $extensions in envelope templates",
+		})
+	}
+
+	if err := validateReadinessQuorum(config); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "readinessQuorum",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_READINESS_QUORUM",
+			Suggestion: "Use a service count like \"3\" or a percentage like \"75%\"",
+		})
+	}
+
+	if err := validateHTTPStatusMapping(config.HTTPStatusMapping); err != nil {
+		errors = append(errors, ValidationError{
+			Path:       "httpStatusMapping",
+			Message:    err.Message,
+			Severity:   SeverityError,
+			Code:       "INVALID_HTTP_STATUS_MAPPING",
+			Suggestion: "Map error codes to HTTP statuses between 100 and 599",
+		})
+	}
+
+	// 检查日志格式
+	switch config.LogFormat {
+	case "", "text", "ndjson":
+	default:
+		errors = append(errors, ValidationError{
+			Path:       "logFormat",
+			Message:    fmt.Sprintf("invalid logFormat: %s", config.LogFormat),
+			Severity:   SeverityError,
+			Code:       "INVALID_LOG_FORMAT",
+			Suggestion: "Use 'text' or 'ndjson'",
+		})
+	}
+
+	// 检查日志级别
+	switch config.LogLevel {
+	case "", "info", "debug":
+	default:
+		errors = append(errors, ValidationError{
+			Path:       "logLevel",
+			Message:    fmt.Sprintf("invalid logLevel: %s", config.LogLevel),
+			Severity:   SeverityError,
+			Code:       "INVALID_LOG_LEVEL",
+			Suggestion: "Use 'info' or 'debug'",
+		})
+	}
+
+	// 检查批量操作重名处理策略
+	switch config.DuplicateOperationNames {
+	case "", "reject", "index":
+	default:
+		errors = append(errors, ValidationError{
+			Path:       "duplicateOperationNames",
+			Message:    fmt.Sprintf("invalid duplicateOperationNames: %s", config.DuplicateOperationNames),
+			Severity:   SeverityError,
+			Code:       "INVALID_DUPLICATE_OPERATION_NAMES",
+			Suggestion: "Use 'reject' or 'index'",
+		})
+	}
+
+	// 检查子查询协程池大小
+	if config.WorkerPoolSize < 0 {
+		errors = append(errors, ValidationError{
+			Path:       "workerPoolSize",
+			Message:    "workerPoolSize cannot be negative",
+			Severity:   SeverityError,
+			Code:       "INVALID_WORKER_POOL_SIZE",
+			Suggestion: "Omit workerPoolSize or set it to a positive integer",
+		})
+	}
+
+	// 检查查询缓存结果大小上限
+	if config.MaxCacheValueBytes < 0 {
+		errors = append(errors, ValidationError{
+			Path:       "maxCacheValueBytes",
+			Message:    "maxCacheValueBytes cannot be negative",
+			Severity:   SeverityError,
+			Code:       "INVALID_MAX_CACHE_VALUE_BYTES",
+			Suggestion: "Omit maxCacheValueBytes or set it to a positive byte count",
+		})
+	}
+
+	// 检查客户端缓存提示上下限
+	if err := validateClientCacheBounds(config); err != nil {
+		errors = append(errors, ValidationError{
+			Path:     "clientCacheMaxAge",
+			Message:  err.Message,
+			Severity: SeverityError,
+			Code:     "INVALID_CLIENT_CACHE_BOUNDS",
+		})
+	}
+
+	// 检查兜底响应
+	if config.FallbackResponse != "" {
+		if err := validateFallbackResponse(config.FallbackResponse); err != nil {
+			errors = append(errors, ValidationError{
+				Path:       "fallbackResponse",
+				Message:    err.Message,
+				Severity:   SeverityError,
+				Code:       "INVALID_FALLBACK_RESPONSE",
+				Suggestion: "Provide a static JSON object such as '{\"items\": []}'",
+			})
+		}
 	}
 
 	return errors
@@ -1039,11 +2216,19 @@ func (m *Manager) getDisabledServices() []string {
 	return []string{}
 }
 
-// checkServiceHealth 检查服务健康状态
+// SetHealthChecker 设置服务健康检查，通常来自服务调用器的健康状态
+func (m *Manager) SetHealthChecker(checker func(serviceName string) bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.healthChecker = checker
+}
+
+// checkServiceHealth 检查服务健康状态，调用方需持有读锁
 func (m *Manager) checkServiceHealth(serviceName string) bool {
-	// 这里可以实现实际的健康检查逻辑
-	// 暂时返回true，表示服务健康
-	return true
+	if m.healthChecker == nil {
+		return true
+	}
+	return m.healthChecker(serviceName)
 }
 
 // GetServiceWeight 获取服务权重
@@ -234,3 +234,594 @@ func TestConfigMetrics_Struct(t *testing.T) {
 		t.Errorf("Expected ServiceHealth to have 2 entries, got %d", len(metrics.ServiceHealth))
 	}
 }
+
+func TestLoadConfig_InvalidAuthority(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "reviews",
+				"endpoint": "http://shared-ingress/graphql",
+				"authority": "reviews.internal/graphql",
+				"schema": "type Query { reviews: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for malformed authority")
+	}
+}
+
+func TestLoadConfig_InvalidBatching(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"batching": {"maxComplexity": 10, "similarityThreshold": 1.5}
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for similarityThreshold above 1")
+	}
+
+	zeroComplexity := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"batching": {"maxComplexity": 0}
+	}`)
+
+	if _, err := manager.LoadConfig(zeroComplexity); err == nil {
+		t.Fatal("Expected error for maxComplexity 0")
+	}
+}
+
+func TestLoadConfig_InvalidFallbackResponse(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"fallbackResponse": "{\"users\": ["
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for malformed fallbackResponse")
+	}
+}
+
+func TestLoadConfig_InvalidLogFormat(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"logFormat": "xml"
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for unknown logFormat")
+	}
+}
+
+func TestLoadConfig_InvalidLogLevel(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"logLevel": "trace"
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for unknown logLevel")
+	}
+}
+
+func TestManager_IsServiceEnabled_HealthChecker(t *testing.T) {
+	manager := NewManager(&MockLogger{}).(*Manager)
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }",
+				"weight": 1,
+				"timeout": 1000000000
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000
+	}`)
+	if _, err := manager.LoadConfig(config); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if !manager.IsServiceEnabled("users") {
+		t.Fatal("Expected service to be enabled without a health checker")
+	}
+
+	manager.SetHealthChecker(func(serviceName string) bool { return serviceName != "users" })
+	if manager.IsServiceEnabled("users") {
+		t.Error("Expected unhealthy service to be disabled")
+	}
+}
+
+func TestLoadConfig_PersistedQueryRegistry(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for name, registry := range map[string]string{
+		"valid":           `{"endpoint": "http://registry/graphql", "authHeader": "Bearer token"}`,
+		"missingEndpoint": `{"authHeader": "Bearer token"}`,
+		"negativeTTL":     `{"endpoint": "http://registry/graphql", "cacheTTL": -1}`,
+	} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"persistedQueryRegistry": ` + registry + `
+		}`)
+
+		_, err := manager.LoadConfig(config)
+		if name == "valid" && err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if name != "valid" && err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidFieldTimeouts(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, fieldTimeouts := range []string{
+		`{"Product.reviews": 100000000}`,
+		`{"Query.slowReport": 0}`,
+	} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"fieldTimeouts": ` + fieldTimeouts + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for fieldTimeouts %s", fieldTimeouts)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidAllowedDirectives(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, allowedDirectives := range []string{`["skip", ""]`, `["@my-directive"]`, `["1st"]`} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"allowedDirectives": ` + allowedDirectives + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for allowedDirectives %s", allowedDirectives)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidSchemaExportPath(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, path := range []string{"schema.graphql", "/schema?format=sdl"} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"enableSchemaExport": true,
+			"schemaExportPath": "` + path + `"
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for schemaExportPath %s", path)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidErrorRate(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, errorRate := range []string{`{"threshold": 1.5}`, `{"buckets": -1}`} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"errorRate": ` + errorRate + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for errorRate %s", errorRate)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidResponseSize(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, responseSize := range []string{`{"buckets": [1024, 512]}`, `{"buckets": [0]}`, `{"maxOperations": -1}`} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"responseSize": ` + responseSize + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for responseSize %s", responseSize)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidReadinessQuorum(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, quorum := range []string{`"2"`, `"0%"`, `"150%"`, `"most"`} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"readinessQuorum": ` + quorum + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for readinessQuorum %s", quorum)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidHTTPStatusMapping(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, mapping := range []string{`{"QUERY_VALIDATION_ERROR": 99}`, `{"INTERNAL_ERROR": 600}`, `{"": 400}`} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"httpStatusMapping": ` + mapping + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for httpStatusMapping %s", mapping)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidAllowedOperationTypes(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"allowedOperationTypes": ["query", "delete"]
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Error("Expected error for unknown operation type")
+	}
+}
+
+func TestLoadConfig_AllowedClustersMustCoverServices(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"allowedClusters": ["accounts"]
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Error("Expected error when a service cluster is not in allowedClusters")
+	}
+}
+
+func TestLoadConfig_AllowedClustersMustCoverPersistedQueryRegistry(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"persistedQueryRegistry": {"endpoint": "http://pq-registry/graphql"},
+		"allowedClusters": ["users"]
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Error("Expected error when the persisted query registry cluster is not in allowedClusters")
+	}
+}
+
+func TestLoadConfig_ListMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		wantErr  bool
+	}{
+		{name: "default", settings: `"maxQueryDepth": 10`},
+		{name: "union by key", settings: `"listMergePolicy": "unionByKey", "listMergeKeys": ["id"]`},
+		{name: "zip by index path", settings: `"listMergePaths": {"users": "zipByIndex"}`},
+		{name: "unknown policy", settings: `"listMergePolicy": "merge"`, wantErr: true},
+		{name: "unknown path policy", settings: `"listMergePaths": {"users": "merge"}`, wantErr: true},
+		{name: "union by key without keys", settings: `"listMergePolicy": "unionByKey"`, wantErr: true},
+		{name: "path union by key without keys", settings: `"listMergePaths": {"users": "unionByKey"}`, wantErr: true},
+		{name: "empty key", settings: `"listMergePolicy": "unionByKey", "listMergeKeys": [""]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&MockLogger{})
+			config := []byte(`{
+				"services": [
+					{
+						"name": "users",
+						"endpoint": "http://users/graphql",
+						"schema": "type Query { users: [String] }"
+					}
+				],
+				"queryTimeout": 30000000000,
+				` + tt.settings + `
+			}`)
+
+			_, err := manager.LoadConfig(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_InvalidServiceAuth(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }",
+				"auth": {"token": "static", "tokenEndpoint": "http://auth/token"}
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error when both static token and token endpoint are set")
+	}
+}
+
+func TestLoadConfig_InvalidShadowPercent(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }",
+				"shadowEndpoint": "http://users-v2/graphql",
+				"shadowPercent": 120
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for shadowPercent above 100")
+	}
+}
+
+func TestLoadConfig_InvalidIDCoercion(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }",
+				"idCoercion": "uuid"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for unknown idCoercion")
+	}
+}
+
+func TestLoadConfig_ResponseEnvelopeUnknownField(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	config := []byte(`{
+		"services": [
+			{
+				"name": "users",
+				"endpoint": "http://users/graphql",
+				"schema": "type Query { users: [String] }"
+			}
+		],
+		"maxQueryDepth": 10,
+		"queryTimeout": 30000000000,
+		"responseEnvelopes": [
+			{"header": "x-client", "template": {"result": "$data", "meta": {"errors": "$errors", "trace": "$tracing"}}}
+		]
+	}`)
+
+	if _, err := manager.LoadConfig(config); err == nil {
+		t.Fatal("Expected error for unknown envelope field reference")
+	}
+}
+
+func TestLoadConfig_InvalidMergeHeadroom(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, headroom := range []string{"-0.1", "1", "1.5"} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			"mergeHeadroom": ` + headroom + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for mergeHeadroom %s", headroom)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidSoftHardTimeouts(t *testing.T) {
+	manager := NewManager(&MockLogger{})
+
+	for _, timeouts := range []string{
+		`"softQueryTimeout": -1`,
+		`"hardQueryTimeout": -1`,
+		`"softQueryTimeout": 5000000000, "hardQueryTimeout": 5000000000`,
+		`"softQueryTimeout": 6000000000, "hardQueryTimeout": 5000000000`,
+		`"softQueryTimeout": 30000000000`,
+		`"hardQueryTimeout": 40000000000`,
+	} {
+		config := []byte(`{
+			"services": [
+				{
+					"name": "users",
+					"endpoint": "http://users/graphql",
+					"schema": "type Query { users: [String] }"
+				}
+			],
+			"maxQueryDepth": 10,
+			"queryTimeout": 30000000000,
+			` + timeouts + `
+		}`)
+
+		if _, err := manager.LoadConfig(config); err == nil {
+			t.Errorf("Expected error for %s", timeouts)
+		}
+	}
+}
@@ -34,9 +34,9 @@ func getSeverityForCode(code ErrorCode) string {
 	switch code {
 	case ErrCodeInternal, ErrCodeConfigInvalid, ErrCodeSchemaInvalid:
 		return "critical"
-	case ErrCodeServiceCall, ErrCodeTimeout, ErrCodeUnavailable:
+	case ErrCodeServiceCall, ErrCodeTimeout, ErrCodeUnavailable, ErrCodeInvalidResponseFormat:
 		return "high"
-	case ErrCodeQueryParsing, ErrCodeQueryValidation, ErrCodeQueryComplexity:
+	case ErrCodeQueryParsing, ErrCodeQueryValidation, ErrCodeQueryComplexity, ErrCodeDirectiveNotAllowed:
 		return "medium"
 	default:
 		return "low"
@@ -46,9 +46,10 @@ func getSeverityForCode(code ErrorCode) string {
 // getCategoryForCode 根据错误代码获取分类
 func getCategoryForCode(code ErrorCode) string {
 	switch code {
-	case ErrCodeQueryParsing, ErrCodeQueryValidation, ErrCodeQueryComplexity:
+	case ErrCodeQueryParsing, ErrCodeQueryValidation, ErrCodeQueryComplexity, ErrCodeDirectiveNotAllowed,
+		ErrCodePersistedQueryNotFound, ErrCodePersistedQueryNotAllowed:
 		return "user"
-	case ErrCodeServiceCall, ErrCodeTimeout, ErrCodeUnavailable, ErrCodeServiceNotFound:
+	case ErrCodeServiceCall, ErrCodeTimeout, ErrCodeUnavailable, ErrCodeServiceNotFound, ErrCodeInvalidResponseFormat:
 		return "external"
 	case ErrCodeConfigInvalid, ErrCodeSchemaInvalid:
 		return "system"
@@ -77,12 +78,16 @@ const (
 	ErrCodeQueryValidation ErrorCode = "QUERY_VALIDATION_ERROR"
 	ErrCodeQueryComplexity ErrorCode = "QUERY_COMPLEXITY_ERROR"
 
+	ErrCodeDirectiveNotAllowed ErrorCode = "DIRECTIVE_NOT_ALLOWED"
+
 	// 执行错误
 	ErrCodePlanningFailed  ErrorCode = "PLANNING_FAILED"
 	ErrCodeExecutionFailed ErrorCode = "EXECUTION_FAILED"
 	ErrCodeServiceCall     ErrorCode = "SERVICE_CALL_ERROR"
 	ErrCodeTimeout         ErrorCode = "TIMEOUT_ERROR"
 
+	ErrCodeInvalidResponseFormat ErrorCode = "INVALID_RESPONSE_FORMAT"
+
 	// 配置错误
 	ErrCodeConfigInvalid   ErrorCode = "CONFIG_INVALID"
 	ErrCodeSchemaInvalid   ErrorCode = "SCHEMA_INVALID"
@@ -93,6 +98,12 @@ const (
 	ErrCodeUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
 	ErrCodeRateLimit   ErrorCode = "RATE_LIMIT_EXCEEDED"
 
+	ErrCodeResponseTooLarge ErrorCode = "RESPONSE_TOO_LARGE"
+
+	// 持久化查询错误
+	ErrCodePersistedQueryNotFound   ErrorCode = "PERSISTED_QUERY_NOT_FOUND"
+	ErrCodePersistedQueryNotAllowed ErrorCode = "PERSISTED_QUERY_NOT_ALLOWED"
+
 	// Federation 相关错误
 	ErrCodeDirectiveParsing ErrorCode = "DIRECTIVE_PARSING_ERROR"
 	ErrCodeEntityResolution ErrorCode = "ENTITY_RESOLUTION_ERROR"
@@ -262,6 +273,12 @@ func NewTimeoutError(service string, message string, opts ...ErrorOption) *Feder
 	return NewFederationError(ErrCodeTimeout, message, opts...)
 }
 
+// NewInvalidResponseFormatError 创建上游响应格式错误，子图返回的不是 JSON 格式的 GraphQL 响应
+func NewInvalidResponseFormatError(service string, message string, opts ...ErrorOption) *FederationError {
+	opts = append(opts, WithService(service))
+	return NewFederationError(ErrCodeInvalidResponseFormat, message, opts...)
+}
+
 // NewConfigError 创建配置错误
 func NewConfigError(message string, opts ...ErrorOption) *FederationError {
 	return NewFederationError(ErrCodeConfigInvalid, message, opts...)
@@ -295,6 +312,26 @@ func NewRateLimitError(message string, opts ...ErrorOption) *FederationError {
 	return NewFederationError(ErrCodeRateLimit, message, opts...)
 }
 
+// NewDirectiveNotAllowedError 创建查询使用了未允许指令的验证错误
+func NewDirectiveNotAllowedError(message string, opts ...ErrorOption) *FederationError {
+	return NewFederationError(ErrCodeDirectiveNotAllowed, message, opts...)
+}
+
+// NewResponseTooLargeError 创建响应过大错误
+func NewResponseTooLargeError(message string, opts ...ErrorOption) *FederationError {
+	return NewFederationError(ErrCodeResponseTooLarge, message, opts...)
+}
+
+// NewPersistedQueryNotFoundError 创建持久化查询未找到错误
+func NewPersistedQueryNotFoundError(message string, opts ...ErrorOption) *FederationError {
+	return NewFederationError(ErrCodePersistedQueryNotFound, message, opts...)
+}
+
+// NewPersistedQueryNotAllowedError 创建查询不在允许列表中的错误
+func NewPersistedQueryNotAllowedError(message string, opts ...ErrorOption) *FederationError {
+	return NewFederationError(ErrCodePersistedQueryNotAllowed, message, opts...)
+}
+
 // NewServiceError 创建服务错误
 func NewServiceError(message string, opts ...ErrorOption) *FederationError {
 	return NewFederationError(ErrCodeServiceCall, message, opts...)
@@ -587,6 +624,12 @@ func EnrichError(err *FederationError, ctx *ErrorContext) *FederationError {
 	return err
 }
 
+// 调试模式下子查询失败时附加的扩展字段
+const (
+	ExtensionSubQuery  = "subQuery"
+	ExtensionVariables = "variables"
+)
+
 // SanitizeError 清理错误信息（移除敏感信息）
 func SanitizeError(err *FederationError) *FederationError {
 	if err == nil {
@@ -400,3 +400,39 @@ func TestIsRetryableCode(t *testing.T) {
 		t.Errorf("Expected ErrCodeInternal to not be retryable")
 	}
 }
+
+func TestHTTPStatusForCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     []string
+		overrides map[string]int
+		expected  int
+	}{
+		{"no errors", nil, nil, 200},
+		{"validation", []string{"QUERY_VALIDATION_ERROR"}, nil, 400},
+		{"rate limit", []string{"RATE_LIMIT_EXCEEDED"}, nil, 429},
+		{"internal", []string{"INTERNAL_ERROR"}, nil, 500},
+		{"partial", []string{"SERVICE_CALL_ERROR"}, nil, 200},
+		{"unmapped", []string{"NOT_FOUND"}, nil, 200},
+		{"highest severity wins", []string{"QUERY_VALIDATION_ERROR", "INTERNAL_ERROR", "SERVICE_CALL_ERROR"}, nil, 500},
+		{"override", []string{"QUERY_VALIDATION_ERROR"}, map[string]int{"QUERY_VALIDATION_ERROR": 422}, 422},
+		{"override custom code", []string{"NOT_FOUND"}, map[string]int{"NOT_FOUND": 404}, 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := HTTPStatusForCodes(tt.codes, tt.overrides); status != tt.expected {
+				t.Errorf("HTTPStatusForCodes(%v) = %d, expected %d", tt.codes, status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDefaultHTTPStatusMapping_Copy(t *testing.T) {
+	mapping := DefaultHTTPStatusMapping()
+	mapping[ErrCodeQueryValidation] = 418
+
+	if HTTPStatusForCodes([]string{string(ErrCodeQueryValidation)}, nil) != 400 {
+		t.Error("Modifying the returned mapping should not affect defaults")
+	}
+}
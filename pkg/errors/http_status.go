@@ -0,0 +1,64 @@
+package errors
+
+import "net/http"
+
+// defaultHTTPStatus 错误码到 HTTP 状态码的默认映射，未列出的错误码视为部分失败，返回 200
+var defaultHTTPStatus = map[ErrorCode]int{
+	ErrCodeQueryParsing:             http.StatusBadRequest,
+	ErrCodeQueryValidation:          http.StatusBadRequest,
+	ErrCodeQueryComplexity:          http.StatusBadRequest,
+	ErrCodeDirectiveNotAllowed:      http.StatusBadRequest,
+	ErrCodePersistedQueryNotAllowed: http.StatusBadRequest,
+	ErrCodeRateLimit:                http.StatusTooManyRequests,
+	ErrCodeResponseTooLarge:         http.StatusRequestEntityTooLarge,
+	ErrCodeInternal:                 http.StatusInternalServerError,
+	ErrCodeConfigInvalid:            http.StatusInternalServerError,
+	ErrCodeSchemaInvalid:            http.StatusInternalServerError,
+	ErrCodeServiceCall:              http.StatusOK,
+	ErrCodeTimeout:                  http.StatusOK,
+}
+
+// severityRank 严重程度排序，数值越大越严重
+var severityRank = map[string]int{
+	"low":      0,
+	"medium":   1,
+	"high":     2,
+	"critical": 3,
+}
+
+// DefaultHTTPStatusMapping 返回默认的错误码到 HTTP 状态码映射的副本
+func DefaultHTTPStatusMapping() map[ErrorCode]int {
+	mapping := make(map[ErrorCode]int, len(defaultHTTPStatus))
+	for code, status := range defaultHTTPStatus {
+		mapping[code] = status
+	}
+	return mapping
+}
+
+// IsValidHTTPStatus 检查是否为合法的 HTTP 状态码
+func IsValidHTTPStatus(status int) bool {
+	return status >= 100 && status <= 599
+}
+
+// HTTPStatusForCodes 从聚合后的错误码中选出严重程度最高的一个（同级取先出现者），
+// 按 overrides、默认映射的顺序确定 HTTP 状态码。没有错误或错误码未映射时返回 200
+func HTTPStatusForCodes(codes []string, overrides map[string]int) int {
+	if len(codes) == 0 {
+		return http.StatusOK
+	}
+
+	selected := codes[0]
+	for _, code := range codes[1:] {
+		if severityRank[getSeverityForCode(ErrorCode(code))] > severityRank[getSeverityForCode(ErrorCode(selected))] {
+			selected = code
+		}
+	}
+
+	if status, ok := overrides[selected]; ok {
+		return status
+	}
+	if status, ok := defaultHTTPStatus[ErrorCode(selected)]; ok {
+		return status
+	}
+	return http.StatusOK
+}
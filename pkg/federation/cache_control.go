@@ -0,0 +1,294 @@
+package federation
+
+import (
+	"time"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+const (
+	cacheControlDirective = "cacheControl"
+	cacheScopePrivate     = "PRIVATE"
+
+	// clientCachePolicyExtension 请求 extensions 中客户端缓存提示的键
+	clientCachePolicyExtension = "cachePolicy"
+	// defaultClientCacheMaxAge 未配置上限时客户端 maxAge 的上限
+	defaultClientCacheMaxAge = 5 * time.Minute
+
+	// cacheMetadataExtension 响应 extensions 中缓存元数据的键
+	cacheMetadataExtension = "cache"
+)
+
+// cachePolicy 根据 @cacheControl 计算的响应缓存策略
+type cachePolicy struct {
+	maxAge    time.Duration // 所有带提示字段中最小的 maxAge
+	hasMaxAge bool
+	cacheable bool
+	noStore   bool // 客户端要求不写入缓存
+}
+
+// restrict 用一个字段的缓存提示收紧策略
+func (p *cachePolicy) restrict(hint map[string]interface{}) {
+	if scope, ok := hint["scope"].(string); ok && scope == cacheScopePrivate {
+		p.cacheable = false
+	}
+
+	seconds, ok := cacheMaxAgeSeconds(hint["maxAge"])
+	if !ok {
+		return
+	}
+	if seconds <= 0 {
+		p.cacheable = false
+		return
+	}
+
+	maxAge := time.Duration(seconds) * time.Second
+	if !p.hasMaxAge || maxAge < p.maxAge {
+		p.maxAge = maxAge
+		p.hasMaxAge = true
+	}
+}
+
+// restrictMaxAge 用没有提示的字段的默认 maxAge 收紧策略，maxAge 为 0 时不缓存
+func (p *cachePolicy) restrictMaxAge(maxAge time.Duration) {
+	if maxAge <= 0 {
+		p.cacheable = false
+		return
+	}
+	if !p.hasMaxAge || maxAge < p.maxAge {
+		p.maxAge = maxAge
+		p.hasMaxAge = true
+	}
+}
+
+// ttl 返回写入缓存的 TTL。可缓存的策略总有 maxAge，无提示时返回 0
+func (p *cachePolicy) ttl() time.Duration {
+	if !p.hasMaxAge {
+		return 0
+	}
+	return p.maxAge
+}
+
+// applyClientCachePolicy 用请求 extensions.cachePolicy 覆盖派生的 TTL。
+// maxAge 按服务端配置的上下限截断并记录警告，生效的 TTL 取截断值与模式派生 TTL 中较小者；noStore 跳过写入；
+// 模式中标记为不可缓存的查询不会因客户端提示而变为可缓存
+func (e *Engine) applyClientCachePolicy(request *federationtypes.GraphQLRequest, policy *cachePolicy) {
+	hint, ok := request.Extensions[clientCachePolicyExtension].(map[string]interface{})
+	if !ok || !policy.cacheable {
+		return
+	}
+
+	if noStore, ok := hint["noStore"].(bool); ok && noStore {
+		policy.noStore = true
+	}
+
+	seconds, ok := cacheMaxAgeSeconds(hint["maxAge"])
+	if !ok {
+		return
+	}
+
+	minAge := e.federationConfig.ClientCacheMinAge
+	maxAge := e.federationConfig.ClientCacheMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultClientCacheMaxAge
+	}
+
+	requested := time.Duration(seconds) * time.Second
+	clamped := requested
+	if clamped < minAge {
+		clamped = minAge
+	}
+	if clamped > maxAge {
+		clamped = maxAge
+	}
+	if clamped != requested {
+		e.logger.Warn("Client cache policy maxAge out of bounds, clamping",
+			"requested", requested,
+			"applied", clamped,
+			"min", minAge,
+			"max", maxAge,
+		)
+	}
+
+	if clamped <= 0 {
+		policy.noStore = true
+		return
+	}
+	// 客户端只能缩短模式派生的 TTL，不能延长
+	if !policy.hasMaxAge || clamped < policy.maxAge {
+		policy.maxAge = clamped
+		policy.hasMaxAge = true
+	}
+}
+
+// cacheMaxAgeSeconds 解析 maxAge 参数值
+func cacheMaxAgeSeconds(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// schemaIndex 合并各服务模式后的类型索引，用于查找字段、类型种类和类型上的指令
+type schemaIndex struct {
+	fields     map[string]map[string]federationtypes.FieldInfo
+	kinds      map[string]string
+	directives map[string]map[string]map[string]interface{}
+	config     *federationtypes.FederationConfig // 构建索引时的配置
+}
+
+// currentSchemaIndex 返回当前配置的类型索引，同一配置下复用，配置重新加载后重建
+func (e *Engine) currentSchemaIndex() *schemaIndex {
+	if index := e.schemaIndexCache.Load(); index != nil && index.config == e.federationConfig {
+		return index
+	}
+	index := e.buildSchemaIndex()
+	e.schemaIndexCache.Store(index)
+	return index
+}
+
+// buildSchemaIndex 从注册中心汇总所有服务的类型信息
+func (e *Engine) buildSchemaIndex() *schemaIndex {
+	index := &schemaIndex{
+		config:     e.federationConfig,
+		fields:     make(map[string]map[string]federationtypes.FieldInfo),
+		kinds:      make(map[string]string),
+		directives: make(map[string]map[string]map[string]interface{}),
+	}
+
+	for _, service := range e.federationConfig.Services {
+		schemaInfo, err := e.registry.GetSchema(service.Name)
+		if err != nil {
+			continue
+		}
+
+		for _, typeInfo := range schemaInfo.Types {
+			if _, exists := index.kinds[typeInfo.Name]; !exists {
+				index.kinds[typeInfo.Name] = typeInfo.Kind
+			}
+
+			fields, ok := index.fields[typeInfo.Name]
+			if !ok {
+				fields = make(map[string]federationtypes.FieldInfo)
+				index.fields[typeInfo.Name] = fields
+			}
+			for _, fieldInfo := range typeInfo.Fields {
+				// 同一字段在多个服务中定义时，保留带 @cacheControl 的定义
+				if existing, exists := fields[fieldInfo.Name]; exists && existing.Directives[cacheControlDirective] != nil {
+					continue
+				}
+				fields[fieldInfo.Name] = fieldInfo
+			}
+
+			if hint, ok := typeInfo.Directives[cacheControlDirective]; ok {
+				if index.directives[typeInfo.Name] == nil {
+					index.directives[typeInfo.Name] = make(map[string]map[string]interface{})
+				}
+				index.directives[typeInfo.Name][cacheControlDirective] = hint
+			}
+		}
+	}
+
+	return index
+}
+
+// computeCachePolicy 计算查询的缓存策略：TTL 为所选字段中最小的 maxAge，
+// 任一字段为 PRIVATE 或 maxAge 为 0 时不缓存；变更和订阅操作不缓存。
+// 没有提示的根字段按 DefaultCacheMaxAge 处理，默认 0 即不缓存，避免未标注的按用户数据被共享
+func (e *Engine) computeCachePolicy(query *federationtypes.ParsedQuery) cachePolicy {
+	policy := cachePolicy{}
+
+	document, operationRef := findOperation(query)
+	if operationRef == -1 || document.OperationDefinitions[operationRef].OperationType != ast.OperationTypeQuery {
+		return policy
+	}
+
+	policy.cacheable = true
+	index := e.currentSchemaIndex()
+	e.collectCacheHints(document, document.OperationDefinitions[operationRef].SelectionSet, "Query", index, &policy, make(map[string]bool))
+	if !policy.hasMaxAge {
+		policy.cacheable = false
+	}
+
+	return policy
+}
+
+// collectCacheHints 遍历选择集，用每个字段（或其返回类型）上的 @cacheControl 收紧策略
+func (e *Engine) collectCacheHints(document *ast.Document, selectionSet int, typeName string, index *schemaIndex, policy *cachePolicy, visitedFragments map[string]bool) {
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			field := document.Fields[selection.Ref]
+			fieldInfo, ok := index.fields[typeName][document.FieldNameString(selection.Ref)]
+			if !ok {
+				continue
+			}
+
+			returnType := namedType(fieldInfo.Type)
+			if hint, ok := fieldInfo.Directives[cacheControlDirective]; ok {
+				policy.restrict(hint)
+			} else if hint, ok := index.directives[returnType][cacheControlDirective]; ok {
+				policy.restrict(hint)
+			} else if typeName == "Query" {
+				// 子字段继承父字段的提示，根字段没有可继承的提示
+				policy.restrictMaxAge(e.federationConfig.DefaultCacheMaxAge)
+			}
+
+			if field.HasSelections {
+				e.collectCacheHints(document, field.SelectionSet, returnType, index, policy, visitedFragments)
+			}
+
+		case ast.SelectionKindInlineFragment:
+			fragment := document.InlineFragments[selection.Ref]
+			if !fragment.HasSelections {
+				continue
+			}
+			fragmentType := typeName
+			if condition := document.InlineFragmentTypeConditionNameString(selection.Ref); condition != "" {
+				fragmentType = condition
+			}
+			e.collectCacheHints(document, fragment.SelectionSet, fragmentType, index, policy, visitedFragments)
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+
+			for i := range document.FragmentDefinitions {
+				if document.FragmentDefinitionNameString(i) != name {
+					continue
+				}
+				e.collectCacheHints(document, document.FragmentDefinitions[i].SelectionSet, document.FragmentDefinitionTypeNameString(i), index, policy, visitedFragments)
+			}
+		}
+	}
+}
+
+// attachCacheMetadata 开启 CacheMetadata 时在响应 extensions 中写入缓存命中状态、
+// 条目 age 和剩余 TTL（秒），不包含缓存键等内部信息
+func (e *Engine) attachCacheMetadata(response *federationtypes.GraphQLResponse, hit bool, age, ttl time.Duration) {
+	if !e.federationConfig.CacheMetadata {
+		return
+	}
+
+	if response.Extensions == nil {
+		response.Extensions = make(map[string]interface{})
+	}
+	response.Extensions[cacheMetadataExtension] = map[string]interface{}{
+		"hit": hit,
+		"age": int64(age / time.Second),
+		"ttl": int64(ttl / time.Second),
+	}
+}
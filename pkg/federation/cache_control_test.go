@@ -0,0 +1,194 @@
+package federation
+
+import (
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+const cacheControlSchema = `
+	enum CacheControlScope { PUBLIC PRIVATE }
+	directive @cacheControl(maxAge: Int, scope: CacheControlScope) on OBJECT | FIELD_DEFINITION
+
+	type Query {
+		products: [Product] @cacheControl(maxAge: 300)
+		me: User @cacheControl(maxAge: 60, scope: PRIVATE)
+		stock: Int @cacheControl(maxAge: 0)
+		session: User
+	}
+	type Product @cacheControl(maxAge: 120) {
+		upc: String!
+		price: Float @cacheControl(maxAge: 30)
+		reviews: [Review]
+	}
+	type Review @cacheControl(maxAge: 90) { body: String }
+	type User { id: ID! }`
+
+func TestEngine_ComputeCachePolicy(t *testing.T) {
+	logger := utils.NewLogger("test")
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "products", Endpoint: "http://products/graphql", Schema: cacheControlSchema, Timeout: time.Second},
+		},
+		EnableCaching: true,
+	}
+
+	engine, err := NewEngine(config, logger)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if err := engine.Initialize(config); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		cacheable bool
+		ttl       time.Duration
+	}{
+		{"root field only", "{ products { upc } }", true, 300 * time.Second},
+		{"nested field with lower maxAge", "{ products { upc price } }", true, 30 * time.Second},
+		{"type-level hint", "{ products { upc reviews { body } } }", true, 90 * time.Second},
+		{"fragment spread", "query { products { ...P } } fragment P on Product { price }", true, 30 * time.Second},
+		{"private scope", "{ products { upc } me { id } }", false, 0},
+		{"zero maxAge", "{ products { upc } stock }", false, 0},
+		{"unhinted root field", "{ products { upc } session { id } }", false, 0},
+		{"mutation", "mutation { products { upc } }", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsedQuery, err := engine.parser.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			policy := engine.computeCachePolicy(parsedQuery)
+			if policy.cacheable != tt.cacheable {
+				t.Fatalf("Expected cacheable %v, got %v", tt.cacheable, policy.cacheable)
+			}
+			if tt.cacheable && policy.ttl() != tt.ttl {
+				t.Errorf("Expected TTL %v, got %v", tt.ttl, policy.ttl())
+			}
+		})
+	}
+}
+
+func TestEngine_ComputeCachePolicy_DefaultMaxAge(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "products", Endpoint: "http://products/graphql", Schema: cacheControlSchema, Timeout: time.Second},
+		},
+		EnableCaching:      true,
+		DefaultCacheMaxAge: 45 * time.Second,
+	}
+
+	engine, err := NewEngine(config, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if err := engine.Initialize(config); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	// 显式配置默认 maxAge 后，未标注的根字段按该值参与取最小值
+	for query, ttl := range map[string]time.Duration{
+		"{ session { id } }":                        45 * time.Second,
+		"{ products { upc price } session { id } }": 30 * time.Second,
+	} {
+		parsedQuery, err := engine.parser.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery() error = %v", err)
+		}
+		policy := engine.computeCachePolicy(parsedQuery)
+		if !policy.cacheable || policy.ttl() != ttl {
+			t.Errorf("%s: expected cacheable with TTL %v, got %+v", query, ttl, policy)
+		}
+	}
+}
+
+func TestEngine_ApplyClientCachePolicy(t *testing.T) {
+	engine := &Engine{
+		federationConfig: &federationtypes.FederationConfig{
+			ClientCacheMinAge: 10 * time.Second,
+			ClientCacheMaxAge: 120 * time.Second,
+		},
+		logger: utils.NewLogger("test"),
+	}
+
+	derived := func() cachePolicy {
+		return cachePolicy{maxAge: 30 * time.Second, hasMaxAge: true, cacheable: true}
+	}
+	withHint := func(hint map[string]interface{}) *federationtypes.GraphQLRequest {
+		return &federationtypes.GraphQLRequest{Extensions: map[string]interface{}{"cachePolicy": hint}}
+	}
+
+	tests := []struct {
+		name    string
+		policy  cachePolicy
+		request *federationtypes.GraphQLRequest
+		ttl     time.Duration
+		noStore bool
+	}{
+		{"no hint keeps derived TTL", derived(), &federationtypes.GraphQLRequest{}, 30 * time.Second, false},
+		{"maxAge below schema maxAge shortens TTL", derived(), withHint(map[string]interface{}{"maxAge": int64(20)}), 20 * time.Second, false},
+		{"maxAge above schema maxAge keeps derived TTL", derived(), withHint(map[string]interface{}{"maxAge": int64(60)}), 30 * time.Second, false},
+		{"maxAge above cap keeps derived TTL", derived(), withHint(map[string]interface{}{"maxAge": float64(86400)}), 30 * time.Second, false},
+		{"maxAge above cap is clamped", cachePolicy{maxAge: time.Hour, hasMaxAge: true, cacheable: true}, withHint(map[string]interface{}{"maxAge": float64(86400)}), 120 * time.Second, false},
+		{"maxAge below floor is clamped", derived(), withHint(map[string]interface{}{"maxAge": int64(1)}), 10 * time.Second, false},
+		{"noStore skips caching", derived(), withHint(map[string]interface{}{"noStore": true}), 30 * time.Second, true},
+		{"uncacheable query stays uncacheable", cachePolicy{}, withHint(map[string]interface{}{"maxAge": int64(60)}), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			engine.applyClientCachePolicy(tt.request, &policy)
+
+			if policy.ttl() != tt.ttl {
+				t.Errorf("Expected TTL %v, got %v", tt.ttl, policy.ttl())
+			}
+			if policy.noStore != tt.noStore {
+				t.Errorf("Expected noStore %v, got %v", tt.noStore, policy.noStore)
+			}
+			if policy.cacheable != tt.policy.cacheable {
+				t.Errorf("Client hint must not change cacheability")
+			}
+		})
+	}
+}
+
+func TestEngine_SchemaIndexReusedUntilReload(t *testing.T) {
+	newConfig := func(schema string) *federationtypes.FederationConfig {
+		return &federationtypes.FederationConfig{
+			Services:     []federationtypes.ServiceConfig{{Name: "products", Endpoint: "http://products/graphql", Schema: schema, Timeout: time.Second}},
+			QueryTimeout: time.Second,
+		}
+	}
+	engine, err := NewEngine(newConfig("type Query { products: [Product] } type Product { upc: String! }"), utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if err := engine.Initialize(newConfig("type Query { products: [Product] } type Product { upc: String! }")); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	index := engine.currentSchemaIndex()
+	if engine.currentSchemaIndex() != index {
+		t.Error("Expected the schema index to be reused for the same configuration")
+	}
+
+	if err := engine.Initialize(newConfig("type Query { products: [Product] } type Product { upc: String! id: ID! }")); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	reloaded := engine.currentSchemaIndex()
+	if reloaded == index {
+		t.Fatal("Expected the schema index to be rebuilt after reload")
+	}
+	if _, ok := reloaded.fields["Product"]["id"]; !ok {
+		t.Errorf("Expected the rebuilt index to contain the new field, got %v", reloaded.fields["Product"])
+	}
+}
@@ -0,0 +1,133 @@
+package federation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// CoalescingStats 请求合并统计，均为聚合值，不按键区分
+type CoalescingStats struct {
+	CoalescedRequests    int64 `json:"coalescedRequests"`    // 加入进行中执行而未单独执行的请求数
+	StampedesPrevented   int64 `json:"stampedesPrevented"`   // 至少有一个跟随者的执行次数
+	BytesSaved           int64 `json:"bytesSaved"`           // 跟随者复用的响应字节数
+	MaxConcurrentJoiners int64 `json:"maxConcurrentJoiners"` // 单个键上同时等待的最大跟随者数
+}
+
+// inflightQuery 进行中的查询执行
+type inflightQuery struct {
+	done     chan struct{}
+	response *federationtypes.GraphQLResponse
+	err      error
+	joiners  int64
+}
+
+// coalescer 合并并发的相同查询，同一键只执行一次
+type coalescer struct {
+	calls map[string]*inflightQuery
+	mutex sync.Mutex
+
+	coalescedRequests    int64
+	stampedesPrevented   int64
+	bytesSaved           int64
+	maxConcurrentJoiners int64
+}
+
+// newCoalescer 创建查询合并器
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*inflightQuery)}
+}
+
+// do 执行查询；已有相同键的执行在进行时等待其结果并返回副本
+func (c *coalescer) do(key string, execute func() (*federationtypes.GraphQLResponse, error)) (*federationtypes.GraphQLResponse, error) {
+	c.mutex.Lock()
+	if call, ok := c.calls[key]; ok {
+		call.joiners++
+		joiners := call.joiners
+		c.mutex.Unlock()
+
+		atomic.AddInt64(&c.coalescedRequests, 1)
+		if joiners == 1 {
+			atomic.AddInt64(&c.stampedesPrevented, 1)
+		}
+		c.recordJoiners(joiners)
+
+		<-call.done
+		if call.response == nil {
+			return nil, call.err
+		}
+		return cloneResponse(call.response), call.err
+	}
+
+	call := &inflightQuery{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mutex.Unlock()
+
+	call.response, call.err = execute()
+
+	c.mutex.Lock()
+	delete(c.calls, key)
+	joiners := call.joiners
+	c.mutex.Unlock()
+	close(call.done)
+
+	if joiners > 0 && call.response != nil {
+		if body, err := jsonutil.Marshal(call.response); err == nil {
+			atomic.AddInt64(&c.bytesSaved, joiners*int64(len(body)))
+		}
+	}
+
+	return call.response, call.err
+}
+
+// recordJoiners 更新最大并发跟随者数
+func (c *coalescer) recordJoiners(joiners int64) {
+	for {
+		current := atomic.LoadInt64(&c.maxConcurrentJoiners)
+		if joiners <= current || atomic.CompareAndSwapInt64(&c.maxConcurrentJoiners, current, joiners) {
+			return
+		}
+	}
+}
+
+// stats 返回合并统计
+func (c *coalescer) stats() CoalescingStats {
+	return CoalescingStats{
+		CoalescedRequests:    atomic.LoadInt64(&c.coalescedRequests),
+		StampedesPrevented:   atomic.LoadInt64(&c.stampedesPrevented),
+		BytesSaved:           atomic.LoadInt64(&c.bytesSaved),
+		MaxConcurrentJoiners: atomic.LoadInt64(&c.maxConcurrentJoiners),
+	}
+}
+
+// coalescingKey 由查询文本、操作名标签、变量和请求扩展生成合并键，
+// 扩展（如 tracing、cachePolicy）会影响响应，扩展不同的请求不合并
+func coalescingKey(request *federationtypes.GraphQLRequest, operation string) string {
+	// fmt 按键排序输出 map，变量和扩展的顺序不影响键
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%#v\x00%#v", request.Query, operation, request.Variables, request.Extensions)))
+	return hex.EncodeToString(sum[:])
+}
+
+// isQueryOperation 判断请求的操作是否为 query，变更和订阅不参与合并
+func isQueryOperation(query *federationtypes.ParsedQuery) bool {
+	document, operationRef := findOperation(query)
+	return operationRef != -1 && document.OperationDefinitions[operationRef].OperationType == ast.OperationTypeQuery
+}
+
+// GetCoalescingStats 获取请求合并统计，未启用合并时返回零值
+func (e *Engine) GetCoalescingStats() CoalescingStats {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.coalescer == nil {
+		return CoalescingStats{}
+	}
+	return e.coalescer.stats()
+}
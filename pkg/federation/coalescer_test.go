@@ -0,0 +1,28 @@
+package federation
+
+import (
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+func TestCoalescingKey_IncludesExtensions(t *testing.T) {
+	request := func(extensions map[string]interface{}) *federationtypes.GraphQLRequest {
+		return &federationtypes.GraphQLRequest{
+			Query:      "{ products { upc } }",
+			Variables:  map[string]interface{}{"first": 2},
+			Extensions: extensions,
+		}
+	}
+
+	plain := coalescingKey(request(nil), "")
+	traced := coalescingKey(request(map[string]interface{}{"tracing": true}), "")
+	if plain == traced {
+		t.Error("Expected requests with different extensions to use different keys")
+	}
+
+	reordered := coalescingKey(request(map[string]interface{}{"b": 1, "a": 2}), "")
+	if reordered != coalescingKey(request(map[string]interface{}{"a": 2, "b": 1}), "") {
+		t.Error("Expected extension order not to affect the key")
+	}
+}
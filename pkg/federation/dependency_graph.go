@@ -0,0 +1,134 @@
+package federation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 依赖边的来源指令
+const (
+	DependencyRequires = "requires" // 字段的 @requires 需要其他服务提供的字段
+	DependencyProvides = "provides" // 字段的 @provides 直接返回其他服务拥有的字段
+)
+
+// DependencyGraph 由各服务模式的 @requires/@provides 分析得到的服务依赖图，以邻接表表示
+type DependencyGraph struct {
+	Services     []string                    `json:"services"`     // 全部服务，按名称排序
+	Dependencies map[string][]DependencyEdge `json:"dependencies"` // 服务 -> 该服务依赖的边
+}
+
+// DependencyEdge 依赖图中的一条边及其原因
+type DependencyEdge struct {
+	Service   string   `json:"service"`   // 被依赖的服务
+	Directive string   `json:"directive"` // requires 或 provides
+	Field     string   `json:"field"`     // 产生依赖的字段，如 Product.shippingEstimate
+	Fields    []string `json:"fields"`    // 指令中由被依赖服务拥有的字段
+}
+
+// ServiceDependencyGraph 从各服务模式中的联邦指令构建服务依赖图，供导出可视化
+func (e *Engine) ServiceDependencyGraph() (*DependencyGraph, error) {
+	var services []string
+	for _, service := range e.federationConfig.Services {
+		services = append(services, service.Name)
+	}
+	entities, err := e.configuredEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	federatedPlanner, ok := e.federationPlanner.(*FederatedPlanner)
+	if !ok {
+		federatedPlanner = NewFederatedPlanner(e.logger).(*FederatedPlanner)
+	}
+	return federatedPlanner.BuildDependencyGraph(services, entities), nil
+}
+
+// BuildDependencyGraph 按实体字段上的 @requires 和 @provides 构建服务依赖图。
+// @requires 的字段依赖所需字段的全部提供者，@provides 的字段依赖所提供字段在其他服务中的拥有者；
+// 同一字段对同一服务的依赖合并为一条边
+func (p *FederatedPlanner) BuildDependencyGraph(services []string, entities []federationtypes.FederatedEntity) *DependencyGraph {
+	graph := &DependencyGraph{Dependencies: make(map[string][]DependencyEdge)}
+
+	serviceSet := make(map[string]bool)
+	for _, service := range services {
+		serviceSet[service] = true
+	}
+
+	addEdge := func(from, to, directive, field, requiredField string) {
+		edges := graph.Dependencies[from]
+		for i := range edges {
+			if edges[i].Service == to && edges[i].Directive == directive && edges[i].Field == field {
+				for _, existing := range edges[i].Fields {
+					if existing == requiredField {
+						return
+					}
+				}
+				edges[i].Fields = append(edges[i].Fields, requiredField)
+				return
+			}
+		}
+		graph.Dependencies[from] = append(edges, DependencyEdge{Service: to, Directive: directive, Field: field, Fields: []string{requiredField}})
+	}
+
+	for _, entity := range entities {
+		serviceSet[entity.ServiceName] = true
+		for _, field := range entity.Fields {
+			fieldName := entity.TypeName + "." + field.Name
+
+			if field.Directives.Requires != nil {
+				federationtypes.FieldSetProviders(entity.TypeName, field.Directives.Requires.FieldSet(), entities, func(provider, requiredField string) {
+					if provider != entity.ServiceName {
+						addEdge(entity.ServiceName, provider, DependencyRequires, fieldName, requiredField)
+					}
+				})
+			}
+
+			if field.Directives.Provides != nil {
+				federationtypes.FieldSetProviders(namedType(field.Type), field.Directives.Provides.FieldSet(), entities, func(owner, providedField string) {
+					if owner != entity.ServiceName {
+						addEdge(entity.ServiceName, owner, DependencyProvides, fieldName, providedField)
+					}
+				})
+			}
+		}
+	}
+
+	for service := range serviceSet {
+		graph.Services = append(graph.Services, service)
+	}
+	sort.Strings(graph.Services)
+
+	for _, edges := range graph.Dependencies {
+		sort.Slice(edges, func(i, j int) bool {
+			if edges[i].Service != edges[j].Service {
+				return edges[i].Service < edges[j].Service
+			}
+			if edges[i].Field != edges[j].Field {
+				return edges[i].Field < edges[j].Field
+			}
+			return edges[i].Directive < edges[j].Directive
+		})
+	}
+
+	return graph
+}
+
+// DOT 以 Graphviz DOT 格式输出依赖图，边从依赖方指向被依赖的服务，标签为指令、字段和所需字段
+func (g *DependencyGraph) DOT() string {
+	var builder strings.Builder
+	builder.WriteString("digraph federation {\n")
+	for _, service := range g.Services {
+		fmt.Fprintf(&builder, "  %q;\n", service)
+	}
+	for _, service := range g.Services {
+		for _, edge := range g.Dependencies[service] {
+			label := fmt.Sprintf("@%s %s (%s)", edge.Directive, edge.Field, strings.Join(edge.Fields, ", "))
+			fmt.Fprintf(&builder, "  %q -> %q [label=%q];\n", service, edge.Service, label)
+		}
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
@@ -0,0 +1,114 @@
+package federation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_ServiceDependencyGraph(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "products",
+				Endpoint: "http://products/graphql",
+				Schema:   `type Product @key(fields: "upc") { upc: String! weight: Int name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "shipping",
+				Endpoint: "http://shipping/graphql",
+				Schema: `
+					type Product @key(fields: "upc") {
+						upc: String!
+						weight: Int @external
+						name: String @external
+						estimate: Int @requires(fields: "weight")
+					}
+					type Shipment @key(fields: "id") { id: ID! product: Product @provides(fields: "name") }`,
+				Timeout: time.Second,
+			},
+		},
+		QueryTimeout: time.Second,
+	}
+	engine, err := NewEngineWithCaller(config, &listCaller{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	graph, err := engine.ServiceDependencyGraph()
+	if err != nil {
+		t.Fatalf("ServiceDependencyGraph() error = %v", err)
+	}
+
+	expected := &DependencyGraph{
+		Services: []string{"products", "shipping"},
+		Dependencies: map[string][]DependencyEdge{
+			"shipping": {
+				{Service: "products", Directive: DependencyRequires, Field: "Product.estimate", Fields: []string{"weight"}},
+				{Service: "products", Directive: DependencyProvides, Field: "Shipment.product", Fields: []string{"name"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(graph, expected) {
+		t.Fatalf("Unexpected dependency graph:\n got: %+v\nwant: %+v", graph, expected)
+	}
+
+	dot := graph.DOT()
+	for _, line := range []string{
+		`"products";`,
+		`"shipping" -> "products" [label="@requires Product.estimate (weight)"];`,
+		`"shipping" -> "products" [label="@provides Shipment.product (name)"];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("Expected DOT output to contain %s, got:\n%s", line, dot)
+		}
+	}
+}
+
+func TestEngine_ServiceDependencyGraph_NestedRequires(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "warehouse",
+				Endpoint: "http://warehouse/graphql",
+				Schema:   `type Product @key(fields: "upc") { upc: String! dimensions: Dimensions } type Dimensions { height: Int depth: Int }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "shipping",
+				Endpoint: "http://shipping/graphql",
+				Schema: `
+					type Product @key(fields: "upc") {
+						upc: String!
+						dimensions: Dimensions @external
+						volume: Int @requires(fields: "dimensions { height depth }")
+					}
+					type Dimensions { height: Int depth: Int }`,
+				Timeout: time.Second,
+			},
+		},
+		QueryTimeout: time.Second,
+	}
+	engine, err := NewEngineWithCaller(config, &listCaller{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	graph, err := engine.ServiceDependencyGraph()
+	if err != nil {
+		t.Fatalf("ServiceDependencyGraph() error = %v", err)
+	}
+
+	// 嵌套的必需字段按叶子路径记录在边上
+	expected := []DependencyEdge{
+		{Service: "warehouse", Directive: DependencyRequires, Field: "Product.volume", Fields: []string{"dimensions.height", "dimensions.depth"}},
+	}
+	if !reflect.DeepEqual(graph.Dependencies["shipping"], expected) {
+		t.Errorf("Unexpected nested @requires edges:\n got: %+v\nwant: %+v", graph.Dependencies["shipping"], expected)
+	}
+}
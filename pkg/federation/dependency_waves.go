@@ -0,0 +1,93 @@
+package federation
+
+import (
+	"context"
+
+	"envoy-wasm-graphql-federation/pkg/planner"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// subQueryWaves 按计划依赖把子查询分成依次执行的批次：服务所依赖的全部服务
+// 都在更早的批次中执行完毕后才调度它。依赖中没有子查询的服务忽略，
+// 循环依赖由计划验证拒绝，这里不再展开。返回子查询下标，批次内保持计划顺序
+func subQueryWaves(plan *federationtypes.ExecutionPlan) [][]int {
+	services := make(map[string]bool, len(plan.SubQueries))
+	for _, subQuery := range plan.SubQueries {
+		services[subQuery.ServiceName] = true
+	}
+
+	levels := make(map[string]int, len(services))
+	visiting := make(map[string]bool)
+	var levelOf func(service string) int
+	levelOf = func(service string) int {
+		if level, ok := levels[service]; ok {
+			return level
+		}
+		if visiting[service] {
+			return 0
+		}
+		visiting[service] = true
+
+		level := 0
+		for _, dependency := range plan.Dependencies[service] {
+			if dependency != service && services[dependency] {
+				if dependencyLevel := levelOf(dependency) + 1; dependencyLevel > level {
+					level = dependencyLevel
+				}
+			}
+		}
+
+		visiting[service] = false
+		levels[service] = level
+		return level
+	}
+
+	var waves [][]int
+	for i, subQuery := range plan.SubQueries {
+		level := levelOf(subQuery.ServiceName)
+		for len(waves) <= level {
+			waves = append(waves, nil)
+		}
+		waves[level] = append(waves[level], i)
+	}
+	return waves
+}
+
+// executeSubQueryWaves 按依赖批次执行子查询。只有依赖来自 @requires 分析的计划分批，
+// 按服务名推断的依赖只影响顺序，子查询仍全部并发执行。批次只保证顺序：根子查询彼此独立，
+// @requires 字段的取值由实体查询传递，规划器先安排取回必需字段的实体查询，再把字段放入依赖服务的表示。
+// 响应按计划中的子查询顺序返回，之前批次的响应在出错时仍然保留
+func (e *Engine) executeSubQueryWaves(ctx context.Context, plan *federationtypes.ExecutionPlan, execCtx *federationtypes.ExecutionContext) ([]*federationtypes.ServiceResponse, error) {
+	var waves [][]int
+	if federationPlan, _ := plan.Metadata[planner.FederationPlanMetadataKey].(bool); federationPlan {
+		waves = subQueryWaves(plan)
+	}
+	if len(waves) <= 1 {
+		return e.executeSubQueries(ctx, plan.SubQueries, execCtx)
+	}
+
+	// 所有批次共享查询超时
+	queryCtx, cancel := context.WithTimeout(ctx, execCtx.Config.QueryTimeout)
+	defer cancel()
+
+	responses := make([]*federationtypes.ServiceResponse, len(plan.SubQueries))
+	for _, wave := range waves {
+		subQueries := make([]federationtypes.SubQuery, len(wave))
+		for i, index := range wave {
+			subQueries[i] = plan.SubQueries[index]
+		}
+
+		e.logger.Debug("Executing sub-query wave", "requestId", execCtx.RequestID, "count", len(subQueries))
+		waveResponses, err := e.executeSubQueries(queryCtx, subQueries, execCtx)
+		for i, index := range wave {
+			if i < len(waveResponses) {
+				responses[index] = waveResponses[i]
+			}
+		}
+		if err != nil {
+			return responses, err
+		}
+	}
+
+	return responses, nil
+}
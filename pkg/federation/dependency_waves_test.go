@@ -0,0 +1,38 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+func TestSubQueryWaves(t *testing.T) {
+	plan := &federationtypes.ExecutionPlan{
+		SubQueries: []federationtypes.SubQuery{
+			{ServiceName: "shipping"},
+			{ServiceName: "inventory"},
+			{ServiceName: "pricing"},
+		},
+		// shipping 的 @requires 字段分别来自 inventory 和 pricing
+		Dependencies: map[string][]string{"shipping": {"inventory", "pricing"}},
+	}
+
+	if waves := subQueryWaves(plan); !reflect.DeepEqual(waves, [][]int{{1, 2}, {0}}) {
+		t.Errorf("Expected providers before dependent, got %v", waves)
+	}
+
+	// 依赖链逐级分批，计划中没有子查询的依赖被忽略
+	plan.Dependencies = map[string][]string{
+		"shipping": {"pricing", "reviews"},
+		"pricing":  {"inventory"},
+	}
+	if waves := subQueryWaves(plan); !reflect.DeepEqual(waves, [][]int{{1}, {2}, {0}}) {
+		t.Errorf("Expected chained waves, got %v", waves)
+	}
+
+	plan.Dependencies = nil
+	if waves := subQueryWaves(plan); !reflect.DeepEqual(waves, [][]int{{0, 1, 2}}) {
+		t.Errorf("Expected a single wave without dependencies, got %v", waves)
+	}
+}
@@ -0,0 +1,30 @@
+package federation
+
+import (
+	"strings"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// DefaultAllowedDirectives 未配置 allowedDirectives 时查询可使用的指令：
+// GraphQL 规范内置指令、Federation 指令和网关处理的 @timeout、@noCache
+var DefaultAllowedDirectives = []string{
+	"skip", "include", "deprecated", "specifiedBy",
+	"key", "external", "requires", "provides", "extends", "shareable", "inaccessible",
+	"override", "tag", "link", "interfaceObject", "composeDirective",
+	timeoutDirective, noCacheDirective,
+}
+
+// configureDirectiveAllowlist 按配置重建查询指令允许列表，配置名称可带 @ 前缀
+func (e *Engine) configureDirectiveAllowlist(config *federationtypes.FederationConfig) {
+	names := config.AllowedDirectives
+	if len(names) == 0 {
+		names = DefaultAllowedDirectives
+	}
+
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[strings.TrimPrefix(strings.TrimSpace(name), "@")] = true
+	}
+	e.allowedDirectives = allowed
+}
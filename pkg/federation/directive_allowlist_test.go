@@ -0,0 +1,68 @@
+package federation
+
+import (
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_DirectiveAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		query   string
+		wantErr bool
+	}{
+		{"default allows include", nil, `{ people { id @include(if: true) } }`, false},
+		{"default allows gateway directives", nil, `query @noCache { people { id } }`, false},
+		{"default rejects internal directive", nil, `{ people { id @source(name: "internal") } }`, true},
+		{"configured directive", []string{"@source"}, `{ people { id @source(name: "internal") } }`, false},
+		{"configured name without prefix", []string{"source"}, `{ people { id @source(name: "internal") } }`, false},
+		{"configured list replaces defaults", []string{"@source"}, `{ people { id @include(if: true) } }`, true},
+		{"operation directive", []string{"@include"}, `query @source(name: "internal") { people { id } }`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewEngine(&federationtypes.FederationConfig{AllowedDirectives: tt.allowed}, utils.NewLogger("test"))
+			if err != nil {
+				t.Fatalf("NewEngine() error = %v", err)
+			}
+			query, err := engine.parseQuery(&federationtypes.GraphQLRequest{Query: tt.query})
+			if err != nil {
+				t.Fatalf("parseQuery() error = %v", err)
+			}
+
+			err = engine.validateQueryLimits(query)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("validateQueryLimits() error = %v", err)
+				}
+				return
+			}
+			if federationErr, ok := err.(*errors.FederationError); !ok || federationErr.Code != errors.ErrCodeDirectiveNotAllowed {
+				t.Errorf("Expected DIRECTIVE_NOT_ALLOWED, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEngine_DirectiveAllowlistReloaded(t *testing.T) {
+	engine, err := NewEngine(&federationtypes.FederationConfig{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if engine.allowedDirectives["source"] {
+		t.Fatal("Expected @source to be outside the default allowlist")
+	}
+
+	// 重载配置后立即生效
+	if err := engine.Initialize(&federationtypes.FederationConfig{AllowedDirectives: []string{"@source"}}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if !engine.allowedDirectives["source"] || engine.allowedDirectives["include"] {
+		t.Errorf("Expected reloaded allowlist to replace the defaults, got %v", engine.allowedDirectives)
+	}
+}
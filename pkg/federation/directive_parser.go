@@ -86,10 +86,12 @@ func (p *DirectiveParser) ParseKeyDirective(directive string) (*federationtypes.
 		keyDirective.Resolvable = matches[2] == "true"
 	}
 
-	// 验证字段选择集格式
-	if err := p.validateFieldSelection(keyDirective.Fields); err != nil {
+	// 解析字段选择集，支持嵌套与列表字段
+	selection, err := federationtypes.ParseFieldSet(keyDirective.Fields)
+	if err != nil {
 		return nil, fmt.Errorf("invalid key fields: %w", err)
 	}
+	keyDirective.Selection = selection
 
 	return keyDirective, nil
 }
@@ -136,10 +138,12 @@ func (p *DirectiveParser) ParseRequiresDirective(directive string) (*federationt
 		Fields: strings.TrimSpace(matches[1]),
 	}
 
-	// 验证字段选择集格式
-	if err := p.validateFieldSelection(requiresDirective.Fields); err != nil {
+	// 解析字段选择集，支持嵌套与列表字段
+	selection, err := federationtypes.ParseFieldSet(requiresDirective.Fields)
+	if err != nil {
 		return nil, fmt.Errorf("invalid requires fields: %w", err)
 	}
+	requiresDirective.Selection = selection
 
 	return requiresDirective, nil
 }
@@ -162,10 +166,12 @@ func (p *DirectiveParser) ParseProvidesDirective(directive string) (*federationt
 		Fields: strings.TrimSpace(matches[1]),
 	}
 
-	// 验证字段选择集格式
-	if err := p.validateFieldSelection(providesDirective.Fields); err != nil {
+	// 解析字段选择集，支持嵌套与列表字段
+	selection, err := federationtypes.ParseFieldSet(providesDirective.Fields)
+	if err != nil {
 		return nil, fmt.Errorf("invalid provides fields: %w", err)
 	}
+	providesDirective.Selection = selection
 
 	return providesDirective, nil
 }
@@ -272,11 +278,8 @@ func (p *DirectiveParser) validateFieldSelection(fields string) error {
 		return errors.NewValidationError("field selection cannot be empty")
 	}
 
-	// 简单验证：检查是否包含有效的字段名
-	// 这里可以根据需要实现更复杂的 GraphQL 字段选择集验证
-	fieldRegex := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\s+[a-zA-Z_][a-zA-Z0-9_]*)*$`)
-	if !fieldRegex.MatchString(strings.TrimSpace(fields)) {
-		return fmt.Errorf("invalid field selection format: %s", fields)
+	if _, err := federationtypes.ParseFieldSet(fields); err != nil {
+		return fmt.Errorf("invalid field selection format: %s: %w", fields, err)
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package federation
 
 import (
+	"reflect"
 	"testing"
 
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
@@ -166,6 +167,24 @@ func TestDirectiveParser_ParseRequiresDirective(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:      "requires directive with nested selection",
+			directive: `@requires(fields: "address { zip } tags")`,
+			expected: &federationtypes.RequiresDirective{
+				Fields: "address { zip } tags",
+				Selection: []federationtypes.FieldSelection{
+					{Name: "address", Selections: []federationtypes.FieldSelection{{Name: "zip"}}},
+					{Name: "tags"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:      "requires directive with unbalanced braces",
+			directive: `@requires(fields: "address { zip")`,
+			expected:  nil,
+			wantErr:   true,
+		},
 		{
 			name:      "invalid directive format",
 			directive: `@requires(invalid)`,
@@ -198,6 +217,10 @@ func TestDirectiveParser_ParseRequiresDirective(t *testing.T) {
 			if result.Fields != tt.expected.Fields {
 				t.Errorf("ParseRequiresDirective() fields = %v, expected %v", result.Fields, tt.expected.Fields)
 			}
+
+			if tt.expected.Selection != nil && !reflect.DeepEqual(result.Selection, tt.expected.Selection) {
+				t.Errorf("ParseRequiresDirective() selection = %+v, expected %+v", result.Selection, tt.expected.Selection)
+			}
 		})
 	}
 }
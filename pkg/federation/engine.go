@@ -3,18 +3,24 @@ package federation
 import (
 	"context"
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	stderrors "errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"envoy-wasm-graphql-federation/pkg/cache"
 	"envoy-wasm-graphql-federation/pkg/caller"
 	"envoy-wasm-graphql-federation/pkg/errors"
 	"envoy-wasm-graphql-federation/pkg/merger"
 	"envoy-wasm-graphql-federation/pkg/parser"
+	"envoy-wasm-graphql-federation/pkg/persisted"
 	"envoy-wasm-graphql-federation/pkg/planner"
 	"envoy-wasm-graphql-federation/pkg/registry"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
 )
 
 // Engine 实现 GraphQL Federation 引擎
@@ -32,6 +38,68 @@ type Engine struct {
 	federationPlanner federationtypes.FederationPlanner
 	entityResolver    federationtypes.EntityResolver
 
+	// 查询结果缓存，EnableCaching 关闭时为 nil
+	queryCache              cache.Cache
+	cacheKeys               *cache.CacheKeyGenerator
+	queryCacheMaxValueBytes int // 当前查询缓存的结果大小上限，变化时重建缓存
+
+	// 查询解析缓存，ParseCache 未配置时为 nil
+	parseCache *parseCache
+
+	// 持久化查询存储（APQ 与允许列表）
+	persistedQueries federationtypes.PersistedQueryStore
+
+	// 并发相同查询合并器，CoalesceQueries 关闭时为 nil
+	coalescer *coalescer
+
+	// 请求内去重缓存复用已有调用结果的次数
+	requestCacheHits atomic.Int64
+
+	// 子查询执行协程池，跨请求共享
+	workerPool *utils.WorkerPool
+
+	// 查询并发上限与排队策略，LoadShedding 未配置时为 nil
+	loadShedder atomic.Pointer[loadShedder]
+
+	// 已准入、正在执行的查询数，未配置 LoadShedding 时同样统计
+	inFlightQueries atomic.Int64
+
+	// 查询允许使用的指令，键为不含 @ 的指令名
+	allowedDirectives map[string]bool
+
+	// 变量规范化：自定义转换器优先于按 VariableCoercion 配置生成的默认转换器
+	variableTransformer        federationtypes.VariableTransformer
+	defaultVariableTransformer federationtypes.VariableTransformer
+
+	// 合并后、序列化前按注册顺序执行的响应转换器
+	responseTransformers []federationtypes.ResponseTransformer
+
+	// 组合模式的内省结果缓存
+	introspection atomic.Pointer[introspectionSnapshot]
+
+	// 各服务模式的类型索引缓存，重新初始化时清除
+	schemaIndexCache atomic.Pointer[schemaIndex]
+
+	// 按服务统计的滚动错误率
+	errorRateConfig atomic.Pointer[federationtypes.ErrorRateConfig]
+	errorRates      sync.Map // 服务名 -> *serviceErrorRate
+
+	// 按服务累计的上游调用次数和字节数
+	serviceUsage sync.Map // 服务名 -> *serviceUsageTotals
+
+	// 详细执行追踪的采样统计
+	traceSampling traceSamplingCounters
+
+	// 按服务累计的镜像流量对比统计
+	shadowTraffic  sync.Map // 服务名 -> *shadowTotals
+	shadowInFlight atomic.Int64
+
+	// 序列化后响应大小的直方图
+	responseSizes atomic.Pointer[responseSizeMetrics]
+
+	// 最近一次初始化中模式注册失败的服务，非空时网关不就绪
+	failedSchemas []string
+
 	// 配置和状态
 	federationConfig *federationtypes.FederationConfig
 	status           federationtypes.EngineStatus
@@ -53,6 +121,23 @@ func NewEngine(config *federationtypes.FederationConfig, logger federationtypes.
 		return nil, fmt.Errorf("logger is required")
 	}
 
+	return NewEngineWithCaller(config, caller.NewHTTPCaller(nil, logger), logger)
+}
+
+// NewEngineWithCaller 使用指定的服务调用器创建联邦引擎
+func NewEngineWithCaller(config *federationtypes.FederationConfig, serviceCaller federationtypes.ServiceCaller, logger federationtypes.Logger) (*Engine, error) {
+	if config == nil {
+		return nil, fmt.Errorf("configuration is required")
+	}
+
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+
+	if serviceCaller == nil {
+		return nil, fmt.Errorf("service caller is required")
+	}
+
 	engine := &Engine{
 		federationConfig: config,
 		logger:           logger,
@@ -64,21 +149,26 @@ func NewEngine(config *federationtypes.FederationConfig, logger federationtypes.
 	}
 
 	// 初始化组件
-	engine.parser = parser.NewParser(logger)
-	engine.planner = planner.NewPlanner(logger)
+	engine.parser = parser.NewParserWithConfig(parserConfigFrom(config), logger)
+	engine.parseCache = newParseCache(config.ParseCache)
+	engine.planner = planner.NewPlannerWithConfig(engine.plannerConfig(config), logger)
+	engine.caller = serviceCaller
+	engine.merger = merger.NewResponseMerger(mergerConfigFrom(config), logger)
+	engine.registry = registry.NewSchemaRegistry(nil, logger)
 
 	// 初始化 Federation 组件
 	engine.directiveParser = NewDirectiveParser(logger)
-	engine.federationPlanner = NewFederatedPlanner(logger)
-	engine.entityResolver = NewEntityResolver(logger, nil) // caller 将在后面初始化
-
-	// 初始化其他组件
-	engine.caller = caller.NewHTTPCaller(nil, logger)
-	engine.merger = merger.NewResponseMerger(nil, logger)
-	engine.registry = registry.NewSchemaRegistry(nil, logger)
-
-	// 更新 entityResolver 的 caller
-	engine.entityResolver = NewEntityResolver(logger, engine.caller)
+	engine.federationPlanner = NewFederatedPlannerWithConfig(federatedPlannerConfigFrom(config), logger)
+	engine.entityResolver = NewEntityResolverWithConfig(entityResolverConfigFrom(config), logger, engine.caller)
+	engine.configureQueryCache(config)
+	engine.configureErrorRates(config)
+	engine.configureResponseSize(config)
+	engine.configureCoalescing(config)
+	engine.configureWorkerPool(config)
+	engine.configureLoadShedding(config)
+	engine.configureDirectiveAllowlist(config)
+	engine.configureVariableTransformer(config)
+	engine.persistedQueries = persisted.NewPersistedQueryStore(nil, logger)
 
 	logger.Info("Federation engine created",
 		"services", len(config.Services),
@@ -96,21 +186,53 @@ func (e *Engine) Initialize(config *federationtypes.FederationConfig) error {
 	defer e.mutex.Unlock()
 
 	// 更新配置
+	oldConfig := e.federationConfig
 	e.federationConfig = config
+	e.parser = parser.NewParserWithConfig(parserConfigFrom(config), e.logger)
+	// 解析选项可能变化，重建解析缓存
+	e.parseCache = newParseCache(config.ParseCache)
+	e.planner = planner.NewPlannerWithConfig(e.plannerConfig(config), e.logger)
+	e.merger = merger.NewResponseMerger(mergerConfigFrom(config), e.logger)
+	e.federationPlanner = NewFederatedPlannerWithConfig(federatedPlannerConfigFrom(config), e.logger)
+	e.entityResolver = NewEntityResolverWithConfig(entityResolverConfigFrom(config), e.logger, e.caller)
+	e.configureQueryCache(config)
+	e.configureErrorRates(config)
+	e.configureResponseSize(config)
+	e.configureCoalescing(config)
+	e.configureWorkerPool(config)
+	e.configureLoadShedding(config)
+	e.configureDirectiveAllowlist(config)
+	e.configureVariableTransformer(config)
+	if err := e.loadPersistedQueries(config); err != nil {
+		return err
+	}
+	if handler, ok := e.caller.(configReloadHandler); ok {
+		if err := handler.OnConfigReload(oldConfig, config); err != nil {
+			e.logger.Warn("Service caller reload failed", "error", err)
+		}
+	}
 
 	// 初始化配置管理器
 	// 配置已经通过构造函数传入，无需其他初始化
 
 	// 注册服务模式到SchemaRegistry
+	e.failedSchemas = nil
 	for _, service := range config.Services {
+		// 先应用固定版本，未设置时清除之前的固定
+		e.registry.PinSchemaVersion(service.Name, service.PinnedSchemaVersion)
+
 		if service.Schema != "" {
 			if err := e.registry.RegisterSchema(service.Name, service.Schema); err != nil {
 				e.logger.Warn("Failed to register schema", "service", service.Name, "error", err)
-				// 不阻止初始化，只记录警告
+				// 不阻止初始化，只记录警告，配置了就绪检查时网关不就绪
+				e.failedSchemas = append(e.failedSchemas, service.Name)
 			}
 		}
 	}
 
+	// 服务模式可能变化，类型索引按需重建
+	e.schemaIndexCache.Store(nil)
+
 	// 初始化服务状态
 	e.initializeServiceStatus()
 
@@ -134,50 +256,260 @@ func (e *Engine) ExecuteQuery(ctx *federationtypes.ExecutionContext, request *fe
 
 	e.incrementQueryCount()
 
+	// 过载时快速拒绝，而不是让请求堆积到超时
+	release, err := e.admitQuery()
+	if err != nil {
+		e.incrementErrorCount()
+		e.logger.Warn("Query shed due to overload", "requestId", ctx.RequestID, "error", err)
+		return nil, err
+	}
+	defer release()
+
+	e.inFlightQueries.Add(1)
+	defer e.inFlightQueries.Add(-1)
+
+	// 请求内去重缓存只在本次请求内有效
+	defer ctx.ClearRequestCache()
+
+	// 客户端未提供 traceparent 时生成新的追踪，子查询以子 span 继续该追踪
+	traceparent := ensureTraceContext(ctx)
+
+	// 按采样比例或强制追踪请求头决定是否记录详细执行追踪
+	e.decideTraceSampling(ctx)
+
 	e.logger.Info("Executing GraphQL query",
 		"requestId", ctx.RequestID,
-		"operation", request.OperationName,
+		"operation", operationLabel(ctx, request),
+		"traceparent", traceparent,
 	)
 
+	response, err := e.executeRequest(ctx, request)
+	if err == nil && e.federationConfig.TraceparentExtension {
+		response = attachTraceparent(response, traceparent)
+	}
+	if err == nil {
+		response, err = e.transformResponse(ctx, response)
+		if err != nil {
+			e.incrementErrorCount()
+		}
+	}
+	return response, err
+}
+
+// executeRequest 解析、验证并执行请求
+func (e *Engine) executeRequest(ctx *federationtypes.ExecutionContext, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+	// 解析持久化查询并执行允许列表检查
+	request, err := e.resolvePersistedQuery(request)
+	if err != nil {
+		e.incrementErrorCount()
+		return nil, err
+	}
+
+	// 解析前按原始文本拒绝明显超限的查询，避免恶意输入进入解析器
+	if err := e.preScanQuery(request.Query); err != nil {
+		e.incrementErrorCount()
+		return nil, err
+	}
+
 	// 解析查询
-	parsedQuery, err := e.parser.ParseQuery(request.Query)
+	parsing := tracingPhase{start: time.Now()}
+	parsedQuery, err := e.parseQueryCached(request)
 	if err != nil {
 		e.incrementErrorCount()
 		return nil, fmt.Errorf("query parsing failed: %w", err)
 	}
+	parsing.duration = time.Since(parsing.start)
 
 	// 验证查询深度和复杂度
+	validation := tracingPhase{start: time.Now()}
 	if err := e.validateQueryLimits(parsedQuery); err != nil {
 		e.incrementErrorCount()
 		return nil, err
 	}
 
+	// 操作级 @timeout 指令仅覆盖本次请求的服务超时，须在允许列表中
+	ctx.ServiceTimeouts, err = e.parseTimeoutDirectives(parsedQuery)
+	if err != nil {
+		e.incrementErrorCount()
+		return nil, err
+	}
+
+	// 操作级 @noCache 指令在查询缓存读取和写入之前生效
+	ctx.NoCache, err = parseNoCacheDirective(parsedQuery)
+	if err != nil {
+		e.incrementErrorCount()
+		return nil, err
+	}
+	validation.duration = time.Since(validation.start)
+
+	// 分发前规范化变量，子查询、实体查询和缓存键都使用规范化后的变量
+	request, err = e.transformVariables(ctx, request, parsedQuery)
+	if err != nil {
+		e.incrementErrorCount()
+		return nil, err
+	}
+
+	// 内省查询由网关按组合模式直接应答，不分发到子图
+	if isIntrospectionQuery(parsedQuery) {
+		return e.executeIntrospection(parsedQuery)
+	}
+
+	// tracing 数据属于单个请求，不参与合并
+	if e.tracingEnabled(ctx) {
+		start := ctx.StartTime
+		if start.IsZero() || start.After(parsing.start) {
+			start = parsing.start
+		}
+		response, err := e.executeParsedQuery(ctx, request, parsedQuery)
+		if err == nil {
+			e.attachTracing(ctx, parsedQuery, response, start, parsing, validation)
+		}
+		return response, err
+	}
+
+	// 合并并发的相同查询，跟随者复用进行中执行的结果；采样的请求单独执行以记录完整追踪
+	if queryCoalescer := e.coalescer; queryCoalescer != nil && isQueryOperation(parsedQuery) && !ctx.TraceSampled && !ctx.NoCache {
+		return queryCoalescer.do(coalescingKey(request, operationLabel(ctx, request)), func() (*federationtypes.GraphQLResponse, error) {
+			return e.executeParsedQuery(ctx, request, parsedQuery)
+		})
+	}
+
+	return e.executeParsedQuery(ctx, request, parsedQuery)
+}
+
+// executeParsedQuery 执行已解析并通过限制检查的查询
+func (e *Engine) executeParsedQuery(ctx *federationtypes.ExecutionContext, request *federationtypes.GraphQLRequest, parsedQuery *federationtypes.ParsedQuery) (*federationtypes.GraphQLResponse, error) {
+	// 命中查询缓存时直接返回，带 @noCache 的操作既不读取也不写入缓存
+	var cacheKey string
+	var policy cachePolicy
+	if e.queryCache != nil && !ctx.NoCache {
+		policy = e.computeCachePolicy(parsedQuery)
+		e.applyClientCachePolicy(request, &policy)
+		if policy.cacheable {
+			cacheKey = e.cacheKeys.GenerateQueryKey(request.Query, request.Variables, operationLabel(ctx, request))
+			if entry, ok := e.queryCache.GetQueryEntry(cacheKey); ok {
+				response := cloneResponse(entry.Value.(*federationtypes.GraphQLResponse))
+				now := time.Now()
+				e.attachCacheMetadata(response, true, now.Sub(entry.CreatedAt), entry.ExpiresAt.Sub(now))
+				return response, nil
+			}
+		}
+	}
+
 	// 创建执行计划
+	planningStart := time.Now()
 	plan, err := e.createExecutionPlan(context.Background(), parsedQuery)
 	if err != nil {
 		e.incrementErrorCount()
 		return nil, fmt.Errorf("planning failed: %w", err)
 	}
+	planningTime := time.Since(planningStart)
+
+	// 合并时丢弃子图返回的未选择字段
+	if e.federationConfig.UnknownFieldPolicy == string(merger.UnknownFieldPolicyDrop) {
+		plan.Selection = mergeSelection(parsedQuery, plan)
+	}
 
 	// 执行计划
+	executionStart := time.Now()
 	response, err := e.executePlan(context.Background(), plan, ctx)
 	if err != nil {
 		e.incrementErrorCount()
 		return nil, fmt.Errorf("execution failed: %w", err)
 	}
+	executionTime := time.Since(executionStart)
+
+	// 具体类型位置的 __typename 由模式信息直接填充
+	e.resolveStaticTypenames(parsedQuery, response)
+
+	// 去除规划器补充的 __typename 和键字段，再按客户端选择集裁剪子图多返回的字段
+	stripInjectedFields(parsedQuery, plan, response)
+	if e.federationConfig.StrictProjection {
+		e.applyStrictProjection(parsedQuery, response)
+	}
+
+	// 规划时按目标服务模式删除了字段，在 extensions 中告知客户端这些字段不会出现在结果中
+	if pruned, ok := plan.Metadata[planner.PrunedFieldsMetadataKey]; ok {
+		if response.Extensions == nil {
+			response.Extensions = make(map[string]interface{})
+		}
+		response.Extensions[planner.PrunedFieldsMetadataKey] = pruned
+	}
+
+	// 仅缓存无错误的响应，TTL 取所选字段 @cacheControl 的最小 maxAge，客户端提示可覆盖
+	if cacheKey != "" && !policy.noStore && len(response.Errors) == 0 {
+		if err := e.queryCache.SetQueryForServices(cacheKey, cloneResponse(response), policy.ttl(), cache.PlanServices(plan)); err != nil {
+			e.logger.Warn("Failed to cache query response", "requestId", ctx.RequestID, "error", err)
+		} else {
+			e.attachCacheMetadata(response, false, 0, policy.ttl())
+		}
+	}
+
+	// 规划和执行阶段的耗时、计划哈希只在调试模式下通过 extensions 输出
+	if e.federationConfig.DebugMode {
+		if response.Extensions == nil {
+			response.Extensions = make(map[string]interface{})
+		}
+		response.Extensions["timings"] = map[string]interface{}{
+			"planningMs":  planningTime.Milliseconds(),
+			"executionMs": executionTime.Milliseconds(),
+		}
+		if planHash, ok := plan.Metadata[planner.PlanHashMetadataKey]; ok {
+			response.Extensions[planner.PlanHashMetadataKey] = planHash
+		}
+	}
 
 	duration := time.Since(ctx.StartTime)
 	e.logger.Info("Query executed successfully",
 		"requestId", ctx.RequestID,
 		"duration", duration,
 		"subQueries", len(plan.SubQueries),
+		"planHash", plan.Metadata[planner.PlanHashMetadataKey],
+		"serviceUsage", ctx.ServiceUsage(),
 	)
+	e.logSampledTrace(ctx, parsedQuery)
 
 	return response, nil
 }
 
-// createExecutionPlan 创建执行计划
+// createExecutionPlan 创建执行计划，配置了 PlanningTimeout 时规划阶段单独限时
 func (e *Engine) createExecutionPlan(ctx context.Context, query *federationtypes.ParsedQuery) (*federationtypes.ExecutionPlan, error) {
+	timeout := e.federationConfig.PlanningTimeout
+	if timeout <= 0 {
+		return e.buildExecutionPlan(ctx, query)
+	}
+
+	planningCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type planResult struct {
+		plan *federationtypes.ExecutionPlan
+		err  error
+	}
+	resultCh := make(chan planResult, 1)
+
+	// 规划器在各阶段检查上下文，超时后不等待其返回
+	go func() {
+		plan, err := e.buildExecutionPlan(planningCtx, query)
+		resultCh <- planResult{plan: plan, err: err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.plan, result.err
+	case <-planningCtx.Done():
+		e.logger.Warn("Query planning timed out", "timeout", timeout)
+		return nil, errors.NewPlanningError(
+			fmt.Sprintf("query planning exceeded %s", timeout),
+			errors.WithCause(planningCtx.Err()),
+			errors.WithExtension("reason", "PLANNING_TIMEOUT"),
+			errors.WithExtension("limit", timeout.String()),
+		)
+	}
+}
+
+// buildExecutionPlan 创建、验证并优化执行计划
+func (e *Engine) buildExecutionPlan(ctx context.Context, query *federationtypes.ParsedQuery) (*federationtypes.ExecutionPlan, error) {
 	services := e.federationConfig.Services
 
 	// 创建基本计划
@@ -193,7 +525,7 @@ func (e *Engine) createExecutionPlan(ctx context.Context, query *federationtypes
 
 	// 优化计划（如果启用）
 	if e.federationConfig.EnableQueryPlan {
-		optimizedPlan, err := e.planner.OptimizePlan(plan)
+		optimizedPlan, err := e.planner.OptimizePlan(ctx, plan)
 		if err != nil {
 			e.logger.Warn("Plan optimization failed, using original plan", "error", err)
 		} else {
@@ -215,21 +547,139 @@ func (e *Engine) executePlan(ctx context.Context, plan *federationtypes.Executio
 		return nil, errors.NewExecutionError("response merger not initialized")
 	}
 
-	// 执行子查询
-	responses, err := e.executeSubQueries(ctx, plan.SubQueries, execCtx)
+	// 配置了硬超时时，整个执行超过该时间即中止；软超时到达时只合并已收到的子查询结果
+	ctx, cancelHard := e.applyQueryTimeouts(ctx, execCtx)
+	defer cancelHard()
+
+	// 配置了合并预留时，上游调用提前截止，为合并留出时间
+	fetchCtx, mergeCtx, cancel := e.reserveMergeHeadroom(ctx, execCtx)
+	defer cancel()
+
+	// 执行子查询，依赖其他服务的子查询等所依赖的全部服务完成后再调度
+	responses, err := e.executeSubQueryWaves(fetchCtx, plan, execCtx)
+	var limitErr *errors.FederationError
 	if err != nil {
-		return nil, err
+		if hardErr := e.hardTimeoutError(ctx); hardErr != nil {
+			return nil, hardErr
+		}
+		// 超出响应总字节上限时，按策略返回部分数据
+		if !e.federationConfig.PartialOnResponseLimit || !stderrors.As(err, &limitErr) || limitErr.Code != errors.ErrCodeResponseTooLarge {
+			return nil, err
+		}
+		responses = receivedResponses(responses)
+	}
+
+	// 记录上游响应头，供转发给客户端
+	for _, response := range responses {
+		e.recordUpstreamHeaders(execCtx, response)
 	}
 
 	// 合并响应
-	mergedResponse, err := e.merger.MergeResponses(ctx, responses, plan)
+	mergedResponse, err := e.merger.MergeResponses(mergeCtx, responses, plan)
 	if err != nil {
 		return nil, fmt.Errorf("response merging failed: %w", err)
 	}
 
+	if limitErr != nil {
+		mergedResponse.Errors = append(mergedResponse.Errors, federationtypes.GraphQLError{
+			Message:    limitErr.Message,
+			Extensions: limitErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+		})
+	}
+
+	// 根查询合并后执行依赖其结果的实体查询，超出响应上限时不再发起
+	if len(plan.EntityFetches) > 0 && limitErr == nil {
+		e.executeEntityFetches(ctx, plan.EntityFetches, mergedResponse, execCtx)
+	}
+
+	if hardErr := e.hardTimeoutError(ctx); hardErr != nil {
+		return nil, hardErr
+	}
+
+	// 所有子查询均失败时使用兜底数据，错误保持不变
+	if e.federationConfig.FallbackResponse != "" && allSubQueriesFailed(responses) {
+		e.applyFallbackResponse(mergedResponse)
+	}
+
 	return mergedResponse, nil
 }
 
+// allSubQueriesFailed 判断是否所有子查询都失败
+func allSubQueriesFailed(responses []*federationtypes.ServiceResponse) bool {
+	if len(responses) == 0 {
+		return false
+	}
+
+	for _, response := range responses {
+		if response != nil && response.Error == nil && response.Data != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// applyFallbackResponse 将配置的兜底 JSON 作为响应数据
+func (e *Engine) applyFallbackResponse(response *federationtypes.GraphQLResponse) {
+	var fallback map[string]interface{}
+	if err := jsonutil.Unmarshal([]byte(e.federationConfig.FallbackResponse), &fallback); err != nil {
+		e.logger.Warn("Failed to parse fallback response", "error", err)
+		return
+	}
+
+	e.logger.Warn("All sub-queries failed, returning fallback response", "errors", len(response.Errors))
+	response.Data = fallback
+}
+
+// trackResponseBytes 累加响应体大小，超出 MaxTotalResponseBytes 时返回 RESPONSE_TOO_LARGE 错误
+func (e *Engine) trackResponseBytes(execCtx *federationtypes.ExecutionContext, response *federationtypes.ServiceResponse) error {
+	limit := e.federationConfig.MaxTotalResponseBytes
+	if limit <= 0 {
+		return nil
+	}
+
+	total := execCtx.AddResponseBytes(responseBodySize(response))
+	if total <= limit {
+		return nil
+	}
+
+	return errors.NewResponseTooLargeError(
+		fmt.Sprintf("total upstream response size %d bytes exceeds maximum %d", total, limit),
+		errors.WithService(response.Service),
+		errors.WithExtension("maxTotalResponseBytes", limit),
+	)
+}
+
+// responseBodySize 返回响应体大小，调用器未提供时按序列化结果估算
+func responseBodySize(response *federationtypes.ServiceResponse) int64 {
+	if response.BodySize > 0 {
+		return response.BodySize
+	}
+
+	if response.Data == nil && len(response.Errors) == 0 {
+		return 0
+	}
+
+	body, err := jsonutil.Marshal(&federationtypes.GraphQLResponse{
+		Data:   response.Data,
+		Errors: response.Errors,
+	})
+	if err != nil {
+		return 0
+	}
+	return int64(len(body))
+}
+
+// receivedResponses 过滤掉未完成的子查询响应
+func receivedResponses(responses []*federationtypes.ServiceResponse) []*federationtypes.ServiceResponse {
+	received := make([]*federationtypes.ServiceResponse, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			received = append(received, response)
+		}
+	}
+	return received
+}
+
 // executeSubQueries 执行子查询（并发执行）
 func (e *Engine) executeSubQueries(ctx context.Context, subQueries []federationtypes.SubQuery, execCtx *federationtypes.ExecutionContext) ([]*federationtypes.ServiceResponse, error) {
 	if len(subQueries) == 0 {
@@ -240,89 +690,67 @@ func (e *Engine) executeSubQueries(ctx context.Context, subQueries []federationt
 
 	responses := make([]*federationtypes.ServiceResponse, len(subQueries))
 	errCh := make(chan error, len(subQueries))
-	responseCh := make(chan struct {
-		index    int
-		response *federationtypes.ServiceResponse
-	}, len(subQueries))
+	responseCh := make(chan subQueryResult, len(subQueries))
+
+	// 软超时已过（如后续波次）时不再发起调用
+	if softDeadlinePassed(execCtx) {
+		e.fillSoftTimeoutResponses(subQueries, responses, execCtx)
+		return responses, nil
+	}
 
 	// 创建上下文，支持超时和取消
 	queryCtx, cancel := context.WithTimeout(ctx, execCtx.Config.QueryTimeout)
 	defer cancel()
 
-	// 并发执行子查询
-	var wg sync.WaitGroup
-	for i, subQuery := range subQueries {
-		wg.Add(1)
-		go func(index int, sq federationtypes.SubQuery) {
-			defer wg.Done()
+	softTimeout, stopSoftTimeout := softTimeoutTimer(execCtx)
+	defer stopSoftTimeout()
 
-			startTime := time.Now()
-			e.logger.Debug("Executing sub-query", "service", sq.ServiceName, "index", index)
+	// 发往支持批量请求的同一服务的子查询合并为一次调用，其余并发执行
+	batches, batched := e.nativeBatchGroups(subQueries)
 
-			// 获取服务配置
-			var serviceConfig *federationtypes.ServiceConfig
-			for _, service := range e.federationConfig.Services {
-				if service.Name == sq.ServiceName {
-					serviceConfig = &service
-					break
-				}
-			}
-			if serviceConfig == nil {
-				e.logger.Error("Service not found in configuration", "service", sq.ServiceName)
-				errCh <- fmt.Errorf("service not found: %s", sq.ServiceName)
-				return
-			}
+	batchOf := make(map[int]int, len(subQueries))
+	for b, indexes := range batches {
+		for _, index := range indexes {
+			batchOf[index] = b
+		}
+	}
 
-			// 检查服务健康状态
-			if !e.caller.IsHealthy(queryCtx, serviceConfig) {
-				e.logger.Warn("Service is unhealthy", "service", sq.ServiceName)
-				response := &federationtypes.ServiceResponse{
-					Service: sq.ServiceName,
-					Error:   errors.NewServiceError("service is unhealthy: " + sq.ServiceName),
-					Latency: time.Since(startTime),
-				}
-				responseCh <- struct {
-					index    int
-					response *federationtypes.ServiceResponse
-				}{index, response}
-				return
+	// 按服务的解析优先级发起，工作池受限时优先级高的子查询先获得执行槽位
+	var wg sync.WaitGroup
+	submittedBatches := make(map[int]bool, len(batches))
+	for _, i := range e.dispatchOrder(subQueries) {
+		if batched[i] {
+			b := batchOf[i]
+			if submittedBatches[b] {
+				continue
 			}
+			submittedBatches[b] = true
+
+			indexes := batches[b]
+			wg.Add(1)
+			e.submitTask(func() {
+				defer wg.Done()
+				e.executeNativeBatch(queryCtx, execCtx, subQueries, indexes, responseCh, errCh)
+			})
+			continue
+		}
 
-			// 构建服务调用
-			call := &federationtypes.ServiceCall{
-				Service:   serviceConfig,
-				SubQuery:  &sq,
-				Context:   execCtx.QueryContext,
-				StartTime: startTime,
-			}
+		index, sq := i, subQueries[i]
+		wg.Add(1)
+		e.submitTask(func() {
+			defer wg.Done()
 
-			// 执行调用
-			response, err := e.caller.Call(queryCtx, call)
+			run, err := e.prepareSubQuery(queryCtx, execCtx, index, sq)
 			if err != nil {
-				e.logger.Error("Service call failed", "service", sq.ServiceName, "error", err)
-				// 创建错误响应
-				response = &federationtypes.ServiceResponse{
-					Service: sq.ServiceName,
-					Error:   err,
-					Latency: time.Since(startTime),
-					Metadata: map[string]interface{}{
-						"error_type": "service_call_error",
-						"query":      sq.Query,
-					},
-				}
+				errCh <- err
+				return
 			}
-
-			e.logger.Debug("Sub-query completed",
-				"service", sq.ServiceName,
-				"latency", response.Latency,
-				"hasError", response.Error != nil,
-			)
-
-			responseCh <- struct {
-				index    int
-				response *federationtypes.ServiceResponse
-			}{index, response}
-		}(i, subQuery)
+			if run.call != nil {
+				e.callSubQuery(queryCtx, execCtx, run)
+				e.finishSubQuery(execCtx, run)
+			}
+			responseCh <- subQueryResult{index, run.response}
+		})
 	}
 
 	// 等待所有goroutine完成
@@ -338,6 +766,16 @@ func (e *Engine) executeSubQueries(ctx context.Context, subQueries []federationt
 		select {
 		case result := <-responseCh:
 			if result.response != nil {
+				if err := e.trackResponseBytes(execCtx, result.response); err != nil {
+					// 取消未完成的子查询，丢弃超出上限的响应
+					cancel()
+					e.logger.Warn("Upstream response size limit exceeded",
+						"requestId", execCtx.RequestID,
+						"service", result.response.Service,
+						"totalBytes", execCtx.ResponseBytes(),
+					)
+					return responses, err
+				}
 				responses[result.index] = result.response
 				completed++
 			}
@@ -346,6 +784,15 @@ func (e *Engine) executeSubQueries(ctx context.Context, subQueries []federationt
 				// 即使有错误，也继续等待其他查询完成
 				e.logger.Error("Sub-query error", "error", err)
 			}
+		case <-softTimeout:
+			// 软超时：取消未完成的子查询，合并已收到的结果
+			cancel()
+			pending := e.fillSoftTimeoutResponses(subQueries, responses, execCtx)
+			e.logger.Warn("Soft query timeout reached, merging partial results",
+				"requestId", execCtx.RequestID,
+				"pending", pending,
+			)
+			return responses, nil
 		case <-queryCtx.Done():
 			// 超时或取消
 			e.logger.Warn("Sub-queries execution timeout or cancelled")
@@ -375,6 +822,120 @@ func (e *Engine) executeSubQueries(ctx context.Context, subQueries []federationt
 	return responses, nil
 }
 
+// subQueryResult 子查询在计划中的下标及其响应
+type subQueryResult struct {
+	index    int
+	response *federationtypes.ServiceResponse
+}
+
+// subQueryRun 单个子查询的执行状态
+type subQueryRun struct {
+	sq        federationtypes.SubQuery
+	call      *federationtypes.ServiceCall
+	startTime time.Time
+	response  *federationtypes.ServiceResponse
+	shared    bool // 复用了请求内相同调用的结果，不重复记录服务结果和用量
+	batched   bool // 作为原生批量请求中第一个之外的操作发送，服务结果已随第一个操作记录
+	err       error
+}
+
+// prepareSubQuery 查找服务配置并构建服务调用。服务不健康且开启 SkipUnhealthyServices 时
+// 不构建调用，直接给出错误响应
+func (e *Engine) prepareSubQuery(queryCtx context.Context, execCtx *federationtypes.ExecutionContext, index int, sq federationtypes.SubQuery) (*subQueryRun, error) {
+	run := &subQueryRun{sq: sq, startTime: time.Now()}
+	e.logger.Debug("Executing sub-query", "service", sq.ServiceName, "index", index)
+
+	// 获取服务配置
+	var serviceConfig *federationtypes.ServiceConfig
+	for _, service := range e.federationConfig.Services {
+		if service.Name == sq.ServiceName {
+			serviceConfig = &service
+			break
+		}
+	}
+	if serviceConfig == nil {
+		e.logger.Error("Service not found in configuration", "service", sq.ServiceName)
+		return nil, fmt.Errorf("service not found: %s", sq.ServiceName)
+	}
+	if overridden, ok := serviceWithDirectiveTimeout(execCtx, serviceConfig); ok {
+		serviceConfig = overridden
+		run.sq.Timeout = overridden.Timeout
+	}
+
+	// 开启 SkipUnhealthyServices 时不调用不健康的服务，否则仍然尝试
+	if e.federationConfig.SkipUnhealthyServices && !e.isServiceAvailable(queryCtx, serviceConfig) {
+		e.logger.Warn("Service is unhealthy", "service", sq.ServiceName)
+		run.response = &federationtypes.ServiceResponse{
+			Service: sq.ServiceName,
+			Error:   errors.NewServiceError("service is unhealthy: " + sq.ServiceName),
+			Latency: time.Since(run.startTime),
+		}
+		return run, nil
+	}
+
+	// 构建服务调用，每个子查询携带独立的子 span
+	run.sq.Headers = subQueryTraceHeaders(execCtx, run.sq.Headers)
+	run.call = &federationtypes.ServiceCall{
+		Service:   serviceConfig,
+		SubQuery:  &run.sq,
+		Context:   execCtx.QueryContext,
+		StartTime: run.startTime,
+	}
+	return run, nil
+}
+
+// callSubQuery 执行单个子查询的调用，按字段预算拆出的子查询单独限时，超时时该字段返回 null
+func (e *Engine) callSubQuery(queryCtx context.Context, execCtx *federationtypes.ExecutionContext, run *subQueryRun) {
+	callCtx := queryCtx
+	if run.sq.FieldBudget != nil {
+		var cancelBudget context.CancelFunc
+		callCtx, cancelBudget = context.WithTimeout(queryCtx, run.sq.FieldBudget.Timeout)
+		defer cancelBudget()
+	}
+
+	run.response, run.shared, run.err = e.callWithRequestCache(callCtx, run.call, execCtx)
+	if run.err != nil && run.sq.FieldBudget != nil && callCtx.Err() == context.DeadlineExceeded && queryCtx.Err() == nil {
+		e.logger.Warn("Field exceeded timeout budget", "service", run.sq.ServiceName, "field", run.sq.FieldBudget.Field, "timeout", run.sq.FieldBudget.Timeout)
+		run.response, run.err = fieldBudgetTimeoutResponse(&run.sq, time.Since(run.startTime)), nil
+	}
+}
+
+// finishSubQuery 将调用失败转换为错误响应，并记录耗时、服务健康和用量
+func (e *Engine) finishSubQuery(execCtx *federationtypes.ExecutionContext, run *subQueryRun) {
+	sq := &run.sq
+	if run.err != nil {
+		e.logger.Error("Service call failed", "service", sq.ServiceName, "error", run.err)
+		// 创建错误响应
+		run.response = &federationtypes.ServiceResponse{
+			Service: sq.ServiceName,
+			Error:   e.withSubQueryDebug(run.call, run.err),
+			Latency: time.Since(run.startTime),
+			Metadata: map[string]interface{}{
+				"error_type": "service_call_error",
+				"query":      sq.Query,
+			},
+		}
+	}
+
+	// 子图省略所请求的根字段时按配置补 null，使响应结构与请求一致
+	e.fillMissingRootFields(sq, run.response)
+
+	e.recordSubQueryTiming(execCtx, sq, run.response, run.startTime)
+	if !run.shared {
+		if !run.batched {
+			e.recordServiceResult(sq.ServiceName, run.response.Error != nil)
+		}
+		e.recordServiceUsage(execCtx, sq, run.response)
+		e.mirrorSubQuery(run.call, run.response)
+	}
+
+	e.logger.Debug("Sub-query completed",
+		"service", sq.ServiceName,
+		"latency", run.response.Latency,
+		"hasError", run.response.Error != nil,
+	)
+}
+
 // validateQueryLimits 验证查询限制
 func (e *Engine) validateQueryLimits(query *federationtypes.ParsedQuery) error {
 	// 检查查询深度
@@ -384,11 +945,45 @@ func (e *Engine) validateQueryLimits(query *federationtypes.ParsedQuery) error {
 		)
 	}
 
+	// 只读网关等场景下拒绝未开放的操作类型
+	if err := e.validateOperationType(query); err != nil {
+		return err
+	}
+
+	// 拒绝允许列表之外的指令，防止客户端调用内部指令
+	if err := parser.ValidateDirectives(query, e.allowedDirectives); err != nil {
+		return err
+	}
+
+	if err := e.validateIntrospection(query); err != nil {
+		return err
+	}
+
+	// 按组合模式验证，拒绝引用已移除字段或类型的查询
+	if err := e.validateAgainstSchema(query); err != nil {
+		return err
+	}
+
 	// 这里可以添加更多限制检查，如复杂度分析等
 
 	return nil
 }
 
+// validateAgainstSchema 按当前组合模式验证查询，组合模式为空或配置跳过时不验证
+func (e *Engine) validateAgainstSchema(query *federationtypes.ParsedQuery) error {
+	if e.federationConfig.SkipQueryValidation {
+		return nil
+	}
+
+	schema, err := e.registry.GetFederatedSchema()
+	if err != nil || strings.TrimSpace(schema.SDL) == "" {
+		e.logger.Debug("Composed schema not available, skipping query validation")
+		return nil
+	}
+
+	return e.parser.ValidateQuery(query, schema)
+}
+
 // Shutdown 关闭引擎
 func (e *Engine) Shutdown() error {
 	e.logger.Info("Shutting down federation engine")
@@ -398,23 +993,57 @@ func (e *Engine) Shutdown() error {
 
 	e.status.Status = "shutdown"
 
+	// 等待进行中的子查询完成后释放工作协程
+	if e.workerPool != nil {
+		e.workerPool.Close()
+	}
+
 	e.logger.Info("Federation engine shutdown completed")
 	return nil
 }
 
 // GetStatus 获取引擎状态
 func (e *Engine) GetStatus() federationtypes.EngineStatus {
+	return e.GetStatusFor()
+}
+
+// GetStatusFor 获取引擎状态，只包含指定服务的状态，未指定服务时包含全部服务
+func (e *Engine) GetStatusFor(services ...string) federationtypes.EngineStatus {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 
 	status := e.status
 	status.Uptime = time.Since(e.startTime)
-	status.QueryCount = e.queryCount
-	status.ErrorCount = e.errorCount
+	status.QueryCount = atomic.LoadInt64(&e.queryCount)
+	status.ErrorCount = atomic.LoadInt64(&e.errorCount)
+	status.InFlight = e.inFlightQueries.Load()
+
+	// 在读锁内复制服务状态，填入当前窗口的错误率，避免与并发的状态更新竞争
+	selected := serviceSelection(services)
+	status.Services = make(map[string]federationtypes.ServiceStatus, len(e.status.Services))
+	for name, serviceStatus := range e.status.Services {
+		if selected != nil && !selected[name] {
+			continue
+		}
+		serviceStatus.ErrorRate = e.serviceErrorRate(name)
+		status.Services[name] = serviceStatus
+	}
 
 	return status
 }
 
+// serviceSelection 返回指定服务名的集合，未指定时返回 nil 表示全部服务
+func serviceSelection(services []string) map[string]bool {
+	if len(services) == 0 {
+		return nil
+	}
+	selected := make(map[string]bool, len(services))
+	for _, name := range services {
+		selected[name] = true
+	}
+	return selected
+}
+
 // 私有辅助方法
 
 // initializeServiceStatus 初始化服务状态
@@ -422,14 +1051,198 @@ func (e *Engine) initializeServiceStatus() {
 	e.status.Services = make(map[string]federationtypes.ServiceStatus)
 
 	for _, service := range e.federationConfig.Services {
-		e.status.Services[service.Name] = federationtypes.ServiceStatus{
-			Name:         service.Name,
-			Healthy:      true, // 假设初始状态为健康
-			LastCheck:    time.Now(),
-			ResponseTime: 0,
-			ErrorRate:    0.0,
+		serviceStatus := federationtypes.ServiceStatus{
+			Name:                service.Name,
+			Healthy:             true, // 假设初始状态为健康
+			LastCheck:           time.Now(),
+			ResponseTime:        0,
+			PinnedSchemaVersion: service.PinnedSchemaVersion,
+		}
+
+		// 记录当前注册的模式版本
+		if schemaInfo, err := e.registry.GetSchema(service.Name); err == nil {
+			serviceStatus.SchemaVersion = schemaInfo.Version
 		}
+
+		e.status.Services[service.Name] = serviceStatus
+	}
+}
+
+// configureQueryCache 根据 EnableCaching 创建或关闭查询结果缓存
+func (e *Engine) configureQueryCache(config *federationtypes.FederationConfig) {
+	if !config.EnableCaching {
+		e.queryCache = nil
+		return
+	}
+	// 缓存跨配置重载保留，只有结果大小上限变化时重建
+	if e.queryCache != nil && e.queryCacheMaxValueBytes == config.MaxCacheValueBytes {
+		return
 	}
+
+	cacheConfig := cache.DefaultCacheConfig()
+	// WASM 环境中不启动后台清理协程，过期条目在读取时判定
+	cacheConfig.CleanupInterval = 0
+	cacheConfig.QueryCache.MaxValueBytes = config.MaxCacheValueBytes
+	e.queryCache = cache.NewMemoryCache(cacheConfig, e.logger)
+	e.cacheKeys = cache.NewCacheKeyGenerator()
+	e.queryCacheMaxValueBytes = cacheConfig.QueryCache.MaxValueBytes
+}
+
+// cloneResponse 浅拷贝响应，避免调用方修改 extensions 影响缓存条目
+func cloneResponse(response *federationtypes.GraphQLResponse) *federationtypes.GraphQLResponse {
+	clone := *response
+	if response.Extensions != nil {
+		clone.Extensions = make(map[string]interface{}, len(response.Extensions))
+		for key, value := range response.Extensions {
+			clone.Extensions[key] = value
+		}
+	}
+	return &clone
+}
+
+// configureCoalescing 根据配置启用或关闭并发查询合并，已启用时保留统计
+func (e *Engine) configureCoalescing(config *federationtypes.FederationConfig) {
+	if !config.CoalesceQueries {
+		e.coalescer = nil
+		return
+	}
+
+	if e.coalescer == nil {
+		e.coalescer = newCoalescer()
+	}
+}
+
+// operationParser 支持按操作名从多操作文档中选择操作的解析器
+type operationParser interface {
+	ParseOperation(query string, operationName string) (*federationtypes.ParsedQuery, error)
+}
+
+// parseQuery 解析请求中的查询，解析器支持时传入 operationName
+func (e *Engine) parseQuery(request *federationtypes.GraphQLRequest) (*federationtypes.ParsedQuery, error) {
+	if operationParser, ok := e.parser.(operationParser); ok {
+		return operationParser.ParseOperation(request.Query, request.OperationName)
+	}
+	return e.parser.ParseQuery(request.Query)
+}
+
+// configReloadHandler 需要感知配置重载的服务调用器，如清理已移除服务的健康状态
+type configReloadHandler interface {
+	OnConfigReload(oldConfig, newConfig *federationtypes.FederationConfig) error
+}
+
+// workerPoolSetter 可使用引擎协程池执行批量调用的服务调用器
+type workerPoolSetter interface {
+	SetWorkerPool(pool *utils.WorkerPool)
+}
+
+// configureWorkerPool 按配置大小创建子查询协程池，大小变化时替换旧池
+func (e *Engine) configureWorkerPool(config *federationtypes.FederationConfig) {
+	size := config.WorkerPoolSize
+	if size <= 0 {
+		size = utils.DefaultWorkerPoolSize
+	}
+
+	if e.workerPool != nil && e.workerPool.Size() == size {
+		return
+	}
+
+	previous := e.workerPool
+	e.workerPool = utils.NewWorkerPool(size)
+	if setter, ok := e.caller.(workerPoolSetter); ok {
+		setter.SetWorkerPool(e.workerPool)
+	}
+
+	// 旧池上的任务执行完后再退出，不阻塞重新初始化
+	if previous != nil {
+		go previous.Close()
+	}
+}
+
+// submitTask 将任务提交到协程池，未创建协程池时单独启动 goroutine
+func (e *Engine) submitTask(task func()) {
+	if e.workerPool == nil {
+		go task()
+		return
+	}
+	e.workerPool.Submit(task)
+}
+
+// plannerConfigFrom 根据联邦配置构建规划器配置
+func plannerConfigFrom(config *federationtypes.FederationConfig) *planner.PlannerConfig {
+	plannerConfig := planner.DefaultPlannerConfig()
+	plannerConfig.StrictFieldRouting = config.StrictFieldRouting
+	if config.VariableConflictPolicy != "" {
+		plannerConfig.VariableConflictPolicy = planner.VariableConflictPolicy(config.VariableConflictPolicy)
+	}
+	plannerConfig.Batching = planner.MergeBatchingConfig(config.Batching)
+	plannerConfig.SkipUnhealthyServices = config.SkipUnhealthyServices
+	plannerConfig.FieldTimeouts = config.FieldTimeouts
+	plannerConfig.MaxEntityFieldAliases = config.MaxEntityFieldAliases
+	plannerConfig.ElideTypenameOnlyFetches = config.ElideTypenameOnlyFetches
+	plannerConfig.UndefinedFieldPolicy = planner.UndefinedFieldPolicy(config.UndefinedFieldPolicy)
+	return plannerConfig
+}
+
+// plannerConfig 构建规划器配置，并以服务调用器的健康状态作为规划时的健康检查
+func (e *Engine) plannerConfig(config *federationtypes.FederationConfig) *planner.PlannerConfig {
+	plannerConfig := plannerConfigFrom(config)
+	plannerConfig.ServiceHealth = func(service federationtypes.ServiceConfig) bool {
+		return e.isServiceAvailable(context.Background(), &service)
+	}
+	return plannerConfig
+}
+
+// entityResolverConfigFrom 根据联邦配置构建实体解析器配置
+func entityResolverConfigFrom(config *federationtypes.FederationConfig) *EntityResolverConfig {
+	resolverConfig := DefaultEntityResolverConfig()
+	if config.MaxEntitiesPerRequest > 0 {
+		resolverConfig.MaxEntitiesPerRequest = config.MaxEntitiesPerRequest
+	}
+	return resolverConfig
+}
+
+// federatedPlannerConfigFrom 根据联邦配置构建联邦规划器配置
+func federatedPlannerConfigFrom(config *federationtypes.FederationConfig) *FederatedPlannerConfig {
+	plannerConfig := &FederatedPlannerConfig{}
+	for _, service := range config.Services {
+		if service.ResolutionPriority != 0 {
+			if plannerConfig.ResolutionPriorities == nil {
+				plannerConfig.ResolutionPriorities = make(map[string]int)
+			}
+			plannerConfig.ResolutionPriorities[service.Name] = service.ResolutionPriority
+		}
+	}
+	return plannerConfig
+}
+
+// parserConfigFrom 根据联邦配置构建解析器配置
+func parserConfigFrom(config *federationtypes.FederationConfig) *parser.ParserConfig {
+	parserConfig := parser.DefaultParserConfig()
+	parserConfig.Lenient = config.LenientParsing
+	parserConfig.MaxSelectionBreadth = config.MaxSelectionBreadth
+	// 指令由允许列表校验，组合模式不包含执行期指令定义
+	parserConfig.IgnoreUndefinedDirectives = true
+	return parserConfig
+}
+
+// mergerConfigFrom 根据联邦配置构建合并器配置
+func mergerConfigFrom(config *federationtypes.FederationConfig) *merger.MergerConfig {
+	mergerConfig := merger.DefaultMergerConfig()
+	mergerConfig.ErrorCodeMapping = config.ErrorCodeMapping
+	if config.UnknownFieldPolicy != "" {
+		mergerConfig.UnknownFieldPolicy = merger.UnknownFieldPolicy(config.UnknownFieldPolicy)
+	}
+	mergerConfig.StrictFieldTypes = config.StrictFieldTypes
+	if config.ListMergePolicy != "" {
+		mergerConfig.ListMergePolicy = merger.ListMergePolicy(config.ListMergePolicy)
+	}
+	for path, policy := range config.ListMergePaths {
+		mergerConfig.ListMergePaths[path] = merger.ListMergePolicy(policy)
+	}
+	if len(config.ListMergeKeys) > 0 {
+		mergerConfig.ListMergeKeys = config.ListMergeKeys
+	}
+	return mergerConfig
 }
 
 // serializeConfig 序列化配置
@@ -447,26 +1260,104 @@ func (e *Engine) incrementErrorCount() {
 	atomic.AddInt64(&e.errorCount, 1)
 }
 
-// IsHealthy 检查引擎健康状态
+// IsHealthy 检查引擎健康状态，配置了 ReadinessQuorum 或关键服务时还需满足就绪条件
 func (e *Engine) IsHealthy() bool {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
-	return e.status.Status == "running"
+	return e.status.Status == "running" && e.readinessLocked(context.Background()).Ready
+}
+
+// DefaultMetricsMaxServices 指标端点默认按服务输出的条目上限
+const DefaultMetricsMaxServices = 100
+
+// MetricsFilter 限定按服务输出的指标
+type MetricsFilter struct {
+	Services    []string // 只输出这些服务，为空时输出全部服务
+	MaxServices int      // 按服务名排序后最多输出的服务数，0 表示不限制
 }
 
 // GetMetrics 获取引擎指标
 func (e *Engine) GetMetrics() map[string]interface{} {
+	return e.GetMetricsFor(MetricsFilter{})
+}
+
+// GetMetricsFor 获取引擎指标，按服务统计的部分只包含过滤后的服务。
+// 截断时 services_truncated 记录被省略的服务数
+func (e *Engine) GetMetricsFor(filter MetricsFilter) map[string]interface{} {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 
-	return map[string]interface{}{
+	// 计数器在锁外以原子操作累加
+	queryCount, errorCount := atomic.LoadInt64(&e.queryCount), atomic.LoadInt64(&e.errorCount)
+	metrics := map[string]interface{}{
 		"uptime":        time.Since(e.startTime),
-		"query_count":   e.queryCount,
-		"error_count":   e.errorCount,
-		"error_rate":    float64(e.errorCount) / float64(max(e.queryCount, 1)),
+		"query_count":   queryCount,
+		"error_count":   errorCount,
+		"error_rate":    float64(errorCount) / float64(max(queryCount, 1)),
 		"service_count": len(e.federationConfig.Services),
 		"status":        e.status.Status,
+		"in_flight":     e.inFlightQueries.Load(),
+	}
+
+	names, truncated := e.metricsServices(filter)
+	if truncated > 0 {
+		metrics["services_truncated"] = truncated
+	}
+
+	serviceErrorRates := make(map[string]float64, len(names))
+	for _, name := range names {
+		serviceErrorRates[name] = e.serviceErrorRate(name)
+	}
+	metrics["service_error_rates"] = serviceErrorRates
+	metrics["service_usage"] = e.serviceUsageMetrics(names)
+	metrics["response_size"] = e.GetResponseSizeStats()
+	if e.federationConfig.TraceSampling != nil {
+		metrics["trace_sampling"] = e.GetTraceSamplingStats()
+	}
+	if shadow := e.shadowMetrics(names); len(shadow) > 0 {
+		metrics["shadow_traffic"] = shadow
+	}
+
+	if e.parseCache != nil {
+		metrics["parse_cache"] = e.parseCache.stats()
+	}
+
+	if e.queryCache != nil {
+		metrics["query_cache"] = e.queryCache.Stats()
+	}
+
+	if shedder := e.loadShedder.Load(); shedder != nil {
+		metrics["load_shedding"] = shedder.stats()
+	}
+
+	if e.coalescer != nil {
+		stats := e.coalescer.stats()
+		metrics["coalesced_requests"] = stats.CoalescedRequests
+		metrics["stampedes_prevented"] = stats.StampedesPrevented
+		metrics["coalescing_bytes_saved"] = stats.BytesSaved
+		metrics["max_concurrent_joiners"] = stats.MaxConcurrentJoiners
+	}
+
+	metrics["request_cache_hits"] = e.requestCacheHits.Load()
+
+	return metrics
+}
+
+// metricsServices 返回按服务输出指标的服务名（按名称排序）及因上限被省略的服务数，调用方需持有读锁
+func (e *Engine) metricsServices(filter MetricsFilter) ([]string, int) {
+	selected := serviceSelection(filter.Services)
+	names := make([]string, 0, len(e.federationConfig.Services))
+	for _, service := range e.federationConfig.Services {
+		if selected == nil || selected[service.Name] {
+			names = append(names, service.Name)
+		}
 	}
+	sort.Strings(names)
+
+	if filter.MaxServices > 0 && len(names) > filter.MaxServices {
+		return names[:filter.MaxServices], len(names) - filter.MaxServices
+	}
+	return names, 0
 }
 
 // max 返回两个整数中的较大值
@@ -538,7 +1429,7 @@ func (e *Engine) ExecuteFederationQuery(ctx *federationtypes.ExecutionContext, r
 	e.logger.Info("Executing Federation query", "entityCount", len(entities))
 
 	// 解析查询
-	parsedQuery, err := e.parser.ParseQuery(request.Query)
+	parsedQuery, err := e.parseQuery(request)
 	if err != nil {
 		e.incrementErrorCount()
 		return nil, fmt.Errorf("query parsing failed: %w", err)
@@ -618,21 +1509,66 @@ func (e *Engine) mergeFederationResponses(responses []*federationtypes.ServiceRe
 		return &federationtypes.GraphQLResponse{Data: map[string]interface{}{}}, nil
 	}
 
-	// 简化实现：返回第一个响应
+	// 简化实现：返回第一个响应的数据
 	// 在实际实现中，应该根据 Federation 规则合并实体数据
 	firstResponse := responses[0]
+
+	// 保留所有子图错误及其 extensions
+	var graphqlErrors []federationtypes.GraphQLError
+	for _, response := range responses {
+		if response != nil {
+			graphqlErrors = append(graphqlErrors, merger.MapErrorCodes(merger.AnnotateServiceErrors(response), e.federationConfig.ErrorCodeMapping)...)
+		}
+	}
+
 	return &federationtypes.GraphQLResponse{
 		Data:   firstResponse.Data,
-		Errors: firstResponse.Errors,
+		Errors: graphqlErrors,
 	}, nil
 }
 
-// ResolveEntityReferences 解析实体引用
-func (e *Engine) ResolveEntityReferences(ctx context.Context, serviceName string, representations []federationtypes.RepresentationRequest) ([]interface{}, error) {
+// ResolveEntityReferences 解析实体引用，返回的子图错误已按 ErrorCodeMapping 改写错误码，路径为表示的 Path。
+// serviceName 为空时按各表示的具体 __typename 分发到拥有该实体的服务，没有拥有者的表示结果为 nil
+func (e *Engine) ResolveEntityReferences(ctx context.Context, serviceName string, representations []federationtypes.RepresentationRequest) ([]interface{}, []federationtypes.GraphQLError, error) {
 	e.logger.Debug("Resolving entity references", "service", serviceName, "count", len(representations))
 
-	// 使用实体解析器批量解析
-	return e.entityResolver.ResolveBatchEntities(ctx, serviceName, representations)
+	var results []interface{}
+	var graphqlErrors []federationtypes.GraphQLError
+	var err error
+	if serviceName == "" {
+		entities, entitiesErr := e.configuredEntities()
+		if entitiesErr != nil {
+			return nil, nil, entitiesErr
+		}
+		results, graphqlErrors, err = e.entityResolver.ResolveEntitiesByType(ctx, representations, EntityOwners(entities))
+	} else {
+		// 使用实体解析器批量解析
+		results, graphqlErrors, err = e.entityResolver.ResolveBatchEntities(ctx, serviceName, representations)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, merger.MapErrorCodes(graphqlErrors, e.federationConfig.ErrorCodeMapping), nil
+}
+
+// configuredEntities 提取所有已配置服务模式中的联邦实体，并标记所属服务
+func (e *Engine) configuredEntities() ([]federationtypes.FederatedEntity, error) {
+	var entities []federationtypes.FederatedEntity
+	for _, service := range e.federationConfig.Services {
+		if strings.TrimSpace(service.Schema) == "" {
+			continue
+		}
+
+		serviceEntities, err := e.extractFederationEntities(service.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract entities of service %s: %w", service.Name, err)
+		}
+		for _, entity := range serviceEntities {
+			entity.ServiceName = service.Name
+			entities = append(entities, entity)
+		}
+	}
+	return entities, nil
 }
 
 // BuildRepresentationQuery 构建实体表示查询
@@ -667,3 +1603,54 @@ func (e *Engine) ValidateEntityKey(entity *federationtypes.FederatedEntity, keyF
 
 	return nil
 }
+
+// SetVariableTransformer 设置自定义变量转换器，为 nil 时恢复按配置生成的默认转换器
+func (e *Engine) SetVariableTransformer(transformer federationtypes.VariableTransformer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.variableTransformer = transformer
+}
+
+// configureVariableTransformer 按配置和当前子图模式重建默认变量转换器
+func (e *Engine) configureVariableTransformer(config *federationtypes.FederationConfig) {
+	if config.VariableCoercion == nil {
+		e.defaultVariableTransformer = nil
+		return
+	}
+
+	schemas := make([]string, 0, len(config.Services))
+	for _, service := range config.Services {
+		schemas = append(schemas, service.Schema)
+	}
+	e.defaultVariableTransformer = NewTypeCoercionTransformer(config.VariableCoercion, schemas, e.logger)
+}
+
+// transformVariables 执行变量转换，返回携带转换后变量的请求副本
+func (e *Engine) transformVariables(ctx *federationtypes.ExecutionContext, request *federationtypes.GraphQLRequest, query *federationtypes.ParsedQuery) (*federationtypes.GraphQLRequest, error) {
+	e.mutex.RLock()
+	transformer := e.variableTransformer
+	if transformer == nil {
+		transformer = e.defaultVariableTransformer
+	}
+	e.mutex.RUnlock()
+
+	// 客户端省略的变量使用操作中声明的默认值，显式传入的 null 保持不变
+	variables := applyVariableDefaults(query, request.Variables)
+	if transformer != nil {
+		transformed, err := transformer.Transform(query, variables)
+		if err != nil {
+			return nil, errors.NewQueryValidationError("invalid variables: "+err.Error(), errors.WithCause(err))
+		}
+		variables = transformed
+	}
+
+	query.Variables = variables
+	if ctx.QueryContext != nil {
+		ctx.QueryContext.Variables = variables
+	}
+
+	normalized := *request
+	normalized.Variables = variables
+	return &normalized, nil
+}
@@ -0,0 +1,412 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	"envoy-wasm-graphql-federation/pkg/merger"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// representationsVariable 实体查询中表示列表的变量名
+const representationsVariable = "representations"
+
+// entityTarget 响应数据中等待实体字段的父级对象
+type entityTarget struct {
+	object map[string]interface{}
+	path   []interface{} // 在联邦响应中的路径，含列表下标
+}
+
+// executeEntityFetches 按依赖层级执行实体查询，结果合并回响应数据中对应的父级对象。
+// 后续层级可依赖前面查询合并进来的数据，同一层级内按服务的解析优先级排列；单个实体查询失败只记录错误
+func (e *Engine) executeEntityFetches(ctx context.Context, fetches []federationtypes.EntityFetch, response *federationtypes.GraphQLResponse, execCtx *federationtypes.ExecutionContext) {
+	data, ok := response.Data.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, index := range e.entityFetchOrder(fetches) {
+		fetch := fetches[index]
+		targets := collectEntityTargets(data, fetch.Path, nil)
+		if len(targets) == 0 {
+			continue
+		}
+		// 软超时已过时不再发起实体查询
+		if softDeadlinePassed(execCtx) {
+			response.Errors = append(response.Errors, e.softTimeoutEntityError(fetch, targets[0].path))
+			continue
+		}
+
+		response.Errors = append(response.Errors, e.executeEntityFetch(ctx, fetch, targets, execCtx)...)
+	}
+}
+
+// entityBatch 一次 _entities 调用携带的表示及其对应的父级对象
+type entityBatch struct {
+	representations []interface{}
+	entityPaths     [][]interface{}
+	groups          [][]entityTarget
+}
+
+// executeEntityFetch 执行单个实体查询，相同表示只请求一次。每个对象按其实际返回的 @key 构造表示，
+// 使用不同 @key 的表示分开批量调用，超过批次上限时再拆分为多次调用
+func (e *Engine) executeEntityFetch(ctx context.Context, fetch federationtypes.EntityFetch, targets []entityTarget, execCtx *federationtypes.ExecutionContext) []federationtypes.GraphQLError {
+	var byKey []entityBatch
+	keyIndex := make(map[int]int)
+	groupIndex := make(map[string]int)
+	idCoercion := e.entityIDCoercion(fetch)
+
+	for _, target := range targets {
+		representation, keySet, ok := buildRepresentation(target.object, fetch, idCoercion)
+		if !ok {
+			continue
+		}
+
+		k, exists := keyIndex[keySet]
+		if !exists {
+			k = len(byKey)
+			keyIndex[keySet] = k
+			byKey = append(byKey, entityBatch{})
+		}
+		all := &byKey[k]
+
+		// fmt 按键排序输出 map，可作为去重键；表示包含键字段名，相同表示必然使用相同的 @key
+		key := fmt.Sprintf("%#v", representation)
+		index, exists := groupIndex[key]
+		if !exists {
+			index = len(all.representations)
+			groupIndex[key] = index
+			all.representations = append(all.representations, representation)
+			all.entityPaths = append(all.entityPaths, target.path)
+			all.groups = append(all.groups, nil)
+		}
+		all.groups[index] = append(all.groups[index], target)
+	}
+
+	if len(byKey) == 0 {
+		return nil
+	}
+
+	var serviceConfig *federationtypes.ServiceConfig
+	for i := range e.federationConfig.Services {
+		if e.federationConfig.Services[i].Name == fetch.ServiceName {
+			serviceConfig = &e.federationConfig.Services[i]
+			break
+		}
+	}
+	if serviceConfig == nil {
+		return []federationtypes.GraphQLError{entityFetchError(fetch, byKey[0].entityPaths[0], fmt.Errorf("service not found: %s", fetch.ServiceName))}
+	}
+	if overridden, ok := serviceWithDirectiveTimeout(execCtx, serviceConfig); ok {
+		serviceConfig = overridden
+		fetch.Timeout = overridden.Timeout
+	}
+
+	var batches []entityBatch
+	representations := 0
+	for _, all := range byKey {
+		keyBatches, err := e.splitEntityBatch(all)
+		if err != nil {
+			e.logger.Warn("Entity representations exceed batch limits", "service", fetch.ServiceName, "type", fetch.TypeName, "error", err)
+			return []federationtypes.GraphQLError{entityFetchError(fetch, all.entityPaths[0], err)}
+		}
+		batches = append(batches, keyBatches...)
+		representations += len(all.representations)
+	}
+
+	e.logger.Debug("Executing entity fetch",
+		"requestId", execCtx.RequestID,
+		"service", fetch.ServiceName,
+		"type", fetch.TypeName,
+		"representations", representations,
+		"keys", len(byKey),
+		"batches", len(batches),
+	)
+
+	// 所有批次共享实体查询的超时并发执行，启用软超时时调用在软超时到达时取消
+	fetchCtx, cancel := context.WithTimeout(ctx, execCtx.Config.QueryTimeout)
+	defer cancel()
+	if !execCtx.SoftDeadline.IsZero() {
+		var cancelSoft context.CancelFunc
+		fetchCtx, cancelSoft = context.WithDeadline(fetchCtx, execCtx.SoftDeadline)
+		defer cancelSoft()
+	}
+
+	if len(batches) == 1 {
+		return e.fetchEntityBatch(fetchCtx, fetch, serviceConfig, batches[0], execCtx, nil)
+	}
+
+	var wg sync.WaitGroup
+	var mergeMutex sync.Mutex
+	batchErrors := make([][]federationtypes.GraphQLError, len(batches))
+	for i := range batches {
+		wg.Add(1)
+		e.submitTask(func() {
+			defer wg.Done()
+			batchErrors[i] = e.fetchEntityBatch(fetchCtx, fetch, serviceConfig, batches[i], execCtx, &mergeMutex)
+		})
+	}
+	wg.Wait()
+
+	var graphqlErrors []federationtypes.GraphQLError
+	for _, errs := range batchErrors {
+		graphqlErrors = append(graphqlErrors, errs...)
+	}
+	return graphqlErrors
+}
+
+// splitEntityBatch 按 EntityBatch 的数量和序列化大小上限拆分表示列表，
+// 关闭拆分时超出上限返回错误。单个表示始终自成一批
+func (e *Engine) splitEntityBatch(all entityBatch) ([]entityBatch, error) {
+	maxCount, maxBytes, chunking := entityBatchLimits(e.federationConfig.EntityBatch)
+
+	indexes := make([]int, len(all.representations))
+	sizes := make([]int64, len(all.representations))
+	var totalBytes int64
+	for i, representation := range all.representations {
+		body, err := jsonutil.Marshal(representation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize representation: %w", err)
+		}
+		indexes[i] = i
+		sizes[i] = int64(len(body)) + 1 // 列表中的逗号或括号
+		totalBytes += sizes[i]
+	}
+
+	chunks := splitIntoChunks(indexes, maxCount, maxBytes, func(i int) int64 { return sizes[i] })
+	if len(chunks) > 1 && !chunking {
+		return nil, fmt.Errorf("%d representations (%d bytes) exceed the entity batch limit of %d representations or %d bytes and chunking is disabled",
+			len(all.representations), totalBytes, maxCount, maxBytes)
+	}
+
+	batches := make([]entityBatch, 0, len(chunks))
+	for _, chunk := range chunks {
+		var batch entityBatch
+		for _, i := range chunk {
+			batch.representations = append(batch.representations, all.representations[i])
+			batch.entityPaths = append(batch.entityPaths, all.entityPaths[i])
+			batch.groups = append(batch.groups, all.groups[i])
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// entityBatchLimits 返回单次 _entities 调用的表示数量和字节上限，未配置时使用默认值
+func entityBatchLimits(config *federationtypes.EntityBatchConfig) (int, int64, bool) {
+	maxCount, maxBytes, chunking := federationtypes.DefaultMaxRepresentations, int64(federationtypes.DefaultMaxRepresentationBytes), true
+	if config == nil {
+		return maxCount, maxBytes, chunking
+	}
+	if config.MaxRepresentations > 0 {
+		maxCount = config.MaxRepresentations
+	}
+	if config.MaxRepresentationBytes > 0 {
+		maxBytes = config.MaxRepresentationBytes
+	}
+	return maxCount, maxBytes, !config.DisableChunking
+}
+
+// fetchEntityBatch 以一次 _entities 调用获取一批实体并合并到父级对象。
+// 多个批次并发执行时 mergeMutex 串行化合并，父级对象可能共享嵌套数据
+func (e *Engine) fetchEntityBatch(ctx context.Context, fetch federationtypes.EntityFetch, serviceConfig *federationtypes.ServiceConfig, batch entityBatch, execCtx *federationtypes.ExecutionContext, mergeMutex *sync.Mutex) []federationtypes.GraphQLError {
+	representations, entityPaths, groups := batch.representations, batch.entityPaths, batch.groups
+
+	startTime := time.Now()
+	subQuery := &federationtypes.SubQuery{
+		ServiceName: fetch.ServiceName,
+		Query:       fetch.Query,
+		Variables:   entityFetchVariables(fetch, execCtx, representations),
+		Path:        fetch.Path,
+		Timeout:     fetch.Timeout,
+		Headers:     subQueryTraceHeaders(execCtx, nil),
+	}
+	// 不同路径引用的相同实体在请求内只请求一次
+	serviceResponse, shared, err := e.callWithRequestCache(ctx, &federationtypes.ServiceCall{
+		Service:   serviceConfig,
+		SubQuery:  subQuery,
+		Context:   execCtx.QueryContext,
+		StartTime: startTime,
+	}, execCtx)
+	if err == nil && serviceResponse.Error != nil {
+		err = serviceResponse.Error
+	}
+	if !shared {
+		e.recordServiceResult(fetch.ServiceName, err != nil)
+		e.recordServiceUsage(execCtx, subQuery, serviceResponse)
+	}
+	if err != nil {
+		if softDeadlinePassed(execCtx) {
+			e.logger.Warn("Entity fetch cancelled by soft timeout", "service", fetch.ServiceName, "type", fetch.TypeName)
+			return []federationtypes.GraphQLError{e.softTimeoutEntityError(fetch, entityPaths[0])}
+		}
+		e.logger.Error("Entity fetch failed", "service", fetch.ServiceName, "type", fetch.TypeName, "error", err)
+		return []federationtypes.GraphQLError{entityFetchError(fetch, entityPaths[0], err)}
+	}
+
+	if !shared {
+		e.recordUpstreamHeaders(execCtx, serviceResponse)
+	}
+
+	if err := e.trackResponseBytes(execCtx, serviceResponse); err != nil {
+		e.logger.Warn("Upstream response size limit exceeded", "requestId", execCtx.RequestID, "service", fetch.ServiceName)
+		return []federationtypes.GraphQLError{entityFetchError(fetch, entityPaths[0], err)}
+	}
+
+	// 子图错误路径重定位到实体所在的联邦路径
+	serviceResponse.EntityPaths = entityPaths
+	graphqlErrors := merger.MapErrorCodes(merger.AnnotateServiceErrors(serviceResponse), e.federationConfig.ErrorCodeMapping)
+
+	responseData, _ := serviceResponse.Data.(map[string]interface{})
+	entities, _ := responseData["_entities"].([]interface{})
+
+	// 实体按表示的顺序逐项对应，数量不一致时无法确定归属，不合并任何结果
+	if responseData != nil && len(entities) != len(representations) {
+		e.logger.Error("Entity fetch returned mismatched entities",
+			"service", fetch.ServiceName,
+			"type", fetch.TypeName,
+			"representations", len(representations),
+			"entities", len(entities),
+		)
+		mismatch := fmt.Errorf("expected %d entities, got %d", len(representations), len(entities))
+		return append(graphqlErrors, entityFetchError(fetch, entityPaths[0], mismatch))
+	}
+
+	if mergeMutex != nil {
+		mergeMutex.Lock()
+		defer mergeMutex.Unlock()
+	}
+	for i, entity := range entities {
+		fields, ok := entity.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, target := range groups[i] {
+			mergeEntityFields(target.object, fields)
+		}
+	}
+
+	e.logger.Debug("Entity fetch completed",
+		"service", fetch.ServiceName,
+		"type", fetch.TypeName,
+		"entities", len(entities),
+		"latency", time.Since(startTime),
+	)
+
+	return graphqlErrors
+}
+
+// collectEntityTargets 沿路径收集父级对象，途经的列表逐项展开
+func collectEntityTargets(value interface{}, path []string, current []interface{}) []entityTarget {
+	switch v := value.(type) {
+	case []interface{}:
+		var targets []entityTarget
+		for i, item := range v {
+			targets = append(targets, collectEntityTargets(item, path, appendPath(current, i))...)
+		}
+		return targets
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return []entityTarget{{object: v, path: current}}
+		}
+		child, ok := v[path[0]]
+		if !ok || child == nil {
+			return nil
+		}
+		return collectEntityTargets(child, path[1:], appendPath(current, path[0]))
+	}
+	return nil
+}
+
+// appendPath 复制并追加路径段，避免兄弟节点共享底层数组
+func appendPath(path []interface{}, segment interface{}) []interface{} {
+	result := make([]interface{}, len(path), len(path)+1)
+	copy(result, path)
+	return append(result, segment)
+}
+
+// buildRepresentation 由对象的 __typename、键字段和 @requires 字段构造实体表示，ID 类型的键字段按目标服务的约定转换。
+// 按顺序选用对象包含全部字段的第一个 @key，返回表示和所选 @key 的下标；没有可用的 @key 时返回 false
+func buildRepresentation(object map[string]interface{}, fetch federationtypes.EntityFetch, idCoercion idKeyCoercion) (map[string]interface{}, int, bool) {
+	typeName, _ := object[typenameField].(string)
+	if typeName == "" {
+		typeName = fetch.TypeName
+	}
+
+	for index, keyFields := range fetch.KeySets() {
+		representation := map[string]interface{}{typenameField: typeName}
+		complete := true
+		for _, keyField := range keyFields {
+			value, ok := object[keyField]
+			if !ok || value == nil {
+				complete = false
+				break
+			}
+			representation[keyField] = idCoercion.apply(keyField, value)
+		}
+		if complete {
+			// 必需字段由之前的实体查询合并进父级对象，缺失时不放入表示，由子图报告错误
+			for _, field := range fetch.RequiredFields {
+				if value, ok := object[field]; ok {
+					representation[field] = value
+				}
+			}
+			return representation, index, true
+		}
+	}
+
+	return nil, -1, false
+}
+
+// entityFetchVariables 组装实体查询变量：计划中的变量、查询引用的请求变量和表示列表
+func entityFetchVariables(fetch federationtypes.EntityFetch, execCtx *federationtypes.ExecutionContext, representations []interface{}) map[string]interface{} {
+	variables := make(map[string]interface{}, len(fetch.Variables)+1)
+	for name, value := range fetch.Variables {
+		variables[name] = value
+	}
+
+	if execCtx.QueryContext != nil {
+		for name, value := range execCtx.QueryContext.Variables {
+			if _, exists := variables[name]; !exists && strings.Contains(fetch.Query, "$"+name+":") {
+				variables[name] = value
+			}
+		}
+	}
+
+	variables[representationsVariable] = representations
+	return variables
+}
+
+// mergeEntityFields 将实体字段深度合并到父级对象
+func mergeEntityFields(target, fields map[string]interface{}) {
+	for key, value := range fields {
+		existing, exists := target[key].(map[string]interface{})
+		incoming, isObject := value.(map[string]interface{})
+		if exists && isObject {
+			mergeEntityFields(existing, incoming)
+			continue
+		}
+		target[key] = value
+	}
+}
+
+// entityFetchError 构建实体查询失败的 GraphQL 错误
+func entityFetchError(fetch federationtypes.EntityFetch, path []interface{}, cause error) federationtypes.GraphQLError {
+	fetchErr := errors.NewEntityResolutionError(
+		fmt.Sprintf("failed to resolve %s fields from service %s: %v", fetch.TypeName, fetch.ServiceName, cause),
+		errors.WithService(fetch.ServiceName),
+		errors.WithPath(path...),
+		errors.WithCause(cause),
+	)
+
+	return federationtypes.GraphQLError{
+		Message:    fetchErr.Message,
+		Path:       path,
+		Extensions: fetchErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+	}
+}
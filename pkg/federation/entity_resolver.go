@@ -3,12 +3,15 @@ package federation
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/tidwall/gjson"
 
 	"envoy-wasm-graphql-federation/pkg/errors"
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	"envoy-wasm-graphql-federation/pkg/merger"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
 
@@ -16,13 +19,38 @@ import (
 type EntityResolverImpl struct {
 	logger        federationtypes.Logger
 	serviceCaller federationtypes.ServiceCaller
+	config        *EntityResolverConfig
+}
+
+// EntityResolverConfig 实体解析器配置
+type EntityResolverConfig struct {
+	MaxEntitiesPerRequest int // 单次 _entities 调用的最大表示数
+	MaxConcurrentBatches  int // 分片调用的最大并发数
+}
+
+// DefaultEntityResolverConfig 返回默认实体解析器配置
+func DefaultEntityResolverConfig() *EntityResolverConfig {
+	return &EntityResolverConfig{
+		MaxEntitiesPerRequest: 100,
+		MaxConcurrentBatches:  4,
+	}
 }
 
 // NewEntityResolver 创建新的实体解析器
 func NewEntityResolver(logger federationtypes.Logger, caller federationtypes.ServiceCaller) federationtypes.EntityResolver {
+	return NewEntityResolverWithConfig(nil, logger, caller)
+}
+
+// NewEntityResolverWithConfig 使用指定配置创建实体解析器
+func NewEntityResolverWithConfig(config *EntityResolverConfig, logger federationtypes.Logger, caller federationtypes.ServiceCaller) federationtypes.EntityResolver {
+	if config == nil {
+		config = DefaultEntityResolverConfig()
+	}
+
 	return &EntityResolverImpl{
 		logger:        logger,
 		serviceCaller: caller,
+		config:        config,
 	}
 }
 
@@ -82,70 +110,285 @@ func (r *EntityResolverImpl) ResolveEntity(ctx context.Context, serviceName stri
 }
 
 // ResolveBatchEntities 批量解析实体
-func (r *EntityResolverImpl) ResolveBatchEntities(ctx context.Context, serviceName string, representations []federationtypes.RepresentationRequest) ([]interface{}, error) {
+// 结果与输入表示一一对应；超过单次上限的批次会被拆分，失败分片对应位置为 nil。
+// 子图返回的 _entities 错误路径重定位到表示的 Path，失败分片中的每个表示各产生一条错误
+func (r *EntityResolverImpl) ResolveBatchEntities(ctx context.Context, serviceName string, representations []federationtypes.RepresentationRequest) ([]interface{}, []federationtypes.GraphQLError, error) {
 	if serviceName == "" {
-		return nil, errors.NewResolutionError("service name cannot be empty")
+		return nil, nil, errors.NewResolutionError("service name cannot be empty")
 	}
 
 	if len(representations) == 0 {
-		return []interface{}{}, nil
+		return []interface{}{}, nil, nil
 	}
 
 	r.logger.Debug("Resolving batch entities", "service", serviceName, "count", len(representations))
 
-	// 按类型分组表示
-	typeGroups := r.groupRepresentationsByType(representations)
-	var allResults []interface{}
+	// 按类型和所用的 @key 分组并拆分为受限大小的分片
+	var chunks []entityChunk
+	for _, group := range r.groupRepresentationIndexesByType(representations) {
+		for _, indexes := range splitIntoChunks(group.indexes, r.config.MaxEntitiesPerRequest, 0, nil) {
+			chunks = append(chunks, entityChunk{typeName: group.typeName, keyFields: group.keyFields, indexes: indexes})
+		}
+	}
+
+	results := make([]interface{}, len(representations))
+	chunkErrors := make([]error, len(chunks))
+	chunkGraphQLErrors := make([][]federationtypes.GraphQLError, len(chunks))
 
-	for typeName, typeRepresentations := range typeGroups {
-		// 构建批量查询
-		query, err := r.buildBatchEntityQuery(typeName, typeRepresentations)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build batch query for type %s: %w", typeName, err)
+	concurrency := r.config.MaxConcurrentBatches
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			chunkErrors[i] = ctx.Err()
+			continue
 		}
 
-		// 准备变量
-		variables := map[string]interface{}{
-			"representations": r.extractRepresentationData(typeRepresentations),
+		wg.Add(1)
+		go func(i int, chunk entityChunk) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			entities, graphqlErrors, err := r.resolveEntityChunk(ctx, serviceName, chunk, representations)
+			chunkGraphQLErrors[i] = graphqlErrors
+			if err != nil {
+				chunkErrors[i] = err
+				return
+			}
+
+			// 分片内各自写入原始位置，互不重叠
+			for position, index := range chunk.indexes {
+				if position < len(entities) {
+					results[index] = entities[position]
+				}
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	var firstErr error
+	var graphqlErrors []federationtypes.GraphQLError
+	failed := 0
+	for i, err := range chunkErrors {
+		graphqlErrors = append(graphqlErrors, chunkGraphQLErrors[i]...)
+		if err == nil {
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = err
 		}
+		r.logger.Warn("Entity batch chunk failed", "service", serviceName, "typename", chunks[i].typeName, "count", len(chunks[i].indexes), "error", err)
+		for _, index := range chunks[i].indexes {
+			graphqlErrors = append(graphqlErrors, entityResolutionError(serviceName, representations[index], err))
+		}
+	}
+
+	if failed == len(chunks) {
+		return nil, nil, firstErr
+	}
+
+	r.logger.Debug("Batch entities resolved successfully", "service", serviceName, "totalCount", len(results), "chunks", len(chunks), "failedChunks", failed)
+	return results, graphqlErrors, nil
+}
+
+// ResolveEntitiesByType 按具体 __typename 将表示分发到所属服务解析
+// owners 将类型名映射到服务名；结果与输入表示一一对应，无法解析的位置为 nil 并产生一条错误
+func (r *EntityResolverImpl) ResolveEntitiesByType(ctx context.Context, representations []federationtypes.RepresentationRequest, owners map[string]string) ([]interface{}, []federationtypes.GraphQLError, error) {
+	if len(representations) == 0 {
+		return []interface{}{}, nil, nil
+	}
 
-		// 创建服务调用
-		serviceCall := &federationtypes.ServiceCall{
-			Service: &federationtypes.ServiceConfig{
-				Name: serviceName,
-			},
-			SubQuery: &federationtypes.SubQuery{
-				ServiceName: serviceName,
-				Query:       query,
-				Variables:   variables,
-			},
-			Context: &federationtypes.QueryContext{
-				RequestID: "batch-entity-resolution",
-			},
+	// 按所属服务分组，保持服务首次出现的顺序
+	var serviceOrder []string
+	serviceIndexes := make(map[string][]int)
+	var graphqlErrors []federationtypes.GraphQLError
+	unrouted := 0
+
+	for i, repr := range representations {
+		serviceName, ok := owners[repr.TypeName]
+		if !ok || serviceName == "" {
+			unrouted++
+			r.logger.Warn("No service owns entity type", "typename", repr.TypeName)
+			graphqlErrors = append(graphqlErrors, entityResolutionError("", repr, fmt.Errorf("no service owns entity type %s", repr.TypeName)))
+			continue
 		}
+		if _, exists := serviceIndexes[serviceName]; !exists {
+			serviceOrder = append(serviceOrder, serviceName)
+		}
+		serviceIndexes[serviceName] = append(serviceIndexes[serviceName], i)
+	}
+
+	if unrouted == len(representations) {
+		return nil, nil, errors.NewResolutionError("no service owns the requested entity types")
+	}
 
-		// 调用服务
-		response, err := r.serviceCaller.Call(ctx, serviceCall)
+	results := make([]interface{}, len(representations))
+	var firstErr error
+	failed := 0
+
+	for _, serviceName := range serviceOrder {
+		indexes := serviceIndexes[serviceName]
+		serviceRepresentations := make([]federationtypes.RepresentationRequest, len(indexes))
+		for position, index := range indexes {
+			serviceRepresentations[position] = representations[index]
+		}
+
+		entities, serviceErrors, err := r.ResolveBatchEntities(ctx, serviceName, serviceRepresentations)
 		if err != nil {
-			return nil, fmt.Errorf("batch service call failed: %w", err)
+			// 单个服务失败不影响其他服务
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			r.logger.Warn("Entity resolution failed for service", "service", serviceName, "count", len(indexes), "error", err)
+			for _, representation := range serviceRepresentations {
+				graphqlErrors = append(graphqlErrors, entityResolutionError(serviceName, representation, err))
+			}
+			continue
 		}
+		graphqlErrors = append(graphqlErrors, serviceErrors...)
 
-		// 处理响应
-		if response.Error != nil {
-			return nil, fmt.Errorf("service returned error: %w", response.Error)
+		for position, index := range indexes {
+			if position < len(entities) {
+				results[index] = entities[position]
+			}
 		}
+	}
 
-		// 提取实体数据
-		entities, err := r.extractEntitiesFromResponse(response, typeName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to extract entities data: %w", err)
+	if failed == len(serviceOrder) {
+		return nil, nil, firstErr
+	}
+
+	return results, graphqlErrors, nil
+}
+
+// EntityOwners 根据实体定义构建类型名到服务名的映射
+// 具体对象类型优先；接口实体的类型名也会映射到声明它的服务，用于接口对象形式的表示
+func EntityOwners(entities []federationtypes.FederatedEntity) map[string]string {
+	owners := make(map[string]string)
+
+	for _, entity := range entities {
+		if entity.ServiceName == "" || entity.Kind == federationtypes.EntityKindInterface {
+			continue
 		}
+		if _, exists := owners[entity.TypeName]; !exists {
+			owners[entity.TypeName] = entity.ServiceName
+		}
+	}
 
-		allResults = append(allResults, entities...)
+	for _, entity := range entities {
+		if entity.ServiceName == "" || entity.Kind != federationtypes.EntityKindInterface {
+			continue
+		}
+		if _, exists := owners[entity.TypeName]; !exists {
+			owners[entity.TypeName] = entity.ServiceName
+		}
 	}
 
-	r.logger.Debug("Batch entities resolved successfully", "service", serviceName, "totalCount", len(allResults))
-	return allResults, nil
+	return owners
+}
+
+// entityChunk 单次 _entities 调用的表示分片
+type entityChunk struct {
+	typeName  string
+	keyFields string // 分片中表示共同使用的键字段，按名称排序
+	indexes   []int  // 在原始表示列表中的位置
+}
+
+// resolveEntityChunk 解析单个分片，返回的子图错误路径已重定位到表示的 Path
+func (r *EntityResolverImpl) resolveEntityChunk(ctx context.Context, serviceName string, chunk entityChunk, representations []federationtypes.RepresentationRequest) ([]interface{}, []federationtypes.GraphQLError, error) {
+	chunkRepresentations := make([]federationtypes.RepresentationRequest, 0, len(chunk.indexes))
+	for _, index := range chunk.indexes {
+		chunkRepresentations = append(chunkRepresentations, representations[index])
+	}
+
+	// 构建批量查询
+	query, err := r.buildBatchEntityQuery(chunk.typeName, chunkRepresentations)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build batch query for type %s: %w", chunk.typeName, err)
+	}
+
+	// 准备变量
+	variables := map[string]interface{}{
+		"representations": r.extractRepresentationData(chunkRepresentations),
+	}
+
+	// 创建服务调用
+	serviceCall := &federationtypes.ServiceCall{
+		Service: &federationtypes.ServiceConfig{
+			Name: serviceName,
+		},
+		SubQuery: &federationtypes.SubQuery{
+			ServiceName: serviceName,
+			Query:       query,
+			Variables:   variables,
+		},
+		Context: &federationtypes.QueryContext{
+			RequestID: "batch-entity-resolution",
+		},
+	}
+
+	// 调用服务
+	response, err := r.serviceCaller.Call(ctx, serviceCall)
+	if err != nil {
+		return nil, nil, fmt.Errorf("batch service call failed: %w", err)
+	}
+
+	// 处理响应
+	if response.Error != nil {
+		return nil, nil, fmt.Errorf("service returned error: %w", response.Error)
+	}
+
+	// 子图错误路径重定位到实体所在的联邦路径，随结果返回给调用方
+	var graphqlErrors []federationtypes.GraphQLError
+	if len(response.Errors) > 0 {
+		if response.Service == "" {
+			response.Service = serviceName
+		}
+		response.EntityPaths = make([][]interface{}, len(chunkRepresentations))
+		for i, representation := range chunkRepresentations {
+			response.EntityPaths[i] = representation.Path
+		}
+		graphqlErrors = merger.AnnotateServiceErrors(response)
+		r.logger.Warn("Entity resolution returned subgraph errors",
+			"service", serviceName,
+			"type", chunk.typeName,
+			"errors", graphqlErrors,
+		)
+	}
+
+	// 提取实体数据；data 为空时仍返回子图错误说明原因
+	entities, err := r.extractEntitiesFromResponse(response, chunk.typeName)
+	if err != nil {
+		return nil, graphqlErrors, fmt.Errorf("failed to extract entities data: %w", err)
+	}
+
+	return entities, graphqlErrors, nil
+}
+
+// entityResolutionError 为无法解析的表示构造位于其联邦路径上的错误
+func entityResolutionError(serviceName string, representation federationtypes.RepresentationRequest, cause error) federationtypes.GraphQLError {
+	opts := []errors.ErrorOption{errors.WithPath(representation.Path...), errors.WithCause(cause)}
+	if serviceName != "" {
+		opts = append(opts, errors.WithService(serviceName))
+	}
+	resolutionErr := errors.NewEntityResolutionError(
+		fmt.Sprintf("failed to resolve %s entity: %v", representation.TypeName, cause),
+		opts...,
+	)
+
+	return federationtypes.GraphQLError{
+		Message:    resolutionErr.Message,
+		Path:       representation.Path,
+		Extensions: resolutionErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+	}
 }
 
 // ValidateRepresentation 验证实体表示的有效性
@@ -216,18 +459,63 @@ func (r *EntityResolverImpl) buildBatchEntityQuery(typeName string, representati
 	return query, nil
 }
 
-// groupRepresentationsByType 按类型分组表示
-func (r *EntityResolverImpl) groupRepresentationsByType(representations []federationtypes.RepresentationRequest) map[string][]federationtypes.RepresentationRequest {
-	groups := make(map[string][]federationtypes.RepresentationRequest)
-
-	for _, repr := range representations {
-		typeName := repr.TypeName
-		groups[typeName] = append(groups[typeName], repr)
+// groupRepresentationIndexesByType 按类型和表示使用的键字段分组表示位置，保持分组首次出现的顺序。
+// 同一类型的不同引用可能按不同的 @key 给出（如 id 或 sku），各自成组批量调用
+func (r *EntityResolverImpl) groupRepresentationIndexesByType(representations []federationtypes.RepresentationRequest) []entityChunk {
+	var groups []entityChunk
+	groupIndex := make(map[string]int)
+
+	for i, repr := range representations {
+		keyFields := representationKeyFields(repr.Representation)
+		groupKey := repr.TypeName + "\x1f" + keyFields
+		g, exists := groupIndex[groupKey]
+		if !exists {
+			g = len(groups)
+			groupIndex[groupKey] = g
+			groups = append(groups, entityChunk{typeName: repr.TypeName, keyFields: keyFields})
+		}
+		groups[g].indexes = append(groups[g].indexes, i)
 	}
 
 	return groups
 }
 
+// representationKeyFields 返回表示中除 __typename 外的字段名，按名称排序并以空格连接
+func representationKeyFields(representation map[string]interface{}) string {
+	fields := make([]string, 0, len(representation))
+	for field := range representation {
+		if field != typenameField {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// splitIntoChunks 按单次请求的数量上限和字节上限将元素依次拆分为连续的分片，单个元素始终自成一片。
+// maxCount 或 maxBytes 不大于 0 时不按该项限制，size 为空时不计算字节数
+func splitIntoChunks[T any](items []T, maxCount int, maxBytes int64, size func(T) int64) [][]T {
+	var chunks [][]T
+	start := 0
+	var currentBytes int64
+	for i, item := range items {
+		var itemBytes int64
+		if size != nil {
+			itemBytes = size(item)
+		}
+		count := i - start
+		if count > 0 && ((maxCount > 0 && count >= maxCount) || (maxBytes > 0 && currentBytes+itemBytes > maxBytes)) {
+			chunks = append(chunks, items[start:i])
+			start, currentBytes = i, 0
+		}
+		currentBytes += itemBytes
+	}
+	if start < len(items) {
+		chunks = append(chunks, items[start:])
+	}
+	return chunks
+}
+
 // extractRepresentationData 提取表示数据
 func (r *EntityResolverImpl) extractRepresentationData(representations []federationtypes.RepresentationRequest) []interface{} {
 	var data []interface{}
@@ -303,38 +591,26 @@ func (r *EntityResolverImpl) extractEntitiesFromResponse(response *federationtyp
 	return results, nil
 }
 
-// validateKeyFields 验证键字段
+// validateKeyFields 验证键字段：实体声明多个 @key 时，表示包含其中任意一个 @key 的全部字段即可
 func (r *EntityResolverImpl) validateKeyFields(entity *federationtypes.FederatedEntity, representation map[string]interface{}) error {
-	// 收集所有键字段
-	requiredKeys := make(map[string]bool)
+	if len(entity.Directives.Keys) == 0 {
+		return nil
+	}
 
+	var missing []string
 	for _, key := range entity.Directives.Keys {
-		// 解析字段选择集
-		fields := r.parseFieldSelection(key.Fields)
-		for _, field := range fields {
-			requiredKeys[field] = true
+		complete := true
+		for _, field := range key.FieldNames() {
+			if _, exists := representation[field]; !exists {
+				complete = false
+				missing = append(missing, field)
+				break
+			}
 		}
-	}
-
-	// 检查表示是否包含所有必需的键字段
-	for keyField := range requiredKeys {
-		if _, exists := representation[keyField]; !exists {
-			return fmt.Errorf("missing required key field: %s", keyField)
+		if complete {
+			return nil
 		}
 	}
 
-	return nil
-}
-
-// parseFieldSelection 解析字段选择集
-func (r *EntityResolverImpl) parseFieldSelection(fields string) []string {
-	// 简单实现：按空格分割
-	// 在实际实现中，可能需要更复杂的解析逻辑
-	var result []string
-	for _, field := range strings.Fields(fields) {
-		if field != "" {
-			result = append(result, field)
-		}
-	}
-	return result
+	return fmt.Errorf("missing required key field: %s", strings.Join(missing, " or "))
 }
@@ -2,7 +2,11 @@ package federation
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 	"envoy-wasm-graphql-federation/pkg/utils"
@@ -94,7 +98,7 @@ func TestEntityResolver_ResolveBatchEntities(t *testing.T) {
 		},
 	}
 
-	results, err := resolver.ResolveBatchEntities(context.Background(), "user-service", representations)
+	results, _, err := resolver.ResolveBatchEntities(context.Background(), "user-service", representations)
 	if err != nil {
 		t.Fatalf("ResolveBatchEntities() error = %v", err)
 	}
@@ -174,3 +178,238 @@ func TestEntityResolver_ValidateRepresentation(t *testing.T) {
 		})
 	}
 }
+
+// chunkingServiceCaller 按表示数量返回实体，并可让指定调用失败
+type chunkingServiceCaller struct {
+	mutex     sync.Mutex
+	calls     int
+	batchSize []int
+	failOn    string // 包含该 id 的分片返回错误
+}
+
+func (c *chunkingServiceCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	representations := call.SubQuery.Variables["representations"].([]interface{})
+
+	c.mutex.Lock()
+	c.calls++
+	c.batchSize = append(c.batchSize, len(representations))
+	c.mutex.Unlock()
+
+	var entities []interface{}
+	for _, repr := range representations {
+		id := repr.(map[string]interface{})["id"]
+		if id == c.failOn {
+			return nil, fmt.Errorf("subgraph rejected representation %v", id)
+		}
+		entities = append(entities, map[string]interface{}{"__typename": "User", "id": id})
+	}
+
+	return &federationtypes.ServiceResponse{
+		Data:    map[string]interface{}{"_entities": entities},
+		Service: call.Service.Name,
+	}, nil
+}
+
+func (c *chunkingServiceCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	return nil, nil
+}
+
+func (c *chunkingServiceCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	return true
+}
+
+func TestEntityResolver_ResolveBatchEntities_Chunking(t *testing.T) {
+	var representations []federationtypes.RepresentationRequest
+	for i := 0; i < 7; i++ {
+		representations = append(representations, federationtypes.RepresentationRequest{
+			TypeName:       "User",
+			Representation: map[string]interface{}{"id": fmt.Sprintf("%d", i)},
+		})
+	}
+
+	config := &EntityResolverConfig{MaxEntitiesPerRequest: 3, MaxConcurrentBatches: 2}
+
+	caller := &chunkingServiceCaller{}
+	resolver := NewEntityResolverWithConfig(config, utils.NewLogger("test"), caller)
+
+	results, _, err := resolver.ResolveBatchEntities(context.Background(), "user-service", representations)
+	if err != nil {
+		t.Fatalf("ResolveBatchEntities() error = %v", err)
+	}
+	if caller.calls != 3 {
+		t.Errorf("Expected 3 chunked calls, got %d", caller.calls)
+	}
+	for _, size := range caller.batchSize {
+		if size > 3 {
+			t.Errorf("Chunk size %d exceeds limit", size)
+		}
+	}
+	for i, result := range results {
+		if result.(map[string]interface{})["id"] != fmt.Sprintf("%d", i) {
+			t.Errorf("Result %d out of order: %v", i, result)
+		}
+	}
+
+	// 单个分片失败不影响其他分片
+	caller = &chunkingServiceCaller{failOn: "4"}
+	resolver = NewEntityResolverWithConfig(config, utils.NewLogger("test"), caller)
+
+	for i := range representations {
+		representations[i].Path = []interface{}{"users", i}
+	}
+	results, graphqlErrors, err := resolver.ResolveBatchEntities(context.Background(), "user-service", representations)
+	if err != nil {
+		t.Fatalf("Partial failure should not fail the batch: %v", err)
+	}
+	// 失败分片中的每个表示在各自路径上产生错误
+	if len(graphqlErrors) != 3 || !reflect.DeepEqual(graphqlErrors[0].Path, []interface{}{"users", 3}) {
+		t.Errorf("Expected one error per failed representation, got %+v", graphqlErrors)
+	}
+	if results[0] == nil || results[6] == nil {
+		t.Error("Expected successful chunks to return entities")
+	}
+	if results[3] != nil || results[5] != nil {
+		t.Error("Expected failed chunk to leave nil entries")
+	}
+}
+
+func TestEntityResolver_ResolveBatchEntities_SubgraphErrors(t *testing.T) {
+	caller := &mockServiceCaller{responses: map[string]*federationtypes.ServiceResponse{
+		"user-service": {
+			Data: map[string]interface{}{"_entities": []interface{}{
+				map[string]interface{}{"__typename": "User", "id": "1"},
+				nil,
+			}},
+			Errors: []federationtypes.GraphQLError{{
+				Message:    "forbidden",
+				Path:       []interface{}{"_entities", float64(1), "email"},
+				Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+			}},
+		},
+	}}
+	resolver := NewEntityResolver(utils.NewLogger("test"), caller)
+
+	representations := []federationtypes.RepresentationRequest{
+		{TypeName: "User", Representation: map[string]interface{}{"id": "1"}, Path: []interface{}{"reviews", 0, "author"}},
+		{TypeName: "User", Representation: map[string]interface{}{"id": "2"}, Path: []interface{}{"reviews", 1, "author"}},
+	}
+
+	results, graphqlErrors, err := resolver.ResolveBatchEntities(context.Background(), "user-service", representations)
+	if err != nil {
+		t.Fatalf("ResolveBatchEntities() error = %v", err)
+	}
+	if results[0] == nil || results[1] != nil {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	// _entities 错误保留 extensions，路径重定位到客户端路径并标注来源服务
+	if len(graphqlErrors) != 1 {
+		t.Fatalf("Expected the subgraph error to be surfaced, got %+v", graphqlErrors)
+	}
+	if !reflect.DeepEqual(graphqlErrors[0].Path, []interface{}{"reviews", 1, "author", "email"}) {
+		t.Errorf("Expected rebased path, got %v", graphqlErrors[0].Path)
+	}
+	if graphqlErrors[0].Extensions["code"] != "FORBIDDEN" || graphqlErrors[0].Extensions["service"] != "user-service" {
+		t.Errorf("Unexpected extensions: %v", graphqlErrors[0].Extensions)
+	}
+}
+
+// echoServiceCaller 原样返回表示，并标记处理的服务
+type echoServiceCaller struct{}
+
+func (c *echoServiceCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	var entities []interface{}
+	for _, repr := range call.SubQuery.Variables["representations"].([]interface{}) {
+		entity := map[string]interface{}{"resolvedBy": call.Service.Name}
+		for k, v := range repr.(map[string]interface{}) {
+			entity[k] = v
+		}
+		entities = append(entities, entity)
+	}
+
+	return &federationtypes.ServiceResponse{
+		Data:    map[string]interface{}{"_entities": entities},
+		Service: call.Service.Name,
+	}, nil
+}
+
+func (c *echoServiceCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	return nil, nil
+}
+
+func (c *echoServiceCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	return true
+}
+
+func TestEntityResolver_ResolveEntitiesByType_InterfaceImplementations(t *testing.T) {
+	key := []federationtypes.KeyDirective{{Fields: "id", Resolvable: true}}
+	entities := []federationtypes.FederatedEntity{
+		{TypeName: "Node", ServiceName: "accounts", Kind: federationtypes.EntityKindInterface, Directives: federationtypes.EntityDirectives{Keys: key}},
+		{TypeName: "User", ServiceName: "accounts", Kind: federationtypes.EntityKindObject, Interfaces: []string{"Node"}, Directives: federationtypes.EntityDirectives{Keys: key}},
+		{TypeName: "Node", ServiceName: "catalog", Kind: federationtypes.EntityKindInterface, Directives: federationtypes.EntityDirectives{Keys: key}},
+		{TypeName: "Product", ServiceName: "catalog", Kind: federationtypes.EntityKindObject, Interfaces: []string{"Node"}, Directives: federationtypes.EntityDirectives{Keys: key}},
+	}
+
+	owners := EntityOwners(entities)
+	if owners["User"] != "accounts" || owners["Product"] != "catalog" {
+		t.Fatalf("Unexpected owners: %v", owners)
+	}
+
+	representations := []federationtypes.RepresentationRequest{
+		{TypeName: "User", Representation: map[string]interface{}{"id": "u1"}},
+		{TypeName: "Product", Representation: map[string]interface{}{"id": "p1"}},
+		{TypeName: "User", Representation: map[string]interface{}{"id": "u2"}},
+		{TypeName: "Unknown", Representation: map[string]interface{}{"id": "x"}},
+	}
+
+	resolver := NewEntityResolver(utils.NewLogger("test"), &echoServiceCaller{})
+	results, _, err := resolver.ResolveEntitiesByType(context.Background(), representations, owners)
+	if err != nil {
+		t.Fatalf("ResolveEntitiesByType() error = %v", err)
+	}
+
+	expected := []struct{ id, service string }{{"u1", "accounts"}, {"p1", "catalog"}, {"u2", "accounts"}}
+	for i, want := range expected {
+		entity, ok := results[i].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Result %d missing: %v", i, results[i])
+		}
+		if entity["id"] != want.id || entity["resolvedBy"] != want.service {
+			t.Errorf("Result %d = %v, want id %s from %s", i, entity, want.id, want.service)
+		}
+	}
+	if results[3] != nil {
+		t.Errorf("Expected unowned type to resolve to nil, got %v", results[3])
+	}
+}
+
+func TestEngine_ResolveEntityReferences_RoutesByTypename(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "accounts", Endpoint: "http://accounts/graphql", Schema: `type User @key(fields: "id") { id: ID! name: String }`, Timeout: time.Second},
+			{Name: "catalog", Endpoint: "http://catalog/graphql", Schema: `type Product @key(fields: "upc") { upc: String! title: String }`, Timeout: time.Second},
+		},
+		QueryTimeout: time.Second,
+	}
+	engine, err := NewEngineWithCaller(config, &echoServiceCaller{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	representations := []federationtypes.RepresentationRequest{
+		{TypeName: "Product", Representation: map[string]interface{}{"__typename": "Product", "upc": "p1"}},
+		{TypeName: "User", Representation: map[string]interface{}{"__typename": "User", "id": "u1"}},
+	}
+	results, _, err := engine.ResolveEntityReferences(context.Background(), "", representations)
+	if err != nil {
+		t.Fatalf("ResolveEntityReferences() error = %v", err)
+	}
+
+	expected := []string{"catalog", "accounts"}
+	for i, service := range expected {
+		entity, ok := results[i].(map[string]interface{})
+		if !ok || entity["resolvedBy"] != service {
+			t.Errorf("Result %d = %v, want resolved by %s", i, results[i], service)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package federation
+
+import (
+	"context"
+	"sync/atomic"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// serviceErrorRate 单个服务的滚动错误率及告警状态
+type serviceErrorRate struct {
+	window   *utils.ErrorRateWindow
+	alerting atomic.Bool // 错误率已超过阈值
+}
+
+// configureErrorRates 按配置重置各服务的错误率窗口
+func (e *Engine) configureErrorRates(config *federationtypes.FederationConfig) {
+	errorRateConfig := config.ErrorRate
+	if errorRateConfig == nil {
+		errorRateConfig = &federationtypes.ErrorRateConfig{}
+	}
+
+	e.errorRateConfig.Store(errorRateConfig)
+	e.errorRates.Range(func(key, value interface{}) bool {
+		e.errorRates.Delete(key)
+		return true
+	})
+}
+
+// serviceErrorRateFor 返回服务的错误率统计，不存在时创建
+func (e *Engine) serviceErrorRateFor(serviceName string) *serviceErrorRate {
+	if value, ok := e.errorRates.Load(serviceName); ok {
+		return value.(*serviceErrorRate)
+	}
+
+	config := e.errorRateConfig.Load()
+	value, _ := e.errorRates.LoadOrStore(serviceName, &serviceErrorRate{
+		window: utils.NewErrorRateWindow(config.Window, config.Buckets),
+	})
+	return value.(*serviceErrorRate)
+}
+
+// recordServiceResult 记录一次服务调用结果并检查告警阈值
+func (e *Engine) recordServiceResult(serviceName string, failed bool) {
+	if e.errorRateConfig.Load() == nil {
+		return
+	}
+
+	e.serviceErrorRateFor(serviceName).window.Record(failed)
+	e.checkErrorRate(serviceName)
+}
+
+// checkErrorRate 按当前窗口判断服务是否超过告警阈值，状态变化时记录日志
+func (e *Engine) checkErrorRate(serviceName string) bool {
+	config := e.errorRateConfig.Load()
+	if config == nil || config.Threshold <= 0 {
+		return false
+	}
+
+	errorRate := e.serviceErrorRateFor(serviceName)
+	rate, total := errorRate.window.Rate()
+	exceeded := total >= int64(config.MinRequests) && total > 0 && rate >= config.Threshold
+
+	if exceeded && errorRate.alerting.CompareAndSwap(false, true) {
+		e.logger.Warn("Service error rate exceeded threshold",
+			"service", serviceName,
+			"errorRate", rate,
+			"threshold", config.Threshold,
+			"calls", total,
+		)
+	} else if !exceeded && errorRate.alerting.CompareAndSwap(true, false) {
+		e.logger.Info("Service error rate recovered",
+			"service", serviceName,
+			"errorRate", rate,
+			"calls", total,
+		)
+	}
+
+	return exceeded
+}
+
+// serviceErrorRate 返回服务当前窗口的错误率
+func (e *Engine) serviceErrorRate(serviceName string) float64 {
+	if e.errorRateConfig.Load() == nil {
+		return 0
+	}
+
+	rate, _ := e.serviceErrorRateFor(serviceName).window.Rate()
+	return rate
+}
+
+// isServiceAvailable 判断服务是否可调用：调用器认为健康，且开启 TripCircuit 时错误率未超过阈值
+func (e *Engine) isServiceAvailable(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	if !e.caller.IsHealthy(ctx, service) {
+		return false
+	}
+
+	config := e.errorRateConfig.Load()
+	if config == nil || !config.TripCircuit {
+		return true
+	}
+	return !e.checkErrorRate(service.Name)
+}
@@ -0,0 +1,267 @@
+// Package federationtest 提供进程内的联邦引擎测试工具，不会被编译进 WASM 插件
+package federationtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/federation"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// SubgraphStub 进程内子图桩，直接应答 GraphQL 请求
+type SubgraphStub func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error)
+
+// StaticSubgraph 返回固定数据的子图桩，每次应答数据的副本，与真实子图每次解码新响应一致
+func StaticSubgraph(data map[string]interface{}) SubgraphStub {
+	return func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		return &federationtypes.GraphQLResponse{Data: copyData(data)}, nil
+	}
+}
+
+// copyData 深拷贝桩数据，避免引擎就地修改响应时影响后续调用
+func copyData(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyData(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyData(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// ErrorSubgraph 返回 GraphQL 错误的子图桩
+func ErrorSubgraph(message string) SubgraphStub {
+	return func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		return &federationtypes.GraphQLResponse{
+			Errors: []federationtypes.GraphQLError{{Message: message}},
+		}, nil
+	}
+}
+
+// FailingSubgraph 模拟传输层失败的子图桩
+func FailingSubgraph(err error) SubgraphStub {
+	return func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		return nil, err
+	}
+}
+
+// RecordedCall 记录的子图调用
+type RecordedCall struct {
+	Service   string
+	Query     string
+	Variables map[string]interface{}
+	Headers   map[string]string // 子查询附带的头部，如 traceparent
+	Timeout   time.Duration     // 本次调用生效的服务超时
+	Sequence  int               // 调用开始的顺序
+}
+
+// StubCaller 将服务调用路由到进程内子图桩
+type StubCaller struct {
+	subgraphs       map[string]SubgraphStub
+	responseHeaders map[string]map[string]string
+	calls           []RecordedCall
+	mutex           sync.Mutex
+}
+
+// NewStubCaller 创建子图桩调用器
+func NewStubCaller(subgraphs map[string]SubgraphStub) *StubCaller {
+	if subgraphs == nil {
+		subgraphs = make(map[string]SubgraphStub)
+	}
+
+	return &StubCaller{
+		subgraphs: subgraphs,
+	}
+}
+
+// Call 调用子图桩
+func (c *StubCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	if call == nil || call.Service == nil || call.SubQuery == nil {
+		return nil, fmt.Errorf("invalid service call")
+	}
+
+	serviceName := call.Service.Name
+	startTime := time.Now()
+
+	c.mutex.Lock()
+	c.calls = append(c.calls, RecordedCall{
+		Service:   serviceName,
+		Query:     call.SubQuery.Query,
+		Variables: call.SubQuery.Variables,
+		Headers:   call.SubQuery.Headers,
+		Timeout:   call.Service.Timeout,
+		Sequence:  len(c.calls),
+	})
+	stub, exists := c.subgraphs[serviceName]
+	headers := c.responseHeaders[serviceName]
+	c.mutex.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("no subgraph stub registered for service %s", serviceName)
+	}
+
+	result, err := stub(ctx, &federationtypes.GraphQLRequest{
+		Query:     call.SubQuery.Query,
+		Variables: call.SubQuery.Variables,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &federationtypes.ServiceResponse{
+		Service:    serviceName,
+		Latency:    time.Since(startTime),
+		StatusCode: 200,
+		Headers:    headers,
+	}
+	if result != nil {
+		response.Data = result.Data
+		response.Errors = result.Errors
+	}
+
+	return response, nil
+}
+
+// SetResponseHeaders 设置服务每次调用返回的响应头
+func (c *StubCaller) SetResponseHeaders(service string, headers map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.responseHeaders == nil {
+		c.responseHeaders = make(map[string]map[string]string)
+	}
+	c.responseHeaders[service] = headers
+}
+
+// CallBatch 依次调用子图桩
+func (c *StubCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	responses := make([]*federationtypes.ServiceResponse, len(calls))
+	for i, call := range calls {
+		response, err := c.Call(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		responses[i] = response
+	}
+	return responses, nil
+}
+
+// IsHealthy 注册了子图桩的服务视为健康
+func (c *StubCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	if service == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, exists := c.subgraphs[service.Name]
+	return exists
+}
+
+// Calls 返回已记录的调用
+func (c *StubCaller) Calls() []RecordedCall {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	calls := make([]RecordedCall, len(c.calls))
+	copy(calls, c.calls)
+	return calls
+}
+
+// CallsTo 返回发往指定服务的调用
+func (c *StubCaller) CallsTo(serviceName string) []RecordedCall {
+	var calls []RecordedCall
+	for _, call := range c.Calls() {
+		if call.Service == serviceName {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// TestEngine 使用子图桩的联邦引擎
+type TestEngine struct {
+	*federation.Engine
+	Caller *StubCaller
+	config *federationtypes.FederationConfig
+}
+
+// NewTestEngine 创建使用进程内子图桩的联邦引擎。引擎使用配置的副本，补全默认值不会修改调用方的配置
+func NewTestEngine(config *federationtypes.FederationConfig, subgraphs map[string]SubgraphStub) (*TestEngine, error) {
+	if config == nil {
+		return nil, fmt.Errorf("configuration is required")
+	}
+
+	copied := *config
+	copied.Services = append([]federationtypes.ServiceConfig(nil), config.Services...)
+	config = &copied
+	if config.QueryTimeout <= 0 {
+		config.QueryTimeout = 5 * time.Second
+	}
+
+	stubCaller := NewStubCaller(subgraphs)
+
+	engine, err := federation.NewEngineWithCaller(config, stubCaller, utils.NewLogger("federationtest"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return &TestEngine{
+		Engine: engine,
+		Caller: stubCaller,
+		config: config,
+	}, nil
+}
+
+// Execute 执行查询
+func (e *TestEngine) Execute(query string, variables map[string]interface{}) (*federationtypes.GraphQLResponse, error) {
+	requestID := fmt.Sprintf("federationtest-%d", len(e.Caller.Calls()))
+
+	ctx := &federationtypes.ExecutionContext{
+		RequestID: requestID,
+		QueryContext: &federationtypes.QueryContext{
+			Query:     query,
+			Variables: variables,
+			RequestID: requestID,
+		},
+		StartTime: time.Now(),
+		Config:    e.config,
+	}
+
+	return e.ExecuteQuery(ctx, &federationtypes.GraphQLRequest{
+		Query:     query,
+		Variables: variables,
+	})
+}
+
+// ExecuteBatch 执行一批操作
+func (e *TestEngine) ExecuteBatch(requests []*federationtypes.GraphQLRequest) ([]*federationtypes.GraphQLResponse, error) {
+	requestID := fmt.Sprintf("federationtest-batch-%d", len(e.Caller.Calls()))
+
+	ctx := &federationtypes.ExecutionContext{
+		RequestID:    requestID,
+		QueryContext: &federationtypes.QueryContext{RequestID: requestID},
+		StartTime:    time.Now(),
+		Config:       e.config,
+	}
+
+	return e.Engine.ExecuteBatch(ctx, requests)
+}
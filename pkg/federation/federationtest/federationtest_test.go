@@ -0,0 +1,2928 @@
+package federationtest
+
+import (
+	"context"
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/federation"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func newTestConfig() *federationtypes.FederationConfig {
+	return &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "people",
+				Endpoint: "http://people/graphql",
+				Schema:   "type Query { people: [Person] } type Person { id: ID! name: String }",
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "books",
+				Endpoint: "http://books/graphql",
+				Schema:   "type Query { books: [Book] } type Book { isbn: String! }",
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+}
+
+func TestTestEngine_MergesSubgraphResponses(t *testing.T) {
+	engine, err := NewTestEngine(newTestConfig(), map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+		}),
+		"books": StaticSubgraph(map[string]interface{}{
+			"books": []interface{}{map[string]interface{}{"isbn": "978-0"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ people { id name } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	data, ok := response.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected object data, got %T", response.Data)
+	}
+	if _, ok := data["people"]; !ok {
+		t.Error("Expected people in merged data")
+	}
+	if _, ok := data["books"]; !ok {
+		t.Error("Expected books in merged data")
+	}
+
+	if len(engine.Caller.CallsTo("people")) != 1 || len(engine.Caller.CallsTo("books")) != 1 {
+		t.Errorf("Expected one call per subgraph, got %+v", engine.Caller.Calls())
+	}
+}
+
+func TestTestEngine_PropagatesSubgraphErrors(t *testing.T) {
+	engine, err := NewTestEngine(newTestConfig(), map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+		"books": ErrorSubgraph("books unavailable"),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	found := false
+	for _, graphqlErr := range response.Errors {
+		if graphqlErr.Message == "books unavailable" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected subgraph error to be propagated, got %+v", response.Errors)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	if _, ok := data["people"]; !ok {
+		t.Error("Expected people data despite books failure")
+	}
+}
+
+func TestTestEngine_PinnedSchemaVersionInStatus(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].PinnedSchemaVersion = "0000000000000000"
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	status := engine.GetStatus()
+
+	pinned := status.Services["people"]
+	if pinned.PinnedSchemaVersion != "0000000000000000" {
+		t.Errorf("Expected pinned version in status, got %q", pinned.PinnedSchemaVersion)
+	}
+	if pinned.SchemaVersion != "" {
+		t.Errorf("Expected drifted schema to be rejected, got live version %q", pinned.SchemaVersion)
+	}
+
+	if unpinned := status.Services["books"]; unpinned.SchemaVersion == "" || unpinned.PinnedSchemaVersion != "" {
+		t.Errorf("Expected live version without pin, got %+v", unpinned)
+	}
+}
+
+func TestTestEngine_MaxTotalResponseBytes(t *testing.T) {
+	subgraphs := func() map[string]SubgraphStub {
+		large := StaticSubgraph(map[string]interface{}{
+			"books": []interface{}{map[string]interface{}{"isbn": strings.Repeat("9", 512)}},
+		})
+		return map[string]SubgraphStub{
+			"people": StaticSubgraph(map[string]interface{}{
+				"people": []interface{}{map[string]interface{}{"id": "1"}},
+			}),
+			"books": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+				// 保证 people 先返回
+				time.Sleep(50 * time.Millisecond)
+				return large(ctx, request)
+			},
+		}
+	}
+
+	t.Run("partial data", func(t *testing.T) {
+		config := newTestConfig()
+		config.MaxTotalResponseBytes = 256
+		config.PartialOnResponseLimit = true
+
+		engine, err := NewTestEngine(config, subgraphs())
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+
+		response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+
+		data, _ := response.Data.(map[string]interface{})
+		if _, ok := data["people"]; !ok {
+			t.Errorf("Expected people data, got %+v", response.Data)
+		}
+		if _, ok := data["books"]; ok {
+			t.Error("Expected books data to be dropped")
+		}
+
+		found := false
+		for _, graphqlErr := range response.Errors {
+			if graphqlErr.Extensions["code"] == string(errors.ErrCodeResponseTooLarge) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected RESPONSE_TOO_LARGE error, got %+v", response.Errors)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		config := newTestConfig()
+		config.MaxTotalResponseBytes = 256
+
+		engine, err := NewTestEngine(config, subgraphs())
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+
+		_, err = engine.Execute("{ people { id } books { isbn } }", nil)
+		var fedErr *errors.FederationError
+		if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeResponseTooLarge {
+			t.Fatalf("Expected RESPONSE_TOO_LARGE error, got %v", err)
+		}
+	})
+}
+
+func TestTestEngine_DebugModePhaseTimings(t *testing.T) {
+	config := newTestConfig()
+	config.DebugMode = true
+	config.PlanningTimeout = time.Second
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	timings, ok := response.Extensions["timings"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected timings in extensions, got %+v", response.Extensions)
+	}
+	if _, ok := timings["planningMs"]; !ok {
+		t.Error("Expected planningMs timing")
+	}
+	if _, ok := timings["executionMs"]; !ok {
+		t.Error("Expected executionMs timing")
+	}
+}
+
+func TestTestEngine_CacheControlCachesResponses(t *testing.T) {
+	config := newTestConfig()
+	config.EnableCaching = true
+	config.Services[0].Schema = `
+		directive @cacheControl(maxAge: Int) on OBJECT | FIELD_DEFINITION
+		type Query { people: [Person] @cacheControl(maxAge: 60) } type Person { id: ID! name: String }`
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := engine.Execute("{ people { id } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if _, ok := response.Data.(map[string]interface{})["people"]; !ok {
+			t.Fatalf("Expected people data, got %+v", response.Data)
+		}
+	}
+
+	if calls := engine.Caller.CallsTo("people"); len(calls) != 1 {
+		t.Errorf("Expected second query to be served from cache, got %d calls", len(calls))
+	}
+}
+
+func TestTestEngine_CacheMetadata(t *testing.T) {
+	config := newTestConfig()
+	config.EnableCaching = true
+	config.CacheMetadata = true
+	config.Services[0].Schema = `
+		directive @cacheControl(maxAge: Int) on OBJECT | FIELD_DEFINITION
+		type Query { people: [Person] @cacheControl(maxAge: 60) } type Person { id: ID! name: String }`
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	stored, err := engine.Execute("{ people { id } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := map[string]interface{}{"hit": false, "age": int64(0), "ttl": int64(60)}
+	if got := stored.Extensions["cache"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stored cache metadata %v, got %v", want, got)
+	}
+
+	hit, err := engine.Execute("{ people { id } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	metadata, ok := hit.Extensions["cache"].(map[string]interface{})
+	if !ok || metadata["hit"] != true || metadata["age"] != int64(0) || metadata["ttl"].(int64) > 60 || len(metadata) != 3 {
+		t.Errorf("Unexpected cache hit metadata: %v", hit.Extensions["cache"])
+	}
+
+	// 未开启缓存时不返回缓存元数据
+	config.EnableCaching = false
+	if err := engine.Initialize(config); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	uncached, err := engine.Execute("{ people { id } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, ok := uncached.Extensions["cache"]; ok {
+		t.Errorf("Expected no cache metadata with caching disabled, got %v", uncached.Extensions)
+	}
+}
+
+func TestTestEngine_DebugModePlanHash(t *testing.T) {
+	config := newTestConfig()
+	config.DebugMode = true
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	hashes := make(map[interface{}]bool)
+	for _, query := range []string{"{ people { id } }", "{ people { id } }", "{ books { isbn } }"} {
+		response, err := engine.Execute(query, nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		planHash, ok := response.Extensions["planHash"].(string)
+		if !ok || planHash == "" {
+			t.Fatalf("Expected planHash in extensions, got %+v", response.Extensions)
+		}
+		hashes[planHash] = true
+	}
+
+	if len(hashes) != 2 {
+		t.Errorf("Expected identical plans to share a hash and different routing to differ, got %v", hashes)
+	}
+}
+
+func TestTestEngine_StrictProjection(t *testing.T) {
+	subgraphs := func() map[string]SubgraphStub {
+		return map[string]SubgraphStub{
+			"people": StaticSubgraph(map[string]interface{}{
+				"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada", "ssn": "secret"}},
+			}),
+		}
+	}
+
+	for _, strict := range []bool{false, true} {
+		config := newTestConfig()
+		config.StrictProjection = strict
+
+		engine, err := NewTestEngine(config, subgraphs())
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+
+		response, err := engine.Execute("{ people { id } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+
+		person := response.Data.(map[string]interface{})["people"].([]interface{})[0].(map[string]interface{})
+		if _, leaked := person["ssn"]; leaked == strict {
+			t.Errorf("StrictProjection=%v: unexpected projected person %+v", strict, person)
+		}
+	}
+}
+
+func TestTestEngine_UnknownFieldPolicy(t *testing.T) {
+	for _, policy := range []string{"", "drop"} {
+		config := newTestConfig()
+		config.UnknownFieldPolicy = policy
+
+		engine, err := NewTestEngine(config, map[string]SubgraphStub{
+			"people": StaticSubgraph(map[string]interface{}{
+				"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada", "ssn": "secret"}},
+			}),
+		})
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+
+		response, err := engine.Execute("{ people { id name } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+
+		person := response.Data.(map[string]interface{})["people"].([]interface{})[0].(map[string]interface{})
+		if _, leaked := person["ssn"]; leaked == (policy == "drop") {
+			t.Errorf("UnknownFieldPolicy=%q: unexpected person %+v", policy, person)
+		}
+		if person["name"] != "Ada" {
+			t.Errorf("UnknownFieldPolicy=%q: expected selected field to be kept, got %+v", policy, person)
+		}
+	}
+
+	// 实体查询所需的键字段在合并时保留
+	config := newEntityListConfig()
+	config.UnknownFieldPolicy = "drop"
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviewsSubgraph(0)})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+	product := response.Data.(map[string]interface{})["topProducts"].([]interface{})[0].(map[string]interface{})
+	if reviews, _ := product["reviews"].([]interface{}); len(reviews) != 1 {
+		t.Errorf("Expected entity join to survive dropping unselected fields, got %v", product)
+	}
+}
+
+func TestTestEngine_FallbackResponse(t *testing.T) {
+	config := newTestConfig()
+	config.FallbackResponse = `{"people": [], "books": []}`
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": FailingSubgraph(stderrors.New("connection refused")),
+		"books":  ErrorSubgraph("books unavailable"),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) == 0 {
+		t.Error("Expected errors to be kept alongside fallback data")
+	}
+
+	data, ok := response.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected fallback data, got %T", response.Data)
+	}
+	if _, ok := data["people"]; !ok {
+		t.Errorf("Expected fallback people field, got %+v", data)
+	}
+
+	// 部分成功时不使用兜底数据
+	engine, err = NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+		"books": ErrorSubgraph("books unavailable"),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err = engine.Execute("{ people { id } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	data, _ = response.Data.(map[string]interface{})
+	if people, _ := data["people"].([]interface{}); len(people) != 1 {
+		t.Errorf("Expected real people data on partial failure, got %+v", data)
+	}
+}
+
+func TestTestEngine_CoalescesConcurrentQueries(t *testing.T) {
+	config := newTestConfig()
+	config.CoalesceQueries = true
+
+	release := make(chan struct{})
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			<-release
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+				"people": []interface{}{map[string]interface{}{"id": "1"}},
+			}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	const concurrent = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrent)
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := engine.Execute("{ people { id } }", nil)
+			if err == nil && response.Data == nil {
+				err = stderrors.New("missing data")
+			}
+			errs <- err
+		}()
+	}
+
+	// 等待其余请求加入进行中的执行后再放行子图
+	deadline := time.Now().Add(2 * time.Second)
+	for engine.GetCoalescingStats().CoalescedRequests < concurrent-1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Execute() error = %v", err)
+		}
+	}
+
+	if calls := len(engine.Caller.CallsTo("people")); calls != 1 {
+		t.Errorf("Expected a single subgraph call, got %d", calls)
+	}
+
+	stats := engine.GetCoalescingStats()
+	if stats.CoalescedRequests != concurrent-1 {
+		t.Errorf("Expected %d coalesced requests, got %d", concurrent-1, stats.CoalescedRequests)
+	}
+	if stats.StampedesPrevented != 1 {
+		t.Errorf("Expected 1 stampede prevented, got %d", stats.StampedesPrevented)
+	}
+	if stats.MaxConcurrentJoiners != concurrent-1 {
+		t.Errorf("Expected max joiners %d, got %d", concurrent-1, stats.MaxConcurrentJoiners)
+	}
+	if stats.BytesSaved <= 0 {
+		t.Errorf("Expected bytes saved to be recorded, got %d", stats.BytesSaved)
+	}
+
+	metrics := engine.GetMetrics()
+	if metrics["coalesced_requests"] != int64(concurrent-1) {
+		t.Errorf("Expected coalesced_requests in metrics, got %v", metrics["coalesced_requests"])
+	}
+}
+
+func TestTestEngine_StaticTypenames(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = `
+		type Query { people: [Person] search: [SearchResult] }
+		type Person { id: ID! name: String }
+		type Book { isbn: String! }
+		union SearchResult = Person | Book`
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+			"search": []interface{}{
+				map[string]interface{}{"__typename": "Book", "isbn": "978-0"},
+				map[string]interface{}{"id": "2"},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ __typename people { kind: __typename id } search { __typename } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	if data["__typename"] != "Query" {
+		t.Errorf("Expected root __typename Query, got %v", data["__typename"])
+	}
+
+	// 具体类型位置由模式信息填充
+	person := data["people"].([]interface{})[0].(map[string]interface{})
+	if person["kind"] != "Person" {
+		t.Errorf("Expected aliased __typename Person, got %v", person["kind"])
+	}
+
+	// 联合类型位置保留子图返回值，不做推断
+	search := data["search"].([]interface{})
+	if search[0].(map[string]interface{})["__typename"] != "Book" {
+		t.Errorf("Expected upstream __typename Book, got %v", search[0])
+	}
+	if _, ok := search[1].(map[string]interface{})["__typename"]; ok {
+		t.Errorf("Abstract position should not be filled locally, got %v", search[1])
+	}
+
+	// 原样转发时具体类型位置的 __typename 不发给子图
+	response, err = engine.Execute("{ people { kind: __typename id } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	calls := engine.Caller.CallsTo("people")
+	if sent := calls[len(calls)-1].Query; strings.Contains(sent, "__typename") {
+		t.Errorf("Expected concrete __typename not to be sent upstream, got %q", sent)
+	}
+	person = response.Data.(map[string]interface{})["people"].([]interface{})[0].(map[string]interface{})
+	if person["kind"] != "Person" {
+		t.Errorf("Expected locally filled __typename Person, got %v", person["kind"])
+	}
+}
+
+func TestTestEngine_WorkerPoolSharedAcrossRequests(t *testing.T) {
+	config := newTestConfig()
+	config.WorkerPoolSize = 1
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+			if err != nil {
+				t.Errorf("Execute() error = %v", err)
+				return
+			}
+			data, _ := response.Data.(map[string]interface{})
+			if _, ok := data["people"]; !ok {
+				t.Errorf("Expected people in merged data, got %+v", data)
+			}
+			if _, ok := data["books"]; !ok {
+				t.Errorf("Expected books in merged data, got %+v", data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := engine.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+}
+
+func TestTestEngine_LoadShedding(t *testing.T) {
+	config := newTestConfig()
+	config.LoadShedding = &federationtypes.LoadSheddingConfig{MaxConcurrent: 2, QueueDepth: 1}
+
+	started := make(chan struct{}, 8)
+	unblock := make(chan struct{})
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			started <- struct{}{}
+			<-unblock
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"people": []interface{}{}}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	admitted := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.Execute("{ people { id } }", nil)
+			admitted <- err
+		}()
+	}
+
+	// 两个查询占满并发，第三个进入队列
+	<-started
+	<-started
+	deadline := time.Now().Add(time.Second)
+	for engine.GetLoadSheddingStats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected one queued query, got %+v", engine.GetLoadSheddingStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 队列已满，超出的查询立即被拒绝，而不是等到超时
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err := engine.Execute("{ people { id } }", nil)
+		elapsed := time.Since(start)
+
+		var federationErr *errors.FederationError
+		if !stderrors.As(err, &federationErr) || federationErr.Code != errors.ErrCodeUnavailable {
+			t.Fatalf("Expected SERVICE_UNAVAILABLE, got %v", err)
+		}
+		if federationErr.Extensions["reason"] != "OVERLOADED" || federationErr.Extensions["retryAfter"] != 1 {
+			t.Errorf("Expected OVERLOADED with retryAfter 1, got %v", federationErr.Extensions)
+		}
+		if elapsed > 100*time.Millisecond {
+			t.Errorf("Expected shed query to fail fast, took %s", elapsed)
+		}
+	}
+
+	close(unblock)
+	wg.Wait()
+	close(admitted)
+	for err := range admitted {
+		if err != nil {
+			t.Errorf("Expected admitted and queued queries to succeed, got %v", err)
+		}
+	}
+
+	if stats := engine.GetLoadSheddingStats(); stats.Shed != 2 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Unexpected load shedding stats %+v", stats)
+	}
+}
+
+func TestTestEngine_LoadSheddingWaitPolicy(t *testing.T) {
+	config := newTestConfig()
+	config.LoadShedding = &federationtypes.LoadSheddingConfig{
+		MaxConcurrent: 1,
+		Policy:        federationtypes.LoadSheddingWait,
+		QueueTimeout:  50 * time.Millisecond,
+	}
+
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			started <- struct{}{}
+			<-unblock
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"people": []interface{}{}}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.Execute("{ people { id } }", nil)
+		done <- err
+	}()
+	<-started
+
+	// 等待策略下超出的查询排队到 queueTimeout 后才被拒绝
+	start := time.Now()
+	_, err = engine.Execute("{ people { id } }", nil)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected queued query to wait for queueTimeout, took %s", elapsed)
+	}
+	var federationErr *errors.FederationError
+	if !stderrors.As(err, &federationErr) || federationErr.Code != errors.ErrCodeUnavailable {
+		t.Fatalf("Expected SERVICE_UNAVAILABLE after queue timeout, got %v", err)
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Errorf("Expected admitted query to succeed, got %v", err)
+	}
+}
+
+func TestTestEngine_EntityJoin(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Query { products: [Product] } type Product @key(fields: "id") { id: ID! name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "reviews",
+				Endpoint: "http://reviews/graphql",
+				Schema:   `type Product @key(fields: "id") { id: ID! reviews: [Review] } type Review { body: String }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"catalog": StaticSubgraph(map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"},
+				map[string]interface{}{"__typename": "Product", "id": "2", "name": "Desk"},
+				map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"},
+			},
+		}),
+		"reviews": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			representations, _ := request.Variables["representations"].([]interface{})
+			entities := make([]interface{}, len(representations))
+			for i, representation := range representations {
+				id := representation.(map[string]interface{})["id"]
+				entities[i] = map[string]interface{}{
+					"reviews": []interface{}{map[string]interface{}{"body": "review of " + id.(string)}},
+				}
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": entities}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ products { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	products, _ := data["products"].([]interface{})
+	if len(products) != 3 {
+		t.Fatalf("Expected 3 products, got %v", data["products"])
+	}
+	for i, expected := range []string{"1", "2", "1"} {
+		product := products[i].(map[string]interface{})
+		reviews, _ := product["reviews"].([]interface{})
+		if product["name"] == nil || len(reviews) != 1 {
+			t.Fatalf("Expected joined product fields, got %v", product)
+		}
+		if body := reviews[0].(map[string]interface{})["body"]; body != "review of "+expected {
+			t.Errorf("Product %d: expected review of %s, got %v", i, expected, body)
+		}
+		// 规划器补充的键字段和 __typename 不返回给客户端
+		if _, ok := product["id"]; ok {
+			t.Errorf("Product %d: expected injected key field to be stripped, got %v", i, product)
+		}
+		if _, ok := product["__typename"]; ok {
+			t.Errorf("Product %d: expected injected __typename to be stripped, got %v", i, product)
+		}
+	}
+
+	// 相同实体只请求一次
+	calls := engine.Caller.CallsTo("reviews")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one entity fetch, got %+v", engine.Caller.Calls())
+	}
+	if representations, _ := calls[0].Variables["representations"].([]interface{}); len(representations) != 2 {
+		t.Errorf("Expected 2 deduplicated representations, got %v", calls[0].Variables["representations"])
+	}
+	if !strings.Contains(calls[0].Query, "_entities(representations: $representations)") {
+		t.Errorf("Expected _entities query, got %s", calls[0].Query)
+	}
+}
+
+func TestTestEngine_RequiresFromThirdService(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Query { products: [Product] } type Product @key(fields: "id") { id: ID! name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "inventory",
+				Endpoint: "http://inventory/graphql",
+				Schema:   `type Product @key(fields: "id") { id: ID! weight: Int }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "shipping",
+				Endpoint: "http://shipping/graphql",
+				Schema:   `type Product @key(fields: "id") { id: ID! @external weight: Int @external shippingEstimate: Int @requires(fields: "weight") }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+
+	entities := func(resolve func(representation map[string]interface{}) map[string]interface{}) SubgraphStub {
+		return func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			representations, _ := request.Variables["representations"].([]interface{})
+			result := make([]interface{}, len(representations))
+			for i, representation := range representations {
+				result[i] = resolve(representation.(map[string]interface{}))
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": result}}, nil
+		}
+	}
+	weights := map[string]float64{"1": 10, "2": 25}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"catalog": StaticSubgraph(map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"},
+				map[string]interface{}{"__typename": "Product", "id": "2", "name": "Desk"},
+			},
+		}),
+		"inventory": entities(func(representation map[string]interface{}) map[string]interface{} {
+			return map[string]interface{}{"weight": weights[representation["id"].(string)]}
+		}),
+		"shipping": entities(func(representation map[string]interface{}) map[string]interface{} {
+			weight, ok := representation["weight"].(float64)
+			if !ok {
+				return map[string]interface{}{"shippingEstimate": nil}
+			}
+			return map[string]interface{}{"shippingEstimate": weight * 2}
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ products { name shippingEstimate } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	// 必需字段先从 inventory 取回，再随表示发给 shipping
+	calls := engine.Caller.CallsTo("shipping")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one shipping entity fetch, got %+v", engine.Caller.Calls())
+	}
+	representations, _ := calls[0].Variables["representations"].([]interface{})
+	if len(representations) != 2 {
+		t.Fatalf("Expected 2 shipping representations, got %v", calls[0].Variables["representations"])
+	}
+	for _, representation := range representations {
+		fields := representation.(map[string]interface{})
+		if fields["weight"] != weights[fields["id"].(string)] {
+			t.Errorf("Expected required weight in shipping representation, got %v", fields)
+		}
+	}
+	if inventory := engine.Caller.CallsTo("inventory"); len(inventory) != 1 {
+		t.Errorf("Expected one inventory entity fetch, got %+v", inventory)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	products, _ := data["products"].([]interface{})
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 products, got %v", data["products"])
+	}
+	for i, expected := range []float64{20, 50} {
+		product := products[i].(map[string]interface{})
+		if product["shippingEstimate"] != expected {
+			t.Errorf("Product %d: expected shippingEstimate %v, got %v", i, expected, product["shippingEstimate"])
+		}
+		// 必需字段和键字段是规划器补充的，客户端未选择
+		if _, ok := product["weight"]; ok {
+			t.Errorf("Product %d: expected required field to be stripped, got %v", i, product)
+		}
+	}
+}
+
+func TestTestEngine_AccountsReviewsEntityJoin(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "accounts",
+				Endpoint: "http://accounts/graphql",
+				Schema:   `type Query { me: User } type User @key(fields: "id") { id: ID! username: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "reviews",
+				Endpoint: "http://reviews/graphql",
+				Schema: `type Query { topReviews: [Review] } type Review { body: String author: User }
+					extend type User @key(fields: "id") { id: ID! @external reviews: [Review] }`,
+				Timeout: time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+
+	usernames := map[string]string{"1": "ada", "2": "grace"}
+	entities := func(request *federationtypes.GraphQLRequest, resolve func(id string) map[string]interface{}) *federationtypes.GraphQLResponse {
+		representations, _ := request.Variables["representations"].([]interface{})
+		result := make([]interface{}, len(representations))
+		for i, representation := range representations {
+			result[i] = resolve(representation.(map[string]interface{})["id"].(string))
+		}
+		return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": result}}
+	}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"accounts": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			if strings.Contains(request.Query, "_entities") {
+				return entities(request, func(id string) map[string]interface{} {
+					return map[string]interface{}{"username": usernames[id]}
+				}), nil
+			}
+			me := map[string]interface{}{"__typename": "User", "id": "1"}
+			if strings.Contains(request.Query, "username") {
+				me["username"] = usernames["1"]
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"me": me}}, nil
+		},
+		"reviews": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			if strings.Contains(request.Query, "_entities") {
+				return entities(request, func(id string) map[string]interface{} {
+					review := map[string]interface{}{"body": "great"}
+					if strings.Contains(request.Query, "author") {
+						review["author"] = map[string]interface{}{"__typename": "User", "id": id}
+					}
+					return map[string]interface{}{"reviews": []interface{}{review}}
+				}), nil
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+				"topReviews": []interface{}{
+					map[string]interface{}{"body": "ok", "author": map[string]interface{}{"__typename": "User", "id": "2"}},
+				},
+			}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected map[string]interface{}
+		calls    map[string]int
+	}{
+		{
+			name:  "base fetch from owner then reviews by key",
+			query: "{ me { username reviews { body } } }",
+			expected: map[string]interface{}{
+				"me": map[string]interface{}{"username": "ada", "reviews": []interface{}{map[string]interface{}{"body": "great"}}},
+			},
+			calls: map[string]int{"accounts": 1, "reviews": 1},
+		},
+		{
+			name:  "extending service resolves owner fields by external key",
+			query: "{ topReviews { body author { username } } }",
+			expected: map[string]interface{}{
+				"topReviews": []interface{}{map[string]interface{}{"body": "ok", "author": map[string]interface{}{"username": "grace"}}},
+			},
+			calls: map[string]int{"accounts": 1, "reviews": 1},
+		},
+		{
+			name:  "nested join back to the owner",
+			query: "{ me { reviews { body author { username } } } }",
+			expected: map[string]interface{}{
+				"me": map[string]interface{}{"reviews": []interface{}{
+					map[string]interface{}{"body": "great", "author": map[string]interface{}{"username": "ada"}},
+				}},
+			},
+			calls: map[string]int{"accounts": 2, "reviews": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := map[string]int{"accounts": len(engine.Caller.CallsTo("accounts")), "reviews": len(engine.Caller.CallsTo("reviews"))}
+
+			response, err := engine.Execute(tt.query, nil)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if len(response.Errors) != 0 {
+				t.Fatalf("Unexpected errors: %+v", response.Errors)
+			}
+
+			if data := stripKeys(response.Data); !reflect.DeepEqual(data, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, data)
+			}
+			for service, count := range tt.calls {
+				if calls := len(engine.Caller.CallsTo(service)) - before[service]; calls != count {
+					t.Errorf("Expected %d calls to %s, got %d", count, service, calls)
+				}
+			}
+		})
+	}
+}
+
+// stripKeys 去除网关为构造表示补充的 __typename 和 id，只比较客户端选择的字段
+func stripKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			if key == "__typename" || key == "id" {
+				continue
+			}
+			stripped[key] = stripKeys(field)
+		}
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, len(v))
+		for i, item := range v {
+			stripped[i] = stripKeys(item)
+		}
+		return stripped
+	default:
+		return value
+	}
+}
+
+func TestTestEngine_FieldTimeoutBudget(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = "type Query { people: [Person] slowReport: String } type Person { id: ID! name: String }"
+	config.FieldTimeouts = map[string]time.Duration{"Query.slowReport": 20 * time.Millisecond}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			if strings.Contains(request.Query, "slowReport") {
+				// 模拟慢字段，直到预算耗尽
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+				"people": []interface{}{map[string]interface{}{"id": "1"}},
+			}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	start := time.Now()
+	response, err := engine.Execute("{ people { id } slowReport }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= config.QueryTimeout {
+		t.Errorf("Slow field should not hold the response until the query timeout, took %v", elapsed)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	if _, ok := data["people"]; !ok {
+		t.Errorf("Expected people to be returned, got %v", data)
+	}
+	if value, ok := data["slowReport"]; !ok || value != nil {
+		t.Errorf("Expected slowReport to be null, got %v (present %v)", value, ok)
+	}
+
+	if len(response.Errors) != 1 {
+		t.Fatalf("Expected one timeout error, got %+v", response.Errors)
+	}
+	timeoutErr := response.Errors[0]
+	if timeoutErr.Extensions["code"] != string(errors.ErrCodeTimeout) {
+		t.Errorf("Expected TIMEOUT_ERROR, got %v", timeoutErr.Extensions["code"])
+	}
+	if len(timeoutErr.Path) != 1 || timeoutErr.Path[0] != "slowReport" {
+		t.Errorf("Expected error path [slowReport], got %v", timeoutErr.Path)
+	}
+	if len(engine.Caller.CallsTo("people")) != 2 {
+		t.Errorf("Expected slowReport in its own sub-query, got %+v", engine.Caller.Calls())
+	}
+}
+
+func TestTestEngine_Tracing(t *testing.T) {
+	config := newTestConfig()
+	config.EnableTracing = true
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+		"books": StaticSubgraph(map[string]interface{}{
+			"books": []interface{}{map[string]interface{}{"isbn": "978-0"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	// 未请求 tracing 时不输出
+	response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, ok := response.Extensions["tracing"]; ok {
+		t.Error("Tracing should be omitted unless requested")
+	}
+
+	query := "{ people { id } library: books { isbn } }"
+	response, err = engine.ExecuteQuery(&federationtypes.ExecutionContext{
+		RequestID:    "tracing",
+		QueryContext: &federationtypes.QueryContext{Query: query, RequestID: "tracing"},
+		StartTime:    time.Now(),
+		Config:       config,
+		Tracing:      true,
+	}, &federationtypes.GraphQLRequest{Query: query})
+	if err != nil {
+		t.Fatalf("ExecuteQuery() error = %v", err)
+	}
+
+	tracing, ok := response.Extensions["tracing"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected tracing extension, got %v", response.Extensions)
+	}
+	if tracing["version"] != 1 {
+		t.Errorf("Expected version 1, got %v", tracing["version"])
+	}
+	if duration, _ := tracing["duration"].(int64); duration <= 0 {
+		t.Errorf("Expected positive duration, got %v", tracing["duration"])
+	}
+	if _, ok := tracing["parsing"].(map[string]interface{}); !ok {
+		t.Errorf("Expected parsing phase, got %v", tracing["parsing"])
+	}
+
+	resolvers := tracing["execution"].(map[string]interface{})["resolvers"].([]interface{})
+	if len(resolvers) != 2 {
+		t.Fatalf("Expected one resolver per root field, got %v", resolvers)
+	}
+	services := make(map[string]map[string]interface{})
+	for _, entry := range resolvers {
+		resolver := entry.(map[string]interface{})
+		services[resolver["service"].(string)] = resolver
+	}
+	people := services["people"]
+	if people["parentType"] != "Query" || people["fieldName"] != "people" || people["returnType"] != "[Person]" {
+		t.Errorf("Unexpected people resolver %v", people)
+	}
+	if books := services["books"]; books == nil || books["fieldName"] != "books" {
+		t.Errorf("Unexpected books resolver %v", books)
+	}
+}
+
+func TestTestEngine_TimeoutDirective(t *testing.T) {
+	config := newTestConfig()
+	config.MaxDirectiveTimeout = 3 * time.Second
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute(`query Shelf @timeout(service: "books", ms: 2000) { people { id } books { isbn } }`, nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+	if calls := engine.Caller.CallsTo("books"); len(calls) != 1 || calls[0].Timeout != 2*time.Second {
+		t.Errorf("Expected books sub-query to use the 2s directive timeout, got %+v", calls)
+	} else if strings.Contains(calls[0].Query, "@timeout") {
+		t.Errorf("Expected @timeout not to be forwarded to the subgraph, got %q", calls[0].Query)
+	}
+	if calls := engine.Caller.CallsTo("people"); len(calls) != 1 || calls[0].Timeout != time.Second {
+		t.Errorf("Expected people sub-query to keep the configured timeout, got %+v", calls)
+	}
+
+	// 超过上限时截断，只对当前请求生效
+	if _, err := engine.Execute(`query @timeout(service: "books", ms: 60000) { books { isbn } }`, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, err := engine.Execute(`{ books { isbn } }`, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	calls := engine.Caller.CallsTo("books")
+	if len(calls) != 3 || calls[1].Timeout != 3*time.Second || calls[2].Timeout != time.Second {
+		t.Errorf("Expected clamped 3s timeout followed by the configured 1s, got %+v", calls)
+	}
+
+	for _, query := range []string{
+		`query @timeout(service: "unknown", ms: 100) { books { isbn } }`,
+		`query @timeout(service: "books", ms: 0) { books { isbn } }`,
+		`query @timeout(service: "books") { books { isbn } }`,
+		`query @timeout(service: "books", ms: 100) @timeout(service: "books", ms: 200) { books { isbn } }`,
+		`{ books @timeout(service: "books", ms: 100) { isbn } }`,
+	} {
+		_, err := engine.Execute(query, nil)
+		fedErr, ok := err.(*errors.FederationError)
+		if !ok || fedErr.Code != errors.ErrCodeQueryValidation {
+			t.Errorf("Expected QUERY_VALIDATION_ERROR for %s, got %v", query, err)
+		}
+	}
+
+	// 配置的允许列表不包含 @timeout 时拒绝
+	restricted := newTestConfig()
+	restricted.AllowedDirectives = []string{"include", "skip"}
+	if err := engine.Initialize(restricted); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	_, err = engine.Execute(`query @timeout(service: "books", ms: 100) { books { isbn } }`, nil)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeDirectiveNotAllowed {
+		t.Errorf("Expected DIRECTIVE_NOT_ALLOWED without @timeout on the allowlist, got %v", err)
+	}
+}
+
+func TestTestEngine_NoCacheDirective(t *testing.T) {
+	config := newTestConfig()
+	config.EnableCaching = true
+	config.DefaultCacheMaxAge = time.Minute
+	config.CacheMetadata = true
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	// 带 @noCache 的操作每次都调用子图，且响应不写入缓存
+	for i := 0; i < 2; i++ {
+		response, err := engine.Execute(`query Token @noCache { people { id } }`, nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if _, ok := response.Extensions["cache"]; ok {
+			t.Errorf("Expected no cache metadata for @noCache, got %v", response.Extensions["cache"])
+		}
+	}
+	calls := engine.Caller.CallsTo("people")
+	if len(calls) != 2 {
+		t.Fatalf("Expected @noCache queries to bypass the cache, got %d calls", len(calls))
+	}
+	if strings.Contains(calls[0].Query, "@noCache") {
+		t.Errorf("Expected @noCache not to be forwarded to the subgraph, got %q", calls[0].Query)
+	}
+
+	// 未带指令的相同查询照常缓存
+	for i := 0; i < 2; i++ {
+		if _, err := engine.Execute(`query Token { people { id } }`, nil); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	if calls := engine.Caller.CallsTo("people"); len(calls) != 3 {
+		t.Errorf("Expected the query without @noCache to be cached, got %d calls", len(calls))
+	}
+
+	_, err = engine.Execute(`{ people @noCache { id } }`, nil)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeQueryValidation {
+		t.Errorf("Expected QUERY_VALIDATION_ERROR for @noCache on a field, got %v", err)
+	}
+}
+
+func TestTestEngine_ReadinessQuorum(t *testing.T) {
+	newQuorumConfig := func(quorum string) *federationtypes.FederationConfig {
+		config := newTestConfig()
+		config.Services = append(config.Services, federationtypes.ServiceConfig{
+			Name:     "reviews",
+			Endpoint: "http://reviews/graphql",
+			Schema:   "type Query { reviews: [Review] } type Review { body: String }",
+			Timeout:  time.Second,
+		})
+		config.ReadinessQuorum = quorum
+		return config
+	}
+	// reviews 没有注册子图桩，视为不健康
+	subgraphs := map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	}
+
+	tests := []struct {
+		name     string
+		quorum   string
+		required string
+		ready    bool
+	}{
+		{name: "no readiness config", ready: true},
+		{name: "count met", quorum: "2", ready: true},
+		{name: "count unmet", quorum: "3", ready: false},
+		{name: "percentage met", quorum: "60%", ready: true},
+		{name: "percentage unmet", quorum: "75%", ready: false},
+		{name: "required healthy", quorum: "1", required: "people", ready: true},
+		{name: "required unhealthy despite quorum", quorum: "1", required: "reviews", ready: false},
+		{name: "required unhealthy without quorum", required: "reviews", ready: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newQuorumConfig(tt.quorum)
+			for i := range config.Services {
+				config.Services[i].Required = config.Services[i].Name == tt.required
+			}
+
+			engine, err := NewTestEngine(config, subgraphs)
+			if err != nil {
+				t.Fatalf("NewTestEngine() error = %v", err)
+			}
+
+			readiness := engine.Readiness(context.Background())
+			if readiness.Ready != tt.ready || engine.IsHealthy() != tt.ready {
+				t.Errorf("Expected ready=%v, got %+v (IsHealthy=%v)", tt.ready, readiness, engine.IsHealthy())
+			}
+			if !tt.ready && readiness.Reason == "" {
+				t.Error("Expected a reason when not ready")
+			}
+		})
+	}
+
+	// 模式注册失败时即使达到法定数量也不就绪
+	config := newQuorumConfig("1")
+	config.Services[0].Schema = "type Query { people: [Person }"
+	engine, err := NewTestEngine(config, subgraphs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	if readiness := engine.Readiness(context.Background()); readiness.Ready || readiness.SchemaComposed {
+		t.Errorf("Expected failed schema registration to block readiness, got %+v", readiness)
+	}
+}
+
+func TestTestEngine_ResponseHeaders(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected [][2]string
+	}{
+		{policy: "", expected: [][2]string{{"cache-tag", "people"}, {"set-cookie", "session=a"}, {"set-cookie", "theme=dark"}, {"set-cookie", "books=1"}}},
+		{policy: "last", expected: [][2]string{{"cache-tag", "books, shelf"}, {"set-cookie", "session=a"}, {"set-cookie", "theme=dark"}, {"set-cookie", "books=1"}}},
+		{policy: "combine", expected: [][2]string{{"cache-tag", "people, books, shelf"}, {"set-cookie", "session=a"}, {"set-cookie", "theme=dark"}, {"set-cookie", "books=1"}}},
+	}
+
+	for _, tt := range tests {
+		config := newTestConfig()
+		config.ResponseHeaders = &federationtypes.ResponseHeadersConfig{
+			Allowlist:      []string{"Cache-Tag", "Set-Cookie"},
+			ConflictPolicy: tt.policy,
+		}
+		engine, err := NewTestEngine(config, map[string]SubgraphStub{
+			"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+			"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+		})
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+		engine.Caller.SetResponseHeaders("people", map[string]string{"cache-tag": "people", "set-cookie": "session=a\ntheme=dark", "x-internal": "1"})
+		engine.Caller.SetResponseHeaders("books", map[string]string{"Cache-Tag": "books, shelf", "set-cookie": "books=1"})
+
+		execCtx := &federationtypes.ExecutionContext{RequestID: "headers", StartTime: time.Now(), Config: config}
+		if _, err := engine.ExecuteQuery(execCtx, &federationtypes.GraphQLRequest{Query: "{ people { id } books { isbn } }"}); err != nil {
+			t.Fatalf("ExecuteQuery() error = %v", err)
+		}
+
+		if headers := engine.ResponseHeaders(execCtx); !reflect.DeepEqual(headers, tt.expected) {
+			t.Errorf("policy %q: expected headers %v, got %v", tt.policy, tt.expected, headers)
+		}
+	}
+}
+
+func TestTestEngine_VariableDefaults(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = "type Query { people(limit: Int, after: String): [Person] } type Person { id: ID! name: String }"
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		expected  map[string]interface{}
+	}{
+		{
+			name:     "omitted variable uses default",
+			query:    "query People($limit: Int = 10) { people(limit: $limit) { id } }",
+			expected: map[string]interface{}{"limit": int64(10)},
+		},
+		{
+			name:      "provided variable wins",
+			query:     "query People($limit: Int = 10) { people(limit: $limit) { id } }",
+			variables: map[string]interface{}{"limit": int64(3)},
+			expected:  map[string]interface{}{"limit": int64(3)},
+		},
+		{
+			name:      "explicit null is kept",
+			query:     "query People($limit: Int = 10) { people(limit: $limit) { id } }",
+			variables: map[string]interface{}{"limit": nil},
+			expected:  map[string]interface{}{"limit": nil},
+		},
+		{
+			name:     "default reaches split sub-query",
+			query:    `query Shelf($limit: Int = 10, $after: String = "c1") { people(limit: $limit, after: $after) { id } books { isbn } }`,
+			expected: map[string]interface{}{"limit": int64(10), "after": "c1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(engine.Caller.CallsTo("people"))
+			if _, err := engine.Execute(tt.query, tt.variables); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			calls := engine.Caller.CallsTo("people")
+			if len(calls) != before+1 {
+				t.Fatalf("Expected one call to people, got %d", len(calls)-before)
+			}
+			variables := calls[len(calls)-1].Variables
+			for name, value := range tt.expected {
+				if actual, ok := variables[name]; !ok || !reflect.DeepEqual(actual, value) {
+					t.Errorf("Expected variable %s = %#v in sub-query, got %#v", name, value, variables)
+				}
+			}
+		})
+	}
+}
+
+// newEntityListConfig catalog 提供商品列表、reviews 按 upc 扩展 Product 的配置
+func newEntityListConfig() *federationtypes.FederationConfig {
+	return &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Query { topProducts: [Product] } type Product @key(fields: "upc") { upc: String! name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "reviews",
+				Endpoint: "http://reviews/graphql",
+				Schema:   `type Product @key(fields: "upc") { upc: String! reviews: [Review] } type Review { body: String }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+}
+
+// topProductsSubgraph 每次返回新数据，避免实体字段合并到共享的桩数据中
+func topProductsSubgraph(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+	return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+		"topProducts": []interface{}{
+			map[string]interface{}{"__typename": "Product", "upc": "a", "name": "Chair"},
+			map[string]interface{}{"__typename": "Product", "upc": "b", "name": "Desk"},
+			map[string]interface{}{"__typename": "Product", "upc": "c", "name": "Lamp"},
+		},
+	}}, nil
+}
+
+// reviewsSubgraph 按表示返回评论，drop 指定少返回的实体数量
+func reviewsSubgraph(drop int) SubgraphStub {
+	return func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		representations, _ := request.Variables["representations"].([]interface{})
+		var entities []interface{}
+		for _, representation := range representations[:len(representations)-drop] {
+			upc := representation.(map[string]interface{})["upc"].(string)
+			entities = append(entities, map[string]interface{}{
+				"reviews": []interface{}{map[string]interface{}{"body": "review of " + upc}},
+			})
+		}
+		return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": entities}}, nil
+	}
+}
+
+func TestTestEngine_EntityListJoin(t *testing.T) {
+	config := newEntityListConfig()
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviewsSubgraph(0)})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	// 列表中的所有键合并为一次批量实体查询
+	calls := engine.Caller.CallsTo("reviews")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one batched _entities call, got %d", len(calls))
+	}
+	representations, _ := calls[0].Variables["representations"].([]interface{})
+	if len(representations) != 3 {
+		t.Fatalf("Expected 3 representations, got %v", representations)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	products, _ := data["topProducts"].([]interface{})
+	for i, upc := range []string{"a", "b", "c"} {
+		if representations[i].(map[string]interface{})["upc"] != upc {
+			t.Errorf("Representation %d: expected upc %s, got %v", i, upc, representations[i])
+		}
+		reviews, _ := products[i].(map[string]interface{})["reviews"].([]interface{})
+		if len(reviews) != 1 || reviews[0].(map[string]interface{})["body"] != "review of "+upc {
+			t.Errorf("Product %d: expected review of %s, got %v", i, upc, products[i])
+		}
+	}
+
+	// 返回的实体数量与表示不一致时不按位置错配
+	engine, err = NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviewsSubgraph(1)})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err = engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != string(errors.ErrCodeEntityResolution) {
+		t.Fatalf("Expected entity resolution error, got %+v", response.Errors)
+	}
+	data, _ = response.Data.(map[string]interface{})
+	for _, product := range data["topProducts"].([]interface{}) {
+		if _, ok := product.(map[string]interface{})["reviews"]; ok {
+			t.Errorf("Mismatched entities should not be merged, got %v", product)
+		}
+	}
+}
+
+func TestTestEngine_EntityBatchChunking(t *testing.T) {
+	config := newEntityListConfig()
+	config.EntityBatch = &federationtypes.EntityBatchConfig{MaxRepresentations: 2}
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviewsSubgraph(0)})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	// 3 个表示按上限拆分为 2 + 1 两次调用，分片并发发出，调用顺序不固定
+	calls := engine.Caller.CallsTo("reviews")
+	if len(calls) != 2 {
+		t.Fatalf("Expected two chunked _entities calls, got %d", len(calls))
+	}
+	sizes := make(map[int]int)
+	for _, call := range calls {
+		representations, _ := call.Variables["representations"].([]interface{})
+		sizes[len(representations)]++
+	}
+	if sizes[2] != 1 || sizes[1] != 1 {
+		t.Errorf("Expected chunks of 2 and 1 representations, got %v", sizes)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	for i, product := range data["topProducts"].([]interface{}) {
+		if _, ok := product.(map[string]interface{})["reviews"]; !ok {
+			t.Errorf("Product %d: expected reviews from chunked fetch, got %v", i, product)
+		}
+	}
+
+	// 按字节上限拆分，关闭拆分时返回错误且不调用子图
+	config = newEntityListConfig()
+	config.EntityBatch = &federationtypes.EntityBatchConfig{MaxRepresentationBytes: 40, DisableChunking: true}
+	engine, err = NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviewsSubgraph(0)})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err = engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != string(errors.ErrCodeEntityResolution) {
+		t.Fatalf("Expected entity resolution error, got %+v", response.Errors)
+	}
+	if calls := engine.Caller.CallsTo("reviews"); len(calls) != 0 {
+		t.Errorf("Expected no _entities call when chunking is disabled, got %d", len(calls))
+	}
+}
+
+func TestTestEngine_MultiOperationDocument(t *testing.T) {
+	config := newTestConfig()
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+		"books": StaticSubgraph(map[string]interface{}{
+			"books": []interface{}{map[string]interface{}{"isbn": "978"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	query := "query People { people { id } } query Books { books { isbn } }"
+	execute := func() (*federationtypes.GraphQLResponse, error) {
+		return engine.ExecuteQuery(&federationtypes.ExecutionContext{
+			RequestID:    "multi-operation",
+			QueryContext: &federationtypes.QueryContext{Query: query, Operation: "Books", RequestID: "multi-operation"},
+			StartTime:    time.Now(),
+			Config:       config,
+		}, &federationtypes.GraphQLRequest{Query: query, OperationName: "Books"})
+	}
+
+	// operationName 选择操作不依赖宽松解析
+	response, err := execute()
+	if err != nil {
+		t.Fatalf("ExecuteQuery() error = %v", err)
+	}
+	data, _ := response.Data.(map[string]interface{})
+	if _, ok := data["books"]; !ok || len(data) != 1 {
+		t.Errorf("Expected only the selected operation to run, got %v", data)
+	}
+	if len(engine.Caller.CallsTo("people")) != 0 {
+		t.Error("Unselected operation should not reach its subgraph")
+	}
+}
+
+// upperCaseTransformer 将所有字符串变量转为大写的自定义转换器
+type upperCaseTransformer struct{}
+
+func (upperCaseTransformer) Transform(query *federationtypes.ParsedQuery, variables map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		if text, ok := value.(string); ok {
+			value = strings.ToUpper(text)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+func TestTestEngine_VariableCoercion(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = "type Query { people(first: Int, order: Order): [Person] } type Person { id: ID! name: String } enum Order { NAME_ASC NAME_DESC }"
+	config.VariableCoercion = &federationtypes.VariableCoercionConfig{CoerceNumbers: true, NormalizeEnums: true}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	query := "query($first: Int, $order: Order) { people(first: $first, order: $order) { id } }"
+	if _, err := engine.Execute(query, map[string]interface{}{"first": "5", "order": "name_desc"}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	calls := engine.Caller.CallsTo("people")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one people call, got %d", len(calls))
+	}
+	if calls[0].Variables["first"] != int64(5) || calls[0].Variables["order"] != "NAME_DESC" {
+		t.Errorf("Expected coerced variables, got %#v", calls[0].Variables)
+	}
+
+	// 自定义转换器覆盖默认规则
+	engine.SetVariableTransformer(upperCaseTransformer{})
+	if _, err := engine.Execute(query, map[string]interface{}{"first": "5", "order": "name_desc"}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	calls = engine.Caller.CallsTo("people")
+	if calls[1].Variables["first"] != "5" || calls[1].Variables["order"] != "NAME_DESC" {
+		t.Errorf("Expected custom transformer to replace the default, got %#v", calls[1].Variables)
+	}
+}
+
+func TestTestEngine_Introspection(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = `type Query { people: [Person] } type Person { id: ID! name: String ssn: String @inaccessible }`
+	config.EnableIntrospect = true
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{}),
+		"books":  StaticSubgraph(map[string]interface{}{}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	query := `query($name: String!) {
+		__typename
+		__schema { queryType { name } types { ...TypeName } }
+		person: __type(name: $name) { name fields { name } }
+	}
+	fragment TypeName on __Type { name }`
+	response, err := engine.Execute(query, map[string]interface{}{"name": "Person"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	data := response.Data.(map[string]interface{})
+	if data["__typename"] != "Query" {
+		t.Errorf("Expected __typename Query, got %v", data["__typename"])
+	}
+
+	schema := data["__schema"].(map[string]interface{})
+	if schema["queryType"].(map[string]interface{})["name"] != "Query" {
+		t.Errorf("Unexpected queryType: %v", schema["queryType"])
+	}
+	types := make(map[string]bool)
+	for _, item := range schema["types"].([]interface{}) {
+		types[item.(map[string]interface{})["name"].(string)] = true
+	}
+	if !types["Person"] || !types["Book"] || types["_Service"] {
+		t.Errorf("Unexpected composed types: %v", types)
+	}
+
+	person := data["person"].(map[string]interface{})
+	var fields []string
+	for _, field := range person["fields"].([]interface{}) {
+		fields = append(fields, field.(map[string]interface{})["name"].(string))
+	}
+	if !reflect.DeepEqual(fields, []string{"id", "name"}) {
+		t.Errorf("Expected @inaccessible field to be hidden, got %v", fields)
+	}
+	if len(engine.Caller.CallsTo("people")) != 0 || len(engine.Caller.CallsTo("books")) != 0 {
+		t.Error("Introspection should be answered by the gateway")
+	}
+
+	sdl, err := engine.ComposedSchemaSDL()
+	if err != nil {
+		t.Fatalf("ComposedSchemaSDL() error = %v", err)
+	}
+	if !strings.Contains(sdl, "type Person {") || strings.Contains(sdl, "ssn") {
+		t.Errorf("Unexpected composed SDL:\n%s", sdl)
+	}
+
+	// 关闭内省后拒绝内省查询，SDL 导出不受影响
+	config.EnableIntrospect = false
+	if err := engine.Initialize(config); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if _, err := engine.Execute("{ __schema { queryType { name } } }", nil); err == nil {
+		t.Error("Expected introspection to be rejected when disabled")
+	}
+	if _, err := engine.ComposedSchemaSDL(); err != nil {
+		t.Errorf("ComposedSchemaSDL() error = %v", err)
+	}
+}
+
+func TestTestEngine_ServiceErrorRate(t *testing.T) {
+	config := newTestConfig()
+	config.SkipUnhealthyServices = true
+	config.ErrorRate = &federationtypes.ErrorRateConfig{Threshold: 0.5, MinRequests: 4, TripCircuit: true}
+
+	var mutex sync.Mutex
+	failures := []bool{false, true, false, true, true}
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failed := failures[0]
+			failures = failures[1:]
+			if failed {
+				return nil, stderrors.New("connection reset")
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"people": []interface{}{}}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		_, _ = engine.Execute("{ people { id } }", nil)
+	}
+	if rate := engine.GetStatus().Services["people"].ErrorRate; rate != 0.5 {
+		t.Fatalf("Expected error rate 0.5 after 2 of 4 failures, got %v", rate)
+	}
+	if rates := engine.GetMetrics()["service_error_rates"].(map[string]float64); rates["people"] != 0.5 || rates["books"] != 0 {
+		t.Errorf("Unexpected service error rates: %v", rates)
+	}
+
+	// 超过阈值后视为不健康，不再调用子图
+	_, _ = engine.Execute("{ people { id } }", nil)
+	if calls := len(engine.Caller.CallsTo("people")); calls != 4 {
+		t.Errorf("Expected tripped service not to be called, got %d calls", calls)
+	}
+}
+
+func TestTestEngine_ServiceUsage(t *testing.T) {
+	config := newTestConfig()
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+		}),
+		"books": StaticSubgraph(map[string]interface{}{
+			"books": []interface{}{map[string]interface{}{"isbn": "978-0"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	query := "{ people { id name } books { isbn } }"
+	execCtx := &federationtypes.ExecutionContext{
+		RequestID:    "usage",
+		QueryContext: &federationtypes.QueryContext{Query: query, RequestID: "usage"},
+		StartTime:    time.Now(),
+		Config:       config,
+	}
+	if _, err := engine.ExecuteQuery(execCtx, &federationtypes.GraphQLRequest{Query: query}); err != nil {
+		t.Fatalf("ExecuteQuery() error = %v", err)
+	}
+
+	usage := execCtx.ServiceUsage()
+	if len(usage) != 2 {
+		t.Fatalf("Expected usage for two services, got %+v", usage)
+	}
+	for _, service := range []string{"people", "books"} {
+		if usage[service].Calls != 1 || usage[service].RequestBytes <= 0 || usage[service].ResponseBytes <= 0 {
+			t.Errorf("Unexpected usage for %s: %+v", service, usage[service])
+		}
+	}
+
+	_, _ = engine.Execute(query, nil)
+	totals := engine.GetMetrics()["service_usage"].(map[string]federationtypes.ServiceUsage)
+	if totals["people"].Calls != 2 || totals["books"].Calls != 2 {
+		t.Errorf("Expected two calls per service in metrics, got %+v", totals)
+	}
+	if totals["people"].ResponseBytes != 2*usage["people"].ResponseBytes {
+		t.Errorf("Expected aggregated response bytes %d, got %d", 2*usage["people"].ResponseBytes, totals["people"].ResponseBytes)
+	}
+}
+
+func TestTestEngine_Traceparent(t *testing.T) {
+	config := newTestConfig()
+	config.TraceparentExtension = true
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	query := "{ people { id } books { isbn } }"
+	execute := func(headers map[string]string) (*federationtypes.GraphQLResponse, *federationtypes.ExecutionContext) {
+		execCtx := &federationtypes.ExecutionContext{
+			RequestID:    "trace",
+			QueryContext: &federationtypes.QueryContext{Query: query, RequestID: "trace", Headers: headers},
+			StartTime:    time.Now(),
+			Config:       config,
+		}
+		response, err := engine.ExecuteQuery(execCtx, &federationtypes.GraphQLRequest{Query: query})
+		if err != nil {
+			t.Fatalf("ExecuteQuery() error = %v", err)
+		}
+		return response, execCtx
+	}
+
+	// 未提供 traceparent 时生成合法的根追踪，并以子 span 传播到每个子图
+	response, execCtx := execute(nil)
+	root, ok := utils.ParseTraceparent(execCtx.QueryContext.Traceparent)
+	if !ok {
+		t.Fatalf("Expected generated traceparent to be well-formed, got %q", execCtx.QueryContext.Traceparent)
+	}
+	if response.Extensions["traceparent"] != execCtx.QueryContext.Traceparent {
+		t.Errorf("Expected traceparent in extensions, got %v", response.Extensions["traceparent"])
+	}
+
+	spans := make(map[string]bool)
+	for _, call := range engine.Caller.Calls() {
+		child, ok := utils.ParseTraceparent(call.Headers["traceparent"])
+		if !ok {
+			t.Fatalf("Expected %s call to carry a traceparent, got %q", call.Service, call.Headers["traceparent"])
+		}
+		if child.TraceID != root.TraceID || child.ParentID == root.ParentID || spans[child.ParentID] {
+			t.Errorf("Expected a distinct child span of trace %s, got %s", root.TraceID, call.Headers["traceparent"])
+		}
+		spans[child.ParentID] = true
+	}
+	if len(spans) != 2 {
+		t.Errorf("Expected two traced sub-queries, got %d", len(spans))
+	}
+
+	// 提供 traceparent 时继续该追踪，tracestate 原样转发
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	_, execCtx = execute(map[string]string{"traceparent": incoming, "tracestate": "vendor=1"})
+	if execCtx.QueryContext.Traceparent != incoming {
+		t.Errorf("Expected incoming traceparent to be kept, got %q", execCtx.QueryContext.Traceparent)
+	}
+	calls := engine.Caller.Calls()
+	for _, call := range calls[len(calls)-2:] {
+		if !strings.HasPrefix(call.Headers["traceparent"], "00-4bf92f3577b34da6a3ce929d0e0e4736-") || call.Headers["traceparent"] == incoming {
+			t.Errorf("Expected child span of the incoming trace, got %q", call.Headers["traceparent"])
+		}
+		if call.Headers["tracestate"] != "vendor=1" {
+			t.Errorf("Expected tracestate to be forwarded, got %q", call.Headers["tracestate"])
+		}
+	}
+}
+
+func TestTestEngine_ShadowTraffic(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].ShadowEndpoint = "http://people-v2/graphql"
+	config.Services[0].ShadowPercent = 25
+
+	var shadowRequests int32
+	var mu sync.Mutex
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+		}),
+		federation.ShadowServiceName("people"): func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			mu.Lock()
+			shadowRequests++
+			n := shadowRequests
+			mu.Unlock()
+
+			// 候选版本：首次调用失败，之后交替返回相同结构和多出字段的响应
+			switch {
+			case n == 1:
+				return nil, stderrors.New("candidate unavailable")
+			case n%2 == 0:
+				return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+					"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada v2"}},
+				}}, nil
+			default:
+				return &federationtypes.GraphQLResponse{Data: map[string]interface{}{
+					"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada", "email": "ada@example.com"}},
+				}}, nil
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+	}
+	for i := 0; i < 20; i++ {
+		response, err := engine.Execute("{ people { id name } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if len(response.Errors) != 0 || !reflect.DeepEqual(response.Data, want) {
+			t.Fatalf("Shadow traffic altered the response: %+v", response)
+		}
+	}
+
+	var stats federation.ShadowStats
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats = engine.GetShadowStats()["people"]
+		if stats.Matches+stats.Mismatches+stats.Failures == 5 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if stats.Calls != 5 {
+		t.Errorf("Expected 25%% of 20 sub-queries to be mirrored, got %d", stats.Calls)
+	}
+	if stats.Failures != 1 || stats.Matches != 2 || stats.Mismatches != 2 {
+		t.Errorf("Unexpected shadow comparison stats: %+v", stats)
+	}
+	if got := len(engine.Caller.CallsTo("people")); got != 20 {
+		t.Errorf("Expected 20 primary calls, got %d", got)
+	}
+}
+
+func TestTestEngine_ShadowTrafficSkipsMutations(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].Schema = "type Query { people: [Person] } type Mutation { addPerson(name: String): Person } type Person { id: ID! name: String }"
+	config.Services[0].ShadowEndpoint = "http://people-v2/graphql"
+	config.Services[0].ShadowPercent = 100
+
+	var shadowRequests atomic.Int32
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"addPerson": map[string]interface{}{"id": "1", "name": "Ada"},
+		}),
+		federation.ShadowServiceName("people"): func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			shadowRequests.Add(1)
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		response, err := engine.Execute(`mutation { addPerson(name: "Ada") { id name } }`, nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if len(response.Errors) != 0 {
+			t.Fatalf("Unexpected errors: %+v", response.Errors)
+		}
+	}
+
+	// 镜像是异步的，留出时间让误发的镜像调用完成
+	time.Sleep(50 * time.Millisecond)
+	if n := shadowRequests.Load(); n != 0 {
+		t.Errorf("Expected mutations not to be mirrored, got %d shadow calls", n)
+	}
+	if stats := engine.GetShadowStats()["people"]; stats.Calls != 0 {
+		t.Errorf("Expected no shadow calls in stats, got %+v", stats)
+	}
+}
+
+func TestTestEngine_ResponseTransformers(t *testing.T) {
+	config := newTestConfig()
+	config.EnableCaching = true
+	config.DefaultCacheMaxAge = time.Minute
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{
+				map[string]interface{}{"id": "1", "name": "Ada"},
+				map[string]interface{}{"id": "2", "name": "Grace"},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	var order []string
+	engine.AddResponseTransformer(federation.ResponseTransformerFunc(func(ctx *federationtypes.QueryContext, response *federationtypes.GraphQLResponse) error {
+		order = append(order, "count")
+		data := response.Data.(map[string]interface{})
+		data["peopleCount"] = len(data["people"].([]interface{}))
+		return nil
+	}))
+	engine.AddResponseTransformer(federation.ResponseTransformerFunc(func(ctx *federationtypes.QueryContext, response *federationtypes.GraphQLResponse) error {
+		order = append(order, "legacy")
+		data := response.Data.(map[string]interface{})
+		data["total"] = data["peopleCount"]
+		delete(data, "peopleCount")
+		return nil
+	}))
+
+	// 第二次执行命中查询缓存，转换结果不应写回缓存
+	for i := 0; i < 2; i++ {
+		response, err := engine.Execute("{ people { id name } }", nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		data := response.Data.(map[string]interface{})
+		if data["total"] != 2 || data["peopleCount"] != nil || len(data["people"].([]interface{})) != 2 {
+			t.Fatalf("Unexpected transformed data: %+v", data)
+		}
+	}
+	if got := len(engine.Caller.CallsTo("people")); got != 1 {
+		t.Errorf("Expected the second execution to hit the query cache, got %d calls", got)
+	}
+	if !reflect.DeepEqual(order, []string{"count", "legacy", "count", "legacy"}) {
+		t.Errorf("Expected transformers to run in registration order, got %v", order)
+	}
+
+	engine.AddResponseTransformer(federation.ResponseTransformerFunc(func(ctx *federationtypes.QueryContext, response *federationtypes.GraphQLResponse) error {
+		return stderrors.New("legacy client adapter failed")
+	}))
+	_, err = engine.Execute("{ people { id name } }", nil)
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeInternal {
+		t.Fatalf("Expected transformer failure to surface as internal error, got %v", err)
+	}
+}
+
+func TestTestEngine_MissingRootFieldPolicy(t *testing.T) {
+	stubs := func() map[string]SubgraphStub {
+		return map[string]SubgraphStub{
+			// 子图以 data: {} 应答，省略了请求的 people 字段
+			"people": StaticSubgraph(map[string]interface{}{}),
+			"books": StaticSubgraph(map[string]interface{}{
+				"books": []interface{}{map[string]interface{}{"isbn": "978-0"}},
+			}),
+		}
+	}
+	query := "{ people { id } books { isbn } }"
+
+	run := func(policy string) *federationtypes.GraphQLResponse {
+		t.Helper()
+		config := newTestConfig()
+		config.MissingRootFieldPolicy = policy
+		engine, err := NewTestEngine(config, stubs())
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+		response, err := engine.Execute(query, nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return response
+	}
+
+	response := run("")
+	if _, exists := response.Data.(map[string]interface{})["people"]; exists {
+		t.Errorf("Expected the default policy to leave the omitted field absent, got %+v", response.Data)
+	}
+
+	response = run("null")
+	data := response.Data.(map[string]interface{})
+	if value, exists := data["people"]; !exists || value != nil {
+		t.Errorf("Expected omitted field to be filled with null, got %+v", data)
+	}
+	if len(response.Errors) != 0 || data["books"] == nil {
+		t.Errorf("Expected other fields to be unaffected without errors, got %+v", response)
+	}
+
+	response = run("error")
+	data = response.Data.(map[string]interface{})
+	if value, exists := data["people"]; !exists || value != nil {
+		t.Errorf("Expected omitted field to be filled with null, got %+v", data)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["reason"] != "MISSING_ROOT_FIELD" ||
+		!reflect.DeepEqual(response.Errors[0].Path, []interface{}{"people"}) {
+		t.Errorf("Expected a MISSING_ROOT_FIELD error for people, got %+v", response.Errors)
+	}
+}
+
+func TestTestEngine_TraceSampling(t *testing.T) {
+	config := newTestConfig()
+	config.TraceSampling = &federationtypes.TraceSamplingConfig{Rate: 1}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("query People { people { id ...Name } } fragment Name on Person { name }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+	}
+	if len(response.Errors) != 0 || !reflect.DeepEqual(response.Data, want) {
+		t.Fatalf("Sampling altered the response: %+v", response)
+	}
+	if _, exists := response.Extensions["tracing"]; exists {
+		t.Error("Expected sampled traces not to be exposed in extensions")
+	}
+	if stats := engine.GetTraceSamplingStats(); stats.Sampled != 1 || stats.Forced != 0 {
+		t.Errorf("Unexpected trace sampling stats: %+v", stats)
+	}
+}
+
+func TestTestEngine_RequestCache(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Query { products: [Product] } type Product @key(fields: "id") { id: ID! name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "reviews",
+				Endpoint: "http://reviews/graphql",
+				Schema:   `type Product @key(fields: "id") { id: ID! reviews: [Review] } type Review { body: String }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+	subgraphs := map[string]SubgraphStub{
+		"catalog": StaticSubgraph(map[string]interface{}{
+			"featured": []interface{}{map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"}},
+			"popular":  []interface{}{map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"}},
+		}),
+		"reviews": StaticSubgraph(map[string]interface{}{
+			"_entities": []interface{}{map[string]interface{}{
+				"reviews": []interface{}{map[string]interface{}{"body": "comfortable"}},
+			}},
+		}),
+	}
+	query := "{ featured: products { name reviews { body } } popular: products { name reviews { body } } }"
+
+	engine, err := NewTestEngine(config, subgraphs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute(query, nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	for _, key := range []string{"featured", "popular"} {
+		products, _ := data[key].([]interface{})
+		if len(products) != 1 {
+			t.Fatalf("Expected one %s product, got %v", key, data[key])
+		}
+		reviews, _ := products[0].(map[string]interface{})["reviews"].([]interface{})
+		if len(reviews) != 1 {
+			t.Fatalf("Expected joined reviews for %s, got %v", key, products[0])
+		}
+	}
+
+	// 两条路径引用的同一实体只请求一次
+	if calls := engine.Caller.CallsTo("reviews"); len(calls) != 1 {
+		t.Errorf("Expected one entity fetch, got %+v", engine.Caller.Calls())
+	}
+	if hits := engine.GetMetrics()["request_cache_hits"]; hits != int64(1) {
+		t.Errorf("Expected 1 request cache hit, got %v", hits)
+	}
+
+	// 关闭后每条路径各自请求
+	config.DisableRequestCache = true
+	engine, err = NewTestEngine(config, subgraphs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	if _, err := engine.Execute(query, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if calls := engine.Caller.CallsTo("reviews"); len(calls) != 2 {
+		t.Errorf("Expected two entity fetches with the request cache disabled, got %+v", engine.Caller.Calls())
+	}
+}
+
+func TestTestEngine_IDCoercion(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Query { products: [Product] } type Product @key(fields: "id") { id: ID! name: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "reviews",
+				Endpoint: "http://reviews/graphql",
+				Schema:   `type Product @key(fields: "id") { id: ID! reviews: [Review] } type Review { body: String }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+
+	var representations []interface{}
+	subgraphs := map[string]SubgraphStub{
+		// 数字 ID 与 JSON 解码结果一致
+		"catalog": StaticSubgraph(map[string]interface{}{
+			"products": []interface{}{
+				map[string]interface{}{"__typename": "Product", "id": float64(1), "name": "Chair"},
+				map[string]interface{}{"__typename": "Product", "id": "1", "name": "Chair"},
+			},
+		}),
+		"reviews": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			representations, _ = request.Variables["representations"].([]interface{})
+			entities := make([]interface{}, len(representations))
+			for i := range representations {
+				entities[i] = map[string]interface{}{"reviews": []interface{}{map[string]interface{}{"body": "comfortable"}}}
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": entities}}, nil
+		},
+	}
+
+	engine, err := NewTestEngine(config, subgraphs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	response, err := engine.Execute("{ products { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	// 默认转换为字符串，1 与 "1" 视为同一实体
+	if len(representations) != 1 {
+		t.Fatalf("Expected one deduplicated representation, got %v", representations)
+	}
+	if id := representations[0].(map[string]interface{})["id"]; id != "1" {
+		t.Errorf("Expected string ID \"1\", got %#v", id)
+	}
+	data, _ := response.Data.(map[string]interface{})
+	for i, product := range data["products"].([]interface{}) {
+		if reviews, _ := product.(map[string]interface{})["reviews"].([]interface{}); len(reviews) != 1 {
+			t.Errorf("Product %d: expected joined reviews, got %v", i, product)
+		}
+	}
+
+	// 坚持数字 ID 的子图按 number 转换，请求变量经 JSON 往返后解码为 float64
+	config.Services[1].IDCoercion = federationtypes.IDCoercionNumber
+	engine, err = NewTestEngine(config, subgraphs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	if _, err := engine.Execute("{ products { name reviews { body } } }", nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(representations) != 1 {
+		t.Fatalf("Expected one deduplicated representation, got %v", representations)
+	}
+	if id := representations[0].(map[string]interface{})["id"]; id != float64(1) {
+		t.Errorf("Expected numeric ID 1, got %#v", id)
+	}
+}
+
+func TestTestEngine_StatusServiceFilter(t *testing.T) {
+	engine, err := NewTestEngine(newTestConfig(), map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	// 过滤与并发执行的查询同时进行，状态在锁内复制
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = engine.Execute("{ people { id } books { isbn } }", nil)
+		}()
+	}
+
+	status := engine.GetStatusFor("books")
+	wg.Wait()
+	if len(status.Services) != 1 {
+		t.Fatalf("Expected only the books service, got %+v", status.Services)
+	}
+	if _, ok := status.Services["books"]; !ok {
+		t.Errorf("Expected books status, got %+v", status.Services)
+	}
+	if all := engine.GetStatus(); len(all.Services) != 2 {
+		t.Errorf("Expected all services without a filter, got %+v", all.Services)
+	}
+
+	metrics := engine.GetMetricsFor(federation.MetricsFilter{Services: []string{"people"}})
+	if rates := metrics["service_error_rates"].(map[string]float64); len(rates) != 1 || metrics["service_usage"].(map[string]federationtypes.ServiceUsage)["people"].Calls != 4 {
+		t.Errorf("Expected people metrics only, got %v and %v", rates, metrics["service_usage"])
+	}
+
+	// 超出上限时按服务名截取并记录省略数
+	metrics = engine.GetMetricsFor(federation.MetricsFilter{MaxServices: 1})
+	rates := metrics["service_error_rates"].(map[string]float64)
+	if _, ok := rates["books"]; len(rates) != 1 || !ok || metrics["services_truncated"] != 1 {
+		t.Errorf("Expected books only with one truncated service, got %v (truncated %v)", rates, metrics["services_truncated"])
+	}
+}
+
+func TestTestEngine_DebugModeSubQueryErrorDetails(t *testing.T) {
+	execute := func(debug bool) federationtypes.GraphQLError {
+		t.Helper()
+		config := newTestConfig()
+		config.DebugMode = debug
+		config.Services[0].Schema = "type Query { people(token: String, first: Int): [Person] } type Person { id: ID! name: String }"
+		config.Services[0].DebugRedactVariables = []string{"token"}
+
+		engine, err := NewTestEngine(config, map[string]SubgraphStub{
+			"people": FailingSubgraph(stderrors.New("connection refused")),
+			"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+		})
+		if err != nil {
+			t.Fatalf("NewTestEngine() error = %v", err)
+		}
+
+		query := "query($token: String, $first: Int) { people(token: $token, first: $first) { id } books { isbn } }"
+		response, err := engine.Execute(query, map[string]interface{}{"token": "secret", "first": 2})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		for _, graphqlErr := range response.Errors {
+			if graphqlErr.Extensions["service"] == "people" {
+				return graphqlErr
+			}
+		}
+		t.Fatalf("Expected people service error, got %+v", response.Errors)
+		return federationtypes.GraphQLError{}
+	}
+
+	debugErr := execute(true)
+	subQuery, _ := debugErr.Extensions["subQuery"].(string)
+	if !strings.Contains(subQuery, "people") {
+		t.Errorf("Expected sub-query in debug error extensions, got %+v", debugErr.Extensions)
+	}
+	variables, _ := debugErr.Extensions["variables"].(map[string]interface{})
+	if variables["token"] != utils.RedactedValue || variables["first"] == nil {
+		t.Errorf("Expected redacted variables in debug error extensions, got %+v", debugErr.Extensions["variables"])
+	}
+
+	productionErr := execute(false)
+	for _, key := range []string{"subQuery", "variables"} {
+		if _, exists := productionErr.Extensions[key]; exists {
+			t.Errorf("Expected %s to be omitted in production, got %+v", key, productionErr.Extensions)
+		}
+	}
+}
+
+func TestTestEngine_BatchDuplicateOperationNames(t *testing.T) {
+	requests := []*federationtypes.GraphQLRequest{
+		{Query: "query Shelf { people { id } }", OperationName: "Shelf"},
+		{Query: "query Shelf { books { isbn } }", OperationName: "Shelf"},
+	}
+	stubs := map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{map[string]interface{}{"id": "1"}}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{map[string]interface{}{"isbn": "978-0"}}}),
+	}
+
+	// 默认拒绝整批，不调用任何子图
+	engine, err := NewTestEngine(newTestConfig(), stubs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	_, err = engine.ExecuteBatch(requests)
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeQueryValidation || fedErr.Extensions["reason"] != "DUPLICATE_OPERATION_NAME" {
+		t.Fatalf("Expected DUPLICATE_OPERATION_NAME validation error, got %v", err)
+	}
+	if calls := engine.Caller.Calls(); len(calls) != 0 {
+		t.Errorf("Expected rejected batch to make no upstream calls, got %+v", calls)
+	}
+
+	// 按下标区分时各操作独立执行
+	config := newTestConfig()
+	config.DuplicateOperationNames = federation.DuplicateOperationNamesIndex
+	engine, err = NewTestEngine(config, stubs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	responses, err := engine.ExecuteBatch(requests)
+	if err != nil {
+		t.Fatalf("ExecuteBatch() error = %v", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(responses))
+	}
+	for i, field := range []string{"people", "books"} {
+		data, _ := responses[i].Data.(map[string]interface{})
+		if len(data) != 1 || data[field] == nil {
+			t.Errorf("Expected response %d to contain only %s, got %+v", i, field, responses[i].Data)
+		}
+	}
+
+	// 带下标的操作名参与查询缓存键，重名操作不共享缓存结果
+	config.EnableCaching = true
+	config.DefaultCacheMaxAge = time.Minute
+	engine, err = NewTestEngine(config, stubs)
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	same := []*federationtypes.GraphQLRequest{requests[0], requests[0]}
+	if _, err := engine.ExecuteBatch(same); err != nil {
+		t.Fatalf("ExecuteBatch() error = %v", err)
+	}
+	if calls := engine.Caller.CallsTo("people"); len(calls) != 2 {
+		t.Errorf("Expected indexed operations to use separate cache entries, got %d calls", len(calls))
+	}
+}
+
+func TestTestEngine_SoftAndHardQueryTimeouts(t *testing.T) {
+	slowPeople := func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(800 * time.Millisecond):
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"people": []interface{}{}}}, nil
+		}
+	}
+	books := StaticSubgraph(map[string]interface{}{"books": []interface{}{map[string]interface{}{"isbn": "978-0"}}})
+
+	// 软超时到达时合并已收到的数据，慢服务的字段为 null 并附带超时错误
+	config := newTestConfig()
+	config.SoftQueryTimeout = 50 * time.Millisecond
+	config.HardQueryTimeout = 500 * time.Millisecond
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"people": slowPeople, "books": books})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	start := time.Now()
+	response, err := engine.Execute("{ people { id } books { isbn } }", nil)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if elapsed >= config.HardQueryTimeout {
+		t.Errorf("Expected partial response before hard timeout, took %s", elapsed)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	if data["books"] == nil {
+		t.Errorf("Expected books data from fast service, got %+v", response.Data)
+	}
+	if people, exists := data["people"]; !exists || people != nil {
+		t.Errorf("Expected people to be null, got %+v", response.Data)
+	}
+
+	var timeoutErr *federationtypes.GraphQLError
+	for i := range response.Errors {
+		if response.Errors[i].Extensions["reason"] == "SOFT_TIMEOUT" {
+			timeoutErr = &response.Errors[i]
+		}
+	}
+	if timeoutErr == nil || timeoutErr.Extensions["code"] != string(errors.ErrCodeTimeout) || len(timeoutErr.Path) != 1 || timeoutErr.Path[0] != "people" {
+		t.Errorf("Expected SOFT_TIMEOUT error at path people, got %+v", response.Errors)
+	}
+
+	// 仅配置硬超时时，超过硬超时的执行整体中止
+	config = newTestConfig()
+	config.HardQueryTimeout = 50 * time.Millisecond
+	engine, err = NewTestEngine(config, map[string]SubgraphStub{"people": slowPeople, "books": books})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	_, err = engine.Execute("{ people { id } books { isbn } }", nil)
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeTimeout || fedErr.Extensions["reason"] != "HARD_TIMEOUT" {
+		t.Fatalf("Expected HARD_TIMEOUT error, got %v", err)
+	}
+}
+
+func TestTestEngine_EntityJoinWithMultipleKeys(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{
+				Name:     "orders",
+				Endpoint: "http://orders/graphql",
+				Schema:   `type Query { orders: [Order] } type Order { number: Int product: Product } type Product @key(fields: "id") @key(fields: "sku") { id: ID sku: String }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "warehouse",
+				Endpoint: "http://warehouse/graphql",
+				Schema:   `type Query { shipments: [Shipment] } type Shipment { product: Product } type Product @key(fields: "sku") { sku: String! }`,
+				Timeout:  time.Second,
+			},
+			{
+				Name:     "catalog",
+				Endpoint: "http://catalog/graphql",
+				Schema:   `type Product @key(fields: "id") @key(fields: "sku") { id: ID sku: String name: String }`,
+				Timeout:  time.Second,
+			},
+		},
+		MaxQueryDepth: 10,
+		QueryTimeout:  time.Second,
+	}
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"orders": StaticSubgraph(map[string]interface{}{
+			"orders": []interface{}{
+				map[string]interface{}{"number": 1, "product": map[string]interface{}{"__typename": "Product", "id": "1", "sku": nil}},
+				map[string]interface{}{"number": 2, "product": map[string]interface{}{"__typename": "Product", "id": nil, "sku": "S2"}},
+			},
+		}),
+		"warehouse": StaticSubgraph(map[string]interface{}{
+			"shipments": []interface{}{
+				map[string]interface{}{"product": map[string]interface{}{"__typename": "Product", "sku": "S3"}},
+			},
+		}),
+		"catalog": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			representations, _ := request.Variables["representations"].([]interface{})
+			entities := make([]interface{}, len(representations))
+			for i, representation := range representations {
+				fields := representation.(map[string]interface{})
+				name := "unresolved"
+				if id, ok := fields["id"]; ok {
+					name = "product " + id.(string)
+				} else if sku, ok := fields["sku"]; ok {
+					name = "sku " + sku.(string)
+				}
+				entities[i] = map[string]interface{}{"name": name}
+			}
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"_entities": entities}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ orders { number product { name } } shipments { product { name } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", response.Errors)
+	}
+
+	// 每个引用按其实际返回的 @key 解析，id 和 sku 引用都能合并到对应的对象
+	data, _ := response.Data.(map[string]interface{})
+	productName := func(item interface{}) interface{} {
+		product, _ := item.(map[string]interface{})["product"].(map[string]interface{})
+		return product["name"]
+	}
+	orders, _ := data["orders"].([]interface{})
+	if len(orders) != 2 || productName(orders[0]) != "product 1" || productName(orders[1]) != "sku S2" {
+		t.Errorf("Expected order products resolved by id and sku, got %v", data["orders"])
+	}
+	shipments, _ := data["shipments"].([]interface{})
+	if len(shipments) != 1 || productName(shipments[0]) != "sku S3" {
+		t.Errorf("Expected shipment product resolved by sku, got %v", data["shipments"])
+	}
+
+	// 使用不同 @key 的表示分开批量调用，每次调用中的表示只包含同一组键字段
+	calls := engine.Caller.CallsTo("catalog")
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 entity fetches (id and sku for orders, sku for shipments), got %+v", calls)
+	}
+	for _, call := range calls {
+		representations, _ := call.Variables["representations"].([]interface{})
+		if len(representations) != 1 {
+			t.Errorf("Expected one representation per key group, got %v", representations)
+			continue
+		}
+		fields := representations[0].(map[string]interface{})
+		_, hasID := fields["id"]
+		_, hasSKU := fields["sku"]
+		if hasID == hasSKU {
+			t.Errorf("Expected representation keyed by exactly one of id or sku, got %v", fields)
+		}
+	}
+}
+
+func TestTestEngine_InFlightQueryLimit(t *testing.T) {
+	config := newTestConfig()
+	config.LoadShedding = &federationtypes.LoadSheddingConfig{MaxConcurrent: 2}
+
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+			started <- struct{}{}
+			<-unblock
+			return &federationtypes.GraphQLResponse{Data: map[string]interface{}{"people": []interface{}{}}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := engine.Execute("{ people { id } }", nil); err != nil {
+				t.Errorf("Expected admitted query to succeed, got %v", err)
+			}
+		}()
+	}
+	<-started
+	<-started
+
+	// 执行中的查询数在状态和指标中可见
+	if inFlight := engine.GetStatus().InFlight; inFlight != 2 {
+		t.Errorf("Expected 2 in-flight queries in status, got %d", inFlight)
+	}
+	if inFlight := engine.GetMetrics()["in_flight"]; inFlight != int64(2) {
+		t.Errorf("Expected 2 in-flight queries in metrics, got %v", inFlight)
+	}
+
+	// 达到上限后新的查询不排队，立即以 SERVICE_UNAVAILABLE 拒绝
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		_, err := engine.Execute("{ people { id } }", nil)
+		elapsed := time.Since(start)
+
+		var federationErr *errors.FederationError
+		if !stderrors.As(err, &federationErr) || federationErr.Code != errors.ErrCodeUnavailable || federationErr.Extensions["retryAfter"] != 1 {
+			t.Fatalf("Expected SERVICE_UNAVAILABLE with retryAfter, got %v", err)
+		}
+		if elapsed > 100*time.Millisecond {
+			t.Errorf("Expected excess query to be rejected quickly, took %s", elapsed)
+		}
+	}
+	if inFlight := engine.GetStatus().InFlight; inFlight != 2 {
+		t.Errorf("Expected rejected queries not to count as in-flight, got %d", inFlight)
+	}
+
+	close(unblock)
+	wg.Wait()
+	if inFlight := engine.GetStatus().InFlight; inFlight != 0 {
+		t.Errorf("Expected no in-flight queries after completion, got %d", inFlight)
+	}
+}
+
+func TestTestEngine_UndefinedFieldPolicyPrune(t *testing.T) {
+	config := newTestConfig()
+	// profiles 声明了 Person.email 但没有 @key，字段随根字段发往 people 后被删除
+	config.Services[1] = federationtypes.ServiceConfig{
+		Name:     "profiles",
+		Endpoint: "http://profiles/graphql",
+		Schema:   "type Person { id: ID! email(format: String): String }",
+		Timeout:  time.Second,
+	}
+	config.UndefinedFieldPolicy = "prune"
+
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{
+			"people": []interface{}{map[string]interface{}{"id": "1", "name": "Ada"}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("query Q($format: String) { people { id name email(format: $format) } }", map[string]interface{}{"format": "short"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// 客户端通过 extensions 得知被删除的字段
+	if pruned := response.Extensions["prunedFields"]; !reflect.DeepEqual(pruned, []string{"people:Person.email"}) {
+		t.Errorf("Expected pruned fields in extensions, got %v", response.Extensions)
+	}
+
+	calls := engine.Caller.CallsTo("people")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one people call, got %+v", engine.Caller.Calls())
+	}
+	if query := calls[0].Query; strings.Contains(query, "email") || strings.Contains(query, "$format") {
+		t.Errorf("Expected email and its variable to be pruned, got %q", query)
+	}
+	if _, exists := calls[0].Variables["format"]; exists {
+		t.Errorf("Expected unused variable value to be dropped, got %v", calls[0].Variables)
+	}
+}
+
+func TestTestEngine_SoftTimeoutCancelsEntityFetches(t *testing.T) {
+	slowReviews := func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(800 * time.Millisecond):
+			return reviewsSubgraph(0)(ctx, request)
+		}
+	}
+
+	config := newEntityListConfig()
+	config.SoftQueryTimeout = 50 * time.Millisecond
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": slowReviews})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	start := time.Now()
+	response, err := engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("Expected entity fetch to stop at the soft timeout, took %s", elapsed)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	if products, _ := data["topProducts"].([]interface{}); len(products) != 3 {
+		t.Fatalf("Expected root data to be kept, got %+v", response.Data)
+	}
+	var timeoutErr *federationtypes.GraphQLError
+	for i := range response.Errors {
+		if response.Errors[i].Extensions["reason"] == "SOFT_TIMEOUT" {
+			timeoutErr = &response.Errors[i]
+		}
+	}
+	if timeoutErr == nil || timeoutErr.Extensions["code"] != string(errors.ErrCodeTimeout) || len(timeoutErr.Path) != 2 || timeoutErr.Path[0] != "topProducts" {
+		t.Errorf("Expected SOFT_TIMEOUT error at the entity path, got %+v", response.Errors)
+	}
+}
+
+func TestTestEngine_ShadowMetricsServiceFilter(t *testing.T) {
+	config := newTestConfig()
+	config.Services[0].ShadowEndpoint = "http://people-v2/graphql"
+	config.Services[1].ShadowEndpoint = "http://books-v2/graphql"
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{
+		"people": StaticSubgraph(map[string]interface{}{"people": []interface{}{}}),
+		"books":  StaticSubgraph(map[string]interface{}{"books": []interface{}{}}),
+	})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	metrics := engine.GetMetricsFor(federation.MetricsFilter{Services: []string{"people"}})
+	shadow, _ := metrics["shadow_traffic"].(map[string]federation.ShadowStats)
+	if _, ok := shadow["people"]; len(shadow) != 1 || !ok {
+		t.Errorf("Expected people shadow metrics only, got %v", shadow)
+	}
+
+	metrics = engine.GetMetricsFor(federation.MetricsFilter{MaxServices: 1})
+	shadow, _ = metrics["shadow_traffic"].(map[string]federation.ShadowStats)
+	if _, ok := shadow["books"]; len(shadow) != 1 || !ok {
+		t.Errorf("Expected books shadow metrics only within the service cap, got %v", shadow)
+	}
+	if all := engine.GetShadowStats(); len(all) != 2 {
+		t.Errorf("Expected shadow stats for all services without a filter, got %v", all)
+	}
+}
+
+func TestNewTestEngine_DoesNotModifyConfig(t *testing.T) {
+	config := newTestConfig()
+	config.QueryTimeout = 0
+	if _, err := NewTestEngine(config, map[string]SubgraphStub{}); err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+	if config.QueryTimeout != 0 {
+		t.Errorf("Expected caller's queryTimeout to stay unset, got %s", config.QueryTimeout)
+	}
+}
+
+func TestTestEngine_EntityBatchChunksDispatchedConcurrently(t *testing.T) {
+	// 两个分片都到达后才返回，顺序执行时第一个分片会等到超时
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	reviews := func(ctx context.Context, request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLResponse, error) {
+		arrived.Done()
+		done := make(chan struct{})
+		go func() {
+			arrived.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return reviewsSubgraph(0)(ctx, request)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	config := newEntityListConfig()
+	config.QueryTimeout = 500 * time.Millisecond
+	config.EntityBatch = &federationtypes.EntityBatchConfig{MaxRepresentations: 2}
+	engine, err := NewTestEngine(config, map[string]SubgraphStub{"catalog": topProductsSubgraph, "reviews": reviews})
+	if err != nil {
+		t.Fatalf("NewTestEngine() error = %v", err)
+	}
+
+	response, err := engine.Execute("{ topProducts { name reviews { body } } }", nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("Expected both chunks to be in flight together, got %+v", response.Errors)
+	}
+	data, _ := response.Data.(map[string]interface{})
+	for i, product := range data["topProducts"].([]interface{}) {
+		if _, ok := product.(map[string]interface{})["reviews"]; !ok {
+			t.Errorf("Product %d: expected reviews from concurrent chunks, got %v", i, product)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package federation
+
+import (
+	"fmt"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// fieldBudgetTimeoutResponse 构建超出字段预算的子查询响应：对应字段为 null，并附带超时错误
+func fieldBudgetTimeoutResponse(subQuery *federationtypes.SubQuery, latency time.Duration) *federationtypes.ServiceResponse {
+	budget := subQuery.FieldBudget
+	data := make(map[string]interface{}, len(budget.ResponseKeys))
+	graphqlErrors := make([]federationtypes.GraphQLError, 0, len(budget.ResponseKeys))
+
+	for _, key := range budget.ResponseKeys {
+		data[key] = nil
+
+		timeoutErr := errors.NewTimeoutError(subQuery.ServiceName,
+			fmt.Sprintf("field %s exceeded timeout budget of %s", budget.Field, budget.Timeout),
+			errors.WithPath(key),
+			errors.WithExtension("field", budget.Field),
+			errors.WithExtension("timeoutMs", budget.Timeout.Milliseconds()),
+		)
+		graphqlErrors = append(graphqlErrors, federationtypes.GraphQLError{
+			Message:    timeoutErr.Message,
+			Path:       []interface{}{key},
+			Extensions: timeoutErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+		})
+	}
+
+	return &federationtypes.ServiceResponse{
+		Service: subQuery.ServiceName,
+		Data:    data,
+		Errors:  graphqlErrors,
+		Latency: latency,
+	}
+}
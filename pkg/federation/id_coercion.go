@@ -0,0 +1,79 @@
+package federation
+
+import (
+	"encoding/json"
+	"strconv"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// idKeyCoercion 实体查询构造表示时对 ID 类型键字段的转换
+type idKeyCoercion struct {
+	fields map[string]bool // 类型为 ID 的键字段
+	mode   string
+}
+
+// entityIDCoercion 按模式找出实体查询中类型为 ID 的键字段，并取目标服务配置的转换方式，
+// 子图对 ID 是字符串还是数字的约定不一致时，避免 1 与 "1" 导致实体匹配失败
+func (e *Engine) entityIDCoercion(fetch federationtypes.EntityFetch) idKeyCoercion {
+	coercion := idKeyCoercion{mode: federationtypes.IDCoercionString}
+	for _, service := range e.federationConfig.Services {
+		if service.Name == fetch.ServiceName && service.IDCoercion != "" {
+			coercion.mode = service.IDCoercion
+			break
+		}
+	}
+
+	fields := e.currentSchemaIndex().fields[fetch.TypeName]
+	for _, keyFields := range fetch.KeySets() {
+		for _, keyField := range keyFields {
+			if field, ok := fields[keyField]; ok && namedType(field.Type) == "ID" {
+				if coercion.fields == nil {
+					coercion.fields = make(map[string]bool)
+				}
+				coercion.fields[keyField] = true
+			}
+		}
+	}
+	return coercion
+}
+
+// apply 转换键字段的值，非 ID 字段原样返回
+func (c idKeyCoercion) apply(keyField string, value interface{}) interface{} {
+	if !c.fields[keyField] {
+		return value
+	}
+	return coerceID(value, c.mode)
+}
+
+// coerceID 按转换方式转换 ID 值，列表逐项转换；无法转换的值原样返回
+func coerceID(value interface{}, mode string) interface{} {
+	if list, ok := value.([]interface{}); ok {
+		coerced := make([]interface{}, len(list))
+		for i, item := range list {
+			coerced[i] = coerceID(item, mode)
+		}
+		return coerced
+	}
+
+	if mode == federationtypes.IDCoercionNumber {
+		if s, ok := value.(string); ok {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n
+			}
+		}
+		return value
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case json.Number:
+		return v.String()
+	}
+	return value
+}
@@ -0,0 +1,281 @@
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/asttransform"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/introspection"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// introspectionSnapshot 由组合模式生成的内省结果，组合模式变化时重新生成
+type introspectionSnapshot struct {
+	sdl    string
+	schema map[string]interface{}            // __Schema 对象
+	types  map[string]map[string]interface{} // 类型名 -> __Type 对象
+}
+
+// ComposedSchemaSDL 返回当前注册表组合出的对外模式 SDL，不含 @inaccessible 元素
+func (e *Engine) ComposedSchemaSDL() (string, error) {
+	schema, err := e.registry.GetFederatedSchema()
+	if err != nil {
+		return "", err
+	}
+	return schema.SDL, nil
+}
+
+// rootIntrospectionFields 统计操作根选择集（含片段）中的内省字段、__typename 和全部字段数量
+func rootIntrospectionFields(query *federationtypes.ParsedQuery) (introspectionFields, typenameFields, fields int) {
+	document, operationRef := findOperation(query)
+	if operationRef == -1 {
+		return 0, 0, 0
+	}
+
+	var count func(selectionSet int, visitedFragments map[string]bool)
+	count = func(selectionSet int, visitedFragments map[string]bool) {
+		for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+			selection := document.Selections[selectionRef]
+			switch selection.Kind {
+			case ast.SelectionKindField:
+				fields++
+				switch document.FieldNameString(selection.Ref) {
+				case "__schema", "__type":
+					introspectionFields++
+				case typenameField:
+					typenameFields++
+				}
+			case ast.SelectionKindInlineFragment:
+				count(document.InlineFragments[selection.Ref].SelectionSet, visitedFragments)
+			case ast.SelectionKindFragmentSpread:
+				name := document.FragmentSpreadNameString(selection.Ref)
+				if visitedFragments[name] {
+					continue
+				}
+				visitedFragments[name] = true
+				if fragmentRef, ok := document.FragmentDefinitionRef([]byte(name)); ok {
+					count(document.FragmentDefinitions[fragmentRef].SelectionSet, visitedFragments)
+				}
+			}
+		}
+	}
+	count(document.OperationDefinitions[operationRef].SelectionSet, make(map[string]bool))
+
+	return introspectionFields, typenameFields, fields
+}
+
+// isIntrospectionQuery 判断查询是否只包含内省根字段（__schema、__type、__typename）
+func isIntrospectionQuery(query *federationtypes.ParsedQuery) bool {
+	if !isQueryOperation(query) {
+		return false
+	}
+
+	introspectionFields, typenameFields, fields := rootIntrospectionFields(query)
+	return introspectionFields > 0 && introspectionFields+typenameFields == fields
+}
+
+// validateIntrospection 未启用内省时拒绝包含 __schema 或 __type 的查询
+func (e *Engine) validateIntrospection(query *federationtypes.ParsedQuery) error {
+	if e.federationConfig.EnableIntrospect {
+		return nil
+	}
+	if introspectionFields, _, _ := rootIntrospectionFields(query); introspectionFields > 0 {
+		return errors.NewQueryValidationError("introspection is disabled",
+			errors.WithExtension("reason", "INTROSPECTION_DISABLED"),
+		)
+	}
+	return nil
+}
+
+// executeIntrospection 按组合模式在网关本地应答内省查询
+func (e *Engine) executeIntrospection(query *federationtypes.ParsedQuery) (*federationtypes.GraphQLResponse, error) {
+	snapshot, err := e.introspectionSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	document, operationRef := findOperation(query)
+	root := map[string]interface{}{typenameField: rootTypeName(ast.OperationTypeQuery)}
+
+	data := make(map[string]interface{})
+	resolveIntrospectionSelections(document, document.OperationDefinitions[operationRef].SelectionSet, root, data, query.Variables, make(map[string]bool),
+		func(fieldRef int) (interface{}, bool) {
+			switch document.FieldNameString(fieldRef) {
+			case "__schema":
+				return snapshot.schema, true
+			case "__type":
+				name, _ := introspectionArgument(document, fieldRef, "name", query.Variables).(string)
+				if fieldType, ok := snapshot.types[name]; ok {
+					return fieldType, true
+				}
+				return nil, true
+			}
+			return nil, false
+		})
+
+	return &federationtypes.GraphQLResponse{Data: data}, nil
+}
+
+// introspectionSnapshot 返回当前组合模式的内省结果，模式未变化时复用
+func (e *Engine) introspectionSnapshot() (*introspectionSnapshot, error) {
+	sdl, err := e.ComposedSchemaSDL()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot := e.introspection.Load(); snapshot != nil && snapshot.sdl == sdl {
+		return snapshot, nil
+	}
+
+	definition, report := astparser.ParseGraphqlDocumentString(sdl)
+	if report.HasErrors() {
+		return nil, errors.NewSchemaError(fmt.Sprintf("failed to parse composed schema: %s", report.Error()))
+	}
+	if err := asttransform.MergeDefinitionWithBaseSchema(&definition); err != nil {
+		return nil, errors.NewSchemaError("failed to merge base schema", errors.WithCause(err))
+	}
+
+	var data introspection.Data
+	introspection.NewGenerator().Generate(&definition, &report, &data)
+	if report.HasErrors() {
+		return nil, errors.NewSchemaError(fmt.Sprintf("failed to generate introspection: %s", report.Error()))
+	}
+
+	// 转换为通用结构，便于按客户端选择集投影
+	raw, err := json.Marshal(data.Schema)
+	if err != nil {
+		return nil, errors.NewSchemaError("failed to encode introspection", errors.WithCause(err))
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, errors.NewSchemaError("failed to decode introspection", errors.WithCause(err))
+	}
+
+	snapshot := &introspectionSnapshot{
+		sdl:    sdl,
+		schema: schema,
+		types:  make(map[string]map[string]interface{}),
+	}
+	types, _ := schema["types"].([]interface{})
+	for _, item := range types {
+		if fullType, ok := item.(map[string]interface{}); ok {
+			if name, ok := fullType["name"].(string); ok {
+				snapshot.types[name] = fullType
+			}
+		}
+	}
+
+	e.introspection.Store(snapshot)
+	return snapshot, nil
+}
+
+// resolveIntrospectionSelections 将内省对象按选择集投影到 result，别名作为响应键；
+// rootField 非空时优先用于解析根字段
+func resolveIntrospectionSelections(document *ast.Document, selectionSet int, object, result map[string]interface{}, variables map[string]interface{}, visitedFragments map[string]bool, rootField func(fieldRef int) (interface{}, bool)) {
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			key := document.FieldAliasOrNameString(selection.Ref)
+			name := document.FieldNameString(selection.Ref)
+
+			var value interface{}
+			resolved := false
+			if rootField != nil {
+				value, resolved = rootField(selection.Ref)
+			}
+			if !resolved {
+				value = object[name]
+			}
+			value = filterDeprecated(document, selection.Ref, name, value, variables)
+
+			field := document.Fields[selection.Ref]
+			if field.HasSelections {
+				value = resolveIntrospectionValue(document, field.SelectionSet, value, variables)
+			}
+			result[key] = value
+
+		case ast.SelectionKindInlineFragment:
+			condition := document.InlineFragmentTypeConditionNameString(selection.Ref)
+			if condition == "" || condition == object[typenameField] {
+				resolveIntrospectionSelections(document, document.InlineFragments[selection.Ref].SelectionSet, object, result, variables, visitedFragments, rootField)
+			}
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			fragmentRef, ok := document.FragmentDefinitionRef([]byte(name))
+			if !ok || document.FragmentDefinitionTypeNameString(fragmentRef) != object[typenameField] {
+				continue
+			}
+			visitedFragments[name] = true
+			resolveIntrospectionSelections(document, document.FragmentDefinitions[fragmentRef].SelectionSet, object, result, variables, visitedFragments, rootField)
+			delete(visitedFragments, name)
+		}
+	}
+}
+
+// resolveIntrospectionValue 投影对象或对象列表，其余值原样返回
+func resolveIntrospectionValue(document *ast.Document, selectionSet int, value interface{}, variables map[string]interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		resolveIntrospectionSelections(document, selectionSet, typed, result, variables, make(map[string]bool), nil)
+		return result
+	case []interface{}:
+		items := make([]interface{}, len(typed))
+		for i, item := range typed {
+			items[i] = resolveIntrospectionValue(document, selectionSet, item, variables)
+		}
+		return items
+	}
+	return value
+}
+
+// filterDeprecated 未传 includeDeprecated: true 时去掉已废弃的字段和枚举值
+func filterDeprecated(document *ast.Document, fieldRef int, name string, value interface{}, variables map[string]interface{}) interface{} {
+	if name != "fields" && name != "enumValues" {
+		return value
+	}
+	if include, _ := introspectionArgument(document, fieldRef, "includeDeprecated", variables).(bool); include {
+		return value
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	filtered := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok && object["isDeprecated"] == true {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// introspectionArgument 读取字段的字符串或布尔参数，支持变量引用
+func introspectionArgument(document *ast.Document, fieldRef int, name string, variables map[string]interface{}) interface{} {
+	argumentRef, ok := document.FieldArgument(fieldRef, []byte(name))
+	if !ok {
+		return nil
+	}
+
+	value := document.ArgumentValue(argumentRef)
+	switch value.Kind {
+	case ast.ValueKindString:
+		return document.StringValueContentString(value.Ref)
+	case ast.ValueKindBoolean:
+		return bool(document.BooleanValue(value.Ref))
+	case ast.ValueKindVariable:
+		return variables[document.VariableValueNameString(value.Ref)]
+	}
+	return nil
+}
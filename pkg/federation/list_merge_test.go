@@ -0,0 +1,84 @@
+package federation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_ListMergePolicyFromConfig(t *testing.T) {
+	newResponses := func() []*federationtypes.ServiceResponse {
+		return []*federationtypes.ServiceResponse{
+			{Service: "accounts", Data: map[string]interface{}{"users": []interface{}{
+				map[string]interface{}{"id": "1", "name": "Alice"},
+				map[string]interface{}{"id": "2", "name": "Bob"},
+			}}},
+			{Service: "reviews", Data: map[string]interface{}{"users": []interface{}{
+				map[string]interface{}{"id": "2", "rating": 3.0},
+				map[string]interface{}{"id": "1", "rating": 5.0},
+			}}},
+		}
+	}
+	plan := &federationtypes.ExecutionPlan{MergeStrategy: federationtypes.MergeStrategyDeep}
+
+	tests := []struct {
+		name      string
+		configure func(*federationtypes.FederationConfig)
+		expected  int
+	}{
+		{name: "default concat", configure: func(c *federationtypes.FederationConfig) {}, expected: 4},
+		{name: "unionByKey", configure: func(c *federationtypes.FederationConfig) {
+			c.ListMergePolicy = "unionByKey"
+			c.ListMergeKeys = []string{"id"}
+		}, expected: 2},
+		{name: "zipByIndex path override", configure: func(c *federationtypes.FederationConfig) {
+			c.ListMergePaths = map[string]string{"users": "zipByIndex"}
+		}, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &federationtypes.FederationConfig{
+				Services: []federationtypes.ServiceConfig{
+					{Name: "accounts", Endpoint: "http://accounts/graphql", Schema: "type Query { users: [User] } type User { id: ID! name: String }", Timeout: time.Second},
+				},
+				QueryTimeout: time.Second,
+			}
+			tt.configure(config)
+
+			engine, err := NewEngineWithCaller(config, &listCaller{}, utils.NewLogger("test"))
+			if err != nil {
+				t.Fatalf("NewEngineWithCaller() error = %v", err)
+			}
+
+			response, err := engine.merger.MergeResponses(context.Background(), newResponses(), plan)
+			if err != nil {
+				t.Fatalf("MergeResponses() error = %v", err)
+			}
+			users, _ := response.Data.(map[string]interface{})["users"].([]interface{})
+			if len(users) != tt.expected {
+				t.Fatalf("Expected %d users, got %d: %v", tt.expected, len(users), users)
+			}
+		})
+	}
+
+	// unionByKey 按键合并同一用户在两个服务中的字段，与元素顺序无关
+	config := &federationtypes.FederationConfig{ListMergePolicy: "unionByKey", ListMergeKeys: []string{"id"}, QueryTimeout: time.Second}
+	engine, err := NewEngineWithCaller(config, &listCaller{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+	response, err := engine.merger.MergeResponses(context.Background(), newResponses(), plan)
+	if err != nil {
+		t.Fatalf("MergeResponses() error = %v", err)
+	}
+	for _, item := range response.Data.(map[string]interface{})["users"].([]interface{}) {
+		user := item.(map[string]interface{})
+		if (user["id"] == "1" && (user["name"] != "Alice" || user["rating"] != 5.0)) || (user["id"] == "2" && (user["name"] != "Bob" || user["rating"] != 3.0)) {
+			t.Errorf("Expected fields merged by key, got %v", user)
+		}
+	}
+}
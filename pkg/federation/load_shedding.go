@@ -0,0 +1,133 @@
+package federation
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// DefaultLoadSheddingRetryAfter 拒绝过载请求时默认建议客户端等待的时间
+const DefaultLoadSheddingRetryAfter = time.Second
+
+// LoadSheddingStats 过载保护统计
+type LoadSheddingStats struct {
+	MaxConcurrent int   `json:"maxConcurrent"`
+	InFlight      int   `json:"inFlight"`
+	Queued        int64 `json:"queued"`
+	Shed          int64 `json:"shed"`
+}
+
+// loadShedder 限制同时执行的查询数，超出时按策略排队或直接拒绝
+type loadShedder struct {
+	slots        chan struct{} // 执行中的查询，容量为 MaxConcurrent
+	policy       string
+	queueDepth   int64
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+
+	queued atomic.Int64
+	shed   atomic.Int64
+}
+
+// newLoadShedder 按配置创建过载保护，未配置时返回 nil。排队超时默认使用查询超时
+func newLoadShedder(config *federationtypes.LoadSheddingConfig, queryTimeout time.Duration) *loadShedder {
+	if config == nil || config.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	policy := config.Policy
+	if policy == "" {
+		policy = federationtypes.LoadSheddingShed
+	}
+	queueTimeout := config.QueueTimeout
+	if queueTimeout <= 0 {
+		queueTimeout = queryTimeout
+	}
+	retryAfter := config.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultLoadSheddingRetryAfter
+	}
+
+	return &loadShedder{
+		slots:        make(chan struct{}, config.MaxConcurrent),
+		policy:       policy,
+		queueDepth:   int64(config.QueueDepth),
+		queueTimeout: queueTimeout,
+		retryAfter:   retryAfter,
+	}
+}
+
+// acquire 占用执行名额，返回释放函数。shed 策略下排队数达到上限时立即拒绝；
+// 排队的请求最多等待 queueTimeout，超时同样拒绝
+func (s *loadShedder) acquire() (func(), error) {
+	release := func() { <-s.slots }
+
+	select {
+	case s.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if queued := s.queued.Add(1); s.policy == federationtypes.LoadSheddingShed && queued > s.queueDepth {
+		s.queued.Add(-1)
+		return nil, s.reject("concurrency limit reached and queue is full")
+	}
+	defer s.queued.Add(-1)
+
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, s.reject(fmt.Sprintf("no execution slot became available within %s", s.queueTimeout))
+	}
+}
+
+// reject 记录并返回过载错误，extensions.retryAfter 为建议的重试等待秒数
+func (s *loadShedder) reject(message string) error {
+	s.shed.Add(1)
+
+	seconds := int((s.retryAfter + time.Second - 1) / time.Second)
+	return errors.NewFederationError(errors.ErrCodeUnavailable, "gateway overloaded: "+message,
+		errors.WithExtension("reason", "OVERLOADED"),
+		errors.WithExtension("retryAfter", seconds),
+	)
+}
+
+// stats 返回过载保护统计
+func (s *loadShedder) stats() LoadSheddingStats {
+	return LoadSheddingStats{
+		MaxConcurrent: cap(s.slots),
+		InFlight:      len(s.slots),
+		Queued:        s.queued.Load(),
+		Shed:          s.shed.Load(),
+	}
+}
+
+// configureLoadShedding 按配置替换过载保护，执行中的查询在旧实例上释放名额
+func (e *Engine) configureLoadShedding(config *federationtypes.FederationConfig) {
+	e.loadShedder.Store(newLoadShedder(config.LoadShedding, config.QueryTimeout))
+}
+
+// admitQuery 申请执行名额，未配置过载保护时直接放行
+func (e *Engine) admitQuery() (func(), error) {
+	shedder := e.loadShedder.Load()
+	if shedder == nil {
+		return func() {}, nil
+	}
+	return shedder.acquire()
+}
+
+// GetLoadSheddingStats 获取过载保护统计，未启用时返回零值
+func (e *Engine) GetLoadSheddingStats() LoadSheddingStats {
+	shedder := e.loadShedder.Load()
+	if shedder == nil {
+		return LoadSheddingStats{}
+	}
+	return shedder.stats()
+}
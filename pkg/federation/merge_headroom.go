@@ -0,0 +1,31 @@
+package federation
+
+import (
+	"context"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// reserveMergeHeadroom 按 MergeHeadroom 为响应合并预留查询超时的一部分：截止时间从请求开始时间
+// （execCtx.StartTime）算起，解析和规划耗费的时间同样计入查询超时。返回的 fetchCtx 截止时间
+// 只覆盖查询超时的其余部分，供上游调用使用；mergeCtx 截止于整个查询超时，供合并使用。
+// 未配置预留比例时两者都是原上下文
+func (e *Engine) reserveMergeHeadroom(ctx context.Context, execCtx *federationtypes.ExecutionContext) (context.Context, context.Context, context.CancelFunc) {
+	headroom := e.federationConfig.MergeHeadroom
+	budget := execCtx.Config.QueryTimeout
+	if headroom <= 0 || headroom >= 1 || budget <= 0 {
+		return ctx, ctx, func() {}
+	}
+
+	start := execCtx.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	mergeCtx, cancelMerge := context.WithDeadline(ctx, start.Add(budget))
+	fetchCtx, cancelFetch := context.WithDeadline(mergeCtx, start.Add(time.Duration(float64(budget)*(1-headroom))))
+	return fetchCtx, mergeCtx, func() {
+		cancelFetch()
+		cancelMerge()
+	}
+}
@@ -0,0 +1,122 @@
+package federation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// listCaller 立即返回每个服务根字段下的大列表
+type listCaller struct {
+	size int
+}
+
+func (c *listCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	items := make([]interface{}, c.size)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i}
+	}
+	return &federationtypes.ServiceResponse{Service: call.Service.Name, Data: map[string]interface{}{call.Service.Name: items}}, nil
+}
+
+func (c *listCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	responses := make([]*federationtypes.ServiceResponse, len(calls))
+	for i, call := range calls {
+		responses[i], _ = c.Call(ctx, call)
+	}
+	return responses, nil
+}
+
+func (c *listCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	return true
+}
+
+// slowMerger 模拟耗尽预留时间的合并：等到合并截止时间过后再开始合并
+type slowMerger struct {
+	federationtypes.ResponseMerger
+	hadDeadline bool
+}
+
+func (m *slowMerger) MergeResponses(ctx context.Context, responses []*federationtypes.ServiceResponse, plan *federationtypes.ExecutionPlan) (*federationtypes.GraphQLResponse, error) {
+	_, m.hadDeadline = ctx.Deadline()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+	return m.ResponseMerger.MergeResponses(ctx, responses, plan)
+}
+
+func TestEngine_MergeHeadroomReturnsPartialData(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "people", Endpoint: "http://people/graphql", Schema: "type Query { people: [Person] } type Person { id: ID! }", Timeout: time.Second},
+			{Name: "books", Endpoint: "http://books/graphql", Schema: "type Query { books: [Book] } type Book { id: ID! }", Timeout: time.Second},
+		},
+		QueryTimeout:  200 * time.Millisecond,
+		MergeHeadroom: 0.2,
+	}
+	engine, err := NewEngineWithCaller(config, &listCaller{size: 200}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+	merger := &slowMerger{ResponseMerger: engine.merger}
+	engine.merger = merger
+
+	query := "{ people { id } books { id } }"
+	execCtx := &federationtypes.ExecutionContext{
+		RequestID:    "headroom",
+		QueryContext: &federationtypes.QueryContext{Query: query, RequestID: "headroom"},
+		StartTime:    time.Now(),
+		Config:       config,
+	}
+	response, err := engine.ExecuteQuery(execCtx, &federationtypes.GraphQLRequest{Query: query})
+	if err != nil {
+		t.Fatalf("ExecuteQuery() error = %v", err)
+	}
+	if !merger.hadDeadline {
+		t.Error("Expected merging to run under the reserved deadline")
+	}
+
+	// 先合并的服务数据保留，其余服务的数据在截止时间后跳过
+	data, _ := response.Data.(map[string]interface{})
+	if len(data) != 1 {
+		t.Fatalf("Expected data from exactly one service, got %v fields", len(data))
+	}
+	for field, value := range data {
+		if items, _ := value.([]interface{}); len(items) != 200 {
+			t.Errorf("Expected %s data to be kept, got %d items", field, len(items))
+		}
+	}
+
+	var skipped []string
+	for _, graphqlErr := range response.Errors {
+		if graphqlErr.Extensions["reason"] == "MERGE_TIMEOUT" {
+			skipped, _ = graphqlErr.Extensions["skippedServices"].([]string)
+		}
+	}
+	if len(skipped) != 1 || data[skipped[0]] != nil {
+		t.Errorf("Expected MERGE_TIMEOUT error naming the skipped service, got %+v", response.Errors)
+	}
+}
+
+func TestEngine_MergeHeadroomCountsFromRequestStart(t *testing.T) {
+	config := &federationtypes.FederationConfig{QueryTimeout: time.Second, MergeHeadroom: 0.2}
+	engine := &Engine{federationConfig: config}
+
+	start := time.Now().Add(-500 * time.Millisecond)
+	execCtx := &federationtypes.ExecutionContext{StartTime: start, Config: config}
+	fetchCtx, mergeCtx, cancel := engine.reserveMergeHeadroom(context.Background(), execCtx)
+	defer cancel()
+
+	fetchDeadline, _ := fetchCtx.Deadline()
+	mergeDeadline, _ := mergeCtx.Deadline()
+	if !fetchDeadline.Equal(start.Add(800 * time.Millisecond)) {
+		t.Errorf("Expected fetch deadline 800ms after request start, got %v", fetchDeadline.Sub(start))
+	}
+	if !mergeDeadline.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected merge deadline at query timeout after request start, got %v", mergeDeadline.Sub(start))
+	}
+}
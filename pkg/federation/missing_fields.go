@@ -0,0 +1,78 @@
+package federation
+
+import (
+	"fmt"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/planner"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 子图成功响应缺少所请求根字段时的处理策略
+const (
+	missingRootFieldIgnore = "ignore" // 不处理，字段不出现在合并结果中
+	missingRootFieldNull   = "null"   // 补 null 并记录警告
+	missingRootFieldError  = "error"  // 补 null 并附带字段错误
+)
+
+// fillMissingRootFields 检查成功的子查询响应是否包含子查询请求的全部根字段，
+// 缺失的字段按 MissingRootFieldPolicy 补 null，使响应结构与请求一致
+func (e *Engine) fillMissingRootFields(subQuery *federationtypes.SubQuery, response *federationtypes.ServiceResponse) {
+	policy := e.federationConfig.MissingRootFieldPolicy
+	if policy == "" || policy == missingRootFieldIgnore || response == nil || response.Error != nil {
+		return
+	}
+
+	// data 为 null 且带有错误时由子图错误说明原因
+	data, isMap := response.Data.(map[string]interface{})
+	if !isMap && (response.Data != nil || len(response.Errors) > 0) {
+		return
+	}
+
+	var missing []string
+	for _, key := range subQueryRootKeys(subQuery) {
+		if _, exists := data[key]; !exists {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	// 响应数据可能被调用方复用，补齐时复制根对象
+	filled := make(map[string]interface{}, len(data)+len(missing))
+	for key, value := range data {
+		filled[key] = value
+	}
+
+	for _, key := range missing {
+		filled[key] = nil
+		e.logger.Warn("Subgraph response is missing requested root field",
+			"service", subQuery.ServiceName,
+			"field", key,
+			"policy", policy,
+		)
+
+		if policy == missingRootFieldError {
+			response.Errors = append(response.Errors, federationtypes.GraphQLError{
+				Message: fmt.Sprintf("service %s did not return requested field %s", subQuery.ServiceName, key),
+				Path:    []interface{}{key},
+				Extensions: map[string]interface{}{
+					"code":    string(errors.ErrCodeServiceCall),
+					"service": subQuery.ServiceName,
+					"reason":  "MISSING_ROOT_FIELD",
+				},
+			})
+		}
+	}
+	response.Data = filled
+}
+
+// subQueryRootKeys 返回子查询请求的根字段响应键，优先使用规划器记录的结果，
+// 未记录时按子查询的操作名解析查询文本
+func subQueryRootKeys(subQuery *federationtypes.SubQuery) []string {
+	if subQuery.RootKeys != nil {
+		return subQuery.RootKeys
+	}
+	return planner.RootResponseKeys(subQuery.Query, subQuery.OperationName)
+}
@@ -0,0 +1,25 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+func TestSubQueryRootKeys(t *testing.T) {
+	// 优先使用规划器记录的根字段，不再解析查询文本
+	planned := &federationtypes.SubQuery{Query: "{ broken", RootKeys: []string{"me"}}
+	if keys := subQueryRootKeys(planned); !reflect.DeepEqual(keys, []string{"me"}) {
+		t.Errorf("Expected planned root keys to be reused, got %v", keys)
+	}
+
+	// 未记录时按操作名选择操作
+	subQuery := &federationtypes.SubQuery{
+		Query:         "query A { users { id } } query B { books { isbn } }",
+		OperationName: "B",
+	}
+	if keys := subQueryRootKeys(subQuery); !reflect.DeepEqual(keys, []string{"books"}) {
+		t.Errorf("Expected root keys of the named operation, got %v", keys)
+	}
+}
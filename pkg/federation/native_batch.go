@@ -0,0 +1,155 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// nativeBatchGroups 找出可以作为子图原生批量请求发送的子查询：目标服务开启 SupportsBatching，
+// 是 query 操作，且没有单独的字段超时预算。同一服务至少两个子查询时成组，返回各组的下标和成组的下标集合
+func (e *Engine) nativeBatchGroups(subQueries []federationtypes.SubQuery) ([][]int, map[int]bool) {
+	supportsBatching := make(map[string]bool)
+	for _, service := range e.federationConfig.Services {
+		if service.SupportsBatching {
+			supportsBatching[service.Name] = true
+		}
+	}
+	if len(supportsBatching) == 0 {
+		return nil, nil
+	}
+
+	var order []string
+	candidates := make(map[string][]int)
+	for i, sq := range subQueries {
+		if !supportsBatching[sq.ServiceName] || sq.FieldBudget != nil || operationType(sq.Query) != "query" {
+			continue
+		}
+		if _, exists := candidates[sq.ServiceName]; !exists {
+			order = append(order, sq.ServiceName)
+		}
+		candidates[sq.ServiceName] = append(candidates[sq.ServiceName], i)
+	}
+
+	var groups [][]int
+	batched := make(map[int]bool)
+	for _, service := range order {
+		if indexes := candidates[service]; len(indexes) >= 2 {
+			groups = append(groups, indexes)
+			for _, index := range indexes {
+				batched[index] = true
+			}
+		}
+	}
+	return groups, batched
+}
+
+// executeNativeBatch 通过一次 CallBatch 执行同一服务的一组子查询，再逐个转换为子查询响应。
+// 与本请求中已发出的调用或本批次中靠前的子查询相同的子查询复用其结果，不重复发送。
+// 服务健康只按一次调用记录，用量和影子流量按子查询分别记录
+func (e *Engine) executeNativeBatch(queryCtx context.Context, execCtx *federationtypes.ExecutionContext, subQueries []federationtypes.SubQuery, indexes []int, responseCh chan<- subQueryResult, errCh chan<- error) {
+	var runs []*subQueryRun
+	var runIndexes []int
+	for _, index := range indexes {
+		run, err := e.prepareSubQuery(queryCtx, execCtx, index, subQueries[index])
+		if err != nil {
+			errCh <- err
+			continue
+		}
+		if run.call == nil {
+			responseCh <- subQueryResult{index, run.response}
+			continue
+		}
+		runs = append(runs, run)
+		runIndexes = append(runIndexes, index)
+	}
+	if len(runs) == 0 {
+		return
+	}
+
+	// 按请求内去重缓存分出需要发送的子查询和复用结果的子查询
+	var sent []*subQueryRun
+	var sentFetches []*federationtypes.RequestFetch
+	reused := make(map[*subQueryRun]*federationtypes.RequestFetch)
+	batchFetches := make(map[string]*federationtypes.RequestFetch)
+	for _, run := range runs {
+		key, ok := e.requestCacheKey(&run.sq)
+		if !ok {
+			sent = append(sent, run)
+			sentFetches = append(sentFetches, nil)
+			continue
+		}
+		if fetch, exists := batchFetches[key]; exists {
+			reused[run] = fetch
+			continue
+		}
+		fetch, owner := execCtx.LoadOrStartFetch(key)
+		if !owner {
+			reused[run] = fetch
+			continue
+		}
+		batchFetches[key] = fetch
+		sent = append(sent, run)
+		sentFetches = append(sentFetches, fetch)
+	}
+
+	e.sendNativeBatch(queryCtx, sent)
+	for i, run := range sent {
+		if sentFetches[i] != nil {
+			// 保存副本，调用方随后修改自己的响应不影响复用者
+			sentFetches[i].Complete(cloneServiceResponse(run.response), run.err)
+		}
+	}
+
+	for _, run := range runs {
+		fetch, ok := reused[run]
+		if !ok {
+			continue
+		}
+		select {
+		case <-fetch.Done():
+			run.response, run.err = cloneServiceResponse(fetch.Response), fetch.Err
+		case <-queryCtx.Done():
+			run.err = queryCtx.Err()
+		}
+		run.shared = true
+		e.requestCacheHits.Add(1)
+	}
+
+	for i, run := range runs {
+		e.finishSubQuery(execCtx, run)
+		responseCh <- subQueryResult{runIndexes[i], run.response}
+	}
+}
+
+// sendNativeBatch 发送去重后的子查询，只剩一个时单独调用。批量请求是一次 HTTP 调用：
+// 调用器的 TotalCalls 只计一次，不做对冲，重试次数取第一个子查询
+func (e *Engine) sendNativeBatch(ctx context.Context, runs []*subQueryRun) {
+	switch len(runs) {
+	case 0:
+		return
+	case 1:
+		runs[0].response, runs[0].err = e.caller.Call(ctx, runs[0].call)
+		return
+	}
+
+	calls := make([]*federationtypes.ServiceCall, len(runs))
+	for i, run := range runs {
+		calls[i] = run.call
+	}
+
+	e.logger.Debug("Executing sub-queries as native batch", "service", calls[0].Service.Name, "count", len(calls))
+	responses, err := e.caller.CallBatch(ctx, calls)
+	for i, run := range runs {
+		switch {
+		case i < len(responses) && responses[i] != nil:
+			run.response = responses[i]
+		case err != nil:
+			run.err = err
+		default:
+			run.err = fmt.Errorf("native batch returned no response for sub-query %d", i)
+		}
+		run.batched = i > 0
+	}
+}
@@ -0,0 +1,163 @@
+package federation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// batchRecordingCaller 记录单个调用和批量调用
+type batchRecordingCaller struct {
+	mutex   sync.Mutex
+	calls   []string
+	batches [][]string
+}
+
+func (c *batchRecordingCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	c.mutex.Lock()
+	c.calls = append(c.calls, call.Service.Name)
+	c.mutex.Unlock()
+	return &federationtypes.ServiceResponse{Service: call.Service.Name, Data: map[string]interface{}{"query": call.SubQuery.Query}}, nil
+}
+
+func (c *batchRecordingCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	queries := make([]string, len(calls))
+	responses := make([]*federationtypes.ServiceResponse, len(calls))
+	for i, call := range calls {
+		queries[i] = call.SubQuery.Query
+		responses[i] = &federationtypes.ServiceResponse{Service: call.Service.Name, Data: map[string]interface{}{"query": call.SubQuery.Query}}
+	}
+
+	c.mutex.Lock()
+	c.batches = append(c.batches, queries)
+	c.mutex.Unlock()
+	return responses, nil
+}
+
+func (c *batchRecordingCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	return true
+}
+
+func TestEngine_NativeBatchSubQueries(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "products", Endpoint: "http://products/graphql", Schema: "type Query { product: String top: String }", Timeout: time.Second, SupportsBatching: true},
+			{Name: "reviews", Endpoint: "http://reviews/graphql", Schema: "type Query { review: String latest: String }", Timeout: time.Second},
+		},
+		QueryTimeout: time.Second,
+	}
+	caller := &batchRecordingCaller{}
+	engine, err := NewEngineWithCaller(config, caller, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	subQueries := []federationtypes.SubQuery{
+		{ServiceName: "products", Query: "query { product }"},
+		{ServiceName: "reviews", Query: "query { review }"},
+		{ServiceName: "products", Query: "query { top }"},
+		{ServiceName: "reviews", Query: "query { latest }"},
+	}
+	execCtx := &federationtypes.ExecutionContext{RequestID: "batch", Config: config, StartTime: time.Now()}
+	responses, err := engine.executeSubQueries(context.Background(), subQueries, execCtx)
+	if err != nil {
+		t.Fatalf("executeSubQueries() error = %v", err)
+	}
+
+	// 支持批量请求的服务合并为一次调用，其余服务单独调用
+	if len(caller.batches) != 1 || len(caller.batches[0]) != 2 || caller.batches[0][0] != "query { product }" || caller.batches[0][1] != "query { top }" {
+		t.Errorf("Expected one products batch in plan order, got %v", caller.batches)
+	}
+	if len(caller.calls) != 2 || caller.calls[0] != "reviews" || caller.calls[1] != "reviews" {
+		t.Errorf("Expected individual reviews calls, got %v", caller.calls)
+	}
+
+	// 批量响应按下标拆回各子查询
+	for i, sq := range subQueries {
+		if data, _ := responses[i].Data.(map[string]interface{}); data["query"] != sq.Query {
+			t.Errorf("Sub-query %d: expected response for %q, got %v", i, sq.Query, responses[i].Data)
+		}
+	}
+
+	// 关闭后逐个调用
+	config.Services[0].SupportsBatching = false
+	caller.batches, caller.calls = nil, nil
+	execCtx = &federationtypes.ExecutionContext{RequestID: "individual", Config: config, StartTime: time.Now()}
+	if _, err := engine.executeSubQueries(context.Background(), subQueries, execCtx); err != nil {
+		t.Fatalf("executeSubQueries() error = %v", err)
+	}
+	if len(caller.batches) != 0 || len(caller.calls) != 4 {
+		t.Errorf("Expected individual calls without batching, got %d batches and %d calls", len(caller.batches), len(caller.calls))
+	}
+}
+
+func TestEngine_NativeBatchGroups_SkipsNonQueries(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "products", Endpoint: "http://products/graphql", Schema: "type Query { product: String }", Timeout: time.Second, SupportsBatching: true},
+		},
+		QueryTimeout: time.Second,
+	}
+	engine, err := NewEngineWithCaller(config, &batchRecordingCaller{}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	// 前导注释后的 mutation 同样不参与批量请求和请求内去重
+	subQueries := []federationtypes.SubQuery{
+		{ServiceName: "products", Query: "# audit\nmutation { restock }"},
+		{ServiceName: "products", Query: "{ product }"},
+		{ServiceName: "products", Query: "query { product }"},
+	}
+	_, batched := engine.nativeBatchGroups(subQueries)
+	if batched[0] || !batched[1] || !batched[2] {
+		t.Errorf("Expected only the query sub-queries to be batched, got %v", batched)
+	}
+	if _, ok := engine.requestCacheKey(&subQueries[0]); ok {
+		t.Error("Expected mutation with a leading comment not to be cached")
+	}
+}
+
+func TestEngine_NativeBatchDeduplicatesAndRecordsUsage(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		Services: []federationtypes.ServiceConfig{
+			{Name: "products", Endpoint: "http://products/graphql", Schema: "type Query { product: String top: String }", Timeout: time.Second, SupportsBatching: true},
+		},
+		QueryTimeout: time.Second,
+	}
+	caller := &batchRecordingCaller{}
+	engine, err := NewEngineWithCaller(config, caller, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngineWithCaller() error = %v", err)
+	}
+
+	subQueries := []federationtypes.SubQuery{
+		{ServiceName: "products", Query: "query { product }"},
+		{ServiceName: "products", Query: "query { top }"},
+		{ServiceName: "products", Query: "query { product }"},
+	}
+	execCtx := &federationtypes.ExecutionContext{RequestID: "dedup", Config: config, StartTime: time.Now()}
+	responses, err := engine.executeSubQueries(context.Background(), subQueries, execCtx)
+	if err != nil {
+		t.Fatalf("executeSubQueries() error = %v", err)
+	}
+
+	// 相同的子查询只发送一次，结果复用
+	if len(caller.batches) != 1 || len(caller.batches[0]) != 2 {
+		t.Fatalf("Expected a deduplicated batch of 2 operations, got %v", caller.batches)
+	}
+	for i, sq := range subQueries {
+		if data, _ := responses[i].Data.(map[string]interface{}); data["query"] != sq.Query {
+			t.Errorf("Sub-query %d: expected response for %q, got %v", i, sq.Query, responses[i].Data)
+		}
+	}
+
+	// 实际发送的每个操作都计入用量
+	if usage := execCtx.ServiceUsage()["products"]; usage.Calls != 2 {
+		t.Errorf("Expected usage for both sent operations, got %+v", usage)
+	}
+}
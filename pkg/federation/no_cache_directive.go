@@ -0,0 +1,51 @@
+package federation
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// noCacheDirective 操作级指令 @noCache，本次请求绕过查询结果缓存和并发查询合并，
+// 用于一次性令牌等不应被复用的敏感读取
+const noCacheDirective = "noCache"
+
+// parseNoCacheDirective 判断所执行的操作是否带 @noCache，用在操作以外的位置时返回验证错误
+func parseNoCacheDirective(query *federationtypes.ParsedQuery) (bool, error) {
+	document, operationRef := findOperation(query)
+	if document == nil {
+		return false, nil
+	}
+
+	operationDirectives := make(map[int]bool)
+	for i := range document.OperationDefinitions {
+		for _, ref := range document.OperationDefinitions[i].Directives.Refs {
+			operationDirectives[ref] = true
+		}
+	}
+	for ref := range document.Directives {
+		if document.DirectiveNameString(ref) == noCacheDirective && !operationDirectives[ref] {
+			return false, noCacheDirectiveError(document, ref, "directive @noCache is only allowed on operations")
+		}
+	}
+
+	if operationRef == -1 {
+		return false, nil
+	}
+	for _, ref := range document.OperationDefinitions[operationRef].Directives.Refs {
+		if document.DirectiveNameString(ref) == noCacheDirective {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// noCacheDirectiveError 构建 @noCache 指令的验证错误
+func noCacheDirectiveError(document *ast.Document, ref int, message string) error {
+	at := document.Directives[ref].At
+	return errors.NewQueryValidationError(message,
+		errors.WithLocation(int(at.LineStart), int(at.CharStart)),
+		errors.WithExtension("directive", noCacheDirective),
+	)
+}
@@ -0,0 +1,117 @@
+package federation
+
+import (
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 同一批操作中操作名重复时的处理策略
+const (
+	DuplicateOperationNamesReject = "reject" // 拒绝整批，返回 QUERY_VALIDATION_ERROR
+	DuplicateOperationNamesIndex  = "index"  // 重名操作按批内下标区分，如 GetUser#0、GetUser#1
+)
+
+// ExecuteBatch 依次执行客户端一次提交的多个操作，响应与请求顺序一致。每个操作使用独立的执行上下文，
+// 请求 ID 为批次请求 ID 加下标；单个操作失败转换为该操作的错误响应，不影响其他操作。
+// 同一批中有重名操作时按 DuplicateOperationNames 处理，匿名操作不参与检查
+func (e *Engine) ExecuteBatch(ctx *federationtypes.ExecutionContext, requests []*federationtypes.GraphQLRequest) ([]*federationtypes.GraphQLResponse, error) {
+	labels, err := e.batchOperationLabels(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*federationtypes.GraphQLResponse, len(requests))
+	for i, request := range requests {
+		response, err := e.ExecuteQuery(batchExecutionContext(ctx, request, i, labels[i]), request)
+		if err != nil {
+			e.logger.Error("Batched operation failed", "requestId", ctx.RequestID, "index", i, "error", err)
+			response = batchErrorResponse(err)
+		}
+		responses[i] = response
+	}
+	return responses, nil
+}
+
+// batchOperationLabels 返回各操作在执行上下文中使用的操作名。重名时默认拒绝整批，
+// 配置为 index 时重名的操作名附加批内下标，其余操作名不变
+func (e *Engine) batchOperationLabels(requests []*federationtypes.GraphQLRequest) ([]string, error) {
+	indexes := make(map[string][]int)
+	labels := make([]string, len(requests))
+	for i, request := range requests {
+		if request == nil {
+			return nil, errors.NewQueryValidationError(fmt.Sprintf("batched operation %d is empty", i))
+		}
+		labels[i] = request.OperationName
+		if request.OperationName != "" {
+			indexes[request.OperationName] = append(indexes[request.OperationName], i)
+		}
+	}
+
+	for i, request := range requests {
+		duplicates := indexes[request.OperationName]
+		if len(duplicates) < 2 {
+			continue
+		}
+		if e.federationConfig.DuplicateOperationNames != DuplicateOperationNamesIndex {
+			return nil, errors.NewQueryValidationError(
+				fmt.Sprintf("operation name %q is used by more than one operation in the batch", request.OperationName),
+				errors.WithExtension("reason", "DUPLICATE_OPERATION_NAME"),
+				errors.WithExtension("operationName", request.OperationName),
+				errors.WithExtension("indexes", duplicates),
+			)
+		}
+		labels[i] = fmt.Sprintf("%s#%d", request.OperationName, i)
+	}
+	return labels, nil
+}
+
+// operationLabel 返回请求在查询缓存键和合并键中使用的操作名。批内重名的操作使用执行上下文中带下标的标签，
+// 避免不同操作共享缓存和合并结果；其余请求使用请求的操作名
+func operationLabel(ctx *federationtypes.ExecutionContext, request *federationtypes.GraphQLRequest) string {
+	if ctx != nil && ctx.QueryContext != nil && ctx.QueryContext.Operation != "" {
+		return ctx.QueryContext.Operation
+	}
+	return request.OperationName
+}
+
+// batchExecutionContext 为批内单个操作创建执行上下文，沿用批次的配置、请求头和追踪设置
+func batchExecutionContext(ctx *federationtypes.ExecutionContext, request *federationtypes.GraphQLRequest, index int, label string) *federationtypes.ExecutionContext {
+	requestID := fmt.Sprintf("%s-%d", ctx.RequestID, index)
+	var headers map[string]string
+	if ctx.QueryContext != nil {
+		headers = ctx.QueryContext.Headers
+	}
+
+	return &federationtypes.ExecutionContext{
+		RequestID: requestID,
+		QueryContext: &federationtypes.QueryContext{
+			Query:     request.Query,
+			Variables: request.Variables,
+			Operation: label,
+			RequestID: requestID,
+			Headers:   headers,
+		},
+		StartTime: time.Now(),
+		Config:    ctx.Config,
+		Tracing:   ctx.Tracing,
+	}
+}
+
+// batchErrorResponse 将单个操作的执行错误转换为 GraphQL 错误响应
+func batchErrorResponse(err error) *federationtypes.GraphQLResponse {
+	// 非联邦错误不向客户端暴露细节
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) {
+		fedErr = errors.NewInternalError("Internal server error")
+	}
+	return &federationtypes.GraphQLResponse{
+		Errors: []federationtypes.GraphQLError{{
+			Message:    fedErr.Message,
+			Extensions: fedErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+		}},
+	}
+}
@@ -0,0 +1,74 @@
+package federation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// validateOperationType 拒绝 AllowedOperationTypes 之外的操作类型，未配置时全部允许
+func (e *Engine) validateOperationType(query *federationtypes.ParsedQuery) error {
+	allowed := e.federationConfig.AllowedOperationTypes
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	document, operationRef := findOperation(query)
+	if operationRef == -1 {
+		return nil
+	}
+
+	operationType := operationTypeName(document.OperationDefinitions[operationRef].OperationType)
+	for _, name := range allowed {
+		if name == operationType {
+			return nil
+		}
+	}
+
+	return errors.NewQueryValidationError(fmt.Sprintf("%s operations are disabled", operationType),
+		errors.WithExtension("reason", "OPERATION_TYPE_DISABLED"),
+		errors.WithExtension("operationType", operationType),
+	)
+}
+
+// operationTypeName 返回操作类型在配置中使用的名称
+func operationTypeName(operationType ast.OperationType) string {
+	switch operationType {
+	case ast.OperationTypeMutation:
+		return "mutation"
+	case ast.OperationTypeSubscription:
+		return "subscription"
+	default:
+		return "query"
+	}
+}
+
+// operationType 返回子查询文本的操作类型，匿名简写视为 query，无法识别时返回空串
+func operationType(query string) string {
+	query = strings.TrimSpace(query)
+
+	// 跳过前导注释
+	for strings.HasPrefix(query, "#") {
+		if idx := strings.Index(query, "\n"); idx != -1 {
+			query = strings.TrimSpace(query[idx+1:])
+		} else {
+			return ""
+		}
+	}
+
+	for _, operation := range []string{"mutation", "subscription", "query"} {
+		if strings.HasPrefix(query, operation) {
+			return operation
+		}
+	}
+
+	if strings.HasPrefix(query, "{") {
+		return "query"
+	}
+
+	return ""
+}
@@ -0,0 +1,51 @@
+package federation
+
+import (
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_ValidateOperationType(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		query    string
+		disabled string
+	}{
+		{"unrestricted mutation", nil, `mutation { addPerson(name: "Ada") { id } }`, ""},
+		{"query allowed", []string{"query"}, `{ people { id } }`, ""},
+		{"named query allowed", []string{"query"}, `query People { people { id } }`, ""},
+		{"mutation disabled", []string{"query"}, `mutation { addPerson(name: "Ada") { id } }`, "mutation"},
+		{"subscription disabled", []string{"query", "mutation"}, `subscription { personAdded { id } }`, "subscription"},
+		{"mutation allowed", []string{"query", "mutation"}, `mutation { addPerson(name: "Ada") { id } }`, ""},
+		{"query disabled", []string{"mutation"}, `{ people { id } }`, "query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewEngine(&federationtypes.FederationConfig{AllowedOperationTypes: tt.allowed}, utils.NewLogger("test"))
+			if err != nil {
+				t.Fatalf("NewEngine() error = %v", err)
+			}
+			query, err := engine.parseQuery(&federationtypes.GraphQLRequest{Query: tt.query})
+			if err != nil {
+				t.Fatalf("parseQuery() error = %v", err)
+			}
+
+			err = engine.validateOperationType(query)
+			if tt.disabled == "" {
+				if err != nil {
+					t.Errorf("validateOperationType() error = %v", err)
+				}
+				return
+			}
+			federationErr, ok := err.(*errors.FederationError)
+			if !ok || federationErr.Code != errors.ErrCodeQueryValidation || federationErr.Extensions["reason"] != "OPERATION_TYPE_DISABLED" || federationErr.Extensions["operationType"] != tt.disabled {
+				t.Errorf("Expected OPERATION_TYPE_DISABLED for %s, got %v", tt.disabled, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package federation
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 解析缓存的默认容量和 TTL
+const (
+	DefaultParseCacheSize = 1000
+	DefaultParseCacheTTL  = 5 * time.Minute
+)
+
+// ParseCacheStats 解析缓存统计
+type ParseCacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+}
+
+// parseCacheEntry 解析缓存条目
+type parseCacheEntry struct {
+	key       parseCacheKey
+	query     *federationtypes.ParsedQuery
+	expiresAt time.Time
+}
+
+// parseCacheKey 解析结果取决于查询文本和选择的操作名。查询文本去除首尾空白后作为键，
+// 中间的空白不改写，避免字符串字面量被合并
+type parseCacheKey struct {
+	query         string
+	operationName string
+}
+
+func newParseCacheKey(query, operationName string) parseCacheKey {
+	return parseCacheKey{query: strings.TrimSpace(query), operationName: operationName}
+}
+
+// parseCache 按查询文本缓存解析结果的 LRU 缓存。缓存的 AST 在请求间共享，只能读取；
+// 调用方拿到的是 ParsedQuery 的浅拷贝，可以替换 Variables 等字段
+type parseCache struct {
+	mutex   sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	order   *list.List // 最近使用的条目在前
+	entries map[parseCacheKey]*list.Element
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// newParseCache 按配置创建解析缓存，未配置时返回 nil
+func newParseCache(config *federationtypes.ParseCacheConfig) *parseCache {
+	if config == nil {
+		return nil
+	}
+
+	maxSize := config.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultParseCacheSize
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = DefaultParseCacheTTL
+	}
+
+	return &parseCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[parseCacheKey]*list.Element),
+	}
+}
+
+// get 返回未过期的解析结果副本
+func (c *parseCache) get(query, operationName string) (*federationtypes.ParsedQuery, bool) {
+	key := newParseCacheKey(query, operationName)
+
+	c.mutex.Lock()
+	element, ok := c.entries[key]
+	if ok && time.Now().After(element.Value.(*parseCacheEntry).expiresAt) {
+		c.removeElement(element)
+		ok = false
+	}
+	if !ok {
+		c.mutex.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	parsed := *element.Value.(*parseCacheEntry).query
+	c.mutex.Unlock()
+
+	c.hits.Add(1)
+	return &parsed, true
+}
+
+// set 缓存解析结果，超出容量时淘汰最久未使用的条目
+func (c *parseCache) set(query, operationName string, parsed *federationtypes.ParsedQuery) {
+	key := newParseCacheKey(query, operationName)
+	// 缓存独立的副本，调用方之后修改 Variables 不影响缓存条目
+	stored := *parsed
+	stored.Variables = nil
+	entry := &parseCacheEntry{key: key, query: &stored, expiresAt: time.Now().Add(c.ttl)}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxSize {
+		c.removeElement(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// removeElement 删除条目，调用方需持有锁
+func (c *parseCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*parseCacheEntry).key)
+}
+
+// stats 返回解析缓存统计
+func (c *parseCache) stats() ParseCacheStats {
+	c.mutex.Lock()
+	size := c.order.Len()
+	c.mutex.Unlock()
+
+	return ParseCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// parseQueryCached 启用解析缓存时先查缓存，命中则跳过解析。解析失败的查询不缓存
+func (e *Engine) parseQueryCached(request *federationtypes.GraphQLRequest) (*federationtypes.ParsedQuery, error) {
+	e.mutex.RLock()
+	cache := e.parseCache
+	e.mutex.RUnlock()
+	if cache == nil {
+		return e.parseQuery(request)
+	}
+
+	if parsed, ok := cache.get(request.Query, request.OperationName); ok {
+		parsed.Variables = make(map[string]interface{})
+		return parsed, nil
+	}
+
+	parsed, err := e.parseQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	cache.set(request.Query, request.OperationName, parsed)
+	return parsed, nil
+}
+
+// GetParseCacheStats 获取解析缓存统计，未启用时返回零值
+func (e *Engine) GetParseCacheStats() ParseCacheStats {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.parseCache == nil {
+		return ParseCacheStats{}
+	}
+	return e.parseCache.stats()
+}
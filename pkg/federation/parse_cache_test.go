@@ -0,0 +1,104 @@
+package federation
+
+import (
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+const parseCacheQuery = `
+	query TopProducts($first: Int) {
+		topProducts(first: $first) {
+			upc
+			name
+			price
+			reviews { id body author { id username } }
+		}
+	}`
+
+func newParseCacheEngine(tb testing.TB, parseCache *federationtypes.ParseCacheConfig) *Engine {
+	tb.Helper()
+
+	config := &federationtypes.FederationConfig{ParseCache: parseCache}
+	engine, err := NewEngine(config, utils.NewLogger("test"))
+	if err != nil {
+		tb.Fatalf("NewEngine() error = %v", err)
+	}
+	return engine
+}
+
+func TestEngine_ParseQueryCached(t *testing.T) {
+	engine := newParseCacheEngine(t, &federationtypes.ParseCacheConfig{MaxSize: 2})
+	request := &federationtypes.GraphQLRequest{Query: parseCacheQuery, OperationName: "TopProducts"}
+
+	first, err := engine.parseQueryCached(request)
+	if err != nil {
+		t.Fatalf("parseQueryCached() error = %v", err)
+	}
+	first.Variables["first"] = 5
+
+	second, err := engine.parseQueryCached(&federationtypes.GraphQLRequest{Query: parseCacheQuery + "\n", OperationName: "TopProducts"})
+	if err != nil {
+		t.Fatalf("parseQueryCached() error = %v", err)
+	}
+	if second.AST != first.AST {
+		t.Error("Expected cache hit to share the parsed AST")
+	}
+	if second.Depth != first.Depth || second.Complexity != first.Complexity {
+		t.Errorf("Expected cached depth/complexity %d/%d, got %d/%d", first.Depth, first.Complexity, second.Depth, second.Complexity)
+	}
+	if len(second.Variables) != 0 {
+		t.Errorf("Expected variables of the previous request not to leak, got %v", second.Variables)
+	}
+
+	if _, err := engine.parseQueryCached(&federationtypes.GraphQLRequest{Query: "{ a { "}); err == nil {
+		t.Error("Expected parse error")
+	}
+	engine.parseQueryCached(&federationtypes.GraphQLRequest{Query: "{ a }"})
+	engine.parseQueryCached(&federationtypes.GraphQLRequest{Query: "{ b }"})
+
+	stats := engine.GetParseCacheStats()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.Size != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected parse cache stats: %+v", stats)
+	}
+}
+
+func TestParseCache_Expiry(t *testing.T) {
+	cache := newParseCache(&federationtypes.ParseCacheConfig{TTL: time.Millisecond})
+	cache.set("{ a }", "", &federationtypes.ParsedQuery{Depth: 1})
+
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.get("{ a }", ""); ok {
+		t.Error("Expected expired entry to miss")
+	}
+	if size := cache.stats().Size; size != 0 {
+		t.Errorf("Expected expired entry to be removed, size = %d", size)
+	}
+
+	if newParseCache(nil) != nil {
+		t.Error("Expected nil config to disable the parse cache")
+	}
+}
+
+func benchmarkParseQuery(b *testing.B, parseCache *federationtypes.ParseCacheConfig) {
+	engine := newParseCacheEngine(b, parseCache)
+	request := &federationtypes.GraphQLRequest{Query: parseCacheQuery, OperationName: "TopProducts"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.parseQueryCached(request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEngine_ParseQuery_Uncached(b *testing.B) {
+	benchmarkParseQuery(b, nil)
+}
+
+func BenchmarkEngine_ParseQuery_Cached(b *testing.B) {
+	benchmarkParseQuery(b, &federationtypes.ParseCacheConfig{})
+}
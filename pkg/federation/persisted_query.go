@@ -0,0 +1,77 @@
+package federation
+
+import (
+	"strings"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/persisted"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// loadPersistedQueries 重建持久化查询存储并载入配置中的清单，配置了注册中心时本地未命中再查询远程
+func (e *Engine) loadPersistedQueries(config *federationtypes.FederationConfig) error {
+	store := persisted.NewPersistedQueryStore(nil, e.logger)
+	if config.PersistedQueryManifest != "" {
+		if _, err := store.LoadManifest([]byte(config.PersistedQueryManifest)); err != nil {
+			return err
+		}
+	}
+
+	if config.PersistedQueryRegistry != nil {
+		e.persistedQueries = persisted.NewRemoteStore(config.PersistedQueryRegistry, store, e.caller, e.logger)
+		return nil
+	}
+
+	e.persistedQueries = store
+	return nil
+}
+
+// persistedQueryHash 读取请求 extensions.persistedQuery.sha256Hash
+func persistedQueryHash(request *federationtypes.GraphQLRequest) string {
+	persistedQuery, ok := request.Extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	hash, _ := persistedQuery["sha256Hash"].(string)
+	return hash
+}
+
+// resolvePersistedQuery 按 APQ 协议解析查询文本，启用 EnforcePersistedQueries 时只放行清单中的查询
+func (e *Engine) resolvePersistedQuery(request *federationtypes.GraphQLRequest) (*federationtypes.GraphQLRequest, error) {
+	if e.persistedQueries == nil {
+		return request, nil
+	}
+
+	enforce := e.federationConfig.EnforcePersistedQueries
+	hash := persistedQueryHash(request)
+
+	if hash == "" {
+		if enforce && !e.persistedQueries.IsAllowed(persisted.HashQuery(request.Query)) {
+			return nil, errors.NewPersistedQueryNotAllowedError("query is not in the persisted query allowlist")
+		}
+		return request, nil
+	}
+
+	if request.Query == "" {
+		query, ok := e.persistedQueries.Get(hash)
+		if !ok || (enforce && !e.persistedQueries.IsAllowed(hash)) {
+			return nil, errors.NewPersistedQueryNotFoundError("PersistedQueryNotFound")
+		}
+
+		resolved := *request
+		resolved.Query = query
+		return &resolved, nil
+	}
+
+	if enforce {
+		if !e.persistedQueries.IsAllowed(hash) || !strings.EqualFold(persisted.HashQuery(request.Query), hash) {
+			return nil, errors.NewPersistedQueryNotAllowedError("query is not in the persisted query allowlist")
+		}
+		return request, nil
+	}
+
+	if err := e.persistedQueries.Register(hash, request.Query); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
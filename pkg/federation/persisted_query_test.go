@@ -0,0 +1,65 @@
+package federation
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/persisted"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func apqRequest(query, hash string) *federationtypes.GraphQLRequest {
+	return &federationtypes.GraphQLRequest{
+		Query: query,
+		Extensions: map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash},
+		},
+	}
+}
+
+func TestEngine_ResolvePersistedQuery(t *testing.T) {
+	allowed := "query GetUser { user { id } }"
+	config := &federationtypes.FederationConfig{
+		PersistedQueryManifest: fmt.Sprintf(`{"operations": [{"id": %q, "body": %q}]}`, persisted.HashQuery(allowed), allowed),
+	}
+
+	engine := &Engine{federationConfig: config, logger: utils.NewLogger("test")}
+	if err := engine.loadPersistedQueries(config); err != nil {
+		t.Fatalf("loadPersistedQueries() error = %v", err)
+	}
+
+	// 清单中的操作可按哈希直接执行
+	resolved, err := engine.resolvePersistedQuery(apqRequest("", persisted.HashQuery(allowed)))
+	if err != nil || resolved.Query != allowed {
+		t.Fatalf("Expected manifest query, got %v, %v", resolved, err)
+	}
+
+	// 未注册的哈希返回 PERSISTED_QUERY_NOT_FOUND
+	adHoc := "{ other }"
+	_, err = engine.resolvePersistedQuery(apqRequest("", persisted.HashQuery(adHoc)))
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePersistedQueryNotFound {
+		t.Fatalf("Expected PERSISTED_QUERY_NOT_FOUND, got %v", err)
+	}
+
+	// 携带查询文本时注册，之后可仅凭哈希执行
+	if _, err := engine.resolvePersistedQuery(apqRequest(adHoc, persisted.HashQuery(adHoc))); err != nil {
+		t.Fatalf("APQ registration error = %v", err)
+	}
+	if resolved, err := engine.resolvePersistedQuery(apqRequest("", persisted.HashQuery(adHoc))); err != nil || resolved.Query != adHoc {
+		t.Errorf("Expected registered query, got %v, %v", resolved, err)
+	}
+
+	// 强制模式下只放行清单中的查询
+	config.EnforcePersistedQueries = true
+	_, err = engine.resolvePersistedQuery(&federationtypes.GraphQLRequest{Query: adHoc})
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePersistedQueryNotAllowed {
+		t.Errorf("Expected PERSISTED_QUERY_NOT_ALLOWED, got %v", err)
+	}
+	if _, err := engine.resolvePersistedQuery(&federationtypes.GraphQLRequest{Query: allowed}); err != nil {
+		t.Errorf("Allowlisted query rejected: %v", err)
+	}
+}
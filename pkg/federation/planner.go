@@ -5,6 +5,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
 	"envoy-wasm-graphql-federation/pkg/errors"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
@@ -13,13 +15,29 @@ import (
 type FederatedPlanner struct {
 	logger          federationtypes.Logger
 	directiveParser federationtypes.FederationDirectiveParser
+	config          *FederatedPlannerConfig
+}
+
+// FederatedPlannerConfig 联邦规划器配置
+type FederatedPlannerConfig struct {
+	ResolutionPriorities map[string]int // 服务的解析优先级，只在同一依赖层级内调整顺序
 }
 
 // NewFederatedPlanner 创建新的联邦规划器
 func NewFederatedPlanner(logger federationtypes.Logger) federationtypes.FederationPlanner {
+	return NewFederatedPlannerWithConfig(nil, logger)
+}
+
+// NewFederatedPlannerWithConfig 使用指定配置创建联邦规划器
+func NewFederatedPlannerWithConfig(config *FederatedPlannerConfig, logger federationtypes.Logger) federationtypes.FederationPlanner {
+	if config == nil {
+		config = &FederatedPlannerConfig{}
+	}
+
 	return &FederatedPlanner{
 		logger:          logger,
 		directiveParser: NewDirectiveParser(logger),
+		config:          config,
 	}
 }
 
@@ -48,6 +66,9 @@ func (p *FederatedPlanner) PlanEntityResolution(entities []federationtypes.Feder
 		return nil, fmt.Errorf("failed to analyze query entities: %w", err)
 	}
 
+	// 由 @provides 内联满足的实体无需再向所属服务解析
+	requiredEntities = p.pruneProvidedEntities(query, requiredEntities)
+
 	// 为每个实体创建解析策略
 	for _, entity := range requiredEntities {
 		resolution, err := p.createEntityResolution(&entity)
@@ -211,6 +232,239 @@ func (p *FederatedPlanner) analyzeQueryEntities(query *federationtypes.ParsedQue
 	return allEntities, nil
 }
 
+// providedField 通过 @provides 内联提供的字段
+type providedField struct {
+	typeName    string          // 字段返回的实体类型
+	serviceName string          // 提供字段的服务
+	fields      map[string]bool // 内联提供的字段
+}
+
+// pruneProvidedEntities 移除查询中仅通过 @provides 路径访问且字段均已内联提供的实体解析
+func (p *FederatedPlanner) pruneProvidedEntities(query *federationtypes.ParsedQuery, entities []federationtypes.FederatedEntity) []federationtypes.FederatedEntity {
+	document, ok := query.AST.(*ast.Document)
+	if !ok || document == nil {
+		return entities
+	}
+
+	provides := p.collectProvidedFields(entities)
+	if len(provides) == 0 {
+		return entities
+	}
+
+	referenced := make(map[string]bool)
+	unsatisfied := make(map[string]bool)
+	for i := range document.OperationDefinitions {
+		p.collectProvidedReferences(document, document.OperationDefinitions[i].SelectionSet, "", provides, entities, referenced, unsatisfied)
+	}
+
+	var pruned []federationtypes.FederatedEntity
+	for _, entity := range entities {
+		if referenced[entity.TypeName] && !unsatisfied[entity.TypeName] && !p.providesType(provides, entity) {
+			p.logger.Debug("Entity fields satisfied by @provides, skipping resolution",
+				"type", entity.TypeName,
+				"service", entity.ServiceName,
+			)
+			continue
+		}
+		pruned = append(pruned, entity)
+	}
+
+	return pruned
+}
+
+// collectProvidedFields 收集带 @provides 的字段，以“类型.字段”为键
+func (p *FederatedPlanner) collectProvidedFields(entities []federationtypes.FederatedEntity) map[string]providedField {
+	provides := make(map[string]providedField)
+
+	for _, entity := range entities {
+		for _, field := range entity.Fields {
+			if field.Directives.Provides == nil {
+				continue
+			}
+
+			fields := make(map[string]bool)
+			for _, name := range field.Directives.Provides.FieldNames() {
+				fields[name] = true
+			}
+
+			provides[entity.TypeName+"."+field.Name] = providedField{
+				typeName:    namedType(field.Type),
+				serviceName: entity.ServiceName,
+				fields:      fields,
+			}
+		}
+	}
+
+	return provides
+}
+
+// collectProvidedReferences 遍历查询，记录经 @provides 字段访问的实体类型以及是否有未内联提供的字段。
+// parentType 为选择集所属类型，未知时按选择的字段推断；无法确定所属类型的字段不会匹配 @provides
+func (p *FederatedPlanner) collectProvidedReferences(document *ast.Document, selectionSet int, parentType string, provides map[string]providedField, entities []federationtypes.FederatedEntity, referenced, unsatisfied map[string]bool) {
+	if selectionSet == -1 {
+		return
+	}
+	if parentType == "" {
+		parentType = p.inferSelectionType(document, selectionSet, entities)
+	}
+
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			field := document.Fields[selection.Ref]
+			if !field.HasSelections {
+				continue
+			}
+
+			fieldName := document.FieldNameString(selection.Ref)
+			childType := p.typeFieldType(parentType, fieldName, entities)
+			if provided, ok := provides[parentType+"."+fieldName]; ok && parentType != "" {
+				childType = provided.typeName
+				referenced[provided.typeName] = true
+				for _, subField := range p.selectionFieldNames(document, field.SelectionSet) {
+					if !provided.fields[subField] && !p.isTypeKeyField(provided.typeName, subField, entities) {
+						unsatisfied[provided.typeName] = true
+					}
+				}
+			} else if typeName := p.entityFieldType(fieldName, entities); typeName != "" {
+				// 未经 @provides 访问实体类型，仍需所属服务解析
+				unsatisfied[typeName] = true
+			}
+
+			p.collectProvidedReferences(document, field.SelectionSet, childType, provides, entities, referenced, unsatisfied)
+
+		case ast.SelectionKindInlineFragment:
+			if fragment := document.InlineFragments[selection.Ref]; fragment.HasSelections {
+				fragmentType := parentType
+				if typeCondition := document.InlineFragmentTypeConditionNameString(selection.Ref); typeCondition != "" {
+					fragmentType = typeCondition
+				}
+				p.collectProvidedReferences(document, fragment.SelectionSet, fragmentType, provides, entities, referenced, unsatisfied)
+			}
+		}
+	}
+}
+
+// inferSelectionType 返回唯一包含选择集中全部字段的实体类型，无法唯一确定时返回空字符串
+func (p *FederatedPlanner) inferSelectionType(document *ast.Document, selectionSet int, entities []federationtypes.FederatedEntity) string {
+	names := p.selectionFieldNames(document, selectionSet)
+
+	candidate := ""
+	for _, entity := range entities {
+		if entity.TypeName == candidate || !entityHasFields(entity, names) {
+			continue
+		}
+		if candidate != "" {
+			return ""
+		}
+		candidate = entity.TypeName
+	}
+	return candidate
+}
+
+// entityHasFields 检查实体是否定义了全部字段，__typename 视为所有类型都有
+func entityHasFields(entity federationtypes.FederatedEntity, names []string) bool {
+	for _, name := range names {
+		if name == "__typename" {
+			continue
+		}
+		found := false
+		for _, field := range entity.Fields {
+			if field.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// typeFieldType 返回指定类型字段的基础类型名，类型未知或未定义该字段时返回空字符串
+func (p *FederatedPlanner) typeFieldType(typeName, fieldName string, entities []federationtypes.FederatedEntity) string {
+	if typeName == "" {
+		return ""
+	}
+	for _, entity := range entities {
+		if entity.TypeName != typeName {
+			continue
+		}
+		for _, field := range entity.Fields {
+			if field.Name == fieldName {
+				return namedType(field.Type)
+			}
+		}
+	}
+	return ""
+}
+
+// selectionFieldNames 返回选择集中直接选择的字段名（含内联片段）
+func (p *FederatedPlanner) selectionFieldNames(document *ast.Document, selectionSet int) []string {
+	var names []string
+
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			names = append(names, document.FieldNameString(selection.Ref))
+		case ast.SelectionKindInlineFragment:
+			if fragment := document.InlineFragments[selection.Ref]; fragment.HasSelections {
+				names = append(names, p.selectionFieldNames(document, fragment.SelectionSet)...)
+			}
+		}
+	}
+
+	return names
+}
+
+// isTypeKeyField 检查字段是否为指定类型任一实体的键字段
+func (p *FederatedPlanner) isTypeKeyField(typeName, fieldName string, entities []federationtypes.FederatedEntity) bool {
+	for i := range entities {
+		if entities[i].TypeName == typeName && p.isKeyField(&entities[i], fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityFieldType 返回实体字段所返回的实体类型，非实体类型返回空字符串
+func (p *FederatedPlanner) entityFieldType(fieldName string, entities []federationtypes.FederatedEntity) string {
+	for _, entity := range entities {
+		for _, field := range entity.Fields {
+			if field.Name != fieldName {
+				continue
+			}
+			typeName := namedType(field.Type)
+			for _, candidate := range entities {
+				if candidate.TypeName == typeName {
+					return typeName
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// providesType 检查实体是否位于为其类型提供 @provides 字段的服务中
+func (p *FederatedPlanner) providesType(provides map[string]providedField, entity federationtypes.FederatedEntity) bool {
+	for _, provided := range provides {
+		if provided.typeName == entity.TypeName && provided.serviceName == entity.ServiceName {
+			return true
+		}
+	}
+	return false
+}
+
+// namedType 去除列表和非空修饰，返回基础类型名
+func namedType(typeName string) string {
+	return strings.Trim(typeName, "[]! ")
+}
+
 // createEntityResolution 创建实体解析策略
 func (p *FederatedPlanner) createEntityResolution(entity *federationtypes.FederatedEntity) (*federationtypes.EntityResolution, error) {
 	if entity == nil {
@@ -241,9 +495,7 @@ func (p *FederatedPlanner) extractKeyFields(entity *federationtypes.FederatedEnt
 	var keyFields []string
 
 	for _, key := range entity.Directives.Keys {
-		// 解析字段选择集
-		fields := strings.Fields(key.Fields)
-		keyFields = append(keyFields, fields...)
+		keyFields = append(keyFields, key.FieldNames()...)
 	}
 
 	// 去重
@@ -282,8 +534,7 @@ func (p *FederatedPlanner) buildBasicEntityQuery(entity *federationtypes.Federat
 // isKeyField 检查字段是否是键字段
 func (p *FederatedPlanner) isKeyField(entity *federationtypes.FederatedEntity, fieldName string) bool {
 	for _, key := range entity.Directives.Keys {
-		fields := strings.Fields(key.Fields)
-		for _, field := range fields {
+		for _, field := range key.FieldNames() {
 			if field == fieldName {
 				return true
 			}
@@ -299,16 +550,12 @@ func (p *FederatedPlanner) analyzeFieldDependencies(entity federationtypes.Feder
 	for _, field := range entity.Fields {
 		// 检查 @requires 指令
 		if field.Directives.Requires != nil {
-			// 查找提供必需字段的服务
-			requiredFields := strings.Fields(field.Directives.Requires.Fields)
-
-			for _, requiredField := range requiredFields {
-				provider := p.findFieldProvider(entity.TypeName, requiredField, allEntities)
-
-				if provider != "" && provider != entity.ServiceName {
+			// 必需字段（含嵌套子字段）可能分布在多个服务中，依赖所有提供者
+			federationtypes.FieldSetProviders(entity.TypeName, field.Directives.Requires.FieldSet(), allEntities, func(provider, _ string) {
+				if provider != entity.ServiceName {
 					dependencies = append(dependencies, provider)
 				}
-			}
+			})
 		}
 	}
 
@@ -325,20 +572,6 @@ func (p *FederatedPlanner) analyzeFieldDependencies(entity federationtypes.Feder
 	return uniqueDeps
 }
 
-// findFieldProvider 查找提供指定字段的服务
-func (p *FederatedPlanner) findFieldProvider(typeName, fieldName string, entities []federationtypes.FederatedEntity) string {
-	for _, entity := range entities {
-		if entity.TypeName == typeName {
-			for _, field := range entity.Fields {
-				if field.Name == fieldName && field.Directives.External == nil {
-					return entity.ServiceName
-				}
-			}
-		}
-	}
-	return ""
-}
-
 // collectRequiredServices 收集所需服务
 func (p *FederatedPlanner) collectRequiredServices(entities []federationtypes.FederatedEntity) []string {
 	serviceSet := make(map[string]bool)
@@ -355,7 +588,8 @@ func (p *FederatedPlanner) collectRequiredServices(entities []federationtypes.Fe
 	return services
 }
 
-// topologicalSort 拓扑排序
+// topologicalSort 按层级拓扑排序：依赖都已排出的服务组成下一层级，
+// 层级内按解析优先级从高到低排列，优先级相同时按服务名排列以保证结果稳定
 func (p *FederatedPlanner) topologicalSort(graph map[string][]string) ([]string, error) {
 	// 计算入度
 	inDegree := make(map[string]int)
@@ -372,37 +606,60 @@ func (p *FederatedPlanner) topologicalSort(graph map[string][]string) ([]string,
 	}
 
 	// 找到所有入度为0的节点
-	var queue []string
+	var level []string
 	for node, degree := range inDegree {
 		if degree == 0 {
-			queue = append(queue, node)
+			level = append(level, node)
 		}
 	}
 
 	var result []string
-	for len(queue) > 0 {
-		// 取出队列第一个元素
-		current := queue[0]
-		queue = queue[1:]
-		result = append(result, current)
+	for len(level) > 0 {
+		p.sortByResolutionPriority(level)
+		result = append(result, level...)
 
 		// 更新邻居节点的入度
-		for _, neighbor := range graph[current] {
-			inDegree[neighbor]--
-			if inDegree[neighbor] == 0 {
-				queue = append(queue, neighbor)
+		var next []string
+		for _, current := range level {
+			for _, neighbor := range graph[current] {
+				inDegree[neighbor]--
+				if inDegree[neighbor] == 0 {
+					next = append(next, neighbor)
+				}
 			}
 		}
+		level = next
 	}
 
-	// 检查是否有循环依赖
+	// 检查是否有循环依赖，未能排出的服务都在环上或依赖环
 	if len(result) != len(inDegree) {
-		return nil, errors.NewPlanningError("circular dependency detected")
+		var cycle []string
+		for node, degree := range inDegree {
+			if degree > 0 {
+				cycle = append(cycle, node)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, errors.NewPlanningError("circular dependency detected",
+			errors.WithExtension("reason", "CIRCULAR_DEPENDENCY"),
+			errors.WithExtension("cycle", cycle),
+		)
 	}
 
 	return result, nil
 }
 
+// sortByResolutionPriority 将同一层级的服务按解析优先级从高到低排序
+func (p *FederatedPlanner) sortByResolutionPriority(services []string) {
+	priorities := p.config.ResolutionPriorities
+	sort.Slice(services, func(i, j int) bool {
+		if priorities[services[i]] != priorities[services[j]] {
+			return priorities[services[i]] > priorities[services[j]]
+		}
+		return services[i] < services[j]
+	})
+}
+
 // mergeEntityResolutions 合并相同服务的实体解析
 func (p *FederatedPlanner) mergeEntityResolutions(resolutions []federationtypes.EntityResolution) []federationtypes.EntityResolution {
 	serviceMap := make(map[string][]federationtypes.EntityResolution)
@@ -1,8 +1,13 @@
 package federation
 
 import (
+	stderrors "errors"
+	"reflect"
 	"testing"
 
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 	"envoy-wasm-graphql-federation/pkg/utils"
 )
@@ -179,6 +184,123 @@ func TestFederatedPlanner_AnalyzeDependencies(t *testing.T) {
 	}
 }
 
+func TestFederatedPlanner_AnalyzeDependencies_MultipleProviders(t *testing.T) {
+	planner := NewFederatedPlanner(utils.NewLogger("test"))
+
+	external := federationtypes.EntityDirectives{External: &federationtypes.ExternalDirective{}}
+	entities := []federationtypes.FederatedEntity{
+		{
+			TypeName:    "Product",
+			ServiceName: "shipping",
+			Fields: []federationtypes.FederatedField{
+				{Name: "weight", Type: "Int", Directives: external},
+				{Name: "price", Type: "Int", Directives: external},
+				{
+					Name: "estimate",
+					Type: "Int",
+					Directives: federationtypes.EntityDirectives{
+						Requires: &federationtypes.RequiresDirective{Fields: "weight price"},
+					},
+				},
+			},
+		},
+		{TypeName: "Product", ServiceName: "inventory", Fields: []federationtypes.FederatedField{{Name: "weight", Type: "Int"}}},
+		{TypeName: "Product", ServiceName: "pricing", Fields: []federationtypes.FederatedField{{Name: "price", Type: "Int"}}},
+	}
+
+	order, err := planner.AnalyzeDependencies(entities)
+	if err != nil {
+		t.Fatalf("AnalyzeDependencies() error = %v", err)
+	}
+
+	// shipping 在两个提供者之后
+	shipping := indexOf(order, "shipping")
+	if shipping < indexOf(order, "inventory") || shipping < indexOf(order, "pricing") {
+		t.Errorf("Expected shipping after inventory and pricing, got %v", order)
+	}
+}
+
+func TestFederatedPlanner_AnalyzeDependencies_ResolutionPriority(t *testing.T) {
+	external := federationtypes.EntityDirectives{External: &federationtypes.ExternalDirective{}}
+	entities := []federationtypes.FederatedEntity{
+		{
+			TypeName:    "Product",
+			ServiceName: "shipping",
+			Fields: []federationtypes.FederatedField{
+				{Name: "weight", Type: "Int", Directives: external},
+				{
+					Name: "estimate",
+					Type: "Int",
+					Directives: federationtypes.EntityDirectives{
+						Requires: &federationtypes.RequiresDirective{Fields: "weight"},
+					},
+				},
+			},
+		},
+		{TypeName: "Product", ServiceName: "inventory", Fields: []federationtypes.FederatedField{{Name: "weight", Type: "Int"}}},
+		{TypeName: "Product", ServiceName: "pricing", Fields: []federationtypes.FederatedField{{Name: "price", Type: "Int"}}},
+		{TypeName: "Product", ServiceName: "reviews", Fields: []federationtypes.FederatedField{{Name: "rating", Type: "Int"}}},
+	}
+
+	tests := []struct {
+		name       string
+		priorities map[string]int
+		want       []string
+	}{
+		{name: "no priorities", want: []string{"inventory", "pricing", "reviews", "shipping"}},
+		{
+			name:       "priorities reorder within a level",
+			priorities: map[string]int{"reviews": 10, "pricing": 5},
+			want:       []string{"reviews", "pricing", "inventory", "shipping"},
+		},
+		{
+			// shipping 依赖 inventory，优先级再高也不能提前到第一层级
+			name:       "priorities do not cross levels",
+			priorities: map[string]int{"shipping": 100, "inventory": -1},
+			want:       []string{"pricing", "reviews", "inventory", "shipping"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := NewFederatedPlannerWithConfig(&FederatedPlannerConfig{ResolutionPriorities: tt.priorities}, utils.NewLogger("test"))
+			order, err := planner.AnalyzeDependencies(entities)
+			if err != nil {
+				t.Fatalf("AnalyzeDependencies() error = %v", err)
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("AnalyzeDependencies() = %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederatedPlanner_AnalyzeDependencies_CycleDiagnostics(t *testing.T) {
+	requires := func(fields string) federationtypes.EntityDirectives {
+		return federationtypes.EntityDirectives{Requires: &federationtypes.RequiresDirective{Fields: fields}}
+	}
+	entities := []federationtypes.FederatedEntity{
+		{TypeName: "Product", ServiceName: "pricing", Fields: []federationtypes.FederatedField{
+			{Name: "price", Type: "Int"},
+			{Name: "discount", Type: "Int", Directives: requires("weight")},
+		}},
+		{TypeName: "Product", ServiceName: "inventory", Fields: []federationtypes.FederatedField{
+			{Name: "weight", Type: "Int"},
+			{Name: "restock", Type: "Int", Directives: requires("price")},
+		}},
+		{TypeName: "Product", ServiceName: "reviews", Fields: []federationtypes.FederatedField{{Name: "rating", Type: "Int"}}},
+	}
+
+	_, err := NewFederatedPlanner(utils.NewLogger("test")).AnalyzeDependencies(entities)
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePlanningFailed {
+		t.Fatalf("Expected PLANNING_FAILED, got %v", err)
+	}
+	if fedErr.Extensions["reason"] != "CIRCULAR_DEPENDENCY" || !reflect.DeepEqual(fedErr.Extensions["cycle"], []string{"inventory", "pricing"}) {
+		t.Errorf("Expected cycle members inventory and pricing, got %v", fedErr.Extensions)
+	}
+}
+
 func TestFederatedPlanner_OptimizeFederationPlan(t *testing.T) {
 	logger := utils.NewLogger("test")
 	planner := NewFederatedPlanner(logger)
@@ -246,3 +368,108 @@ func indexOf(slice []string, item string) int {
 	}
 	return -1
 }
+
+func TestFederatedPlanner_PlanEntityResolution_Provides(t *testing.T) {
+	planner := NewFederatedPlanner(utils.NewLogger("test"))
+
+	key := federationtypes.EntityDirectives{
+		Keys: []federationtypes.KeyDirective{{Fields: "id", Resolvable: true}},
+	}
+	external := federationtypes.EntityDirectives{External: &federationtypes.ExternalDirective{}}
+
+	entities := []federationtypes.FederatedEntity{
+		{
+			TypeName:    "Review",
+			ServiceName: "reviews",
+			Directives:  key,
+			Fields: []federationtypes.FederatedField{
+				{Name: "id", Type: "ID!"},
+				{Name: "body", Type: "String"},
+				{
+					Name: "author",
+					Type: "User",
+					Directives: federationtypes.EntityDirectives{
+						Provides: &federationtypes.ProvidesDirective{Fields: "name"},
+					},
+				},
+			},
+		},
+		{
+			TypeName:    "User",
+			ServiceName: "reviews",
+			Directives:  key,
+			Fields: []federationtypes.FederatedField{
+				{Name: "id", Type: "ID!", Directives: external},
+				{Name: "name", Type: "String", Directives: external},
+			},
+		},
+		{
+			TypeName:    "User",
+			ServiceName: "users",
+			Directives:  key,
+			Fields: []federationtypes.FederatedField{
+				{Name: "id", Type: "ID!"},
+				{Name: "name", Type: "String"},
+				{Name: "email", Type: "String"},
+			},
+		},
+		{
+			TypeName:    "Post",
+			ServiceName: "posts",
+			Directives:  key,
+			Fields: []federationtypes.FederatedField{
+				{Name: "id", Type: "ID!"},
+				{Name: "title", Type: "String"},
+				{Name: "author", Type: "User"},
+			},
+		},
+	}
+
+	plan := func(t *testing.T, query string) *federationtypes.FederationPlan {
+		document, report := astparser.ParseGraphqlDocumentString(query)
+		if report.HasErrors() {
+			t.Fatalf("failed to parse query: %s", report.Error())
+		}
+
+		result, err := planner.PlanEntityResolution(entities, &federationtypes.ParsedQuery{AST: &document})
+		if err != nil {
+			t.Fatalf("PlanEntityResolution() error = %v", err)
+		}
+		return result
+	}
+
+	plansUsers := func(plan *federationtypes.FederationPlan) bool {
+		for _, resolution := range plan.Entities {
+			if resolution.ServiceName == "users" {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("provided field is resolved inline", func(t *testing.T) {
+		result := plan(t, `{ reviews { body author { id name } } }`)
+		if plansUsers(result) {
+			t.Errorf("expected no users resolution, got %+v", result.Entities)
+		}
+		for _, service := range result.RequiredServices {
+			if service == "users" {
+				t.Errorf("expected users not to be required, got %v", result.RequiredServices)
+			}
+		}
+	})
+
+	t.Run("non-provided field still resolves through owner", func(t *testing.T) {
+		result := plan(t, `{ reviews { author { name email } } }`)
+		if !plansUsers(result) {
+			t.Errorf("expected users resolution for email, got %+v", result.Entities)
+		}
+	})
+
+	t.Run("same field name on another type is not provided", func(t *testing.T) {
+		result := plan(t, `{ posts { title author { name } } }`)
+		if !plansUsers(result) {
+			t.Errorf("expected users resolution for Post.author, got %+v", result.Entities)
+		}
+	})
+}
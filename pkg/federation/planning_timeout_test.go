@@ -0,0 +1,84 @@
+package federation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// blockingPlanner 在上下文结束前不返回，用于确定性地触发规划超时
+type blockingPlanner struct {
+	federationtypes.QueryPlanner
+}
+
+func (p *blockingPlanner) CreateExecutionPlan(ctx context.Context, query *federationtypes.ParsedQuery, services []federationtypes.ServiceConfig) (*federationtypes.ExecutionPlan, error) {
+	<-ctx.Done()
+	// 让超时分支先于规划结果被选中
+	time.Sleep(10 * time.Millisecond)
+	return nil, ctx.Err()
+}
+
+func TestEngine_CreateExecutionPlanTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		blocking   bool
+		wantReason string
+	}{
+		{"no timeout", 0, false, ""},
+		{"generous timeout", time.Second, false, ""},
+		{"planner exceeds timeout", time.Millisecond, true, "PLANNING_TIMEOUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &federationtypes.FederationConfig{
+				Services: []federationtypes.ServiceConfig{
+					{Name: "people", Endpoint: "http://people/graphql", Schema: "type Query { people: [Person] } type Person { id: ID! }", Timeout: time.Second},
+					{Name: "books", Endpoint: "http://books/graphql", Schema: "type Query { books: [Book] } type Book { isbn: String! }", Timeout: time.Second},
+				},
+				PlanningTimeout: tt.timeout,
+			}
+			engine, err := NewEngine(config, utils.NewLogger("test"))
+			if err != nil {
+				t.Fatalf("NewEngine() error = %v", err)
+			}
+			if err := engine.Initialize(config); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+			if tt.blocking {
+				engine.planner = &blockingPlanner{QueryPlanner: engine.planner}
+			}
+			query, err := engine.parseQuery(&federationtypes.GraphQLRequest{Query: `{ people { id } books { isbn } }`})
+			if err != nil {
+				t.Fatalf("parseQuery() error = %v", err)
+			}
+
+			plan, err := engine.createExecutionPlan(context.Background(), query)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("createExecutionPlan() error = %v", err)
+				}
+				if plan == nil || len(plan.SubQueries) != 2 {
+					t.Errorf("Expected a plan with 2 sub-queries, got %+v", plan)
+				}
+				return
+			}
+
+			federationErr, ok := err.(*errors.FederationError)
+			if !ok || federationErr.Code != errors.ErrCodePlanningFailed {
+				t.Fatalf("Expected PLANNING_FAILED, got %v", err)
+			}
+			if reason := federationErr.Extensions["reason"]; reason != tt.wantReason {
+				t.Errorf("Expected reason %s, got %v", tt.wantReason, reason)
+			}
+			if limit := federationErr.Extensions["limit"]; limit != tt.timeout.String() {
+				t.Errorf("Expected limit %s, got %v", tt.timeout, limit)
+			}
+		})
+	}
+}
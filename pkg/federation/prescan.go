@@ -0,0 +1,183 @@
+package federation
+
+import (
+	"fmt"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+)
+
+// 解析前检查的默认上限，取值宽松，只拒绝明显超限的查询
+const (
+	DefaultPreParseMaxBytes   = 1 << 20
+	DefaultPreParseMaxNesting = 256
+	DefaultPreParseMaxCost    = 100000
+)
+
+// preScanResult 对原始查询文本的粗略统计，字符串和注释中的字符不计入
+type preScanResult struct {
+	nesting       int // 花括号、圆括号和方括号的最大嵌套层数
+	cost          int // 花括号×2 + 圆括号，与规划器的 calculateQueryComplexity 一致
+	fragments     int // 片段定义数量
+	fragmentBytes int // 所有片段定义从 fragment 关键字到右花括号的总字节数
+}
+
+// scanQuery 单次遍历查询文本统计嵌套层数、粗略代价和片段定义，不构建 AST
+func scanQuery(query string) preScanResult {
+	var result preScanResult
+	depth := 0
+	// 顶层定义以第一个名称区分：fragment 关键字开始片段定义，记录其起始位置直到定义结束
+	definitionStart := true
+	fragmentStart := -1
+
+	for i := 0; i < len(query); i++ {
+		if depth == 0 && isNameStart(query[i]) {
+			end := i + 1
+			for end < len(query) && isNameContinue(query[end]) {
+				end++
+			}
+			if definitionStart && query[i:end] == "fragment" {
+				result.fragments++
+				fragmentStart = i
+			}
+			definitionStart = false
+			i = end - 1
+			continue
+		}
+
+		switch query[i] {
+		case '#':
+			// 注释到行尾
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+		case '"':
+			i = skipString(query, i)
+		case '{', '(', '[':
+			depth++
+			if depth > result.nesting {
+				result.nesting = depth
+			}
+			switch query[i] {
+			case '{':
+				result.cost += 2
+			case '(':
+				result.cost++
+			}
+		case '}', ')', ']':
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 && query[i] == '}' {
+				if fragmentStart >= 0 {
+					result.fragmentBytes += i + 1 - fragmentStart
+					fragmentStart = -1
+				}
+				definitionStart = true
+			}
+		}
+	}
+
+	return result
+}
+
+// isNameStart 判断字符是否可以开始 GraphQL 名称
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isNameContinue 判断字符是否可以出现在 GraphQL 名称中
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// skipString 跳过从 start 开始的字符串或块字符串，返回结束引号的位置
+func skipString(query string, start int) int {
+	if len(query)-start >= 3 && query[start:start+3] == `"""` {
+		for i := start + 3; i < len(query); i++ {
+			if query[i] == '\\' && len(query)-i >= 4 && query[i+1:i+4] == `"""` {
+				i += 3
+				continue
+			}
+			if len(query)-i >= 3 && query[i:i+3] == `"""` {
+				return i + 2
+			}
+		}
+		return len(query)
+	}
+
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"', '\n', '\r':
+			return i
+		}
+	}
+	return len(query)
+}
+
+// preScanQuery 在完整解析之前按原始文本做启发式检查，保护解析器免受恶意构造的输入。
+// 配置了 preParseLimits 时检查大小、嵌套和粗略代价，配置了 maxFragments 或 maxFragmentBytes 时检查片段定义；
+// 精确的深度和复杂度限制仍在解析后执行
+func (e *Engine) preScanQuery(query string) error {
+	limits := e.federationConfig.PreParseLimits
+	maxFragments, maxFragmentBytes := e.federationConfig.MaxFragments, e.federationConfig.MaxFragmentBytes
+	if limits == nil && maxFragments <= 0 && maxFragmentBytes <= 0 {
+		return nil
+	}
+
+	if limits != nil {
+		maxBytes := limits.MaxBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultPreParseMaxBytes
+		}
+		if len(query) > maxBytes {
+			return preParseLimitError("bytes", fmt.Sprintf("query size %d bytes exceeds pre-parse limit %d", len(query), maxBytes))
+		}
+	}
+
+	result := scanQuery(query)
+
+	if limits != nil {
+		maxNesting := limits.MaxNesting
+		if maxNesting <= 0 {
+			maxNesting = DefaultPreParseMaxNesting
+		}
+		if result.nesting > maxNesting {
+			return preParseLimitError("nesting", fmt.Sprintf("query nesting %d exceeds pre-parse limit %d", result.nesting, maxNesting))
+		}
+
+		maxCost := limits.MaxCost
+		if maxCost <= 0 {
+			maxCost = DefaultPreParseMaxCost
+		}
+		if result.cost > maxCost {
+			return preParseLimitError("cost", fmt.Sprintf("query cost %d exceeds pre-parse limit %d", result.cost, maxCost))
+		}
+	}
+
+	if maxFragments > 0 && result.fragments > maxFragments {
+		return errors.NewQueryValidationError(
+			fmt.Sprintf("query defines %d fragments, exceeding maximum %d", result.fragments, maxFragments),
+			errors.WithExtension("fragments", result.fragments),
+			errors.WithExtension("maxFragments", maxFragments),
+		)
+	}
+	if maxFragmentBytes > 0 && result.fragmentBytes > maxFragmentBytes {
+		return errors.NewQueryValidationError(
+			fmt.Sprintf("fragment definitions total %d bytes, exceeding maximum %d", result.fragmentBytes, maxFragmentBytes),
+			errors.WithExtension("fragmentBytes", result.fragmentBytes),
+			errors.WithExtension("maxFragmentBytes", maxFragmentBytes),
+		)
+	}
+
+	return nil
+}
+
+// preParseLimitError 构建解析前检查失败的复杂度错误
+func preParseLimitError(limit, message string) error {
+	return errors.NewQueryComplexityError(message,
+		errors.WithExtension("reason", "PRE_PARSE_LIMIT"),
+		errors.WithExtension("limit", limit),
+	)
+}
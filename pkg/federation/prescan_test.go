@@ -0,0 +1,145 @@
+package federation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestScanQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		nesting int
+		cost    int
+	}{
+		{"simple", `query { user(id: 1) { name tags } }`, 2, 5},
+		{"list argument", `{ users(ids: [1, 2]) { id } }`, 3, 5},
+		{"braces in string", `{ search(text: "{{{ (((") { id } }`, 2, 5},
+		{"braces in block string", `{ search(text: """ {{{ \""" ((( """) { id } }`, 2, 5},
+		{"braces in comment", "{ # {{{{ (((\n user { id } }", 2, 4},
+		{"unbalanced closing", `} } { a }`, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := scanQuery(tt.query)
+			if result.nesting != tt.nesting || result.cost != tt.cost {
+				t.Errorf("scanQuery() = nesting %d cost %d, want nesting %d cost %d", result.nesting, result.cost, tt.nesting, tt.cost)
+			}
+		})
+	}
+}
+
+func TestScanQuery_Fragments(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		fragments int
+		bytes     int
+	}{
+		{"single fragment", "query { ...F }\nfragment F on Query { a b c }", 1, 29},
+		{"operation named fragment", "query fragment { a }", 0, 0},
+		{"fragment keyword in string", `{ search(text: "fragment F on Query { a }") { id } }`, 0, 0},
+		{"nested braces", "fragment F on Query { a { b } }\nfragment G on Query { c }", 2, 56},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := scanQuery(tt.query)
+			if result.fragments != tt.fragments || result.fragmentBytes != tt.bytes {
+				t.Errorf("scanQuery() = %d fragments (%d bytes), want %d fragments (%d bytes)", result.fragments, result.fragmentBytes, tt.fragments, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestEngine_PreScanQuery_FragmentLimits(t *testing.T) {
+	engine, err := NewEngine(&federationtypes.FederationConfig{MaxFragments: 10, MaxFragmentBytes: 28}, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	// 查询末尾的语法错误说明检查发生在解析之前
+	var builder strings.Builder
+	builder.WriteString("query { ...F0 }\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&builder, "fragment F%d on Query { a }\n", i)
+	}
+	builder.WriteString("{")
+	err = engine.preScanQuery(builder.String())
+	if federationErr, ok := err.(*errors.FederationError); !ok || federationErr.Code != errors.ErrCodeQueryValidation || federationErr.Extensions["maxFragments"] != 10 {
+		t.Errorf("Expected fragment count error before parsing, got %v", err)
+	}
+
+	if err := engine.preScanQuery("query { ...F }\nfragment F on Query { a b c }"); err == nil {
+		t.Error("Expected oversized fragment definitions to be rejected")
+	}
+	engine.federationConfig.MaxFragmentBytes = 29
+	if err := engine.preScanQuery("query { ...F }\nfragment F on Query { a b c }"); err != nil {
+		t.Errorf("Fragment within the byte limit should be accepted, got %v", err)
+	}
+}
+
+func TestEngine_PreScanQuery(t *testing.T) {
+	newEngine := func(limits *federationtypes.PreParseLimitsConfig) *Engine {
+		engine, err := NewEngine(&federationtypes.FederationConfig{PreParseLimits: limits}, utils.NewLogger("test"))
+		if err != nil {
+			t.Fatalf("NewEngine() error = %v", err)
+		}
+		return engine
+	}
+
+	braceBomb := strings.Repeat("{", 100000)
+
+	t.Run("disabled", func(t *testing.T) {
+		if err := newEngine(nil).preScanQuery(braceBomb); err != nil {
+			t.Errorf("Expected no pre-parse check without preParseLimits, got %v", err)
+		}
+	})
+
+	t.Run("brace bomb rejected before parsing", func(t *testing.T) {
+		engine := newEngine(&federationtypes.PreParseLimitsConfig{})
+		_, err := engine.ExecuteQuery(&federationtypes.ExecutionContext{RequestID: "bomb"}, &federationtypes.GraphQLRequest{Query: braceBomb})
+		if err == nil {
+			t.Fatal("Expected brace bomb to be rejected")
+		}
+		federationErr, ok := err.(*errors.FederationError)
+		if !ok {
+			t.Fatalf("Expected pre-parse FederationError, got %T: %v", err, err)
+		}
+		if federationErr.Code != errors.ErrCodeQueryComplexity || federationErr.Extensions["limit"] != "nesting" {
+			t.Errorf("Expected nesting pre-parse limit error, got %v %v", federationErr.Code, federationErr.Extensions)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		engine := newEngine(&federationtypes.PreParseLimitsConfig{MaxBytes: 64, MaxNesting: 3, MaxCost: 8})
+		tests := []struct {
+			query string
+			limit string
+		}{
+			{`{ a { b { c } } }`, ""},
+			{`{ a { b { c { d } } } }`, "nesting"},
+			{`{ a { b } c { d } e { f } g { h } }`, "cost"},
+			{`{ ` + strings.Repeat("field ", 20) + `}`, "bytes"},
+		}
+		for _, tt := range tests {
+			err := engine.preScanQuery(tt.query)
+			if tt.limit == "" {
+				if err != nil {
+					t.Errorf("preScanQuery(%q) unexpected error: %v", tt.query, err)
+				}
+				continue
+			}
+			federationErr, ok := err.(*errors.FederationError)
+			if !ok || federationErr.Extensions["limit"] != tt.limit {
+				t.Errorf("preScanQuery(%q) = %v, want %s limit error", tt.query, err, tt.limit)
+			}
+		}
+	})
+}
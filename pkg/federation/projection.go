@@ -0,0 +1,198 @@
+package federation
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+const typenameField = "__typename"
+
+// findOperation 按操作名查找操作定义，未指定时返回第一个操作
+func findOperation(query *federationtypes.ParsedQuery) (*ast.Document, int) {
+	document, ok := query.AST.(*ast.Document)
+	if !ok || document == nil {
+		return nil, -1
+	}
+
+	for i := range document.OperationDefinitions {
+		if query.Operation == "" || document.OperationDefinitionNameString(i) == query.Operation {
+			return document, i
+		}
+	}
+	return document, -1
+}
+
+// buildProjection 从查询的操作选择集构建投影树
+func buildProjection(query *federationtypes.ParsedQuery) *federationtypes.SelectionNode {
+	document, operationRef := findOperation(query)
+	if operationRef == -1 {
+		return nil
+	}
+
+	root := &federationtypes.SelectionNode{Children: make(map[string]*federationtypes.SelectionNode)}
+	addSelections(document, document.OperationDefinitions[operationRef].SelectionSet, root, make(map[string]bool))
+	return root
+}
+
+// addSelections 将选择集中的字段合并到投影节点，片段的字段并入所在层级
+func addSelections(document *ast.Document, selectionSet int, node *federationtypes.SelectionNode, visitedFragments map[string]bool) {
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			field := document.Fields[selection.Ref]
+			key := document.FieldAliasOrNameString(selection.Ref)
+
+			child, exists := node.Children[key]
+			if !exists {
+				child = &federationtypes.SelectionNode{}
+				node.Children[key] = child
+			}
+			if field.HasSelections {
+				if child.Children == nil {
+					child.Children = make(map[string]*federationtypes.SelectionNode)
+				}
+				addSelections(document, field.SelectionSet, child, visitedFragments)
+			}
+
+		case ast.SelectionKindInlineFragment:
+			if document.InlineFragments[selection.Ref].HasSelections {
+				addSelections(document, document.InlineFragments[selection.Ref].SelectionSet, node, visitedFragments)
+			}
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+
+			for i := range document.FragmentDefinitions {
+				if document.FragmentDefinitionNameString(i) == name {
+					addSelections(document, document.FragmentDefinitions[i].SelectionSet, node, visitedFragments)
+				}
+			}
+			delete(visitedFragments, name)
+		}
+	}
+}
+
+// project 将数据裁剪为投影树中的字段，__typename 始终保留
+func project(node *federationtypes.SelectionNode, value interface{}) interface{} {
+	if node == nil || node.Children == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		projected := make(map[string]interface{}, len(node.Children))
+		for key, fieldValue := range v {
+			if child, ok := node.Children[key]; ok {
+				projected[key] = project(child, fieldValue)
+			} else if key == typenameField {
+				projected[key] = fieldValue
+			}
+		}
+		return projected
+	case []interface{}:
+		projected := make([]interface{}, len(v))
+		for i, item := range v {
+			projected[i] = project(node, item)
+		}
+		return projected
+	default:
+		return value
+	}
+}
+
+// mergeSelection 返回合并器使用的字段树：客户端选择集加上实体查询构造表示所需的路径、键字段和 @requires 字段，
+// 避免合并时丢弃后续实体查询依赖的字段
+func mergeSelection(query *federationtypes.ParsedQuery, plan *federationtypes.ExecutionPlan) *federationtypes.SelectionNode {
+	selection := buildProjection(query)
+	if selection == nil {
+		return nil
+	}
+
+	for _, fetch := range plan.EntityFetches {
+		node := selection
+		for _, key := range fetch.Path {
+			if node.Children == nil {
+				// 客户端将该字段作为叶子选择时保留其完整值
+				break
+			}
+			child, ok := node.Children[key]
+			if !ok {
+				child = &federationtypes.SelectionNode{Children: make(map[string]*federationtypes.SelectionNode)}
+				node.Children[key] = child
+			}
+			node = child
+		}
+		if node.Children == nil {
+			continue
+		}
+		for _, keyFields := range append(fetch.KeySets(), fetch.RequiredFields) {
+			for _, keyField := range keyFields {
+				if _, ok := node.Children[keyField]; !ok {
+					node.Children[keyField] = &federationtypes.SelectionNode{}
+				}
+			}
+		}
+	}
+	return selection
+}
+
+// applyStrictProjection 按客户端选择集裁剪合并后的响应数据，去除子图多返回的字段
+func (e *Engine) applyStrictProjection(query *federationtypes.ParsedQuery, response *federationtypes.GraphQLResponse) {
+	if response == nil || response.Data == nil {
+		return
+	}
+
+	projection := buildProjection(query)
+	if projection == nil {
+		return
+	}
+
+	response.Data = project(projection, response.Data)
+}
+
+// stripInjectedFields 去除规划器为构造实体表示而补充选择、客户端并未选择的 __typename、键字段和 @requires 字段。
+// 与 StrictProjection 无关，始终执行；子图自行多返回的字段仍由 StrictProjection 裁剪
+func stripInjectedFields(query *federationtypes.ParsedQuery, plan *federationtypes.ExecutionPlan, response *federationtypes.GraphQLResponse) {
+	if response == nil || response.Data == nil || plan == nil || len(plan.EntityFetches) == 0 {
+		return
+	}
+
+	projection := buildProjection(query)
+	if projection == nil {
+		return
+	}
+
+	for _, fetch := range plan.EntityFetches {
+		node := projection
+		for _, key := range fetch.Path {
+			if node == nil || node.Children == nil {
+				break
+			}
+			node = node.Children[key]
+		}
+		// 客户端将该位置作为叶子选择或未选择时保留原值
+		if node == nil || node.Children == nil {
+			continue
+		}
+
+		injected := append([]string{typenameField}, fetch.RequiredFields...)
+		for _, keyFields := range fetch.KeySets() {
+			injected = append(injected, keyFields...)
+		}
+
+		for _, target := range collectEntityTargets(response.Data, fetch.Path, nil) {
+			for _, field := range injected {
+				if _, selected := node.Children[field]; !selected {
+					delete(target.object, field)
+				}
+			}
+		}
+	}
+}
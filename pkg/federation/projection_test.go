@@ -0,0 +1,60 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/parser"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestProjection_Project(t *testing.T) {
+	query := `
+		query GetUser {
+			me: user {
+				id
+				... on User { name }
+				orders { ...OrderFields }
+			}
+		}
+		fragment OrderFields on Order { total }`
+
+	parsedQuery, err := parser.NewParser(utils.NewLogger("test")).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	data := map[string]interface{}{
+		"me": map[string]interface{}{
+			"__typename": "User",
+			"id":         "1",
+			"name":       "Ada",
+			"auditedBy":  "system",
+			"orders": []interface{}{
+				map[string]interface{}{"total": 10, "internalCost": 4},
+				nil,
+			},
+		},
+		"user": map[string]interface{}{"id": "leaked"},
+	}
+
+	expected := map[string]interface{}{
+		"me": map[string]interface{}{
+			"__typename": "User",
+			"id":         "1",
+			"name":       "Ada",
+			"orders": []interface{}{
+				map[string]interface{}{"total": 10},
+				nil,
+			},
+		},
+	}
+
+	response := &federationtypes.GraphQLResponse{Data: data}
+	(&Engine{}).applyStrictProjection(parsedQuery, response)
+
+	if !reflect.DeepEqual(response.Data, expected) {
+		t.Errorf("Unexpected projected data:\n got: %+v\nwant: %+v", response.Data, expected)
+	}
+}
@@ -0,0 +1,63 @@
+package federation
+
+import (
+	"testing"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_ValidateAgainstSchema(t *testing.T) {
+	const current = "type Query { people: [Person] } type Person { id: ID! name: String }"
+	const removedName = "type Query { people: [Person] } type Person { id: ID! }"
+
+	tests := []struct {
+		name    string
+		schema  string
+		skip    bool
+		query   string
+		wantErr bool
+	}{
+		{"known fields", current, false, `{ people { id name } }`, false},
+		{"fields in fragment", current, false, `{ people { ...PersonFields } } fragment PersonFields on Person { id name }`, false},
+		{"removed field", removedName, false, `{ people { id name } }`, true},
+		{"removed field in fragment", removedName, false, `{ people { ...PersonFields } } fragment PersonFields on Person { id name }`, true},
+		{"unknown root field", current, false, `{ books { isbn } }`, true},
+		{"validation skipped", removedName, true, `{ people { id name } }`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &federationtypes.FederationConfig{
+				Services: []federationtypes.ServiceConfig{
+					{Name: "people", Endpoint: "http://people/graphql", Schema: tt.schema, Timeout: time.Second},
+				},
+				SkipQueryValidation: tt.skip,
+			}
+			engine, err := NewEngine(config, utils.NewLogger("test"))
+			if err != nil {
+				t.Fatalf("NewEngine() error = %v", err)
+			}
+			if err := engine.Initialize(config); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+			query, err := engine.parseQuery(&federationtypes.GraphQLRequest{Query: tt.query})
+			if err != nil {
+				t.Fatalf("parseQuery() error = %v", err)
+			}
+
+			err = engine.validateAgainstSchema(query)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("validateAgainstSchema() error = %v", err)
+				}
+				return
+			}
+			if federationErr, ok := err.(*errors.FederationError); !ok || federationErr.Code != errors.ErrCodeQueryValidation {
+				t.Errorf("Expected QUERY_VALIDATION_ERROR, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package federation
+
+import (
+	"context"
+
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// requestCacheKey 返回上游调用在请求内去重缓存中的键：服务、查询文本和稳定序列化的变量。
+// 关闭缓存或不是 query 的调用时返回 false，相同的 mutation 仍需各自执行
+func (e *Engine) requestCacheKey(subQuery *federationtypes.SubQuery) (string, bool) {
+	if e.federationConfig.DisableRequestCache || operationType(subQuery.Query) != "query" {
+		return "", false
+	}
+
+	variables, err := jsonutil.MarshalStable(subQuery.Variables)
+	if err != nil {
+		return "", false
+	}
+	return subQuery.ServiceName + "\x00" + subQuery.Query + "\x00" + string(variables), true
+}
+
+// callWithRequestCache 执行上游调用。同一请求中已有相同键的调用时等待其完成并复用结果的副本，
+// shared 为 true 表示未实际发起调用，调用方不应重复记录服务健康和用量
+func (e *Engine) callWithRequestCache(ctx context.Context, call *federationtypes.ServiceCall, execCtx *federationtypes.ExecutionContext) (response *federationtypes.ServiceResponse, shared bool, err error) {
+	key, ok := e.requestCacheKey(call.SubQuery)
+	if !ok {
+		response, err = e.caller.Call(ctx, call)
+		return response, false, err
+	}
+
+	fetch, owner := execCtx.LoadOrStartFetch(key)
+	if owner {
+		response, err = e.caller.Call(ctx, call)
+		// 保存副本，调用方随后修改自己的响应不影响等待者
+		fetch.Complete(cloneServiceResponse(response), err)
+		return response, false, err
+	}
+
+	select {
+	case <-fetch.Done():
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+
+	e.requestCacheHits.Add(1)
+	e.logger.Debug("Reusing in-request upstream call", "requestId", execCtx.RequestID, "service", call.SubQuery.ServiceName)
+	return cloneServiceResponse(fetch.Response), true, fetch.Err
+}
+
+// cloneServiceResponse 深拷贝响应数据，复用同一结果的调用方各自合并时互不影响
+func cloneServiceResponse(response *federationtypes.ServiceResponse) *federationtypes.ServiceResponse {
+	if response == nil {
+		return nil
+	}
+
+	clone := *response
+	clone.Data = copyJSONValue(response.Data)
+	clone.Errors = append([]federationtypes.GraphQLError(nil), response.Errors...)
+	clone.EntityPaths = nil
+	return &clone
+}
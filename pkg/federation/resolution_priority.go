@@ -0,0 +1,71 @@
+package federation
+
+import (
+	"sort"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// resolutionPriority 返回服务配置的解析优先级，未配置的服务为 0
+func (e *Engine) resolutionPriority(serviceName string) int {
+	for i := range e.federationConfig.Services {
+		if e.federationConfig.Services[i].Name == serviceName {
+			return e.federationConfig.Services[i].ResolutionPriority
+		}
+	}
+	return 0
+}
+
+// dispatchOrder 返回同一批次内子查询的发起顺序：按服务的解析优先级从高到低，优先级相同时保持计划顺序
+func (e *Engine) dispatchOrder(subQueries []federationtypes.SubQuery) []int {
+	priorities := make([]int, len(subQueries))
+	order := make([]int, len(subQueries))
+	for i, subQuery := range subQueries {
+		priorities[i] = e.resolutionPriority(subQuery.ServiceName)
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return priorities[order[a]] > priorities[order[b]]
+	})
+	return order
+}
+
+// entityFetchOrder 返回实体查询的执行顺序。路径是后续查询路径前缀（含相同路径）的查询会为其
+// 合并父级对象或表示所需的字段，视为依赖，必须先执行；按依赖分层后，同一层级内按服务的解析
+// 优先级从高到低排列，优先级相同时保持计划顺序
+func (e *Engine) entityFetchOrder(fetches []federationtypes.EntityFetch) []int {
+	levels := make([]int, len(fetches))
+	priorities := make([]int, len(fetches))
+	order := make([]int, len(fetches))
+	for j := range fetches {
+		for i := 0; i < j; i++ {
+			if isPathPrefix(fetches[i].Path, fetches[j].Path) && levels[i]+1 > levels[j] {
+				levels[j] = levels[i] + 1
+			}
+		}
+		priorities[j] = e.resolutionPriority(fetches[j].ServiceName)
+		order[j] = j
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		if levels[order[a]] != levels[order[b]] {
+			return levels[order[a]] < levels[order[b]]
+		}
+		return priorities[order[a]] > priorities[order[b]]
+	})
+	return order
+}
+
+// isPathPrefix 判断 prefix 是否为 path 的前缀，两者相同时也成立
+func isPathPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
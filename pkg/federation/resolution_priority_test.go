@@ -0,0 +1,47 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+func TestEngine_DispatchOrder(t *testing.T) {
+	engine := &Engine{federationConfig: &federationtypes.FederationConfig{Services: []federationtypes.ServiceConfig{
+		{Name: "users"},
+		{Name: "recommendations", ResolutionPriority: 10},
+		{Name: "audit", ResolutionPriority: -1},
+	}}}
+
+	subQueries := []federationtypes.SubQuery{
+		{ServiceName: "audit"},
+		{ServiceName: "users"},
+		{ServiceName: "recommendations"},
+		{ServiceName: "books"},
+	}
+
+	// 优先级高的先发起，相同优先级保持计划顺序
+	if order := engine.dispatchOrder(subQueries); !reflect.DeepEqual(order, []int{2, 1, 3, 0}) {
+		t.Errorf("Unexpected dispatch order: %v", order)
+	}
+}
+
+func TestEngine_EntityFetchOrder(t *testing.T) {
+	engine := &Engine{federationConfig: &federationtypes.FederationConfig{Services: []federationtypes.ServiceConfig{
+		{Name: "reviews"},
+		{Name: "inventory", ResolutionPriority: 5},
+	}}}
+
+	fetches := []federationtypes.EntityFetch{
+		{ServiceName: "reviews", Path: []string{"products"}},
+		{ServiceName: "inventory", Path: []string{"products"}},
+		{ServiceName: "inventory", Path: []string{"users"}},
+		{ServiceName: "reviews", Path: []string{"products", "reviews", "author"}},
+	}
+
+	// 相同路径和子路径上的查询依赖前面的查询，只有互不依赖的层级内按优先级排列
+	if order := engine.entityFetchOrder(fetches); !reflect.DeepEqual(order, []int{2, 0, 1, 3}) {
+		t.Errorf("Unexpected entity fetch order: %v", order)
+	}
+}
@@ -0,0 +1,88 @@
+package federation
+
+import (
+	"sort"
+	"strings"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// setCookieHeader 逐条累积而不按冲突策略合并的响应头
+const setCookieHeader = "set-cookie"
+
+// recordUpstreamHeaders 配置了响应头转发时记录上游响应头
+func (e *Engine) recordUpstreamHeaders(execCtx *federationtypes.ExecutionContext, response *federationtypes.ServiceResponse) {
+	if response == nil || response.Error != nil || e.federationConfig.ResponseHeaders == nil {
+		return
+	}
+	execCtx.RecordUpstreamHeaders(response.Service, response.Headers)
+}
+
+// ResponseHeaders 按允许列表和冲突策略合并本次请求的上游响应头，返回转发给客户端的头部。
+// first/last 按服务在配置中的顺序确定，与子查询完成顺序无关；头部名称为小写，按允许列表顺序输出，
+// set-cookie 的每个值单独输出
+func (e *Engine) ResponseHeaders(execCtx *federationtypes.ExecutionContext) [][2]string {
+	config := e.federationConfig.ResponseHeaders
+	if config == nil || len(config.Allowlist) == 0 || execCtx == nil {
+		return nil
+	}
+
+	upstream := execCtx.UpstreamHeaders()
+	rank := make(map[string]int, len(e.federationConfig.Services))
+	for i, service := range e.federationConfig.Services {
+		rank[service.Name] = i
+	}
+	sort.SliceStable(upstream, func(i, j int) bool {
+		return rank[upstream[i].Service] < rank[upstream[j].Service]
+	})
+	var headers [][2]string
+	for _, name := range config.Allowlist {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		var values []string
+		for _, recorded := range upstream {
+			if value := headerValue(recorded.Headers, name); value != "" {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		for _, value := range mergeHeaderValues(name, values, config.ConflictPolicy) {
+			headers = append(headers, [2]string{name, value})
+		}
+	}
+	return headers
+}
+
+// mergeHeaderValues 按冲突策略合并各服务返回的同名头部值
+func mergeHeaderValues(name string, values []string, policy string) []string {
+	if name == setCookieHeader {
+		var cookies []string
+		for _, value := range values {
+			cookies = append(cookies, strings.Split(value, "\n")...)
+		}
+		return cookies
+	}
+
+	switch policy {
+	case federationtypes.HeaderConflictLast:
+		return values[len(values)-1:]
+	case federationtypes.HeaderConflictCombine:
+		seen := make(map[string]bool)
+		var combined []string
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				part = strings.TrimSpace(part)
+				if part != "" && !seen[part] {
+					seen[part] = true
+					combined = append(combined, part)
+				}
+			}
+		}
+		return []string{strings.Join(combined, ", ")}
+	default:
+		return values[:1]
+	}
+}
@@ -0,0 +1,118 @@
+package federation
+
+import (
+	"sync"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// DefaultMaxResponseSizeOperations 单独统计响应大小的操作名数量上限
+const DefaultMaxResponseSizeOperations = 50
+
+// 未命名操作和超出上限的操作名使用的分段
+const (
+	anonymousOperation = "anonymous"
+	otherOperations    = "other"
+)
+
+// ResponseSizeStats 序列化后响应大小的直方图，总体及按操作名分段
+type ResponseSizeStats struct {
+	All        utils.HistogramSnapshot            `json:"all"`
+	Operations map[string]utils.HistogramSnapshot `json:"operations"`
+}
+
+// responseSizeMetrics 响应大小直方图，操作名分段数量有上限
+type responseSizeMetrics struct {
+	buckets       []int64
+	maxOperations int
+	all           *utils.Histogram
+
+	mutex      sync.RWMutex
+	operations map[string]*utils.Histogram
+}
+
+// configureResponseSize 按配置重置响应大小直方图
+func (e *Engine) configureResponseSize(config *federationtypes.FederationConfig) {
+	sizeConfig := config.ResponseSize
+	if sizeConfig == nil {
+		sizeConfig = &federationtypes.ResponseSizeConfig{}
+	}
+
+	maxOperations := sizeConfig.MaxOperations
+	if maxOperations <= 0 {
+		maxOperations = DefaultMaxResponseSizeOperations
+	}
+
+	e.responseSizes.Store(&responseSizeMetrics{
+		buckets:       sizeConfig.Buckets,
+		maxOperations: maxOperations,
+		all:           utils.NewHistogram(sizeConfig.Buckets),
+		operations:    make(map[string]*utils.Histogram),
+	})
+}
+
+// RecordResponseSize 记录一次序列化后响应体的字节数，由响应序列化处调用一次
+func (e *Engine) RecordResponseSize(operationName string, size int) {
+	metrics := e.responseSizes.Load()
+	if metrics == nil || size < 0 {
+		return
+	}
+
+	metrics.all.Observe(int64(size))
+	metrics.operationHistogram(operationName).Observe(int64(size))
+}
+
+// operationHistogram 返回操作名对应的直方图，分段数量达到上限后新的操作名计入 other
+func (m *responseSizeMetrics) operationHistogram(operationName string) *utils.Histogram {
+	if operationName == "" {
+		operationName = anonymousOperation
+	}
+
+	m.mutex.RLock()
+	histogram, ok := m.operations[operationName]
+	m.mutex.RUnlock()
+	if ok {
+		return histogram
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if histogram, ok := m.operations[operationName]; ok {
+		return histogram
+	}
+	// other 分段不占用操作名配额
+	named := len(m.operations)
+	if _, ok := m.operations[otherOperations]; ok {
+		named--
+	}
+	if named >= m.maxOperations {
+		operationName = otherOperations
+		if histogram, ok := m.operations[operationName]; ok {
+			return histogram
+		}
+	}
+
+	histogram = utils.NewHistogram(m.buckets)
+	m.operations[operationName] = histogram
+	return histogram
+}
+
+// GetResponseSizeStats 获取响应大小直方图
+func (e *Engine) GetResponseSizeStats() ResponseSizeStats {
+	stats := ResponseSizeStats{Operations: make(map[string]utils.HistogramSnapshot)}
+
+	metrics := e.responseSizes.Load()
+	if metrics == nil {
+		return stats
+	}
+
+	stats.All = metrics.all.Snapshot()
+	metrics.mutex.RLock()
+	defer metrics.mutex.RUnlock()
+	for operationName, histogram := range metrics.operations {
+		stats.Operations[operationName] = histogram.Snapshot()
+	}
+	return stats
+}
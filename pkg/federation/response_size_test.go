@@ -0,0 +1,41 @@
+package federation
+
+import (
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestEngine_RecordResponseSize(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		ResponseSize: &federationtypes.ResponseSizeConfig{Buckets: []int64{1024, 4096}, MaxOperations: 1},
+	}
+	engine, err := NewEngine(config, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	engine.RecordResponseSize("GetUser", 1500)
+	engine.RecordResponseSize("GetUser", 512)
+	engine.RecordResponseSize("ListOrders", 8192)
+	engine.RecordResponseSize("ListProducts", 100)
+
+	stats := engine.GetMetrics()["response_size"].(ResponseSizeStats)
+	if stats.All.Count != 4 || stats.All.Sum != 1500+512+8192+100 {
+		t.Errorf("Unexpected overall histogram: %+v", stats.All)
+	}
+
+	getUser := stats.Operations["GetUser"]
+	if getUser.Count != 2 || getUser.Sum != 2012 {
+		t.Fatalf("Unexpected GetUser histogram: %+v", getUser)
+	}
+	if getUser.Buckets[0].Count != 1 || getUser.Buckets[1].Count != 2 || getUser.Buckets[2].Count != 2 {
+		t.Errorf("Expected 512 in the 1 KiB bucket and 1500 in the 4 KiB bucket, got %+v", getUser.Buckets)
+	}
+
+	// 超出操作名上限的操作合并到 other
+	if len(stats.Operations) != 2 || stats.Operations["other"].Count != 2 {
+		t.Errorf("Expected overflow operations in other, got %+v", stats.Operations)
+	}
+}
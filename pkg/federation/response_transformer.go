@@ -0,0 +1,54 @@
+package federation
+
+import (
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// ResponseTransformerFunc 将函数适配为 ResponseTransformer
+type ResponseTransformerFunc func(ctx *federationtypes.QueryContext, response *federationtypes.GraphQLResponse) error
+
+// Transform 调用函数本身
+func (f ResponseTransformerFunc) Transform(ctx *federationtypes.QueryContext, response *federationtypes.GraphQLResponse) error {
+	return f(ctx, response)
+}
+
+// AddResponseTransformer 注册响应转换器，多个转换器按注册顺序执行。未注册时不改写响应
+func (e *Engine) AddResponseTransformer(transformer federationtypes.ResponseTransformer) {
+	if transformer == nil {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.responseTransformers = append(e.responseTransformers, transformer)
+}
+
+// transformResponse 依次执行已注册的响应转换器。响应可能与查询缓存或合并的并发请求共享，
+// 转换器作用于深拷贝，任一转换器失败时返回内部错误
+func (e *Engine) transformResponse(ctx *federationtypes.ExecutionContext, response *federationtypes.GraphQLResponse) (*federationtypes.GraphQLResponse, error) {
+	e.mutex.RLock()
+	transformers := e.responseTransformers
+	e.mutex.RUnlock()
+
+	if len(transformers) == 0 || response == nil {
+		return response, nil
+	}
+
+	transformed := cloneResponse(response)
+	transformed.Data = copyJSONValue(response.Data)
+	if response.Extensions != nil {
+		transformed.Extensions = copyJSONValue(response.Extensions).(map[string]interface{})
+	}
+	transformed.Errors = append([]federationtypes.GraphQLError(nil), response.Errors...)
+
+	for _, transformer := range transformers {
+		if err := transformer.Transform(ctx.QueryContext, transformed); err != nil {
+			e.logger.Error("Response transformer failed", "requestId", ctx.RequestID, "error", err)
+			return nil, errors.NewInternalError("response transformation failed: "+err.Error(), errors.WithCause(err))
+		}
+	}
+
+	return transformed, nil
+}
@@ -0,0 +1,80 @@
+package federation
+
+import (
+	"sync/atomic"
+
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// serviceUsageTotals 单个服务累计的上游调用次数和字节数
+type serviceUsageTotals struct {
+	calls         atomic.Int64
+	requestBytes  atomic.Int64
+	responseBytes atomic.Int64
+}
+
+// recordServiceUsage 将一次服务调用的用量记入请求上下文和引擎累计值。
+// 累计值只记录已配置的服务，避免指标随任意服务名无限增长
+func (e *Engine) recordServiceUsage(execCtx *federationtypes.ExecutionContext, subQuery *federationtypes.SubQuery, response *federationtypes.ServiceResponse) {
+	if response == nil {
+		return
+	}
+
+	requestBytes := requestBodySize(subQuery, response)
+	responseBytes := responseBodySize(response)
+	execCtx.RecordServiceUsage(subQuery.ServiceName, requestBytes, responseBytes)
+
+	if !e.isConfiguredService(subQuery.ServiceName) {
+		return
+	}
+
+	value, _ := e.serviceUsage.LoadOrStore(subQuery.ServiceName, &serviceUsageTotals{})
+	totals := value.(*serviceUsageTotals)
+	totals.calls.Add(1)
+	totals.requestBytes.Add(requestBytes)
+	totals.responseBytes.Add(responseBytes)
+}
+
+// isConfiguredService 判断服务是否在当前配置中
+func (e *Engine) isConfiguredService(serviceName string) bool {
+	for _, service := range e.federationConfig.Services {
+		if service.Name == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceUsageMetrics 返回指定服务的累计用量，调用方需持有 e.mutex
+func (e *Engine) serviceUsageMetrics(services []string) map[string]federationtypes.ServiceUsage {
+	usage := make(map[string]federationtypes.ServiceUsage, len(services))
+	for _, name := range services {
+		var snapshot federationtypes.ServiceUsage
+		if value, ok := e.serviceUsage.Load(name); ok {
+			totals := value.(*serviceUsageTotals)
+			snapshot.Calls = totals.calls.Load()
+			snapshot.RequestBytes = totals.requestBytes.Load()
+			snapshot.ResponseBytes = totals.responseBytes.Load()
+		}
+		usage[name] = snapshot
+	}
+	return usage
+}
+
+// requestBodySize 返回请求体大小，调用器未提供时按序列化结果估算
+func requestBodySize(subQuery *federationtypes.SubQuery, response *federationtypes.ServiceResponse) int64 {
+	if response.RequestSize > 0 {
+		return response.RequestSize
+	}
+
+	body, err := jsonutil.Marshal(&federationtypes.GraphQLRequest{
+		Query:         subQuery.Query,
+		Variables:     subQuery.Variables,
+		OperationName: subQuery.OperationName,
+	})
+	if err != nil {
+		return 0
+	}
+	return int64(len(body))
+}
@@ -0,0 +1,248 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// maxShadowInFlight 同时进行的镜像调用上限，超出时跳过镜像而不是堆积 goroutine
+const maxShadowInFlight = 64
+
+// defaultShadowTimeout 服务和查询均未配置超时时镜像调用使用的超时
+const defaultShadowTimeout = 10 * time.Second
+
+// ShadowStats 单个服务镜像流量的对比统计
+type ShadowStats struct {
+	Calls        int64         `json:"calls"`        // 已发出的镜像调用
+	Matches      int64         `json:"matches"`      // 响应结构与主调用一致
+	Mismatches   int64         `json:"mismatches"`   // 响应结构与主调用不一致
+	Failures     int64         `json:"failures"`     // 镜像调用失败
+	Dropped      int64         `json:"dropped"`      // 镜像调用过多而跳过
+	LatencyDelta time.Duration `json:"latencyDelta"` // 镜像与主调用的平均延迟差（镜像减主调用）
+}
+
+// shadowTotals 单个服务累计的镜像流量统计
+type shadowTotals struct {
+	sampled      atomic.Int64 // 参与采样的主调用次数
+	calls        atomic.Int64
+	matches      atomic.Int64
+	mismatches   atomic.Int64
+	failures     atomic.Int64
+	dropped      atomic.Int64
+	latencyDelta atomic.Int64 // 纳秒，累计值
+}
+
+// ShadowServiceName 返回镜像调用使用的服务名，与主服务的健康状态、重试和令牌缓存相互隔离。
+// 服务名必须是合法的 GraphQL 名称，因此不会与已配置的服务冲突
+func ShadowServiceName(serviceName string) string {
+	return serviceName + "-shadow"
+}
+
+// shadowTotalsFor 返回服务的镜像统计，不存在时创建
+func (e *Engine) shadowTotalsFor(serviceName string) *shadowTotals {
+	value, _ := e.shadowTraffic.LoadOrStore(serviceName, &shadowTotals{})
+	return value.(*shadowTotals)
+}
+
+// shouldShadow 按配置比例判断本次调用是否镜像。按调用计数均匀采样，
+// 第 n 次调用在 floor(n*p/100) 增加时镜像，长期比例与配置一致
+func shouldShadow(totals *shadowTotals, percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	n := totals.sampled.Add(1)
+	if percent >= 100 {
+		return true
+	}
+	return math.Floor(float64(n)*percent/100) > math.Floor(float64(n-1)*percent/100)
+}
+
+// mirrorSubQuery 按服务配置将子查询镜像到候选端点，异步对比响应结构和延迟。
+// 镜像调用使用独立的上下文，结果只计入统计，不影响主响应；只镜像 query，mutation 重放会产生副作用
+func (e *Engine) mirrorSubQuery(call *federationtypes.ServiceCall, primary *federationtypes.ServiceResponse) {
+	service := call.Service
+	if service.ShadowEndpoint == "" || primary == nil || primary.Error != nil {
+		return
+	}
+	if call.SubQuery == nil || operationType(call.SubQuery.Query) != "query" {
+		return
+	}
+
+	totals := e.shadowTotalsFor(service.Name)
+	if !shouldShadow(totals, service.ShadowPercent) {
+		return
+	}
+
+	if e.shadowInFlight.Add(1) > maxShadowInFlight {
+		e.shadowInFlight.Add(-1)
+		totals.dropped.Add(1)
+		return
+	}
+
+	// 主响应随后会被合并修改，先在当前 goroutine 中计算结构签名
+	primaryShape := responseShape(primary)
+	primaryLatency := primary.Latency
+
+	shadowService := *service
+	shadowService.Name = ShadowServiceName(service.Name)
+	shadowService.Endpoint = service.ShadowEndpoint
+	shadowService.ShadowEndpoint = ""
+	shadowService.MaxRetries = 0
+	shadowService.HedgeAfter = 0
+
+	subQuery := *call.SubQuery
+	subQuery.ServiceName = shadowService.Name
+	subQuery.Headers = make(map[string]string, len(call.SubQuery.Headers))
+	for key, value := range call.SubQuery.Headers {
+		subQuery.Headers[key] = value
+	}
+
+	timeout := service.Timeout
+	if timeout <= 0 {
+		timeout = e.federationConfig.QueryTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	shadowCall := &federationtypes.ServiceCall{
+		Service:   &shadowService,
+		SubQuery:  &subQuery,
+		Context:   call.Context,
+		StartTime: time.Now(),
+	}
+
+	go func() {
+		defer e.shadowInFlight.Add(-1)
+		defer func() {
+			if r := recover(); r != nil {
+				totals.failures.Add(1)
+				e.logger.Error("Shadow call panicked", "service", service.Name, "panic", r)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		totals.calls.Add(1)
+		startTime := time.Now()
+		response, err := e.caller.Call(ctx, shadowCall)
+		if err == nil && response != nil {
+			err = response.Error
+		}
+		if err != nil || response == nil {
+			totals.failures.Add(1)
+			e.logger.Debug("Shadow call failed", "service", service.Name, "endpoint", service.ShadowEndpoint, "error", err)
+			return
+		}
+
+		latency := response.Latency
+		if latency <= 0 {
+			latency = time.Since(startTime)
+		}
+		totals.latencyDelta.Add(int64(latency - primaryLatency))
+
+		if shape := responseShape(response); shape == primaryShape {
+			totals.matches.Add(1)
+		} else {
+			totals.mismatches.Add(1)
+			e.logger.Debug("Shadow response shape mismatch",
+				"service", service.Name,
+				"endpoint", service.ShadowEndpoint,
+				"primary", primaryShape,
+				"shadow", shape,
+			)
+		}
+	}()
+}
+
+// GetShadowStats 返回配置了镜像端点的服务的镜像统计
+func (e *Engine) GetShadowStats() map[string]ShadowStats {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	names, _ := e.metricsServices(MetricsFilter{})
+	return e.shadowMetrics(names)
+}
+
+// shadowMetrics 返回 services 中配置了镜像端点的服务的镜像统计，调用方需持有 e.mutex
+func (e *Engine) shadowMetrics(services []string) map[string]ShadowStats {
+	selected := serviceSelection(services)
+	stats := make(map[string]ShadowStats)
+	for _, service := range e.federationConfig.Services {
+		if service.ShadowEndpoint == "" || !selected[service.Name] {
+			continue
+		}
+
+		var snapshot ShadowStats
+		if value, ok := e.shadowTraffic.Load(service.Name); ok {
+			totals := value.(*shadowTotals)
+			snapshot.Calls = totals.calls.Load()
+			snapshot.Matches = totals.matches.Load()
+			snapshot.Mismatches = totals.mismatches.Load()
+			snapshot.Failures = totals.failures.Load()
+			snapshot.Dropped = totals.dropped.Load()
+			if compared := snapshot.Matches + snapshot.Mismatches; compared > 0 {
+				snapshot.LatencyDelta = time.Duration(totals.latencyDelta.Load() / compared)
+			}
+		}
+		stats[service.Name] = snapshot
+	}
+	return stats
+}
+
+// responseShape 返回响应的结构签名：对象键、值类型和列表长度，忽略标量值。
+// 错误只比较条数和路径
+func responseShape(response *federationtypes.ServiceResponse) string {
+	var builder strings.Builder
+	writeShape(&builder, response.Data)
+	builder.WriteString("|errors:")
+	for _, graphQLError := range response.Errors {
+		fmt.Fprintf(&builder, "%v;", graphQLError.Path)
+	}
+	return builder.String()
+}
+
+// writeShape 递归写入值的结构签名
+func writeShape(builder *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		builder.WriteString("null")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		builder.WriteByte('{')
+		for _, key := range keys {
+			builder.WriteString(key)
+			builder.WriteByte(':')
+			writeShape(builder, v[key])
+			builder.WriteByte(',')
+		}
+		builder.WriteByte('}')
+	case []interface{}:
+		builder.WriteByte('[')
+		for _, item := range v {
+			writeShape(builder, item)
+			builder.WriteByte(',')
+		}
+		builder.WriteByte(']')
+	case string:
+		builder.WriteString("string")
+	case bool:
+		builder.WriteString("bool")
+	case float32, float64, int, int32, int64, uint, uint32, uint64:
+		builder.WriteString("number")
+	default:
+		fmt.Fprintf(builder, "%T", v)
+	}
+}
@@ -0,0 +1,116 @@
+package federation
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// applyQueryTimeouts 按 SoftQueryTimeout 和 HardQueryTimeout 设置本次执行的截止时间：软超时记录在
+// 执行上下文中，由子查询收集阶段检查；硬超时作为整个执行的上下文截止时间
+func (e *Engine) applyQueryTimeouts(ctx context.Context, execCtx *federationtypes.ExecutionContext) (context.Context, context.CancelFunc) {
+	now := time.Now()
+	if soft := e.federationConfig.SoftQueryTimeout; soft > 0 {
+		execCtx.SoftDeadline = now.Add(soft)
+	}
+
+	if hard := e.federationConfig.HardQueryTimeout; hard > 0 {
+		return context.WithDeadline(ctx, now.Add(hard))
+	}
+	return ctx, func() {}
+}
+
+// hardTimeoutError 执行超过硬超时时返回 TIMEOUT_ERROR，否则返回 nil
+func (e *Engine) hardTimeoutError(ctx context.Context) error {
+	hard := e.federationConfig.HardQueryTimeout
+	if hard <= 0 || !stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+
+	return errors.NewFederationError(errors.ErrCodeTimeout,
+		fmt.Sprintf("query exceeded hard timeout of %s", hard),
+		errors.WithExtension("reason", "HARD_TIMEOUT"),
+		errors.WithExtension("timeoutMs", hard.Milliseconds()),
+	)
+}
+
+// softDeadlinePassed 软超时已启用且已到达时返回 true
+func softDeadlinePassed(execCtx *federationtypes.ExecutionContext) bool {
+	return !execCtx.SoftDeadline.IsZero() && !time.Now().Before(execCtx.SoftDeadline)
+}
+
+// softTimeoutTimer 返回软超时到达时触发的通道及其释放函数，未启用软超时时通道为 nil，永不触发
+func softTimeoutTimer(execCtx *federationtypes.ExecutionContext) (<-chan time.Time, func()) {
+	if execCtx.SoftDeadline.IsZero() {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(time.Until(execCtx.SoftDeadline))
+	return timer.C, func() { timer.Stop() }
+}
+
+// fillSoftTimeoutResponses 为软超时时仍未完成的子查询补上超时响应，返回补上的数量
+func (e *Engine) fillSoftTimeoutResponses(subQueries []federationtypes.SubQuery, responses []*federationtypes.ServiceResponse, execCtx *federationtypes.ExecutionContext) int {
+	timeout := e.federationConfig.SoftQueryTimeout
+	latency := time.Since(execCtx.SoftDeadline) + timeout
+
+	filled := 0
+	for i := range subQueries {
+		if responses[i] != nil {
+			continue
+		}
+		responses[i] = softTimeoutResponse(&subQueries[i], timeout, latency)
+		filled++
+	}
+	return filled
+}
+
+// softTimeoutResponse 构建软超时时未完成的子查询响应：子查询的根字段为 null，并附带超时错误
+func softTimeoutResponse(subQuery *federationtypes.SubQuery, timeout, latency time.Duration) *federationtypes.ServiceResponse {
+	keys := subQueryRootKeys(subQuery)
+	data := make(map[string]interface{}, len(keys))
+	graphqlErrors := make([]federationtypes.GraphQLError, 0, len(keys))
+
+	for _, key := range keys {
+		data[key] = nil
+
+		timeoutErr := errors.NewTimeoutError(subQuery.ServiceName,
+			fmt.Sprintf("service %s did not respond before soft timeout of %s", subQuery.ServiceName, timeout),
+			errors.WithPath(key),
+			errors.WithExtension("reason", "SOFT_TIMEOUT"),
+			errors.WithExtension("timeoutMs", timeout.Milliseconds()),
+		)
+		graphqlErrors = append(graphqlErrors, federationtypes.GraphQLError{
+			Message:    timeoutErr.Message,
+			Path:       []interface{}{key},
+			Extensions: timeoutErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+		})
+	}
+
+	return &federationtypes.ServiceResponse{
+		Service: subQuery.ServiceName,
+		Data:    data,
+		Errors:  graphqlErrors,
+		Latency: latency,
+	}
+}
+
+// softTimeoutEntityError 构建软超时时未完成的实体查询错误，实体字段不再合并
+func (e *Engine) softTimeoutEntityError(fetch federationtypes.EntityFetch, path []interface{}) federationtypes.GraphQLError {
+	timeout := e.federationConfig.SoftQueryTimeout
+	timeoutErr := errors.NewTimeoutError(fetch.ServiceName,
+		fmt.Sprintf("service %s did not resolve %s fields before soft timeout of %s", fetch.ServiceName, fetch.TypeName, timeout),
+		errors.WithPath(path...),
+		errors.WithExtension("reason", "SOFT_TIMEOUT"),
+		errors.WithExtension("timeoutMs", timeout.Milliseconds()),
+	)
+	return federationtypes.GraphQLError{
+		Message:    timeoutErr.Message,
+		Path:       path,
+		Extensions: timeoutErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+	}
+}
@@ -0,0 +1,41 @@
+package federation
+
+import (
+	stderrors "errors"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// withSubQueryDebug 调试模式下在子查询失败的错误扩展中附带实际发送的查询和脱敏后的变量，
+// 生产模式原样返回
+func (e *Engine) withSubQueryDebug(call *federationtypes.ServiceCall, err error) error {
+	if !e.federationConfig.DebugMode || call == nil || call.SubQuery == nil || call.Service == nil {
+		return err
+	}
+
+	variables := utils.RedactVariables(call.SubQuery.Variables, call.Service.DebugRedactVariables)
+
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) {
+		fedErr = errors.NewServiceCallError(call.Service.Name, err.Error(), errors.WithCause(err))
+	} else {
+		// 错误可能经请求内去重缓存被多个子查询共享，在副本上附加
+		annotated := *fedErr
+		annotated.Extensions = make(map[string]interface{}, len(fedErr.Extensions)+2)
+		for key, value := range fedErr.Extensions {
+			annotated.Extensions[key] = value
+		}
+		fedErr = &annotated
+	}
+
+	if fedErr.Extensions == nil {
+		fedErr.Extensions = make(map[string]interface{})
+	}
+	fedErr.Extensions[errors.ExtensionSubQuery] = call.SubQuery.Query
+	if len(variables) > 0 {
+		fedErr.Extensions[errors.ExtensionVariables] = variables
+	}
+	return fedErr
+}
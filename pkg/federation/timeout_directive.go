@@ -0,0 +1,116 @@
+package federation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// timeoutDirective 操作级指令 @timeout(service: "x", ms: 2000)，仅对本次请求覆盖指定服务的子查询超时
+const timeoutDirective = "timeout"
+
+// parseTimeoutDirectives 读取所执行操作上的 @timeout 指令，返回服务名到超时的映射。
+// 参数必须为字面量，服务须已配置，同一服务只能出现一次；超时超过上限时截断为上限
+func (e *Engine) parseTimeoutDirectives(query *federationtypes.ParsedQuery) (map[string]time.Duration, error) {
+	document, operationRef := findOperation(query)
+	if document == nil {
+		return nil, nil
+	}
+
+	// @timeout 只能用在操作定义上，字段等位置上的指令会被转发到子图
+	operationDirectives := make(map[int]bool)
+	for i := range document.OperationDefinitions {
+		for _, ref := range document.OperationDefinitions[i].Directives.Refs {
+			operationDirectives[ref] = true
+		}
+	}
+	for ref := range document.Directives {
+		if document.DirectiveNameString(ref) == timeoutDirective && !operationDirectives[ref] {
+			return nil, timeoutDirectiveError(document, ref, "directive @timeout is only allowed on operations")
+		}
+	}
+
+	if operationRef == -1 {
+		return nil, nil
+	}
+
+	var timeouts map[string]time.Duration
+	for _, ref := range document.OperationDefinitions[operationRef].Directives.Refs {
+		if document.DirectiveNameString(ref) != timeoutDirective {
+			continue
+		}
+
+		service, ok := document.DirectiveArgumentValueByName(ref, []byte("service"))
+		if !ok || service.Kind != ast.ValueKindString {
+			return nil, timeoutDirectiveError(document, ref, "directive @timeout requires a string literal service argument")
+		}
+		serviceName := document.StringValueContentString(service.Ref)
+		if !e.hasService(serviceName) {
+			return nil, timeoutDirectiveError(document, ref, fmt.Sprintf("directive @timeout references unknown service %q", serviceName))
+		}
+		if _, exists := timeouts[serviceName]; exists {
+			return nil, timeoutDirectiveError(document, ref, fmt.Sprintf("directive @timeout is repeated for service %q", serviceName))
+		}
+
+		ms, ok := document.DirectiveArgumentValueByName(ref, []byte("ms"))
+		if !ok || ms.Kind != ast.ValueKindInteger || document.IntValueAsInt(ms.Ref) <= 0 {
+			return nil, timeoutDirectiveError(document, ref, "directive @timeout requires a positive integer literal ms argument")
+		}
+
+		timeout := time.Duration(document.IntValueAsInt(ms.Ref)) * time.Millisecond
+		if maxTimeout := e.maxDirectiveTimeout(); maxTimeout > 0 && timeout > maxTimeout {
+			e.logger.Debug("Clamping @timeout to the configured maximum", "service", serviceName, "requested", timeout, "max", maxTimeout)
+			timeout = maxTimeout
+		}
+
+		if timeouts == nil {
+			timeouts = make(map[string]time.Duration)
+		}
+		timeouts[serviceName] = timeout
+	}
+
+	return timeouts, nil
+}
+
+// maxDirectiveTimeout 返回 @timeout 可设置的上限，未配置 MaxDirectiveTimeout 时使用 QueryTimeout
+func (e *Engine) maxDirectiveTimeout() time.Duration {
+	if e.federationConfig.MaxDirectiveTimeout > 0 {
+		return e.federationConfig.MaxDirectiveTimeout
+	}
+	return e.federationConfig.QueryTimeout
+}
+
+// hasService 判断服务是否已配置
+func (e *Engine) hasService(name string) bool {
+	for _, service := range e.federationConfig.Services {
+		if service.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutDirectiveError 构建 @timeout 指令的验证错误
+func timeoutDirectiveError(document *ast.Document, ref int, message string) error {
+	at := document.Directives[ref].At
+	return errors.NewQueryValidationError(message,
+		errors.WithLocation(int(at.LineStart), int(at.CharStart)),
+		errors.WithExtension("directive", timeoutDirective),
+	)
+}
+
+// serviceWithDirectiveTimeout 请求通过 @timeout 覆盖了服务超时时返回超时替换后的服务配置副本，否则返回原配置
+func serviceWithDirectiveTimeout(execCtx *federationtypes.ExecutionContext, service *federationtypes.ServiceConfig) (*federationtypes.ServiceConfig, bool) {
+	timeout, ok := execCtx.ServiceTimeouts[service.Name]
+	if !ok {
+		return service, false
+	}
+
+	overridden := *service
+	overridden.Timeout = timeout
+	return &overridden, true
+}
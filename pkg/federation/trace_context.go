@@ -0,0 +1,81 @@
+package federation
+
+import (
+	"strings"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// traceparentExtension 响应 extensions 中返回 traceparent 的键
+const traceparentExtension = "traceparent"
+
+// ensureTraceContext 确定本次请求的 traceparent：优先使用已设置的值，其次是合法的 traceparent 请求头，
+// 都没有时生成新的根追踪。结果写回 QueryContext.Traceparent
+func ensureTraceContext(ctx *federationtypes.ExecutionContext) string {
+	if ctx.QueryContext == nil {
+		ctx.QueryContext = &federationtypes.QueryContext{RequestID: ctx.RequestID}
+	}
+
+	if trace, ok := utils.ParseTraceparent(ctx.QueryContext.Traceparent); ok {
+		ctx.QueryContext.Traceparent = trace.String()
+		return ctx.QueryContext.Traceparent
+	}
+
+	trace, ok := utils.ParseTraceparent(headerValue(ctx.QueryContext.Headers, utils.TraceparentHeader))
+	if !ok {
+		trace = utils.NewTraceContext()
+	}
+	ctx.QueryContext.Traceparent = trace.String()
+	return ctx.QueryContext.Traceparent
+}
+
+// subQueryTraceHeaders 返回附加了子 span traceparent 的子查询头部副本，客户端的 tracestate 原样转发。
+// 请求没有追踪上下文时原样返回
+func subQueryTraceHeaders(execCtx *federationtypes.ExecutionContext, headers map[string]string) map[string]string {
+	if execCtx == nil || execCtx.QueryContext == nil {
+		return headers
+	}
+
+	trace, ok := utils.ParseTraceparent(execCtx.QueryContext.Traceparent)
+	if !ok {
+		return headers
+	}
+
+	traced := make(map[string]string, len(headers)+2)
+	for key, value := range headers {
+		traced[key] = value
+	}
+	traced[utils.TraceparentHeader] = trace.Child().String()
+	if tracestate := headerValue(execCtx.QueryContext.Headers, utils.TracestateHeader); tracestate != "" {
+		traced[utils.TracestateHeader] = tracestate
+	}
+	return traced
+}
+
+// attachTraceparent 在响应副本的 extensions 中返回 traceparent，不修改可能被缓存或合并共享的原响应
+func attachTraceparent(response *federationtypes.GraphQLResponse, traceparent string) *federationtypes.GraphQLResponse {
+	if response == nil || traceparent == "" {
+		return response
+	}
+
+	traced := cloneResponse(response)
+	if traced.Extensions == nil {
+		traced.Extensions = make(map[string]interface{})
+	}
+	traced.Extensions[traceparentExtension] = traceparent
+	return traced
+}
+
+// headerValue 不区分大小写地读取头部
+func headerValue(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package federation
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// DefaultForceTraceHeader 未配置 forceHeader 时强制追踪使用的请求头
+const DefaultForceTraceHeader = "force-trace"
+
+// TraceSamplingStats 详细执行追踪的采样统计
+type TraceSamplingStats struct {
+	Rate    float64 `json:"rate"`
+	Sampled int64   `json:"sampled"` // 按比例采样的请求数
+	Forced  int64   `json:"forced"`  // 通过请求头强制追踪的请求数
+}
+
+// traceSamplingCounters 采样统计计数器
+type traceSamplingCounters struct {
+	sampled atomic.Int64
+	forced  atomic.Int64
+}
+
+// sampleTrace 按请求 ID 的哈希决定是否采样：哈希映射到 [0, 1) 后小于 rate 即采样，
+// 同一请求 ID 的结果始终相同。FNV-1a 对相近的 ID 高位分布不均，经 fmix64 混合后使用
+func sampleTrace(requestID string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(requestID))
+	return float64(mix64(hash.Sum64()))/math.Exp2(64) < rate
+}
+
+// mix64 MurmurHash3 的 fmix64 终结函数，使每个输入位均匀影响所有输出位
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// decideTraceSampling 决定本次请求是否记录详细执行追踪，结果写入 ctx.TraceSampled。
+// 强制追踪请求头优先，未配置采样时不改变已有的决定
+func (e *Engine) decideTraceSampling(ctx *federationtypes.ExecutionContext) {
+	config := e.federationConfig.TraceSampling
+	if config == nil || ctx.TraceSampled {
+		return
+	}
+
+	forceHeader := config.ForceHeader
+	if forceHeader == "" {
+		forceHeader = DefaultForceTraceHeader
+	}
+	if ctx.QueryContext != nil {
+		switch strings.ToLower(strings.TrimSpace(headerValue(ctx.QueryContext.Headers, forceHeader))) {
+		case "", "0", "false":
+		default:
+			ctx.TraceSampled = true
+			e.traceSampling.forced.Add(1)
+			return
+		}
+	}
+
+	if sampleTrace(ctx.RequestID, config.Rate) {
+		ctx.TraceSampled = true
+		e.traceSampling.sampled.Add(1)
+	}
+}
+
+// logSampledTrace 输出采样请求的详细执行追踪：各子查询 span 及耗时、服务用量和查询使用的字段
+func (e *Engine) logSampledTrace(ctx *federationtypes.ExecutionContext, query *federationtypes.ParsedQuery) {
+	if !ctx.TraceSampled {
+		return
+	}
+
+	start := ctx.StartTime
+	timings := ctx.SubQueryTimings()
+	spans := make([]map[string]interface{}, 0, len(timings))
+	for _, timing := range timings {
+		if start.IsZero() || timing.Start.Before(start) {
+			start = timing.Start
+		}
+	}
+	for _, timing := range timings {
+		spans = append(spans, map[string]interface{}{
+			"service":      timing.Service,
+			"fields":       timing.ResponseKeys,
+			"traceparent":  timing.Traceparent,
+			"startOffset":  timing.Start.Sub(start).Nanoseconds(),
+			"durationNano": timing.Duration.Nanoseconds(),
+		})
+	}
+
+	var fields []string
+	collectFieldPaths(buildProjection(query), "", &fields)
+	sort.Strings(fields)
+
+	traceparent := ""
+	if ctx.QueryContext != nil {
+		traceparent = ctx.QueryContext.Traceparent
+	}
+
+	e.logger.Info("Sampled query trace",
+		"requestId", ctx.RequestID,
+		"traceparent", traceparent,
+		"duration", time.Since(start),
+		"spans", spans,
+		"serviceUsage", ctx.ServiceUsage(),
+		"fields", fields,
+	)
+}
+
+// collectFieldPaths 将投影树展开为以点分隔的字段路径
+func collectFieldPaths(node *federationtypes.SelectionNode, prefix string, fields *[]string) {
+	if node == nil {
+		return
+	}
+	for key, child := range node.Children {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		*fields = append(*fields, path)
+		collectFieldPaths(child, path, fields)
+	}
+}
+
+// GetTraceSamplingStats 返回详细执行追踪的采样统计
+func (e *Engine) GetTraceSamplingStats() TraceSamplingStats {
+	stats := TraceSamplingStats{
+		Sampled: e.traceSampling.sampled.Load(),
+		Forced:  e.traceSampling.forced.Load(),
+	}
+	if config := e.federationConfig.TraceSampling; config != nil {
+		stats.Rate = config.Rate
+	}
+	return stats
+}
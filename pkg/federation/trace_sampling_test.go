@@ -0,0 +1,66 @@
+package federation
+
+import (
+	"fmt"
+	"testing"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestSampleTrace_DeterministicRate(t *testing.T) {
+	const total = 20000
+	const rate = 0.1
+
+	sampled := 0
+	for i := 0; i < total; i++ {
+		requestID := fmt.Sprintf("req-%d", i)
+		decision := sampleTrace(requestID, rate)
+		if decision != sampleTrace(requestID, rate) {
+			t.Fatalf("Sampling decision for %s is not deterministic", requestID)
+		}
+		if decision {
+			sampled++
+		}
+	}
+
+	if ratio := float64(sampled) / total; ratio < 0.09 || ratio > 0.11 {
+		t.Errorf("Expected about %.0f%% of requests to be sampled, got %.2f%%", rate*100, ratio*100)
+	}
+
+	if sampleTrace("req-1", 0) || !sampleTrace("req-1", 1) {
+		t.Error("Expected rate 0 to never sample and rate 1 to always sample")
+	}
+}
+
+func TestEngine_DecideTraceSampling(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		TraceSampling: &federationtypes.TraceSamplingConfig{Rate: 0},
+	}
+	engine, err := NewEngine(config, utils.NewLogger("test"))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	unsampled := &federationtypes.ExecutionContext{
+		RequestID:    "req-1",
+		QueryContext: &federationtypes.QueryContext{Headers: map[string]string{"force-trace": "0"}},
+	}
+	engine.decideTraceSampling(unsampled)
+	if unsampled.TraceSampled {
+		t.Error("Expected request to stay on the cheap path at rate 0")
+	}
+
+	forced := &federationtypes.ExecutionContext{
+		RequestID:    "req-2",
+		QueryContext: &federationtypes.QueryContext{Headers: map[string]string{"Force-Trace": "1"}},
+	}
+	engine.decideTraceSampling(forced)
+	if !forced.TraceSampled {
+		t.Error("Expected force-trace header to override the sampling rate")
+	}
+
+	if stats := engine.GetTraceSamplingStats(); stats.Forced != 1 || stats.Sampled != 0 {
+		t.Errorf("Unexpected sampling stats: %+v", stats)
+	}
+}
@@ -0,0 +1,121 @@
+package federation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// tracingVersion Apollo tracing 格式版本
+const tracingVersion = 1
+
+// tracingPhase 请求阶段的起止时间
+type tracingPhase struct {
+	start    time.Time
+	duration time.Duration
+}
+
+// tracingEnabled 判断本次请求是否输出 extensions.tracing
+func (e *Engine) tracingEnabled(ctx *federationtypes.ExecutionContext) bool {
+	return e.federationConfig.EnableTracing && ctx.Tracing
+}
+
+// recordSubQueryTiming 记录子查询耗时、span 和其返回的根字段，未请求 tracing 且未被采样时不记录
+func (e *Engine) recordSubQueryTiming(execCtx *federationtypes.ExecutionContext, subQuery *federationtypes.SubQuery, response *federationtypes.ServiceResponse, start time.Time) {
+	if (!e.tracingEnabled(execCtx) && !execCtx.TraceSampled) || response == nil {
+		return
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	execCtx.RecordSubQueryTiming(federationtypes.SubQueryTiming{
+		Service:      response.Service,
+		ResponseKeys: keys,
+		Traceparent:  headerValue(subQuery.Headers, utils.TraceparentHeader),
+		Start:        start,
+		Duration:     time.Since(start),
+	})
+}
+
+// attachTracing 按 Apollo tracing 格式组装耗时数据写入 extensions.tracing，
+// 每个子查询返回的根字段作为一个 resolver 条目，附带所属服务
+func (e *Engine) attachTracing(ctx *federationtypes.ExecutionContext, query *federationtypes.ParsedQuery, response *federationtypes.GraphQLResponse, start time.Time, parsing, validation tracingPhase) {
+	end := time.Now()
+
+	parentType := "Query"
+	fieldNames := make(map[string]string)
+	document, operationRef := findOperation(query)
+	if operationRef != -1 {
+		operation := document.OperationDefinitions[operationRef]
+		parentType = rootTypeName(operation.OperationType)
+		for _, selectionRef := range document.SelectionSets[operation.SelectionSet].SelectionRefs {
+			selection := document.Selections[selectionRef]
+			if selection.Kind == ast.SelectionKindField {
+				fieldNames[document.FieldAliasOrNameString(selection.Ref)] = document.FieldNameString(selection.Ref)
+			}
+		}
+		// 子图可能按字段名而非别名返回数据
+		for _, name := range fieldNames {
+			if _, exists := fieldNames[name]; !exists {
+				fieldNames[name] = name
+			}
+		}
+	}
+
+	index := e.currentSchemaIndex()
+	timings := ctx.SubQueryTimings()
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].Start.Before(timings[j].Start)
+	})
+
+	resolvers := make([]interface{}, 0, len(timings))
+	for _, timing := range timings {
+		for _, key := range timing.ResponseKeys {
+			fieldName, ok := fieldNames[key]
+			if !ok {
+				continue
+			}
+			resolvers = append(resolvers, map[string]interface{}{
+				"path":        []interface{}{key},
+				"parentType":  parentType,
+				"fieldName":   fieldName,
+				"returnType":  index.fields[parentType][fieldName].Type,
+				"startOffset": timing.Start.Sub(start).Nanoseconds(),
+				"duration":    timing.Duration.Nanoseconds(),
+				"service":     timing.Service,
+			})
+		}
+	}
+
+	if response.Extensions == nil {
+		response.Extensions = make(map[string]interface{})
+	}
+	response.Extensions["tracing"] = map[string]interface{}{
+		"version":    tracingVersion,
+		"startTime":  start.UTC().Format(time.RFC3339Nano),
+		"endTime":    end.UTC().Format(time.RFC3339Nano),
+		"duration":   end.Sub(start).Nanoseconds(),
+		"parsing":    tracingPhaseOffsets(parsing, start),
+		"validation": tracingPhaseOffsets(validation, start),
+		"execution": map[string]interface{}{
+			"resolvers": resolvers,
+		},
+	}
+}
+
+// tracingPhaseOffsets 返回阶段相对请求开始的偏移和耗时（纳秒）
+func tracingPhaseOffsets(phase tracingPhase, start time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"startOffset": phase.start.Sub(start).Nanoseconds(),
+		"duration":    phase.duration.Nanoseconds(),
+	}
+}
@@ -0,0 +1,116 @@
+package federation
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+const objectTypeKind = "OBJECT"
+
+// rootTypeName 返回操作类型对应的根类型名
+func rootTypeName(operationType ast.OperationType) string {
+	switch operationType {
+	case ast.OperationTypeMutation:
+		return "Mutation"
+	case ast.OperationTypeSubscription:
+		return "Subscription"
+	default:
+		return "Query"
+	}
+}
+
+// resolveStaticTypenames 为具体对象类型位置上选择的 __typename 直接填入类型名，
+// 接口和联合类型位置保留子图返回的值
+func (e *Engine) resolveStaticTypenames(query *federationtypes.ParsedQuery, response *federationtypes.GraphQLResponse) {
+	if response == nil || response.Data == nil {
+		return
+	}
+
+	document, operationRef := findOperation(query)
+	if operationRef == -1 {
+		return
+	}
+
+	operation := document.OperationDefinitions[operationRef]
+	index := e.currentSchemaIndex()
+	fillTypenames(document, operation.SelectionSet, rootTypeName(operation.OperationType), true, index, response.Data, make(map[string]bool))
+}
+
+// fillTypenames 按选择集遍历数据；concrete 表示当前位置的类型是否静态已知
+func fillTypenames(document *ast.Document, selectionSet int, typeName string, concrete bool, index *schemaIndex, value interface{}, visitedFragments map[string]bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			fillTypenames(document, selectionSet, typeName, concrete, index, item, visitedFragments)
+		}
+		return
+	case map[string]interface{}:
+		fillObjectTypenames(document, selectionSet, typeName, concrete, index, v, visitedFragments)
+	}
+}
+
+// fillObjectTypenames 处理单个对象上的选择
+func fillObjectTypenames(document *ast.Document, selectionSet int, typeName string, concrete bool, index *schemaIndex, object map[string]interface{}, visitedFragments map[string]bool) {
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			key := document.FieldAliasOrNameString(selection.Ref)
+			if document.FieldNameString(selection.Ref) == typenameField {
+				if concrete {
+					object[key] = typeName
+				}
+				continue
+			}
+
+			field := document.Fields[selection.Ref]
+			fieldInfo, ok := index.fields[typeName][document.FieldNameString(selection.Ref)]
+			if !ok || !field.HasSelections {
+				continue
+			}
+
+			returnType := namedType(fieldInfo.Type)
+			if child, exists := object[key]; exists && child != nil {
+				fillTypenames(document, field.SelectionSet, returnType, index.kinds[returnType] == objectTypeKind, index, child, visitedFragments)
+			}
+
+		case ast.SelectionKindInlineFragment:
+			fragment := document.InlineFragments[selection.Ref]
+			if !fragment.HasSelections {
+				continue
+			}
+			fragmentType, fragmentConcrete := narrowType(typeName, concrete, document.InlineFragmentTypeConditionNameString(selection.Ref), object)
+			fillObjectTypenames(document, fragment.SelectionSet, fragmentType, fragmentConcrete, index, object, visitedFragments)
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+
+			for i := range document.FragmentDefinitions {
+				if document.FragmentDefinitionNameString(i) != name {
+					continue
+				}
+				fragmentType, fragmentConcrete := narrowType(typeName, concrete, document.FragmentDefinitionTypeNameString(i), object)
+				fillObjectTypenames(document, document.FragmentDefinitions[i].SelectionSet, fragmentType, fragmentConcrete, index, object, visitedFragments)
+			}
+			delete(visitedFragments, name)
+		}
+	}
+}
+
+// narrowType 计算片段内的类型：已知具体类型时沿用，抽象位置仅在子图返回的
+// __typename 与类型条件一致时视为已知
+func narrowType(typeName string, concrete bool, condition string, object map[string]interface{}) (string, bool) {
+	if concrete || condition == "" {
+		return typeName, concrete
+	}
+	if object[typenameField] == condition {
+		return condition, true
+	}
+	return condition, false
+}
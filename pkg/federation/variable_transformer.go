@@ -0,0 +1,259 @@
+package federation
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// inputType 变量或输入字段的类型，非空修饰不影响转换
+type inputType struct {
+	name   string     // 命名类型，列表时为空
+	ofType *inputType // 列表元素类型
+}
+
+// TypeCoercionTransformer 按操作声明的变量类型转换变量值，
+// 枚举值和输入对象字段的类型来自各子图模式；无法转换的值原样保留，由子图报错
+type TypeCoercionTransformer struct {
+	config *federationtypes.VariableCoercionConfig
+	logger federationtypes.Logger
+
+	enums  map[string]map[string]string     // 枚举类型 -> 大写的值 -> 模式中的值
+	inputs map[string]map[string]*inputType // 输入对象类型 -> 字段名 -> 字段类型
+}
+
+// DefaultVariableCoercionConfig 返回默认配置
+func DefaultVariableCoercionConfig() *federationtypes.VariableCoercionConfig {
+	return &federationtypes.VariableCoercionConfig{
+		CoerceNumbers:  true,
+		NormalizeEnums: true,
+	}
+}
+
+// NewTypeCoercionTransformer 创建按类型转换变量值的转换器，schemas 为各子图的模式文本
+func NewTypeCoercionTransformer(config *federationtypes.VariableCoercionConfig, schemas []string, logger federationtypes.Logger) *TypeCoercionTransformer {
+	if config == nil {
+		config = DefaultVariableCoercionConfig()
+	}
+
+	transformer := &TypeCoercionTransformer{
+		config: config,
+		logger: logger,
+		enums:  make(map[string]map[string]string),
+		inputs: make(map[string]map[string]*inputType),
+	}
+	for _, schema := range schemas {
+		transformer.addSchema(schema)
+	}
+
+	return transformer
+}
+
+// addSchema 收集模式中的枚举和输入对象定义，无法解析的模式忽略
+func (t *TypeCoercionTransformer) addSchema(schema string) {
+	if schema == "" {
+		return
+	}
+
+	document, report := astparser.ParseGraphqlDocumentString(schema)
+	if report.HasErrors() {
+		return
+	}
+
+	addEnum := func(name string, definition ast.EnumTypeDefinition) {
+		values, ok := t.enums[name]
+		if !ok {
+			values = make(map[string]string)
+			t.enums[name] = values
+		}
+		for _, valueRef := range definition.EnumValuesDefinition.Refs {
+			value := document.EnumValueDefinitionNameString(valueRef)
+			values[strings.ToUpper(value)] = value
+		}
+	}
+	for i := range document.EnumTypeDefinitions {
+		addEnum(document.EnumTypeDefinitionNameString(i), document.EnumTypeDefinitions[i])
+	}
+	for i := range document.EnumTypeExtensions {
+		addEnum(document.EnumTypeExtensionNameString(i), document.EnumTypeExtensions[i].EnumTypeDefinition)
+	}
+
+	addInput := func(name string, definition ast.InputObjectTypeDefinition) {
+		fields, ok := t.inputs[name]
+		if !ok {
+			fields = make(map[string]*inputType)
+			t.inputs[name] = fields
+		}
+		for _, fieldRef := range definition.InputFieldsDefinition.Refs {
+			fields[document.InputValueDefinitionNameString(fieldRef)] = inputTypeFromAST(&document, document.InputValueDefinitions[fieldRef].Type)
+		}
+	}
+	for i := range document.InputObjectTypeDefinitions {
+		addInput(document.InputObjectTypeDefinitionNameString(i), document.InputObjectTypeDefinitions[i])
+	}
+	for i := range document.InputObjectTypeExtensions {
+		addInput(document.InputObjectTypeExtensionNameString(i), document.InputObjectTypeExtensions[i].InputObjectTypeDefinition)
+	}
+}
+
+// Transform 按操作的变量定义转换变量值，未声明的变量原样保留
+func (t *TypeCoercionTransformer) Transform(query *federationtypes.ParsedQuery, variables map[string]interface{}) (map[string]interface{}, error) {
+	if len(variables) == 0 || query == nil {
+		return variables, nil
+	}
+
+	document, operationRef := findOperation(query)
+	if operationRef == -1 {
+		return variables, nil
+	}
+
+	operation := document.OperationDefinitions[operationRef]
+	declared := make(map[string]*inputType, len(operation.VariableDefinitions.Refs))
+	for _, definitionRef := range operation.VariableDefinitions.Refs {
+		declared[document.VariableDefinitionNameString(definitionRef)] = inputTypeFromAST(document, document.VariableDefinitions[definitionRef].Type)
+	}
+
+	result := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		if variableType, ok := declared[name]; ok {
+			value = t.coerce(value, variableType)
+		}
+		result[name] = value
+	}
+
+	return result, nil
+}
+
+// coerce 按类型转换单个值
+func (t *TypeCoercionTransformer) coerce(value interface{}, valueType *inputType) interface{} {
+	if value == nil || valueType == nil {
+		return value
+	}
+
+	if valueType.ofType != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced[i] = t.coerce(item, valueType.ofType)
+		}
+		return coerced
+	}
+
+	switch valueType.name {
+	case "Int":
+		if text, ok := value.(string); ok && t.config.CoerceNumbers {
+			if number, err := strconv.ParseInt(strings.TrimSpace(text), 10, 32); err == nil {
+				return number
+			}
+		}
+	case "Float":
+		if text, ok := value.(string); ok && t.config.CoerceNumbers {
+			// ParseFloat 接受 NaN 和 Inf，它们不是合法的 GraphQL Float
+			if number, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+				return number
+			}
+		}
+	case "String":
+		if text, ok := value.(string); ok && t.config.TrimStrings {
+			return strings.TrimSpace(text)
+		}
+	default:
+		if values, ok := t.enums[valueType.name]; ok {
+			if text, ok := value.(string); ok && t.config.NormalizeEnums {
+				if canonical, ok := values[strings.ToUpper(strings.TrimSpace(text))]; ok {
+					return canonical
+				}
+			}
+			return value
+		}
+
+		if fields, ok := t.inputs[valueType.name]; ok {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			coerced := make(map[string]interface{}, len(object))
+			for name, fieldValue := range object {
+				coerced[name] = t.coerce(fieldValue, fields[name])
+			}
+			return coerced
+		}
+	}
+
+	return value
+}
+
+// inputTypeFromAST 由 AST 类型引用构建输入类型，去掉非空修饰
+func inputTypeFromAST(document *ast.Document, typeRef int) *inputType {
+	if typeRef < 0 || typeRef >= len(document.Types) {
+		return nil
+	}
+
+	switch document.Types[typeRef].TypeKind {
+	case ast.TypeKindNonNull:
+		return inputTypeFromAST(document, document.Types[typeRef].OfType)
+	case ast.TypeKindList:
+		return &inputType{ofType: inputTypeFromAST(document, document.Types[typeRef].OfType)}
+	default:
+		return &inputType{name: document.TypeNameString(typeRef)}
+	}
+}
+
+// applyVariableDefaults 为客户端省略的变量填入操作声明的默认值，返回新的变量表。
+// 默认值来自可能被解析缓存共享的查询，填入前复制，避免后续修改影响其他请求
+func applyVariableDefaults(query *federationtypes.ParsedQuery, variables map[string]interface{}) map[string]interface{} {
+	if query == nil {
+		return variables
+	}
+
+	var result map[string]interface{}
+	for _, definition := range query.VariableDefinitions {
+		if !definition.HasDefault {
+			continue
+		}
+		if _, provided := variables[definition.Name]; provided {
+			continue
+		}
+
+		if result == nil {
+			result = make(map[string]interface{}, len(variables)+1)
+			for name, value := range variables {
+				result[name] = value
+			}
+		}
+		result[definition.Name] = copyJSONValue(definition.DefaultValue)
+	}
+
+	if result == nil {
+		return variables
+	}
+	return result
+}
+
+// copyJSONValue 深拷贝 JSON 形式的值
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyJSONValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyJSONValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,78 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/parser"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestTypeCoercionTransformer_Transform(t *testing.T) {
+	schemas := []string{
+		`type Query { products(first: Int, filter: ProductFilter): [String] }
+		 input ProductFilter { sort: SortOrder tags: [SortOrder!] minPrice: Float }
+		 enum SortOrder { ASC DESC }`,
+		`type Query { search(term: String): [String] }`,
+	}
+	query := `query($first: Int!, $filter: ProductFilter, $order: SortOrder, $ids: [Int], $term: String) {
+		products(first: $first, filter: $filter) search(term: $term)
+	}`
+
+	parsedQuery, err := parser.NewParser(utils.NewLogger("test")).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	transformer := NewTypeCoercionTransformer(nil, schemas, utils.NewLogger("test"))
+	variables, err := transformer.Transform(parsedQuery, map[string]interface{}{
+		"first": "10",
+		"filter": map[string]interface{}{
+			"sort":     "desc",
+			"tags":     []interface{}{"Asc", "unknown"},
+			"minPrice": " 2.5",
+		},
+		"order":      "Asc",
+		"ids":        []interface{}{"1", 2.0, "x"},
+		"term":       "  chair ",
+		"undeclared": "10",
+	})
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"first": int64(10),
+		"filter": map[string]interface{}{
+			"sort":     "DESC",
+			"tags":     []interface{}{"ASC", "unknown"},
+			"minPrice": 2.5,
+		},
+		"order":      "ASC",
+		"ids":        []interface{}{int64(1), 2.0, "x"},
+		"term":       "  chair ",
+		"undeclared": "10",
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("Transform() = %#v, want %#v", variables, expected)
+	}
+
+	// 默认不去除字符串空白，开启后生效
+	transformer = NewTypeCoercionTransformer(&federationtypes.VariableCoercionConfig{TrimStrings: true}, schemas, utils.NewLogger("test"))
+	variables, _ = transformer.Transform(parsedQuery, map[string]interface{}{"term": "  chair ", "first": "10"})
+	if variables["term"] != "chair" || variables["first"] != "10" {
+		t.Errorf("Expected only string trimming, got %#v", variables)
+	}
+	// NaN 和 Inf 不是合法的 Float，原样保留
+	filters := []interface{}{"NaN", "Inf", "-infinity"}
+	transformer = NewTypeCoercionTransformer(&federationtypes.VariableCoercionConfig{CoerceNumbers: true}, schemas, utils.NewLogger("test"))
+	for _, text := range filters {
+		variables, _ = transformer.Transform(parsedQuery, map[string]interface{}{
+			"filter": map[string]interface{}{"minPrice": text},
+		})
+		if minPrice := variables["filter"].(map[string]interface{})["minPrice"]; minPrice != text {
+			t.Errorf("Expected %q to be left unchanged, got %#v", text, minPrice)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"strings"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// matchResponseEnvelope 按请求路径和请求头选择第一条匹配的响应包装模板，未匹配时返回 nil 使用标准结构
+func matchResponseEnvelope(envelopes []federationtypes.ResponseEnvelopeConfig, path string, header func(string) string) map[string]interface{} {
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+
+	for _, envelope := range envelopes {
+		if envelope.PathPrefix != "" && !strings.HasPrefix(path, envelope.PathPrefix) {
+			continue
+		}
+		if envelope.Header != "" {
+			value := header(strings.ToLower(envelope.Header))
+			if value == "" || (envelope.HeaderValue != "" && !strings.EqualFold(strings.TrimSpace(value), envelope.HeaderValue)) {
+				continue
+			}
+		}
+		return envelope.Template
+	}
+	return nil
+}
+
+// applyResponseEnvelope 按模板构造响应结构。占位符替换为对应的标准字段，
+// 与标准结构一致，值为空的字段不输出；其余值原样保留
+func applyResponseEnvelope(template map[string]interface{}, response *federationtypes.GraphQLResponse) map[string]interface{} {
+	return renderEnvelopeObject(template, response)
+}
+
+func renderEnvelopeObject(template map[string]interface{}, response *federationtypes.GraphQLResponse) map[string]interface{} {
+	result := make(map[string]interface{}, len(template))
+	for key, value := range template {
+		if rendered, ok := renderEnvelopeValue(value, response); ok {
+			result[key] = rendered
+		}
+	}
+	return result
+}
+
+// renderEnvelopeValue 渲染模板中的单个值，ok 为 false 表示引用的标准字段为空
+func renderEnvelopeValue(value interface{}, response *federationtypes.GraphQLResponse) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return renderEnvelopeObject(v, response), true
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i], _ = renderEnvelopeValue(item, response)
+		}
+		return items, true
+	case string:
+		switch v {
+		case federationtypes.EnvelopeFieldData:
+			return response.Data, response.Data != nil
+		case federationtypes.EnvelopeFieldErrors:
+			return response.Errors, len(response.Errors) > 0
+		case federationtypes.EnvelopeFieldExtensions:
+			return response.Extensions, len(response.Extensions) > 0
+		}
+	}
+	return value, true
+}
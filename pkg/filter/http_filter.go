@@ -1,8 +1,13 @@
 package filter
 
 import (
+	"bytes"
+	"context"
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	stderrors "errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +20,27 @@ import (
 	"envoy-wasm-graphql-federation/pkg/utils"
 )
 
+// DefaultSchemaExportPath 未配置 schemaExportPath 时组合 SDL 的导出路径
+const DefaultSchemaExportPath = "/federation/schema.graphql"
+
+// DefaultHealthPath 未配置 healthPath 时就绪状态的路径
+const DefaultHealthPath = "/federation/health"
+
+// DefaultStatusPath 未配置 statusPath 时引擎状态的路径
+const DefaultStatusPath = "/federation/status"
+
+// DefaultMetricsPath 未配置 metricsPath 时引擎指标的路径
+const DefaultMetricsPath = "/federation/metrics"
+
+// DefaultDependencyGraphPath 未配置 dependencyGraphPath 时服务依赖图的路径
+const DefaultDependencyGraphPath = "/federation/dependencies"
+
+// 响应媒体类型
+const (
+	jsonMediaType            = "application/json"
+	graphqlResponseMediaType = "application/graphql-response+json"
+)
+
 // HTTPFilterContext 表示 HTTP 过滤器上下文
 type HTTPFilterContext struct {
 	types.DefaultHttpContext
@@ -33,9 +59,29 @@ type HTTPFilterContext struct {
 	// GraphQL 相关
 	graphqlRequest  *federationtypes.GraphQLRequest
 	graphqlResponse *federationtypes.GraphQLResponse
+	execCtx         *federationtypes.ExecutionContext
+
+	// 请求体为操作数组时的批量请求和按请求顺序排列的响应
+	batchRequests  []*federationtypes.GraphQLRequest
+	batchResponses []*federationtypes.GraphQLResponse
 
 	// 错误状态
 	lastError error
+
+	// 根据响应数据与错误码确定的 HTTP 状态码
+	responseStatus int
+
+	// 过载拒绝时建议客户端等待的秒数，写入 Retry-After
+	retryAfter int
+
+	// 按 Accept 协商的响应媒体类型
+	responseContentType string
+
+	// 序列化后的 GraphQL 响应体字节数
+	responseSize int
+
+	// 按路由或请求头匹配的自定义响应包装模板，为空时使用标准结构
+	responseEnvelope map[string]interface{}
 }
 
 // NewHTTPFilterContext 创建新的 HTTP 过滤器上下文
@@ -65,6 +111,29 @@ func (ctx *HTTPFilterContext) OnHttpRequestHeaders(numHeaders int, endOfStream b
 		return ctx.sendErrorResponse(400, "Only POST and GET methods are supported")
 	}
 
+	// 导出组合后的模式 SDL
+	if method == "GET" && ctx.isSchemaExportEndpoint(ctx.getRequestPath()) {
+		return ctx.sendSchemaExport()
+	}
+
+	// 返回就绪状态
+	if method == "GET" && ctx.isHealthEndpoint(ctx.getRequestPath()) {
+		return ctx.sendReadiness()
+	}
+
+	// 返回引擎状态和指标，可按服务过滤
+	if method == "GET" && ctx.isStatusEndpoint(ctx.getRequestPath()) {
+		return ctx.sendStatus()
+	}
+	if method == "GET" && ctx.isMetricsEndpoint(ctx.getRequestPath()) {
+		return ctx.sendMetrics()
+	}
+
+	// 导出服务依赖图
+	if method == "GET" && ctx.isDependencyGraphEndpoint(ctx.getRequestPath()) {
+		return ctx.sendDependencyGraph()
+	}
+
 	// 验证 Content-Type (仅对 POST 请求)
 	if method == "POST" {
 		contentType := ctx.getRequestHeader("content-type")
@@ -125,14 +194,31 @@ func (ctx *HTTPFilterContext) OnHttpRequestBody(bodySize int, endOfStream bool)
 // OnHttpResponseHeaders 处理 HTTP 响应头
 func (ctx *HTTPFilterContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool) types.Action {
 	// 如果没有处理 GraphQL 请求，直接继续
-	if ctx.graphqlResponse == nil {
+	if !ctx.handled() {
 		return types.ActionContinue
 	}
 
 	// 设置响应头
-	_ = proxywasm.ReplaceHttpResponseHeader("content-type", "application/json")
+	if ctx.responseStatus != 0 {
+		_ = proxywasm.ReplaceHttpResponseHeader(":status", strconv.Itoa(ctx.responseStatus))
+	}
+	contentType := ctx.responseContentType
+	if contentType == "" {
+		contentType = jsonMediaType
+	}
+	_ = proxywasm.ReplaceHttpResponseHeader("content-type", contentType)
 	_ = proxywasm.AddHttpResponseHeader("x-graphql-federation", "true")
 	_ = proxywasm.AddHttpResponseHeader("x-request-id", ctx.requestID)
+	if ctx.retryAfter > 0 {
+		_ = proxywasm.ReplaceHttpResponseHeader("retry-after", strconv.Itoa(ctx.retryAfter))
+	}
+
+	// 转发允许列表中的上游响应头
+	if ctx.federation != nil {
+		for _, header := range ctx.federation.ResponseHeaders(ctx.execCtx) {
+			_ = proxywasm.AddHttpResponseHeader(header[0], header[1])
+		}
+	}
 
 	return types.ActionContinue
 }
@@ -140,7 +226,7 @@ func (ctx *HTTPFilterContext) OnHttpResponseHeaders(numHeaders int, endOfStream
 // OnHttpResponseBody 处理 HTTP 响应体
 func (ctx *HTTPFilterContext) OnHttpResponseBody(bodySize int, endOfStream bool) types.Action {
 	// 如果没有处理 GraphQL 请求，直接继续
-	if ctx.graphqlResponse == nil {
+	if !ctx.handled() {
 		return types.ActionContinue
 	}
 
@@ -148,13 +234,19 @@ func (ctx *HTTPFilterContext) OnHttpResponseBody(bodySize int, endOfStream bool)
 		return types.ActionPause
 	}
 
-	// 替换响应体为 GraphQL 联邦响应
-	responseBody, err := jsonutil.Marshal(ctx.graphqlResponse)
+	// 替换响应体为 GraphQL 联邦响应，启用 stableJSON 时使用字节稳定的序列化
+	marshal := jsonutil.Marshal
+	if ctx.config != nil && ctx.config.StableJSON {
+		marshal = jsonutil.MarshalStable
+	}
+	responseBody, err := marshal(ctx.responsePayload())
 	if err != nil {
 		ctx.logger.Error("Failed to marshal GraphQL response", "error", err)
 		return ctx.sendErrorResponse(500, "Failed to generate response")
 	}
 
+	ctx.recordResponseSize(len(responseBody))
+
 	if err := proxywasm.ReplaceHttpResponseBody(responseBody); err != nil {
 		ctx.logger.Error("Failed to replace response body", "error", err)
 		return types.ActionContinue
@@ -172,42 +264,141 @@ func (ctx *HTTPFilterContext) OnHttpStreamDone() {
 			"requestId", ctx.requestID,
 			"duration", duration,
 			"hasErrors", len(ctx.graphqlResponse.Errors) > 0,
+			"serviceUsage", ctx.serviceUsage(),
+			"responseSize", ctx.responseSize,
+		)
+	} else if ctx.batchResponses != nil {
+		ctx.logger.Info("GraphQL batch request completed",
+			"requestId", ctx.requestID,
+			"duration", duration,
+			"operations", len(ctx.batchResponses),
+			"responseSize", ctx.responseSize,
 		)
 	}
 }
 
-// parseGraphQLRequest 解析 GraphQL 请求
+// handled 判断本次请求是否由过滤器应答
+func (ctx *HTTPFilterContext) handled() bool {
+	return ctx.graphqlResponse != nil || ctx.batchResponses != nil
+}
+
+// responsePayload 返回写入响应体的值：批量请求为按请求顺序排列的响应数组，各响应分别套用响应包装
+func (ctx *HTTPFilterContext) responsePayload() interface{} {
+	if ctx.graphqlResponse == nil {
+		payloads := make([]interface{}, len(ctx.batchResponses))
+		for i, response := range ctx.batchResponses {
+			payloads[i] = response
+			if ctx.responseEnvelope != nil {
+				payloads[i] = applyResponseEnvelope(ctx.responseEnvelope, response)
+			}
+		}
+		return payloads
+	}
+
+	if ctx.responseEnvelope != nil {
+		return applyResponseEnvelope(ctx.responseEnvelope, ctx.graphqlResponse)
+	}
+	return ctx.graphqlResponse
+}
+
+// recordResponseSize 记录序列化后的响应大小，按请求的操作名分段
+func (ctx *HTTPFilterContext) recordResponseSize(size int) {
+	ctx.responseSize = size
+	if ctx.federation == nil {
+		return
+	}
+
+	operationName := ""
+	if ctx.graphqlRequest != nil {
+		operationName = ctx.graphqlRequest.OperationName
+	}
+	ctx.federation.RecordResponseSize(operationName, size)
+}
+
+// serviceUsage 返回本次请求按服务统计的上游用量，用于访问日志中的成本归因
+func (ctx *HTTPFilterContext) serviceUsage() map[string]federationtypes.ServiceUsage {
+	if ctx.execCtx == nil {
+		return nil
+	}
+	return ctx.execCtx.ServiceUsage()
+}
+
+// parseGraphQLRequest 解析 GraphQL 请求，请求体为 JSON 数组时按批量请求解析
 func (ctx *HTTPFilterContext) parseGraphQLRequest() error {
-	if len(ctx.requestBody) == 0 {
+	body := bytes.TrimSpace(ctx.requestBody)
+	if len(body) == 0 {
 		return fmt.Errorf("empty request body")
 	}
 
+	if body[0] == '[' {
+		return ctx.parseBatchRequest(body)
+	}
+
 	var request federationtypes.GraphQLRequest
-	if err := jsonutil.Unmarshal(ctx.requestBody, &request); err != nil {
+	if err := jsonutil.Unmarshal(body, &request); err != nil {
 		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	// 验证请求
-	if strings.TrimSpace(request.Query) == "" {
-		return fmt.Errorf("query is required")
+	if err := validateGraphQLRequest(&request); err != nil {
+		return err
 	}
 
 	ctx.graphqlRequest = &request
 	return nil
 }
 
+// parseBatchRequest 解析 Apollo 风格的批量请求（操作数组），每个操作须单独有效
+func (ctx *HTTPFilterContext) parseBatchRequest(body []byte) error {
+	var requests []*federationtypes.GraphQLRequest
+	if err := jsonutil.Unmarshal(body, &requests); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("batch must contain at least one operation")
+	}
+
+	for i, request := range requests {
+		if request == nil {
+			return fmt.Errorf("batched operation %d is empty", i)
+		}
+		if err := validateGraphQLRequest(request); err != nil {
+			return fmt.Errorf("batched operation %d: %w", i, err)
+		}
+	}
+
+	ctx.batchRequests = requests
+	return nil
+}
+
+// validateGraphQLRequest 验证请求，APQ 请求可以只携带查询哈希
+func validateGraphQLRequest(request *federationtypes.GraphQLRequest) error {
+	if strings.TrimSpace(request.Query) == "" && request.Extensions["persistedQuery"] == nil {
+		return fmt.Errorf("query is required")
+	}
+	return nil
+}
+
 // handleGetRequest 处理 GET 请求
 func (ctx *HTTPFilterContext) handleGetRequest() error {
 	// 从查询参数获取 GraphQL 查询
 	queryParam := ctx.getQueryParam("query")
-	if queryParam == "" {
-		return fmt.Errorf("query parameter is required")
-	}
-
 	request := &federationtypes.GraphQLRequest{
 		Query: queryParam,
 	}
 
+	// 获取扩展参数（APQ 哈希）
+	if extensionsParam := ctx.getQueryParam("extensions"); extensionsParam != "" {
+		var extensions map[string]interface{}
+		if err := jsonutil.Unmarshal([]byte(extensionsParam), &extensions); err != nil {
+			return fmt.Errorf("invalid extensions parameter: %w", err)
+		}
+		request.Extensions = extensions
+	}
+
+	if queryParam == "" && request.Extensions["persistedQuery"] == nil {
+		return fmt.Errorf("query parameter is required")
+	}
+
 	// 获取变量参数
 	if variablesParam := ctx.getQueryParam("variables"); variablesParam != "" {
 		var variables map[string]interface{}
@@ -228,6 +419,9 @@ func (ctx *HTTPFilterContext) handleGetRequest() error {
 
 // processGraphQLRequest 处理 GraphQL 请求
 func (ctx *HTTPFilterContext) processGraphQLRequest() types.Action {
+	if ctx.batchRequests != nil {
+		return ctx.processBatchRequest()
+	}
 	if ctx.graphqlRequest == nil {
 		return ctx.sendErrorResponse(400, "No GraphQL request to process")
 	}
@@ -244,43 +438,140 @@ func (ctx *HTTPFilterContext) processGraphQLRequest() types.Action {
 		},
 		StartTime: ctx.startTime,
 		Config:    ctx.config,
+		Tracing:   ctx.isTracingRequested(),
 	}
+	ctx.execCtx = execCtx
 
 	// 执行 GraphQL 查询
 	response, err := ctx.federation.ExecuteQuery(execCtx, ctx.graphqlRequest)
 	if err != nil {
 		ctx.logger.Error("Failed to execute GraphQL query", "error", err)
-
-		// 如果是联邦错误，转换为 GraphQL 错误响应
-		if fedErr, ok := err.(*errors.FederationError); ok {
-			ctx.graphqlResponse = &federationtypes.GraphQLResponse{
-				Errors: []federationtypes.GraphQLError{
-					{
-						Message:    fedErr.Message,
-						Extensions: fedErr.ToGraphQLError()["extensions"].(map[string]interface{}),
-					},
-				},
-			}
-		} else {
-			ctx.graphqlResponse = &federationtypes.GraphQLResponse{
-				Errors: []federationtypes.GraphQLError{
-					{
-						Message: "Internal server error",
-						Extensions: map[string]interface{}{
-							"code": "INTERNAL_ERROR",
-						},
-					},
-				},
-			}
-		}
+		ctx.graphqlResponse = ctx.errorResponse(err)
 	} else {
 		ctx.graphqlResponse = response
 	}
+	ctx.negotiateResponse()
+	ctx.responseStatus = ctx.responseStatusCode()
 
 	// 阻止请求继续传递到上游服务
 	return types.ActionPause
 }
 
+// processBatchRequest 处理批量请求：各操作依次执行，响应数组与请求顺序一致，状态码为 200；
+// 整批被拒绝（如操作名重复）时按单个错误响应应答
+func (ctx *HTTPFilterContext) processBatchRequest() types.Action {
+	execCtx := &federationtypes.ExecutionContext{
+		RequestID: ctx.requestID,
+		QueryContext: &federationtypes.QueryContext{
+			RequestID: ctx.requestID,
+			Headers:   ctx.getRequestHeaders(),
+		},
+		StartTime: ctx.startTime,
+		Config:    ctx.config,
+		Tracing:   ctx.isTracingRequested(),
+	}
+	ctx.execCtx = execCtx
+
+	responses, err := ctx.federation.ExecuteBatch(execCtx, ctx.batchRequests)
+	ctx.negotiateResponse()
+	if err != nil {
+		ctx.logger.Error("Failed to execute GraphQL batch", "error", err)
+		ctx.graphqlResponse = ctx.errorResponse(err)
+		ctx.responseStatus = ctx.responseStatusCode()
+	} else {
+		ctx.batchResponses = responses
+		ctx.responseStatus = http.StatusOK
+	}
+
+	// 阻止请求继续传递到上游服务
+	return types.ActionPause
+}
+
+// errorResponse 将执行错误转换为 GraphQL 错误响应，非联邦错误不向客户端暴露细节
+func (ctx *HTTPFilterContext) errorResponse(err error) *federationtypes.GraphQLResponse {
+	var fedErr *errors.FederationError
+	if stderrors.As(err, &fedErr) {
+		if retryAfter, ok := fedErr.Extensions["retryAfter"].(int); ok {
+			ctx.retryAfter = retryAfter
+		}
+		return &federationtypes.GraphQLResponse{
+			Errors: []federationtypes.GraphQLError{
+				{
+					Message:    fedErr.Message,
+					Extensions: fedErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+				},
+			},
+		}
+	}
+
+	return &federationtypes.GraphQLResponse{
+		Errors: []federationtypes.GraphQLError{
+			{
+				Message: "Internal server error",
+				Extensions: map[string]interface{}{
+					"code": "INTERNAL_ERROR",
+				},
+			},
+		},
+	}
+}
+
+// negotiateResponse 按 Accept 协商响应媒体类型，并匹配自定义响应包装
+func (ctx *HTTPFilterContext) negotiateResponse() {
+	ctx.responseContentType = negotiateResponseContentType(ctx.getRequestHeader("accept"))
+	if ctx.config != nil && len(ctx.config.ResponseEnvelopes) > 0 {
+		ctx.responseEnvelope = matchResponseEnvelope(ctx.config.ResponseEnvelopes, ctx.getRequestPath(), ctx.getRequestHeader)
+	}
+}
+
+// responseStatusCode 按 GraphQL-over-HTTP 规则确定 HTTP 状态码，需在 negotiateResponse 之后调用：
+// 响应媒体类型为 application/json 或响应包含非空数据（即使只有部分）时返回 200；
+// 没有数据时按最严重错误的错误码取 httpStatusMapping 与默认值，映射结果不是错误状态时返回 502，过载拒绝返回 503
+func (ctx *HTTPFilterContext) responseStatusCode() int {
+	if ctx.graphqlResponse == nil {
+		return 0
+	}
+	if ctx.responseContentType == jsonMediaType {
+		return http.StatusOK
+	}
+	if hasResponseData(ctx.graphqlResponse.Data) || len(ctx.graphqlResponse.Errors) == 0 {
+		return http.StatusOK
+	}
+
+	codes := make([]string, 0, len(ctx.graphqlResponse.Errors))
+	for _, graphqlErr := range ctx.graphqlResponse.Errors {
+		if code, ok := graphqlErr.Extensions["code"].(string); ok && code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	var mapping map[string]int
+	if ctx.config != nil {
+		mapping = ctx.config.HTTPStatusMapping
+	}
+
+	status := errors.HTTPStatusForCodes(codes, mapping)
+	if status < http.StatusBadRequest {
+		if ctx.retryAfter > 0 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusBadGateway
+	}
+	return status
+}
+
+// hasResponseData 判断响应数据是否非空，空对象视为没有数据，字段均为 null 的对象骨架视为有数据
+func hasResponseData(data interface{}) bool {
+	switch value := data.(type) {
+	case nil:
+		return false
+	case map[string]interface{}:
+		return len(value) > 0
+	default:
+		return true
+	}
+}
+
 // sendErrorResponse 发送错误响应
 func (ctx *HTTPFilterContext) sendErrorResponse(statusCode int, message string) types.Action {
 	errorResponse := &federationtypes.GraphQLResponse{
@@ -304,6 +595,122 @@ func (ctx *HTTPFilterContext) sendErrorResponse(statusCode int, message string)
 	return types.ActionPause
 }
 
+// sendSchemaExport 返回当前组合的模式 SDL
+func (ctx *HTTPFilterContext) sendSchemaExport() types.Action {
+	sdl, err := ctx.federation.ComposedSchemaSDL()
+	if err != nil {
+		ctx.logger.Error("Failed to export composed schema", "error", err)
+		return ctx.sendErrorResponse(503, "Composed schema not available")
+	}
+
+	_ = proxywasm.SendHttpResponse(200, [][2]string{
+		{"content-type", "text/plain; charset=utf-8"},
+		{"x-request-id", ctx.requestID},
+	}, []byte(sdl), -1)
+
+	return types.ActionPause
+}
+
+// sendReadiness 返回就绪状态，未就绪时返回 503
+func (ctx *HTTPFilterContext) sendReadiness() types.Action {
+	if ctx.federation == nil {
+		return ctx.sendErrorResponse(503, "Federation engine not available")
+	}
+
+	readiness := ctx.federation.Readiness(context.Background())
+	statusCode := 200
+	if !readiness.Ready || !ctx.federation.IsHealthy() {
+		statusCode = 503
+	}
+
+	body, _ := jsonutil.Marshal(readiness)
+	_ = proxywasm.SendHttpResponse(uint32(statusCode), [][2]string{
+		{"content-type", jsonMediaType},
+		{"x-request-id", ctx.requestID},
+	}, body, -1)
+
+	return types.ActionPause
+}
+
+// sendStatus 返回引擎状态，?service= 指定时只包含这些服务
+func (ctx *HTTPFilterContext) sendStatus() types.Action {
+	if ctx.federation == nil {
+		return ctx.sendErrorResponse(503, "Federation engine not available")
+	}
+
+	return ctx.sendJSON(ctx.federation.GetStatusFor(ctx.requestedServices()...))
+}
+
+// sendMetrics 返回引擎指标，按服务统计的部分按 ?service= 过滤并受 metricsMaxServices 限制
+func (ctx *HTTPFilterContext) sendMetrics() types.Action {
+	if ctx.federation == nil {
+		return ctx.sendErrorResponse(503, "Federation engine not available")
+	}
+
+	maxServices := ctx.config.MetricsMaxServices
+	if maxServices == 0 {
+		maxServices = federation.DefaultMetricsMaxServices
+	}
+	return ctx.sendJSON(ctx.federation.GetMetricsFor(federation.MetricsFilter{
+		Services:    ctx.requestedServices(),
+		MaxServices: maxServices,
+	}))
+}
+
+// sendDependencyGraph 返回服务依赖图，?format=dot 时以 Graphviz DOT 格式返回，否则返回 JSON 邻接表
+func (ctx *HTTPFilterContext) sendDependencyGraph() types.Action {
+	if ctx.federation == nil {
+		return ctx.sendErrorResponse(503, "Federation engine not available")
+	}
+
+	graph, err := ctx.federation.ServiceDependencyGraph()
+	if err != nil {
+		ctx.logger.Error("Failed to build service dependency graph", "error", err)
+		return ctx.sendErrorResponse(503, "Service dependency graph not available")
+	}
+
+	if strings.EqualFold(ctx.getQueryParam("format"), "dot") {
+		_ = proxywasm.SendHttpResponse(200, [][2]string{
+			{"content-type", "text/vnd.graphviz; charset=utf-8"},
+			{"x-request-id", ctx.requestID},
+		}, []byte(graph.DOT()), -1)
+		return types.ActionPause
+	}
+	return ctx.sendJSON(graph)
+}
+
+// sendJSON 以 200 返回序列化后的值
+func (ctx *HTTPFilterContext) sendJSON(value interface{}) types.Action {
+	body, err := jsonutil.Marshal(value)
+	if err != nil {
+		ctx.logger.Error("Failed to serialize admin response", "error", err)
+		return ctx.sendErrorResponse(500, "Failed to serialize response")
+	}
+
+	_ = proxywasm.SendHttpResponse(200, [][2]string{
+		{"content-type", jsonMediaType},
+		{"x-request-id", ctx.requestID},
+	}, body, -1)
+
+	return types.ActionPause
+}
+
+// requestedServices 返回 ?service= 指定的服务名，多个服务以逗号分隔
+func (ctx *HTTPFilterContext) requestedServices() []string {
+	return parseServiceParam(ctx.getQueryParam("service"))
+}
+
+// parseServiceParam 拆分逗号分隔的服务名，忽略空项
+func parseServiceParam(value string) []string {
+	var services []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			services = append(services, name)
+		}
+	}
+	return services
+}
+
 // 辅助方法
 
 func (ctx *HTTPFilterContext) getRequestMethod() string {
@@ -341,6 +748,45 @@ func (ctx *HTTPFilterContext) getQueryParam(name string) string {
 	return ""
 }
 
+// isTracingRequested 客户端通过 ?tracing 参数或 apollo-tracing 头请求 extensions.tracing
+func (ctx *HTTPFilterContext) isTracingRequested() bool {
+	path := ctx.getRequestPath()
+	if idx := strings.Index(path, "?"); idx > 0 && utils.HasQueryParam(path[idx+1:], "tracing") {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(ctx.getRequestHeader("apollo-tracing"))) {
+	case "", "0", "false":
+		return false
+	}
+	return true
+}
+
+// negotiateResponseContentType 客户端 Accept 接受 application/graphql-response+json（q 不为 0）时使用该媒体类型，
+// 否则回退为 application/json
+func negotiateResponseContentType(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		parts := strings.Split(mediaRange, ";")
+		if !strings.EqualFold(strings.TrimSpace(parts[0]), graphqlResponseMediaType) {
+			continue
+		}
+
+		accepted := true
+		for _, param := range parts[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q <= 0 {
+					accepted = false
+				}
+			}
+		}
+		if accepted {
+			return graphqlResponseMediaType
+		}
+	}
+	return jsonMediaType
+}
+
 func (ctx *HTTPFilterContext) isValidContentType(contentType string) bool {
 	contentType = strings.ToLower(strings.TrimSpace(contentType))
 	return contentType == "application/json" ||
@@ -348,6 +794,45 @@ func (ctx *HTTPFilterContext) isValidContentType(contentType string) bool {
 		strings.HasPrefix(contentType, "application/json")
 }
 
+// matchEndpointPath 判断去掉查询参数后的路径是否为已启用的内置端点，未配置路径时使用默认路径
+func matchEndpointPath(path string, enabled bool, configured, defaultPath string) bool {
+	if !enabled {
+		return false
+	}
+	if idx := strings.Index(path, "?"); idx > 0 {
+		path = path[:idx]
+	}
+	if configured == "" {
+		configured = defaultPath
+	}
+	return path == configured
+}
+
+// isSchemaExportEndpoint 判断是否为已启用的模式导出端点
+func (ctx *HTTPFilterContext) isSchemaExportEndpoint(path string) bool {
+	return ctx.config != nil && matchEndpointPath(path, ctx.config.EnableSchemaExport, ctx.config.SchemaExportPath, DefaultSchemaExportPath)
+}
+
+// isHealthEndpoint 判断是否为已启用的就绪状态端点
+func (ctx *HTTPFilterContext) isHealthEndpoint(path string) bool {
+	return ctx.config != nil && matchEndpointPath(path, ctx.config.EnableHealthEndpoint, ctx.config.HealthPath, DefaultHealthPath)
+}
+
+// isStatusEndpoint 判断是否为已启用的引擎状态端点
+func (ctx *HTTPFilterContext) isStatusEndpoint(path string) bool {
+	return ctx.config != nil && matchEndpointPath(path, ctx.config.EnableStatusEndpoint, ctx.config.StatusPath, DefaultStatusPath)
+}
+
+// isMetricsEndpoint 判断是否为已启用的引擎指标端点
+func (ctx *HTTPFilterContext) isMetricsEndpoint(path string) bool {
+	return ctx.config != nil && matchEndpointPath(path, ctx.config.EnableMetricsEndpoint, ctx.config.MetricsPath, DefaultMetricsPath)
+}
+
+// isDependencyGraphEndpoint 判断是否为已启用的服务依赖图端点
+func (ctx *HTTPFilterContext) isDependencyGraphEndpoint(path string) bool {
+	return ctx.config != nil && matchEndpointPath(path, ctx.config.EnableDependencyGraphEndpoint, ctx.config.DependencyGraphPath, DefaultDependencyGraphPath)
+}
+
 func (ctx *HTTPFilterContext) isGraphQLEndpoint(path string) bool {
 	// 移除查询参数
 	if idx := strings.Index(path, "?"); idx > 0 {
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 	"envoy-wasm-graphql-federation/pkg/utils"
 )
@@ -214,6 +215,316 @@ func TestHTTPFilterContext_isGraphQLEndpoint(t *testing.T) {
 	}
 }
 
+func TestHTTPFilterContext_isSchemaExportEndpoint(t *testing.T) {
+	config := &federationtypes.FederationConfig{}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+
+	// 未启用时不导出
+	if filterContext.isSchemaExportEndpoint(DefaultSchemaExportPath) {
+		t.Error("Expected schema export to be disabled by default")
+	}
+
+	config.EnableSchemaExport = true
+	if !filterContext.isSchemaExportEndpoint("/federation/schema.graphql?v=1") {
+		t.Error("Expected default export path to match")
+	}
+
+	config.SchemaExportPath = "/schema.graphql"
+	if !filterContext.isSchemaExportEndpoint("/schema.graphql") {
+		t.Error("Expected configured export path to match")
+	}
+	if filterContext.isSchemaExportEndpoint(DefaultSchemaExportPath) || filterContext.isSchemaExportEndpoint("/graphql") {
+		t.Error("Expected other paths not to match")
+	}
+}
+
+func TestHTTPFilterContext_isHealthEndpoint(t *testing.T) {
+	config := &federationtypes.FederationConfig{}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+
+	if filterContext.isHealthEndpoint(DefaultHealthPath) {
+		t.Error("Expected health endpoint to be disabled by default")
+	}
+
+	config.EnableHealthEndpoint = true
+	if !filterContext.isHealthEndpoint("/federation/health?probe=1") {
+		t.Error("Expected default health path to match")
+	}
+
+	config.HealthPath = "/ready"
+	if !filterContext.isHealthEndpoint("/ready") || filterContext.isHealthEndpoint(DefaultHealthPath) {
+		t.Error("Expected only the configured health path to match")
+	}
+}
+
+func TestHTTPFilterContext_isStatusAndMetricsEndpoint(t *testing.T) {
+	config := &federationtypes.FederationConfig{}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+
+	if filterContext.isStatusEndpoint(DefaultStatusPath) || filterContext.isMetricsEndpoint(DefaultMetricsPath) {
+		t.Error("Expected status and metrics endpoints to be disabled by default")
+	}
+
+	config.EnableStatusEndpoint = true
+	config.EnableMetricsEndpoint = true
+	if !filterContext.isStatusEndpoint("/federation/status?service=users") || !filterContext.isMetricsEndpoint(DefaultMetricsPath) {
+		t.Error("Expected default status and metrics paths to match")
+	}
+
+	config.StatusPath = "/admin/status"
+	if !filterContext.isStatusEndpoint("/admin/status") || filterContext.isStatusEndpoint(DefaultStatusPath) {
+		t.Error("Expected only the configured status path to match")
+	}
+}
+
+func TestHTTPFilterContext_isDependencyGraphEndpoint(t *testing.T) {
+	config := &federationtypes.FederationConfig{}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+
+	if filterContext.isDependencyGraphEndpoint(DefaultDependencyGraphPath) {
+		t.Error("Expected dependency graph endpoint to be disabled by default")
+	}
+
+	config.EnableDependencyGraphEndpoint = true
+	if !filterContext.isDependencyGraphEndpoint("/federation/dependencies?format=dot") {
+		t.Error("Expected default dependency graph path to match")
+	}
+
+	config.DependencyGraphPath = "/admin/dependencies"
+	if !filterContext.isDependencyGraphEndpoint("/admin/dependencies") || filterContext.isDependencyGraphEndpoint(DefaultDependencyGraphPath) {
+		t.Error("Expected only the configured dependency graph path to match")
+	}
+}
+
+func TestParseServiceParam(t *testing.T) {
+	if services := parseServiceParam(" users, ,orders "); len(services) != 2 || services[0] != "users" || services[1] != "orders" {
+		t.Errorf("Expected [users orders], got %v", services)
+	}
+	if services := parseServiceParam(""); services != nil {
+		t.Errorf("Expected no services, got %v", services)
+	}
+}
+
+func TestHTTPFilterContext_parseGraphQLRequest_Batch(t *testing.T) {
+	ctx := &HTTPFilterContext{requestBody: []byte(` [{"query": "{ a }", "operationName": "A"}, {"query": "{ b }"}]`)}
+	if err := ctx.parseGraphQLRequest(); err != nil {
+		t.Fatalf("parseGraphQLRequest() error = %v", err)
+	}
+	if ctx.graphqlRequest != nil || len(ctx.batchRequests) != 2 {
+		t.Fatalf("Expected a batch of 2 operations, got single=%v batch=%v", ctx.graphqlRequest, ctx.batchRequests)
+	}
+	if ctx.batchRequests[0].OperationName != "A" || ctx.batchRequests[1].Query != "{ b }" {
+		t.Errorf("Unexpected batched operations: %+v %+v", ctx.batchRequests[0], ctx.batchRequests[1])
+	}
+
+	for _, body := range []string{`[]`, `[{"query": "{ a }"}, {"query": ""}]`, `[null]`} {
+		ctx := &HTTPFilterContext{requestBody: []byte(body)}
+		if err := ctx.parseGraphQLRequest(); err == nil {
+			t.Errorf("Expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestHTTPFilterContext_responsePayload_Batch(t *testing.T) {
+	ctx := &HTTPFilterContext{batchResponses: []*federationtypes.GraphQLResponse{
+		{Data: map[string]interface{}{"a": 1}},
+		{Errors: []federationtypes.GraphQLError{{Message: "failed"}}},
+	}}
+	if !ctx.handled() {
+		t.Fatal("Expected batch responses to be handled by the filter")
+	}
+
+	body, err := jsonutil.Marshal(ctx.responsePayload())
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := jsonutil.Unmarshal(body, &decoded); err != nil || len(decoded) != 2 {
+		t.Fatalf("Expected a JSON array of 2 responses, got %s (%v)", body, err)
+	}
+	if decoded[0]["data"] == nil || decoded[1]["errors"] == nil {
+		t.Errorf("Unexpected batch payload: %s", body)
+	}
+}
+
+func TestHTTPFilterContext_responseStatusCode(t *testing.T) {
+	config := &federationtypes.FederationConfig{}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+	filterContext.responseContentType = graphqlResponseMediaType
+
+	filterContext.graphqlResponse = &federationtypes.GraphQLResponse{
+		Data: map[string]interface{}{"hello": "world"},
+	}
+	if status := filterContext.responseStatusCode(); status != 200 {
+		t.Errorf("Expected 200 without errors, got %d", status)
+	}
+
+	filterContext.graphqlResponse = &federationtypes.GraphQLResponse{
+		Errors: []federationtypes.GraphQLError{
+			{Message: "bad field", Extensions: map[string]interface{}{"code": "QUERY_VALIDATION_ERROR"}},
+			{Message: "upstream failed", Extensions: map[string]interface{}{"code": "SERVICE_CALL_ERROR"}},
+		},
+	}
+	if status := filterContext.responseStatusCode(); status != 502 {
+		t.Errorf("Expected SERVICE_CALL_ERROR (higher severity) without data to map to 502, got %d", status)
+	}
+
+	config.HTTPStatusMapping = map[string]int{"SERVICE_CALL_ERROR": 503}
+	if status := filterContext.responseStatusCode(); status != 503 {
+		t.Errorf("Expected configured status 503, got %d", status)
+	}
+
+	filterContext.graphqlResponse = &federationtypes.GraphQLResponse{
+		Errors: []federationtypes.GraphQLError{
+			{Message: "gateway overloaded", Extensions: map[string]interface{}{"code": "SERVICE_UNAVAILABLE", "retryAfter": 1}},
+		},
+	}
+	filterContext.retryAfter = 1
+	if status := filterContext.responseStatusCode(); status != 503 {
+		t.Errorf("Expected shed request to map to 503, got %d", status)
+	}
+
+	// application/json 响应始终返回 200
+	filterContext.responseContentType = jsonMediaType
+	filterContext.graphqlResponse = &federationtypes.GraphQLResponse{
+		Errors: []federationtypes.GraphQLError{
+			{Message: "bad field", Extensions: map[string]interface{}{"code": "QUERY_VALIDATION_ERROR"}},
+		},
+	}
+	if status := filterContext.responseStatusCode(); status != 200 {
+		t.Errorf("Expected application/json responses to use 200, got %d", status)
+	}
+}
+
+func TestHTTPFilterContext_responseStatusCode_DataPresence(t *testing.T) {
+	config := &federationtypes.FederationConfig{
+		HTTPStatusMapping: map[string]int{"SERVICE_CALL_ERROR": 503},
+	}
+	filterContext := NewHTTPFilterContext(&RootContext{
+		config: config,
+		logger: &MockLogger{},
+	})
+
+	serviceErr := federationtypes.GraphQLError{Message: "upstream failed", Extensions: map[string]interface{}{"code": "SERVICE_CALL_ERROR"}}
+
+	tests := []struct {
+		name     string
+		response *federationtypes.GraphQLResponse
+		expected int
+	}{
+		{
+			name: "partial data",
+			response: &federationtypes.GraphQLResponse{
+				Data:   map[string]interface{}{"me": map[string]interface{}{"id": "1"}, "reviews": nil},
+				Errors: []federationtypes.GraphQLError{serviceErr},
+			},
+			expected: 200,
+		},
+		{
+			name: "parse failure",
+			response: &federationtypes.GraphQLResponse{
+				Errors: []federationtypes.GraphQLError{{Message: "syntax error", Extensions: map[string]interface{}{"code": "QUERY_PARSING_ERROR"}}},
+			},
+			expected: 400,
+		},
+		{
+			name: "all services down with data skeleton",
+			response: &federationtypes.GraphQLResponse{
+				Data:   map[string]interface{}{"me": nil, "reviews": nil},
+				Errors: []federationtypes.GraphQLError{serviceErr, serviceErr},
+			},
+			expected: 200,
+		},
+		{
+			name: "all services down without data",
+			response: &federationtypes.GraphQLResponse{
+				Data:   map[string]interface{}{},
+				Errors: []federationtypes.GraphQLError{{Message: "timeout", Extensions: map[string]interface{}{"code": "TIMEOUT_ERROR"}}},
+			},
+			expected: 502,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filterContext.graphqlResponse = tt.response
+			if status := filterContext.responseStatusCode(); status != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, status)
+			}
+		})
+	}
+}
+
+func TestNegotiateResponseContentType(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "application/json",
+		"application/json":                  "application/json",
+		"*/*":                               "application/json",
+		"application/graphql-response+json": "application/graphql-response+json",
+		"application/json, application/graphql-response+json;q=0.9": "application/graphql-response+json",
+		"application/graphql-response+json;q=0, application/json":   "application/json",
+	}
+
+	for accept, expected := range tests {
+		if contentType := negotiateResponseContentType(accept); contentType != expected {
+			t.Errorf("Accept %q: expected %s, got %s", accept, expected, contentType)
+		}
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	envelopes := []federationtypes.ResponseEnvelopeConfig{
+		{
+			Header:      "X-Client",
+			HeaderValue: "legacy",
+			Template: map[string]interface{}{
+				"result": "$data",
+				"meta":   map[string]interface{}{"errors": "$errors", "extensions": "$extensions", "version": "v1"},
+			},
+		},
+	}
+	headers := map[string]string{"x-client": "Legacy"}
+	header := func(name string) string { return headers[name] }
+
+	template := matchResponseEnvelope(envelopes, "/graphql?tracing=1", header)
+	if template == nil {
+		t.Fatal("Expected envelope to match legacy client header")
+	}
+
+	response := &federationtypes.GraphQLResponse{
+		Data:   map[string]interface{}{"user": map[string]interface{}{"id": "1"}},
+		Errors: []federationtypes.GraphQLError{{Message: "partial failure"}},
+	}
+	body, err := jsonutil.MarshalStable(applyResponseEnvelope(template, response))
+	if err != nil {
+		t.Fatalf("Failed to marshal envelope: %v", err)
+	}
+	expected := `{"meta":{"errors":[{"message":"partial failure"}],"version":"v1"},"result":{"user":{"id":"1"}}}`
+	if string(body) != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+
+	headers["x-client"] = "modern"
+	if template := matchResponseEnvelope(envelopes, "/graphql", header); template != nil {
+		t.Errorf("Expected standard envelope for other clients, got %v", template)
+	}
+}
+
 func TestHTTPFilterContext_getRequestMethod(t *testing.T) {
 	// 这个方法依赖于 proxy-wasm 的环境，我们无法在测试中直接调用
 	// 但我们可以在测试中验证方法的存在
@@ -28,7 +28,7 @@ type RootContext struct {
 // NewRootContext 创建新的根上下文
 func NewRootContext(vmConfigurationSize int) *RootContext {
 	return &RootContext{
-		logger: utils.NewLogger("graphql-federation"),
+		logger: utils.NewLoggerWithDebug("graphql-federation", false),
 	}
 }
 
@@ -155,6 +155,9 @@ func (ctx *RootContext) loadConfiguration(configData []byte) error {
 	// 设置默认值
 	ctx.setConfigDefaults(federationConfig)
 
+	// 按配置的格式和级别切换日志输出
+	ctx.logger = utils.NewLoggerWithFormat("graphql-federation", federationConfig.LogFormat, federationConfig.LogLevel == "debug")
+
 	ctx.config = federationConfig
 	ctx.logger.Info("Configuration loaded successfully",
 		"services", len(federationConfig.Services),
@@ -227,6 +230,14 @@ func (ctx *RootContext) performHealthChecks() {
 				"errorRate", serviceStatus.ErrorRate,
 			)
 		}
+
+		if serviceStatus.PinnedSchemaVersion != "" && serviceStatus.SchemaVersion != serviceStatus.PinnedSchemaVersion {
+			ctx.logger.Warn("Service schema does not match pinned version",
+				"service", serviceName,
+				"pinnedVersion", serviceStatus.PinnedSchemaVersion,
+				"schemaVersion", serviceStatus.SchemaVersion,
+			)
+		}
 	}
 }
 
@@ -238,11 +249,17 @@ func (ctx *RootContext) collectMetrics() {
 
 	status := ctx.federation.GetStatus()
 
+	coalescing := ctx.federation.GetCoalescingStats()
+
 	// 记录关键指标
 	ctx.logger.Debug("Engine metrics",
 		"uptime", status.Uptime,
 		"queryCount", status.QueryCount,
 		"errorCount", status.ErrorCount,
+		"coalescedRequests", coalescing.CoalescedRequests,
+		"stampedesPrevented", coalescing.StampedesPrevented,
+		"coalescingBytesSaved", coalescing.BytesSaved,
+		"maxConcurrentJoiners", coalescing.MaxConcurrentJoiners,
 	)
 }
 
@@ -2,10 +2,13 @@ package jsonutil
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
@@ -25,11 +28,26 @@ func MarshalString(v interface{}) (string, error) {
 	return marshalValue(v, 0)
 }
 
+// MarshalStable 将 Go 值序列化为字节稳定的 JSON：对象键（包括结构体字段）按字典序排列，
+// 数字和字符串转义使用固定格式，相同的逻辑值总是得到相同的字节，用于内容哈希缓存和响应签名
+func MarshalStable(v interface{}) ([]byte, error) {
+	var builder strings.Builder
+	if err := writeStable(&builder, v, 0); err != nil {
+		return nil, err
+	}
+	return []byte(builder.String()), nil
+}
+
 // Unmarshal 将 JSON 字节数组反序列化为 Go 值
 func Unmarshal(data []byte, v interface{}) error {
 	return UnmarshalString(string(data), v)
 }
 
+// Valid 判断字节数组是否为合法 JSON
+func Valid(data []byte) bool {
+	return gjson.ValidBytes(data)
+}
+
 // UnmarshalString 将 JSON 字符串反序列化为 Go 值
 func UnmarshalString(jsonStr string, v interface{}) error {
 	val := reflect.ValueOf(v)
@@ -216,6 +234,190 @@ func marshalStruct(val reflect.Value, depth int) (string, error) {
 	return result, nil
 }
 
+// stableMember 稳定序列化时的对象成员
+type stableMember struct {
+	key   string
+	value interface{}
+}
+
+func writeStable(builder *strings.Builder, v interface{}, depth int) error {
+	if depth > 32 {
+		return fmt.Errorf("maximum nesting depth exceeded")
+	}
+
+	if v == nil {
+		builder.WriteString("null")
+		return nil
+	}
+
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.String:
+		writeStableString(builder, val.String())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		builder.WriteString(strconv.FormatInt(val.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		builder.WriteString(strconv.FormatUint(val.Uint(), 10))
+
+	case reflect.Float32, reflect.Float64:
+		f := val.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("unsupported float value: %v", f)
+		}
+		bitSize := 64
+		if val.Kind() == reflect.Float32 {
+			bitSize = 32
+		}
+		// 整数值的浮点数与整数输出相同，避免 1 和 1.0 产生不同字节
+		builder.WriteString(strconv.FormatFloat(f, 'f', -1, bitSize))
+
+	case reflect.Bool:
+		builder.WriteString(strconv.FormatBool(val.Bool()))
+
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			builder.WriteString("null")
+			return nil
+		}
+		builder.WriteByte('[')
+		for i := 0; i < val.Len(); i++ {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			if err := writeStable(builder, val.Index(i).Interface(), depth+1); err != nil {
+				return err
+			}
+		}
+		builder.WriteByte(']')
+
+	case reflect.Map:
+		if val.IsNil() {
+			builder.WriteString("null")
+			return nil
+		}
+		members := make([]stableMember, 0, val.Len())
+		for _, key := range val.MapKeys() {
+			members = append(members, stableMember{
+				key:   fmt.Sprintf("%v", key.Interface()),
+				value: val.MapIndex(key).Interface(),
+			})
+		}
+		return writeStableObject(builder, members, depth)
+
+	case reflect.Struct:
+		return writeStableObject(builder, structMembers(val), depth)
+
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			builder.WriteString("null")
+			return nil
+		}
+		return writeStable(builder, val.Elem().Interface(), depth)
+
+	default:
+		return fmt.Errorf("unsupported type: %s", val.Kind())
+	}
+
+	return nil
+}
+
+// structMembers 按 json 标签收集结构体的可导出字段，规则与 marshalStruct 相同
+func structMembers(val reflect.Value) []stableMember {
+	typ := val.Type()
+	members := make([]stableMember, 0, val.NumField())
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		fieldType := typ.Field(i)
+
+		if !field.CanInterface() {
+			continue
+		}
+
+		tag := fieldType.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		fieldName := fieldType.Name
+		omitEmpty := false
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				fieldName = parts[0]
+			}
+			for _, part := range parts[1:] {
+				if part == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+
+		if omitEmpty && isEmptyValue(field) {
+			continue
+		}
+
+		members = append(members, stableMember{key: fieldName, value: field.Interface()})
+	}
+
+	return members
+}
+
+func writeStableObject(builder *strings.Builder, members []stableMember, depth int) error {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].key < members[j].key
+	})
+
+	builder.WriteByte('{')
+	for i, member := range members {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		writeStableString(builder, member.key)
+		builder.WriteByte(':')
+		if err := writeStable(builder, member.value, depth+1); err != nil {
+			return err
+		}
+	}
+	builder.WriteByte('}')
+	return nil
+}
+
+// writeStableString 以固定规则转义字符串：控制字符使用短转义或 \u00XX，非法 UTF-8 替换为 \ufffd
+func writeStableString(builder *strings.Builder, s string) {
+	builder.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			builder.WriteString(`\ufffd`)
+		case r == '"':
+			builder.WriteString(`\"`)
+		case r == '\\':
+			builder.WriteString(`\\`)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\t':
+			builder.WriteString(`\t`)
+		case r == '\b':
+			builder.WriteString(`\b`)
+		case r == '\f':
+			builder.WriteString(`\f`)
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(builder, `\u%04x`, r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	builder.WriteByte('"')
+}
+
 func unmarshalValue(jsonStr string, path string, val reflect.Value) error {
 	var result gjson.Result
 	if path == "" {
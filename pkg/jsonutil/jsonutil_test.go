@@ -270,6 +270,44 @@ func TestMarshal_Pointer(t *testing.T) {
 	}
 }
 
+func TestMarshalStable_Deterministic(t *testing.T) {
+	type response struct {
+		Errors []map[string]interface{} `json:"errors,omitempty"`
+		Data   map[string]interface{}   `json:"data"`
+	}
+
+	value := response{
+		Data: map[string]interface{}{
+			"zeta":  []interface{}{1, 2.5, float64(3)},
+			"alpha": map[string]interface{}{"b": "line\nbreak \"quoted\"", "a": nil, "c": true},
+			"mid":   "tab\tand\u0001control",
+		},
+		Errors: []map[string]interface{}{{"message": "boom", "path": []interface{}{"zeta", 0}}},
+	}
+
+	first, err := MarshalStable(value)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := MarshalStable(value)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(again) != string(first) {
+			t.Fatalf("Expected identical bytes, got %s and %s", first, again)
+		}
+	}
+
+	expected := `{"data":{"alpha":{"a":null,"b":"line\nbreak \"quoted\"","c":true},"mid":"tab\tand\u0001control","zeta":[1,2.5,3]},"errors":[{"message":"boom","path":["zeta",0]}]}`
+	if string(first) != expected {
+		t.Errorf("Expected %s, got %s", expected, first)
+	}
+	if !Valid(first) {
+		t.Errorf("Expected valid JSON, got %s", first)
+	}
+}
+
 func TestUnmarshal_NilPointer(t *testing.T) {
 	var target *int
 	err := Unmarshal([]byte("42"), target)
@@ -0,0 +1,28 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// mergeDeadlineExceeded 判断是否应跳过后续响应的数据：已合并至少一个响应且上下文已超出截止时间，
+// 保证超时时仍返回部分数据
+func mergeDeadlineExceeded(ctx context.Context, merged int) bool {
+	return merged > 0 && ctx.Err() != nil
+}
+
+// mergeTimeoutError 合并超出截止时间时附加的错误，列出数据未被合并的服务
+func mergeTimeoutError(skipped []string) federationtypes.GraphQLError {
+	timeoutErr := errors.NewFederationError(errors.ErrCodeTimeout,
+		fmt.Sprintf("response merging exceeded its deadline, data from %d service response(s) was omitted", len(skipped)),
+		errors.WithExtension("reason", "MERGE_TIMEOUT"),
+		errors.WithExtension("skippedServices", skipped),
+	)
+	return federationtypes.GraphQLError{
+		Message:    timeoutErr.Message,
+		Extensions: timeoutErr.ToGraphQLError()["extensions"].(map[string]interface{}),
+	}
+}
@@ -3,6 +3,7 @@ package merger
 import (
 	"context"
 	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	stderrors "errors"
 	"fmt"
 	"reflect"
 	"sort"
@@ -25,6 +26,16 @@ type MergerConfig struct {
 	TypeMapping    map[string]string      // 类型映射
 	FieldMapping   map[string]FieldMerger // 字段合并器映射
 	EnableMetrics  bool                   // 是否启用指标收集
+
+	ListMergePolicy ListMergePolicy            // 列表合并策略
+	ListMergePaths  map[string]ListMergePolicy // 按路径覆盖的列表合并策略（如 "users" 或 "user.orders"）
+	ListMergeKeys   []string                   // unionByKey 使用的键字段
+
+	ErrorCodeMapping map[string]string // 子图错误码到规范错误码的映射，原值保存在 extensions.originalCode
+
+	UnknownFieldPolicy UnknownFieldPolicy // 子图返回计划选择集之外字段的处理策略
+
+	StrictFieldTypes bool // 同一字段在不同服务中的值类型不兼容时返回合并错误，而不是按冲突策略静默取值
 }
 
 // ConflictPolicy 冲突处理策略
@@ -46,6 +57,23 @@ const (
 	NullPolicyOverride NullPolicy = "override" // null覆盖非null
 )
 
+// ListMergePolicy 列表合并策略
+type ListMergePolicy string
+
+const (
+	ListMergePolicyConcat     ListMergePolicy = "concat"     // 连接后去重
+	ListMergePolicyUnionByKey ListMergePolicy = "unionByKey" // 按键字段合并相同实体
+	ListMergePolicyZipByIndex ListMergePolicy = "zipByIndex" // 按索引逐项合并
+)
+
+// UnknownFieldPolicy 未选择字段处理策略
+type UnknownFieldPolicy string
+
+const (
+	UnknownFieldPolicyKeep UnknownFieldPolicy = "keep" // 保留子图返回的全部字段
+	UnknownFieldPolicyDrop UnknownFieldPolicy = "drop" // 合并时丢弃不在 plan.Selection 中的字段
+)
+
 // FieldMerger 字段合并器接口
 type FieldMerger interface {
 	MergeField(fieldName string, values []interface{}) (interface{}, error)
@@ -89,6 +117,12 @@ func DefaultMergerConfig() *MergerConfig {
 		TypeMapping:    make(map[string]string),
 		FieldMapping:   make(map[string]FieldMerger),
 		EnableMetrics:  true,
+
+		ListMergePolicy: ListMergePolicyConcat,
+		ListMergePaths:  make(map[string]ListMergePolicy),
+		ListMergeKeys:   []string{"id"},
+
+		UnknownFieldPolicy: UnknownFieldPolicyKeep,
 	}
 }
 
@@ -107,6 +141,9 @@ func (m *ResponseMerger) MergeResponses(ctx context.Context, responses []*federa
 		}
 	}
 
+	// 按计划中的子查询顺序合并，first/last 冲突策略不受子查询完成顺序影响
+	responses = orderByPlan(responses, plan)
+
 	m.logger.Debug("Merging responses",
 		"responseCount", len(responses),
 		"strategy", plan.MergeStrategy,
@@ -123,6 +160,36 @@ func (m *ResponseMerger) MergeResponses(ctx context.Context, responses []*federa
 	}
 }
 
+// orderByPlan 按服务在计划子查询中首次出现的位置稳定排序响应，计划外的服务排在最后。
+// 返回新切片，不修改调用方的响应顺序
+func orderByPlan(responses []*federationtypes.ServiceResponse, plan *federationtypes.ExecutionPlan) []*federationtypes.ServiceResponse {
+	if len(plan.SubQueries) == 0 {
+		return responses
+	}
+
+	rank := make(map[string]int, len(plan.SubQueries))
+	for i, subQuery := range plan.SubQueries {
+		if _, exists := rank[subQuery.ServiceName]; !exists {
+			rank[subQuery.ServiceName] = i
+		}
+	}
+	rankOf := func(response *federationtypes.ServiceResponse) int {
+		if response == nil {
+			return len(plan.SubQueries)
+		}
+		if index, ok := rank[response.Service]; ok {
+			return index
+		}
+		return len(plan.SubQueries)
+	}
+
+	ordered := append([]*federationtypes.ServiceResponse(nil), responses...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rankOf(ordered[i]) < rankOf(ordered[j])
+	})
+	return ordered
+}
+
 // mergeDeep 深度合并响应
 func (m *ResponseMerger) mergeDeep(ctx context.Context, responses []*federationtypes.ServiceResponse, plan *federationtypes.ExecutionPlan) (*federationtypes.GraphQLResponse, error) {
 	result := &federationtypes.GraphQLResponse{
@@ -131,6 +198,7 @@ func (m *ResponseMerger) mergeDeep(ctx context.Context, responses []*federationt
 
 	var allErrors []federationtypes.GraphQLError
 	var validResponses []*federationtypes.ServiceResponse
+	var skippedServices []string
 	mergedServices := make([]string, 0, len(responses))
 
 	// 收集有效响应和错误
@@ -138,26 +206,32 @@ func (m *ResponseMerger) mergeDeep(ctx context.Context, responses []*federationt
 		if resp.Error != nil {
 			// 将服务错误转换为GraphQL错误
 			graphqlErr := federationtypes.GraphQLError{
-				Message: fmt.Sprintf("Service %s error: %s", resp.Service, resp.Error.Error()),
-				Extensions: map[string]interface{}{
-					"service": resp.Service,
-					"code":    "SERVICE_ERROR",
-				},
+				Message:    fmt.Sprintf("Service %s error: %s", resp.Service, resp.Error.Error()),
+				Extensions: serviceErrorExtensions(resp),
 			}
 			allErrors = append(allErrors, graphqlErr)
 			continue
 		}
 
 		if resp.Errors != nil {
-			allErrors = append(allErrors, resp.Errors...)
+			allErrors = append(allErrors, MapErrorCodes(AnnotateServiceErrors(resp), m.config.ErrorCodeMapping)...)
 		}
 
 		if resp.Data != nil {
-			validResponses = append(validResponses, resp)
+			// 超出截止时间后不再合并后续数据，错误仍然收集
+			if mergeDeadlineExceeded(ctx, len(validResponses)) {
+				skippedServices = append(skippedServices, resp.Service)
+				continue
+			}
+			validResponses = append(validResponses, m.dropUnknownFields(resp, plan))
 			mergedServices = append(mergedServices, resp.Service)
 		}
 	}
 
+	if len(skippedServices) > 0 {
+		allErrors = append(allErrors, mergeTimeoutError(skippedServices))
+	}
+
 	// 如果没有有效数据，返回错误
 	if len(validResponses) == 0 {
 		result.Errors = allErrors
@@ -165,8 +239,11 @@ func (m *ResponseMerger) mergeDeep(ctx context.Context, responses []*federationt
 	}
 
 	// 深度合并数据
-	mergedData, err := m.mergeDataDeep(validResponses, 0)
+	mergedData, err := m.mergeDataDeep(validResponses, "", 0)
 	if err != nil {
+		if isFieldTypeConflict(err) {
+			return nil, err
+		}
 		return nil, errors.NewMergeError("deep merge failed: " + err.Error())
 	}
 
@@ -191,35 +268,41 @@ func (m *ResponseMerger) mergeShallow(ctx context.Context, responses []*federati
 
 	var allErrors []federationtypes.GraphQLError
 	dataMap := result.Data.(map[string]interface{})
+	var skippedServices []string
 	mergedServices := make([]string, 0, len(responses))
 
 	// 浅合并每个响应
 	for _, resp := range responses {
 		if resp.Error != nil {
 			graphqlErr := federationtypes.GraphQLError{
-				Message: fmt.Sprintf("Service %s error: %s", resp.Service, resp.Error.Error()),
-				Extensions: map[string]interface{}{
-					"service": resp.Service,
-					"code":    "SERVICE_ERROR",
-				},
+				Message:    fmt.Sprintf("Service %s error: %s", resp.Service, resp.Error.Error()),
+				Extensions: serviceErrorExtensions(resp),
 			}
 			allErrors = append(allErrors, graphqlErr)
 			continue
 		}
 
 		if resp.Errors != nil {
-			allErrors = append(allErrors, resp.Errors...)
+			allErrors = append(allErrors, MapErrorCodes(AnnotateServiceErrors(resp), m.config.ErrorCodeMapping)...)
 		}
 
 		if resp.Data != nil {
+			// 超出截止时间后不再合并后续数据，错误仍然收集
+			if mergeDeadlineExceeded(ctx, len(mergedServices)) {
+				skippedServices = append(skippedServices, resp.Service)
+				continue
+			}
 			mergedServices = append(mergedServices, resp.Service)
 
 			// 将响应数据合并到结果中
-			if respData, ok := resp.Data.(map[string]interface{}); ok {
+			if respData, ok := m.dropUnknownFields(resp, plan).Data.(map[string]interface{}); ok {
 				for key, value := range respData {
 					if existing, exists := dataMap[key]; exists {
 						// 处理字段冲突
 						mergedValue, err := m.resolveFieldConflict(key, existing, value)
+						if isFieldTypeConflict(err) {
+							return nil, err
+						}
 						if err != nil {
 							m.logger.Warn("Field conflict resolution failed",
 								"field", key,
@@ -237,6 +320,10 @@ func (m *ResponseMerger) mergeShallow(ctx context.Context, responses []*federati
 		}
 	}
 
+	if len(skippedServices) > 0 {
+		allErrors = append(allErrors, mergeTimeoutError(skippedServices))
+	}
+
 	result.Errors = m.MergeErrors(allErrors)
 	result.Extensions = m.MergeExtensions(m.extractExtensions(responses))
 
@@ -249,8 +336,84 @@ func (m *ResponseMerger) mergeShallow(ctx context.Context, responses []*federati
 	return result, nil
 }
 
+// dropUnknownFields 按 UnknownFieldPolicy 丢弃响应数据中不在计划选择集内的字段，__typename 始终保留。
+// 未丢弃任何字段时返回原响应，否则返回数据替换后的副本，不修改子图响应
+func (m *ResponseMerger) dropUnknownFields(resp *federationtypes.ServiceResponse, plan *federationtypes.ExecutionPlan) *federationtypes.ServiceResponse {
+	if m.config.UnknownFieldPolicy != UnknownFieldPolicyDrop || plan.Selection == nil {
+		return resp
+	}
+
+	data, dropped := dropUnselected(plan.Selection, resp.Data)
+	if !dropped {
+		return resp
+	}
+
+	m.logger.Debug("Dropped unselected fields from service response", "service", resp.Service)
+	pruned := *resp
+	pruned.Data = data
+	return &pruned
+}
+
+// dropUnselected 返回去除未选择字段后的值，仅在确有字段被丢弃的分支上复制对象和列表
+func dropUnselected(node *federationtypes.SelectionNode, value interface{}) (interface{}, bool) {
+	if node == nil || node.Children == nil {
+		return value, false
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var result map[string]interface{}
+		for key, fieldValue := range v {
+			child, selected := node.Children[key]
+			if !selected && key != "__typename" {
+				if result == nil {
+					result = copyObject(v)
+				}
+				delete(result, key)
+				continue
+			}
+
+			if pruned, dropped := dropUnselected(child, fieldValue); dropped {
+				if result == nil {
+					result = copyObject(v)
+				}
+				result[key] = pruned
+			}
+		}
+		if result == nil {
+			return value, false
+		}
+		return result, true
+	case []interface{}:
+		var result []interface{}
+		for i, item := range v {
+			if pruned, dropped := dropUnselected(node, item); dropped {
+				if result == nil {
+					result = append([]interface{}(nil), v...)
+				}
+				result[i] = pruned
+			}
+		}
+		if result == nil {
+			return value, false
+		}
+		return result, true
+	default:
+		return value, false
+	}
+}
+
+// copyObject 浅拷贝对象
+func copyObject(object map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		copied[key] = value
+	}
+	return copied
+}
+
 // mergeDataDeep 深度合并数据
-func (m *ResponseMerger) mergeDataDeep(responses []*federationtypes.ServiceResponse, depth int) (interface{}, error) {
+func (m *ResponseMerger) mergeDataDeep(responses []*federationtypes.ServiceResponse, path string, depth int) (interface{}, error) {
 	if depth > m.config.MaxDepth {
 		return nil, fmt.Errorf("maximum merge depth %d exceeded", m.config.MaxDepth)
 	}
@@ -279,9 +442,9 @@ func (m *ResponseMerger) mergeDataDeep(responses []*federationtypes.ServiceRespo
 	firstItem := dataItems[0]
 	switch firstType := firstItem.(type) {
 	case map[string]interface{}:
-		return m.mergeObjects(dataItems, depth)
+		return m.mergeObjects(dataItems, path, depth)
 	case []interface{}:
-		return m.mergeArrays(dataItems, depth)
+		return m.mergeArrays(dataItems, path, depth)
 	default:
 		// 对于基本类型，使用冲突解决策略
 		return m.resolvePrimitiveConflict(dataItems, reflect.TypeOf(firstType).String())
@@ -289,7 +452,7 @@ func (m *ResponseMerger) mergeDataDeep(responses []*federationtypes.ServiceRespo
 }
 
 // mergeObjects 合并对象
-func (m *ResponseMerger) mergeObjects(objects []interface{}, depth int) (map[string]interface{}, error) {
+func (m *ResponseMerger) mergeObjects(objects []interface{}, path string, depth int) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 
 	for _, obj := range objects {
@@ -305,7 +468,7 @@ func (m *ResponseMerger) mergeObjects(objects []interface{}, depth int) (map[str
 					mergedValue, err := m.mergeDataDeep([]*federationtypes.ServiceResponse{
 						{Data: existing},
 						{Data: value},
-					}, depth+1)
+					}, joinMergePath(path, key), depth+1)
 					if err != nil {
 						return nil, err
 					}
@@ -328,7 +491,19 @@ func (m *ResponseMerger) mergeObjects(objects []interface{}, depth int) (map[str
 }
 
 // mergeArrays 合并数组
-func (m *ResponseMerger) mergeArrays(arrays []interface{}, depth int) ([]interface{}, error) {
+func (m *ResponseMerger) mergeArrays(arrays []interface{}, path string, depth int) ([]interface{}, error) {
+	switch m.listMergePolicyFor(path) {
+	case ListMergePolicyUnionByKey:
+		return m.mergeArraysByKey(arrays, path, depth)
+	case ListMergePolicyZipByIndex:
+		return m.mergeArraysByIndex(arrays, path, depth)
+	default:
+		return m.concatArrays(arrays), nil
+	}
+}
+
+// concatArrays 连接数组并去重
+func (m *ResponseMerger) concatArrays(arrays []interface{}) []interface{} {
 	var result []interface{}
 
 	for _, arr := range arrays {
@@ -340,7 +515,138 @@ func (m *ResponseMerger) mergeArrays(arrays []interface{}, depth int) ([]interfa
 	}
 
 	// 去重（基于JSON序列化比较）
-	return m.deduplicateArray(result), nil
+	return m.deduplicateArray(result)
+}
+
+// mergeArraysByKey 按键字段合并数组，相同键的元素深度合并
+func (m *ResponseMerger) mergeArraysByKey(arrays []interface{}, path string, depth int) ([]interface{}, error) {
+	var result []interface{}
+	keyIndex := make(map[string]int)
+
+	for _, arr := range arrays {
+		arrSlice, ok := arr.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, item := range arrSlice {
+			key, ok := m.listItemKey(item)
+			if !ok {
+				// 无法提取键，按原样保留
+				result = append(result, item)
+				continue
+			}
+
+			idx, exists := keyIndex[key]
+			if !exists {
+				keyIndex[key] = len(result)
+				result = append(result, item)
+				continue
+			}
+
+			merged, err := m.mergeListItems(result[idx], item, path, depth)
+			if err != nil {
+				return nil, err
+			}
+			result[idx] = merged
+		}
+	}
+
+	return result, nil
+}
+
+// mergeArraysByIndex 按索引合并数组，第 i 个元素彼此合并
+func (m *ResponseMerger) mergeArraysByIndex(arrays []interface{}, path string, depth int) ([]interface{}, error) {
+	var result []interface{}
+
+	for _, arr := range arrays {
+		arrSlice, ok := arr.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for i, item := range arrSlice {
+			if i >= len(result) {
+				result = append(result, item)
+				continue
+			}
+
+			merged, err := m.mergeListItems(result[i], item, path, depth)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = merged
+		}
+	}
+
+	return result, nil
+}
+
+// mergeListItems 合并两个列表元素
+func (m *ResponseMerger) mergeListItems(existing, value interface{}, path string, depth int) (interface{}, error) {
+	if m.shouldMergeRecursively(existing, value) {
+		return m.mergeDataDeep([]*federationtypes.ServiceResponse{
+			{Data: existing},
+			{Data: value},
+		}, path, depth+1)
+	}
+
+	return m.resolveFieldConflict(path, existing, value)
+}
+
+// listItemKey 提取列表元素的键（基于配置的键字段）
+func (m *ResponseMerger) listItemKey(item interface{}) (string, bool) {
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	keyFields := m.config.ListMergeKeys
+	if len(keyFields) == 0 {
+		keyFields = []string{"id"}
+	}
+
+	keyParts := make(map[string]interface{}, len(keyFields)+1)
+	for _, field := range keyFields {
+		value, exists := obj[field]
+		if !exists || value == nil {
+			return "", false
+		}
+		keyParts[field] = value
+	}
+
+	// 不同类型的实体即使键相同也不合并
+	if typeName, exists := obj["__typename"]; exists {
+		keyParts["__typename"] = typeName
+	}
+
+	keyBytes, err := jsonutil.Marshal(keyParts)
+	if err != nil {
+		return "", false
+	}
+
+	return string(keyBytes), true
+}
+
+// listMergePolicyFor 获取指定路径的列表合并策略
+func (m *ResponseMerger) listMergePolicyFor(path string) ListMergePolicy {
+	if policy, ok := m.config.ListMergePaths[path]; ok && policy != "" {
+		return policy
+	}
+
+	if m.config.ListMergePolicy != "" {
+		return m.config.ListMergePolicy
+	}
+
+	return ListMergePolicyConcat
+}
+
+// joinMergePath 拼接合并路径
+func joinMergePath(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
 }
 
 // shouldMergeRecursively 判断是否应该递归合并
@@ -383,6 +689,10 @@ func (m *ResponseMerger) resolveFieldConflict(fieldName string, existing, value
 		return value, nil
 	}
 
+	if err := m.checkFieldTypes(fieldName, existing, value); err != nil {
+		return nil, err
+	}
+
 	// 使用冲突策略
 	switch m.config.ConflictPolicy {
 	case ConflictPolicyFirst:
@@ -404,9 +714,9 @@ func (m *ResponseMerger) attemptMerge(existing, value interface{}) (interface{},
 	if reflect.TypeOf(existing) == reflect.TypeOf(value) {
 		switch existing.(type) {
 		case map[string]interface{}:
-			return m.mergeObjects([]interface{}{existing, value}, 0)
+			return m.mergeObjects([]interface{}{existing, value}, "", 0)
 		case []interface{}:
-			return m.mergeArrays([]interface{}{existing, value}, 0)
+			return m.mergeArrays([]interface{}{existing, value}, "", 0)
 		case string:
 			// 字符串合并（用空格连接）
 			return fmt.Sprintf("%s %s", existing, value), nil
@@ -510,6 +820,100 @@ func (m *ResponseMerger) deduplicateArray(arr []interface{}) []interface{} {
 	return result
 }
 
+// serviceErrorExtensions 构建服务调用失败时的 GraphQL 错误扩展字段，调试模式下引擎附加在
+// FederationError 上的子查询和变量一并带出
+func serviceErrorExtensions(resp *federationtypes.ServiceResponse) map[string]interface{} {
+	extensions := map[string]interface{}{
+		"service": resp.Service,
+		"code":    "SERVICE_ERROR",
+	}
+
+	var fedErr *errors.FederationError
+	if stderrors.As(resp.Error, &fedErr) {
+		for _, key := range []string{errors.ExtensionSubQuery, errors.ExtensionVariables} {
+			if value, exists := fedErr.Extensions[key]; exists {
+				extensions[key] = value
+			}
+		}
+	}
+	return extensions
+}
+
+// AnnotateServiceErrors 返回子图错误的副本：保留原有 extensions，补充来源服务，并将 _entities 路径重定位到联邦查询路径
+func AnnotateServiceErrors(resp *federationtypes.ServiceResponse) []federationtypes.GraphQLError {
+	if len(resp.Errors) == 0 {
+		return nil
+	}
+
+	annotated := make([]federationtypes.GraphQLError, len(resp.Errors))
+	for i, err := range resp.Errors {
+		extensions := make(map[string]interface{}, len(err.Extensions)+1)
+		for key, value := range err.Extensions {
+			extensions[key] = value
+		}
+		if _, exists := extensions["service"]; !exists && resp.Service != "" {
+			extensions["service"] = resp.Service
+		}
+
+		err.Extensions = extensions
+		err.Path = rebaseErrorPath(err.Path, resp.EntityPaths)
+		annotated[i] = err
+	}
+
+	return annotated
+}
+
+// MapErrorCodes 按映射改写错误的 extensions.code，原值保存在 extensions.originalCode，未映射的错误码保持不变。
+// 会直接修改传入错误的 extensions，调用方应传入副本
+func MapErrorCodes(errs []federationtypes.GraphQLError, mapping map[string]string) []federationtypes.GraphQLError {
+	if len(mapping) == 0 {
+		return errs
+	}
+
+	for _, err := range errs {
+		code, ok := err.Extensions["code"].(string)
+		if !ok {
+			continue
+		}
+		if canonical, mapped := mapping[code]; mapped && canonical != code {
+			err.Extensions["originalCode"] = code
+			err.Extensions["code"] = canonical
+		}
+	}
+
+	return errs
+}
+
+// rebaseErrorPath 将 ["_entities", i, ...] 形式的路径替换为第 i 个实体在联邦响应中的路径
+func rebaseErrorPath(path []interface{}, entityPaths [][]interface{}) []interface{} {
+	if len(path) < 2 || path[0] != "_entities" {
+		return path
+	}
+
+	index, ok := pathIndex(path[1])
+	if !ok || index < 0 || index >= len(entityPaths) || entityPaths[index] == nil {
+		return path
+	}
+
+	rebased := make([]interface{}, 0, len(entityPaths[index])+len(path)-2)
+	rebased = append(rebased, entityPaths[index]...)
+	return append(rebased, path[2:]...)
+}
+
+// pathIndex 将路径中的列表下标转换为 int，兼容 JSON 解码得到的 float64
+func pathIndex(segment interface{}) (int, bool) {
+	switch v := segment.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
 // MergeErrors 合并错误信息
 func (m *ResponseMerger) MergeErrors(errors []federationtypes.GraphQLError) []federationtypes.GraphQLError {
 	if len(errors) == 0 {
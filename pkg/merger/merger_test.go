@@ -2,8 +2,10 @@ package merger
 
 import (
 	"context"
+	stderrors "errors"
 	"testing"
 
+	"envoy-wasm-graphql-federation/pkg/errors"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
 
@@ -302,3 +304,368 @@ func TestMergeResponses_NilPlan(t *testing.T) {
 		t.Log("Result is not nil as expected")
 	}
 }
+
+func TestMergeResponses_ListMergePolicies(t *testing.T) {
+	ctx := context.Background()
+	plan := &federationtypes.ExecutionPlan{MergeStrategy: federationtypes.MergeStrategyDeep}
+
+	newResponses := func() []*federationtypes.ServiceResponse {
+		return []*federationtypes.ServiceResponse{
+			{
+				Service: "users",
+				Data: map[string]interface{}{
+					"users": []interface{}{
+						map[string]interface{}{"id": "1", "name": "Alice"},
+						map[string]interface{}{"id": "2", "name": "Bob"},
+					},
+				},
+			},
+			{
+				Service: "reviews",
+				Data: map[string]interface{}{
+					"users": []interface{}{
+						map[string]interface{}{"id": "1", "rating": 5.0},
+						map[string]interface{}{"id": "2", "rating": 3.0},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		config   func(*MergerConfig)
+		expected int
+	}{
+		{
+			name:     "concat",
+			config:   func(c *MergerConfig) {},
+			expected: 4,
+		},
+		{
+			name:     "unionByKey",
+			config:   func(c *MergerConfig) { c.ListMergePolicy = ListMergePolicyUnionByKey },
+			expected: 2,
+		},
+		{
+			name:     "zipByIndex via path override",
+			config:   func(c *MergerConfig) { c.ListMergePaths["users"] = ListMergePolicyZipByIndex },
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultMergerConfig()
+			tt.config(config)
+			merger := NewResponseMerger(config, &MockLogger{})
+
+			result, err := merger.MergeResponses(ctx, newResponses(), plan)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			users := result.Data.(map[string]interface{})["users"].([]interface{})
+			if len(users) != tt.expected {
+				t.Fatalf("Expected %d users, got %d", tt.expected, len(users))
+			}
+
+			if tt.expected == 2 {
+				first := users[0].(map[string]interface{})
+				if first["name"] != "Alice" || first["rating"] != 5.0 {
+					t.Errorf("Expected merged first user, got %v", first)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeResponses_ConflictPolicyFollowsPlanOrder(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		policy   ConflictPolicy
+		strategy federationtypes.MergeStrategy
+		expected string
+	}{
+		{ConflictPolicyFirst, federationtypes.MergeStrategyShallow, "from users"},
+		{ConflictPolicyLast, federationtypes.MergeStrategyShallow, "from accounts"},
+		{ConflictPolicyFirst, federationtypes.MergeStrategyDeep, "from users"},
+		{ConflictPolicyLast, federationtypes.MergeStrategyDeep, "from accounts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+string(tt.strategy), func(t *testing.T) {
+			config := DefaultMergerConfig()
+			config.ConflictPolicy = tt.policy
+			merger := NewResponseMerger(config, &MockLogger{})
+			plan := &federationtypes.ExecutionPlan{
+				MergeStrategy: tt.strategy,
+				SubQueries:    []federationtypes.SubQuery{{ServiceName: "users"}, {ServiceName: "accounts"}},
+			}
+
+			// 两种到达顺序都按计划顺序处理
+			for _, order := range [][]string{{"users", "accounts"}, {"accounts", "users"}} {
+				var responses []*federationtypes.ServiceResponse
+				for _, service := range order {
+					responses = append(responses, &federationtypes.ServiceResponse{
+						Service: service,
+						Data:    map[string]interface{}{"status": "from " + service},
+					})
+				}
+
+				result, err := merger.MergeResponses(ctx, responses, plan)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if status := result.Data.(map[string]interface{})["status"]; status != tt.expected {
+					t.Errorf("Arrival order %v: expected %q, got %v", order, tt.expected, status)
+				}
+				if responses[0].Service != order[0] {
+					t.Errorf("Caller's response order should not be modified")
+				}
+			}
+		})
+	}
+}
+
+func TestMergeResponses_PreservesSubgraphErrorExtensions(t *testing.T) {
+	merger := NewResponseMerger(nil, &MockLogger{})
+
+	responses := []*federationtypes.ServiceResponse{
+		{
+			Service: "users",
+			Data:    map[string]interface{}{"_entities": []interface{}{nil}},
+			Errors: []federationtypes.GraphQLError{
+				{
+					Message:    "not allowed",
+					Path:       []interface{}{"_entities", float64(0), "email"},
+					Extensions: map[string]interface{}{"code": "FORBIDDEN", "classification": "auth"},
+				},
+			},
+			EntityPaths: [][]interface{}{{"reviews", 2, "author"}},
+		},
+	}
+
+	for _, strategy := range []federationtypes.MergeStrategy{federationtypes.MergeStrategyDeep, federationtypes.MergeStrategyShallow} {
+		result, err := merger.MergeResponses(context.Background(), responses, &federationtypes.ExecutionPlan{MergeStrategy: strategy})
+		if err != nil {
+			t.Fatalf("MergeResponses(%s) error = %v", strategy, err)
+		}
+		if len(result.Errors) != 1 {
+			t.Fatalf("Expected 1 error, got %+v", result.Errors)
+		}
+
+		graphqlErr := result.Errors[0]
+		if graphqlErr.Extensions["code"] != "FORBIDDEN" || graphqlErr.Extensions["classification"] != "auth" {
+			t.Errorf("Expected subgraph extensions to survive merging, got %v", graphqlErr.Extensions)
+		}
+		if graphqlErr.Extensions["service"] != "users" {
+			t.Errorf("Expected originating service annotation, got %v", graphqlErr.Extensions["service"])
+		}
+
+		expectedPath := []interface{}{"reviews", 2, "author", "email"}
+		if len(graphqlErr.Path) != len(expectedPath) {
+			t.Fatalf("Expected rebased path %v, got %v", expectedPath, graphqlErr.Path)
+		}
+		for i := range expectedPath {
+			if graphqlErr.Path[i] != expectedPath[i] {
+				t.Errorf("Expected rebased path %v, got %v", expectedPath, graphqlErr.Path)
+				break
+			}
+		}
+	}
+
+	if _, exists := responses[0].Errors[0].Extensions["service"]; exists {
+		t.Error("Expected original subgraph error to be left untouched")
+	}
+}
+
+func TestMergeResponses_ErrorCodeMapping(t *testing.T) {
+	config := DefaultMergerConfig()
+	config.ErrorCodeMapping = map[string]string{"E_NOT_FOUND": "NOT_FOUND"}
+	merger := NewResponseMerger(config, &MockLogger{})
+
+	responses := []*federationtypes.ServiceResponse{
+		{
+			Service: "users",
+			Errors: []federationtypes.GraphQLError{
+				{Message: "missing", Extensions: map[string]interface{}{"code": "E_NOT_FOUND"}},
+				{Message: "denied", Extensions: map[string]interface{}{"code": "FORBIDDEN"}},
+				{Message: "plain"},
+			},
+		},
+	}
+
+	for _, strategy := range []federationtypes.MergeStrategy{federationtypes.MergeStrategyDeep, federationtypes.MergeStrategyShallow} {
+		result, err := merger.MergeResponses(context.Background(), responses, &federationtypes.ExecutionPlan{MergeStrategy: strategy})
+		if err != nil {
+			t.Fatalf("MergeResponses(%s) error = %v", strategy, err)
+		}
+
+		byMessage := make(map[string]federationtypes.GraphQLError)
+		for _, graphqlErr := range result.Errors {
+			byMessage[graphqlErr.Message] = graphqlErr
+		}
+
+		mapped := byMessage["missing"].Extensions
+		if mapped["code"] != "NOT_FOUND" || mapped["originalCode"] != "E_NOT_FOUND" {
+			t.Errorf("Expected mapped code with original preserved, got %v", mapped)
+		}
+
+		unmapped := byMessage["denied"].Extensions
+		if unmapped["code"] != "FORBIDDEN" {
+			t.Errorf("Expected unmapped code to pass through, got %v", unmapped)
+		}
+		if _, exists := unmapped["originalCode"]; exists {
+			t.Errorf("Unmapped code should not record originalCode, got %v", unmapped)
+		}
+
+		if _, exists := byMessage["plain"].Extensions["code"]; exists {
+			t.Errorf("Error without code should not gain one, got %v", byMessage["plain"].Extensions)
+		}
+	}
+
+	if responses[0].Errors[0].Extensions["code"] != "E_NOT_FOUND" {
+		t.Error("Expected original subgraph error to be left untouched")
+	}
+}
+
+func TestMergeResponses_UnknownFieldPolicy(t *testing.T) {
+	selection := &federationtypes.SelectionNode{Children: map[string]*federationtypes.SelectionNode{
+		"user": {Children: map[string]*federationtypes.SelectionNode{
+			"id":      {},
+			"profile": {},
+		}},
+	}}
+	newResponses := func() []*federationtypes.ServiceResponse {
+		return []*federationtypes.ServiceResponse{
+			{Service: "users", Data: map[string]interface{}{
+				"user": map[string]interface{}{
+					"__typename": "User",
+					"id":         "1",
+					"ssn":        "secret",
+					"profile":    map[string]interface{}{"bio": "hi"},
+				},
+				"internal": true,
+			}},
+		}
+	}
+
+	for _, strategy := range []federationtypes.MergeStrategy{federationtypes.MergeStrategyDeep, federationtypes.MergeStrategyShallow} {
+		for _, policy := range []UnknownFieldPolicy{UnknownFieldPolicyKeep, UnknownFieldPolicyDrop} {
+			config := DefaultMergerConfig()
+			config.UnknownFieldPolicy = policy
+			merger := NewResponseMerger(config, &MockLogger{})
+
+			responses := newResponses()
+			plan := &federationtypes.ExecutionPlan{MergeStrategy: strategy, Selection: selection}
+			result, err := merger.MergeResponses(context.Background(), responses, plan)
+			if err != nil {
+				t.Fatalf("MergeResponses(%s, %s) error = %v", strategy, policy, err)
+			}
+
+			data := result.Data.(map[string]interface{})
+			user := data["user"].(map[string]interface{})
+			dropped := policy == UnknownFieldPolicyDrop
+			if _, exists := user["ssn"]; exists == dropped {
+				t.Errorf("%s/%s: unexpected user %v", strategy, policy, user)
+			}
+			if _, exists := data["internal"]; exists == dropped {
+				t.Errorf("%s/%s: unexpected root fields %v", strategy, policy, data)
+			}
+			if user["id"] != "1" || user["__typename"] != "User" {
+				t.Errorf("%s/%s: expected selected fields and __typename to be kept, got %v", strategy, policy, user)
+			}
+			if profile, _ := user["profile"].(map[string]interface{}); profile["bio"] != "hi" {
+				t.Errorf("%s/%s: expected leaf selection to keep its value, got %v", strategy, policy, user["profile"])
+			}
+
+			if _, exists := responses[0].Data.(map[string]interface{})["user"].(map[string]interface{})["ssn"]; !exists {
+				t.Errorf("%s/%s: expected subgraph response to be left untouched", strategy, policy)
+			}
+		}
+	}
+}
+
+func TestMergeResponses_StrictFieldTypes(t *testing.T) {
+	ctx := context.Background()
+	responses := []*federationtypes.ServiceResponse{
+		{Service: "users", Data: map[string]interface{}{"owner": "alice"}},
+		{Service: "accounts", Data: map[string]interface{}{"owner": map[string]interface{}{"id": "1"}}},
+	}
+
+	for _, strategy := range []federationtypes.MergeStrategy{federationtypes.MergeStrategyShallow, federationtypes.MergeStrategyDeep} {
+		t.Run(string(strategy), func(t *testing.T) {
+			plan := &federationtypes.ExecutionPlan{MergeStrategy: strategy}
+
+			// 默认静默保留第一个值
+			result, err := NewResponseMerger(DefaultMergerConfig(), &MockLogger{}).MergeResponses(ctx, responses, plan)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if owner := result.Data.(map[string]interface{})["owner"]; owner != "alice" {
+				t.Errorf("Expected first value to be kept, got %v", owner)
+			}
+
+			config := DefaultMergerConfig()
+			config.StrictFieldTypes = true
+			_, err = NewResponseMerger(config, &MockLogger{}).MergeResponses(ctx, responses, plan)
+			var fedErr *errors.FederationError
+			if !stderrors.As(err, &fedErr) {
+				t.Fatalf("Expected federation error, got %v", err)
+			}
+			if fedErr.Extensions["reason"] != "FIELD_TYPE_CONFLICT" || fedErr.Extensions["field"] != "owner" {
+				t.Errorf("Unexpected extensions: %v", fedErr.Extensions)
+			}
+			if types, _ := fedErr.Extensions["types"].([]string); len(types) != 2 || types[0] != "string" || types[1] != "object" {
+				t.Errorf("Expected [string object] types, got %v", fedErr.Extensions["types"])
+			}
+		})
+	}
+}
+
+func TestMergeResponses_DeadlineReturnsPartialData(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	responses := []*federationtypes.ServiceResponse{
+		{Service: "users", Data: map[string]interface{}{"users": []interface{}{"alice"}}},
+		{Service: "orders", Data: map[string]interface{}{"orders": []interface{}{"o-1"}}},
+		{Service: "reviews", Errors: []federationtypes.GraphQLError{{Message: "reviews unavailable"}}},
+	}
+
+	for _, strategy := range []federationtypes.MergeStrategy{federationtypes.MergeStrategyShallow, federationtypes.MergeStrategyDeep} {
+		t.Run(string(strategy), func(t *testing.T) {
+			plan := &federationtypes.ExecutionPlan{MergeStrategy: strategy}
+			result, err := NewResponseMerger(DefaultMergerConfig(), &MockLogger{}).MergeResponses(ctx, responses, plan)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			data := result.Data.(map[string]interface{})
+			if _, ok := data["users"]; !ok {
+				t.Errorf("Expected first response to be merged, got %v", data)
+			}
+			if _, ok := data["orders"]; ok {
+				t.Errorf("Expected orders to be skipped after the deadline, got %v", data)
+			}
+
+			var timeoutNote, subgraphError bool
+			for _, graphqlErr := range result.Errors {
+				if graphqlErr.Extensions["reason"] == "MERGE_TIMEOUT" {
+					timeoutNote = true
+					if skipped, _ := graphqlErr.Extensions["skippedServices"].([]string); len(skipped) != 1 || skipped[0] != "orders" {
+						t.Errorf("Expected orders to be reported as skipped, got %v", graphqlErr.Extensions["skippedServices"])
+					}
+				}
+				if graphqlErr.Message == "reviews unavailable" {
+					subgraphError = true
+				}
+			}
+			if !timeoutNote || !subgraphError {
+				t.Errorf("Expected timeout note and subgraph errors to be kept, got %+v", result.Errors)
+			}
+		})
+	}
+}
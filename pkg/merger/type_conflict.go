@@ -0,0 +1,56 @@
+package merger
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+)
+
+// fieldTypeConflictReason 严格模式下同一字段值类型不兼容时合并错误的 reason
+const fieldTypeConflictReason = "FIELD_TYPE_CONFLICT"
+
+// checkFieldTypes 在 StrictFieldTypes 下检查同一字段的两个值是否为相同的 JSON 类型，
+// 不一致时返回标明字段和双方类型的合并错误，而不是静默保留其中一个
+func (m *ResponseMerger) checkFieldTypes(fieldName string, existing, value interface{}) error {
+	if !m.config.StrictFieldTypes {
+		return nil
+	}
+
+	existingKind, valueKind := jsonKind(existing), jsonKind(value)
+	if existingKind == valueKind {
+		return nil
+	}
+	return errors.NewMergeError(fmt.Sprintf("field %s has conflicting types across services: %s and %s", fieldName, existingKind, valueKind),
+		errors.WithExtension("reason", fieldTypeConflictReason),
+		errors.WithExtension("field", fieldName),
+		errors.WithExtension("types", []string{existingKind, valueKind}),
+	)
+}
+
+// isFieldTypeConflict 判断错误是否为严格模式下的字段类型冲突
+func isFieldTypeConflict(err error) bool {
+	var fedErr *errors.FederationError
+	return stderrors.As(err, &fedErr) && fedErr.Extensions["reason"] == fieldTypeConflictReason
+}
+
+// jsonKind 返回值的 JSON 类型名称，各种数值类型统一为 number
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int32, int64, float32, float64, json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -3,26 +3,69 @@ package parser
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astnormalization"
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/asttransform"
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/astvalidation"
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/operationreport"
 
 	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
 
 // Parser 实现 GraphQL 查询解析器
 type Parser struct {
 	logger          federationtypes.Logger
+	config          *ParserConfig
 	directiveParser federationtypes.FederationDirectiveParser
+
+	// 最近一次验证使用的模式文档，模式未变化时复用
+	schemaCache atomic.Pointer[parsedSchema]
+}
+
+// parsedSchema 解析后的模式文档及其 SDL
+type parsedSchema struct {
+	sdl      string
+	document *ast.Document
+}
+
+// ParserConfig 解析器配置
+type ParserConfig struct {
+	// Lenient 宽松解析：可恢复的问题只记录警告，语法错误仍然失败。可恢复的问题包括：
+	//   - 验证时模式中未定义的指令（指令允许列表仍然生效）
+	//   - 验证时定义但未使用的片段
+	Lenient bool
+
+	// IgnoreUndefinedDirectives 验证时忽略模式中未定义的指令，用于指令由允许列表单独校验的场景
+	IgnoreUndefinedDirectives bool
+
+	// MaxSelectionBreadth 单个选择集的字段数上限（内联片段和片段展开的字段计入所在选择集），0 表示不限制
+	MaxSelectionBreadth int
+}
+
+// DefaultParserConfig 返回默认配置
+func DefaultParserConfig() *ParserConfig {
+	return &ParserConfig{}
 }
 
 // NewParser 创建新的解析器
 func NewParser(logger federationtypes.Logger) federationtypes.GraphQLParser {
+	return NewParserWithConfig(nil, logger)
+}
+
+// NewParserWithConfig 使用配置创建解析器
+func NewParserWithConfig(config *ParserConfig, logger federationtypes.Logger) federationtypes.GraphQLParser {
+	if config == nil {
+		config = DefaultParserConfig()
+	}
+
 	return &Parser{
 		logger: logger,
+		config: config,
 		// 不能在这里创建 directiveParser，因为会造成循环依赖
 		// directiveParser: federation.NewDirectiveParser(logger),
 	}
@@ -30,6 +73,11 @@ func NewParser(logger federationtypes.Logger) federationtypes.GraphQLParser {
 
 // ParseQuery 解析 GraphQL 查询
 func (p *Parser) ParseQuery(query string) (*federationtypes.ParsedQuery, error) {
+	return p.ParseOperation(query, "")
+}
+
+// ParseOperation 解析 GraphQL 查询，operationName 用于在宽松模式下从多操作文档中选择操作
+func (p *Parser) ParseOperation(query string, operationName string) (*federationtypes.ParsedQuery, error) {
 	if strings.TrimSpace(query) == "" {
 		return nil, errors.NewQueryParsingError("query cannot be empty")
 	}
@@ -46,7 +94,7 @@ func (p *Parser) ParseQuery(query string) (*federationtypes.ParsedQuery, error)
 	}
 
 	// 分析查询
-	parsedQuery, err := p.analyzeDocument(&document, report)
+	parsedQuery, err := p.analyzeDocument(&document, operationName, report)
 	if err != nil {
 		return nil, err
 	}
@@ -78,16 +126,22 @@ func (p *Parser) ValidateQuery(query *federationtypes.ParsedQuery, schema *feder
 		return errors.NewQueryValidationError("invalid AST document")
 	}
 
-	// 解析模式
-	schemaDocument, err := p.parseSchema(schema.SDL)
+	// 解析模式，模式未变化时复用上次的解析结果
+	schemaDocument, err := p.cachedSchema(schema.SDL)
 	if err != nil {
 		return errors.NewQueryValidationError("invalid schema: " + err.Error())
 	}
 
-	// 验证查询
+	// 验证查询：验证器要求片段展开已内联，在副本上规范化后验证，不影响后续规划
 	report := &operationreport.Report{}
-	validator := astvalidation.DefaultOperationValidator()
-	validator.Validate(document, schemaDocument, report)
+	if operation := p.normalizeForValidation(document, query.Operation, schemaDocument, report); operation != nil {
+		validator := astvalidation.DefaultOperationValidator()
+		validator.Validate(operation, schemaDocument, report)
+	}
+
+	if p.config.Lenient || p.config.IgnoreUndefinedDirectives {
+		report = p.dropRecoverableErrors(report)
+	}
 
 	if report.HasErrors() {
 		p.logger.Error("Query validation failed", "errors", "validation errors found")
@@ -147,7 +201,7 @@ func (p *Parser) ExtractFields(query *federationtypes.ParsedQuery) ([]federation
 }
 
 // analyzeDocument 分析文档
-func (p *Parser) analyzeDocument(document *ast.Document, report *operationreport.Report) (*federationtypes.ParsedQuery, error) {
+func (p *Parser) analyzeDocument(document *ast.Document, operationName string, report *operationreport.Report) (*federationtypes.ParsedQuery, error) {
 	parsed := &federationtypes.ParsedQuery{
 		AST:       document,
 		Variables: make(map[string]interface{}),
@@ -158,13 +212,28 @@ func (p *Parser) analyzeDocument(document *ast.Document, report *operationreport
 	var targetOperation ast.OperationDefinition
 	var operationIndex int
 
-	if len(document.OperationDefinitions) == 1 {
+	switch {
+	case len(document.OperationDefinitions) == 0:
+		return nil, errors.NewQueryParsingError("no operation found")
+	case operationName != "":
+		// 提供了 operationName 时按名称选择操作，找不到时报错
+		operationIndex = -1
+		for i := range document.OperationDefinitions {
+			if document.OperationDefinitionNameString(i) == operationName {
+				operationIndex = i
+				break
+			}
+		}
+		if operationIndex == -1 {
+			return nil, errors.NewQueryParsingError(fmt.Sprintf("operation %s not found", operationName))
+		}
+		targetOperation = document.OperationDefinitions[operationIndex]
+	case len(document.OperationDefinitions) == 1:
 		// 单个操作，直接使用
 		operationIndex = 0
 		targetOperation = document.OperationDefinitions[operationIndex]
-	} else {
+	default:
 		// 多个操作，需要根据 operationName 选择
-		// 这里需要从上下文获取 operationName
 		return nil, errors.NewQueryParsingError("multiple operations found, operationName required")
 	}
 
@@ -174,16 +243,60 @@ func (p *Parser) analyzeDocument(document *ast.Document, report *operationreport
 		parsed.Operation = operationName
 	}
 
-	// 计算查询深度和复杂度
+	// 计算查询深度、复杂度和广度
 	parsed.Depth = p.calculateDepth(document, targetOperation.SelectionSet, 0)
 	parsed.Complexity = p.calculateComplexity(document, targetOperation.SelectionSet)
+	parsed.Breadth = p.calculateBreadth(document, targetOperation.SelectionSet)
+
+	if p.config.MaxSelectionBreadth > 0 && parsed.Breadth > p.config.MaxSelectionBreadth {
+		return nil, errors.NewQueryComplexityError(
+			fmt.Sprintf("query selects %d fields in a single selection set, exceeding maximum %d", parsed.Breadth, p.config.MaxSelectionBreadth),
+			errors.WithExtension("breadth", parsed.Breadth),
+			errors.WithExtension("maxSelectionBreadth", p.config.MaxSelectionBreadth),
+		)
+	}
 
-	// 提取片段
+	// 提取片段和变量定义
 	p.extractFragments(document, parsed)
+	parsed.VariableDefinitions = p.extractVariableDefinitions(document, targetOperation)
 
 	return parsed, nil
 }
 
+// dropRecoverableErrors 移除宽松模式下可恢复的验证错误并记录警告
+func (p *Parser) dropRecoverableErrors(report *operationreport.Report) *operationreport.Report {
+	filtered := &operationreport.Report{InternalErrors: report.InternalErrors}
+	for _, externalErr := range report.ExternalErrors {
+		recoverable := isUndefinedDirectiveError(externalErr.Message)
+		if p.config.Lenient {
+			recoverable = isRecoverableValidationError(externalErr.Message)
+		}
+		if recoverable {
+			p.logger.Warn("Ignoring recoverable query validation error", "error", externalErr.Message)
+			continue
+		}
+		filtered.ExternalErrors = append(filtered.ExternalErrors, externalErr)
+	}
+	return filtered
+}
+
+// isRecoverableValidationError 判断验证错误是否可恢复：未定义的指令和未使用的片段
+func isRecoverableValidationError(message string) bool {
+	switch {
+	case isUndefinedDirectiveError(message):
+		return true
+	case strings.HasPrefix(message, "fragment: ") && strings.HasSuffix(message, " defined but not used"):
+		return true
+	default:
+		return false
+	}
+}
+
+// isUndefinedDirectiveError 判断是否为模式中未定义指令的验证错误
+func isUndefinedDirectiveError(message string) bool {
+	return strings.HasPrefix(message, "directive: ") && strings.HasSuffix(message, " undefined")
+}
+
 // extractFieldsFromSelectionSet 从选择集提取字段
 func (p *Parser) extractFieldsFromSelectionSet(document *ast.Document, selectionSet int, path []string) []federationtypes.FieldPath {
 	var fieldPaths []federationtypes.FieldPath
@@ -343,6 +456,74 @@ func (p *Parser) calculateComplexityWithVisited(document *ast.Document, selectio
 	return complexity
 }
 
+// calculateBreadth 计算查询广度，即单个选择集中字段数的最大值
+func (p *Parser) calculateBreadth(document *ast.Document, selectionSet int) int {
+	visited := make(map[int]bool)
+	fragments := make(map[string][2]int)
+	return p.calculateBreadthWithVisited(document, selectionSet, visited, fragments)
+}
+
+// calculateBreadthWithVisited 计算选择集及其子选择集的最大广度（带访问跟踪）
+func (p *Parser) calculateBreadthWithVisited(document *ast.Document, selectionSet int, visited map[int]bool, fragments map[string][2]int) int {
+	fields, nested := p.countSelectionFields(document, selectionSet, visited, fragments)
+	return max(fields, nested)
+}
+
+// countSelectionFields 统计选择集中的字段数，内联片段和片段展开的字段计入当前选择集，
+// 同时返回子字段选择集中的最大广度。片段的统计结果按名称缓存，避免重复展开
+func (p *Parser) countSelectionFields(document *ast.Document, selectionSet int, visited map[int]bool, fragments map[string][2]int) (int, int) {
+	if selectionSet == -1 {
+		return 0, 0
+	}
+
+	// 检查是否已经访问过这个选择集，防止循环引用
+	if visited[selectionSet] {
+		return 0, 0
+	}
+
+	// 标记为已访问
+	visited[selectionSet] = true
+	defer func() {
+		delete(visited, selectionSet)
+	}()
+
+	fields, nested := 0, 0
+	selections := document.SelectionSets[selectionSet].SelectionRefs
+
+	for _, selectionRef := range selections {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			fields++
+			field := document.Fields[selection.Ref]
+			if field.SelectionSet != -1 {
+				nested = max(nested, p.calculateBreadthWithVisited(document, field.SelectionSet, visited, fragments))
+			}
+
+		case ast.SelectionKindInlineFragment:
+			inlineFragment := document.InlineFragments[selection.Ref]
+			inlineFields, inlineNested := p.countSelectionFields(document, inlineFragment.SelectionSet, visited, fragments)
+			fields += inlineFields
+			nested = max(nested, inlineNested)
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			counts, ok := fragments[name]
+			if !ok {
+				if ref, exists := document.FragmentDefinitionRef(document.FragmentSpreadNameBytes(selection.Ref)); exists {
+					counts[0], counts[1] = p.countSelectionFields(document, document.FragmentDefinitions[ref].SelectionSet, visited, fragments)
+				}
+				fragments[name] = counts
+			}
+			fields += counts[0]
+			nested = max(nested, counts[1])
+		}
+	}
+
+	return fields, nested
+}
+
 // extractFragments 提取片段
 func (p *Parser) extractFragments(document *ast.Document, parsed *federationtypes.ParsedQuery) {
 	for i, _ := range document.FragmentDefinitions {
@@ -354,6 +535,96 @@ func (p *Parser) extractFragments(document *ast.Document, parsed *federationtype
 	}
 }
 
+// extractVariableDefinitions 提取操作声明的变量名、类型和默认值
+func (p *Parser) extractVariableDefinitions(document *ast.Document, operation ast.OperationDefinition) []federationtypes.VariableDefinition {
+	if !operation.HasVariableDefinitions {
+		return nil
+	}
+
+	definitions := make([]federationtypes.VariableDefinition, 0, len(operation.VariableDefinitions.Refs))
+	for _, ref := range operation.VariableDefinitions.Refs {
+		definition := federationtypes.VariableDefinition{
+			Name: document.VariableDefinitionNameString(ref),
+		}
+		if typeText, err := document.PrintTypeBytes(document.VariableDefinitions[ref].Type, nil); err == nil {
+			definition.Type = string(typeText)
+		}
+
+		if document.VariableDefinitionHasDefaultValue(ref) {
+			// 默认值必须为常量，无法转换时视为未声明默认值
+			raw, err := document.ValueToJSON(document.VariableDefinitionDefaultValue(ref))
+			var value interface{}
+			if err == nil {
+				err = jsonutil.Unmarshal(raw, &value)
+			}
+			if err != nil {
+				p.logger.Warn("Ignoring unsupported variable default value", "variable", definition.Name, "error", err)
+			} else {
+				definition.DefaultValue = value
+				definition.HasDefault = true
+			}
+		}
+
+		definitions = append(definitions, definition)
+	}
+
+	return definitions
+}
+
+// normalizeForValidation 复制查询文档并内联片段展开，规范化失败时返回 nil 并记录错误
+func (p *Parser) normalizeForValidation(document *ast.Document, operationName string, definition *ast.Document, report *operationreport.Report) *ast.Document {
+	// 内联后无法再检测未使用的片段，先在原文档上检查
+	used := make(map[string]bool, len(document.FragmentSpreads))
+	for i := range document.FragmentSpreads {
+		used[document.FragmentSpreadNameString(i)] = true
+	}
+	for i := range document.FragmentDefinitions {
+		if name := document.FragmentDefinitionNameBytes(i); !used[string(name)] {
+			report.AddExternalError(operationreport.ErrFragmentDefinedButNotUsed(name))
+		}
+	}
+
+	// 重新解析原始文本，错误位置与客户端查询一致
+	operation, parseReport := astparser.ParseGraphqlDocumentBytes(document.Input.RawBytes)
+	if parseReport.HasErrors() {
+		report.ExternalErrors = append(report.ExternalErrors, parseReport.ExternalErrors...)
+		report.InternalErrors = append(report.InternalErrors, parseReport.InternalErrors...)
+		return nil
+	}
+
+	normalizeReport := &operationreport.Report{}
+	normalizer := astnormalization.NewWithOpts(
+		astnormalization.WithInlineFragmentSpreads(),
+		astnormalization.WithRemoveFragmentDefinitions(),
+	)
+	if operationName != "" {
+		normalizer.NormalizeNamedOperation(&operation, definition, []byte(operationName), normalizeReport)
+	} else {
+		normalizer.NormalizeOperation(&operation, definition, normalizeReport)
+	}
+	if normalizeReport.HasErrors() {
+		report.ExternalErrors = append(report.ExternalErrors, normalizeReport.ExternalErrors...)
+		report.InternalErrors = append(report.InternalErrors, normalizeReport.InternalErrors...)
+		return nil
+	}
+
+	return &operation
+}
+
+// cachedSchema 返回解析后的模式文档，SDL 与上次相同时复用
+func (p *Parser) cachedSchema(schemaSDL string) (*ast.Document, error) {
+	if cached := p.schemaCache.Load(); cached != nil && cached.sdl == schemaSDL {
+		return cached.document, nil
+	}
+
+	document, err := p.parseSchema(schemaSDL)
+	if err != nil {
+		return nil, err
+	}
+	p.schemaCache.Store(&parsedSchema{sdl: schemaSDL, document: document})
+	return document, nil
+}
+
 // parseSchema 解析模式
 func (p *Parser) parseSchema(schemaSDL string) (*ast.Document, error) {
 	document, parseReport := astparser.ParseGraphqlDocumentString(schemaSDL)
@@ -362,6 +633,11 @@ func (p *Parser) parseSchema(schemaSDL string) (*ast.Document, error) {
 		return nil, fmt.Errorf("schema parse error: parse errors found")
 	}
 
+	// 合并内置标量、指令和根操作类型，否则验证时无法识别 Query 等根类型
+	if err := asttransform.MergeDefinitionWithBaseSchema(&document); err != nil {
+		return nil, fmt.Errorf("schema merge error: %w", err)
+	}
+
 	return &document, nil
 }
 
@@ -390,9 +666,9 @@ func (p *Parser) resolveTypeFromRef(document *ast.Document, typeRef int) string
 func (p *Parser) getTypeString(document *ast.Document, typeNode ast.Type) string {
 	switch typeNode.TypeKind {
 	case ast.TypeKindNamed:
-		// 命名类型
-		if typeNode.OfType != -1 {
-			return document.ResolveTypeNameString(typeNode.OfType)
+		// 命名类型，名称直接记录在类型节点上
+		if name := document.Input.ByteSliceString(typeNode.Name); name != "" {
+			return name
 		}
 		return "String"
 
@@ -463,11 +739,16 @@ func (p *Parser) convertValidationErrors(report *operationreport.Report) error {
 
 	// 收集验证错误
 	var errorMessages []string
+	var options []errors.ErrorOption
 
-	// 处理外部错误
+	// 处理外部错误，第一个错误的位置作为错误位置
 	for _, externalErr := range report.ExternalErrors {
-		errorMsg := fmt.Sprintf("%v", externalErr)
-		errorMessages = append(errorMessages, errorMsg)
+		errorMessages = append(errorMessages, externalErr.Message)
+		if len(options) == 0 {
+			for _, location := range externalErr.Locations {
+				options = append(options, errors.WithLocation(int(location.Line), int(location.Column)))
+			}
+		}
 	}
 
 	// 处理内部错误
@@ -490,7 +771,10 @@ func (p *Parser) convertValidationErrors(report *operationreport.Report) error {
 		"mainError", mainMessage,
 	)
 
-	return fmt.Errorf("validation error: %s", mainMessage)
+	if len(errorMessages) > 1 {
+		options = append(options, errors.WithExtension("validationErrors", errorMessages))
+	}
+	return errors.NewQueryValidationError("validation error: "+mainMessage, options...)
 }
 
 // categorizeValidationError 对验证错误进行分类
@@ -570,13 +854,19 @@ func (p *Parser) ExtractFederationEntities(schema string) ([]federationtypes.Fed
 
 	var entities []federationtypes.FederatedEntity
 
+	// 解析 Federation v2 的 @link 声明
+	link := ExtractLinkDirective(&document)
+	if link != nil {
+		p.logger.Debug("Detected @link directive", "url", link.URL, "version", link.Version)
+	}
+
 	// 遍历类型定义
 	for i, _ := range document.ObjectTypeDefinitions {
 		_ = document.ObjectTypeDefinitions[i] // 使用 typeDef 变量
 		typeName := document.ObjectTypeDefinitionNameString(i)
 
 		// 检查是否有 Federation 指令
-		entity, err := p.extractEntityFromTypeDefinition(&document, i, typeName)
+		entity, err := p.extractEntityFromTypeDefinition(&document, i, typeName, link)
 		if err != nil {
 			p.logger.Warn("Failed to extract entity", "type", typeName, "error", err)
 			continue
@@ -587,16 +877,31 @@ func (p *Parser) ExtractFederationEntities(schema string) ([]federationtypes.Fed
 		}
 	}
 
+	// 遍历接口定义，接口也可以通过 @key 成为实体
+	for i := range document.InterfaceTypeDefinitions {
+		typeName := document.InterfaceTypeDefinitionNameString(i)
+
+		entity, err := p.extractEntityFromInterfaceDefinition(&document, i, typeName, link)
+		if err != nil {
+			p.logger.Warn("Failed to extract interface entity", "type", typeName, "error", err)
+			continue
+		}
+
+		if entity != nil {
+			entities = append(entities, *entity)
+		}
+	}
+
 	p.logger.Debug("Extracted Federation entities", "count", len(entities))
 	return entities, nil
 }
 
 // extractEntityFromTypeDefinition 从类型定义中提取实体
-func (p *Parser) extractEntityFromTypeDefinition(document *ast.Document, typeIndex int, typeName string) (*federationtypes.FederatedEntity, error) {
+func (p *Parser) extractEntityFromTypeDefinition(document *ast.Document, typeIndex int, typeName string, link *federationtypes.LinkDirective) (*federationtypes.FederatedEntity, error) {
 	typeDef := document.ObjectTypeDefinitions[typeIndex]
 
 	// 提取类型指令
-	typeDirectives, err := p.extractDirectivesFromType(document, typeIndex)
+	typeDirectives, err := p.extractDirectivesFromType(document, typeIndex, link)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract type directives: %w", err)
 	}
@@ -609,15 +914,56 @@ func (p *Parser) extractEntityFromTypeDefinition(document *ast.Document, typeInd
 
 	entity := &federationtypes.FederatedEntity{
 		TypeName:   typeName,
+		Kind:       federationtypes.EntityKindObject,
 		Directives: *typeDirectives,
 		Fields:     []federationtypes.FederatedField{},
 	}
 
+	// 记录实现的接口
+	for _, interfaceRef := range typeDef.ImplementsInterfaces.Refs {
+		entity.Interfaces = append(entity.Interfaces, document.ResolveTypeNameString(interfaceRef))
+	}
+
 	// 提取字段信息
-	for _, fieldRef := range typeDef.FieldsDefinition.Refs {
-		field, err := p.extractFieldFromDefinition(document, fieldRef)
+	p.appendEntityFields(document, entity, typeDef.FieldsDefinition.Refs, link)
+
+	return entity, nil
+}
+
+// extractEntityFromInterfaceDefinition 从接口定义中提取实体
+func (p *Parser) extractEntityFromInterfaceDefinition(document *ast.Document, typeIndex int, typeName string, link *federationtypes.LinkDirective) (*federationtypes.FederatedEntity, error) {
+	typeDef := document.InterfaceTypeDefinitions[typeIndex]
+
+	// 提取接口指令
+	typeDirectives, err := p.extractDirectivesFromRefs(document, typeDef.Directives.Refs, link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract interface directives: %w", err)
+	}
+
+	// 只有带 @key 的接口才是实体接口
+	if len(typeDirectives.Keys) == 0 {
+		return nil, nil
+	}
+
+	entity := &federationtypes.FederatedEntity{
+		TypeName:   typeName,
+		Kind:       federationtypes.EntityKindInterface,
+		Directives: *typeDirectives,
+		Fields:     []federationtypes.FederatedField{},
+	}
+
+	// 提取字段信息
+	p.appendEntityFields(document, entity, typeDef.FieldsDefinition.Refs, link)
+
+	return entity, nil
+}
+
+// appendEntityFields 提取实体字段
+func (p *Parser) appendEntityFields(document *ast.Document, entity *federationtypes.FederatedEntity, fieldRefs []int, link *federationtypes.LinkDirective) {
+	for _, fieldRef := range fieldRefs {
+		field, err := p.extractFieldFromDefinition(document, fieldRef, link)
 		if err != nil {
-			p.logger.Warn("Failed to extract field", "type", typeName, "error", err)
+			p.logger.Warn("Failed to extract field", "type", entity.TypeName, "error", err)
 			continue
 		}
 
@@ -625,19 +971,21 @@ func (p *Parser) extractEntityFromTypeDefinition(document *ast.Document, typeInd
 			entity.Fields = append(entity.Fields, *field)
 		}
 	}
-
-	return entity, nil
 }
 
 // extractDirectivesFromType 从类型定义中提取指令
-func (p *Parser) extractDirectivesFromType(document *ast.Document, typeIndex int) (*federationtypes.EntityDirectives, error) {
-	typeDef := document.ObjectTypeDefinitions[typeIndex]
+func (p *Parser) extractDirectivesFromType(document *ast.Document, typeIndex int, link *federationtypes.LinkDirective) (*federationtypes.EntityDirectives, error) {
+	return p.extractDirectivesFromRefs(document, document.ObjectTypeDefinitions[typeIndex].Directives.Refs, link)
+}
+
+// extractDirectivesFromRefs 从对象或接口的指令列表中提取联邦指令
+func (p *Parser) extractDirectivesFromRefs(document *ast.Document, directiveRefs []int, link *federationtypes.LinkDirective) (*federationtypes.EntityDirectives, error) {
 	directives := &federationtypes.EntityDirectives{}
 
 	// 遍历类型上的指令
-	for _, directiveRef := range typeDef.Directives.Refs {
+	for _, directiveRef := range directiveRefs {
 		_ = document.Directives[directiveRef] // 使用 directive 变量
-		directiveName := document.DirectiveNameString(directiveRef)
+		directiveName := link.ResolveDirectiveName(document.DirectiveNameString(directiveRef))
 
 		switch directiveName {
 		case "key":
@@ -676,7 +1024,7 @@ func (p *Parser) extractDirectivesFromType(document *ast.Document, typeIndex int
 }
 
 // extractFieldFromDefinition 从字段定义中提取字段
-func (p *Parser) extractFieldFromDefinition(document *ast.Document, fieldRef int) (*federationtypes.FederatedField, error) {
+func (p *Parser) extractFieldFromDefinition(document *ast.Document, fieldRef int, link *federationtypes.LinkDirective) (*federationtypes.FederatedField, error) {
 	fieldDef := document.FieldDefinitions[fieldRef]
 	fieldName := document.FieldDefinitionNameString(fieldRef)
 	fieldType := p.extractFieldType(document, fieldDef.Type)
@@ -689,7 +1037,7 @@ func (p *Parser) extractFieldFromDefinition(document *ast.Document, fieldRef int
 	}
 
 	// 提取字段指令
-	fieldDirectives, err := p.extractDirectivesFromField(document, fieldRef)
+	fieldDirectives, err := p.extractDirectivesFromField(document, fieldRef, link)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract field directives: %w", err)
 	}
@@ -712,13 +1060,13 @@ func (p *Parser) extractFieldFromDefinition(document *ast.Document, fieldRef int
 }
 
 // extractDirectivesFromField 从字段定义中提取指令
-func (p *Parser) extractDirectivesFromField(document *ast.Document, fieldRef int) (*federationtypes.EntityDirectives, error) {
+func (p *Parser) extractDirectivesFromField(document *ast.Document, fieldRef int, link *federationtypes.LinkDirective) (*federationtypes.EntityDirectives, error) {
 	fieldDef := document.FieldDefinitions[fieldRef]
 	directives := &federationtypes.EntityDirectives{}
 
 	// 遍历字段上的指令
 	for _, directiveRef := range fieldDef.Directives.Refs {
-		directiveName := document.DirectiveNameString(directiveRef)
+		directiveName := link.ResolveDirectiveName(document.DirectiveNameString(directiveRef))
 
 		switch directiveName {
 		case "external":
@@ -747,6 +1095,80 @@ func (p *Parser) extractDirectivesFromField(document *ast.Document, fieldRef int
 	return directives, nil
 }
 
+// ExtractLinkDirective 提取模式中声明的 Federation @link 指令，未声明时返回 nil
+func ExtractLinkDirective(document *ast.Document) *federationtypes.LinkDirective {
+	var directiveRefs []int
+	for i := range document.SchemaDefinitions {
+		directiveRefs = append(directiveRefs, document.SchemaDefinitions[i].Directives.Refs...)
+	}
+	for i := range document.SchemaExtensions {
+		directiveRefs = append(directiveRefs, document.SchemaExtensions[i].Directives.Refs...)
+	}
+
+	for _, directiveRef := range directiveRefs {
+		if document.DirectiveNameString(directiveRef) != "link" {
+			continue
+		}
+
+		urlValue, ok := document.DirectiveArgumentValueByName(directiveRef, []byte("url"))
+		if !ok || urlValue.Kind != ast.ValueKindString {
+			continue
+		}
+
+		url := document.StringValueContentString(urlValue.Ref)
+		if !strings.Contains(url, "/federation/") {
+			// 只关心联邦规范的链接
+			continue
+		}
+
+		link := &federationtypes.LinkDirective{
+			URL:     url,
+			Version: strings.TrimPrefix(url[strings.LastIndex(url, "/")+1:], "v"),
+			Aliases: make(map[string]string),
+		}
+
+		if importValue, ok := document.DirectiveArgumentValueByName(directiveRef, []byte("import")); ok && importValue.Kind == ast.ValueKindList {
+			for _, itemRef := range document.ListValues[importValue.Ref].Refs {
+				extractLinkImport(document, document.Values[itemRef], link)
+			}
+		}
+
+		return link
+	}
+
+	return nil
+}
+
+// extractLinkImport 解析 @link 的单个导入项，支持 "@key" 与 { name: "@key", as: "@primaryKey" }
+func extractLinkImport(document *ast.Document, value ast.Value, link *federationtypes.LinkDirective) {
+	switch value.Kind {
+	case ast.ValueKindString:
+		link.Imports = append(link.Imports, strings.TrimPrefix(document.StringValueContentString(value.Ref), "@"))
+
+	case ast.ValueKindObject:
+		var name, alias string
+		for _, fieldRef := range document.ObjectValues[value.Ref].Refs {
+			fieldValue := document.ObjectFieldValue(fieldRef)
+			if fieldValue.Kind != ast.ValueKindString {
+				continue
+			}
+			switch document.ObjectFieldNameString(fieldRef) {
+			case "name":
+				name = strings.TrimPrefix(document.StringValueContentString(fieldValue.Ref), "@")
+			case "as":
+				alias = strings.TrimPrefix(document.StringValueContentString(fieldValue.Ref), "@")
+			}
+		}
+		if name == "" {
+			return
+		}
+		link.Imports = append(link.Imports, name)
+		if alias != "" && alias != name {
+			link.Aliases[alias] = name
+		}
+	}
+}
+
 // extractKeyDirective 提取 @key 指令
 func (p *Parser) extractKeyDirective(document *ast.Document, directiveRef int) (*federationtypes.KeyDirective, error) {
 	directive := document.Directives[directiveRef]
@@ -762,15 +1184,20 @@ func (p *Parser) extractKeyDirective(document *ast.Document, directiveRef int) (
 		switch argName {
 		case "fields":
 			// 提取 fields 参数值
-			fieldsValue, err := p.extractStringValue(document, argument.Value.Ref)
+			fieldsValue, err := p.extractStringValue(document, argument.Value)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract fields value: %w", err)
 			}
+			selection, err := federationtypes.ParseFieldSet(fieldsValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid @key fields: %w", err)
+			}
 			keyDirective.Fields = fieldsValue
+			keyDirective.Selection = selection
 
 		case "resolvable":
 			// 提取 resolvable 参数值
-			resolvableValue, err := p.extractBooleanValue(document, argument.Value.Ref)
+			resolvableValue, err := p.extractBooleanValue(document, argument.Value)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract resolvable value: %w", err)
 			}
@@ -792,7 +1219,7 @@ func (p *Parser) extractExternalDirective(document *ast.Document, directiveRef i
 		argName := document.ArgumentNameString(argRef)
 
 		if argName == "reason" {
-			reasonValue, err := p.extractStringValue(document, argument.Value.Ref)
+			reasonValue, err := p.extractStringValue(document, argument.Value)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract reason value: %w", err)
 			}
@@ -814,11 +1241,16 @@ func (p *Parser) extractRequiresDirective(document *ast.Document, directiveRef i
 		argName := document.ArgumentNameString(argRef)
 
 		if argName == "fields" {
-			fieldsValue, err := p.extractStringValue(document, argument.Value.Ref)
+			fieldsValue, err := p.extractStringValue(document, argument.Value)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract fields value: %w", err)
 			}
+			selection, err := federationtypes.ParseFieldSet(fieldsValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid @requires fields: %w", err)
+			}
 			requiresDirective.Fields = fieldsValue
+			requiresDirective.Selection = selection
 		}
 	}
 
@@ -836,11 +1268,16 @@ func (p *Parser) extractProvidesDirective(document *ast.Document, directiveRef i
 		argName := document.ArgumentNameString(argRef)
 
 		if argName == "fields" {
-			fieldsValue, err := p.extractStringValue(document, argument.Value.Ref)
+			fieldsValue, err := p.extractStringValue(document, argument.Value)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract fields value: %w", err)
 			}
+			selection, err := federationtypes.ParseFieldSet(fieldsValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid @provides fields: %w", err)
+			}
 			providesDirective.Fields = fieldsValue
+			providesDirective.Selection = selection
 		}
 	}
 
@@ -848,24 +1285,22 @@ func (p *Parser) extractProvidesDirective(document *ast.Document, directiveRef i
 }
 
 // extractStringValue 提取字符串值
-func (p *Parser) extractStringValue(document *ast.Document, valueRef int) (string, error) {
-	value := document.Values[valueRef]
+func (p *Parser) extractStringValue(document *ast.Document, value ast.Value) (string, error) {
 	if value.Kind != ast.ValueKindString {
 		return "", fmt.Errorf("expected string value, got %v", value.Kind)
 	}
 
-	return document.StringValueContentString(valueRef), nil
+	return document.StringValueContentString(value.Ref), nil
 }
 
 // extractBooleanValue 提取布尔值
-func (p *Parser) extractBooleanValue(document *ast.Document, valueRef int) (bool, error) {
-	value := document.Values[valueRef]
+func (p *Parser) extractBooleanValue(document *ast.Document, value ast.Value) (bool, error) {
 	if value.Kind != ast.ValueKindBoolean {
 		return false, fmt.Errorf("expected boolean value, got %v", value.Kind)
 	}
 
 	// 从 ast.BooleanValue 转换为 bool
-	boolValue := document.BooleanValue(valueRef)
+	boolValue := document.BooleanValue(value.Ref)
 	return bool(boolValue), nil
 }
 
@@ -877,3 +1312,70 @@ func (p *Parser) extractFieldType(document *ast.Document, typeRef int) string {
 
 	return p.resolveTypeFromRef(document, typeRef)
 }
+
+// ValidateDirectives 检查查询中使用的指令是否都在允许列表中，allowed 的键为不含 @ 的指令名。
+// 查询文档中的指令包括操作、字段、片段和变量定义上的指令，按出现顺序返回第一个未允许的指令
+func ValidateDirectives(query *federationtypes.ParsedQuery, allowed map[string]bool) error {
+	if query == nil {
+		return errors.NewQueryValidationError("query is nil")
+	}
+
+	document, ok := query.AST.(*ast.Document)
+	if !ok {
+		return errors.NewQueryValidationError("invalid AST document")
+	}
+
+	for ref := range document.Directives {
+		name := document.DirectiveNameString(ref)
+		if allowed[name] {
+			continue
+		}
+
+		at := document.Directives[ref].At
+		return errors.NewDirectiveNotAllowedError(
+			fmt.Sprintf("directive @%s is not allowed", name),
+			errors.WithLocation(int(at.LineStart), int(at.CharStart)),
+			errors.WithExtension("directive", name),
+		)
+	}
+
+	return nil
+}
+
+// DefaultRootOperationTypes 返回未通过 schema 定义重命名时的根操作类型名，键为 query、mutation、subscription
+func DefaultRootOperationTypes() map[string]string {
+	return map[string]string{
+		"query":        "Query",
+		"mutation":     "Mutation",
+		"subscription": "Subscription",
+	}
+}
+
+// RootOperationTypes 读取模式中 schema { query: MyQuery ... } 定义及扩展声明的根操作类型名，
+// 未声明的操作类型使用默认名称
+func RootOperationTypes(document *ast.Document) map[string]string {
+	rootTypes := DefaultRootOperationTypes()
+
+	var refs []int
+	for i := range document.SchemaDefinitions {
+		refs = append(refs, document.SchemaDefinitions[i].RootOperationTypeDefinitions.Refs...)
+	}
+	for i := range document.SchemaExtensions {
+		refs = append(refs, document.SchemaExtensions[i].RootOperationTypeDefinitions.Refs...)
+	}
+
+	for _, ref := range refs {
+		definition := document.RootOperationTypeDefinitions[ref]
+		typeName := document.Input.ByteSliceString(definition.NamedType.Name)
+		switch definition.OperationType {
+		case ast.OperationTypeQuery:
+			rootTypes["query"] = typeName
+		case ast.OperationTypeMutation:
+			rootTypes["mutation"] = typeName
+		case ast.OperationTypeSubscription:
+			rootTypes["subscription"] = typeName
+		}
+	}
+
+	return rootTypes
+}
@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
 	"envoy-wasm-graphql-federation/pkg/types"
 )
 
@@ -134,6 +139,191 @@ func TestValidateQuery_NilParameters(t *testing.T) {
 	}
 }
 
+func TestValidateDirectives(t *testing.T) {
+	parser := NewParser(&MockLogger{})
+	allowed := map[string]bool{"skip": true, "include": true}
+
+	parsedQuery, err := parser.ParseQuery("query ($hide: Boolean!) {\n  user {\n    id @skip(if: $hide)\n    ...Secret @include(if: true)\n  }\n}\nfragment Secret on User {\n  email @source(name: \"internal\")\n}")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	err = ValidateDirectives(parsedQuery, allowed)
+	fedErr, ok := err.(*errors.FederationError)
+	if !ok {
+		t.Fatalf("Expected FederationError, got %v", err)
+	}
+	if fedErr.Code != errors.ErrCodeDirectiveNotAllowed || fedErr.Extensions["directive"] != "source" {
+		t.Errorf("Unexpected error: %+v", fedErr)
+	}
+	if len(fedErr.Locations) != 1 || fedErr.Locations[0].Line != 8 || fedErr.Locations[0].Column != 9 {
+		t.Errorf("Expected location 8:9, got %+v", fedErr.Locations)
+	}
+
+	allowed["source"] = true
+	if err := ValidateDirectives(parsedQuery, allowed); err != nil {
+		t.Errorf("Expected allowed directives to pass, got %v", err)
+	}
+}
+
+func TestParseOperation_SelectsByOperationName(t *testing.T) {
+	query := "query A { a } query B { b { c } }"
+
+	for _, p := range []*Parser{
+		NewParser(&MockLogger{}).(*Parser),
+		NewParserWithConfig(&ParserConfig{Lenient: true}, &MockLogger{}).(*Parser),
+	} {
+		parsedQuery, err := p.ParseOperation(query, "B")
+		if err != nil {
+			t.Fatalf("Expected operation B to be selected (lenient=%v), got %v", p.config.Lenient, err)
+		}
+		// 深度按所选操作计算
+		other, err := p.ParseOperation(query, "A")
+		if err != nil {
+			t.Fatalf("Expected operation A to be selected, got %v", err)
+		}
+		if parsedQuery.Operation != "B" || parsedQuery.Depth <= other.Depth {
+			t.Errorf("Expected operation B deeper than A, got %q with depth %d (A: %d)", parsedQuery.Operation, parsedQuery.Depth, other.Depth)
+		}
+
+		if _, err := p.ParseOperation(query, ""); err == nil {
+			t.Error("Multi-operation document without operationName should fail")
+		}
+		if _, err := p.ParseOperation(query, "C"); err == nil {
+			t.Error("Unknown operationName should fail")
+		}
+	}
+
+	if _, err := NewParser(&MockLogger{}).(*Parser).ParseOperation("query A { a }", "B"); err == nil {
+		t.Error("operationName not matching the single operation should fail")
+	}
+}
+
+func TestParseOperation_Lenient(t *testing.T) {
+	lenient := NewParserWithConfig(&ParserConfig{Lenient: true}, &MockLogger{}).(*Parser)
+	if _, err := lenient.ParseOperation("query { a", ""); err == nil {
+		t.Error("Syntax errors should fail in lenient mode")
+	}
+}
+
+func TestParseQuery_VariableDefinitions(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	parsedQuery, err := p.ParseQuery(`query Search($limit: Int = 10, $ids: [ID!]!, $filter: Filter = {tags: ["a"], open: true}, $cursor: String = null) { search(limit: $limit) { id } }`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	expected := []types.VariableDefinition{
+		{Name: "limit", Type: "Int", DefaultValue: int64(10), HasDefault: true},
+		{Name: "ids", Type: "[ID!]!"},
+		{Name: "filter", Type: "Filter", DefaultValue: map[string]interface{}{"tags": []interface{}{"a"}, "open": true}, HasDefault: true},
+		{Name: "cursor", Type: "String", HasDefault: true},
+	}
+	if len(parsedQuery.VariableDefinitions) != len(expected) {
+		t.Fatalf("Expected %d variable definitions, got %+v", len(expected), parsedQuery.VariableDefinitions)
+	}
+	for i, definition := range parsedQuery.VariableDefinitions {
+		if fmt.Sprintf("%#v", definition) != fmt.Sprintf("%#v", expected[i]) {
+			t.Errorf("Variable %d: expected %#v, got %#v", i, expected[i], definition)
+		}
+	}
+}
+
+func TestParseQuery_MaxSelectionBreadth(t *testing.T) {
+	var builder strings.Builder
+	builder.WriteString("query { ")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&builder, "f%d ", i)
+	}
+	builder.WriteString("}")
+	flat := builder.String()
+
+	p := NewParserWithConfig(&ParserConfig{MaxSelectionBreadth: 100}, &MockLogger{}).(*Parser)
+	_, err := p.ParseQuery(flat)
+	if fedErr, ok := err.(*errors.FederationError); !ok || fedErr.Code != errors.ErrCodeQueryComplexity {
+		t.Fatalf("Expected QUERY_COMPLEXITY_ERROR for 200 sibling fields, got %v", err)
+	}
+
+	parsed, err := NewParser(&MockLogger{}).ParseQuery(flat)
+	if err != nil {
+		t.Fatalf("Unlimited parser should accept the query, got %v", err)
+	}
+	if parsed.Breadth != 200 {
+		t.Errorf("Expected breadth 200, got %d", parsed.Breadth)
+	}
+
+	// 内联片段和片段展开的字段计入所在选择集，嵌套选择集单独计算
+	p.config.MaxSelectionBreadth = 4
+	if _, err := p.ParseQuery("query { a { x y z w } b ... on Query { c } ...F }\nfragment F on Query { d }"); err != nil {
+		t.Errorf("Expected breadth 4 to be accepted, got %v", err)
+	}
+	if _, err := p.ParseQuery("query { a { x y z w v } }"); err == nil {
+		t.Error("Expected nested selection set exceeding the limit to be rejected")
+	}
+	if _, err := p.ParseQuery("query { a b ... on Query { c } ...F }\nfragment F on Query { d e }"); err == nil {
+		t.Error("Expected fragment fields to count toward the parent selection set")
+	}
+}
+
+func TestValidateQuery_LenientRecoverableErrors(t *testing.T) {
+	schema := &types.Schema{SDL: "type Query { a: String b: String }"}
+	query := "query { a @unknown } fragment Unused on Query { b }"
+
+	strict := NewParser(&MockLogger{})
+	parsedQuery, err := strict.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := strict.ValidateQuery(parsedQuery, schema); err == nil {
+		t.Error("Strict mode should reject undefined directives and unused fragments")
+	}
+
+	lenient := NewParserWithConfig(&ParserConfig{Lenient: true}, &MockLogger{})
+	parsedQuery, err = lenient.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := lenient.ValidateQuery(parsedQuery, schema); err != nil {
+		t.Errorf("Lenient mode should ignore recoverable errors, got %v", err)
+	}
+
+	parsedQuery, err = lenient.ParseQuery("query { missing }")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := lenient.ValidateQuery(parsedQuery, schema); err == nil {
+		t.Error("Unknown fields should fail in lenient mode")
+	}
+}
+
+func TestValidateQuery_StructuredErrors(t *testing.T) {
+	schema := &types.Schema{SDL: "type Query { people: [Person] } type Person { id: ID! name: String }"}
+	parser := NewParserWithConfig(&ParserConfig{IgnoreUndefinedDirectives: true}, &MockLogger{})
+
+	// 片段展开和未定义的指令都可以通过验证
+	parsedQuery, err := parser.ParseQuery("query { people { ...PersonFields @cached } } fragment PersonFields on Person { id name }")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := parser.ValidateQuery(parsedQuery, schema); err != nil {
+		t.Errorf("Expected fragments to validate, got %v", err)
+	}
+
+	parsedQuery, err = parser.ParseQuery("query { people { id email } }")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	err = parser.ValidateQuery(parsedQuery, schema)
+	fedErr, ok := err.(*errors.FederationError)
+	if !ok || fedErr.Code != errors.ErrCodeQueryValidation {
+		t.Fatalf("Expected QUERY_VALIDATION_ERROR, got %v", err)
+	}
+	if !strings.Contains(fedErr.Message, `Cannot query field "email" on type "Person"`) {
+		t.Errorf("Expected unknown field error, got %v", fedErr)
+	}
+}
+
 func TestExtractFields_NilQuery(t *testing.T) {
 	logger := &MockLogger{}
 	parser := NewParser(logger)
@@ -170,3 +360,203 @@ func TestParser_truncateQuery(t *testing.T) {
 		t.Error("Truncated query should not be empty")
 	}
 }
+
+func TestParser_getTypeString(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	document, report := astparser.ParseGraphqlDocumentString(`
+		type Product {
+			upc: String!
+			address: Address
+			variants: [Variant]
+			tags: [String!]!
+		}
+	`)
+	if report.HasErrors() {
+		t.Fatalf("Failed to parse schema: %s", report.Error())
+	}
+
+	// 命名类型返回自身名称，不回退为 String
+	expected := map[string]string{
+		"upc":      "String!",
+		"address":  "Address",
+		"variants": "[Variant]",
+		"tags":     "[String!]!",
+	}
+	for _, fieldRef := range document.ObjectTypeDefinitions[0].FieldsDefinition.Refs {
+		name := document.FieldDefinitionNameString(fieldRef)
+		typeNode := document.Types[document.FieldDefinitions[fieldRef].Type]
+		if got := p.getTypeString(&document, typeNode); got != expected[name] {
+			t.Errorf("getTypeString(%s) = %q, want %q", name, got, expected[name])
+		}
+	}
+}
+
+func TestExtractFederationEntities_LinkDirective(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	schema := `
+		extend schema @link(url: "https://specs.apollo.dev/federation/v2.3", import: ["@shareable", { name: "@key", as: "@primaryKey" }])
+
+		type User @primaryKey(fields: "id") {
+			id: ID!
+			name: String @shareable
+		}
+
+		type Product @federation__key(fields: "upc") {
+			upc: String!
+		}
+	`
+
+	entities, err := p.ExtractFederationEntities(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error for v2 schema: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("Expected 2 entities, got %d", len(entities))
+	}
+
+	document, report := astparser.ParseGraphqlDocumentString(schema)
+	if report.HasErrors() {
+		t.Fatalf("Failed to parse schema: %s", report.Error())
+	}
+	link := ExtractLinkDirective(&document)
+	if link == nil || link.Version != "2.3" {
+		t.Fatalf("Expected link version 2.3, got %+v", link)
+	}
+	if !link.IsFederationV2() {
+		t.Error("Expected schema to be detected as Federation v2")
+	}
+	if len(link.Imports) != 2 || link.Imports[0] != "shareable" || link.Imports[1] != "key" {
+		t.Errorf("Unexpected imports: %v", link.Imports)
+	}
+
+	user := entities[0]
+	if len(user.Directives.Keys) != 1 || user.Directives.Keys[0].Fields != "id" {
+		t.Errorf("Expected aliased @key on User, got %+v", user.Directives.Keys)
+	}
+	if len(entities[1].Directives.Keys) != 1 || entities[1].Directives.Keys[0].Fields != "upc" {
+		t.Errorf("Expected namespaced @key on Product, got %+v", entities[1].Directives.Keys)
+	}
+}
+
+func TestExtractFederationEntities_InterfaceEntity(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	schema := `
+		interface Node @key(fields: "id") {
+			id: ID!
+		}
+
+		type User implements Node @key(fields: "id") {
+			id: ID!
+			name: String
+		}
+	`
+
+	entities, err := p.ExtractFederationEntities(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("Expected object and interface entities, got %d", len(entities))
+	}
+
+	byName := make(map[string]types.FederatedEntity)
+	for _, entity := range entities {
+		byName[entity.TypeName] = entity
+	}
+
+	node, ok := byName["Node"]
+	if !ok || node.Kind != types.EntityKindInterface {
+		t.Fatalf("Expected Node interface entity, got %+v", node)
+	}
+	if len(node.Directives.Keys) != 1 || node.Directives.Keys[0].Fields != "id" {
+		t.Errorf("Expected @key on Node, got %+v", node.Directives.Keys)
+	}
+
+	user := byName["User"]
+	if user.Kind != types.EntityKindObject || len(user.Interfaces) != 1 || user.Interfaces[0] != "Node" {
+		t.Errorf("Expected User to implement Node, got %+v", user)
+	}
+}
+
+func TestExtractFederationEntities_RequiresFieldSet(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	schema := `
+		type Product @key(fields: "upc") {
+			upc: String!
+			weight: Int @external
+			address: Address @external
+			tags: [String] @external
+			variants: [Variant] @external
+			shippingEstimate: Int @requires(fields: "weight")
+			deliveryZone: String @requires(fields: "address { zip country { code } } tags")
+			stockLevel: Int @requires(fields: "variants { sku }")
+		}
+	`
+
+	entities, err := p.ExtractFederationEntities(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entities) != 1 {
+		t.Fatalf("Expected 1 entity, got %d", len(entities))
+	}
+
+	requires := make(map[string]*types.RequiresDirective)
+	for _, field := range entities[0].Fields {
+		if field.Directives.Requires != nil {
+			requires[field.Name] = field.Directives.Requires
+		}
+	}
+
+	flat := requires["shippingEstimate"]
+	if flat == nil || len(flat.Selection) != 1 || flat.Selection[0].Name != "weight" || flat.Selection[0].Selections != nil {
+		t.Errorf("Expected flat selection on shippingEstimate, got %+v", flat)
+	}
+
+	nested := requires["deliveryZone"]
+	if nested == nil || len(nested.Selection) != 2 {
+		t.Fatalf("Expected two top-level selections on deliveryZone, got %+v", nested)
+	}
+	address := nested.Selection[0]
+	if address.Name != "address" || len(address.Selections) != 2 || address.Selections[0].Name != "zip" {
+		t.Errorf("Expected address { zip country { code } }, got %+v", address)
+	}
+	if country := address.Selections[1]; country.Name != "country" || len(country.Selections) != 1 || country.Selections[0].Name != "code" {
+		t.Errorf("Expected nested country { code }, got %+v", country)
+	}
+	if names := nested.FieldNames(); len(names) != 2 || names[0] != "address" || names[1] != "tags" {
+		t.Errorf("Expected top-level names [address tags], got %v", names)
+	}
+
+	list := requires["stockLevel"]
+	if list == nil || len(list.Selection) != 1 || list.Selection[0].Name != "variants" ||
+		len(list.Selection[0].Selections) != 1 || list.Selection[0].Selections[0].Name != "sku" {
+		t.Errorf("Expected list-valued variants { sku } selection, got %+v", list)
+	}
+}
+
+func TestExtractFederationEntities_InvalidFieldSet(t *testing.T) {
+	p := NewParser(&MockLogger{}).(*Parser)
+
+	schema := `
+		type Product @key(fields: "upc") {
+			upc: String!
+			address: Address @external
+			deliveryZone: String @requires(fields: "address { zip")
+		}
+	`
+
+	entities, err := p.ExtractFederationEntities(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, field := range entities[0].Fields {
+		if field.Name == "deliveryZone" {
+			t.Errorf("Expected field with unbalanced @requires to be skipped, got %+v", field)
+		}
+	}
+}
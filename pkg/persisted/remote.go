@@ -0,0 +1,231 @@
+package persisted
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 远程注册中心默认参数
+const (
+	DefaultRegistryCacheTTL         = 5 * time.Minute
+	DefaultRegistryTimeout          = 2 * time.Second
+	DefaultRegistryNegativeCacheTTL = 30 * time.Second
+
+	// maxNegativeEntries 未命中缓存的条目上限，防止大量随机哈希占满内存
+	maxNegativeEntries = 10000
+
+	registryServiceName = "persisted-query-registry"
+	registryQuery       = "query PersistedQuery($id: ID!) { persistedQuery(id: $id) { body } }"
+)
+
+// remoteEntry 从注册中心取回的操作文本
+type remoteEntry struct {
+	query     string
+	expiresAt time.Time
+}
+
+// RemoteStore 带远程注册中心的持久化查询存储。
+// 清单和 APQ 由本地存储负责；本地未命中时经 ServiceCaller 查询注册中心，结果按 TTL 缓存，
+// 注册中心未找到的哈希按较短的 TTL 缓存，注册中心不可用时使用已过期的缓存
+type RemoteStore struct {
+	local       *MemoryStore
+	caller      federationtypes.ServiceCaller
+	logger      federationtypes.Logger
+	service     *federationtypes.ServiceConfig
+	ttl         time.Duration
+	negativeTTL time.Duration
+	timeout     time.Duration
+
+	entries map[string]*remoteEntry
+	misses  map[string]time.Time // 注册中心未找到的哈希及其过期时间
+	mutex   sync.RWMutex
+	now     func() time.Time
+}
+
+// NewRemoteStore 创建带远程注册中心的持久化查询存储，local 为空时新建内存存储
+func NewRemoteStore(config *federationtypes.PersistedQueryRegistryConfig, local *MemoryStore, caller federationtypes.ServiceCaller, logger federationtypes.Logger) *RemoteStore {
+	if local == nil {
+		local = NewPersistedQueryStore(nil, logger)
+	}
+
+	ttl := config.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultRegistryCacheTTL
+	}
+	negativeTTL := config.NegativeCacheTTL
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultRegistryNegativeCacheTTL
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRegistryTimeout
+	}
+
+	service := &federationtypes.ServiceConfig{
+		Name:     registryServiceName,
+		Endpoint: config.Endpoint,
+		Timeout:  timeout,
+	}
+	if config.AuthHeader != "" {
+		service.Headers = map[string]string{"authorization": config.AuthHeader}
+	}
+
+	return &RemoteStore{
+		local:       local,
+		caller:      caller,
+		logger:      logger,
+		service:     service,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		timeout:     timeout,
+		entries:     make(map[string]*remoteEntry),
+		misses:      make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Get 按哈希获取查询文本，依次查找本地存储、远程缓存和注册中心
+func (s *RemoteStore) Get(hash string) (string, bool) {
+	if query, ok := s.local.Get(hash); ok {
+		return query, true
+	}
+	return s.lookup(strings.ToLower(hash))
+}
+
+// Register 注册自动持久化查询
+func (s *RemoteStore) Register(hash string, query string) error {
+	return s.local.Register(hash, query)
+}
+
+// IsAllowed 清单中的操作和注册中心发布的操作都视为允许
+func (s *RemoteStore) IsAllowed(hash string) bool {
+	if s.local.IsAllowed(hash) {
+		return true
+	}
+	_, ok := s.lookup(strings.ToLower(hash))
+	return ok
+}
+
+// LoadManifest 加载清单到本地存储
+func (s *RemoteStore) LoadManifest(data []byte) (int, error) {
+	return s.local.LoadManifest(data)
+}
+
+// lookup 查找远程缓存，过期或未缓存时请求注册中心；近期确认未找到的哈希不再请求，
+// 注册中心不可用时返回过期缓存
+func (s *RemoteStore) lookup(hash string) (string, bool) {
+	// 非 sha256 格式的哈希不可能命中，避免任意输入触发远程请求
+	if !isSHA256Hex(hash) {
+		return "", false
+	}
+
+	s.mutex.RLock()
+	entry := s.entries[hash]
+	missExpiresAt, missed := s.misses[hash]
+	s.mutex.RUnlock()
+
+	if entry != nil && s.now().Before(entry.expiresAt) {
+		return entry.query, true
+	}
+	if missed && s.now().Before(missExpiresAt) {
+		return "", false
+	}
+
+	query, found, err := s.fetch(hash)
+	if err != nil {
+		s.logger.Warn("Persisted query registry unavailable", "hash", hash, "error", err)
+		if entry != nil {
+			return entry.query, true
+		}
+		return "", false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !found {
+		delete(s.entries, hash)
+		s.recordMissLocked(hash)
+		return "", false
+	}
+	delete(s.misses, hash)
+	s.entries[hash] = &remoteEntry{query: query, expiresAt: s.now().Add(s.ttl)}
+	return query, true
+}
+
+// recordMissLocked 缓存注册中心未找到的哈希。达到条目上限时先清理过期条目，仍然已满则不缓存，调用方需持有写锁
+func (s *RemoteStore) recordMissLocked(hash string) {
+	now := s.now()
+	if len(s.misses) >= maxNegativeEntries {
+		for missed, expiresAt := range s.misses {
+			if !now.Before(expiresAt) {
+				delete(s.misses, missed)
+			}
+		}
+		if len(s.misses) >= maxNegativeEntries {
+			return
+		}
+	}
+	s.misses[hash] = now.Add(s.negativeTTL)
+}
+
+// fetch 向注册中心查询操作文本，注册中心明确未找到时 found 为 false
+func (s *RemoteStore) fetch(hash string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	response, err := s.caller.Call(ctx, &federationtypes.ServiceCall{
+		Service: s.service,
+		SubQuery: &federationtypes.SubQuery{
+			ServiceName:   registryServiceName,
+			Query:         registryQuery,
+			OperationName: "PersistedQuery",
+			Variables:     map[string]interface{}{"id": hash},
+			Timeout:       s.timeout,
+		},
+		StartTime: time.Now(),
+	})
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if len(response.Errors) > 0 {
+		return "", false, fmt.Errorf("registry returned error: %s", response.Errors[0].Message)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	operation, _ := data["persistedQuery"].(map[string]interface{})
+	body, _ := operation["body"].(string)
+	if body == "" {
+		return "", false, nil
+	}
+
+	// 与清单一致，只接受哈希匹配的操作文本
+	if HashQuery(body) != hash {
+		s.logger.Error("Rejected persisted query from registry with mismatched hash", "hash", hash)
+		return "", false, nil
+	}
+
+	return body, true, nil
+}
+
+// isSHA256Hex 判断是否为小写十六进制的 sha256 哈希
+func isSHA256Hex(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		c := hash[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package persisted
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+// registryCaller 模拟注册中心，按哈希返回已发布的操作
+type registryCaller struct {
+	operations map[string]string
+	err        error
+	calls      []*federationtypes.ServiceCall
+}
+
+func (c *registryCaller) Call(ctx context.Context, call *federationtypes.ServiceCall) (*federationtypes.ServiceResponse, error) {
+	c.calls = append(c.calls, call)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	var operation interface{}
+	if body, ok := c.operations[call.SubQuery.Variables["id"].(string)]; ok {
+		operation = map[string]interface{}{"body": body}
+	}
+	return &federationtypes.ServiceResponse{
+		Data:       map[string]interface{}{"persistedQuery": operation},
+		StatusCode: 200,
+	}, nil
+}
+
+func (c *registryCaller) CallBatch(ctx context.Context, calls []*federationtypes.ServiceCall) ([]*federationtypes.ServiceResponse, error) {
+	return nil, nil
+}
+
+func (c *registryCaller) IsHealthy(ctx context.Context, service *federationtypes.ServiceConfig) bool {
+	return true
+}
+
+func TestRemoteStore_FetchesAndCaches(t *testing.T) {
+	published := "query Published { me { id } }"
+	caller := &registryCaller{operations: map[string]string{
+		HashQuery(published):    published,
+		HashQuery("{ signed }"): "{ tampered }",
+	}}
+	store := NewRemoteStore(&federationtypes.PersistedQueryRegistryConfig{
+		Endpoint:   "http://registry/graphql",
+		AuthHeader: "Bearer secret",
+		CacheTTL:   time.Minute,
+	}, nil, caller, utils.NewLogger("test"))
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if query, ok := store.Get(HashQuery(published)); !ok || query != published {
+		t.Fatalf("Expected remote operation, got %q, %v", query, ok)
+	}
+	if !store.IsAllowed(HashQuery(published)) {
+		t.Error("Expected published operation to be allowed")
+	}
+	if len(caller.calls) != 1 {
+		t.Fatalf("Expected cached lookup, got %d registry calls", len(caller.calls))
+	}
+	if caller.calls[0].Service.Headers["authorization"] != "Bearer secret" {
+		t.Errorf("Expected auth header, got %v", caller.calls[0].Service.Headers)
+	}
+
+	// 缓存过期后重新请求注册中心
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.Get(HashQuery(published)); !ok {
+		t.Error("Expected operation after refresh")
+	}
+	if len(caller.calls) != 2 {
+		t.Errorf("Expected refresh after TTL, got %d registry calls", len(caller.calls))
+	}
+
+	if _, ok := store.Get(HashQuery("{ unknown }")); ok {
+		t.Error("Expected remote miss")
+	}
+	if _, ok := store.Get(HashQuery("{ signed }")); ok {
+		t.Error("Operation failing hash verification should be rejected")
+	}
+
+	calls := len(caller.calls)
+	if _, ok := store.Get("not-a-hash"); ok || len(caller.calls) != calls {
+		t.Error("Malformed hash should not reach the registry")
+	}
+}
+
+func TestRemoteStore_NegativeCache(t *testing.T) {
+	caller := &registryCaller{operations: map[string]string{}}
+	store := NewRemoteStore(&federationtypes.PersistedQueryRegistryConfig{
+		Endpoint:         "http://registry/graphql",
+		NegativeCacheTTL: 10 * time.Second,
+	}, nil, caller, utils.NewLogger("test"))
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	// 未找到的哈希在短 TTL 内不再请求注册中心
+	query := "{ later }"
+	for i := 0; i < 3; i++ {
+		if _, ok := store.Get(HashQuery(query)); ok {
+			t.Fatal("Expected remote miss")
+		}
+	}
+	if len(caller.calls) != 1 {
+		t.Fatalf("Expected misses to be cached, got %d registry calls", len(caller.calls))
+	}
+
+	// 过期后重新请求，发布后可以取回
+	caller.operations[HashQuery(query)] = query
+	now = now.Add(11 * time.Second)
+	if got, ok := store.Get(HashQuery(query)); !ok || got != query {
+		t.Errorf("Expected operation published after the miss expired, got %q, %v", got, ok)
+	}
+	if len(caller.calls) != 2 {
+		t.Errorf("Expected a registry call after the miss expired, got %d", len(caller.calls))
+	}
+}
+
+func TestRemoteStore_ServesStaleWhenUnavailable(t *testing.T) {
+	published := "{ a }"
+	caller := &registryCaller{operations: map[string]string{HashQuery(published): published}}
+	store := NewRemoteStore(&federationtypes.PersistedQueryRegistryConfig{
+		Endpoint: "http://registry/graphql",
+		CacheTTL: time.Minute,
+	}, nil, caller, utils.NewLogger("test"))
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if _, ok := store.Get(HashQuery(published)); !ok {
+		t.Fatal("Expected remote operation")
+	}
+
+	now = now.Add(2 * time.Minute)
+	caller.err = stderrors.New("connection refused")
+
+	if query, ok := store.Get(HashQuery(published)); !ok || query != published {
+		t.Errorf("Expected stale cache while registry is unavailable, got %q, %v", query, ok)
+	}
+	if _, ok := store.Get(HashQuery("{ b }")); ok {
+		t.Error("Expected miss for uncached operation while registry is unavailable")
+	}
+}
+
+func TestRemoteStore_LocalFirst(t *testing.T) {
+	caller := &registryCaller{}
+	store := NewRemoteStore(&federationtypes.PersistedQueryRegistryConfig{
+		Endpoint: "http://registry/graphql",
+	}, nil, caller, utils.NewLogger("test"))
+
+	query := "{ local }"
+	if err := store.Register(HashQuery(query), query); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got, ok := store.Get(HashQuery(query)); !ok || got != query {
+		t.Errorf("Expected local APQ entry, got %q, %v", got, ok)
+	}
+	if len(caller.calls) != 0 {
+		t.Errorf("Local hit should not query the registry, got %d calls", len(caller.calls))
+	}
+}
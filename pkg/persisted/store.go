@@ -0,0 +1,159 @@
+package persisted
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// PersistedQueryConfig 持久化查询存储配置
+type PersistedQueryConfig struct {
+	MaxAPQEntries int `json:"maxAPQEntries"` // 运行时注册的 APQ 条目上限，超出时淘汰最早的条目，清单中的操作不受限制
+}
+
+// DefaultPersistedQueryConfig 返回默认持久化查询配置
+func DefaultPersistedQueryConfig() *PersistedQueryConfig {
+	return &PersistedQueryConfig{
+		MaxAPQEntries: 1000,
+	}
+}
+
+// Manifest Apollo 格式的持久化查询清单
+type Manifest struct {
+	Format     string              `json:"format,omitempty"`
+	Version    int                 `json:"version,omitempty"`
+	Operations []ManifestOperation `json:"operations"`
+}
+
+// ManifestOperation 清单中的单个操作，id 为 body 的 sha256 十六进制哈希
+type ManifestOperation struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// MemoryStore 内存持久化查询存储
+type MemoryStore struct {
+	config *PersistedQueryConfig
+	logger federationtypes.Logger
+
+	allowlist map[string]string // 清单载入的操作，同时作为允许列表
+	apq       map[string]string // 运行时注册的自动持久化查询
+	apqOrder  []string
+	mutex     sync.RWMutex
+}
+
+// NewPersistedQueryStore 创建内存持久化查询存储
+func NewPersistedQueryStore(config *PersistedQueryConfig, logger federationtypes.Logger) *MemoryStore {
+	if config == nil {
+		config = DefaultPersistedQueryConfig()
+	}
+
+	return &MemoryStore{
+		config:    config,
+		logger:    logger,
+		allowlist: make(map[string]string),
+		apq:       make(map[string]string),
+	}
+}
+
+// HashQuery 计算查询的 sha256 十六进制哈希
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get 按哈希获取查询文本，清单中的操作优先
+func (s *MemoryStore) Get(hash string) (string, bool) {
+	hash = strings.ToLower(hash)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if query, ok := s.allowlist[hash]; ok {
+		return query, true
+	}
+	query, ok := s.apq[hash]
+	return query, ok
+}
+
+// Register 注册自动持久化查询
+func (s *MemoryStore) Register(hash string, query string) error {
+	hash = strings.ToLower(hash)
+	if HashQuery(query) != hash {
+		return errors.NewQueryValidationError("provided sha does not match query")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.allowlist[hash]; ok {
+		return nil
+	}
+	if _, ok := s.apq[hash]; ok {
+		return nil
+	}
+
+	if s.config.MaxAPQEntries > 0 && len(s.apqOrder) >= s.config.MaxAPQEntries {
+		oldest := s.apqOrder[0]
+		s.apqOrder = s.apqOrder[1:]
+		delete(s.apq, oldest)
+	}
+	s.apq[hash] = query
+	s.apqOrder = append(s.apqOrder, hash)
+	return nil
+}
+
+// IsAllowed 判断查询哈希是否在清单载入的允许列表中
+func (s *MemoryStore) IsAllowed(hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.allowlist[strings.ToLower(hash)]
+	return ok
+}
+
+// LoadManifest 加载清单，同时填充 APQ 和允许列表；哈希校验失败的操作记录错误后跳过
+func (s *MemoryStore) LoadManifest(data []byte) (int, error) {
+	if !jsonutil.Valid(data) {
+		return 0, errors.NewConfigError("invalid persisted query manifest: malformed JSON")
+	}
+
+	var manifest Manifest
+	if err := jsonutil.Unmarshal(data, &manifest); err != nil {
+		return 0, errors.NewConfigError("invalid persisted query manifest", errors.WithCause(err))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	loaded := 0
+	for i, operation := range manifest.Operations {
+		id := strings.ToLower(operation.ID)
+		if actual := HashQuery(operation.Body); id == "" || actual != id {
+			s.logger.Error("Rejected persisted query with mismatched hash",
+				"index", i,
+				"name", operation.Name,
+				"id", operation.ID,
+				"actual", actual,
+			)
+			continue
+		}
+
+		s.allowlist[id] = operation.Body
+		loaded++
+	}
+
+	s.logger.Info("Persisted query manifest loaded",
+		"operations", len(manifest.Operations),
+		"loaded", loaded,
+		"rejected", len(manifest.Operations)-loaded,
+	)
+	return loaded, nil
+}
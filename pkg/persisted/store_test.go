@@ -0,0 +1,71 @@
+package persisted
+
+import (
+	"fmt"
+	"testing"
+
+	"envoy-wasm-graphql-federation/pkg/utils"
+)
+
+func TestMemoryStore_LoadManifest(t *testing.T) {
+	store := NewPersistedQueryStore(nil, utils.NewLogger("test"))
+
+	valid := "query GetUser { user { id } }"
+	manifest := fmt.Sprintf(`{
+		"format": "apollo-persisted-query-manifest",
+		"version": 1,
+		"operations": [
+			{"id": %q, "body": %q, "name": "GetUser", "type": "query"},
+			{"id": %q, "body": "query Tampered { secret }", "name": "Tampered", "type": "query"}
+		]
+	}`, HashQuery(valid), valid, HashQuery("query Original { id }"))
+
+	loaded, err := store.LoadManifest([]byte(manifest))
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if loaded != 1 {
+		t.Errorf("Expected 1 loaded operation, got %d", loaded)
+	}
+
+	if query, ok := store.Get(HashQuery(valid)); !ok || query != valid {
+		t.Errorf("Expected manifest operation to be retrievable, got %q, %v", query, ok)
+	}
+	if !store.IsAllowed(HashQuery(valid)) {
+		t.Error("Expected manifest operation to be allowlisted")
+	}
+	if store.IsAllowed(HashQuery("query Original { id }")) {
+		t.Error("Operation failing hash verification should not be allowlisted")
+	}
+
+	if _, err := store.LoadManifest([]byte(`{"operations": [`)); err == nil {
+		t.Error("Expected error for malformed manifest")
+	}
+}
+
+func TestMemoryStore_Register(t *testing.T) {
+	store := NewPersistedQueryStore(&PersistedQueryConfig{MaxAPQEntries: 1}, utils.NewLogger("test"))
+
+	first := "{ a }"
+	second := "{ b }"
+
+	if err := store.Register(HashQuery(first), "{ tampered }"); err == nil {
+		t.Error("Expected error for mismatched hash")
+	}
+	if err := store.Register(HashQuery(first), first); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if store.IsAllowed(HashQuery(first)) {
+		t.Error("APQ registrations should not be allowlisted")
+	}
+	if err := store.Register(HashQuery(second), second); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if _, ok := store.Get(HashQuery(first)); ok {
+		t.Error("Expected oldest APQ entry to be evicted")
+	}
+	if query, ok := store.Get(HashQuery(second)); !ok || query != second {
+		t.Errorf("Expected %q, got %q", second, query)
+	}
+}
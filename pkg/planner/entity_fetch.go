@@ -0,0 +1,793 @@
+package planner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/parser"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// serviceTypes 单个服务模式中的对象类型信息
+type serviceTypes struct {
+	fields    map[string]map[string]string   // 类型名 -> 字段名 -> 返回的命名类型，@external 字段不计入
+	keys      map[string][][]string          // 可在该服务解析的实体类型的各个 @key 的字段，按声明顺序
+	requires  map[string]map[string][]string // 类型名 -> 字段名 -> @requires 声明的字段，只记录不含嵌套选择的声明
+	rootTypes map[string]string              // 操作类型 -> 根类型名，支持 schema 定义重命名的根类型
+}
+
+// rootType 返回操作类型在该服务模式中的根类型名
+func (t *serviceTypes) rootType(operationType ast.OperationType) string {
+	switch operationType {
+	case ast.OperationTypeMutation:
+		return t.rootTypes["mutation"]
+	case ast.OperationTypeSubscription:
+		return t.rootTypes["subscription"]
+	default:
+		return t.rootTypes["query"]
+	}
+}
+
+// definesRootField 判断服务的任一根类型是否定义了字段
+func (t *serviceTypes) definesRootField(fieldName string) bool {
+	for _, typeName := range t.rootTypes {
+		if t.definesField(typeName, fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+// definesField 判断服务是否自行解析类型上的字段
+func (t *serviceTypes) definesField(typeName, fieldName string) bool {
+	_, ok := t.fields[typeName][fieldName]
+	return ok
+}
+
+// requiredFields 返回服务解析类型上的字段前需要在表示中携带的 @requires 字段
+func (t *serviceTypes) requiredFields(typeName, fieldName string) []string {
+	return t.requires[typeName][fieldName]
+}
+
+// providesKeyField 判断服务能否返回实体的键字段。扩展实体时键字段通常标记为 @external，
+// 但服务在引用该实体时仍会返回自己 @key 中的字段
+func (t *serviceTypes) providesKeyField(typeName, fieldName string) bool {
+	if t.definesField(typeName, fieldName) {
+		return true
+	}
+	for _, keyFields := range t.keys[typeName] {
+		for _, keyField := range keyFields {
+			if keyField == fieldName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// providedKeys 返回 target 中当前服务能提供全部字段的 @key，按 target 的声明顺序
+func (t *serviceTypes) providedKeys(typeName string, target [][]string) [][]string {
+	var provided [][]string
+	for _, keyFields := range target {
+		providesAll := true
+		for _, keyField := range keyFields {
+			if !t.providesKeyField(typeName, keyField) {
+				providesAll = false
+				break
+			}
+		}
+		if providesAll {
+			provided = append(provided, keyFields)
+		}
+	}
+	return provided
+}
+
+// schemaTypes 返回服务模式的类型信息，按模式文本缓存，模式为空或无法解析时返回 nil
+func (p *Planner) schemaTypes(service *federationtypes.ServiceConfig) *serviceTypes {
+	if service == nil || service.Schema == "" {
+		return nil
+	}
+
+	p.schemaMutex.Lock()
+	defer p.schemaMutex.Unlock()
+
+	if types, ok := p.schemaCache[service.Schema]; ok {
+		return types
+	}
+
+	types := parseServiceTypes(service.Schema)
+	if p.schemaCache == nil {
+		p.schemaCache = make(map[string]*serviceTypes)
+	}
+	p.schemaCache[service.Schema] = types
+	return types
+}
+
+// parseServiceTypes 解析模式中的对象类型及扩展
+func parseServiceTypes(schema string) *serviceTypes {
+	document, report := astparser.ParseGraphqlDocumentString(schema)
+	if report.HasErrors() {
+		return nil
+	}
+
+	types := &serviceTypes{
+		fields:    make(map[string]map[string]string),
+		keys:      make(map[string][][]string),
+		requires:  make(map[string]map[string][]string),
+		rootTypes: parser.RootOperationTypes(&document),
+	}
+
+	add := func(typeName string, fieldRefs, directiveRefs []int) {
+		fields, ok := types.fields[typeName]
+		if !ok {
+			fields = make(map[string]string)
+			types.fields[typeName] = fields
+		}
+		for _, fieldRef := range fieldRefs {
+			if hasDirective(&document, document.FieldDefinitionDirectives(fieldRef), "external") {
+				continue
+			}
+			fieldName := document.FieldDefinitionNameString(fieldRef)
+			fields[fieldName] = document.FieldDefinitionTypeNameString(fieldRef)
+			if required := requiresFields(&document, document.FieldDefinitionDirectives(fieldRef)); len(required) > 0 {
+				if types.requires[typeName] == nil {
+					types.requires[typeName] = make(map[string][]string)
+				}
+				types.requires[typeName][fieldName] = required
+			}
+		}
+		// 同一实体可声明多个 @key，类型定义和扩展中的键都保留，重复的键只记录一次
+		for _, keyFields := range resolvableKeys(&document, directiveRefs) {
+			if !containsKey(types.keys[typeName], keyFields) {
+				types.keys[typeName] = append(types.keys[typeName], keyFields)
+			}
+		}
+	}
+
+	for i := range document.ObjectTypeDefinitions {
+		definition := document.ObjectTypeDefinitions[i]
+		add(document.ObjectTypeDefinitionNameString(i), definition.FieldsDefinition.Refs, definition.Directives.Refs)
+	}
+	for i := range document.ObjectTypeExtensions {
+		extension := document.ObjectTypeExtensions[i]
+		add(document.ObjectTypeExtensionNameString(i), extension.FieldsDefinition.Refs, extension.Directives.Refs)
+	}
+
+	return types
+}
+
+// hasDirective 判断指令列表中是否包含指定指令
+func hasDirective(document *ast.Document, directiveRefs []int, name string) bool {
+	for _, directiveRef := range directiveRefs {
+		if document.DirectiveNameString(directiveRef) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requiresFields 返回字段上 @requires 声明的顶层字段，含嵌套选择的声明无法直接从父级对象取值，返回 nil
+func requiresFields(document *ast.Document, directiveRefs []int) []string {
+	for _, directiveRef := range directiveRefs {
+		if document.DirectiveNameString(directiveRef) != "requires" {
+			continue
+		}
+		value, ok := document.DirectiveArgumentValueByName(directiveRef, []byte("fields"))
+		if !ok || value.Kind != ast.ValueKindString {
+			return nil
+		}
+		fields := document.StringValueContentString(value.Ref)
+		if strings.ContainsAny(fields, "{}") {
+			return nil
+		}
+		return strings.Fields(fields)
+	}
+	return nil
+}
+
+// resolvableKeys 返回所有可解析且只包含顶层字段的 @key 的字段列表，按声明顺序
+func resolvableKeys(document *ast.Document, directiveRefs []int) [][]string {
+	var keys [][]string
+	for _, directiveRef := range directiveRefs {
+		if document.DirectiveNameString(directiveRef) != "key" {
+			continue
+		}
+
+		if resolvable, ok := document.DirectiveArgumentValueByName(directiveRef, []byte("resolvable")); ok &&
+			resolvable.Kind == ast.ValueKindBoolean && !bool(document.BooleanValue(resolvable.Ref)) {
+			continue
+		}
+
+		value, ok := document.DirectiveArgumentValueByName(directiveRef, []byte("fields"))
+		if !ok || value.Kind != ast.ValueKindString {
+			continue
+		}
+
+		// 嵌套键需要子选择，构造表示时无法直接取值，跳过
+		fields := document.StringValueContentString(value.Ref)
+		if strings.ContainsAny(fields, "{}") {
+			continue
+		}
+		if keyFields := strings.Fields(fields); len(keyFields) > 0 {
+			keys = append(keys, keyFields)
+		}
+	}
+	return keys
+}
+
+// containsKey 判断键列表中是否已有字段相同的键
+func containsKey(keys [][]string, keyFields []string) bool {
+	for _, existing := range keys {
+		if strings.Join(existing, " ") == strings.Join(keyFields, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// entityFetchPlanner 单次规划中拆分根字段子选择的状态
+type entityFetchPlanner struct {
+	planner      *Planner
+	document     *ast.Document
+	operationRef int
+	services     []federationtypes.ServiceConfig
+	variables    map[string]interface{}
+
+	selections map[string]string // 被拆分的根字段名 -> 拥有者服务的选择文本
+	fetches    []federationtypes.EntityFetch
+
+	entityFields map[string]map[string]bool // 触发实体查询的字段（Type.field）-> 出现位置的响应路径
+}
+
+// planEntityFetches 找出子选择属于其他服务的根字段，记录拥有者服务对这些根字段的选择
+// 以及需要在根查询之后执行的实体查询；没有需要拆分的根字段时返回 nil。
+// 同一个触发实体查询的字段通过别名重复出现超过上限时返回查询复杂度错误
+func (p *Planner) planEntityFetches(query *federationtypes.ParsedQuery, fieldMappings map[string][]string, services []federationtypes.ServiceConfig) (*entityFetchPlanner, error) {
+	document, ok := query.AST.(*ast.Document)
+	if !ok {
+		return nil, nil
+	}
+
+	operationRef := findOperationRef(document, query.Operation)
+	if operationRef == -1 {
+		return nil, nil
+	}
+
+	operation := document.OperationDefinitions[operationRef]
+	if operation.OperationType == ast.OperationTypeSubscription {
+		return nil, nil
+	}
+	splitter := &entityFetchPlanner{
+		planner:      p,
+		document:     document,
+		operationRef: operationRef,
+		services:     services,
+		variables:    query.Variables,
+		selections:   make(map[string]string),
+		entityFields: make(map[string]map[string]bool),
+	}
+	selections := splitter.selections
+	for _, selectionRef := range document.SelectionSets[operation.SelectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+		if selection.Kind != ast.SelectionKindField || !document.Fields[selection.Ref].HasSelections {
+			continue
+		}
+
+		fieldName := document.FieldNameString(selection.Ref)
+		owners := fieldMappings[fieldName]
+		if len(owners) == 0 {
+			continue
+		}
+
+		owner := p.findServiceByName(owners[0], services)
+		types := p.schemaTypes(owner)
+		if types == nil {
+			continue
+		}
+		rootType := types.rootType(operation.OperationType)
+		if !types.definesField(rootType, fieldName) {
+			continue
+		}
+
+		fetchCount := len(splitter.fetches)
+		printed := splitter.printField(selection.Ref, rootType, types.fields[rootType][fieldName], owner, nil)
+		if len(splitter.fetches) == fetchCount {
+			continue
+		}
+
+		if existing, ok := selections[fieldName]; ok {
+			printed = existing + " " + printed
+		}
+		selections[fieldName] = printed
+	}
+
+	if len(splitter.fetches) == 0 {
+		return nil, nil
+	}
+
+	if err := splitter.checkEntityFieldAliases(); err != nil {
+		return nil, err
+	}
+
+	p.logger.Debug("Planned entity fetches", "count", len(splitter.fetches), "rootFields", len(selections))
+	return splitter, nil
+}
+
+// checkEntityFieldAliases 检查每个触发实体查询的字段出现的次数。
+// 每次出现都会单独产生 _entities 请求，通过别名重复字段会成倍放大实体解析的开销
+func (s *entityFetchPlanner) checkEntityFieldAliases() error {
+	limit := s.planner.config.MaxEntityFieldAliases
+	if limit <= 0 {
+		return nil
+	}
+
+	coordinates := make([]string, 0, len(s.entityFields))
+	for coordinate := range s.entityFields {
+		coordinates = append(coordinates, coordinate)
+	}
+	sort.Strings(coordinates)
+
+	for _, coordinate := range coordinates {
+		if count := len(s.entityFields[coordinate]); count > limit {
+			return errors.NewQueryComplexityError(
+				fmt.Sprintf("entity field %s is selected %d times, exceeding maximum %d aliases", coordinate, count, limit),
+				errors.WithExtension("field", coordinate),
+				errors.WithExtension("limit", limit),
+				errors.WithExtension("actual", count),
+			)
+		}
+	}
+
+	return nil
+}
+
+// buildSubQuery 为服务构建包含拆分后根字段选择的子查询，字段中没有被拆分的根字段时返回 false
+func (s *entityFetchPlanner) buildSubQuery(fields []string) (string, map[string]interface{}, bool) {
+	split := false
+	seen := make(map[string]bool)
+	var rootFields []string
+	for _, field := range fields {
+		root := strings.Split(field, ".")[0]
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		if selection, ok := s.selections[root]; ok {
+			split = true
+			rootFields = append(rootFields, selection)
+		} else {
+			rootFields = append(rootFields, root)
+		}
+	}
+	if !split {
+		return "", nil, false
+	}
+
+	sort.Strings(rootFields)
+	selection := strings.Join(rootFields, " ")
+	definitions, variables := s.variableDefinitions(selection)
+	if definitions != "" {
+		definitions = "(" + strings.TrimPrefix(definitions, ", ") + ")"
+	}
+
+	return fmt.Sprintf("query%s { %s }", definitions, selection), variables, true
+}
+
+// printField 打印服务内 parentType 类型上的字段及其子选择，子选择中属于其他服务的字段拆分为实体查询
+func (s *entityFetchPlanner) printField(fieldRef int, parentType, returnType string, service *federationtypes.ServiceConfig, path []string) string {
+	head := s.fieldHead(fieldRef)
+	field := s.document.Fields[fieldRef]
+	if !field.HasSelections {
+		return head
+	}
+
+	fieldPath := append(append([]string(nil), path...), s.document.FieldAliasOrNameString(fieldRef))
+	fetchCount := len(s.fetches)
+	printed := head + " { " + s.printSelectionSet(field.SelectionSet, returnType, service, fieldPath) + " }"
+
+	// 子选择产生了实体查询，记录该字段的出现位置
+	if len(s.fetches) > fetchCount {
+		coordinate := parentType + "." + s.document.FieldNameString(fieldRef)
+		if s.entityFields[coordinate] == nil {
+			s.entityFields[coordinate] = make(map[string]bool)
+		}
+		s.entityFields[coordinate][strings.Join(fieldPath, ".")] = true
+	}
+
+	return printed
+}
+
+// printSelectionSet 打印 typeName 类型上的选择集，service 不解析而其他服务可按 @key 解析的字段
+// 移入实体查询，并补充构造表示所需的键字段和 __typename
+func (s *entityFetchPlanner) printSelectionSet(selectionSet int, typeName string, service *federationtypes.ServiceConfig, path []string) string {
+	types := s.planner.schemaTypes(service)
+
+	var owned []string
+	ownedKeys := make(map[string]bool)
+	moved := make(map[string][]int)
+	movedKeys := make(map[string][][]string)
+	var movedOrder []*federationtypes.ServiceConfig
+	var nestedFetches []federationtypes.EntityFetch
+
+	for _, fieldRef := range s.collectFields(selectionSet, typeName, make(map[string]bool)) {
+		if fieldRef < 0 {
+			// 其他类型条件的片段原样保留在当前服务
+			owned = append(owned, s.printFragment(-fieldRef-1))
+			continue
+		}
+
+		fieldName := s.document.FieldNameString(fieldRef)
+		responseKey := s.document.FieldAliasOrNameString(fieldRef)
+
+		if fieldName != "__typename" && types != nil && !types.definesField(typeName, fieldName) {
+			if target, keys := s.entityOwner(typeName, fieldName, service, types); target != nil {
+				if _, exists := moved[target.Name]; !exists {
+					movedOrder = append(movedOrder, target)
+					movedKeys[target.Name] = keys
+				}
+				moved[target.Name] = append(moved[target.Name], fieldRef)
+				continue
+			}
+		}
+
+		returnType := ""
+		if types != nil {
+			returnType = types.fields[typeName][fieldName]
+		}
+
+		fetchCount := len(s.fetches)
+		owned = append(owned, s.printField(fieldRef, typeName, returnType, service, path))
+		// 子字段产生的实体查询依赖本层的实体查询结果，放到本层之后执行
+		nestedFetches = append(nestedFetches, s.fetches[fetchCount:]...)
+		s.fetches = s.fetches[:fetchCount]
+		ownedKeys[responseKey] = true
+	}
+
+	selectKeys := func(keys [][]string) {
+		keySelection := []string{"__typename"}
+		for _, keyFields := range keys {
+			keySelection = append(keySelection, keyFields...)
+		}
+		for _, keyField := range keySelection {
+			if _, selected := ownedKeys[keyField]; !selected {
+				owned = append(owned, keyField)
+				ownedKeys[keyField] = true
+			}
+		}
+	}
+
+	// @requires 声明的字段由当前服务直接选择，或先从第三个服务按实体查询取回，再放入依赖它的表示
+	required := make(map[string][]string)
+	var requiredOrder []string
+	requiredFetches := make(map[string][]string)
+	var requiredFetchOrder []*federationtypes.ServiceConfig
+	for _, target := range movedOrder {
+		targetTypes := s.planner.schemaTypes(target)
+		for _, fieldRef := range moved[target.Name] {
+			for _, field := range targetTypes.requiredFields(typeName, s.document.FieldNameString(fieldRef)) {
+				if containsString(required[target.Name], field) {
+					continue
+				}
+				if len(required[target.Name]) == 0 {
+					requiredOrder = append(requiredOrder, target.Name)
+				}
+				required[target.Name] = append(required[target.Name], field)
+
+				if types != nil && types.definesField(typeName, field) {
+					if _, selected := ownedKeys[field]; !selected {
+						owned = append(owned, field)
+						ownedKeys[field] = true
+					}
+					continue
+				}
+
+				provider, keys := s.requiredFieldProvider(typeName, field, service, target, types)
+				if provider == nil {
+					s.planner.logger.Debug("No provider for required field", "type", typeName, "field", field, "service", target.Name)
+					continue
+				}
+				if _, exists := requiredFetches[provider.Name]; !exists {
+					requiredFetchOrder = append(requiredFetchOrder, provider)
+					movedKeys[provider.Name] = keys
+				}
+				if !containsString(requiredFetches[provider.Name], field) {
+					requiredFetches[provider.Name] = append(requiredFetches[provider.Name], field)
+				}
+			}
+		}
+	}
+
+	// 提供必需字段的实体查询排在依赖它的实体查询之前，结果合并回父级对象后再构造表示
+	for _, provider := range requiredFetchOrder {
+		keys := movedKeys[provider.Name]
+		selectKeys(keys)
+		s.fetches = append(s.fetches, s.buildEntityFetch(provider, typeName, keys, nil, path, strings.Join(requiredFetches[provider.Name], " ")))
+	}
+
+	for _, target := range movedOrder {
+		// 选择当前服务能提供的所有键的字段，执行时按每个对象实际返回的键构造表示
+		targetTypes := s.planner.schemaTypes(target)
+		keys := movedKeys[target.Name]
+		selectKeys(keys)
+
+		fetchCount := len(s.fetches)
+		var entitySelections []string
+		for _, fieldRef := range moved[target.Name] {
+			fieldName := s.document.FieldNameString(fieldRef)
+			entitySelections = append(entitySelections, s.printField(fieldRef, typeName, targetTypes.fields[typeName][fieldName], target, path))
+		}
+		entityNested := append([]federationtypes.EntityFetch(nil), s.fetches[fetchCount:]...)
+		s.fetches = s.fetches[:fetchCount]
+
+		selection := strings.Join(entitySelections, " ")
+		s.fetches = append(s.fetches, s.buildEntityFetch(target, typeName, keys, required[target.Name], path, selection))
+		s.fetches = append(s.fetches, entityNested...)
+	}
+
+	s.fetches = append(s.fetches, nestedFetches...)
+	return strings.Join(owned, " ")
+}
+
+// entityOwner 查找能按 @key 解析该类型字段的其他服务，当前服务必须能提供其中至少一个 @key 的全部字段。
+// 返回该服务及当前服务能提供的 @key
+func (s *entityFetchPlanner) entityOwner(typeName, fieldName string, current *federationtypes.ServiceConfig, currentTypes *serviceTypes) (*federationtypes.ServiceConfig, [][]string) {
+	if currentTypes.fields[typeName] == nil {
+		return nil, nil
+	}
+
+	for i := range s.services {
+		candidate := &s.services[i]
+		if candidate.Name == current.Name || !s.planner.isServiceHealthy(*candidate) {
+			continue
+		}
+
+		types := s.planner.schemaTypes(candidate)
+		if types == nil || !types.definesField(typeName, fieldName) {
+			continue
+		}
+
+		if keys := currentTypes.providedKeys(typeName, types.keys[typeName]); len(keys) > 0 {
+			return candidate, keys
+		}
+	}
+
+	return nil, nil
+}
+
+// requiredFieldProvider 查找能按 @key 解析必需字段的第三个服务，当前服务必须能提供其中至少一个 @key 的全部字段
+func (s *entityFetchPlanner) requiredFieldProvider(typeName, fieldName string, current, dependent *federationtypes.ServiceConfig, currentTypes *serviceTypes) (*federationtypes.ServiceConfig, [][]string) {
+	if currentTypes == nil {
+		return nil, nil
+	}
+
+	for i := range s.services {
+		candidate := &s.services[i]
+		if candidate.Name == current.Name || candidate.Name == dependent.Name || !s.planner.isServiceHealthy(*candidate) {
+			continue
+		}
+
+		types := s.planner.schemaTypes(candidate)
+		if types == nil || !types.definesField(typeName, fieldName) {
+			continue
+		}
+
+		if keys := currentTypes.providedKeys(typeName, types.keys[typeName]); len(keys) > 0 {
+			return candidate, keys
+		}
+	}
+
+	return nil, nil
+}
+
+// containsString 判断字符串列表中是否包含指定值
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFields 展开类型条件匹配的片段，返回字段引用；其他类型条件的内联片段以 -(ref+1) 表示
+func (s *entityFetchPlanner) collectFields(selectionSet int, typeName string, visitedFragments map[string]bool) []int {
+	var refs []int
+
+	for _, selectionRef := range s.document.SelectionSets[selectionSet].SelectionRefs {
+		selection := s.document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			refs = append(refs, selection.Ref)
+
+		case ast.SelectionKindInlineFragment:
+			fragment := s.document.InlineFragments[selection.Ref]
+			condition := s.document.InlineFragmentTypeConditionNameString(selection.Ref)
+			if !fragment.HasSelections {
+				continue
+			}
+			if condition != "" && condition != typeName {
+				refs = append(refs, -selection.Ref-1)
+				continue
+			}
+			refs = append(refs, s.collectFields(fragment.SelectionSet, typeName, visitedFragments)...)
+
+		case ast.SelectionKindFragmentSpread:
+			name := s.document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+			for i := range s.document.FragmentDefinitions {
+				if s.document.FragmentDefinitionNameString(i) == name {
+					refs = append(refs, s.collectFields(s.document.FragmentDefinitions[i].SelectionSet, typeName, visitedFragments)...)
+				}
+			}
+			delete(visitedFragments, name)
+		}
+	}
+
+	return refs
+}
+
+// printFragment 原样打印内联片段
+func (s *entityFetchPlanner) printFragment(inlineFragmentRef int) string {
+	fragment := s.document.InlineFragments[inlineFragmentRef]
+	condition := s.document.InlineFragmentTypeConditionNameString(inlineFragmentRef)
+	return "... on " + condition + " { " + s.printPlain(fragment.SelectionSet, make(map[string]bool)) + " }"
+}
+
+// printPlain 不做拆分地打印选择集，命名片段展开为内联片段
+func (s *entityFetchPlanner) printPlain(selectionSet int, visitedFragments map[string]bool) string {
+	var parts []string
+
+	for _, selectionRef := range s.document.SelectionSets[selectionSet].SelectionRefs {
+		selection := s.document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			printed := s.fieldHead(selection.Ref)
+			if field := s.document.Fields[selection.Ref]; field.HasSelections {
+				printed += " { " + s.printPlain(field.SelectionSet, visitedFragments) + " }"
+			}
+			parts = append(parts, printed)
+
+		case ast.SelectionKindInlineFragment:
+			fragment := s.document.InlineFragments[selection.Ref]
+			if !fragment.HasSelections {
+				continue
+			}
+			printed := "..."
+			if condition := s.document.InlineFragmentTypeConditionNameString(selection.Ref); condition != "" {
+				printed += " on " + condition
+			}
+			parts = append(parts, printed+" { "+s.printPlain(fragment.SelectionSet, visitedFragments)+" }")
+
+		case ast.SelectionKindFragmentSpread:
+			name := s.document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+			for i := range s.document.FragmentDefinitions {
+				if s.document.FragmentDefinitionNameString(i) == name {
+					parts = append(parts, "... on "+s.document.FragmentDefinitionTypeNameString(i)+" { "+
+						s.printPlain(s.document.FragmentDefinitions[i].SelectionSet, visitedFragments)+" }")
+				}
+			}
+			delete(visitedFragments, name)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// fieldHead 打印字段的别名、名称、参数和指令
+func (s *entityFetchPlanner) fieldHead(fieldRef int) string {
+	var builder strings.Builder
+
+	if s.document.FieldAliasIsDefined(fieldRef) {
+		builder.WriteString(s.document.FieldAliasString(fieldRef))
+		builder.WriteString(": ")
+	}
+	builder.WriteString(s.document.FieldNameString(fieldRef))
+
+	field := s.document.Fields[fieldRef]
+	if field.HasArguments {
+		_ = s.document.PrintArguments(field.Arguments.Refs, &builder)
+	}
+	if field.HasDirectives {
+		for _, directiveRef := range field.Directives.Refs {
+			builder.WriteString(" ")
+			_ = s.document.PrintDirective(directiveRef, &builder)
+		}
+	}
+
+	return builder.String()
+}
+
+// buildEntityFetch 构建 _entities 实体查询，required 为随键字段一起放入表示的 @requires 字段
+func (s *entityFetchPlanner) buildEntityFetch(service *federationtypes.ServiceConfig, typeName string, keys [][]string, required []string, path []string, selection string) federationtypes.EntityFetch {
+	definitions, variables := s.variableDefinitions(selection)
+
+	timeout := service.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second // 默认超时时间
+	}
+
+	return federationtypes.EntityFetch{
+		ServiceName:    service.Name,
+		TypeName:       typeName,
+		Path:           append([]string(nil), path...),
+		KeyFields:      keys[0],
+		AlternateKeys:  keys[1:],
+		RequiredFields: required,
+		Query: fmt.Sprintf("query($representations: [_Any!]!%s) { _entities(representations: $representations) { ... on %s { %s } } }",
+			definitions, typeName, selection),
+		Variables: variables,
+		Timeout:   timeout,
+	}
+}
+
+// variableDefinitions 返回选择文本中引用的操作变量的定义及其取值
+func (s *entityFetchPlanner) variableDefinitions(selection string) (string, map[string]interface{}) {
+	operation := s.document.OperationDefinitions[s.operationRef]
+	if !operation.HasVariableDefinitions {
+		return "", nil
+	}
+
+	var definitions strings.Builder
+	variables := make(map[string]interface{})
+	for _, definitionRef := range operation.VariableDefinitions.Refs {
+		name := s.document.VariableDefinitionNameString(definitionRef)
+		if !referencesVariable(selection, name) {
+			continue
+		}
+
+		definitions.WriteString(", $" + name + ": ")
+		_ = s.document.PrintType(s.document.VariableDefinitions[definitionRef].Type, &definitions)
+		if s.document.VariableDefinitionHasDefaultValue(definitionRef) {
+			definitions.WriteString(" = ")
+			_ = s.document.PrintValue(s.document.VariableDefinitionDefaultValue(definitionRef), &definitions)
+		}
+		if value, ok := s.variables[name]; ok {
+			variables[name] = value
+		}
+	}
+
+	return definitions.String(), variables
+}
+
+// referencesVariable 判断文本中是否引用了完整的变量名
+func referencesVariable(text, name string) bool {
+	token := "$" + name
+	for start := 0; ; {
+		index := strings.Index(text[start:], token)
+		if index == -1 {
+			return false
+		}
+		end := start + index + len(token)
+		if end == len(text) || !isNameChar(text[end]) {
+			return true
+		}
+		start = end
+	}
+}
+
+// findOperationRef 查找要执行的操作，未指定名称时取第一个操作
+func findOperationRef(document *ast.Document, operationName string) int {
+	for i := range document.OperationDefinitions {
+		if operationName == "" || document.OperationDefinitionNameString(i) == operationName {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,93 @@
+package planner
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// fieldGroup 同一服务内一起查询的字段，budget 非空时为按超时预算拆出的根字段
+type fieldGroup struct {
+	fields []string
+	budget *federationtypes.FieldBudget
+}
+
+// fieldBudgets 按配置收集查询操作中有超时预算的根字段，键为字段名。
+// 子查询按根字段拆分，嵌套字段无法单独限时；变更按顺序语义执行，不做拆分
+func (p *Planner) fieldBudgets(query *federationtypes.ParsedQuery) map[string]*federationtypes.FieldBudget {
+	if len(p.config.FieldTimeouts) == 0 {
+		return nil
+	}
+
+	document, ok := query.AST.(*ast.Document)
+	if !ok {
+		return nil
+	}
+
+	operationRef := findOperationRef(document, query.Operation)
+	if operationRef == -1 || document.OperationDefinitions[operationRef].OperationType != ast.OperationTypeQuery {
+		return nil
+	}
+
+	budgets := make(map[string]*federationtypes.FieldBudget)
+	operation := document.OperationDefinitions[operationRef]
+	for _, selectionRef := range document.SelectionSets[operation.SelectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+		if selection.Kind != ast.SelectionKindField {
+			continue
+		}
+
+		name := document.FieldNameString(selection.Ref)
+		coordinate := "Query." + name
+		timeout, ok := p.config.FieldTimeouts[coordinate]
+		if !ok || timeout <= 0 {
+			continue
+		}
+
+		budget, exists := budgets[name]
+		if !exists {
+			budget = &federationtypes.FieldBudget{Field: coordinate, Timeout: timeout}
+			budgets[name] = budget
+		}
+		budget.ResponseKeys = append(budget.ResponseKeys, document.FieldAliasOrNameString(selection.Ref))
+	}
+
+	return budgets
+}
+
+// splitFieldsByBudget 将服务的字段路径按根字段分组，有预算的根字段各自成组，其余字段合为一组
+func splitFieldsByBudget(fields []string, budgets map[string]*federationtypes.FieldBudget) []fieldGroup {
+	if len(budgets) == 0 {
+		return []fieldGroup{{fields: fields}}
+	}
+
+	var rest []string
+	budgeted := make(map[string][]string)
+	for _, field := range fields {
+		root := strings.Split(field, ".")[0]
+		if _, ok := budgets[root]; ok {
+			budgeted[root] = append(budgeted[root], field)
+			continue
+		}
+		rest = append(rest, field)
+	}
+
+	var groups []fieldGroup
+	if len(rest) > 0 {
+		groups = append(groups, fieldGroup{fields: rest})
+	}
+
+	roots := make([]string, 0, len(budgeted))
+	for root := range budgeted {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		groups = append(groups, fieldGroup{fields: budgeted[root], budget: budgets[root]})
+	}
+
+	return groups
+}
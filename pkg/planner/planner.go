@@ -2,11 +2,17 @@ package planner
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
 
 	"envoy-wasm-graphql-federation/pkg/errors"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
@@ -15,18 +21,116 @@ import (
 // Planner 实现查询规划器
 type Planner struct {
 	logger            federationtypes.Logger
+	config            *PlannerConfig
 	federationPlanner federationtypes.FederationPlanner
+
+	// 按模式文本缓存的服务类型信息，用于拆分跨服务的子选择
+	schemaCache map[string]*serviceTypes
+	schemaMutex sync.Mutex
+}
+
+// PlannerConfig 规划器配置
+type PlannerConfig struct {
+	StrictFieldRouting     bool                     // 无法路由的字段直接报错，而不是回退到第一个服务
+	VariableConflictPolicy VariableConflictPolicy   // 合并子查询时同名变量冲突的处理策略
+	Batching               BatchingSettings         // 批处理相似度参数，零值使用默认值
+	FieldTimeouts          map[string]time.Duration // 根字段超时预算，键为 Query.field，命中的字段拆为独立子查询
+	MaxEntityFieldAliases  int                      // 同一个触发实体查询的字段最多出现的次数，0 表示不限制
+
+	SkipUnhealthyServices bool                                             // 字段映射时排除不健康的服务
+	ServiceHealth         func(service federationtypes.ServiceConfig) bool // 服务健康检查，为空时视为全部健康
+
+	ElideTypenameOnlyFetches bool // 省略只选择 __typename 的子查询和实体查询，由引擎本地填充
+
+	UndefinedFieldPolicy UndefinedFieldPolicy // 子查询选择了目标服务模式未定义的字段时的处理，为空等同 ignore
 }
 
+// VariableConflictPolicy 同名变量取值冲突的处理策略
+type VariableConflictPolicy string
+
+const (
+	VariableConflictNamespace VariableConflictPolicy = "namespace" // 重命名冲突变量，如 $id_0、$id_1
+	VariableConflictRefuse    VariableConflictPolicy = "refuse"    // 存在冲突时不合并
+)
+
 // NewPlanner 创建新的查询规划器
 func NewPlanner(logger federationtypes.Logger) federationtypes.QueryPlanner {
+	return NewPlannerWithConfig(nil, logger)
+}
+
+// NewPlannerWithConfig 使用配置创建查询规划器
+func NewPlannerWithConfig(config *PlannerConfig, logger federationtypes.Logger) federationtypes.QueryPlanner {
+	if config == nil {
+		config = DefaultPlannerConfig()
+	}
+	if config.Batching == (BatchingSettings{}) {
+		withDefaults := *config
+		withDefaults.Batching = *DefaultBatchingConfig()
+		config = &withDefaults
+	}
+
 	return &Planner{
 		logger: logger,
+		config: config,
 		// 这里不创建 federationPlanner 防止循环依赖
 		// federationPlanner: federation.NewFederatedPlanner(logger),
 	}
 }
 
+// DefaultPlannerConfig 返回默认配置
+func DefaultPlannerConfig() *PlannerConfig {
+	return &PlannerConfig{
+		StrictFieldRouting:     false,
+		VariableConflictPolicy: VariableConflictNamespace,
+		Batching:               *DefaultBatchingConfig(),
+	}
+}
+
+// BatchingSettings 规划器使用的批处理相似度参数，各字段含义见 federationtypes.BatchingConfig
+type BatchingSettings struct {
+	MaxComplexity       int
+	MinVariableRatio    float64
+	FieldOverlapWeight  float64
+	VariableWeight      float64
+	SimilarityThreshold float64
+}
+
+// DefaultBatchingConfig 返回默认批处理相似度配置。
+// 默认权重下，字段完全不重叠但变量数相同的查询仍可合并，变量数差异较大时需要有字段重叠
+func DefaultBatchingConfig() *BatchingSettings {
+	return &BatchingSettings{
+		MaxComplexity:       10,
+		MinVariableRatio:    0.5,
+		FieldOverlapWeight:  0.5,
+		VariableWeight:      0.5,
+		SimilarityThreshold: 0.5,
+	}
+}
+
+// MergeBatchingConfig 将配置中设置的字段覆盖到默认批处理参数上，config 为空时返回默认值
+func MergeBatchingConfig(config *federationtypes.BatchingConfig) BatchingSettings {
+	settings := *DefaultBatchingConfig()
+	if config == nil {
+		return settings
+	}
+	if config.MaxComplexity != nil {
+		settings.MaxComplexity = *config.MaxComplexity
+	}
+	if config.MinVariableRatio != nil {
+		settings.MinVariableRatio = *config.MinVariableRatio
+	}
+	if config.FieldOverlapWeight != nil {
+		settings.FieldOverlapWeight = *config.FieldOverlapWeight
+	}
+	if config.VariableWeight != nil {
+		settings.VariableWeight = *config.VariableWeight
+	}
+	if config.SimilarityThreshold != nil {
+		settings.SimilarityThreshold = *config.SimilarityThreshold
+	}
+	return settings
+}
+
 // CreateExecutionPlan 创建执行计划
 func (p *Planner) CreateExecutionPlan(ctx context.Context, query *federationtypes.ParsedQuery, services []federationtypes.ServiceConfig) (*federationtypes.ExecutionPlan, error) {
 	if query == nil {
@@ -34,7 +138,7 @@ func (p *Planner) CreateExecutionPlan(ctx context.Context, query *federationtype
 	}
 
 	if len(services) == 0 {
-		return nil, errors.NewPlanningError("no services available")
+		return nil, errors.NewPlanningError("no services available", errors.WithExtension("reason", "NO_SERVICES"))
 	}
 
 	p.logger.Info("Creating execution plan",
@@ -43,6 +147,15 @@ func (p *Planner) CreateExecutionPlan(ctx context.Context, query *federationtype
 		"complexity", query.Complexity,
 	)
 
+	if err := checkPlanningDeadline(ctx, "field mapping"); err != nil {
+		return nil, err
+	}
+
+	// 所有根字段属于同一服务时直接转发原始查询，跳过映射、依赖分析和子查询重建
+	if plan, err := p.planSingleService(query, services); err != nil || plan != nil {
+		return plan, err
+	}
+
 	// 提取字段路径
 	fieldPaths, err := p.extractFieldPaths(query)
 	if err != nil {
@@ -50,18 +163,60 @@ func (p *Planner) CreateExecutionPlan(ctx context.Context, query *federationtype
 	}
 
 	// 分析字段和服务映射
-	fieldMappings := p.analyzeFieldMappings(fieldPaths, services)
+	fieldMappings, err := p.analyzeFieldMappings(fieldPaths, services)
+	if err != nil {
+		return nil, err
+	}
 
 	// 构建依赖关系图
-	dependencies := p.buildDependencyGraph(fieldMappings)
+	dependencies, err := p.buildDependencyGraph(ctx, fieldMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPlanningDeadline(ctx, "sub-query generation"); err != nil {
+		return nil, err
+	}
+
+	// 子选择属于其他服务的根字段拆分为按 @key 关联的实体查询
+	entityFetches, err := p.planEntityFetches(query, fieldMappings, services)
+	if err != nil {
+		return nil, err
+	}
 
 	// 生成子查询
-	subQueries, err := p.generateSubQueries(query, fieldMappings, services)
+	subQueries, err := p.generateSubQueries(query, fieldMappings, services, entityFetches)
 	if err != nil {
 		return nil, errors.NewPlanningError("failed to generate sub-queries: " + err.Error())
 	}
 
 	// 确定合并策略
+	var fetches []federationtypes.EntityFetch
+	if entityFetches != nil {
+		fetches = entityFetches.fetches
+	}
+
+	// 字段拆分后只剩 __typename 的调用不发往子图
+	elided := 0
+	if p.config.ElideTypenameOnlyFetches {
+		subQueries, fetches, elided = p.elideTypenameOnly(subQueries, fetches)
+	}
+
+	// 按服务名推断的依赖可能指向本次查询不涉及或已被省略的服务，只保留计划中有子查询的服务；
+	// 跨服务实体的关联由 EntityFetches 在子查询之后执行
+	dependencies = pruneDependencies(dependencies, subQueries)
+
+	// 按目标服务的模式删除其未定义的字段，保证子查询对目标服务有效
+	pruned, err := p.pruneUndefinedFields(subQueries, fetches, services)
+	if err != nil {
+		return nil, err
+	}
+
+	// 具体类型位置的 __typename 由引擎本地填充，构造实体表示需要子图返回的值时保留
+	if len(fetches) == 0 {
+		p.elideStaticTypenames(subQueries, services)
+	}
+
 	mergeStrategy := p.determineMergeStrategy(subQueries)
 
 	plan := &federationtypes.ExecutionPlan{
@@ -75,18 +230,96 @@ func (p *Planner) CreateExecutionPlan(ctx context.Context, query *federationtype
 			"planComplexity": p.calculatePlanComplexity(subQueries),
 		},
 	}
+	plan.EntityFetches = fetches
+	if elided > 0 {
+		plan.Metadata[ElidedTypenameMetadataKey] = elided
+	}
+	if len(pruned) > 0 {
+		plan.Metadata[PrunedFieldsMetadataKey] = pruned
+	}
+	setRootKeys(plan.SubQueries)
+	plan.Metadata[PlanHashMetadataKey] = PlanHash(plan)
 
 	p.logger.Info("Execution plan created",
 		"subQueries", len(subQueries),
 		"dependencies", len(dependencies),
 		"mergeStrategy", mergeStrategy,
+		"entityFetches", len(plan.EntityFetches),
 	)
 
 	return plan, nil
 }
 
+// PlanHashMetadataKey 执行计划元数据中保存计划哈希的键，引擎在完成日志和调试模式的 extensions 中输出该哈希
+const PlanHashMetadataKey = "planHash"
+
+// FederationPlanMetadataKey 执行计划元数据中标记依赖来自 @requires 分析的键，
+// 这类计划的子查询按依赖分批执行
+const FederationPlanMetadataKey = "federationPlan"
+
+// PlanHash 计算执行计划的稳定内容哈希，覆盖子查询、路由、依赖关系和实体查询。
+// 变量只计入名称而不计入取值，所有映射按键排序后再参与计算，保证结果与遍历顺序无关
+func PlanHash(plan *federationtypes.ExecutionPlan) string {
+	if plan == nil {
+		return ""
+	}
+
+	subQueries := make([]string, 0, len(plan.SubQueries))
+	for _, subQuery := range plan.SubQueries {
+		variableNames := make([]string, 0, len(subQuery.Variables))
+		for name := range subQuery.Variables {
+			variableNames = append(variableNames, name)
+		}
+		sort.Strings(variableNames)
+
+		entry := strings.Join([]string{
+			subQuery.ServiceName,
+			subQuery.OperationName,
+			strings.Join(subQuery.Path, "."),
+			strings.Join(variableNames, ","),
+			subQuery.Query,
+		}, "\x1f")
+		if subQuery.FieldBudget != nil {
+			entry += "\x1fbudget=" + subQuery.FieldBudget.Timeout.String()
+		}
+		subQueries = append(subQueries, entry)
+	}
+	sort.Strings(subQueries)
+
+	services := make([]string, 0, len(plan.Dependencies))
+	for service := range plan.Dependencies {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	hasher := sha256.New()
+	hasher.Write([]byte(string(plan.MergeStrategy)))
+	for _, subQuery := range subQueries {
+		hasher.Write([]byte("\x1esub\x1f" + subQuery))
+	}
+	for _, service := range services {
+		dependencies := append([]string(nil), plan.Dependencies[service]...)
+		sort.Strings(dependencies)
+		hasher.Write([]byte("\x1edep\x1f" + service + "\x1f" + strings.Join(dependencies, ",")))
+	}
+	// 实体查询按执行顺序计入
+	for _, fetch := range plan.EntityFetches {
+		hasher.Write([]byte("\x1eentity\x1f" + strings.Join([]string{
+			fetch.ServiceName,
+			fetch.TypeName,
+			strings.Join(fetch.Path, "."),
+			strings.Join(fetch.KeyFields, ","),
+			fmt.Sprint(fetch.AlternateKeys),
+			strings.Join(fetch.RequiredFields, ","),
+			fetch.Query,
+		}, "\x1f")))
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))[:16]
+}
+
 // OptimizePlan 优化执行计划
-func (p *Planner) OptimizePlan(plan *federationtypes.ExecutionPlan) (*federationtypes.ExecutionPlan, error) {
+func (p *Planner) OptimizePlan(ctx context.Context, plan *federationtypes.ExecutionPlan) (*federationtypes.ExecutionPlan, error) {
 	if plan == nil {
 		return nil, errors.NewPlanningError("plan is nil")
 	}
@@ -98,6 +331,7 @@ func (p *Planner) OptimizePlan(plan *federationtypes.ExecutionPlan) (*federation
 		Dependencies:  make(map[string][]string),
 		MergeStrategy: plan.MergeStrategy,
 		Metadata:      make(map[string]interface{}),
+		EntityFetches: plan.EntityFetches,
 	}
 
 	// 复制原始计划
@@ -116,13 +350,19 @@ func (p *Planner) OptimizePlan(plan *federationtypes.ExecutionPlan) (*federation
 	optimizedPlan.SubQueries = p.optimizeQueryOrder(optimizedPlan.SubQueries, optimizedPlan.Dependencies)
 
 	// 批处理优化
-	optimizedPlan.SubQueries = p.optimizeBatching(optimizedPlan.SubQueries)
+	batched, err := p.optimizeBatching(ctx, optimizedPlan.SubQueries)
+	if err != nil {
+		return nil, err
+	}
+	optimizedPlan.SubQueries = batched
+	setRootKeys(optimizedPlan.SubQueries)
 
 	// 更新元数据
 	optimizedPlan.Metadata["optimized"] = true
 	optimizedPlan.Metadata["optimizedAt"] = time.Now()
 	optimizedPlan.Metadata["originalSubQueries"] = len(plan.SubQueries)
 	optimizedPlan.Metadata["optimizedSubQueries"] = len(optimizedPlan.SubQueries)
+	optimizedPlan.Metadata[PlanHashMetadataKey] = PlanHash(optimizedPlan)
 
 	p.logger.Debug("Plan optimization completed",
 		"originalQueries", len(plan.SubQueries),
@@ -140,7 +380,7 @@ func (p *Planner) ValidatePlan(plan *federationtypes.ExecutionPlan) error {
 
 	// 检查基本有效性
 	if len(plan.SubQueries) == 0 {
-		return errors.NewPlanningError("plan has no sub-queries")
+		return errors.NewPlanningError("plan has no sub-queries", errors.WithExtension("reason", "EMPTY_PLAN"))
 	}
 
 	// 验证子查询
@@ -227,6 +467,11 @@ func (p *Planner) extractFieldsFromSelectionSetWithVisited(document *ast.Documen
 			field := document.Fields[selection.Ref]
 			fieldName := document.FieldNameString(selection.Ref)
 
+			// 根类型的 __typename 静态已知，由引擎本地填充，不路由到子图
+			if fieldName == "__typename" && len(currentPath) == 0 {
+				continue
+			}
+
 			newPath := append(currentPath, fieldName)
 			fieldType := p.getFieldType(document, field)
 
@@ -255,7 +500,7 @@ func (p *Planner) extractFieldsFromSelectionSetWithVisited(document *ast.Documen
 }
 
 // analyzeFieldMappings 分析字段和服务映射
-func (p *Planner) analyzeFieldMappings(fieldPaths []federationtypes.FieldPath, services []federationtypes.ServiceConfig) map[string][]string {
+func (p *Planner) analyzeFieldMappings(fieldPaths []federationtypes.FieldPath, services []federationtypes.ServiceConfig) (map[string][]string, error) {
 	fieldMappings := make(map[string][]string)
 
 	for _, fieldPath := range fieldPaths {
@@ -263,19 +508,70 @@ func (p *Planner) analyzeFieldMappings(fieldPaths []federationtypes.FieldPath, s
 
 		// 简化映射逻辑：根据字段名称推断服务
 		// 在实际实现中，这里应该基于联邦模式进行映射
+		var unhealthyOwners []string
 		for _, service := range services {
-			if p.fieldBelongsToService(fieldPath, service) {
-				fieldMappings[pathKey] = append(fieldMappings[pathKey], service.Name)
+			if !p.fieldBelongsToService(fieldPath, service) {
+				continue
 			}
+			if !p.isServiceHealthy(service) {
+				unhealthyOwners = append(unhealthyOwners, service.Name)
+				continue
+			}
+			fieldMappings[pathKey] = append(fieldMappings[pathKey], service.Name)
 		}
 
-		// 如果没有找到服务，分配给第一个服务（回退策略）
-		if len(fieldMappings[pathKey]) == 0 && len(services) > 0 {
-			fieldMappings[pathKey] = []string{services[0].Name}
+		if len(fieldMappings[pathKey]) > 0 {
+			continue
 		}
+
+		// 所有拥有该字段的服务都不健康时不再回退，避免规划注定失败的调用
+		if len(unhealthyOwners) > 0 {
+			return nil, errors.NewPlanningError(
+				fmt.Sprintf("field %s is only owned by unhealthy services: %s", pathKey, strings.Join(unhealthyOwners, ", ")),
+				errors.WithPath(toErrorPath(fieldPath.Path)...),
+				errors.WithExtension("reason", "UNHEALTHY_OWNERS"),
+				errors.WithExtension("field", pathKey),
+				errors.WithExtension("unhealthyServices", unhealthyOwners),
+			)
+		}
+
+		// 严格模式下不允许回退，直接报告无法路由的字段
+		if p.config.StrictFieldRouting {
+			return nil, errors.NewPlanningError(
+				fmt.Sprintf("no service owns field %s", pathKey),
+				errors.WithPath(toErrorPath(fieldPath.Path)...),
+				errors.WithExtension("reason", "UNROUTABLE_FIELD"),
+				errors.WithExtension("field", pathKey),
+			)
+		}
+
+		// 如果没有找到服务，分配给第一个健康的服务（回退策略）
+		for _, service := range services {
+			if p.isServiceHealthy(service) {
+				fieldMappings[pathKey] = []string{service.Name}
+				break
+			}
+		}
+	}
+
+	return fieldMappings, nil
+}
+
+// isServiceHealthy 判断服务是否参与字段映射，未开启 SkipUnhealthyServices 时始终参与
+func (p *Planner) isServiceHealthy(service federationtypes.ServiceConfig) bool {
+	if !p.config.SkipUnhealthyServices || p.config.ServiceHealth == nil {
+		return true
 	}
+	return p.config.ServiceHealth(service)
+}
 
-	return fieldMappings
+// toErrorPath 将字段路径转换为错误路径
+func toErrorPath(path []string) []interface{} {
+	result := make([]interface{}, len(path))
+	for i, segment := range path {
+		result[i] = segment
+	}
+	return result
 }
 
 // fieldBelongsToService 判断字段是否属于服务（基于模式分析）
@@ -314,7 +610,10 @@ func (p *Planner) fieldBelongsToService(fieldPath federationtypes.FieldPath, ser
 		}
 	}
 
-	// 3. 基于模式分析（如果有可用的模式信息）
+	// 3. 基于模式分析（如果有可用的模式信息），按模式声明的根类型名查找根字段
+	if types := p.schemaTypes(&service); types != nil {
+		return types.definesRootField(rootField)
+	}
 	if service.Schema != "" {
 		return p.fieldExistsInSchema(rootField, service.Schema)
 	}
@@ -396,11 +695,15 @@ func (p *Planner) mapFieldToService(fieldName, serviceName string) bool {
 }
 
 // buildDependencyGraph 构建依赖关系图
-func (p *Planner) buildDependencyGraph(fieldMappings map[string][]string) map[string][]string {
+func (p *Planner) buildDependencyGraph(ctx context.Context, fieldMappings map[string][]string) (map[string][]string, error) {
 	dependencies := make(map[string][]string)
 
 	// 基于联邦规范分析字段依赖
 	for fieldPath, services := range fieldMappings {
+		if err := checkPlanningDeadline(ctx, "dependency analysis"); err != nil {
+			return nil, err
+		}
+
 		for _, service := range services {
 			// 根据字段路径分析依赖
 			serviceDeps := p.analyzeServiceDependencies(service, fieldPath, fieldMappings)
@@ -415,7 +718,7 @@ func (p *Planner) buildDependencyGraph(fieldMappings map[string][]string) map[st
 		dependencies[service] = p.uniqueAndFilterDependencies(deps, service)
 	}
 
-	return dependencies
+	return dependencies, nil
 }
 
 // findServiceDependencies 查找服务依赖
@@ -464,7 +767,8 @@ func (p *Planner) findServiceDependencies(service string, fieldMappings map[stri
 	}
 
 	// 查找匹配的依赖规则
-	for servicePattern, dependencies := range dependencyRules {
+	for _, servicePattern := range sortedPatterns(dependencyRules) {
+		dependencies := dependencyRules[servicePattern]
 		if strings.Contains(serviceLower, servicePattern) {
 			// 验证依赖服务是否存在于字段映射中
 			for _, dep := range dependencies {
@@ -546,7 +850,8 @@ func (p *Planner) findRelatedServiceForField(fieldName string, fieldMappings map
 	}
 
 	fieldLower := strings.ToLower(fieldName)
-	for pattern, possibleServices := range fieldToServiceMap {
+	for _, pattern := range sortedPatterns(fieldToServiceMap) {
+		possibleServices := fieldToServiceMap[pattern]
 		if strings.Contains(fieldLower, pattern) {
 			// 查找在字段映射中存在的服务
 			for _, possibleService := range possibleServices {
@@ -561,7 +866,7 @@ func (p *Planner) findRelatedServiceForField(fieldName string, fieldMappings map
 }
 
 // generateSubQueries 生成子查询
-func (p *Planner) generateSubQueries(query *federationtypes.ParsedQuery, fieldMappings map[string][]string, services []federationtypes.ServiceConfig) ([]federationtypes.SubQuery, error) {
+func (p *Planner) generateSubQueries(query *federationtypes.ParsedQuery, fieldMappings map[string][]string, services []federationtypes.ServiceConfig, entityFetches *entityFetchPlanner) ([]federationtypes.SubQuery, error) {
 	serviceQueries := make(map[string][]string)
 
 	// 按服务分组字段
@@ -572,33 +877,54 @@ func (p *Planner) generateSubQueries(query *federationtypes.ParsedQuery, fieldMa
 	}
 
 	var subQueries []federationtypes.SubQuery
+	budgets := p.fieldBudgets(query)
 
-	// 为每个服务生成子查询
+	// 为每个服务生成子查询，有超时预算的根字段单独成为子查询
 	for serviceName, fields := range serviceQueries {
 		service := p.findServiceByName(serviceName, services)
 		if service == nil {
 			continue
 		}
 
-		// 设置超时值，优先使用服务配置，否则使用默认值
-		timeout := service.Timeout
-		if timeout <= 0 {
-			timeout = 30 * time.Second // 默认超时时间
+		for _, group := range splitFieldsByBudget(fields, budgets) {
+			subQuery := p.newSubQuery(service, group.fields, query, entityFetches)
+			if group.budget != nil {
+				subQuery.Timeout = group.budget.Timeout
+				subQuery.FieldBudget = group.budget
+			}
+			subQueries = append(subQueries, subQuery)
 		}
+	}
 
-		subQuery := federationtypes.SubQuery{
-			ServiceName: serviceName,
-			Query:       p.buildSubQuery(fields, query),
-			Variables:   query.Variables,
-			Path:        []string{serviceName},
-			Timeout:     timeout,
-			RetryCount:  3, // 默认重试次数
-		}
+	return subQueries, nil
+}
 
-		subQueries = append(subQueries, subQuery)
+// newSubQuery 为服务的一组字段构建子查询
+func (p *Planner) newSubQuery(service *federationtypes.ServiceConfig, fields []string, query *federationtypes.ParsedQuery, entityFetches *entityFetchPlanner) federationtypes.SubQuery {
+	// 设置超时值，优先使用服务配置，否则使用默认值
+	timeout := service.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second // 默认超时时间
 	}
 
-	return subQueries, nil
+	subQuery := federationtypes.SubQuery{
+		ServiceName: service.Name,
+		Query:       p.buildSubQuery(fields, query),
+		Variables:   query.Variables,
+		Path:        []string{service.Name},
+		Timeout:     timeout,
+		RetryCount:  service.MaxRetries, // 未配置时不重试
+	}
+
+	// 被拆分的根字段只选择本服务解析的子字段及键字段
+	if entityFetches != nil {
+		if splitQuery, variables, ok := entityFetches.buildSubQuery(fields); ok {
+			subQuery.Query = splitQuery
+			subQuery.Variables = variables
+		}
+	}
+
+	return subQuery
 }
 
 // buildSubQuery 构建子查询（基于AST）
@@ -775,17 +1101,24 @@ func (p *Planner) determineMergeStrategy(subQueries []federationtypes.SubQuery)
 func (p *Planner) mergeQueriesForSameService(subQueries []federationtypes.SubQuery) []federationtypes.SubQuery {
 	serviceGroups := make(map[string][]federationtypes.SubQuery)
 
-	// 按服务分组
+	var optimized []federationtypes.SubQuery
+
+	// 按服务分组，按字段预算拆出的子查询保持独立
 	for _, subQuery := range subQueries {
+		if subQuery.FieldBudget != nil {
+			optimized = append(optimized, subQuery)
+			continue
+		}
 		serviceGroups[subQuery.ServiceName] = append(serviceGroups[subQuery.ServiceName], subQuery)
 	}
 
-	var optimized []federationtypes.SubQuery
-
 	// 合并每个服务的查询
 	for _, queries := range serviceGroups {
 		if len(queries) == 1 {
 			optimized = append(optimized, queries[0])
+		} else if !p.canMergeVariables(queries) {
+			// 变量取值冲突且不允许重命名，保持原样
+			optimized = append(optimized, queries...)
 		} else {
 			merged := p.mergeQueries(queries)
 			optimized = append(optimized, merged)
@@ -805,17 +1138,14 @@ func (p *Planner) mergeQueries(queries []federationtypes.SubQuery) federationtyp
 		return queries[0]
 	}
 
+	// 重命名取值冲突的同名变量
+	queries = p.namespaceConflictingVariables(queries)
+
 	// 使用第一个查询作为基础
 	merged := queries[0]
 
 	// 合并变量
-	allVariables := make(map[string]interface{})
-	for _, query := range queries {
-		for k, v := range query.Variables {
-			allVariables[k] = v
-		}
-	}
-	merged.Variables = allVariables
+	merged.Variables = p.mergeVariables(queries)
 
 	// 合并查询字符串
 	merged.Query = p.mergeQueryStrings(queries)
@@ -829,94 +1159,282 @@ func (p *Planner) mergeQueries(queries []federationtypes.SubQuery) federationtyp
 	return merged
 }
 
-// mergeQueryStrings 合并查询字符串
+// mergeQueryStrings 合并查询字符串，保留各查询的变量定义和顶层选择集
 func (p *Planner) mergeQueryStrings(queries []federationtypes.SubQuery) string {
 	if len(queries) == 0 {
 		return ""
 	}
 
-	// 提取所有查询中的字段
-	fields := make(map[string]bool)
 	var queryType string
+	var definitions, selections []string
+	seenDefinitions := make(map[string]bool)
+	seenSelections := make(map[string]bool)
 
 	for _, query := range queries {
-		// 简化解析：提取大括号内的内容
-		queryContent := p.extractQueryContent(query.Query)
-		if queryContent != "" {
-			queryFields := p.parseQueryFields(queryContent)
-			for _, field := range queryFields {
-				fields[field] = true
-			}
-		}
-
 		// 确定查询类型
 		if queryType == "" {
 			queryType = p.extractQueryType(query.Query)
 		}
+
+		for _, definition := range p.extractVariableDefinitions(query.Query) {
+			name := strings.TrimSpace(strings.SplitN(definition, ":", 2)[0])
+			if !seenDefinitions[name] {
+				seenDefinitions[name] = true
+				definitions = append(definitions, definition)
+			}
+		}
+
+		content := p.extractQueryContent(query.Query)
+		if content != "" && !seenSelections[content] {
+			seenSelections[content] = true
+			selections = append(selections, content)
+		}
 	}
 
 	// 构建合并后的查询
-	if len(fields) == 0 {
+	if len(selections) == 0 {
 		return queries[0].Query
 	}
 
-	var fieldList []string
-	for field := range fields {
-		fieldList = append(fieldList, field)
-	}
-
 	if queryType == "" {
 		queryType = "query"
 	}
 
-	return fmt.Sprintf("%s { %s }", queryType, strings.Join(fieldList, " "))
+	if len(definitions) > 0 {
+		return fmt.Sprintf("%s(%s) { %s }", queryType, strings.Join(definitions, ", "), strings.Join(selections, " "))
+	}
+
+	return fmt.Sprintf("%s { %s }", queryType, strings.Join(selections, " "))
 }
 
-// extractQueryContent 提取查询内容
-func (p *Planner) extractQueryContent(query string) string {
-	start := strings.Index(query, "{")
-	end := strings.LastIndex(query, "}")
+// extractVariableDefinitions 提取操作头部的变量定义，例如 "$id: ID!"
+func (p *Planner) extractVariableDefinitions(query string) []string {
+	header := query
+	if idx := strings.Index(query, "{"); idx != -1 {
+		header = query[:idx]
+	}
 
-	if start == -1 || end == -1 || start >= end {
-		return ""
+	start := strings.Index(header, "(")
+	end := strings.LastIndex(header, ")")
+	if start == -1 || end <= start {
+		return nil
 	}
 
-	return strings.TrimSpace(query[start+1 : end])
+	// 变量定义以 $ 开头，默认值为常量不会包含 $
+	var definitions []string
+	for _, part := range strings.Split(header[start+1:end], "$")[1:] {
+		definition := strings.TrimRight(strings.TrimSpace(part), ", ")
+		if definition != "" {
+			definitions = append(definitions, "$"+definition)
+		}
+	}
+
+	return definitions
 }
 
-// parseQueryFields 解析查询字段
-func (p *Planner) parseQueryFields(content string) []string {
-	var fields []string
+// findVariableConflicts 查找同名但取值不同的变量
+func (p *Planner) findVariableConflicts(queries []federationtypes.SubQuery) map[string]bool {
+	conflicts := make(map[string]bool)
+	values := make(map[string]interface{})
 
-	// 简化解析：按空格和换行分割
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "#") {
-			// 提取字段名（去除参数和子字段）
-			fieldName := p.extractFieldName(line)
-			if fieldName != "" {
-				fields = append(fields, fieldName)
+	for _, query := range queries {
+		for name, value := range query.Variables {
+			if existing, ok := values[name]; ok {
+				if !reflect.DeepEqual(existing, value) {
+					conflicts[name] = true
+				}
+				continue
 			}
+			values[name] = value
 		}
 	}
 
-	return fields
+	return conflicts
 }
 
-// extractFieldName 提取字段名
-func (p *Planner) extractFieldName(line string) string {
-	// 移除参数
-	if idx := strings.Index(line, "("); idx != -1 {
-		line = line[:idx]
+// canMergeVariables 判断变量是否允许合并。重命名只区分变量，不区分响应键：多个查询选择同名根字段时
+// 合并后同一响应键带有不同参数，不是合法的查询，合并后的结果也无法按查询拆回，此时始终不合并
+func (p *Planner) canMergeVariables(queries []federationtypes.SubQuery) bool {
+	conflicts := p.findVariableConflicts(queries)
+	if len(conflicts) == 0 {
+		return true
 	}
 
-	// 移除子字段
-	if idx := strings.Index(line, "{"); idx != -1 {
-		line = line[:idx]
+	if p.config.VariableConflictPolicy == VariableConflictRefuse {
+		p.logger.Debug("Refusing to merge queries with conflicting variables",
+			"service", queries[0].ServiceName,
+			"conflicts", len(conflicts),
+		)
+		return false
 	}
 
-	return strings.TrimSpace(line)
+	if key, shared := sharedRootResponseKey(queries); shared {
+		p.logger.Debug("Refusing to merge queries with conflicting variables on the same root field",
+			"service", queries[0].ServiceName,
+			"field", key,
+		)
+		return false
+	}
+	return true
+}
+
+// sharedRootResponseKey 查找多个查询共同选择的根字段响应键，无法解析的查询视为共享
+func sharedRootResponseKey(queries []federationtypes.SubQuery) (string, bool) {
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		document, report := astparser.ParseGraphqlDocumentString(query.Query)
+		if report.HasErrors() || len(document.OperationDefinitions) == 0 {
+			return "", true
+		}
+
+		keys := make(map[string]bool)
+		for _, selectionRef := range document.SelectionSets[document.OperationDefinitions[0].SelectionSet].SelectionRefs {
+			if selection := document.Selections[selectionRef]; selection.Kind == ast.SelectionKindField {
+				keys[document.FieldAliasOrNameString(selection.Ref)] = true
+			}
+		}
+		for key := range keys {
+			if seen[key] {
+				return key, true
+			}
+			seen[key] = true
+		}
+	}
+	return "", false
+}
+
+// namespaceConflictingVariables 为取值冲突的变量按查询序号重命名并改写查询文本
+func (p *Planner) namespaceConflictingVariables(queries []federationtypes.SubQuery) []federationtypes.SubQuery {
+	conflicts := p.findVariableConflicts(queries)
+	if len(conflicts) == 0 {
+		return queries
+	}
+
+	// 收集已占用的变量名，避免重命名后再次冲突
+	taken := make(map[string]bool)
+	for _, query := range queries {
+		for name := range query.Variables {
+			taken[name] = true
+		}
+	}
+
+	resolved := make([]federationtypes.SubQuery, len(queries))
+	for i, query := range queries {
+		renames := make(map[string]string)
+		variables := make(map[string]interface{}, len(query.Variables))
+
+		for name, value := range query.Variables {
+			if !conflicts[name] {
+				variables[name] = value
+				continue
+			}
+
+			newName := fmt.Sprintf("%s_%d", name, i)
+			for taken[newName] {
+				newName += "_"
+			}
+			taken[newName] = true
+
+			renames[name] = newName
+			variables[newName] = value
+		}
+
+		query.Variables = variables
+		if len(renames) > 0 {
+			query.Query = renameQueryVariables(query.Query, renames)
+		}
+		resolved[i] = query
+	}
+
+	p.logger.Debug("Namespaced conflicting variables", "service", queries[0].ServiceName, "conflicts", len(conflicts))
+	return resolved
+}
+
+// mergeVariables 合并查询变量
+func (p *Planner) mergeVariables(queries []federationtypes.SubQuery) map[string]interface{} {
+	allVariables := make(map[string]interface{})
+	for _, query := range queries {
+		for k, v := range query.Variables {
+			allVariables[k] = v
+		}
+	}
+	return allVariables
+}
+
+// renameQueryVariables 改写查询文本中的变量引用，跳过字符串字面量
+func renameQueryVariables(query string, renames map[string]string) string {
+	var builder strings.Builder
+	builder.Grow(len(query))
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		// 块字符串
+		if strings.HasPrefix(query[i:], `"""`) {
+			end := strings.Index(query[i+3:], `"""`)
+			if end == -1 {
+				builder.WriteString(query[i:])
+				break
+			}
+			builder.WriteString(query[i : i+3+end+3])
+			i += 3 + end + 3
+			continue
+		}
+
+		// 普通字符串
+		if c == '"' {
+			j := i + 1
+			for j < len(query) && query[j] != '"' {
+				if query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(query) {
+				builder.WriteString(query[i:])
+				break
+			}
+			builder.WriteString(query[i : j+1])
+			i = j + 1
+			continue
+		}
+
+		if c == '$' {
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			if newName, ok := renames[query[i+1:j]]; ok {
+				builder.WriteString("$" + newName)
+			} else {
+				builder.WriteString(query[i:j])
+			}
+			i = j
+			continue
+		}
+
+		builder.WriteByte(c)
+		i++
+	}
+
+	return builder.String()
+}
+
+// isNameChar 判断是否为 GraphQL 名称字符
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// extractQueryContent 提取查询内容
+func (p *Planner) extractQueryContent(query string) string {
+	start := strings.Index(query, "{")
+	end := strings.LastIndex(query, "}")
+
+	if start == -1 || end == -1 || start >= end {
+		return ""
+	}
+
+	return strings.TrimSpace(query[start+1 : end])
 }
 
 // extractQueryType 提取查询类型
@@ -996,11 +1514,17 @@ func (p *Planner) optimizeQueryOrder(subQueries []federationtypes.SubQuery, depe
 		visiting[serviceName] = false
 		visited[serviceName] = true
 
-		// 添加到结果
+		// 添加到结果，按字段预算拆出的子查询全部保留
+		added := false
 		for _, subQuery := range subQueries {
-			if subQuery.ServiceName == serviceName {
+			if subQuery.ServiceName != serviceName {
+				continue
+			}
+			if subQuery.FieldBudget != nil {
 				ordered = append(ordered, subQuery)
-				break
+			} else if !added {
+				ordered = append(ordered, subQuery)
+				added = true
 			}
 		}
 
@@ -1016,21 +1540,29 @@ func (p *Planner) optimizeQueryOrder(subQueries []federationtypes.SubQuery, depe
 }
 
 // optimizeBatching 批处理优化
-func (p *Planner) optimizeBatching(subQueries []federationtypes.SubQuery) []federationtypes.SubQuery {
+func (p *Planner) optimizeBatching(ctx context.Context, subQueries []federationtypes.SubQuery) ([]federationtypes.SubQuery, error) {
 	if len(subQueries) <= 1 {
-		return subQueries
+		return subQueries, nil
 	}
 
-	// 按服务名分组
+	var optimized []federationtypes.SubQuery
+
+	// 按服务名分组，按字段预算拆出的子查询不参与批处理
 	serviceGroups := make(map[string][]federationtypes.SubQuery)
 	for _, subQuery := range subQueries {
+		if subQuery.FieldBudget != nil {
+			optimized = append(optimized, subQuery)
+			continue
+		}
 		serviceGroups[subQuery.ServiceName] = append(serviceGroups[subQuery.ServiceName], subQuery)
 	}
 
-	var optimized []federationtypes.SubQuery
-
 	// 对每个服务组进行批处理优化
 	for serviceName, queries := range serviceGroups {
+		if err := checkPlanningDeadline(ctx, "batching"); err != nil {
+			return nil, err
+		}
+
 		if len(queries) == 1 {
 			// 单个查询，直接添加
 			optimized = append(optimized, queries[0])
@@ -1045,7 +1577,7 @@ func (p *Planner) optimizeBatching(subQueries []federationtypes.SubQuery) []fede
 		"original", len(subQueries),
 		"optimized", len(optimized))
 
-	return optimized
+	return optimized, nil
 }
 
 // batchQueriesForService 为特定服务批处理查询
@@ -1096,7 +1628,7 @@ func (p *Planner) groupSimilarQueries(queries []federationtypes.SubQuery) [][]fe
 	return groups
 }
 
-// areQueriesSimilar 检查两个查询是否相似
+// areQueriesSimilar 检查两个查询是否相似，按配置的权重综合字段重叠度和变量数量接近度
 func (p *Planner) areQueriesSimilar(q1, q2 federationtypes.SubQuery) bool {
 	// 检查服务名
 	if q1.ServiceName != q2.ServiceName {
@@ -1110,18 +1642,30 @@ func (p *Planner) areQueriesSimilar(q1, q2 federationtypes.SubQuery) bool {
 		return false
 	}
 
+	batching := p.config.Batching
+
 	// 检查查询复杂度
 	complexity1 := p.calculateQueryComplexity(q1.Query)
 	complexity2 := p.calculateQueryComplexity(q2.Query)
-
-	// 相似的复杂度阈值
-	maxComplexity := 10
-	if complexity1 > maxComplexity || complexity2 > maxComplexity {
+	if complexity1 > batching.MaxComplexity || complexity2 > batching.MaxComplexity {
 		return false
 	}
 
 	// 检查变量相似性
-	return p.areVariablesSimilar(q1.Variables, q2.Variables)
+	variableRatio := p.variableCountRatio(q1.Variables, q2.Variables)
+	if variableRatio < batching.MinVariableRatio {
+		return false
+	}
+
+	totalWeight := batching.FieldOverlapWeight + batching.VariableWeight
+	if totalWeight <= 0 {
+		return true
+	}
+
+	overlap := fieldOverlap(p.topLevelFields(q1.Query), p.topLevelFields(q2.Query))
+	score := (batching.FieldOverlapWeight*overlap + batching.VariableWeight*variableRatio) / totalWeight
+
+	return score >= batching.SimilarityThreshold
 }
 
 // calculateQueryComplexity 计算查询复杂度
@@ -1133,30 +1677,104 @@ func (p *Planner) calculateQueryComplexity(query string) int {
 	return complexity
 }
 
-// areVariablesSimilar 检查变量是否相似
-func (p *Planner) areVariablesSimilar(vars1, vars2 map[string]interface{}) bool {
-	// 如果变量数量相差太大，认为不相似
+// variableCountRatio 返回两组变量数量之比（较少/较多），都为空时为 1
+func (p *Planner) variableCountRatio(vars1, vars2 map[string]interface{}) float64 {
 	len1, len2 := len(vars1), len(vars2)
 	if len1 == 0 && len2 == 0 {
-		return true
+		return 1
 	}
 
-	maxLen := len1
-	if len2 > maxLen {
-		maxLen = len2
+	minLen, maxLen := len1, len2
+	if minLen > maxLen {
+		minLen, maxLen = maxLen, minLen
 	}
 
-	minLen := len1
-	if len2 < minLen {
-		minLen = len2
+	return float64(minLen) / float64(maxLen)
+}
+
+// fieldOverlap 计算两个字段集合的 Jaccard 相似度，都为空时为 1
+func fieldOverlap(fields1, fields2 map[string]bool) float64 {
+	if len(fields1) == 0 && len(fields2) == 0 {
+		return 1
 	}
 
-	// 如果变量数量相差超过50%，认为不相似
-	if maxLen > 0 && float64(minLen)/float64(maxLen) < 0.5 {
-		return false
+	shared := 0
+	for field := range fields1 {
+		if fields2[field] {
+			shared++
+		}
 	}
 
-	return true
+	return float64(shared) / float64(len(fields1)+len(fields2)-shared)
+}
+
+// topLevelFields 提取子查询顶层选择的字段名，忽略别名、参数、子选择和片段
+func (p *Planner) topLevelFields(query string) map[string]bool {
+	fields := make(map[string]bool)
+	content := p.extractQueryContent(query)
+
+	depth := 0
+	pending := ""
+	skipNext := false
+	var token strings.Builder
+
+	commit := func() {
+		if pending != "" {
+			fields[pending] = true
+			pending = ""
+		}
+	}
+	endToken := func() {
+		if token.Len() == 0 {
+			return
+		}
+		name := token.String()
+		token.Reset()
+
+		switch {
+		case skipNext:
+			// 片段展开的名称或 on 后的类型条件
+			skipNext = name == "on"
+		default:
+			commit()
+			pending = name
+		}
+	}
+
+	for _, char := range content {
+		isNameChar := char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if depth == 0 && isNameChar {
+			token.WriteRune(char)
+			continue
+		}
+		endToken()
+
+		switch char {
+		case '{', '(':
+			if depth == 0 {
+				commit()
+			}
+			depth++
+		case '}', ')':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			// 冒号前为别名，真实字段名随后出现
+			if depth == 0 {
+				pending = ""
+			}
+		case '.':
+			if depth == 0 {
+				commit()
+				skipNext = true
+			}
+		}
+	}
+	endToken()
+	commit()
+
+	return fields
 }
 
 // canBatchQueries 检查是否可以批处理查询
@@ -1187,37 +1805,19 @@ func (p *Planner) canBatchQueries(queries []federationtypes.SubQuery) bool {
 		return false
 	}
 
-	return true
+	// 检查变量冲突
+	return p.canMergeVariables(queries)
 }
 
 // createBatchedQuery 创建批处理查询
 func (p *Planner) createBatchedQuery(serviceName string, queries []federationtypes.SubQuery) federationtypes.SubQuery {
-	// 合并所有查询的字段
-	allFields := make(map[string]bool)
-	allVariables := make(map[string]interface{})
-	allPaths := make(map[string]bool)
+	// 重命名取值冲突的同名变量
+	queries = p.namespaceConflictingVariables(queries)
 
 	var maxTimeout time.Duration
 	maxRetryCount := 0
 
 	for _, query := range queries {
-		// 提取字段
-		queryContent := p.extractQueryContent(query.Query)
-		fields := p.parseQueryFields(queryContent)
-		for _, field := range fields {
-			allFields[field] = true
-		}
-
-		// 合并变量
-		for k, v := range query.Variables {
-			allVariables[k] = v
-		}
-
-		// 合并路径
-		for _, path := range query.Path {
-			allPaths[path] = true
-		}
-
 		// 获取最大超时和重试次数
 		if query.Timeout > maxTimeout {
 			maxTimeout = query.Timeout
@@ -1227,24 +1827,11 @@ func (p *Planner) createBatchedQuery(serviceName string, queries []federationtyp
 		}
 	}
 
-	// 构建批处理查询
-	var fieldList []string
-	for field := range allFields {
-		fieldList = append(fieldList, field)
-	}
-
-	var pathList []string
-	for path := range allPaths {
-		pathList = append(pathList, path)
-	}
-
-	batchedQuery := fmt.Sprintf("query { %s }", strings.Join(fieldList, " "))
-
 	return federationtypes.SubQuery{
 		ServiceName: serviceName,
-		Query:       batchedQuery,
-		Variables:   allVariables,
-		Path:        pathList,
+		Query:       p.mergeQueryStrings(queries),
+		Variables:   p.mergeVariables(queries),
+		Path:        p.mergeQueryPaths(queries),
 		Timeout:     maxTimeout,
 		RetryCount:  maxRetryCount,
 	}
@@ -1254,21 +1841,55 @@ func (p *Planner) createBatchedQuery(serviceName string, queries []federationtyp
 
 // validateSubQuery 验证子查询
 func (p *Planner) validateSubQuery(subQuery *federationtypes.SubQuery, index int) error {
+	diagnostics := []errors.ErrorOption{
+		errors.WithExtension("reason", "INVALID_SUB_QUERY"),
+		errors.WithExtension("subQueryIndex", index),
+	}
+	if subQuery.ServiceName != "" {
+		diagnostics = append(diagnostics, errors.WithExtension("service", subQuery.ServiceName))
+	}
+
 	if subQuery.ServiceName == "" {
-		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has empty service name", index))
+		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has empty service name", index), diagnostics...)
 	}
 
 	if subQuery.Query == "" {
-		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has empty query", index))
+		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has empty query", index), diagnostics...)
 	}
 
 	if subQuery.Timeout <= 0 {
-		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has invalid timeout", index))
+		return errors.NewPlanningError(fmt.Sprintf("sub-query %d has invalid timeout", index),
+			append(diagnostics, errors.WithExtension("timeout", subQuery.Timeout.String()))...)
 	}
 
 	return nil
 }
 
+// pruneDependencies 去除依赖关系中没有子查询的服务
+func pruneDependencies(dependencies map[string][]string, subQueries []federationtypes.SubQuery) map[string][]string {
+	planned := make(map[string]bool, len(subQueries))
+	for _, subQuery := range subQueries {
+		planned[subQuery.ServiceName] = true
+	}
+
+	pruned := make(map[string][]string, len(dependencies))
+	for service, deps := range dependencies {
+		if !planned[service] {
+			continue
+		}
+		var kept []string
+		for _, dep := range deps {
+			if planned[dep] {
+				kept = append(kept, dep)
+			}
+		}
+		if len(kept) > 0 {
+			pruned[service] = kept
+		}
+	}
+	return pruned
+}
+
 // validateDependencies 验证依赖关系
 func (p *Planner) validateDependencies(dependencies map[string][]string, subQueries []federationtypes.SubQuery) error {
 	// 收集所有服务名称
@@ -1281,7 +1902,12 @@ func (p *Planner) validateDependencies(dependencies map[string][]string, subQuer
 	for service, deps := range dependencies {
 		for _, dep := range deps {
 			if !serviceNames[dep] {
-				return errors.NewPlanningError(fmt.Sprintf("service %s depends on non-existent service %s", service, dep))
+				return errors.NewPlanningError(
+					fmt.Sprintf("service %s depends on non-existent service %s", service, dep),
+					errors.WithExtension("reason", "UNKNOWN_DEPENDENCY"),
+					errors.WithExtension("service", service),
+					errors.WithExtension("dependency", dep),
+				)
 			}
 		}
 	}
@@ -1289,15 +1915,28 @@ func (p *Planner) validateDependencies(dependencies map[string][]string, subQuer
 	return nil
 }
 
-// checkCircularDependencies 检查循环依赖
+// checkCircularDependencies 检查循环依赖，错误的 cycle 扩展按依赖方向列出环上的服务，首尾相同
 func (p *Planner) checkCircularDependencies(dependencies map[string][]string) error {
 	visited := make(map[string]bool)
 	visiting := make(map[string]bool)
+	var stack []string
 
 	var visit func(service string) error
 	visit = func(service string) error {
 		if visiting[service] {
-			return errors.NewPlanningError(fmt.Sprintf("circular dependency detected involving service %s", service))
+			var cycle []string
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == service {
+					cycle = append(append(cycle, stack[i:]...), service)
+					break
+				}
+			}
+			return errors.NewPlanningError(
+				fmt.Sprintf("circular dependency detected involving service %s", service),
+				errors.WithExtension("reason", "CIRCULAR_DEPENDENCY"),
+				errors.WithExtension("service", service),
+				errors.WithExtension("cycle", cycle),
+			)
 		}
 
 		if visited[service] {
@@ -1305,6 +1944,7 @@ func (p *Planner) checkCircularDependencies(dependencies map[string][]string) er
 		}
 
 		visiting[service] = true
+		stack = append(stack, service)
 
 		for _, dep := range dependencies[service] {
 			if err := visit(dep); err != nil {
@@ -1312,13 +1952,21 @@ func (p *Planner) checkCircularDependencies(dependencies map[string][]string) er
 			}
 		}
 
+		stack = stack[:len(stack)-1]
 		visiting[service] = false
 		visited[service] = true
 
 		return nil
 	}
 
+	// 按服务名遍历，同一计划报告的环保持稳定
+	services := make([]string, 0, len(dependencies))
 	for service := range dependencies {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
 		if err := visit(service); err != nil {
 			return err
 		}
@@ -1360,6 +2008,18 @@ func (p *Planner) extractTypeFromAST(document *ast.Document, typeRef int) string
 	}
 }
 
+// checkPlanningDeadline 检查规划上下文是否已超时或取消
+func checkPlanningDeadline(ctx context.Context, phase string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.NewPlanningError("planning aborted during "+phase,
+			errors.WithCause(err),
+			errors.WithExtension("reason", "PLANNING_ABORTED"),
+			errors.WithExtension("phase", phase),
+		)
+	}
+	return nil
+}
+
 // findServiceByName 根据名称查找服务
 func (p *Planner) findServiceByName(name string, services []federationtypes.ServiceConfig) *federationtypes.ServiceConfig {
 	for _, service := range services {
@@ -1455,9 +2115,9 @@ func (p *Planner) getBusinessLogicDependencies(service string) []string {
 		"analytics":    {"user", "product", "order"},
 	}
 
-	for serviceType, deps := range dependencyMap {
+	for _, serviceType := range sortedPatterns(dependencyMap) {
 		if strings.Contains(serviceLower, serviceType) {
-			dependencies = append(dependencies, deps...)
+			dependencies = append(dependencies, dependencyMap[serviceType]...)
 			break
 		}
 	}
@@ -1465,6 +2125,21 @@ func (p *Planner) getBusinessLogicDependencies(service string) []string {
 	return dependencies
 }
 
+// sortedPatterns 按匹配优先级返回规则键：较长（更具体）的模式在前，同长度按字典序，保证规划结果与 map 遍历顺序无关
+func sortedPatterns(rules map[string][]string) []string {
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	return patterns
+}
+
 // uniqueAndFilterDependencies 去重和过滤依赖
 func (p *Planner) uniqueAndFilterDependencies(deps []string, service string) []string {
 	unique := make(map[string]bool)
@@ -1526,11 +2201,13 @@ func (p *Planner) CreateFederationExecutionPlan(ctx context.Context, query *fede
 		Dependencies:  dependencies,
 		MergeStrategy: federationtypes.MergeStrategyDeep,
 		Metadata: map[string]interface{}{
-			"federationPlan": true,
-			"entityCount":    len(requiredEntities),
-			"createdAt":      time.Now(),
+			FederationPlanMetadataKey: true,
+			"entityCount":             len(requiredEntities),
+			"createdAt":               time.Now(),
 		},
 	}
+	setRootKeys(plan.SubQueries)
+	plan.Metadata[PlanHashMetadataKey] = PlanHash(plan)
 
 	return plan, nil
 }
@@ -1564,8 +2241,7 @@ func (p *Planner) extractEntityKeyFields(entity federationtypes.FederatedEntity)
 	var keyFields []string
 
 	for _, key := range entity.Directives.Keys {
-		fields := strings.Fields(key.Fields)
-		keyFields = append(keyFields, fields...)
+		keyFields = append(keyFields, key.FieldNames()...)
 	}
 
 	// 去重
@@ -1599,8 +2275,7 @@ func (p *Planner) buildEntityQuery(entity federationtypes.FederatedEntity) strin
 // isEntityKeyField 检查字段是否是实体的键字段
 func (p *Planner) isEntityKeyField(entity federationtypes.FederatedEntity, fieldName string) bool {
 	for _, key := range entity.Directives.Keys {
-		fields := strings.Fields(key.Fields)
-		for _, field := range fields {
+		for _, field := range key.FieldNames() {
 			if field == fieldName {
 				return true
 			}
@@ -1637,14 +2312,12 @@ func (p *Planner) buildEntityDependencies(entities []federationtypes.FederatedEn
 		// 分析字段依赖
 		for _, field := range entity.Fields {
 			if field.Directives.Requires != nil {
-				// 找到提供必需字段的服务
-				requiredFields := strings.Fields(field.Directives.Requires.Fields)
-				for _, requiredField := range requiredFields {
-					provider := p.findFieldProviderService(entity.TypeName, requiredField, entities)
-					if provider != "" && provider != serviceName {
+				// 必需字段（含嵌套子字段）可能分布在多个服务中，依赖所有提供者
+				federationtypes.FieldSetProviders(entity.TypeName, field.Directives.Requires.FieldSet(), entities, func(provider, _ string) {
+					if provider != serviceName {
 						deps = append(deps, provider)
 					}
-				}
+				})
 			}
 		}
 
@@ -1657,17 +2330,3 @@ func (p *Planner) buildEntityDependencies(entities []federationtypes.FederatedEn
 
 	return dependencies
 }
-
-// findFieldProviderService 查找提供指定字段的服务
-func (p *Planner) findFieldProviderService(typeName, fieldName string, entities []federationtypes.FederatedEntity) string {
-	for _, entity := range entities {
-		if entity.TypeName == typeName {
-			for _, field := range entity.Fields {
-				if field.Name == fieldName && field.Directives.External == nil {
-					return entity.ServiceName
-				}
-			}
-		}
-	}
-	return ""
-}
@@ -2,9 +2,16 @@ package planner
 
 import (
 	"context"
+	stderrors "errors"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
 	"envoy-wasm-graphql-federation/pkg/types"
 )
 
@@ -80,7 +87,7 @@ func TestPlanner_OptimizePlan_NilPlan(t *testing.T) {
 	planner := NewPlanner(logger)
 
 	// 测试 nil 计划
-	_, err := planner.OptimizePlan(nil)
+	_, err := planner.OptimizePlan(context.Background(), nil)
 	if err == nil {
 		t.Error("Expected error for nil plan")
 	}
@@ -181,3 +188,954 @@ func TestSubQuery_Struct(t *testing.T) {
 		t.Errorf("Expected path length to be 2, got %d", len(subQuery.Path))
 	}
 }
+
+// parseTestQuery 解析测试查询
+func parseTestQuery(t testing.TB, query string) *types.ParsedQuery {
+	t.Helper()
+
+	document, report := astparser.ParseGraphqlDocumentString(query)
+	if report.HasErrors() {
+		t.Fatalf("Failed to parse test query: %s", query)
+	}
+
+	return &types.ParsedQuery{AST: &document}
+}
+
+func TestPlanner_CreateExecutionPlan_StrictFieldRouting(t *testing.T) {
+	ctx := context.Background()
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+	}
+	query := parseTestQuery(t, "{ users { id } inventory { sku } }")
+
+	// 默认宽松模式回退到第一个服务
+	lenient := NewPlanner(&MockLogger{})
+	plan, err := lenient.CreateExecutionPlan(ctx, query, services)
+	if err != nil {
+		t.Fatalf("Unexpected error in lenient mode: %v", err)
+	}
+	if len(plan.SubQueries) != 1 || plan.SubQueries[0].ServiceName != "users" {
+		t.Errorf("Expected fallback to users service, got %+v", plan.SubQueries)
+	}
+
+	// 严格模式下报告无法路由的字段
+	strict := NewPlannerWithConfig(&PlannerConfig{StrictFieldRouting: true}, &MockLogger{})
+	_, err = strict.CreateExecutionPlan(ctx, query, services)
+	if err == nil {
+		t.Fatal("Expected error for unroutable field in strict mode")
+	}
+	if !strings.Contains(err.Error(), "inventory") {
+		t.Errorf("Expected error to name the unroutable field, got %v", err)
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_RetryCountFromService(t *testing.T) {
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second, MaxRetries: 2},
+		{Name: "books", Endpoint: "http://books:4002", Schema: "type Query { books: [Book] }", Timeout: time.Second},
+	}
+
+	plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), parseTestQuery(t, "{ users { id } books { isbn } }"), services)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 重试次数取服务配置，未配置时不重试
+	retries := make(map[string]int)
+	for _, subQuery := range plan.SubQueries {
+		retries[subQuery.ServiceName] = subQuery.RetryCount
+	}
+	if !reflect.DeepEqual(retries, map[string]int{"users": 2, "books": 0}) {
+		t.Errorf("Unexpected retry counts: %v", retries)
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_RootTypenameNotRouted(t *testing.T) {
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+	}
+	query := parseTestQuery(t, "{ __typename users { id } }")
+
+	strict := NewPlannerWithConfig(&PlannerConfig{StrictFieldRouting: true}, &MockLogger{})
+	plan, err := strict.CreateExecutionPlan(context.Background(), query, services)
+	if err != nil {
+		t.Fatalf("Root __typename should not need routing: %v", err)
+	}
+	for _, subQuery := range plan.SubQueries {
+		if strings.Contains(subQuery.Query, "__typename") {
+			t.Errorf("Expected root __typename to be resolved locally, got %q", subQuery.Query)
+		}
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_StaticTypenameNotSent(t *testing.T) {
+	services := []types.ServiceConfig{
+		{
+			Name:     "people",
+			Endpoint: "http://people:4001",
+			Schema: `
+				type Query { people: [Person] search: [SearchResult] }
+				type Person { id: ID! name: String }
+				type Book { isbn: String! }
+				union SearchResult = Person | Book`,
+			Timeout: time.Second,
+		},
+	}
+	query := parseTestQuery(t, "{ people { kind: __typename id } search { __typename ... on Person { id } } }")
+
+	plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), query, services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+	if len(plan.SubQueries) != 1 {
+		t.Fatalf("Expected a single forwarded sub-query, got %d", len(plan.SubQueries))
+	}
+
+	sent := plan.SubQueries[0].Query
+	if strings.Contains(sent, "kind") {
+		t.Errorf("Expected __typename on concrete Person to be filled locally, got %q", sent)
+	}
+	if strings.Count(sent, "__typename") != 1 {
+		t.Errorf("Expected __typename on the union position to be sent, got %q", sent)
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_SplitsEntityFields(t *testing.T) {
+	services := []types.ServiceConfig{
+		{
+			Name:     "catalog",
+			Endpoint: "http://catalog:4001",
+			Schema:   `type Query { product(id: ID!): Product } type Product @key(fields: "id") { id: ID! name: String }`,
+			Timeout:  time.Second,
+		},
+		{
+			Name:     "reviews",
+			Endpoint: "http://reviews:4002",
+			Schema:   `type Product @key(fields: "id") { id: ID! reviews(first: Int): [Review] } type Review { body: String }`,
+			Timeout:  time.Second,
+		},
+	}
+	query := parseTestQuery(t, `query($id: ID!, $first: Int) { item: product(id: $id) { name reviews(first: $first) { body } } }`)
+
+	plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), query, services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+
+	if len(plan.SubQueries) != 1 || plan.SubQueries[0].ServiceName != "catalog" {
+		t.Fatalf("Expected a single catalog sub-query, got %+v", plan.SubQueries)
+	}
+	rootQuery := plan.SubQueries[0].Query
+	if rootQuery != `query($id: ID!) { item: product(id: $id) { name __typename id } }` {
+		t.Errorf("Unexpected catalog query %q", rootQuery)
+	}
+
+	if len(plan.EntityFetches) != 1 {
+		t.Fatalf("Expected one entity fetch, got %+v", plan.EntityFetches)
+	}
+	fetch := plan.EntityFetches[0]
+	if fetch.ServiceName != "reviews" || fetch.TypeName != "Product" {
+		t.Errorf("Expected Product fetch from reviews, got %+v", fetch)
+	}
+	if !reflect.DeepEqual(fetch.Path, []string{"item"}) || !reflect.DeepEqual(fetch.KeyFields, []string{"id"}) {
+		t.Errorf("Unexpected fetch path or keys: %+v", fetch)
+	}
+	expected := `query($representations: [_Any!]!, $first: Int) { _entities(representations: $representations) { ... on Product { reviews(first: $first) { body } } } }`
+	if fetch.Query != expected {
+		t.Errorf("Unexpected entity query %q", fetch.Query)
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_RenamedRootTypes(t *testing.T) {
+	services := []types.ServiceConfig{
+		{
+			Name:     "alpha",
+			Endpoint: "http://alpha:4001",
+			Schema:   `schema { query: AlphaRoot } type AlphaRoot { product(id: ID!): Product } type Product @key(fields: "id") { id: ID! name: String }`,
+			Timeout:  time.Second,
+		},
+		{
+			Name:     "beta",
+			Endpoint: "http://beta:4002",
+			Schema:   `schema { query: BetaRoot } type BetaRoot { topNotes: [String] } type Product @key(fields: "id") { id: ID! notes: [String] }`,
+			Timeout:  time.Second,
+		},
+	}
+	query := parseTestQuery(t, `{ product(id: "1") { name notes } topNotes }`)
+
+	plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), query, services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+
+	queries := make(map[string]string)
+	for _, subQuery := range plan.SubQueries {
+		queries[subQuery.ServiceName] = subQuery.Query
+	}
+	if len(queries) != 2 || !strings.Contains(queries["alpha"], "product") || strings.Contains(queries["alpha"], "topNotes") {
+		t.Fatalf("Expected product to be routed to alpha only, got %+v", queries)
+	}
+	if !strings.Contains(queries["beta"], "topNotes") || strings.Contains(queries["beta"], "product") {
+		t.Errorf("Expected topNotes to be routed to beta only, got %q", queries["beta"])
+	}
+
+	// 根字段位于重命名的根类型上时仍能拆分实体字段
+	if len(plan.EntityFetches) != 1 || plan.EntityFetches[0].ServiceName != "beta" || plan.EntityFetches[0].TypeName != "Product" {
+		t.Errorf("Expected Product.notes to be fetched from beta, got %+v", plan.EntityFetches)
+	}
+}
+
+func TestPlanner_MaxEntityFieldAliases(t *testing.T) {
+	services := []types.ServiceConfig{
+		{
+			Name:     "catalog",
+			Endpoint: "http://catalog:4001",
+			Schema:   `type Query { product(id: ID!): Product } type Product @key(fields: "id") { id: ID! name: String }`,
+			Timeout:  time.Second,
+		},
+		{
+			Name:     "reviews",
+			Endpoint: "http://reviews:4002",
+			Schema:   `type Product @key(fields: "id") { id: ID! reviews: [Review] } type Review { body: String }`,
+			Timeout:  time.Second,
+		},
+	}
+
+	config := DefaultPlannerConfig()
+	config.MaxEntityFieldAliases = 2
+	planner := NewPlannerWithConfig(config, &MockLogger{})
+
+	// 不触发实体查询的字段不受限制
+	query := parseTestQuery(t, `{ a: product(id: 1) { name } b: product(id: 2) { name } c: product(id: 3) { name } }`)
+	if _, err := planner.CreateExecutionPlan(context.Background(), query, services); err != nil {
+		t.Fatalf("Aliases without entity joins should be allowed, got %v", err)
+	}
+
+	query = parseTestQuery(t, `{ a: product(id: 1) { reviews { body } } b: product(id: 2) { reviews { body } } }`)
+	if _, err := planner.CreateExecutionPlan(context.Background(), query, services); err != nil {
+		t.Fatalf("Aliases within the cap should be allowed, got %v", err)
+	}
+
+	query = parseTestQuery(t, `{ a: product(id: 1) { reviews { body } } b: product(id: 2) { reviews { body } } c: product(id: 3) { reviews { body } } }`)
+	_, err := planner.CreateExecutionPlan(context.Background(), query, services)
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodeQueryComplexity {
+		t.Fatalf("Expected QUERY_COMPLEXITY_ERROR, got %v", err)
+	}
+	if fedErr.Extensions["field"] != "Query.product" || fedErr.Extensions["limit"] != 2 || fedErr.Extensions["actual"] != 3 {
+		t.Errorf("Expected Query.product with limit 2 and 3 aliases to be reported, got %v", fedErr.Extensions)
+	}
+}
+
+func TestPlanner_FieldTimeoutSplitsRootField(t *testing.T) {
+	services := []types.ServiceConfig{
+		{
+			Name:     "reports",
+			Endpoint: "http://reports:4001",
+			Schema:   "type Query { summary: String slowReport: String }",
+			Timeout:  time.Second,
+		},
+	}
+	query := parseTestQuery(t, `{ summary report: slowReport }`)
+
+	config := DefaultPlannerConfig()
+	config.FieldTimeouts = map[string]time.Duration{"Query.slowReport": 50 * time.Millisecond}
+	planner := NewPlannerWithConfig(config, &MockLogger{})
+
+	plan, err := planner.CreateExecutionPlan(context.Background(), query, services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+
+	// 合并与批处理不应把拆出的子查询并回去
+	optimized, err := planner.OptimizePlan(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("OptimizePlan() error = %v", err)
+	}
+	if len(optimized.SubQueries) != 2 {
+		t.Fatalf("Expected budgeted field in its own sub-query, got %+v", optimized.SubQueries)
+	}
+
+	var budgeted *types.SubQuery
+	for i := range optimized.SubQueries {
+		if optimized.SubQueries[i].FieldBudget != nil {
+			budgeted = &optimized.SubQueries[i]
+		}
+	}
+	if budgeted == nil {
+		t.Fatalf("Expected a budgeted sub-query, got %+v", optimized.SubQueries)
+	}
+	if budgeted.Timeout != 50*time.Millisecond || budgeted.FieldBudget.Field != "Query.slowReport" {
+		t.Errorf("Unexpected budget %+v (timeout %v)", budgeted.FieldBudget, budgeted.Timeout)
+	}
+	if !reflect.DeepEqual(budgeted.FieldBudget.ResponseKeys, []string{"report"}) {
+		t.Errorf("Expected aliased response key, got %v", budgeted.FieldBudget.ResponseKeys)
+	}
+	if strings.Contains(budgeted.Query, "summary") {
+		t.Errorf("Budgeted sub-query should only select slowReport, got %q", budgeted.Query)
+	}
+}
+
+func TestPlanner_MergeQueries_ConflictingVariables(t *testing.T) {
+	queries := []types.SubQuery{
+		{
+			ServiceName: "users",
+			Query:       `query($id: ID!) { user(id: $id) { name } }`,
+			Variables:   map[string]interface{}{"id": "1"},
+			Timeout:     time.Second,
+		},
+		{
+			ServiceName: "users",
+			Query:       `query($id: ID!, $label: String) { account(id: $id, note: "$id") { label(text: $label) } }`,
+			Variables:   map[string]interface{}{"id": "2", "label": "x"},
+			Timeout:     time.Second,
+		},
+	}
+
+	// 默认策略：重命名冲突变量并改写引用
+	p := NewPlanner(&MockLogger{}).(*Planner)
+	merged := p.mergeQueries(queries)
+
+	if merged.Variables["id_0"] != "1" || merged.Variables["id_1"] != "2" {
+		t.Errorf("Expected namespaced variables, got %v", merged.Variables)
+	}
+	if _, exists := merged.Variables["id"]; exists {
+		t.Error("Conflicting variable should not keep its original name")
+	}
+	if merged.Variables["label"] != "x" {
+		t.Errorf("Expected non-conflicting variable to be kept, got %v", merged.Variables)
+	}
+	for _, fragment := range []string{"$id_0: ID!", "$id_1: ID!", "user(id: $id_0)", "account(id: $id_1", `note: "$id"`, "$label"} {
+		if !strings.Contains(merged.Query, fragment) {
+			t.Errorf("Expected merged query to contain %q, got %s", fragment, merged.Query)
+		}
+	}
+
+	// 拒绝策略：冲突时不合并
+	strict := NewPlannerWithConfig(&PlannerConfig{VariableConflictPolicy: VariableConflictRefuse}, &MockLogger{}).(*Planner)
+	if optimized := strict.mergeQueriesForSameService(queries); len(optimized) != 2 {
+		t.Errorf("Expected conflicting queries to stay separate, got %d", len(optimized))
+	}
+
+	// 取值相同的同名变量可以直接合并
+	queries[1].Variables["id"] = "1"
+	if optimized := strict.mergeQueriesForSameService(queries); len(optimized) != 1 {
+		t.Errorf("Expected queries with equal variables to merge, got %d", len(optimized))
+	}
+
+	// 同名根字段的变量取值冲突时，重命名策略也不合并
+	sameField := []types.SubQuery{
+		{ServiceName: "users", Query: `query($id: ID!) { user(id: $id) { name } }`, Variables: map[string]interface{}{"id": "1"}, Timeout: time.Second},
+		{ServiceName: "users", Query: `query($id: ID!) { user(id: $id) { email } }`, Variables: map[string]interface{}{"id": "2"}, Timeout: time.Second},
+	}
+	if optimized := p.mergeQueriesForSameService(sameField); len(optimized) != 2 {
+		t.Errorf("Expected queries selecting the same root field to stay separate, got %+v", optimized)
+	}
+}
+
+func TestPlanner_PlanningDiagnostics(t *testing.T) {
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+		{Name: "inventory", Endpoint: "http://inventory:4003", Schema: "type Query { stock: Int }", Timeout: time.Second},
+	}
+	subQuery := func(service string) types.SubQuery {
+		return types.SubQuery{ServiceName: service, Query: "{ a }", Timeout: time.Second}
+	}
+
+	tests := []struct {
+		name       string
+		plan       func() error
+		extensions map[string]interface{}
+	}{
+		{
+			name: "unroutable field",
+			plan: func() error {
+				_, err := NewPlannerWithConfig(&PlannerConfig{StrictFieldRouting: true}, &MockLogger{}).
+					CreateExecutionPlan(context.Background(), parseTestQuery(t, "{ users { id } orders { id } }"), services)
+				return err
+			},
+			extensions: map[string]interface{}{"reason": "UNROUTABLE_FIELD", "field": "orders"},
+		},
+		{
+			name: "unhealthy owners",
+			plan: func() error {
+				config := &PlannerConfig{
+					SkipUnhealthyServices: true,
+					ServiceHealth:         func(service types.ServiceConfig) bool { return service.Name != "inventory" },
+				}
+				_, err := NewPlannerWithConfig(config, &MockLogger{}).
+					CreateExecutionPlan(context.Background(), parseTestQuery(t, "{ stock }"), services)
+				return err
+			},
+			extensions: map[string]interface{}{"reason": "UNHEALTHY_OWNERS", "field": "stock", "unhealthyServices": []string{"inventory"}},
+		},
+		{
+			name: "planning aborted",
+			plan: func() error {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(ctx, parseTestQuery(t, "{ users { id } }"), services)
+				return err
+			},
+			extensions: map[string]interface{}{"reason": "PLANNING_ABORTED", "phase": "field mapping"},
+		},
+		{
+			name: "invalid sub-query",
+			plan: func() error {
+				invalid := subQuery("inventory")
+				invalid.Timeout = 0
+				return NewPlanner(&MockLogger{}).ValidatePlan(&types.ExecutionPlan{SubQueries: []types.SubQuery{subQuery("users"), invalid}})
+			},
+			extensions: map[string]interface{}{"reason": "INVALID_SUB_QUERY", "subQueryIndex": 1, "service": "inventory", "timeout": "0s"},
+		},
+		{
+			name: "unknown dependency",
+			plan: func() error {
+				return NewPlanner(&MockLogger{}).ValidatePlan(&types.ExecutionPlan{
+					SubQueries:   []types.SubQuery{subQuery("users")},
+					Dependencies: map[string][]string{"users": {"orders"}},
+				})
+			},
+			extensions: map[string]interface{}{"reason": "UNKNOWN_DEPENDENCY", "service": "users", "dependency": "orders"},
+		},
+		{
+			name: "circular dependency",
+			plan: func() error {
+				return NewPlanner(&MockLogger{}).ValidatePlan(&types.ExecutionPlan{
+					SubQueries: []types.SubQuery{subQuery("accounts"), subQuery("orders"), subQuery("users")},
+					Dependencies: map[string][]string{
+						"accounts": {"users"},
+						"users":    {"orders"},
+						"orders":   {"users"},
+					},
+				})
+			},
+			extensions: map[string]interface{}{"reason": "CIRCULAR_DEPENDENCY", "service": "users", "cycle": []string{"users", "orders", "users"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fedErr *errors.FederationError
+			if err := tt.plan(); !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePlanningFailed {
+				t.Fatalf("Expected PLANNING_FAILED, got %v", err)
+			}
+			for key, want := range tt.extensions {
+				if got := fedErr.Extensions[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("Extension %s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_PlanningDeadline(t *testing.T) {
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+	}
+	query := parseTestQuery(t, "{ users { id } }")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	planner := NewPlanner(&MockLogger{})
+	_, err := planner.CreateExecutionPlan(ctx, query, services)
+
+	var fedErr *errors.FederationError
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePlanningFailed {
+		t.Fatalf("Expected PLANNING_FAILED for expired context, got %v", err)
+	}
+
+	_, err = planner.OptimizePlan(ctx, &types.ExecutionPlan{
+		SubQueries: []types.SubQuery{
+			{ServiceName: "users", Query: "{ a }"},
+			{ServiceName: "orders", Query: "{ b }"},
+		},
+	})
+	if !stderrors.As(err, &fedErr) || fedErr.Code != errors.ErrCodePlanningFailed {
+		t.Fatalf("Expected PLANNING_FAILED from batching with expired context, got %v", err)
+	}
+}
+
+func TestPlanHash(t *testing.T) {
+	plan := &types.ExecutionPlan{
+		SubQueries: []types.SubQuery{
+			{ServiceName: "users", Query: "{ users { id } }", Variables: map[string]interface{}{"a": 1, "b": 2}},
+			{ServiceName: "orders", Query: "{ orders { id } }"},
+		},
+		Dependencies:  map[string][]string{"orders": {"users", "inventory"}, "users": {}},
+		MergeStrategy: types.MergeStrategyDeep,
+	}
+
+	hash := PlanHash(plan)
+	if hash == "" {
+		t.Fatal("Expected non-empty plan hash")
+	}
+
+	// 顺序和变量取值不影响哈希
+	reordered := &types.ExecutionPlan{
+		SubQueries: []types.SubQuery{
+			{ServiceName: "orders", Query: "{ orders { id } }"},
+			{ServiceName: "users", Query: "{ users { id } }", Variables: map[string]interface{}{"b": "x", "a": "y"}},
+		},
+		Dependencies:  map[string][]string{"users": {}, "orders": {"inventory", "users"}},
+		MergeStrategy: types.MergeStrategyDeep,
+	}
+	if PlanHash(reordered) != hash {
+		t.Error("Expected plan hash to be independent of ordering and variable values")
+	}
+
+	// 路由变化会改变哈希
+	rerouted := *plan
+	rerouted.SubQueries = []types.SubQuery{
+		{ServiceName: "accounts", Query: "{ users { id } }", Variables: map[string]interface{}{"a": 1, "b": 2}},
+		{ServiceName: "orders", Query: "{ orders { id } }"},
+	}
+	if PlanHash(&rerouted) == hash {
+		t.Error("Expected plan hash to change when routing changes")
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_PlanHashStable(t *testing.T) {
+	ctx := context.Background()
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+		{Name: "orders", Endpoint: "http://orders:4002", Schema: "type Query { orders: [Order] }", Timeout: time.Second},
+	}
+
+	planner := NewPlanner(&MockLogger{})
+	var first string
+	for i := 0; i < 5; i++ {
+		plan, err := planner.CreateExecutionPlan(ctx, parseTestQuery(t, "{ users { id } orders { id } }"), services)
+		if err != nil {
+			t.Fatalf("CreateExecutionPlan() error = %v", err)
+		}
+		hash, _ := plan.Metadata[PlanHashMetadataKey].(string)
+		if i == 0 {
+			first = hash
+		} else if hash != first {
+			t.Fatalf("Expected stable plan hash, got %s and %s", first, hash)
+		}
+	}
+	if first == "" {
+		t.Error("Expected plan hash in metadata")
+	}
+}
+
+func TestPlanner_topLevelFields(t *testing.T) {
+	planner := NewPlanner(&MockLogger{}).(*Planner)
+
+	fields := planner.topLevelFields(`query($id: ID!) { me: user(id: $id) { id name } orders { total } ...Extra ... on Query { audit } }`)
+	expected := map[string]bool{"user": true, "orders": true}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+}
+
+func TestPlanner_areQueriesSimilar_Weighting(t *testing.T) {
+	users := types.SubQuery{ServiceName: "users", Query: "query { users { id } }"}
+	sameFields := types.SubQuery{ServiceName: "users", Query: "query { users { name } }", Variables: map[string]interface{}{"a": 1}}
+	otherFields := types.SubQuery{ServiceName: "users", Query: "query { admins { id } }", Variables: map[string]interface{}{"a": 1}}
+	noVariables := types.SubQuery{ServiceName: "users", Query: "query { admins { id } }"}
+
+	defaults := NewPlanner(&MockLogger{}).(*Planner)
+	if !defaults.areQueriesSimilar(users, noVariables) {
+		t.Error("Expected queries with matching variable counts to batch by default")
+	}
+
+	overlapOnly := NewPlannerWithConfig(&PlannerConfig{
+		Batching: BatchingSettings{
+			MaxComplexity:       10,
+			FieldOverlapWeight:  1,
+			SimilarityThreshold: 0.5,
+		},
+	}, &MockLogger{}).(*Planner)
+	if !overlapOnly.areQueriesSimilar(users, sameFields) {
+		t.Error("Expected overlapping field sets to be similar")
+	}
+	if overlapOnly.areQueriesSimilar(users, otherFields) {
+		t.Error("Expected disjoint field sets not to be similar when overlap dominates")
+	}
+
+	lowComplexity := NewPlannerWithConfig(&PlannerConfig{
+		Batching: BatchingSettings{MaxComplexity: 1},
+	}, &MockLogger{}).(*Planner)
+	if lowComplexity.areQueriesSimilar(users, noVariables) {
+		t.Error("Expected queries above MaxComplexity not to be similar")
+	}
+}
+
+func TestMergeBatchingConfig(t *testing.T) {
+	if got := MergeBatchingConfig(nil); got != *DefaultBatchingConfig() {
+		t.Errorf("Expected defaults for nil config, got %+v", got)
+	}
+
+	threshold := 0.8
+	got := MergeBatchingConfig(&types.BatchingConfig{SimilarityThreshold: &threshold})
+	want := *DefaultBatchingConfig()
+	want.SimilarityThreshold = 0.8
+	if got != want {
+		t.Errorf("Expected partial config merged over defaults, got %+v", got)
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_SkipUnhealthyServices(t *testing.T) {
+	ctx := context.Background()
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] }", Timeout: time.Second},
+		{Name: "accounts", Endpoint: "http://accounts:4002", Schema: "type Query { users: [User] }", Timeout: time.Second},
+		{Name: "inventory", Endpoint: "http://inventory:4003", Schema: "type Query { stock: Int }", Timeout: time.Second},
+	}
+	unhealthy := map[string]bool{"users": true, "inventory": true}
+	config := &PlannerConfig{
+		SkipUnhealthyServices: true,
+		ServiceHealth: func(service types.ServiceConfig) bool {
+			return !unhealthy[service.Name]
+		},
+	}
+
+	// 不健康服务的字段改由其他拥有者提供
+	plan, err := NewPlannerWithConfig(config, &MockLogger{}).CreateExecutionPlan(ctx, parseTestQuery(t, "{ users { id } }"), services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+	if len(plan.SubQueries) != 1 || plan.SubQueries[0].ServiceName != "accounts" {
+		t.Errorf("Expected users field to be routed to accounts, got %+v", plan.SubQueries)
+	}
+
+	// 没有健康的拥有者时报错
+	_, err = NewPlannerWithConfig(config, &MockLogger{}).CreateExecutionPlan(ctx, parseTestQuery(t, "{ stock }"), services)
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("Expected unhealthy owner error, got %v", err)
+	}
+
+	// 关闭后仍规划到不健康的服务
+	config.SkipUnhealthyServices = false
+	plan, err = NewPlannerWithConfig(config, &MockLogger{}).CreateExecutionPlan(ctx, parseTestQuery(t, "{ stock }"), services)
+	if err != nil {
+		t.Fatalf("CreateExecutionPlan() error = %v", err)
+	}
+	if len(plan.SubQueries) != 1 || plan.SubQueries[0].ServiceName != "inventory" {
+		t.Errorf("Expected stock to be routed to inventory, got %+v", plan.SubQueries)
+	}
+}
+
+func singleServiceTestServices() []types.ServiceConfig {
+	return []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users(first: Int): [User] me: User } type User { id: ID! name: String }", Timeout: time.Second},
+		{Name: "products", Endpoint: "http://products:4002", Schema: "type Query { products: [Product] } type Product { upc: String! }", Timeout: time.Second},
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_SingleServiceForwardsQuery(t *testing.T) {
+	input := `query Users($first: Int) {
+  a: users(first: $first) { ...UserFields }
+  me { id }
+}
+
+fragment UserFields on User { id name }`
+	query := parseTestQuery(t, input)
+	query.Operation = "Users"
+	query.Variables = map[string]interface{}{"first": 10}
+
+	planner := NewPlanner(&MockLogger{})
+	plan, err := planner.CreateExecutionPlan(context.Background(), query, singleServiceTestServices())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(plan.SubQueries) != 1 {
+		t.Fatalf("Expected a single sub-query, got %d", len(plan.SubQueries))
+	}
+	subQuery := plan.SubQueries[0]
+	if subQuery.ServiceName != "users" {
+		t.Errorf("Expected users service, got %s", subQuery.ServiceName)
+	}
+	if subQuery.Query != input {
+		t.Errorf("Expected forwarded query to be byte-equivalent to the input, got %q", subQuery.Query)
+	}
+	if subQuery.OperationName != "Users" || subQuery.Variables["first"] != 10 {
+		t.Errorf("Expected operation name and variables to be forwarded, got %+v", subQuery)
+	}
+	if !reflect.DeepEqual(subQuery.RootKeys, []string{"a", "me"}) {
+		t.Errorf("Expected root response keys to be recorded, got %v", subQuery.RootKeys)
+	}
+	if plan.Metadata[SingleServiceMetadataKey] != true {
+		t.Error("Expected plan to be marked as single-service")
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_SingleServiceNonStandardNotForwarded(t *testing.T) {
+	services := singleServiceTestServices()
+	services[0].MaxRetries = 1
+
+	// 宽松验证放行的未使用片段和未定义指令不能原样转发给子图
+	tests := []struct {
+		name      string
+		input     string
+		operation string
+	}{
+		{name: "unused fragment", input: "{ users { id } } fragment Unused on User { name }"},
+		{name: "unknown directive", input: "{ users { id @cached } }"},
+		{name: "extra operation", input: "query A { users { id } } query B { me { id } }", operation: "A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := parseTestQuery(t, tt.input)
+			query.Operation = tt.operation
+
+			plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), query, services)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, ok := plan.Metadata[SingleServiceMetadataKey]; ok {
+				t.Errorf("Expected %s to use the full planning pipeline, got %q", tt.name, plan.SubQueries[0].Query)
+			}
+		})
+	}
+
+	// 原样转发同样使用服务配置的重试次数
+	plan, err := NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), parseTestQuery(t, "{ users { id } }"), services)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plan.Metadata[SingleServiceMetadataKey] != true || plan.SubQueries[0].RetryCount != 1 {
+		t.Errorf("Expected forwarded sub-query to use the service retry count, got %+v", plan.SubQueries[0])
+	}
+}
+
+func TestPlanner_CreateExecutionPlan_MultiServiceNotForwarded(t *testing.T) {
+	query := parseTestQuery(t, "{ users { id } products { upc } }")
+
+	planner := NewPlanner(&MockLogger{})
+	plan, err := planner.CreateExecutionPlan(context.Background(), query, singleServiceTestServices())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := plan.Metadata[SingleServiceMetadataKey]; ok {
+		t.Error("Queries spanning services should use the full planning pipeline")
+	}
+	if len(plan.SubQueries) != 2 {
+		t.Errorf("Expected one sub-query per service, got %d", len(plan.SubQueries))
+	}
+}
+
+func BenchmarkPlanner_CreateExecutionPlan_SingleService(b *testing.B) {
+	query := parseTestQuery(b, "query Users { a: users(first: 5) { id name } me { id } }")
+	services := singleServiceTestServices()
+	planner := NewPlanner(&MockLogger{})
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := planner.CreateExecutionPlan(ctx, query, services); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// requiresMultiProviderEntities shipping 的 estimate 依赖 inventory 提供的 weight 和 pricing 提供的 price
+func requiresMultiProviderEntities() []types.FederatedEntity {
+	key := types.KeyDirective{Fields: "upc"}
+	external := types.EntityDirectives{External: &types.ExternalDirective{}}
+	return []types.FederatedEntity{
+		{
+			TypeName:    "Product",
+			ServiceName: "shipping",
+			Directives:  types.EntityDirectives{Keys: []types.KeyDirective{key}},
+			Fields: []types.FederatedField{
+				{Name: "upc", Type: "String!"},
+				{Name: "weight", Type: "Int", Directives: external},
+				{Name: "price", Type: "Int", Directives: external},
+				{
+					Name: "estimate",
+					Type: "Int",
+					Directives: types.EntityDirectives{
+						Requires: &types.RequiresDirective{Fields: "weight price"},
+					},
+				},
+			},
+		},
+		{
+			TypeName:    "Product",
+			ServiceName: "inventory",
+			Directives:  types.EntityDirectives{Keys: []types.KeyDirective{key}},
+			Fields:      []types.FederatedField{{Name: "upc", Type: "String!"}, {Name: "weight", Type: "Int"}},
+		},
+		{
+			TypeName:    "Product",
+			ServiceName: "pricing",
+			Directives:  types.EntityDirectives{Keys: []types.KeyDirective{key}},
+			Fields:      []types.FederatedField{{Name: "upc", Type: "String!"}, {Name: "price", Type: "Int"}},
+		},
+	}
+}
+
+func TestPlanner_CreateFederationExecutionPlan_RequiresMultipleProviders(t *testing.T) {
+	planner := NewPlanner(&MockLogger{}).(*Planner)
+	query := parseTestQuery(t, "{ product { estimate } }")
+
+	plan, err := planner.CreateFederationExecutionPlan(context.Background(), query, requiresMultiProviderEntities())
+	if err != nil {
+		t.Fatalf("CreateFederationExecutionPlan() error = %v", err)
+	}
+
+	dependencies := append([]string(nil), plan.Dependencies["shipping"]...)
+	sort.Strings(dependencies)
+	if !reflect.DeepEqual(dependencies, []string{"inventory", "pricing"}) {
+		t.Errorf("Expected shipping to depend on inventory and pricing, got %v", plan.Dependencies)
+	}
+	if plan.Metadata[FederationPlanMetadataKey] != true {
+		t.Errorf("Expected federation plan marker in metadata, got %v", plan.Metadata)
+	}
+
+	// 同一个必需字段由多个服务提供时依赖所有提供者
+	entities := requiresMultiProviderEntities()
+	entities[0].Fields[3].Directives.Requires.Fields = "weight"
+	entities[2].Fields = append(entities[2].Fields, types.FederatedField{Name: "weight", Type: "Int"})
+	plan, err = planner.CreateFederationExecutionPlan(context.Background(), query, entities)
+	if err != nil {
+		t.Fatalf("CreateFederationExecutionPlan() error = %v", err)
+	}
+	if len(plan.Dependencies["shipping"]) != 2 {
+		t.Errorf("Expected shipping to wait for every provider of weight, got %v", plan.Dependencies)
+	}
+}
+
+func TestPlanner_ElideTypenameOnly(t *testing.T) {
+	planner := NewPlannerWithConfig(&PlannerConfig{ElideTypenameOnlyFetches: true}, &MockLogger{}).(*Planner)
+	entityQuery := func(selection string) string {
+		return "query($representations: [_Any!]!) { _entities(representations: $representations) { ... on Product { " + selection + " } } }"
+	}
+
+	// 字段拆分后只剩 __typename 的子查询和实体查询
+	subQueries := []types.SubQuery{
+		{ServiceName: "catalog", Query: "query { __typename ... on Query { kind: __typename } }"},
+		{ServiceName: "reviews", Query: "query { topReviews { __typename } }"},
+	}
+	fetches := []types.EntityFetch{
+		{ServiceName: "inventory", TypeName: "Product", Query: entityQuery("__typename kind: __typename")},
+		{ServiceName: "pricing", TypeName: "Product", Query: entityQuery("__typename price")},
+		{ServiceName: "shipping", TypeName: "Product", Query: entityQuery("...ProductType")},
+	}
+
+	keptSubQueries, keptFetches, elided := planner.elideTypenameOnly(subQueries, fetches)
+	if elided != 2 {
+		t.Errorf("Expected 2 elided calls, got %d", elided)
+	}
+	if len(keptSubQueries) != 1 || keptSubQueries[0].ServiceName != "reviews" {
+		t.Errorf("Expected only the reviews sub-query to remain, got %+v", keptSubQueries)
+	}
+	var services []string
+	for _, fetch := range keptFetches {
+		services = append(services, fetch.ServiceName)
+	}
+	if !reflect.DeepEqual(services, []string{"pricing", "shipping"}) {
+		t.Errorf("Expected fetches selecting real fields or fragments to remain, got %v", services)
+	}
+	if len(subQueries) != 2 || subQueries[0].ServiceName != "catalog" {
+		t.Error("Expected the input sub-queries not to be modified")
+	}
+
+	// 计划至少保留一个子查询
+	keptSubQueries, _, elided = planner.elideTypenameOnly(subQueries[:1], nil)
+	if len(keptSubQueries) != 1 || elided != 0 {
+		t.Errorf("Expected the last sub-query to be kept, got %+v", keptSubQueries)
+	}
+}
+
+func TestPlanner_ElideTypenameOnly_PrunesDependencies(t *testing.T) {
+	planner := NewPlannerWithConfig(&PlannerConfig{ElideTypenameOnlyFetches: true}, &MockLogger{}).(*Planner)
+
+	// reviews 按服务名推断依赖 users，而 users 的子查询只剩 __typename 被省略
+	subQueries := []types.SubQuery{
+		{ServiceName: "users", Query: "query { __typename }", Timeout: time.Second},
+		{ServiceName: "reviews", Query: "query { topReviews { body } }", Timeout: time.Second},
+	}
+	dependencies := map[string][]string{"reviews": {"users"}}
+
+	kept, _, elided := planner.elideTypenameOnly(subQueries, nil)
+	if elided != 1 {
+		t.Fatalf("Expected the users sub-query to be elided, got %+v", kept)
+	}
+
+	// 与 CreateExecutionPlan 相同，依赖在省略之后按剩余的子查询裁剪
+	plan := &types.ExecutionPlan{SubQueries: kept, Dependencies: pruneDependencies(dependencies, kept)}
+	if err := planner.ValidatePlan(plan); err != nil {
+		t.Errorf("Expected plan without the elided dependency to validate, got %v", err)
+	}
+	if len(plan.Dependencies) != 0 {
+		t.Errorf("Expected dependency on the elided service to be pruned, got %v", plan.Dependencies)
+	}
+
+	// 省略之前裁剪会留下指向已省略服务的依赖
+	stale := &types.ExecutionPlan{SubQueries: kept, Dependencies: pruneDependencies(dependencies, subQueries)}
+	if err := planner.ValidatePlan(stale); err == nil {
+		t.Error("Expected a dependency on an elided service to fail validation")
+	}
+}
+
+func TestPlanner_PruneUndefinedFields(t *testing.T) {
+	// reviews 声明了 User.email 但没有 @key，组合模式中存在该字段，却无法从 users 拆分出去
+	services := []types.ServiceConfig{
+		{Name: "users", Endpoint: "http://users:4001", Schema: "type Query { users: [User] } type User { id: ID! name: String }", Timeout: time.Second},
+		{Name: "reviews", Endpoint: "http://reviews:4002", Schema: "type User { id: ID! email: String }", Timeout: time.Second},
+	}
+	input := "{ users { id name email ...Contact } } fragment Contact on User { email }"
+
+	plan, err := NewPlannerWithConfig(&PlannerConfig{UndefinedFieldPolicy: UndefinedFieldPrune}, &MockLogger{}).
+		CreateExecutionPlan(context.Background(), parseTestQuery(t, input), services)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.SubQueries) != 1 || plan.SubQueries[0].ServiceName != "users" {
+		t.Fatalf("Expected a single users sub-query, got %+v", plan.SubQueries)
+	}
+	query := plan.SubQueries[0].Query
+	if strings.Contains(query, "email") || !strings.Contains(query, "name") {
+		t.Errorf("Expected email to be pruned and name kept, got %q", query)
+	}
+	// 片段只剩被删除的字段时补 __typename，保持选择集有效
+	if _, report := astparser.ParseGraphqlDocumentString(query); report.HasErrors() {
+		t.Errorf("Expected pruned sub-query to stay valid, got %q", query)
+	}
+	if pruned := plan.Metadata[PrunedFieldsMetadataKey]; !reflect.DeepEqual(pruned, []string{"users:User.email"}) {
+		t.Errorf("Expected pruned field to be reported, got %v", pruned)
+	}
+
+	// 只被删除字段引用的变量定义和取值一并删除
+	parsed := parseTestQuery(t, "query Q($size: Int) { users { id email(format: $size) } }")
+	parsed.Variables = map[string]interface{}{"size": 10}
+	plan, err = NewPlannerWithConfig(&PlannerConfig{UndefinedFieldPolicy: UndefinedFieldPrune}, &MockLogger{}).
+		CreateExecutionPlan(context.Background(), parsed, services)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if query := plan.SubQueries[0].Query; strings.Contains(query, "$size") {
+		t.Errorf("Expected unused variable definition to be removed, got %q", query)
+	}
+	if _, exists := plan.SubQueries[0].Variables["size"]; exists {
+		t.Errorf("Expected unused variable value to be removed, got %v", plan.SubQueries[0].Variables)
+	}
+
+	// error 策略下规划失败并给出未定义的字段
+	_, err = NewPlannerWithConfig(&PlannerConfig{UndefinedFieldPolicy: UndefinedFieldError}, &MockLogger{}).
+		CreateExecutionPlan(context.Background(), parseTestQuery(t, input), services)
+	var planningErr *errors.FederationError
+	if !stderrors.As(err, &planningErr) {
+		t.Fatalf("Expected planning error, got %v", err)
+	}
+	if planningErr.Extensions["reason"] != "UNDEFINED_FIELD" || !reflect.DeepEqual(planningErr.Extensions["fields"], []string{"User.email"}) {
+		t.Errorf("Unexpected diagnostics: %v", planningErr.Extensions)
+	}
+
+	// 默认原样发送
+	plan, err = NewPlanner(&MockLogger{}).CreateExecutionPlan(context.Background(), parseTestQuery(t, input), services)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plan.SubQueries[0].Query != input {
+		t.Errorf("Expected query to be forwarded unchanged by default, got %q", plan.SubQueries[0].Query)
+	}
+}
@@ -0,0 +1,80 @@
+package planner
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// RootResponseKeys 返回查询中 operationName 所选操作（为空时取第一个操作）的根字段响应键（别名优先）。
+// 带 @skip/@include 的字段可能被合法省略，不计入；内联片段和片段展开中的根字段一并计入。
+// 查询无法解析或找不到操作时返回 nil
+func RootResponseKeys(query, operationName string) []string {
+	document, report := astparser.ParseGraphqlDocumentString(query)
+	if report.HasErrors() {
+		return nil
+	}
+	operationRef := findOperationRef(&document, operationName)
+	if operationRef == -1 {
+		return nil
+	}
+
+	keys := []string{}
+	seen := make(map[string]bool)
+	visited := make(map[int]bool)
+	var collect func(selectionSet int)
+	collect = func(selectionSet int) {
+		if selectionSet == -1 || visited[selectionSet] {
+			return
+		}
+		visited[selectionSet] = true
+
+		for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+			selection := document.Selections[selectionRef]
+			switch selection.Kind {
+			case ast.SelectionKindField:
+				if hasConditionalDirective(&document, document.Fields[selection.Ref].Directives.Refs) {
+					continue
+				}
+				key := document.FieldAliasOrNameString(selection.Ref)
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			case ast.SelectionKindInlineFragment:
+				inlineFragment := document.InlineFragments[selection.Ref]
+				if !hasConditionalDirective(&document, inlineFragment.Directives.Refs) {
+					collect(inlineFragment.SelectionSet)
+				}
+			case ast.SelectionKindFragmentSpread:
+				if hasConditionalDirective(&document, document.FragmentSpreads[selection.Ref].Directives.Refs) {
+					continue
+				}
+				if ref, exists := document.FragmentDefinitionRef(document.FragmentSpreadNameBytes(selection.Ref)); exists {
+					collect(document.FragmentDefinitions[ref].SelectionSet)
+				}
+			}
+		}
+	}
+	collect(document.OperationDefinitions[operationRef].SelectionSet)
+	return keys
+}
+
+// setRootKeys 为计划中的子查询记录根字段响应键，执行阶段补齐缺失字段和软超时填充时直接使用
+func setRootKeys(subQueries []federationtypes.SubQuery) {
+	for i := range subQueries {
+		subQueries[i].RootKeys = RootResponseKeys(subQueries[i].Query, subQueries[i].OperationName)
+	}
+}
+
+// hasConditionalDirective 判断是否带有 @skip 或 @include 指令
+func hasConditionalDirective(document *ast.Document, directiveRefs []int) bool {
+	for _, directiveRef := range directiveRefs {
+		switch document.DirectiveNameString(directiveRef) {
+		case "skip", "include":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package planner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRootResponseKeys(t *testing.T) {
+	query := `query ($withBooks: Boolean!) {
+		me: user { id }
+		user { id }
+		books @include(if: $withBooks) { isbn }
+		... on Query { shelves { id } }
+		...Extra
+	}
+	fragment Extra on Query { authors { id } }`
+
+	got := RootResponseKeys(query, "")
+	want := []string{"me", "user", "shelves", "authors"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RootResponseKeys() = %v, want %v", got, want)
+	}
+
+	// 多操作文档按操作名选择
+	multi := "query A { users { id } } query B { books { isbn } }"
+	if keys := RootResponseKeys(multi, "B"); !reflect.DeepEqual(keys, []string{"books"}) {
+		t.Errorf("Expected keys of operation B, got %v", keys)
+	}
+	if keys := RootResponseKeys(multi, "C"); keys != nil {
+		t.Errorf("Expected no keys for an unknown operation, got %v", keys)
+	}
+
+	if keys := RootResponseKeys("{ broken", ""); keys != nil {
+		t.Errorf("Expected no keys for an unparsable query, got %v", keys)
+	}
+}
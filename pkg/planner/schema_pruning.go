@@ -0,0 +1,215 @@
+package planner
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astprinter"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// PrunedFieldsMetadataKey 执行计划元数据中记录被删除字段的键，值为 service:Type.field 列表
+const PrunedFieldsMetadataKey = "prunedFields"
+
+// UndefinedFieldPolicy 子查询选择了目标服务模式未定义的字段时的处理策略
+type UndefinedFieldPolicy string
+
+const (
+	UndefinedFieldIgnore UndefinedFieldPolicy = "ignore" // 原样发送，由子图报错
+	UndefinedFieldPrune  UndefinedFieldPolicy = "prune"  // 从子查询中删除并记录在计划元数据中
+	UndefinedFieldError  UndefinedFieldPolicy = "error"  // 规划失败
+)
+
+// schemaPruner 按目标服务模式检查单个子查询的选择
+type schemaPruner struct {
+	document  *ast.Document
+	types     *serviceTypes
+	undefined []string // 未定义字段的 Type.field 坐标，按首次出现顺序去重
+	seen      map[string]bool
+	fragments map[string]bool
+}
+
+// pruneUndefinedFields 按目标服务的模式检查子查询和实体查询，删除服务未定义的字段，
+// 或在 error 策略下返回规划错误。返回被删除字段的 service:Type.field 坐标（已排序）
+func (p *Planner) pruneUndefinedFields(subQueries []federationtypes.SubQuery, fetches []federationtypes.EntityFetch, services []federationtypes.ServiceConfig) ([]string, error) {
+	policy := p.config.UndefinedFieldPolicy
+	if policy != UndefinedFieldPrune && policy != UndefinedFieldError {
+		return nil, nil
+	}
+
+	var pruned []string
+	check := func(serviceName string, query *string, variables *map[string]interface{}) error {
+		types := p.schemaTypes(p.findServiceByName(serviceName, services))
+		if types == nil {
+			return nil
+		}
+
+		printed, undefined := pruneQuery(*query, types)
+		if len(undefined) == 0 {
+			return nil
+		}
+		if policy == UndefinedFieldError {
+			return errors.NewPlanningError("sub-query selects fields not defined by service "+serviceName+": "+strings.Join(undefined, ", "),
+				errors.WithService(serviceName),
+				errors.WithExtension("reason", "UNDEFINED_FIELD"),
+				errors.WithExtension("service", serviceName),
+				errors.WithExtension("fields", undefined),
+			)
+		}
+
+		p.logger.Warn("Pruned fields not defined by target service", "service", serviceName, "fields", undefined)
+		*query = printed
+		*variables = referencedVariables(printed, *variables)
+		for _, coordinate := range undefined {
+			pruned = append(pruned, serviceName+":"+coordinate)
+		}
+		return nil
+	}
+
+	for i := range subQueries {
+		if err := check(subQueries[i].ServiceName, &subQueries[i].Query, &subQueries[i].Variables); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fetches {
+		if err := check(fetches[i].ServiceName, &fetches[i].Query, &fetches[i].Variables); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(pruned)
+	return pruned, nil
+}
+
+// pruneQuery 删除查询中服务未定义的字段并重新打印，只被删除字段引用的变量定义一并删除，
+// 没有未定义字段或查询无法解析时原样返回
+func pruneQuery(query string, types *serviceTypes) (string, []string) {
+	document, report := astparser.ParseGraphqlDocumentString(query)
+	if report.HasErrors() {
+		return query, nil
+	}
+
+	pruner := &schemaPruner{document: &document, types: types, seen: make(map[string]bool), fragments: make(map[string]bool)}
+	for i := range document.OperationDefinitions {
+		operation := document.OperationDefinitions[i]
+		pruner.pruneSelectionSet(operation.SelectionSet, types.rootType(operation.OperationType))
+	}
+	if len(pruner.undefined) == 0 {
+		return query, nil
+	}
+	if err := removeUnusedVariableDefinitions(&document); err != nil {
+		return query, nil
+	}
+
+	printed, err := astprinter.PrintString(&document)
+	if err != nil {
+		return query, nil
+	}
+	return printed, pruner.undefined
+}
+
+// removeUnusedVariableDefinitions 删除操作体中不再引用的变量定义，子图会拒绝声明了却未使用的变量
+func removeUnusedVariableDefinitions(document *ast.Document) error {
+	for i := range document.OperationDefinitions {
+		operation := &document.OperationDefinitions[i]
+		if !operation.HasVariableDefinitions {
+			continue
+		}
+
+		// 暂时隐藏变量定义后打印，得到只包含引用位置的操作文本
+		operation.HasVariableDefinitions = false
+		body, err := astprinter.PrintString(document)
+		if err != nil {
+			return err
+		}
+
+		kept := operation.VariableDefinitions.Refs[:0]
+		for _, definitionRef := range operation.VariableDefinitions.Refs {
+			if referencesVariable(body, document.VariableDefinitionNameString(definitionRef)) {
+				kept = append(kept, definitionRef)
+			}
+		}
+		operation.VariableDefinitions.Refs = kept
+		operation.HasVariableDefinitions = len(kept) > 0
+	}
+	return nil
+}
+
+// referencedVariables 返回查询仍然引用的变量取值，未引用的变量不再随请求发送
+func referencedVariables(query string, variables map[string]interface{}) map[string]interface{} {
+	if variables == nil {
+		return nil
+	}
+
+	kept := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		if referencesVariable(query, name) {
+			kept[name] = value
+		}
+	}
+	return kept
+}
+
+// pruneSelectionSet 删除 typeName 类型上服务未定义的字段。类型未知时（接口、联合或
+// _entities 的返回类型）不检查当前层，只进入带类型条件的片段；删空的选择集补 __typename
+func (s *schemaPruner) pruneSelectionSet(selectionSet int, typeName string) {
+	if selectionSet == -1 {
+		return
+	}
+
+	known := s.types.fields[typeName] != nil
+	kept := make([]int, 0, len(s.document.SelectionSets[selectionSet].SelectionRefs))
+	for _, selectionRef := range s.document.SelectionSets[selectionSet].SelectionRefs {
+		selection := s.document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			fieldName := s.document.FieldNameString(selection.Ref)
+			if known && !isMetaField(fieldName) && !s.types.providesKeyField(typeName, fieldName) {
+				if coordinate := typeName + "." + fieldName; !s.seen[coordinate] {
+					s.seen[coordinate] = true
+					s.undefined = append(s.undefined, coordinate)
+				}
+				continue
+			}
+			if field := s.document.Fields[selection.Ref]; field.HasSelections {
+				s.pruneSelectionSet(field.SelectionSet, s.types.fields[typeName][fieldName])
+			}
+
+		case ast.SelectionKindInlineFragment:
+			condition := typeName
+			if s.document.InlineFragmentHasTypeCondition(selection.Ref) {
+				condition = s.document.InlineFragmentTypeConditionNameString(selection.Ref)
+			}
+			s.pruneSelectionSet(s.document.InlineFragments[selection.Ref].SelectionSet, condition)
+
+		case ast.SelectionKindFragmentSpread:
+			name := s.document.FragmentSpreadNameString(selection.Ref)
+			if s.fragments[name] {
+				break
+			}
+			s.fragments[name] = true
+			for i := range s.document.FragmentDefinitions {
+				if s.document.FragmentDefinitionNameString(i) == name {
+					s.pruneSelectionSet(s.document.FragmentDefinitions[i].SelectionSet, s.document.FragmentDefinitionTypeNameString(i))
+				}
+			}
+		}
+		kept = append(kept, selectionRef)
+	}
+
+	if len(kept) == 0 {
+		typename := s.document.AddField(ast.Field{Name: s.document.Input.AppendInputString("__typename")})
+		kept = append(kept, s.document.AddSelectionToDocument(ast.Selection{Kind: ast.SelectionKindField, Ref: typename.Ref}))
+	}
+	s.document.SelectionSets[selectionSet].SelectionRefs = kept
+}
+
+// isMetaField 判断是否为内省字段或 Federation 保留字段，这些字段不在服务模式中声明
+func isMetaField(fieldName string) bool {
+	return strings.HasPrefix(fieldName, "__") || fieldName == "_entities" || fieldName == "_service"
+}
@@ -0,0 +1,218 @@
+package planner
+
+import (
+	"time"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// SingleServiceMetadataKey 执行计划元数据中标记原样转发计划的键
+const SingleServiceMetadataKey = "singleService"
+
+// planSingleService 所有根字段都只由同一个服务提供时，生成将原始查询原样转发给该服务的单子查询计划，
+// 参数、片段和别名保持不变。需要实体拆分或字段超时拆分时返回 nil，由完整流程规划
+func (p *Planner) planSingleService(query *federationtypes.ParsedQuery, services []federationtypes.ServiceConfig) (*federationtypes.ExecutionPlan, error) {
+	document, ok := query.AST.(*ast.Document)
+	if !ok || len(document.Input.RawBytes) == 0 {
+		return nil, nil
+	}
+
+	operationRef := findOperationRef(document, query.Operation)
+	if operationRef == -1 {
+		return nil, nil
+	}
+
+	// 操作级指令（如 @timeout、@noCache）由网关处理，原样转发会把它们发给子图
+	if len(document.OperationDefinitions[operationRef].Directives.Refs) > 0 {
+		return nil, nil
+	}
+
+	// 宽松验证放行的非标准内容（多余的操作、未使用的片段、未定义的指令）会被子图拒绝，由完整流程重建子查询
+	if !isForwardable(document, operationRef) {
+		return nil, nil
+	}
+
+	// 根类型的 __typename 由引擎本地填充，原样转发会把它发给子图
+	rootFields, hasTypename := collectRootFields(document, document.OperationDefinitions[operationRef].SelectionSet, make(map[string]bool))
+	if len(rootFields) == 0 || hasTypename {
+		return nil, nil
+	}
+
+	// 嵌套字段随根字段路由，只需映射根字段
+	fieldPaths := make([]federationtypes.FieldPath, 0, len(rootFields))
+	for _, name := range rootFields {
+		fieldPaths = append(fieldPaths, federationtypes.FieldPath{Path: []string{name}})
+	}
+	fieldMappings, err := p.analyzeFieldMappings(fieldPaths, services)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := ""
+	for _, owners := range fieldMappings {
+		if len(owners) != 1 || (serviceName != "" && owners[0] != serviceName) {
+			return nil, nil
+		}
+		serviceName = owners[0]
+	}
+
+	service := p.findServiceByName(serviceName, services)
+	if service == nil || len(p.fieldBudgets(query)) > 0 {
+		return nil, nil
+	}
+
+	entityFetches, err := p.planEntityFetches(query, fieldMappings, services)
+	if err != nil || entityFetches != nil {
+		return nil, err
+	}
+
+	timeout := service.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	subQueries := []federationtypes.SubQuery{{
+		ServiceName:   service.Name,
+		Query:         string(document.Input.RawBytes),
+		OperationName: query.Operation,
+		Variables:     query.Variables,
+		Path:          []string{service.Name},
+		Timeout:       timeout,
+		RetryCount:    service.MaxRetries,
+	}}
+
+	pruned, err := p.pruneUndefinedFields(subQueries, nil, services)
+	if err != nil {
+		return nil, err
+	}
+	p.elideStaticTypenames(subQueries, services)
+
+	plan := &federationtypes.ExecutionPlan{
+		SubQueries:    subQueries,
+		Dependencies:  make(map[string][]string),
+		MergeStrategy: p.determineMergeStrategy(subQueries),
+		Metadata: map[string]interface{}{
+			"totalFields":            len(rootFields),
+			"totalServices":          len(services),
+			"createdAt":              time.Now(),
+			"planComplexity":         p.calculatePlanComplexity(subQueries),
+			SingleServiceMetadataKey: true,
+		},
+	}
+	if len(pruned) > 0 {
+		plan.Metadata[PrunedFieldsMetadataKey] = pruned
+	}
+	setRootKeys(plan.SubQueries)
+	plan.Metadata[PlanHashMetadataKey] = PlanHash(plan)
+
+	p.logger.Info("Execution plan created for single service", "service", service.Name, "rootFields", len(rootFields))
+
+	return plan, nil
+}
+
+// isForwardable 判断文档能否原样转发：只有一个操作，每个片段定义都被该操作引用，
+// 且只使用 @skip/@include 指令
+func isForwardable(document *ast.Document, operationRef int) bool {
+	if len(document.OperationDefinitions) != 1 {
+		return false
+	}
+
+	for i := range document.Directives {
+		switch document.DirectiveNameString(i) {
+		case "skip", "include":
+		default:
+			return false
+		}
+	}
+
+	used := make(map[string]bool)
+	collectFragmentSpreads(document, document.OperationDefinitions[operationRef].SelectionSet, used)
+	for i := range document.FragmentDefinitions {
+		if !used[document.FragmentDefinitionNameString(i)] {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFragmentSpreads 收集选择集中直接或间接引用的片段名
+func collectFragmentSpreads(document *ast.Document, selectionSet int, used map[string]bool) {
+	if selectionSet == -1 {
+		return
+	}
+
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			if field := document.Fields[selection.Ref]; field.HasSelections {
+				collectFragmentSpreads(document, field.SelectionSet, used)
+			}
+
+		case ast.SelectionKindInlineFragment:
+			if inlineFragment := document.InlineFragments[selection.Ref]; inlineFragment.HasSelections {
+				collectFragmentSpreads(document, inlineFragment.SelectionSet, used)
+			}
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if used[name] {
+				continue
+			}
+			used[name] = true
+
+			fragmentRef, ok := document.FragmentDefinitionRef(document.FragmentSpreadNameBytes(selection.Ref))
+			if ok && document.FragmentDefinitions[fragmentRef].HasSelections {
+				collectFragmentSpreads(document, document.FragmentDefinitions[fragmentRef].SelectionSet, used)
+			}
+		}
+	}
+}
+
+// collectRootFields 收集操作选择集中的根字段名，展开内联片段和片段引用，并报告是否选择了根类型的 __typename
+func collectRootFields(document *ast.Document, selectionSet int, visitedFragments map[string]bool) ([]string, bool) {
+	var fields []string
+	hasTypename := false
+
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		nested := -1
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			if name := document.FieldNameString(selection.Ref); name == "__typename" {
+				hasTypename = true
+			} else {
+				fields = append(fields, name)
+			}
+
+		case ast.SelectionKindInlineFragment:
+			if inlineFragment := document.InlineFragments[selection.Ref]; inlineFragment.HasSelections {
+				nested = inlineFragment.SelectionSet
+			}
+
+		case ast.SelectionKindFragmentSpread:
+			name := document.FragmentSpreadNameString(selection.Ref)
+			if visitedFragments[name] {
+				continue
+			}
+			visitedFragments[name] = true
+
+			fragmentRef, ok := document.FragmentDefinitionRef(document.FragmentSpreadNameBytes(selection.Ref))
+			if ok && document.FragmentDefinitions[fragmentRef].HasSelections {
+				nested = document.FragmentDefinitions[fragmentRef].SelectionSet
+			}
+		}
+
+		if nested != -1 {
+			nestedFields, nestedTypename := collectRootFields(document, nested, visitedFragments)
+			fields = append(fields, nestedFields...)
+			hasTypename = hasTypename || nestedTypename
+		}
+	}
+
+	return fields, hasTypename
+}
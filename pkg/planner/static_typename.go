@@ -0,0 +1,88 @@
+package planner
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astprinter"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// elideStaticTypenames 从子查询中删除具体对象类型位置上选择的 __typename，由引擎按模式本地填充。
+// 接口和联合类型位置、命名片段内以及带指令的 __typename 保留，删除后选择集为空时也保留。
+// 计划包含实体查询时不处理，构造表示需要子图返回的 __typename
+func (p *Planner) elideStaticTypenames(subQueries []federationtypes.SubQuery, services []federationtypes.ServiceConfig) {
+	for i := range subQueries {
+		types := p.schemaTypes(p.findServiceByName(subQueries[i].ServiceName, services))
+		if types == nil {
+			continue
+		}
+		if query, ok := stripStaticTypenames(subQueries[i].Query, types); ok {
+			subQueries[i].Query = query
+		}
+	}
+}
+
+// stripStaticTypenames 删除查询中具体类型位置的 __typename 并重新打印，没有可删除的字段时返回 false
+func stripStaticTypenames(query string, types *serviceTypes) (string, bool) {
+	document, report := astparser.ParseGraphqlDocumentString(query)
+	if report.HasErrors() {
+		return query, false
+	}
+
+	removed := false
+	for i := range document.OperationDefinitions {
+		operation := document.OperationDefinitions[i]
+		if stripSelectionTypenames(&document, operation.SelectionSet, types.rootType(operation.OperationType), types) {
+			removed = true
+		}
+	}
+	if !removed {
+		return query, false
+	}
+
+	printed, err := astprinter.PrintString(&document)
+	if err != nil {
+		return query, false
+	}
+	return printed, true
+}
+
+// stripSelectionTypenames 处理 typeName 类型（静态已知的具体类型）上的选择集，返回是否删除了字段
+func stripSelectionTypenames(document *ast.Document, selectionSet int, typeName string, types *serviceTypes) bool {
+	if selectionSet == -1 || types.fields[typeName] == nil {
+		return false
+	}
+
+	nestedRemoved := false
+	kept := make([]int, 0, len(document.SelectionSets[selectionSet].SelectionRefs))
+	for _, selectionRef := range document.SelectionSets[selectionSet].SelectionRefs {
+		selection := document.Selections[selectionRef]
+
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			fieldName := document.FieldNameString(selection.Ref)
+			if fieldName == "__typename" && !document.FieldHasDirectives(selection.Ref) {
+				continue
+			}
+			if field := document.Fields[selection.Ref]; field.HasSelections {
+				if stripSelectionTypenames(document, field.SelectionSet, types.fields[typeName][fieldName], types) {
+					nestedRemoved = true
+				}
+			}
+
+		case ast.SelectionKindInlineFragment:
+			// 具体类型上的内联片段只能以自身为类型条件
+			if stripSelectionTypenames(document, document.InlineFragments[selection.Ref].SelectionSet, typeName, types) {
+				nestedRemoved = true
+			}
+		}
+		kept = append(kept, selectionRef)
+	}
+
+	if len(kept) == 0 || len(kept) == len(document.SelectionSets[selectionSet].SelectionRefs) {
+		return nestedRemoved
+	}
+	document.SelectionSets[selectionSet].SelectionRefs = kept
+	return true
+}
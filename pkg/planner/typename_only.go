@@ -0,0 +1,91 @@
+package planner
+
+import (
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// ElidedTypenameMetadataKey 执行计划元数据中记录省略的 __typename 子查询数量的键
+const ElidedTypenameMetadataKey = "elidedTypenameFetches"
+
+// elideTypenameOnly 省略只选择 __typename 的子查询和实体查询。根类型和实体类型都是具体类型，
+// 根类型的 __typename 由引擎按模式本地填充，实体对象在构造表示时已带有 __typename，
+// 向子图发起这类调用没有意义。计划至少保留一个子查询
+func (p *Planner) elideTypenameOnly(subQueries []federationtypes.SubQuery, fetches []federationtypes.EntityFetch) ([]federationtypes.SubQuery, []federationtypes.EntityFetch, int) {
+	elided := 0
+
+	keptSubQueries := subQueries[:0:0]
+	for i, subQuery := range subQueries {
+		remaining := len(keptSubQueries) + len(subQueries) - i - 1
+		if remaining > 0 && selectsOnlyTypename(subQuery.Query, false) {
+			p.logger.Debug("Eliding __typename-only sub-query", "service", subQuery.ServiceName)
+			elided++
+			continue
+		}
+		keptSubQueries = append(keptSubQueries, subQuery)
+	}
+
+	keptFetches := fetches[:0:0]
+	for _, fetch := range fetches {
+		if selectsOnlyTypename(fetch.Query, true) {
+			p.logger.Debug("Eliding __typename-only entity fetch", "service", fetch.ServiceName, "type", fetch.TypeName)
+			elided++
+			continue
+		}
+		keptFetches = append(keptFetches, fetch)
+	}
+
+	return keptSubQueries, keptFetches, elided
+}
+
+// selectsOnlyTypename 判断查询是否只选择 __typename；entities 为 true 时检查 _entities 字段内的选择。
+// 无法解析或包含片段引用的查询视为需要调用
+func selectsOnlyTypename(query string, entities bool) bool {
+	document, report := astparser.ParseGraphqlDocumentString(query)
+	if report.HasErrors() || len(document.OperationDefinitions) != 1 {
+		return false
+	}
+
+	selectionSet := document.OperationDefinitions[0].SelectionSet
+	if entities {
+		refs := document.SelectionSets[selectionSet].SelectionRefs
+		if len(refs) != 1 || document.Selections[refs[0]].Kind != ast.SelectionKindField {
+			return false
+		}
+		fieldRef := document.Selections[refs[0]].Ref
+		if document.FieldNameString(fieldRef) != "_entities" || !document.Fields[fieldRef].HasSelections {
+			return false
+		}
+		selectionSet = document.Fields[fieldRef].SelectionSet
+	}
+
+	return onlyTypenameSelections(&document, selectionSet)
+}
+
+// onlyTypenameSelections 判断选择集（含内联片段）是否非空且只包含 __typename 字段
+func onlyTypenameSelections(document *ast.Document, selectionSet int) bool {
+	refs := document.SelectionSets[selectionSet].SelectionRefs
+	if len(refs) == 0 {
+		return false
+	}
+
+	for _, selectionRef := range refs {
+		selection := document.Selections[selectionRef]
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			if document.FieldNameString(selection.Ref) != "__typename" {
+				return false
+			}
+		case ast.SelectionKindInlineFragment:
+			fragment := document.InlineFragments[selection.Ref]
+			if !fragment.HasSelections || !onlyTypenameSelections(document, fragment.SelectionSet) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
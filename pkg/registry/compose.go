@@ -0,0 +1,494 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/parser"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// composedType 组合后的单个类型
+type composedType struct {
+	kind        string // type、interface、input、enum、union、scalar
+	description string
+	interfaces  []string          // 实现的接口
+	members     []string          // 枚举值或联合成员，按首次出现排序
+	fields      []string          // 字段名，按首次出现排序
+	definitions map[string]string // 字段名或枚举值 -> 打印后的定义
+	returnTypes map[string]string // 字段名 -> 返回的命名类型
+}
+
+// schemaComposer 将各子图模式组合为对外暴露的模式，
+// 去掉联邦内部类型、@external 字段和 @inaccessible 元素
+type schemaComposer struct {
+	types        map[string]*composedType
+	inaccessible map[string]bool
+
+	enumValues     map[string]map[string][]string // 枚举名 -> 服务名 -> 该服务定义的全部枚举值（含 @inaccessible）
+	shareableEnums map[string]bool                // 任一服务标记了 @shareable 的枚举，允许各服务的值不同
+}
+
+// composeSDL 组合子图模式，子图按服务名排序以保证输出稳定。
+// 同名枚举在各服务中的值集合不一致且未标记 @shareable 时返回验证错误
+func composeSDL(schemas []*SchemaInfo) (string, error) {
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].ServiceName < schemas[j].ServiceName
+	})
+
+	composer := &schemaComposer{
+		types:          make(map[string]*composedType),
+		inaccessible:   make(map[string]bool),
+		enumValues:     make(map[string]map[string][]string),
+		shareableEnums: make(map[string]bool),
+	}
+	for _, schema := range schemas {
+		if schema.AST != nil {
+			composer.add(schema.ServiceName, schema.AST, schema.Link, schema.RootTypes)
+		}
+	}
+
+	if err := composer.validateEnums(); err != nil {
+		return "", err
+	}
+	return composer.print(), nil
+}
+
+// add 合并单个子图的类型定义与扩展，子图通过 schema 定义重命名的根类型合并到标准的 Query、Mutation、Subscription
+func (c *schemaComposer) add(serviceName string, document *ast.Document, link *federationtypes.LinkDirective, rootTypes map[string]string) {
+	standardNames := make(map[string]string)
+	for operationType, standardName := range parser.DefaultRootOperationTypes() {
+		if typeName := rootTypes[operationType]; typeName != "" && typeName != standardName {
+			standardNames[typeName] = standardName
+		}
+	}
+	objectTypeName := func(name string) string {
+		if standardName, ok := standardNames[name]; ok {
+			return standardName
+		}
+		return name
+	}
+
+	hasDirective := func(refs []int, name string) bool {
+		for _, ref := range refs {
+			if link.ResolveDirectiveName(document.DirectiveNameString(ref)) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	addFields := func(typeName, kind string, description ast.Description, directives, interfaces, fields []int) {
+		if hasDirective(directives, "inaccessible") {
+			c.inaccessible[typeName] = true
+		}
+		composed := c.typeNamed(typeName, kind, document, description)
+		for _, ref := range interfaces {
+			composed.interfaces = appendUnique(composed.interfaces, document.TypeNameString(ref))
+		}
+		for _, ref := range fields {
+			definition := document.FieldDefinitions[ref]
+			name := document.FieldDefinitionNameString(ref)
+			if name == "_service" || name == "_entities" || hasDirective(definition.Directives.Refs, "external") {
+				continue
+			}
+			if hasDirective(definition.Directives.Refs, "inaccessible") {
+				c.inaccessible[typeName+"."+name] = true
+				continue
+			}
+			if _, ok := composed.definitions[name]; ok {
+				continue
+			}
+			composed.fields = append(composed.fields, name)
+			composed.definitions[name] = printFieldDefinition(document, ref)
+			composed.returnTypes[name] = document.ResolveTypeNameString(definition.Type)
+		}
+	}
+	for i, definition := range document.ObjectTypeDefinitions {
+		addFields(objectTypeName(document.ObjectTypeDefinitionNameString(i)), "type", definition.Description,
+			definition.Directives.Refs, definition.ImplementsInterfaces.Refs, definition.FieldsDefinition.Refs)
+	}
+	for i, extension := range document.ObjectTypeExtensions {
+		addFields(objectTypeName(document.ObjectTypeExtensionNameString(i)), "type", extension.Description,
+			extension.Directives.Refs, extension.ImplementsInterfaces.Refs, extension.FieldsDefinition.Refs)
+	}
+	for i, definition := range document.InterfaceTypeDefinitions {
+		addFields(document.InterfaceTypeDefinitionNameString(i), "interface", definition.Description,
+			definition.Directives.Refs, definition.ImplementsInterfaces.Refs, definition.FieldsDefinition.Refs)
+	}
+	for i, extension := range document.InterfaceTypeExtensions {
+		addFields(document.InterfaceTypeExtensionNameString(i), "interface", extension.Description,
+			extension.Directives.Refs, extension.ImplementsInterfaces.Refs, extension.FieldsDefinition.Refs)
+	}
+
+	addInputFields := func(typeName string, definition ast.InputObjectTypeDefinition) {
+		if hasDirective(definition.Directives.Refs, "inaccessible") {
+			c.inaccessible[typeName] = true
+		}
+		composed := c.typeNamed(typeName, "input", document, definition.Description)
+		for _, ref := range definition.InputFieldsDefinition.Refs {
+			name := document.InputValueDefinitionNameString(ref)
+			if hasDirective(document.InputValueDefinitions[ref].Directives.Refs, "inaccessible") {
+				c.inaccessible[typeName+"."+name] = true
+				continue
+			}
+			if _, ok := composed.definitions[name]; ok {
+				continue
+			}
+			composed.fields = append(composed.fields, name)
+			composed.definitions[name] = printInputValueDefinition(document, ref)
+			composed.returnTypes[name] = document.ResolveTypeNameString(document.InputValueDefinitions[ref].Type)
+		}
+	}
+	for i, definition := range document.InputObjectTypeDefinitions {
+		addInputFields(document.InputObjectTypeDefinitionNameString(i), definition)
+	}
+	for i, extension := range document.InputObjectTypeExtensions {
+		addInputFields(document.InputObjectTypeExtensionNameString(i), extension.InputObjectTypeDefinition)
+	}
+
+	addEnumValues := func(typeName string, definition ast.EnumTypeDefinition) {
+		if hasDirective(definition.Directives.Refs, "inaccessible") {
+			c.inaccessible[typeName] = true
+		}
+		if hasDirective(definition.Directives.Refs, "shareable") {
+			c.shareableEnums[typeName] = true
+		}
+		if c.enumValues[typeName] == nil {
+			c.enumValues[typeName] = make(map[string][]string)
+		}
+		composed := c.typeNamed(typeName, "enum", document, definition.Description)
+		for _, ref := range definition.EnumValuesDefinition.Refs {
+			name := document.EnumValueDefinitionNameString(ref)
+			c.enumValues[typeName][serviceName] = appendUnique(c.enumValues[typeName][serviceName], name)
+			if hasDirective(document.EnumValueDefinitions[ref].Directives.Refs, "inaccessible") {
+				c.inaccessible[typeName+"."+name] = true
+				continue
+			}
+			if _, ok := composed.definitions[name]; ok {
+				continue
+			}
+			composed.members = append(composed.members, name)
+			composed.definitions[name] = printEnumValueDefinition(document, ref)
+		}
+	}
+	for i, definition := range document.EnumTypeDefinitions {
+		addEnumValues(document.EnumTypeDefinitionNameString(i), definition)
+	}
+	for i, extension := range document.EnumTypeExtensions {
+		addEnumValues(document.EnumTypeExtensionNameString(i), extension.EnumTypeDefinition)
+	}
+
+	addUnionMembers := func(typeName string, definition ast.UnionTypeDefinition) {
+		if hasDirective(definition.Directives.Refs, "inaccessible") {
+			c.inaccessible[typeName] = true
+		}
+		composed := c.typeNamed(typeName, "union", document, definition.Description)
+		for _, ref := range definition.UnionMemberTypes.Refs {
+			composed.members = appendUnique(composed.members, document.TypeNameString(ref))
+		}
+	}
+	for i, definition := range document.UnionTypeDefinitions {
+		addUnionMembers(document.UnionTypeDefinitionNameString(i), definition)
+	}
+	for i, extension := range document.UnionTypeExtensions {
+		addUnionMembers(document.UnionTypeExtensionNameString(i), extension.UnionTypeDefinition)
+	}
+
+	for i, definition := range document.ScalarTypeDefinitions {
+		typeName := document.ScalarTypeDefinitionNameString(i)
+		if hasDirective(definition.Directives.Refs, "inaccessible") {
+			c.inaccessible[typeName] = true
+		}
+		c.typeNamed(typeName, "scalar", document, definition.Description)
+	}
+}
+
+// validateEnums 比较各服务定义的同名枚举，值集合不同且未标记 @shareable 的枚举无法组合：
+// 子图可能返回其他服务不认识的枚举值。相同的定义允许重复出现
+func (c *schemaComposer) validateEnums() error {
+	var names []string
+	for name := range c.enumValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conflicts := make(map[string]map[string][]string)
+	var descriptions []string
+	for _, name := range names {
+		byService := c.enumValues[name]
+		if len(byService) < 2 || c.shareableEnums[name] {
+			continue
+		}
+
+		services := make([]string, 0, len(byService))
+		for service := range byService {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+
+		values := make(map[string][]string, len(services))
+		conflicting := false
+		for _, service := range services {
+			sorted := append([]string(nil), byService[service]...)
+			sort.Strings(sorted)
+			values[service] = sorted
+			if strings.Join(sorted, " ") != strings.Join(values[services[0]], " ") {
+				conflicting = true
+			}
+		}
+		if !conflicting {
+			continue
+		}
+
+		conflicts[name] = values
+		var parts []string
+		for _, service := range services {
+			parts = append(parts, fmt.Sprintf("%s: %s", service, strings.Join(values[service], " ")))
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", name, strings.Join(parts, "; ")))
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return errors.NewValidationError("enum values conflict across services: "+strings.Join(descriptions, ", "),
+		errors.WithExtension("reason", "ENUM_VALUE_MISMATCH"),
+		errors.WithExtension("enums", conflicts),
+	)
+}
+
+// typeNamed 返回已组合的类型，不存在时创建；首个非空描述生效
+func (c *schemaComposer) typeNamed(name, kind string, document *ast.Document, description ast.Description) *composedType {
+	composed, ok := c.types[name]
+	if !ok {
+		composed = &composedType{
+			kind:        kind,
+			definitions: make(map[string]string),
+			returnTypes: make(map[string]string),
+		}
+		c.types[name] = composed
+	}
+	if composed.description == "" {
+		composed.description = descriptionString(document, description)
+	}
+	return composed
+}
+
+// print 按根类型优先、其余按名称排序输出组合后的 SDL
+func (c *schemaComposer) print() string {
+	names := make([]string, 0, len(c.types))
+	for name := range c.types {
+		if c.isExposed(name) {
+			names = append(names, name)
+		}
+	}
+	rootOrder := map[string]int{"Query": 0, "Mutation": 1, "Subscription": 2}
+	sort.Slice(names, func(i, j int) bool {
+		iOrder, iRoot := rootOrder[names[i]]
+		jOrder, jRoot := rootOrder[names[j]]
+		if iRoot || jRoot {
+			if iRoot && jRoot {
+				return iOrder < jOrder
+			}
+			return iRoot
+		}
+		return names[i] < names[j]
+	})
+
+	var buf strings.Builder
+	for _, name := range names {
+		composed := c.types[name]
+
+		var body []string
+		switch composed.kind {
+		case "type", "interface", "input":
+			for _, field := range composed.fields {
+				if !c.inaccessible[name+"."+field] && c.isExposed(composed.returnTypes[field]) {
+					body = append(body, composed.definitions[field])
+				}
+			}
+		case "enum":
+			for _, value := range composed.members {
+				if !c.inaccessible[name+"."+value] {
+					body = append(body, composed.definitions[value])
+				}
+			}
+		}
+		if composed.kind != "scalar" && composed.kind != "union" && len(body) == 0 {
+			continue
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		writeDescription(&buf, composed.description, "")
+		buf.WriteString(composed.kind + " " + name)
+
+		switch composed.kind {
+		case "scalar":
+			buf.WriteString("\n")
+			continue
+		case "union":
+			var members []string
+			for _, member := range composed.members {
+				if c.isExposed(member) {
+					members = append(members, member)
+				}
+			}
+			buf.WriteString(" = " + strings.Join(members, " | ") + "\n")
+			continue
+		}
+
+		var interfaces []string
+		for _, iface := range composed.interfaces {
+			if c.isExposed(iface) {
+				interfaces = append(interfaces, iface)
+			}
+		}
+		if len(interfaces) > 0 {
+			buf.WriteString(" implements " + strings.Join(interfaces, " & "))
+		}
+		buf.WriteString(" {\n")
+		for _, line := range body {
+			buf.WriteString(line)
+		}
+		buf.WriteString("}\n")
+	}
+
+	return buf.String()
+}
+
+// isExposed 判断命名类型是否对外暴露，内置标量总是暴露
+func (c *schemaComposer) isExposed(name string) bool {
+	if c.inaccessible[name] || isFederationInternalType(name) {
+		return false
+	}
+	if _, ok := c.types[name]; ok {
+		return true
+	}
+	switch name {
+	case "Int", "Float", "String", "Boolean", "ID":
+		return true
+	}
+	return false
+}
+
+// isFederationInternalType 判断是否为联邦规范引入的内部类型
+func isFederationInternalType(name string) bool {
+	return strings.HasPrefix(name, "_") ||
+		strings.HasPrefix(name, "link__") ||
+		strings.HasPrefix(name, "federation__") ||
+		name == "FieldSet"
+}
+
+// printFieldDefinition 打印字段定义，只保留 @deprecated 指令
+func printFieldDefinition(document *ast.Document, ref int) string {
+	definition := document.FieldDefinitions[ref]
+
+	var buf strings.Builder
+	writeDescription(&buf, descriptionString(document, definition.Description), "  ")
+	buf.WriteString("  " + document.FieldDefinitionNameString(ref))
+	if definition.HasArgumentsDefinitions && len(definition.ArgumentsDefinition.Refs) > 0 {
+		arguments := make([]string, 0, len(definition.ArgumentsDefinition.Refs))
+		for _, argumentRef := range definition.ArgumentsDefinition.Refs {
+			arguments = append(arguments, printInputValue(document, argumentRef))
+		}
+		buf.WriteString("(" + strings.Join(arguments, ", ") + ")")
+	}
+	buf.WriteString(": " + printType(document, definition.Type))
+	buf.WriteString(printDeprecated(document, definition.Directives.Refs))
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// printInputValueDefinition 打印输入对象字段定义
+func printInputValueDefinition(document *ast.Document, ref int) string {
+	var buf strings.Builder
+	writeDescription(&buf, descriptionString(document, document.InputValueDefinitions[ref].Description), "  ")
+	buf.WriteString("  " + printInputValue(document, ref) + "\n")
+	return buf.String()
+}
+
+// printEnumValueDefinition 打印枚举值定义
+func printEnumValueDefinition(document *ast.Document, ref int) string {
+	definition := document.EnumValueDefinitions[ref]
+
+	var buf strings.Builder
+	writeDescription(&buf, descriptionString(document, definition.Description), "  ")
+	buf.WriteString("  " + document.EnumValueDefinitionNameString(ref))
+	buf.WriteString(printDeprecated(document, definition.Directives.Refs))
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// printInputValue 打印参数或输入字段的名称、类型和默认值
+func printInputValue(document *ast.Document, ref int) string {
+	definition := document.InputValueDefinitions[ref]
+	text := document.InputValueDefinitionNameString(ref) + ": " + printType(document, definition.Type)
+	if definition.DefaultValue.IsDefined {
+		var buf bytes.Buffer
+		if err := document.PrintValue(definition.DefaultValue.Value, &buf); err == nil {
+			text += " = " + buf.String()
+		}
+	}
+	return text + printDeprecated(document, definition.Directives.Refs)
+}
+
+// printType 打印类型引用
+func printType(document *ast.Document, typeRef int) string {
+	var buf bytes.Buffer
+	_ = document.PrintType(typeRef, &buf)
+	return buf.String()
+}
+
+// printDeprecated 打印 @deprecated 指令，其余指令不对外暴露
+func printDeprecated(document *ast.Document, directiveRefs []int) string {
+	for _, ref := range directiveRefs {
+		if document.DirectiveNameString(ref) != "deprecated" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := document.PrintDirective(ref, &buf); err != nil {
+			return " @deprecated"
+		}
+		return " " + buf.String()
+	}
+	return ""
+}
+
+// descriptionString 返回描述文本，未定义时为空
+func descriptionString(document *ast.Document, description ast.Description) string {
+	if !description.IsDefined {
+		return ""
+	}
+	return document.Input.ByteSliceString(description.Content)
+}
+
+// writeDescription 以块字符串形式输出描述
+func writeDescription(buf *strings.Builder, description, indent string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+	buf.WriteString(indent + `"""` + "\n")
+	for _, line := range strings.Split(strings.ReplaceAll(description, `"""`, `\"""`), "\n") {
+		buf.WriteString(indent + strings.TrimSpace(line) + "\n")
+	}
+	buf.WriteString(indent + `"""` + "\n")
+}
+
+// appendUnique 追加不重复的元素
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -4,27 +4,38 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	stderrors "errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
 	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
 
 	"envoy-wasm-graphql-federation/pkg/errors"
+	"envoy-wasm-graphql-federation/pkg/parser"
 	federationtypes "envoy-wasm-graphql-federation/pkg/types"
 )
 
 // SchemaRegistry 实现GraphQL模式注册表
 type SchemaRegistry struct {
-	logger              federationtypes.Logger
-	config              *RegistryConfig
-	schemas             sync.Map // map[string]*SchemaInfo
-	federatedSchema     *federationtypes.Schema
-	federatedSchemaTime time.Time
-	mutex               sync.RWMutex
-	metrics             *RegistryMetrics
+	logger       federationtypes.Logger
+	config       *RegistryConfig
+	schemas      sync.Map // map[string]*SchemaInfo
+	pinned       sync.Map // map[string]string 固定的模式版本
+	federated    atomic.Pointer[federatedSnapshot]
+	rebuildMutex sync.Mutex // 串行化组合过程，读者不参与
+	mutex        sync.RWMutex
+	metrics      *RegistryMetrics
+}
+
+// federatedSnapshot 已组合联邦模式的不可变快照
+type federatedSnapshot struct {
+	schema  *federationtypes.Schema
+	builtAt time.Time
 }
 
 // RegistryConfig 注册表配置
@@ -71,6 +82,21 @@ type SchemaInfo struct {
 	Directives       map[string]*DirectiveInfo `json:"directives"`
 	Metadata         map[string]interface{}    `json:"metadata"`
 	ValidationErrors []string                  `json:"validationErrors,omitempty"`
+
+	Link *federationtypes.LinkDirective `json:"link,omitempty"` // Federation v2 @link 声明
+
+	RootTypes map[string]string `json:"rootTypes"` // 操作类型（query、mutation、subscription）到根类型名的映射
+}
+
+// federationV1 未声明 @link 的子图视为 Federation v1
+const federationV1 = "1"
+
+// FederationVersion 返回子图的联邦版本
+func (s *SchemaInfo) FederationVersion() string {
+	if s.Link == nil || s.Link.Version == "" {
+		return federationV1
+	}
+	return s.Link.Version
 }
 
 // TypeInfo 类型信息
@@ -110,6 +136,8 @@ type DirectiveInfo struct {
 	Arguments   map[string]interface{} `json:"arguments,omitempty"`
 	Locations   []string               `json:"locations,omitempty"`
 	Repeatable  bool                   `json:"repeatable,omitempty"`
+
+	Instances []map[string]interface{} `json:"instances,omitempty"` // 可重复指令多次应用时每次的参数
 }
 
 // RegistryMetrics 注册表指标
@@ -178,6 +206,23 @@ func (r *SchemaRegistry) RegisterSchema(serviceName string, schema string) error
 
 	r.logger.Debug("Registering schema", "service", serviceName, "size", len(schema))
 
+	// 检查固定版本，拒绝与固定版本不一致的模式
+	if value, ok := r.pinned.Load(serviceName); ok {
+		pinned := value.(string)
+		if version := r.generateSchemaVersion(schema); version != pinned {
+			r.logger.Warn("Rejecting schema that does not match pinned version",
+				"service", serviceName,
+				"pinned", pinned,
+				"version", version,
+			)
+			return errors.NewSchemaError(fmt.Sprintf("schema version %s does not match pinned version %s for service %s", version, pinned, serviceName),
+				errors.WithService(serviceName),
+				errors.WithExtension("pinnedVersion", pinned),
+				errors.WithExtension("version", version),
+			)
+		}
+	}
+
 	// 验证模式
 	if err := r.ValidateSchema(schema); err != nil {
 		return errors.NewSchemaError("schema validation failed: " + err.Error())
@@ -189,22 +234,51 @@ func (r *SchemaRegistry) RegisterSchema(serviceName string, schema string) error
 		return errors.NewSchemaError("schema parsing failed: " + err.Error())
 	}
 
-	// 存储模式
+	// 存储模式并重新构建联邦模式。替换、组合和回滚在同一把锁内完成，
+	// 避免并发注册时回滚覆盖另一次注册存入的模式
+	r.rebuildMutex.Lock()
+	previous, hadPrevious := r.schemas.Load(serviceName)
 	r.schemas.Store(serviceName, schemaInfo)
 
-	// 更新指标
-	r.updateMetrics()
-
-	// 重新构建联邦模式
-	if err := r.rebuildFederatedSchema(); err != nil {
+	if err := r.composeLocked(); err != nil {
+		var compositionErr *errors.FederationError
+		if stderrors.As(err, &compositionErr) && compositionErr.Code == errors.ErrCodeValidation {
+			// 与已注册的子图冲突的模式不生效，恢复该服务之前的模式
+			if hadPrevious {
+				r.schemas.Store(serviceName, previous)
+			} else {
+				r.schemas.Delete(serviceName)
+			}
+			r.rebuildMutex.Unlock()
+			r.mutex.Lock()
+			r.metrics.ValidationErrors++
+			r.mutex.Unlock()
+			r.logger.Warn("Rejecting schema that conflicts with registered services", "service", serviceName, "error", err)
+			return err
+		}
 		r.logger.Warn("Failed to rebuild federated schema", "error", err)
 		// 不返回错误，允许单个服务注册成功
 	}
+	r.rebuildMutex.Unlock()
+
+	// 更新指标
+	r.updateMetrics()
 
 	r.logger.Info("Schema registered successfully", "service", serviceName)
 	return nil
 }
 
+// PinSchemaVersion 固定服务的模式版本，空字符串表示取消固定
+func (r *SchemaRegistry) PinSchemaVersion(serviceName string, version string) {
+	if version == "" {
+		r.pinned.Delete(serviceName)
+		return
+	}
+
+	r.pinned.Store(serviceName, version)
+	r.logger.Info("Schema version pinned", "service", serviceName, "version", version)
+}
+
 // GetSchema 获取模式
 func (r *SchemaRegistry) GetSchema(serviceName string) (*federationtypes.SchemaInfo, error) {
 	if serviceName == "" {
@@ -220,6 +294,7 @@ func (r *SchemaRegistry) GetSchema(serviceName string) (*federationtypes.SchemaI
 			Version:     schemaInfo.Version,
 			UpdatedAt:   schemaInfo.LastUpdated,
 			Types:       r.convertTypes(schemaInfo.Types),
+			RootTypes:   copyRootTypes(schemaInfo.RootTypes),
 		}
 		return typesSchemaInfo, nil
 	}
@@ -232,9 +307,10 @@ func (r *SchemaRegistry) convertTypes(registryTypes map[string]*TypeInfo) []fede
 	var types []federationtypes.TypeInfo
 	for _, typeInfo := range registryTypes {
 		convertedType := federationtypes.TypeInfo{
-			Name:   typeInfo.Name,
-			Kind:   typeInfo.Kind,
-			Fields: r.convertFields(typeInfo.Fields),
+			Name:       typeInfo.Name,
+			Kind:       typeInfo.Kind,
+			Fields:     r.convertFields(typeInfo.Fields),
+			Directives: r.convertDirectives(typeInfo.Directives),
 		}
 		types = append(types, convertedType)
 	}
@@ -246,15 +322,29 @@ func (r *SchemaRegistry) convertFields(registryFields map[string]*FieldInfo) []f
 	var fields []federationtypes.FieldInfo
 	for _, fieldInfo := range registryFields {
 		convertedField := federationtypes.FieldInfo{
-			Name: fieldInfo.Name,
-			Type: fieldInfo.Type,
-			Args: r.convertArgs(fieldInfo.Arguments),
+			Name:       fieldInfo.Name,
+			Type:       fieldInfo.Type,
+			Args:       r.convertArgs(fieldInfo.Arguments),
+			Directives: r.convertDirectives(fieldInfo.Directives),
 		}
 		fields = append(fields, convertedField)
 	}
 	return fields
 }
 
+// convertDirectives 转换已应用的指令，保留每个指令的参数
+func (r *SchemaRegistry) convertDirectives(registryDirectives map[string]*DirectiveInfo) map[string]map[string]interface{} {
+	if len(registryDirectives) == 0 {
+		return nil
+	}
+
+	directives := make(map[string]map[string]interface{}, len(registryDirectives))
+	for name, directiveInfo := range registryDirectives {
+		directives[name] = directiveInfo.Arguments
+	}
+	return directives
+}
+
 // convertArgs 转换参数信息
 func (r *SchemaRegistry) convertArgs(registryArgs map[string]*ArgumentInfo) []federationtypes.ArgumentInfo {
 	var args []federationtypes.ArgumentInfo
@@ -269,25 +359,29 @@ func (r *SchemaRegistry) convertArgs(registryArgs map[string]*ArgumentInfo) []fe
 }
 
 // GetFederatedSchema 获取联邦模式
+// 读取无锁：过期时由获得组合权的调用方重建，其余读者继续使用旧快照
 func (r *SchemaRegistry) GetFederatedSchema() (*federationtypes.Schema, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	if r.federatedSchema == nil {
+	snapshot := r.federated.Load()
+	if snapshot == nil {
 		return nil, errors.NewSchemaError("federated schema not available")
 	}
 
 	// 检查缓存是否过期
-	if r.config.CacheEnabled && time.Since(r.federatedSchemaTime) > r.config.CacheTTL {
-		r.mutex.RUnlock()
-		err := r.rebuildFederatedSchema()
-		r.mutex.RLock()
+	if r.config.CacheEnabled && time.Since(snapshot.builtAt) > r.config.CacheTTL {
+		if !r.rebuildMutex.TryLock() {
+			// 正在重新组合，返回当前快照
+			return snapshot.schema, nil
+		}
+		err := r.composeLocked()
+		r.rebuildMutex.Unlock()
 		if err != nil {
-			return nil, err
+			r.logger.Warn("Failed to recompose federated schema, serving previous version", "error", err)
+			return snapshot.schema, nil
 		}
+		snapshot = r.federated.Load()
 	}
 
-	return r.federatedSchema, nil
+	return snapshot.schema, nil
 }
 
 // ValidateSchema 验证模式
@@ -353,6 +447,13 @@ func (r *SchemaRegistry) parseSchema(serviceName, schema string) (*SchemaInfo, e
 		Subscriptions: make(map[string]*FieldInfo),
 		Directives:    make(map[string]*DirectiveInfo),
 		Metadata:      make(map[string]interface{}),
+		Link:          parser.ExtractLinkDirective(&document),
+		RootTypes:     parser.RootOperationTypes(&document),
+	}
+
+	schemaInfo.Metadata["federationVersion"] = schemaInfo.FederationVersion()
+	if schemaInfo.Link != nil {
+		schemaInfo.Metadata["linkImports"] = schemaInfo.Link.Imports
 	}
 
 	// 提取类型信息
@@ -369,45 +470,143 @@ func (r *SchemaRegistry) parseSchema(serviceName, schema string) (*SchemaInfo, e
 
 // extractTypes 提取类型信息
 func (r *SchemaRegistry) extractTypes(document *ast.Document, schemaInfo *SchemaInfo) {
-	// 由于GraphQL AST API版本兼容性问题，这里简化处理
-	// 返回基本的类型信息
 	r.logger.Debug("Extracting types", "service", schemaInfo.ServiceName)
+
+	for i := range document.ObjectTypeDefinitions {
+		r.extractObjectType(document, i, schemaInfo)
+	}
+	for i := range document.InterfaceTypeDefinitions {
+		r.extractInterfaceType(document, i, schemaInfo)
+	}
+	for i := range document.UnionTypeDefinitions {
+		r.extractUnionType(document, i, schemaInfo)
+	}
+	for i := range document.EnumTypeDefinitions {
+		r.extractEnumType(document, i, schemaInfo)
+	}
+	for i := range document.ScalarTypeDefinitions {
+		r.extractScalarType(document, i, schemaInfo)
+	}
 }
 
 // extractObjectType 提取对象类型
 func (r *SchemaRegistry) extractObjectType(document *ast.Document, typeRef int, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting object type", "service", schemaInfo.ServiceName)
+	typeDef := document.ObjectTypeDefinitions[typeRef]
+	name := document.ObjectTypeDefinitionNameString(typeRef)
+
+	schemaInfo.Types[name] = &TypeInfo{
+		Name:       name,
+		Kind:       "OBJECT",
+		Fields:     r.extractObjectFields(document, typeDef.FieldsDefinition.Refs),
+		Interfaces: r.extractTypeNames(document, typeDef.ImplementsInterfaces.Refs),
+		Directives: r.extractAppliedDirectives(document, typeDef.Directives.Refs),
+	}
 }
 
 // extractInterfaceType 提取接口类型
 func (r *SchemaRegistry) extractInterfaceType(document *ast.Document, typeRef int, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting interface type", "service", schemaInfo.ServiceName)
+	typeDef := document.InterfaceTypeDefinitions[typeRef]
+	name := document.InterfaceTypeDefinitionNameString(typeRef)
+
+	schemaInfo.Types[name] = &TypeInfo{
+		Name:       name,
+		Kind:       "INTERFACE",
+		Fields:     r.extractObjectFields(document, typeDef.FieldsDefinition.Refs),
+		Interfaces: r.extractTypeNames(document, typeDef.ImplementsInterfaces.Refs),
+		Directives: r.extractAppliedDirectives(document, typeDef.Directives.Refs),
+	}
 }
 
 // extractUnionType 提取联合类型
 func (r *SchemaRegistry) extractUnionType(document *ast.Document, typeRef int, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting union type", "service", schemaInfo.ServiceName)
+	typeDef := document.UnionTypeDefinitions[typeRef]
+	name := document.UnionTypeDefinitionNameString(typeRef)
+
+	schemaInfo.Types[name] = &TypeInfo{
+		Name:       name,
+		Kind:       "UNION",
+		UnionTypes: r.extractTypeNames(document, typeDef.UnionMemberTypes.Refs),
+		Directives: r.extractAppliedDirectives(document, typeDef.Directives.Refs),
+	}
 }
 
 // extractEnumType 提取枚举类型
 func (r *SchemaRegistry) extractEnumType(document *ast.Document, typeRef int, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting enum type", "service", schemaInfo.ServiceName)
+	typeDef := document.EnumTypeDefinitions[typeRef]
+	name := document.EnumTypeDefinitionNameString(typeRef)
+
+	var values []string
+	for _, valueRef := range typeDef.EnumValuesDefinition.Refs {
+		values = append(values, document.EnumValueDefinitionNameString(valueRef))
+	}
+
+	schemaInfo.Types[name] = &TypeInfo{
+		Name:       name,
+		Kind:       "ENUM",
+		EnumValues: values,
+		Directives: r.extractAppliedDirectives(document, typeDef.Directives.Refs),
+	}
 }
 
 // extractScalarType 提取标量类型
 func (r *SchemaRegistry) extractScalarType(document *ast.Document, typeRef int, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting scalar type", "service", schemaInfo.ServiceName)
+	name := document.ScalarTypeDefinitionNameString(typeRef)
+
+	schemaInfo.Types[name] = &TypeInfo{
+		Name:       name,
+		Kind:       "SCALAR",
+		Directives: r.extractAppliedDirectives(document, document.ScalarTypeDefinitions[typeRef].Directives.Refs),
+	}
+}
+
+// extractTypeNames 提取类型引用列表中的类型名
+func (r *SchemaRegistry) extractTypeNames(document *ast.Document, typeRefs []int) []string {
+	var names []string
+	for _, typeRef := range typeRefs {
+		names = append(names, document.ResolveTypeNameString(typeRef))
+	}
+	return names
 }
 
-// extractRootFields 提取根字段
+// extractRootFields 按 schema 定义声明的根类型名提取根字段，包括根类型扩展中的字段
 func (r *SchemaRegistry) extractRootFields(document *ast.Document, schemaInfo *SchemaInfo) {
-	// 简化处理，避免AST API兼容性问题
-	r.logger.Debug("Extracting root fields", "service", schemaInfo.ServiceName)
+	r.logger.Debug("Extracting root fields", "service", schemaInfo.ServiceName, "rootTypes", schemaInfo.RootTypes)
+
+	rootFields := map[string]map[string]*FieldInfo{
+		schemaInfo.RootTypes["query"]:        schemaInfo.Queries,
+		schemaInfo.RootTypes["mutation"]:     schemaInfo.Mutations,
+		schemaInfo.RootTypes["subscription"]: schemaInfo.Subscriptions,
+	}
+	collect := func(typeName string, fieldRefs []int) {
+		fields, ok := rootFields[typeName]
+		if !ok {
+			return
+		}
+		for name, field := range r.extractObjectFields(document, fieldRefs) {
+			if _, exists := fields[name]; !exists {
+				fields[name] = field
+			}
+		}
+	}
+
+	for i := range document.ObjectTypeDefinitions {
+		collect(document.ObjectTypeDefinitionNameString(i), document.ObjectTypeDefinitions[i].FieldsDefinition.Refs)
+	}
+	for i := range document.ObjectTypeExtensions {
+		collect(document.ObjectTypeExtensionNameString(i), document.ObjectTypeExtensions[i].FieldsDefinition.Refs)
+	}
+}
+
+// copyRootTypes 复制根类型映射
+func copyRootTypes(rootTypes map[string]string) map[string]string {
+	if rootTypes == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(rootTypes))
+	for operationType, typeName := range rootTypes {
+		copied[operationType] = typeName
+	}
+	return copied
 }
 
 // findRootTypeDefinitions 查找根类型定义
@@ -416,21 +615,57 @@ func (r *SchemaRegistry) findRootTypeDefinitions(document *ast.Document) map[str
 	return make(map[string]int)
 }
 
-// extractObjectFields 提取对象类型字段
-func (r *SchemaRegistry) extractObjectFields(document *ast.Document, typeRef int) map[string]*FieldInfo {
-	// 简化处理，返回空映射
-	return make(map[string]*FieldInfo)
+// extractObjectFields 提取对象或接口类型字段
+func (r *SchemaRegistry) extractObjectFields(document *ast.Document, fieldRefs []int) map[string]*FieldInfo {
+	fields := make(map[string]*FieldInfo, len(fieldRefs))
+
+	for _, fieldRef := range fieldRefs {
+		name := document.FieldDefinitionNameString(fieldRef)
+		fields[name] = &FieldInfo{
+			Name:        name,
+			Type:        r.extractFieldTypeFromDefinition(document, fieldRef),
+			Arguments:   r.extractFieldArguments(document, fieldRef),
+			Description: document.FieldDefinitionDescriptionString(fieldRef),
+			Directives:  r.extractFieldDirectives(document, fieldRef),
+		}
+	}
+
+	return fields
 }
 
 // extractFieldArguments 提取字段参数
-func (r *SchemaRegistry) extractFieldArguments(document *ast.Document, fieldDef ast.FieldDefinition) map[string]*ArgumentInfo {
-	// 简化处理，返回空映射
-	return make(map[string]*ArgumentInfo)
+func (r *SchemaRegistry) extractFieldArguments(document *ast.Document, fieldRef int) map[string]*ArgumentInfo {
+	arguments := make(map[string]*ArgumentInfo)
+
+	for _, argRef := range document.FieldDefinitions[fieldRef].ArgumentsDefinition.Refs {
+		argDef := document.InputValueDefinitions[argRef]
+		name := document.InputValueDefinitionNameString(argRef)
+		arguments[name] = &ArgumentInfo{
+			Name:         name,
+			Type:         r.extractArgumentType(document, argDef.Type),
+			DefaultValue: r.extractDefaultValue(document, argDef),
+			Description:  document.InputValueDefinitionDescriptionString(argRef),
+		}
+	}
+
+	return arguments
 }
 
-// extractDirectives 提取指令
+// extractDirectives 提取指令定义，并补充联邦指令
 func (r *SchemaRegistry) extractDirectives(document *ast.Document, schemaInfo *SchemaInfo) {
-	// 简化处理，直接添加联邦指令
+	for i := range document.DirectiveDefinitions {
+		directiveDef := document.DirectiveDefinitions[i]
+		name := document.DirectiveDefinitionNameString(i)
+
+		schemaInfo.Directives[name] = &DirectiveInfo{
+			Name:        name,
+			Description: document.DirectiveDefinitionDescriptionString(i),
+			Arguments:   r.extractDirectiveArguments(document, directiveDef),
+			Locations:   r.extractDirectiveLocations(document, directiveDef),
+			Repeatable:  directiveDef.Repeatable.IsRepeatable,
+		}
+	}
+
 	r.ensureFederationDirectives(schemaInfo)
 }
 
@@ -475,6 +710,13 @@ func (r *SchemaRegistry) ensureFederationDirectives(schemaInfo *SchemaInfo) {
 		},
 	}
 
+	// Federation v2 子图还可以使用以下指令
+	if schemaInfo.Link.IsFederationV2() {
+		for name, directive := range federationV2Directives() {
+			federationDirectives[name] = directive
+		}
+	}
+
 	// 添加缺失的联邦指令
 	for name, directive := range federationDirectives {
 		if _, exists := schemaInfo.Directives[name]; !exists {
@@ -483,66 +725,206 @@ func (r *SchemaRegistry) ensureFederationDirectives(schemaInfo *SchemaInfo) {
 	}
 }
 
-// extractDirectiveArguments 提取指令参数
+// federationV2Directives 返回 Federation v2 新增的指令
+func federationV2Directives() map[string]*DirectiveInfo {
+	return map[string]*DirectiveInfo{
+		"link": {
+			Name:        "link",
+			Description: "Links definitions from an external specification to this schema.",
+			Arguments: map[string]interface{}{
+				"url":    "String!",
+				"import": "[link__Import]",
+			},
+			Locations: []string{"SCHEMA"},
+		},
+		"shareable": {
+			Name:        "shareable",
+			Description: "Indicates that an object type's field is allowed to be resolved by multiple subgraphs.",
+			Arguments:   make(map[string]interface{}),
+			Locations:   []string{"OBJECT", "FIELD_DEFINITION"},
+		},
+		"inaccessible": {
+			Name:        "inaccessible",
+			Description: "Indicates that a definition in the subgraph schema should be omitted from the router's API schema.",
+			Arguments:   make(map[string]interface{}),
+			Locations:   []string{"FIELD_DEFINITION", "OBJECT", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "SCALAR", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION", "ARGUMENT_DEFINITION"},
+		},
+		"override": {
+			Name:        "override",
+			Description: "Indicates that an object field is now resolved by this subgraph instead of another subgraph.",
+			Arguments: map[string]interface{}{
+				"from": "String!",
+			},
+			Locations: []string{"FIELD_DEFINITION"},
+		},
+		"tag": {
+			Name:        "tag",
+			Description: "Applies arbitrary string metadata to a schema location.",
+			Arguments: map[string]interface{}{
+				"name": "String!",
+			},
+			Locations: []string{"FIELD_DEFINITION", "OBJECT", "INTERFACE", "UNION", "ARGUMENT_DEFINITION", "SCALAR", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION"},
+		},
+		"interfaceObject": {
+			Name:        "interfaceObject",
+			Description: "Indicates that an object definition serves as an abstraction of another subgraph's entity interface.",
+			Arguments:   make(map[string]interface{}),
+			Locations:   []string{"OBJECT"},
+		},
+	}
+}
+
+// extractDirectiveArguments 提取指令定义的参数类型
 func (r *SchemaRegistry) extractDirectiveArguments(document *ast.Document, directiveDef ast.DirectiveDefinition) map[string]interface{} {
-	// 简化处理，返回空映射
-	return make(map[string]interface{})
+	arguments := make(map[string]interface{})
+
+	for _, argRef := range directiveDef.ArgumentsDefinition.Refs {
+		arguments[document.InputValueDefinitionNameString(argRef)] = r.extractArgumentType(document, document.InputValueDefinitions[argRef].Type)
+	}
+
+	return arguments
 }
 
 // extractDirectiveLocations 提取指令位置
 func (r *SchemaRegistry) extractDirectiveLocations(document *ast.Document, directiveDef ast.DirectiveDefinition) []string {
-	// 简化处理，返回空列表
-	return []string{}
+	var locations []string
+
+	iterable := directiveDef.DirectiveLocations.Iterable()
+	for iterable.Next() {
+		locations = append(locations, iterable.Value().LiteralString())
+	}
+
+	return locations
 }
 
 // extractFieldType 提取字段类型
 func (r *SchemaRegistry) extractFieldType(document *ast.Document, typeRef int) string {
-	return "String"
+	return r.extractTypeFromReference(document, typeRef)
 }
 
 // extractFieldTypeFromDefinition 从字段定义提取类型
 func (r *SchemaRegistry) extractFieldTypeFromDefinition(document *ast.Document, fieldRef int) string {
-	return "String"
+	return r.extractTypeFromReference(document, document.FieldDefinitions[fieldRef].Type)
 }
 
-// extractTypeFromReference 从类型引用提取类型
+// extractTypeFromReference 从类型引用提取类型，保留列表和非空修饰
 func (r *SchemaRegistry) extractTypeFromReference(document *ast.Document, typeRef int) string {
-	return "String"
+	if typeRef == ast.InvalidRef {
+		return ""
+	}
+
+	typeBytes, err := document.PrintTypeBytes(typeRef, nil)
+	if err != nil {
+		return document.ResolveTypeNameString(typeRef)
+	}
+	return string(typeBytes)
 }
 
 // extractArgumentType 提取参数类型
 func (r *SchemaRegistry) extractArgumentType(document *ast.Document, typeRef int) string {
-	return "String"
+	return r.extractTypeFromReference(document, typeRef)
 }
 
 // extractDefaultValue 提取默认值
 func (r *SchemaRegistry) extractDefaultValue(document *ast.Document, argDef ast.InputValueDefinition) interface{} {
-	return nil
+	if !argDef.DefaultValue.IsDefined {
+		return nil
+	}
+	return r.extractArgumentValue(document, argDef.DefaultValue.Value)
 }
 
 // extractFieldDirectives 提取字段指令
-func (r *SchemaRegistry) extractFieldDirectives(document *ast.Document, fieldDef ast.FieldDefinition) map[string]*DirectiveInfo {
-	return make(map[string]*DirectiveInfo)
+func (r *SchemaRegistry) extractFieldDirectives(document *ast.Document, fieldRef int) map[string]*DirectiveInfo {
+	return r.extractAppliedDirectives(document, document.FieldDefinitions[fieldRef].Directives.Refs)
+}
+
+// extractAppliedDirectives 提取类型或字段上应用的全部指令及其参数，可重复指令的每次应用记录在 Instances 中
+func (r *SchemaRegistry) extractAppliedDirectives(document *ast.Document, directiveRefs []int) map[string]*DirectiveInfo {
+	if len(directiveRefs) == 0 {
+		return nil
+	}
+
+	directives := make(map[string]*DirectiveInfo, len(directiveRefs))
+	for _, directiveRef := range directiveRefs {
+		name := document.DirectiveNameString(directiveRef)
+		arguments := r.extractDirectiveArgumentValues(document, document.Directives[directiveRef])
+
+		existing, exists := directives[name]
+		if !exists {
+			directives[name] = &DirectiveInfo{
+				Name:      name,
+				Arguments: arguments,
+			}
+			continue
+		}
+
+		if !existing.Repeatable {
+			existing.Repeatable = true
+			existing.Instances = []map[string]interface{}{existing.Arguments}
+		}
+		existing.Instances = append(existing.Instances, arguments)
+	}
+
+	return directives
 }
 
 // extractDirectiveArgumentValues 提取指令参数值
 func (r *SchemaRegistry) extractDirectiveArgumentValues(document *ast.Document, directive ast.Directive) map[string]interface{} {
-	return make(map[string]interface{})
+	values := make(map[string]interface{}, len(directive.Arguments.Refs))
+
+	for _, argRef := range directive.Arguments.Refs {
+		values[document.ArgumentNameString(argRef)] = r.extractArgumentValue(document, document.Arguments[argRef].Value)
+	}
+
+	return values
 }
 
-// extractArgumentValue 提取参数值
+// extractArgumentValue 提取参数值，枚举值以名称字符串表示，变量以 "$name" 表示
 func (r *SchemaRegistry) extractArgumentValue(document *ast.Document, valueRef ast.Value) interface{} {
-	return nil
+	switch valueRef.Kind {
+	case ast.ValueKindString:
+		return document.StringValueContentString(valueRef.Ref)
+	case ast.ValueKindBoolean:
+		return bool(document.BooleanValue(valueRef.Ref))
+	case ast.ValueKindInteger:
+		return document.IntValueAsInt(valueRef.Ref)
+	case ast.ValueKindFloat:
+		value, err := strconv.ParseFloat(document.ValueContentString(valueRef), 64)
+		if err != nil {
+			return document.ValueContentString(valueRef)
+		}
+		return value
+	case ast.ValueKindEnum:
+		return document.EnumValueNameString(valueRef.Ref)
+	case ast.ValueKindVariable:
+		return "$" + document.VariableValueNameString(valueRef.Ref)
+	case ast.ValueKindList:
+		return r.extractListValue(document, valueRef.Ref)
+	case ast.ValueKindObject:
+		return r.extractObjectValue(document, valueRef.Ref)
+	default:
+		return nil
+	}
 }
 
 // extractListValue 提取列表值
 func (r *SchemaRegistry) extractListValue(document *ast.Document, valueRef int) []interface{} {
-	return []interface{}{}
+	refs := document.ListValues[valueRef].Refs
+	values := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, r.extractArgumentValue(document, document.Values[ref]))
+	}
+	return values
 }
 
 // extractObjectValue 提取对象值
 func (r *SchemaRegistry) extractObjectValue(document *ast.Document, valueRef int) map[string]interface{} {
-	return make(map[string]interface{})
+	refs := document.ObjectValues[valueRef].Refs
+	values := make(map[string]interface{}, len(refs))
+	for _, ref := range refs {
+		values[document.ObjectFieldNameString(ref)] = r.extractArgumentValue(document, document.ObjectFieldValue(ref))
+	}
+	return values
 }
 
 // validateSchemaStrict 严格验证模式
@@ -574,21 +956,92 @@ func (r *SchemaRegistry) updateMetrics() {
 
 // rebuildFederatedSchema 重新构建联邦模式
 func (r *SchemaRegistry) rebuildFederatedSchema() error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	r.rebuildMutex.Lock()
+	defer r.rebuildMutex.Unlock()
 
-	// 简化处理，创建一个基本的联邦模式
-	r.federatedSchema = &federationtypes.Schema{
-		SDL: "type Query { _service: String }",
+	return r.composeLocked()
+}
+
+// composeLocked 在旁路构建新模式后原子替换，调用方需持有rebuildMutex
+func (r *SchemaRegistry) composeLocked() error {
+	var schemas []*SchemaInfo
+	r.schemas.Range(func(key, value interface{}) bool {
+		schemas = append(schemas, value.(*SchemaInfo))
+		return true
+	})
+
+	// 组合各子图模式，去掉联邦内部类型与 @inaccessible 元素；无法组合时保留之前的联邦模式
+	sdl, err := composeSDL(schemas)
+	if err != nil {
+		return err
 	}
-	r.federatedSchemaTime = time.Now()
+	schema := &federationtypes.Schema{
+		SDL:               sdl,
+		FederationVersion: r.reconcileFederationVersion(),
+	}
+
+	r.federated.Store(&federatedSnapshot{
+		schema:  schema,
+		builtAt: time.Now(),
+	})
 
+	r.mutex.Lock()
 	r.metrics.FederationBuilds++
+	r.mutex.Unlock()
+
 	r.logger.Debug("Federated schema rebuilt")
 
 	return nil
 }
 
+// reconcileFederationVersion 协调 v1/v2 混合子图的联邦版本，取最高版本
+// v1 子图的实体在 v2 语义下按可解析且可共享处理，因此可以一起组合
+func (r *SchemaRegistry) reconcileFederationVersion() string {
+	version := federationV1
+	hasV1, hasV2 := false, false
+
+	r.schemas.Range(func(key, value interface{}) bool {
+		serviceVersion := value.(*SchemaInfo).FederationVersion()
+		if serviceVersion == federationV1 {
+			hasV1 = true
+		} else {
+			hasV2 = true
+		}
+		if compareFederationVersions(serviceVersion, version) > 0 {
+			version = serviceVersion
+		}
+		return true
+	})
+
+	if hasV1 && hasV2 {
+		r.logger.Info("Composing mixed Federation v1/v2 subgraphs", "version", version)
+	}
+
+	return version
+}
+
+// compareFederationVersions 比较 "major.minor" 形式的版本号
+func compareFederationVersions(a, b string) int {
+	aParts := strings.SplitN(a, ".", 2)
+	bParts := strings.SplitN(b, ".", 2)
+	for i := 0; i < 2; i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum > bNum {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
 // startAutoRefresh 启动自动刷新
 func (r *SchemaRegistry) startAutoRefresh() {
 	ticker := time.NewTicker(r.config.RefreshInterval)
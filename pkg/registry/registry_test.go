@@ -1,8 +1,12 @@
 package registry
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"envoy-wasm-graphql-federation/pkg/errors"
 )
 
 // MockLogger 实现 Logger 接口用于测试
@@ -302,3 +306,384 @@ func TestRegistryMetrics_Struct(t *testing.T) {
 		t.Errorf("Expected ValidationErrors to be 2, got %d", metrics.ValidationErrors)
 	}
 }
+
+func TestSchemaRegistry_GetFederatedSchema_ServesSnapshotDuringRecompose(t *testing.T) {
+	registry := &SchemaRegistry{
+		logger:  &MockLogger{},
+		config:  &RegistryConfig{CacheEnabled: true, CacheTTL: time.Millisecond},
+		metrics: &RegistryMetrics{},
+	}
+
+	if _, err := registry.GetFederatedSchema(); err == nil {
+		t.Fatal("Expected error before first composition")
+	}
+
+	if err := registry.rebuildFederatedSchema(); err != nil {
+		t.Fatalf("rebuildFederatedSchema() failed: %v", err)
+	}
+	previous := registry.federated.Load()
+	time.Sleep(2 * time.Millisecond)
+
+	// 组合进行中时读者不阻塞，继续获得旧快照
+	registry.rebuildMutex.Lock()
+	schema, err := registry.GetFederatedSchema()
+	registry.rebuildMutex.Unlock()
+	if err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+	if schema != previous.schema {
+		t.Error("Expected previous snapshot while recomposition is in progress")
+	}
+
+	// 过期快照由调用方重新组合并原子替换
+	if _, err := registry.GetFederatedSchema(); err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+	if registry.federated.Load() == previous {
+		t.Error("Expected stale snapshot to be swapped")
+	}
+	if registry.metrics.FederationBuilds != 2 {
+		t.Errorf("Expected 2 federation builds, got %d", registry.metrics.FederationBuilds)
+	}
+}
+
+func TestSchemaRegistry_RegisterSchema_MixedFederationVersions(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelStrict,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	v1 := `type Query { me: User } type User @key(fields: "id") { id: ID! }`
+	v2 := `extend schema @link(url: "https://specs.apollo.dev/federation/v2.3", import: ["@key", "@shareable"])
+		type Product @key(fields: "upc") { upc: String! name: String @shareable }`
+
+	if err := registry.RegisterSchema("users", v1); err != nil {
+		t.Fatalf("Failed to register v1 schema: %v", err)
+	}
+	if err := registry.RegisterSchema("products", v2); err != nil {
+		t.Fatalf("Failed to register v2 schema: %v", err)
+	}
+
+	value, _ := registry.schemas.Load("products")
+	products := value.(*SchemaInfo)
+	if products.Metadata["federationVersion"] != "2.3" {
+		t.Errorf("Expected federationVersion 2.3, got %v", products.Metadata["federationVersion"])
+	}
+	if _, ok := products.Directives["shareable"]; !ok {
+		t.Error("Expected v2 directives to be registered for v2 schema")
+	}
+
+	value, _ = registry.schemas.Load("users")
+	users := value.(*SchemaInfo)
+	if users.FederationVersion() != "1" {
+		t.Errorf("Expected v1 schema without @link, got %s", users.FederationVersion())
+	}
+	if _, ok := users.Directives["shareable"]; ok {
+		t.Error("Did not expect v2 directives on v1 schema")
+	}
+
+	schema, err := registry.GetFederatedSchema()
+	if err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+	if schema.FederationVersion != "2.3" {
+		t.Errorf("Expected composed federation version 2.3, got %s", schema.FederationVersion)
+	}
+}
+
+func TestSchemaRegistry_PinSchemaVersion(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	knownGood := "type Query { users: [String] }"
+	drifted := "type Query { users: [String] admins: [String] }"
+
+	registry.PinSchemaVersion("users", registry.generateSchemaVersion(knownGood))
+
+	err := registry.RegisterSchema("users", drifted)
+	if err == nil {
+		t.Fatal("Expected drifted schema to be rejected")
+	}
+	if federationErr, ok := err.(*errors.FederationError); !ok || federationErr.Code != errors.ErrCodeSchemaInvalid {
+		t.Errorf("Expected schema error, got %v", err)
+	}
+
+	if err := registry.RegisterSchema("users", knownGood); err != nil {
+		t.Fatalf("Expected pinned schema to register, got %v", err)
+	}
+
+	// 取消固定后恢复原有行为
+	registry.PinSchemaVersion("users", "")
+	if err := registry.RegisterSchema("users", drifted); err != nil {
+		t.Fatalf("Expected schema to register after unpinning, got %v", err)
+	}
+}
+
+func TestSchemaRegistry_RegisterSchema_CustomDirectives(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	schema := `
+		enum CacheScope { PUBLIC PRIVATE }
+		directive @cacheControl(maxAge: Int, scope: CacheScope) on OBJECT | FIELD_DEFINITION
+		directive @tag(name: String!) repeatable on OBJECT | FIELD_DEFINITION
+
+		type Query { products(first: Int = 10): [Product!]! }
+		type Product @cacheControl(maxAge: 30, scope: PUBLIC) @tag(name: "public") @tag(name: "catalog") {
+			upc: String!
+			price: Float @cacheControl(maxAge: 5, scope: PRIVATE)
+		}`
+
+	if err := registry.RegisterSchema("products", schema); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+
+	value, _ := registry.schemas.Load("products")
+	info := value.(*SchemaInfo)
+
+	tagDef, ok := info.Directives["tag"]
+	if !ok || !tagDef.Repeatable {
+		t.Fatalf("Expected repeatable @tag definition, got %+v", tagDef)
+	}
+	if tagDef.Arguments["name"] != "String!" {
+		t.Errorf("Expected @tag(name: String!), got %+v", tagDef.Arguments)
+	}
+
+	product := info.Types["Product"]
+	if product == nil {
+		t.Fatal("Expected Product type to be extracted")
+	}
+
+	cacheControl := product.Directives["cacheControl"]
+	if cacheControl == nil {
+		t.Fatal("Expected @cacheControl on Product")
+	}
+	if cacheControl.Arguments["maxAge"] != int64(30) {
+		t.Errorf("Expected maxAge 30, got %v", cacheControl.Arguments["maxAge"])
+	}
+	if cacheControl.Arguments["scope"] != "PUBLIC" {
+		t.Errorf("Expected scope PUBLIC, got %v", cacheControl.Arguments["scope"])
+	}
+
+	tag := product.Directives["tag"]
+	if tag == nil || len(tag.Instances) != 2 {
+		t.Fatalf("Expected two @tag instances, got %+v", tag)
+	}
+	if tag.Instances[1]["name"] != "catalog" {
+		t.Errorf("Expected second @tag name catalog, got %v", tag.Instances[1]["name"])
+	}
+
+	price := product.Fields["price"]
+	if price == nil || price.Type != "Float" {
+		t.Fatalf("Expected price field of type Float, got %+v", price)
+	}
+	if scope := price.Directives["cacheControl"].Arguments["scope"]; scope != "PRIVATE" {
+		t.Errorf("Expected field scope PRIVATE, got %v", scope)
+	}
+
+	products := info.Types["Query"].Fields["products"]
+	if products.Type != "[Product!]!" {
+		t.Errorf("Expected [Product!]! type, got %s", products.Type)
+	}
+	if products.Arguments["first"].DefaultValue != int64(10) {
+		t.Errorf("Expected default value 10, got %v", products.Arguments["first"].DefaultValue)
+	}
+}
+
+func TestSchemaRegistry_GetFederatedSchema_ComposedSDL(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	products := `
+		extend schema @link(url: "https://specs.apollo.dev/federation/v2.3", import: ["@key", "@shareable", { name: "@inaccessible", as: "@hidden" }])
+
+		type Query {
+			"所有商品"
+			products(first: Int = 10): [Product!]!
+			internalStats: Stats @hidden
+		}
+		type Product @key(fields: "upc") {
+			upc: String!
+			cost: Float @hidden
+			status: Status @deprecated(reason: "use state")
+		}
+		type Stats @hidden { count: Int }
+		enum Status { ACTIVE RETIRED @hidden }`
+	reviews := `
+		type Query { reviews: [Review] }
+		type Review { body: String product: Product }
+		extend type Product @key(fields: "upc") {
+			upc: String! @external
+			reviews: [Review]
+		}`
+
+	if err := registry.RegisterSchema("products", products); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+	if err := registry.RegisterSchema("reviews", reviews); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+
+	schema, err := registry.GetFederatedSchema()
+	if err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+
+	expected := `type Query {
+  """
+  所有商品
+  """
+  products(first: Int = 10): [Product!]!
+  reviews: [Review]
+}
+
+type Product {
+  upc: String!
+  status: Status @deprecated(reason: "use state")
+  reviews: [Review]
+}
+
+type Review {
+  body: String
+  product: Product
+}
+
+enum Status {
+  ACTIVE
+}
+`
+	if schema.SDL != expected {
+		t.Errorf("Unexpected composed SDL:\n%s", schema.SDL)
+	}
+}
+
+func TestSchemaRegistry_RenamedRootTypes(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	inventory := `
+		schema { query: InventoryQuery mutation: InventoryMutation }
+		type InventoryQuery { stock(upc: String!): Int }
+		extend type InventoryQuery { warehouses: [String] }
+		type InventoryMutation { restock(upc: String!): Int }`
+	products := `type Query { products: [String] }`
+
+	if err := registry.RegisterSchema("inventory", inventory); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+	if err := registry.RegisterSchema("products", products); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+
+	schemaInfo, err := registry.GetSchema("inventory")
+	if err != nil {
+		t.Fatalf("GetSchema() failed: %v", err)
+	}
+	expectedRootTypes := map[string]string{"query": "InventoryQuery", "mutation": "InventoryMutation", "subscription": "Subscription"}
+	if !reflect.DeepEqual(schemaInfo.RootTypes, expectedRootTypes) {
+		t.Errorf("Unexpected root types: %v", schemaInfo.RootTypes)
+	}
+
+	value, _ := registry.schemas.Load("inventory")
+	internal := value.(*SchemaInfo)
+	if len(internal.Queries) != 2 || internal.Queries["warehouses"] == nil || internal.Mutations["restock"] == nil {
+		t.Errorf("Expected root fields from renamed root types, got queries %v mutations %v", internal.Queries, internal.Mutations)
+	}
+
+	// 组合模式中重命名的根类型合并到标准根类型
+	schema, err := registry.GetFederatedSchema()
+	if err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+	if strings.Contains(schema.SDL, "InventoryQuery") || !strings.Contains(schema.SDL, "stock(upc: String!): Int") ||
+		!strings.Contains(schema.SDL, "type Mutation {\n  restock(upc: String!): Int\n}") {
+		t.Errorf("Expected renamed roots to compose into Query and Mutation:\n%s", schema.SDL)
+	}
+}
+
+func TestSchemaRegistry_RegisterSchema_EnumValueMismatch(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	if err := registry.RegisterSchema("products", `type Query { products: [Product] } type Product { status: Status } enum Status { ACTIVE RETIRED }`); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+	// 相同的枚举定义可以出现在多个服务中
+	if err := registry.RegisterSchema("orders", `type Query { orders: [Order] } type Order { status: Status } enum Status { RETIRED ACTIVE }`); err != nil {
+		t.Fatalf("Expected identical enum definitions to compose, got %v", err)
+	}
+
+	// 值集合不同的枚举无法组合，冲突的模式不生效
+	err := registry.RegisterSchema("reviews", `type Query { reviews: [Review] } type Review { status: Status } enum Status { ACTIVE PENDING }`)
+	federationErr, ok := err.(*errors.FederationError)
+	if !ok || federationErr.Code != errors.ErrCodeValidation || federationErr.Extensions["reason"] != "ENUM_VALUE_MISMATCH" {
+		t.Fatalf("Expected ENUM_VALUE_MISMATCH validation error, got %v", err)
+	}
+	conflicts, _ := federationErr.Extensions["enums"].(map[string]map[string][]string)
+	if !reflect.DeepEqual(conflicts["Status"]["reviews"], []string{"ACTIVE", "PENDING"}) || !reflect.DeepEqual(conflicts["Status"]["products"], []string{"ACTIVE", "RETIRED"}) {
+		t.Errorf("Expected conflicting value sets per service, got %v", federationErr.Extensions["enums"])
+	}
+	if _, exists := registry.schemas.Load("reviews"); exists {
+		t.Error("Expected conflicting schema not to be registered")
+	}
+
+	schema, err := registry.GetFederatedSchema()
+	if err != nil {
+		t.Fatalf("GetFederatedSchema() failed: %v", err)
+	}
+	if strings.Contains(schema.SDL, "PENDING") || strings.Contains(schema.SDL, "reviews") {
+		t.Errorf("Expected previous federated schema to be kept, got:\n%s", schema.SDL)
+	}
+
+	// 标记 @shareable 的枚举允许各服务的值不同
+	err = registry.RegisterSchema("reviews", `type Query { reviews: [Review] } type Review { status: Status } enum Status @shareable { ACTIVE PENDING }`)
+	if err != nil {
+		t.Fatalf("Expected shareable enum to compose, got %v", err)
+	}
+}
+
+func TestSchemaRegistry_RegisterSchema_SwapsUnderRebuildLock(t *testing.T) {
+	registry := NewSchemaRegistry(&RegistryConfig{
+		ValidationLevel: ValidationLevelBasic,
+		MaxSchemaSize:   1024 * 1024,
+	}, &MockLogger{}).(*SchemaRegistry)
+
+	if err := registry.RegisterSchema("products", `type Query { products: [String] }`); err != nil {
+		t.Fatalf("RegisterSchema() failed: %v", err)
+	}
+
+	// 组合进行中时，注册不能替换模式，否则冲突回滚可能恢复过期的模式
+	registry.rebuildMutex.Lock()
+	done := make(chan error, 1)
+	go func() {
+		done <- registry.RegisterSchema("orders", `type Query { orders: [String] }`)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if _, exists := registry.schemas.Load("orders"); exists {
+		t.Error("Expected schema not to be stored while recomposition is in progress")
+	}
+	registry.rebuildMutex.Unlock()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RegisterSchema() failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected registration to complete after the rebuild lock is released")
+	}
+	if _, exists := registry.schemas.Load("orders"); !exists {
+		t.Error("Expected schema to be stored after registration")
+	}
+}
@@ -0,0 +1,210 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldSelection 表示 FieldSet 中的单个字段及其嵌套子选择，
+// 用于 @key、@requires 与 @provides 的 fields 参数
+type FieldSelection struct {
+	Name       string           `json:"name"`
+	Selections []FieldSelection `json:"selections,omitempty"`
+}
+
+// ParseFieldSet 将 FieldSet 字符串解析为结构化选择集，
+// 例如 "id address { zip } tags" 解析为三个顶层字段，其中 address 带有子选择 zip。
+// 逗号与空白一样被忽略；列表字段的写法与普通字段相同
+func ParseFieldSet(fields string) ([]FieldSelection, error) {
+	tokens := tokenizeFieldSet(fields)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("field set cannot be empty")
+	}
+
+	selections, pos, err := parseFieldSelections(tokens, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q in field set %q", tokens[pos], fields)
+	}
+
+	return selections, nil
+}
+
+// FieldSetNames 返回选择集的顶层字段名，selection 为空时解析 fields 作为回退
+func FieldSetNames(selection []FieldSelection, fields string) []string {
+	selection = fieldSet(selection, fields)
+
+	names := make([]string, 0, len(selection))
+	for _, field := range selection {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// fieldSet 返回解析后的选择集，selection 为空时解析 fields 作为回退
+func fieldSet(selection []FieldSelection, fields string) []FieldSelection {
+	if len(selection) == 0 {
+		selection, _ = ParseFieldSet(fields)
+	}
+	return selection
+}
+
+// FieldSetProviders 按嵌套选择在实体列表中查找字段集的提供者：顶层字段在 typeName 上查找，
+// 子选择在字段的返回类型上继续查找。visit 收到提供者服务和它提供的叶子字段路径（如 address.zip），
+// 顶层字段的提供者返回整个对象，因此对其下的每个叶子路径都会收到回调；标记为 @external 的定义不算提供者
+func FieldSetProviders(typeName string, selection []FieldSelection, entities []FederatedEntity, visit func(service, path string)) {
+	walkFieldSetProviders(typeName, selection, entities, "", visit)
+}
+
+// walkFieldSetProviders 递归查找一层选择的提供者，prefix 为上层字段路径
+func walkFieldSetProviders(typeName string, selection []FieldSelection, entities []FederatedEntity, prefix string, visit func(service, path string)) {
+	for _, field := range selection {
+		leaves := leafPaths(field, prefix)
+		fieldType := ""
+		for _, entity := range entities {
+			if entity.TypeName != typeName {
+				continue
+			}
+			for _, definition := range entity.Fields {
+				if definition.Name != field.Name || definition.Directives.External != nil {
+					continue
+				}
+				fieldType = strings.Trim(definition.Type, "[]! ")
+				for _, leaf := range leaves {
+					visit(entity.ServiceName, leaf)
+				}
+				break
+			}
+		}
+
+		if len(field.Selections) > 0 && fieldType != "" {
+			walkFieldSetProviders(fieldType, field.Selections, entities, prefix+field.Name+".", visit)
+		}
+	}
+}
+
+// leafPaths 返回字段下所有叶子字段的点分路径
+func leafPaths(field FieldSelection, prefix string) []string {
+	path := prefix + field.Name
+	if len(field.Selections) == 0 {
+		return []string{path}
+	}
+
+	var paths []string
+	for _, child := range field.Selections {
+		paths = append(paths, leafPaths(child, path+".")...)
+	}
+	return paths
+}
+
+// FieldSet 返回 @requires 解析后的嵌套选择集
+func (r *RequiresDirective) FieldSet() []FieldSelection {
+	return fieldSet(r.Selection, r.Fields)
+}
+
+// FieldSet 返回 @provides 解析后的嵌套选择集
+func (p *ProvidesDirective) FieldSet() []FieldSelection {
+	return fieldSet(p.Selection, p.Fields)
+}
+
+// FieldNames 返回 @key 选择集的顶层字段名
+func (k *KeyDirective) FieldNames() []string {
+	return FieldSetNames(k.Selection, k.Fields)
+}
+
+// FieldNames 返回 @requires 选择集的顶层字段名
+func (r *RequiresDirective) FieldNames() []string {
+	return FieldSetNames(r.Selection, r.Fields)
+}
+
+// FieldNames 返回 @provides 选择集的顶层字段名
+func (p *ProvidesDirective) FieldNames() []string {
+	return FieldSetNames(p.Selection, p.Fields)
+}
+
+// parseFieldSelections 从 pos 开始解析一层选择，遇到 "}" 或输入结束时返回
+func parseFieldSelections(tokens []string, pos, depth int) ([]FieldSelection, int, error) {
+	var selections []FieldSelection
+
+	for pos < len(tokens) {
+		token := tokens[pos]
+		switch token {
+		case "}":
+			if depth == 0 {
+				return nil, pos, fmt.Errorf("unbalanced '}' in field set")
+			}
+			return selections, pos, nil
+		case "{":
+			return nil, pos, fmt.Errorf("selection set must follow a field name")
+		}
+
+		if !isFieldSetName(token) {
+			return nil, pos, fmt.Errorf("invalid field name %q in field set", token)
+		}
+
+		field := FieldSelection{Name: token}
+		pos++
+
+		if pos < len(tokens) && tokens[pos] == "{" {
+			children, next, err := parseFieldSelections(tokens, pos+1, depth+1)
+			if err != nil {
+				return nil, next, err
+			}
+			if next >= len(tokens) {
+				return nil, next, fmt.Errorf("unclosed selection set for field %q", token)
+			}
+			if len(children) == 0 {
+				return nil, next, fmt.Errorf("empty selection set for field %q", token)
+			}
+			field.Selections = children
+			pos = next + 1
+		}
+
+		selections = append(selections, field)
+	}
+
+	return selections, pos, nil
+}
+
+// tokenizeFieldSet 将 FieldSet 切分为字段名与花括号
+func tokenizeFieldSet(fields string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range fields {
+		switch {
+		case r == '{' || r == '}':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// isFieldSetName 检查是否为合法的 GraphQL 字段名
+func isFieldSetName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
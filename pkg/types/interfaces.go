@@ -23,7 +23,7 @@ type QueryPlanner interface {
 	CreateExecutionPlan(ctx context.Context, query *ParsedQuery, services []ServiceConfig) (*ExecutionPlan, error)
 
 	// OptimizePlan 优化执行计划
-	OptimizePlan(plan *ExecutionPlan) (*ExecutionPlan, error)
+	OptimizePlan(ctx context.Context, plan *ExecutionPlan) (*ExecutionPlan, error)
 
 	// ValidatePlan 验证执行计划
 	ValidatePlan(plan *ExecutionPlan) error
@@ -84,6 +84,9 @@ type SchemaRegistry interface {
 
 	// RefreshSchemas 刷新所有模式
 	RefreshSchemas(ctx context.Context) error
+
+	// PinSchemaVersion 固定服务的模式版本，空字符串表示取消固定
+	PinSchemaVersion(serviceName string, version string)
 }
 
 // CacheManager 接口定义缓存管理器
@@ -134,6 +137,12 @@ type Logger interface {
 	Fatal(msg string, fields ...interface{})
 }
 
+// DebugLevelLogger 可报告是否启用 debug 级别的日志记录器
+type DebugLevelLogger interface {
+	// IsDebugEnabled 是否输出 debug 日志
+	IsDebugEnabled() bool
+}
+
 // MetricsCollector 接口定义指标收集器
 type MetricsCollector interface {
 	// IncrementCounter 增加计数器
@@ -205,8 +214,11 @@ type EntityResolver interface {
 	// ResolveEntity 解析单个实体
 	ResolveEntity(ctx context.Context, serviceName string, representation RepresentationRequest) (interface{}, error)
 
-	// ResolveBatchEntities 批量解析实体
-	ResolveBatchEntities(ctx context.Context, serviceName string, representations []RepresentationRequest) ([]interface{}, error)
+	// ResolveBatchEntities 批量解析实体，同时返回子图错误和失败分片的错误，路径为表示的 Path
+	ResolveBatchEntities(ctx context.Context, serviceName string, representations []RepresentationRequest) ([]interface{}, []GraphQLError, error)
+
+	// ResolveEntitiesByType 按具体 __typename 将表示分发到所属服务解析，错误同 ResolveBatchEntities
+	ResolveEntitiesByType(ctx context.Context, representations []RepresentationRequest, owners map[string]string) ([]interface{}, []GraphQLError, error)
 
 	// ValidateRepresentation 验证实体表示的有效性
 	ValidateRepresentation(entity *FederatedEntity, representation RepresentationRequest) error
@@ -227,6 +239,33 @@ type FederationValidator interface {
 	ValidateRequiredFields(entity *FederatedEntity, requiredFields []string) error
 }
 
+// PersistedQueryStore 接口定义持久化查询存储（APQ 与允许列表）
+type PersistedQueryStore interface {
+	// Get 按 sha256 哈希获取查询文本
+	Get(hash string) (string, bool)
+
+	// Register 注册自动持久化查询（APQ），哈希必须与查询匹配
+	Register(hash string, query string) error
+
+	// IsAllowed 判断查询哈希是否在允许列表中
+	IsAllowed(hash string) bool
+
+	// LoadManifest 加载 Apollo 格式的持久化查询清单，返回成功加载的操作数
+	LoadManifest(data []byte) (int, error)
+}
+
+// VariableTransformer 接口定义变量规范化，在分发子查询前执行
+type VariableTransformer interface {
+	// Transform 按操作声明的变量类型转换变量值，返回分发给子图的变量
+	Transform(query *ParsedQuery, variables map[string]interface{}) (map[string]interface{}, error)
+}
+
+// ResponseTransformer 接口定义响应改写，在合并后、序列化前执行，用于按客户端适配响应
+type ResponseTransformer interface {
+	// Transform 改写合并后的响应，可修改 data 和 extensions；返回错误时请求以内部错误失败
+	Transform(ctx *QueryContext, response *GraphQLResponse) error
+}
+
 // 辅助类型定义
 
 // ParsedQuery 表示解析后的查询
@@ -237,6 +276,17 @@ type ParsedQuery struct {
 	Fragments  map[string]interface{}
 	Complexity int
 	Depth      int
+	Breadth    int // 单个选择集中字段数的最大值
+
+	VariableDefinitions []VariableDefinition // 所执行操作声明的变量，按声明顺序
+}
+
+// VariableDefinition 操作中声明的变量
+type VariableDefinition struct {
+	Name         string      // 不含 $ 的变量名
+	Type         string      // 类型引用文本，如 [ID!]!
+	DefaultValue interface{} // 默认值，按 JSON 语义转换为 Go 值
+	HasDefault   bool        // 是否声明了默认值，区分未声明与默认值为 null
 }
 
 // Schema 表示 GraphQL 模式
@@ -246,6 +296,8 @@ type Schema struct {
 	Queries   map[string]*FieldDefinition
 	Mutations map[string]*FieldDefinition
 	Version   string
+
+	FederationVersion string // 组合后的联邦版本，v1 子图为 "1"
 }
 
 // TypeDefinition 表示类型定义
@@ -295,6 +347,7 @@ type EngineStatus struct {
 	Uptime     time.Duration
 	QueryCount int64
 	ErrorCount int64
+	InFlight   int64 // 正在执行的查询数
 	Services   map[string]ServiceStatus
 }
 
@@ -305,4 +358,7 @@ type ServiceStatus struct {
 	LastCheck    time.Time
 	ResponseTime time.Duration
 	ErrorRate    float64
+
+	SchemaVersion       string // 当前注册的模式版本
+	PinnedSchemaVersion string // 固定的模式版本，未固定时为空
 }
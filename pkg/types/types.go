@@ -1,6 +1,9 @@
 package types
 
 import (
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +15,8 @@ type QueryContext struct {
 	RequestID string                 `json:"requestId"`
 	UserID    string                 `json:"userId,omitempty"`
 	Headers   map[string]string      `json:"headers,omitempty"`
+
+	Traceparent string `json:"traceparent,omitempty"` // 本次请求的 W3C traceparent，客户端未提供时由引擎生成
 }
 
 // ExecutionPlan 表示查询执行计划
@@ -20,6 +25,36 @@ type ExecutionPlan struct {
 	Dependencies  map[string][]string    `json:"dependencies"`
 	MergeStrategy MergeStrategy          `json:"mergeStrategy"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	EntityFetches []EntityFetch          `json:"entityFetches,omitempty"` // 子查询合并后按顺序执行的实体查询
+	Selection     *SelectionNode         `json:"-"`                       // 合并时保留的字段树，为空表示保留子图返回的全部字段
+}
+
+// SelectionNode 客户端选择集的字段树，键为响应键（别名优先）
+type SelectionNode struct {
+	Children map[string]*SelectionNode // 为 nil 表示叶子字段，保留原值
+}
+
+// EntityFetch 表示依赖父级结果的实体查询：从 Path 处的对象按 @key 构造表示，
+// 通过 _entities 获取其他服务拥有的子字段并合并回原对象
+type EntityFetch struct {
+	ServiceName    string                 `json:"serviceName"`
+	TypeName       string                 `json:"typeName"`
+	Path           []string               `json:"path"`                     // 父级对象在响应数据中的路径（响应键，含别名）
+	KeyFields      []string               `json:"keyFields"`                // 构造表示所需的键字段
+	AlternateKeys  [][]string             `json:"alternateKeys,omitempty"`  // 同一实体的其他可用 @key，对象缺少 KeyFields 时按顺序选用
+	RequiredFields []string               `json:"requiredFields,omitempty"` // 目标服务 @requires 声明的字段，随键字段一起放入表示
+	Query          string                 `json:"query"`
+	Variables      map[string]interface{} `json:"variables,omitempty"`
+	Timeout        time.Duration          `json:"timeout"`
+}
+
+// KeySets 返回实体查询可用的全部 @key 字段列表，KeyFields 在前
+func (f *EntityFetch) KeySets() [][]string {
+	keys := make([][]string, 0, 1+len(f.AlternateKeys))
+	if len(f.KeyFields) > 0 {
+		keys = append(keys, f.KeyFields)
+	}
+	return append(keys, f.AlternateKeys...)
 }
 
 // SubQuery 表示子查询
@@ -32,19 +67,70 @@ type SubQuery struct {
 	Headers       map[string]string      `json:"headers,omitempty"`
 	Timeout       time.Duration          `json:"timeout"`
 	RetryCount    int                    `json:"retryCount,omitempty"`
+	FieldBudget   *FieldBudget           `json:"fieldBudget,omitempty"` // 按字段超时预算拆出的独立子查询，不与同服务的其他子查询合并
+	RootKeys      []string               `json:"rootKeys,omitempty"`    // 规划时记录的根字段响应键，为 nil 时执行阶段按查询文本解析
+}
+
+// FieldBudget 根字段的超时预算，子查询超时时 ResponseKeys 对应的字段返回 null 和超时错误
+type FieldBudget struct {
+	Field        string        `json:"field"`        // Type.field 形式的字段坐标
+	Timeout      time.Duration `json:"timeout"`      // 超时预算
+	ResponseKeys []string      `json:"responseKeys"` // 该字段在响应中的键（含别名）
 }
 
 // ServiceConfig 表示服务配置
 type ServiceConfig struct {
 	Name        string            `json:"name"`
 	Endpoint    string            `json:"endpoint"`
-	Path        string            `json:"path,omitempty"` // GraphQL端点路径，默认为/graphql
+	Path        string            `json:"path,omitempty"`      // GraphQL端点路径，默认为/graphql
+	Authority   string            `json:"authority,omitempty"` // 覆盖上游请求的 :authority，默认使用集群名
 	Schema      string            `json:"schema"`
 	Weight      int               `json:"weight,omitempty"`
 	Timeout     time.Duration     `json:"timeout"`
-	MaxRetries  int               `json:"maxRetries,omitempty"`
+	MaxRetries  int               `json:"maxRetries,omitempty"` // 上游失败后的重试次数，默认 0 不重试，受调用器 MaxRetries 上限约束
 	Headers     map[string]string `json:"headers,omitempty"`
 	HealthCheck *HealthCheck      `json:"healthCheck,omitempty"`
+	HedgeAfter  time.Duration     `json:"hedgeAfter,omitempty"` // 启用对冲请求，观测样本不足时作为对冲延迟
+
+	PinnedSchemaVersion string `json:"pinnedSchemaVersion,omitempty"` // 固定的模式版本哈希，不匹配的模式将被拒绝
+	IdempotentMutations bool   `json:"idempotentMutations,omitempty"` // 子图按幂等键去重变更，允许失败后重试变更
+	Required            bool   `json:"required,omitempty"`            // 关键服务，不健康时网关不就绪，与 readinessQuorum 无关
+
+	ResolutionPriority int `json:"resolutionPriority,omitempty"` // 实体解析顺序提示，互不依赖的服务中优先级高的先解析，不改变依赖约束
+
+	IDCoercion string `json:"idCoercion,omitempty"` // 发往该服务的实体表示中 ID 类型键字段的值类型：string（默认）或 number
+
+	SupportsBatching bool `json:"supportsBatching,omitempty"` // 子图支持 Apollo 风格的 HTTP 批量请求（操作数组），同一批次中发往该服务的多个子查询合并为一次调用
+
+	MaxDecompressedBytes int64 `json:"maxDecompressedBytes,omitempty"` // 按 Content-Encoding 解压（gzip/deflate）后响应体的字节上限，防止解压炸弹，0 使用默认 16 MiB
+
+	Auth *ServiceAuthConfig `json:"auth,omitempty"` // 服务间认证令牌，以 Authorization 头注入每次调用
+
+	ShadowEndpoint string  `json:"shadowEndpoint,omitempty"` // 候选端点，按比例镜像子查询流量并对比响应，不影响客户端响应
+	ShadowPercent  float64 `json:"shadowPercent,omitempty"`  // 镜像到候选端点的子查询比例（0-100）
+
+	DebugLogBodies       bool     `json:"debugLogBodies,omitempty"`       // 以 debug 级别记录子请求与响应体，默认关闭
+	DebugRedactHeaders   []string `json:"debugRedactHeaders,omitempty"`   // 记录时需要脱敏的头部名称
+	DebugRedactVariables []string `json:"debugRedactVariables,omitempty"` // 记录时需要脱敏的变量名称
+}
+
+// 实体表示中 ID 类型键字段的转换方式
+const (
+	IDCoercionString = "string" // 数字转换为字符串，按规范 ID 总是序列化为字符串
+	IDCoercionNumber = "number" // 整数形式的字符串转换为数字，用于坚持数字 ID 的子图
+)
+
+// ServiceAuthConfig 服务间认证配置：使用静态令牌，或从令牌端点获取并在过期前刷新
+type ServiceAuthConfig struct {
+	Token  string `json:"token,omitempty"`  // 静态令牌，与 tokenEndpoint 二选一
+	Scheme string `json:"scheme,omitempty"` // Authorization 头的认证方案，默认为 Bearer
+
+	TokenEndpoint       string            `json:"tokenEndpoint,omitempty"`       // 令牌端点，如 http://auth:8080/oauth/token
+	TokenRequestBody    string            `json:"tokenRequestBody,omitempty"`    // 请求令牌时发送的请求体
+	TokenRequestHeaders map[string]string `json:"tokenRequestHeaders,omitempty"` // 请求令牌时附加的头部，如客户端凭据
+	TokenTimeout        time.Duration     `json:"tokenTimeout,omitempty"`        // 令牌请求超时，0 使用默认值
+	RefreshBefore       time.Duration     `json:"refreshBefore,omitempty"`       // 过期前提前刷新的时间，0 使用默认值
+	DefaultTTL          time.Duration     `json:"defaultTTL,omitempty"`          // 令牌响应未给出 expires_in 时的有效期，0 使用默认值
 }
 
 // HealthCheck 表示健康检查配置
@@ -64,6 +150,244 @@ type FederationConfig struct {
 	QueryTimeout     time.Duration   `json:"queryTimeout"`
 	EnableIntrospect bool            `json:"enableIntrospection"`
 	DebugMode        bool            `json:"debugMode"`
+
+	StrictFieldRouting     bool   `json:"strictFieldRouting,omitempty"`     // 无法路由的字段在规划阶段报错
+	MaxEntitiesPerRequest  int    `json:"maxEntitiesPerRequest,omitempty"`  // 单次 _entities 调用的最大表示数，0 使用默认值
+	MaxEntityFieldAliases  int    `json:"maxEntityFieldAliases,omitempty"`  // 同一个触发实体查询的字段在查询中最多出现的次数（按别名计），0 表示不限制
+	VariableConflictPolicy string `json:"variableConflictPolicy,omitempty"` // 合并子查询时同名变量冲突策略：namespace 或 refuse
+	MaxTotalResponseBytes  int64  `json:"maxTotalResponseBytes,omitempty"`  // 单个请求所有上游响应体的总字节上限，0 表示不限制
+	PartialOnResponseLimit bool   `json:"partialOnResponseLimit,omitempty"` // 超出总字节上限时返回已收到的部分数据
+
+	PlanningTimeout     time.Duration `json:"planningTimeout,omitempty"`     // 查询规划阶段的独立超时，0 表示不单独限制
+	MaxDirectiveTimeout time.Duration `json:"maxDirectiveTimeout,omitempty"` // 操作级 @timeout 指令可设置的服务超时上限，0 使用 queryTimeout
+	StrictProjection    bool          `json:"strictProjection,omitempty"`    // 按客户端选择集裁剪合并后的数据，去除子图多返回的字段
+	UnknownFieldPolicy  string        `json:"unknownFieldPolicy,omitempty"`  // 子图返回未选择字段的处理：keep（默认）或 drop（合并时丢弃）
+	StrictFieldTypes    bool          `json:"strictFieldTypes,omitempty"`    // 多个服务返回的同一字段类型不兼容（如字符串与对象）时返回合并错误
+
+	ListMergePolicy string            `json:"listMergePolicy,omitempty"` // 多个服务返回同一列表时的合并策略：concat（默认，连接后去重）、unionByKey 或 zipByIndex
+	ListMergePaths  map[string]string `json:"listMergePaths,omitempty"`  // 按响应路径（如 "users" 或 "user.orders"）覆盖列表合并策略
+	ListMergeKeys   []string          `json:"listMergeKeys,omitempty"`   // unionByKey 识别同一元素的键字段
+
+	SoftQueryTimeout time.Duration `json:"softQueryTimeout,omitempty"` // 软超时：到达后不再等待未完成的子查询，合并已有结果并为缺失的字段返回超时错误，0 表示不启用
+	HardQueryTimeout time.Duration `json:"hardQueryTimeout,omitempty"` // 硬超时：整个执行（子查询、合并和实体查询）超过该时间即中止并返回超时错误，0 表示不启用
+
+	MergeHeadroom float64 `json:"mergeHeadroom,omitempty"` // 为响应合并预留的查询超时比例（0 到 1 之间），上游调用只使用其余部分，合并超出截止时间时返回部分结果，0 表示不预留
+
+	DuplicateOperationNames string `json:"duplicateOperationNames,omitempty"` // 同一批操作中操作名重复时的处理：reject（默认，拒绝整批）或 index（按批内下标区分）
+
+	MissingRootFieldPolicy string `json:"missingRootFieldPolicy,omitempty"` // 子图成功响应缺少所请求根字段的处理：ignore（默认）、null（补 null 并记录警告）或 error（补 null 并返回错误）
+
+	UndefinedFieldPolicy string `json:"undefinedFieldPolicy,omitempty"` // 子查询选择了目标服务模式未定义的字段时的处理：ignore（默认，原样发送）、prune（删除并记录）或 error（规划失败）
+
+	Batching *BatchingConfig `json:"batching,omitempty"` // 同服务子查询批处理的相似度参数，为空使用默认值
+
+	EntityBatch *EntityBatchConfig `json:"entityBatch,omitempty"` // 单次 _entities 调用的表示数量和大小上限，为空使用默认值
+
+	PersistedQueryManifest  string `json:"persistedQueryManifest,omitempty"`  // Apollo 格式的持久化查询清单（JSON），启动时同时载入 APQ 和允许列表
+	EnforcePersistedQueries bool   `json:"enforcePersistedQueries,omitempty"` // 仅允许执行清单中的查询
+
+	PersistedQueryRegistry *PersistedQueryRegistryConfig `json:"persistedQueryRegistry,omitempty"` // 远程持久化查询注册中心，本地未命中时按哈希查询
+
+	FallbackResponse string `json:"fallbackResponse,omitempty"` // 所有子查询均失败时作为 data 返回的静态 JSON 对象，错误仍保留
+	CoalesceQueries  bool   `json:"coalesceQueries,omitempty"`  // 合并并发的相同查询（仅 query 操作），只向子图执行一次
+
+	ErrorCodeMapping  map[string]string `json:"errorCodeMapping,omitempty"`  // 子图错误码到规范错误码的映射（如 E_NOT_FOUND → NOT_FOUND）
+	HTTPStatusMapping map[string]int    `json:"httpStatusMapping,omitempty"` // 错误码到响应 HTTP 状态码的映射，覆盖默认值，按最严重错误的错误码选择
+	WorkerPoolSize    int               `json:"workerPoolSize,omitempty"`    // 跨请求共享的子查询执行协程数，0 使用默认值
+
+	DefaultCacheMaxAge time.Duration `json:"defaultCacheMaxAge,omitempty"` // 没有 @cacheControl 提示的根字段使用的 maxAge，0（默认）表示包含这类字段的查询不写入缓存
+	ClientCacheMinAge  time.Duration `json:"clientCacheMinAge,omitempty"`  // 请求 extensions.cachePolicy.maxAge 的下限
+	ClientCacheMaxAge  time.Duration `json:"clientCacheMaxAge,omitempty"`  // 请求 extensions.cachePolicy.maxAge 的上限，0 使用默认 5 分钟
+	CacheMetadata      bool          `json:"cacheMetadata,omitempty"`      // 在 extensions.cache 中返回查询缓存的命中状态、age 和剩余 TTL
+
+	MaxCacheValueBytes int `json:"maxCacheValueBytes,omitempty"` // 单个查询结果写入查询缓存的大小上限，超出时不缓存，0 表示不限制
+
+	FieldTimeouts map[string]time.Duration `json:"fieldTimeouts,omitempty"` // 按 Query.field 配置的根字段超时预算，超时的字段返回 null，其余字段不受影响
+
+	SkipUnhealthyServices bool `json:"skipUnhealthyServices,omitempty"` // 规划时排除持续不健康的服务，字段改由其他拥有者提供，否则直接报错
+
+	ElideTypenameOnlyFetches bool `json:"elideTypenameOnlyFetches,omitempty"` // 省略字段拆分后只选择 __typename 的子查询和实体查询，由网关本地填充
+
+	DisableRequestCache bool `json:"disableRequestCache,omitempty"` // 关闭请求内去重缓存，默认同一请求中服务、查询和变量相同的上游调用只执行一次（mutation 除外）
+
+	LogFormat string `json:"logFormat,omitempty"` // 日志输出格式：text（默认）或 ndjson
+	LogLevel  string `json:"logLevel,omitempty"`  // 日志级别：info（默认）或 debug，info 时不输出 debug 日志
+
+	EnableTracing bool `json:"enableTracing,omitempty"` // 允许客户端请求 Apollo 格式的 extensions.tracing，默认关闭
+
+	TraceSampling *TraceSamplingConfig `json:"traceSampling,omitempty"` // 按比例采样请求记录详细执行追踪，为空时不采样
+
+	TraceparentExtension bool `json:"traceparentExtension,omitempty"` // 在 extensions.traceparent 中返回本次请求的 traceparent
+
+	AllowedDirectives []string `json:"allowedDirectives,omitempty"` // 查询中允许使用的指令，为空时使用内置指令和 Federation 指令
+
+	AllowedOperationTypes []string `json:"allowedOperationTypes,omitempty"` // 允许执行的操作类型：query、mutation、subscription，为空时全部允许
+
+	AllowedClusters []string `json:"allowedClusters,omitempty"` // 调用器允许分发的上游集群，为空时由各服务的 endpoint 推导
+
+	EnableSchemaExport bool   `json:"enableSchemaExport,omitempty"` // 通过 GET SchemaExportPath 导出组合后的 SDL，与 enableIntrospection 相互独立
+	SchemaExportPath   string `json:"schemaExportPath,omitempty"`   // 组合 SDL 的导出路径，为空使用 /federation/schema.graphql
+
+	ResponseHeaders *ResponseHeadersConfig `json:"responseHeaders,omitempty"` // 转发给客户端的上游响应头，为空时不转发
+
+	ReadinessQuorum      string `json:"readinessQuorum,omitempty"`      // 就绪所需的最少健康服务数，整数或百分比（如 "3"、"75%"），为空时不要求
+	EnableHealthEndpoint bool   `json:"enableHealthEndpoint,omitempty"` // 通过 GET HealthPath 返回就绪状态，未就绪时返回 503
+	HealthPath           string `json:"healthPath,omitempty"`           // 就绪状态的路径，为空使用 /federation/health
+
+	EnableStatusEndpoint  bool   `json:"enableStatusEndpoint,omitempty"`  // 通过 GET StatusPath 返回引擎和服务状态，支持 ?service= 只返回指定服务
+	StatusPath            string `json:"statusPath,omitempty"`            // 状态端点的路径，为空使用 /federation/status
+	EnableMetricsEndpoint bool   `json:"enableMetricsEndpoint,omitempty"` // 通过 GET MetricsPath 返回引擎指标，支持 ?service= 只返回指定服务
+	MetricsPath           string `json:"metricsPath,omitempty"`           // 指标端点的路径，为空使用 /federation/metrics
+	MetricsMaxServices    int    `json:"metricsMaxServices,omitempty"`    // 指标端点按服务输出的条目上限，按服务名排序截取，0 使用默认 100
+
+	EnableDependencyGraphEndpoint bool   `json:"enableDependencyGraphEndpoint,omitempty"` // 通过 GET DependencyGraphPath 导出由 @requires/@provides 分析的服务依赖图，默认 JSON 邻接表，?format=dot 返回 Graphviz DOT
+	DependencyGraphPath           string `json:"dependencyGraphPath,omitempty"`           // 依赖图端点的路径，为空使用 /federation/dependencies
+
+	SkipQueryValidation bool `json:"skipQueryValidation,omitempty"` // 跳过按组合模式验证查询，仅适用于受信任的内部流量
+
+	ErrorRate *ErrorRateConfig `json:"errorRate,omitempty"` // 按服务统计的滚动错误率窗口与告警阈值，为空使用默认窗口且不告警
+
+	VariableCoercion *VariableCoercionConfig `json:"variableCoercion,omitempty"` // 分发前按变量类型规范化变量值，为空时不转换
+
+	LenientParsing bool `json:"lenientParsing,omitempty"` // 宽松解析：未定义的指令、未使用的片段等可恢复问题只记录警告，语法错误仍然拒绝
+
+	MaxFragments     int `json:"maxFragments,omitempty"`     // 查询中片段定义的最大数量，0 表示不限制
+	MaxFragmentBytes int `json:"maxFragmentBytes,omitempty"` // 查询中所有片段定义的总字节上限，0 表示不限制
+
+	MaxSelectionBreadth int `json:"maxSelectionBreadth,omitempty"` // 单个选择集的字段数上限，超出时返回 QUERY_COMPLEXITY_ERROR，0 表示不限制
+
+	ParseCache *ParseCacheConfig `json:"parseCache,omitempty"` // 按查询文本缓存解析结果，重复查询跳过解析，为空时不缓存
+
+	PreParseLimits *PreParseLimitsConfig `json:"preParseLimits,omitempty"` // 完整解析前按原始文本粗略检查查询大小和嵌套，为空时不检查
+
+	LoadShedding *LoadSheddingConfig `json:"loadShedding,omitempty"` // 查询并发上限，饱和时排队或快速拒绝，为空时不限制
+
+	ResponseSize *ResponseSizeConfig `json:"responseSize,omitempty"` // 响应大小直方图的桶和按操作名分段的数量，为空使用默认值
+
+	StableJSON bool `json:"stableJSON,omitempty"` // 响应体按键名字典序稳定序列化，相同逻辑响应产生相同字节，便于内容哈希缓存和签名
+
+	ResponseEnvelopes []ResponseEnvelopeConfig `json:"responseEnvelopes,omitempty"` // 按路径或请求头选择的自定义响应包装，按顺序取第一条匹配的规则，未匹配时使用标准 { data, errors, extensions }
+}
+
+// ResponseEnvelopeConfig 自定义响应包装规则，面向期望非标准响应结构的旧客户端
+type ResponseEnvelopeConfig struct {
+	PathPrefix  string                 `json:"pathPrefix,omitempty"`  // 请求路径前缀，为空匹配所有路径
+	Header      string                 `json:"header,omitempty"`      // 请求头名称，为空不按请求头匹配
+	HeaderValue string                 `json:"headerValue,omitempty"` // 请求头取值（忽略大小写），为空时只要求请求头存在
+	Template    map[string]interface{} `json:"template"`              // 响应结构模板，值为 $data、$errors、$extensions 的字符串替换为标准字段，其余值原样输出
+}
+
+// 响应包装模板中引用标准响应字段的占位符
+const (
+	EnvelopeFieldData       = "$data"
+	EnvelopeFieldErrors     = "$errors"
+	EnvelopeFieldExtensions = "$extensions"
+)
+
+// ResponseSizeConfig 响应大小直方图配置
+type ResponseSizeConfig struct {
+	Buckets       []int64 `json:"buckets,omitempty"`       // 桶上界（字节），必须严格递增，为空使用 1 KiB 到 4 MiB 的默认桶
+	MaxOperations int     `json:"maxOperations,omitempty"` // 单独统计的操作名数量上限，超出的计入 other，0 使用默认 50
+}
+
+// 多个服务返回同名响应头时的处理策略
+const (
+	HeaderConflictFirst   = "first"   // 使用配置中最靠前的返回该头部的服务的值
+	HeaderConflictLast    = "last"    // 使用配置中最靠后的返回该头部的服务的值
+	HeaderConflictCombine = "combine" // 去重后以逗号拼接
+)
+
+// ResponseHeadersConfig 上游响应头转发配置，set-cookie 始终逐条累积
+type ResponseHeadersConfig struct {
+	Allowlist      []string `json:"allowlist"`                // 转发的头部名称，不区分大小写
+	ConflictPolicy string   `json:"conflictPolicy,omitempty"` // first（默认）、last 或 combine
+}
+
+// TraceSamplingConfig 详细执行追踪的采样配置
+type TraceSamplingConfig struct {
+	Rate        float64 `json:"rate"`                  // 采样比例（0-1），按请求 ID 的哈希确定，同一请求 ID 的结果始终相同
+	ForceHeader string  `json:"forceHeader,omitempty"` // 强制追踪的请求头，默认为 force-trace
+}
+
+// 查询并发饱和时的处理策略
+const (
+	LoadSheddingShed = "shed" // 排队数达到 queueDepth 时立即拒绝
+	LoadSheddingWait = "wait" // 不限制排队数，每个请求最多等待 queueTimeout
+)
+
+// LoadSheddingConfig 查询过载保护配置，拒绝时返回 SERVICE_UNAVAILABLE 和 Retry-After
+type LoadSheddingConfig struct {
+	MaxConcurrent int           `json:"maxConcurrent"`          // 同时执行的查询数上限
+	QueueDepth    int           `json:"queueDepth,omitempty"`   // shed 策略下等待执行的查询数上限，0 表示不排队
+	Policy        string        `json:"policy,omitempty"`       // shed（默认）或 wait
+	QueueTimeout  time.Duration `json:"queueTimeout,omitempty"` // 排队等待执行名额的最长时间，0 使用 queryTimeout
+	RetryAfter    time.Duration `json:"retryAfter,omitempty"`   // 拒绝时建议客户端等待的时间，按秒向上取整，0 使用默认 1 秒
+}
+
+// PreParseLimitsConfig 解析前对原始查询文本的启发式检查上限，字符串和注释中的字符不计入。
+// 只用于在调用解析器前拒绝明显超限的查询，默认值宽松，精确限制仍在解析后执行
+type PreParseLimitsConfig struct {
+	MaxBytes   int `json:"maxBytes,omitempty"`   // 查询文本字节上限，0 使用默认 1 MiB
+	MaxNesting int `json:"maxNesting,omitempty"` // 花括号、圆括号和方括号的最大嵌套层数，0 使用默认 256
+	MaxCost    int `json:"maxCost,omitempty"`    // 粗略代价（花括号数×2 + 圆括号数）上限，0 使用默认 100000
+}
+
+// ParseCacheConfig 查询解析缓存配置
+type ParseCacheConfig struct {
+	MaxSize int           `json:"maxSize,omitempty"` // 最多缓存的查询数，超出时淘汰最久未使用的，0 使用默认 1000
+	TTL     time.Duration `json:"ttl,omitempty"`     // 缓存条目的有效期，0 使用默认 5 分钟
+}
+
+// PersistedQueryRegistryConfig 远程持久化查询注册中心配置。
+// 注册中心是一个 GraphQL 端点，网关以 persistedQuery(id: $id) { body } 按哈希查询操作文本
+type PersistedQueryRegistryConfig struct {
+	Endpoint   string        `json:"endpoint"`             // 注册中心 GraphQL 端点
+	AuthHeader string        `json:"authHeader,omitempty"` // 作为 authorization 头发送的值
+	CacheTTL   time.Duration `json:"cacheTTL,omitempty"`   // 远程结果的本地缓存时间，0 使用默认 5 分钟
+	Timeout    time.Duration `json:"timeout,omitempty"`    // 单次查询超时，0 使用默认 2 秒
+
+	NegativeCacheTTL time.Duration `json:"negativeCacheTTL,omitempty"` // 注册中心未找到的哈希的本地缓存时间，0 使用默认 30 秒
+}
+
+// VariableCoercionConfig 按操作声明的变量类型规范化变量值的规则
+type VariableCoercionConfig struct {
+	CoerceNumbers  bool `json:"coerceNumbers,omitempty"`  // 数字字符串转换为 Int/Float
+	NormalizeEnums bool `json:"normalizeEnums,omitempty"` // 忽略大小写匹配枚举值，改写为模式中的写法
+	TrimStrings    bool `json:"trimStrings,omitempty"`    // 去除 String 值首尾的空白
+}
+
+// BatchingConfig 子查询批处理相似度配置。
+// 两个子查询的相似度 = (FieldOverlapWeight*顶层字段重叠度 + VariableWeight*变量数量接近度) / 权重和，
+// 达到 SimilarityThreshold 且满足复杂度和变量比例下限时才合并为一次请求。未设置的字段使用默认值
+type BatchingConfig struct {
+	MaxComplexity       *int     `json:"maxComplexity,omitempty"`       // 参与批处理的子查询最大复杂度，调大允许合并更复杂的查询
+	MinVariableRatio    *float64 `json:"minVariableRatio,omitempty"`    // 两个子查询变量数量之比的下限（0-1），低于则不合并
+	FieldOverlapWeight  *float64 `json:"fieldOverlapWeight,omitempty"`  // 顶层字段重叠度（Jaccard）的权重，调大更倾向只合并选择相同字段的查询
+	VariableWeight      *float64 `json:"variableWeight,omitempty"`      // 变量数量接近度的权重
+	SimilarityThreshold *float64 `json:"similarityThreshold,omitempty"` // 合并所需的最低加权相似度（0-1），调低更激进地批处理，调高减少多取字段
+}
+
+// 单次 _entities 调用表示列表的默认上限
+const (
+	DefaultMaxRepresentations     = 1000
+	DefaultMaxRepresentationBytes = 1 << 20
+)
+
+// EntityBatchConfig 实体查询表示列表的上限。超过任一上限时拆分为多次 _entities 调用，
+// 关闭拆分时该实体查询返回错误
+type EntityBatchConfig struct {
+	MaxRepresentations     int   `json:"maxRepresentations,omitempty"`     // 单次调用的表示数量上限，0 使用默认 1000
+	MaxRepresentationBytes int64 `json:"maxRepresentationBytes,omitempty"` // 单次调用表示列表序列化后的字节上限，0 使用默认 1 MiB
+	DisableChunking        bool  `json:"disableChunking,omitempty"`        // 超出上限时报错而不是拆分
+}
+
+// ErrorRateConfig 服务滚动错误率配置
+type ErrorRateConfig struct {
+	Window      time.Duration `json:"window,omitempty"`      // 统计窗口，0 使用默认 1 分钟
+	Buckets     int           `json:"buckets,omitempty"`     // 窗口划分的时间桶数量，0 使用默认 6 个
+	Threshold   float64       `json:"threshold,omitempty"`   // 告警阈值（0-1），错误率达到阈值时记录警告，0 表示不告警
+	MinRequests int           `json:"minRequests,omitempty"` // 窗口内至少达到该调用数才判断阈值，避免少量调用造成误报
+	TripCircuit bool          `json:"tripCircuit,omitempty"` // 超过阈值时将服务视为不健康，配合 skipUnhealthyServices 在窗口滑过后自动恢复
 }
 
 // GraphQLRequest 表示 GraphQL 请求
@@ -71,6 +395,7 @@ type GraphQLRequest struct {
 	Query         string                 `json:"query"`
 	Variables     map[string]interface{} `json:"variables,omitempty"`
 	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
 }
 
 // GraphQLResponse 表示 GraphQL 响应
@@ -120,7 +445,12 @@ type ServiceResponse struct {
 	Latency    time.Duration          `json:"latency"`
 	Error      error                  `json:"-"`
 	StatusCode int                    `json:"statusCode"`
-	Headers    map[string]string      `json:"headers,omitempty"`
+	Headers    map[string]string      `json:"headers,omitempty"`  // 上游响应头，重复的 set-cookie 以换行分隔，其余以逗号分隔
+	BodySize   int64                  `json:"bodySize,omitempty"` // 上游响应体字节数
+
+	RequestSize int64 `json:"requestSize,omitempty"` // 发往上游的请求体字节数
+
+	EntityPaths [][]interface{} `json:"entityPaths,omitempty"` // _entities 各表示在联邦响应中的路径，用于重定位错误路径
 }
 
 // ExecutionContext 表示执行上下文
@@ -131,6 +461,155 @@ type ExecutionContext struct {
 	StartTime    time.Time
 	Config       *FederationConfig
 	Metrics      *Metrics
+	Tracing      bool // 客户端请求了 extensions.tracing，需同时开启 EnableTracing
+	TraceSampled bool // 本次请求被采样，记录并输出详细执行追踪
+
+	ServiceTimeouts map[string]time.Duration // 本次请求通过 @timeout 指令覆盖的服务超时
+	NoCache         bool                     // 本次请求带 @noCache 指令，不读写查询缓存，也不与并发的相同查询合并
+	SoftDeadline    time.Time                // 软超时截止时间，到达后合并已收到的子查询结果，零值表示不启用
+
+	responseBytes   int64 // 已接收的上游响应体总字节数
+	subQueryTimings []SubQueryTiming
+	timingMutex     sync.Mutex
+
+	serviceUsage map[string]ServiceUsage // 服务名 -> 本次请求的上游用量
+	usageMutex   sync.Mutex
+
+	upstreamHeaders []ServiceHeaders // 按子查询顺序记录的上游响应头
+	headersMutex    sync.Mutex
+
+	requestFetches map[string]*RequestFetch // 请求内去重缓存：调用键 -> 上游调用
+	fetchesMutex   sync.Mutex
+}
+
+// RequestFetch 请求内去重缓存中的一次上游调用，Done 关闭后 Response 和 Err 可读
+type RequestFetch struct {
+	Response *ServiceResponse
+	Err      error
+	done     chan struct{}
+}
+
+// Done 返回调用完成时关闭的通道
+func (f *RequestFetch) Done() <-chan struct{} {
+	return f.done
+}
+
+// Complete 记录调用结果并唤醒等待者，只能由创建该调用的一方调用一次
+func (f *RequestFetch) Complete(response *ServiceResponse, err error) {
+	f.Response, f.Err = response, err
+	close(f.done)
+}
+
+// LoadOrStartFetch 返回请求内去重缓存中键对应的调用。不存在时创建并返回 true，
+// 调用方负责执行上游调用并 Complete；已存在时等待其 Done 后复用结果
+func (c *ExecutionContext) LoadOrStartFetch(key string) (*RequestFetch, bool) {
+	c.fetchesMutex.Lock()
+	defer c.fetchesMutex.Unlock()
+	if fetch, ok := c.requestFetches[key]; ok {
+		return fetch, false
+	}
+	if c.requestFetches == nil {
+		c.requestFetches = make(map[string]*RequestFetch)
+	}
+	fetch := &RequestFetch{done: make(chan struct{})}
+	c.requestFetches[key] = fetch
+	return fetch, true
+}
+
+// ClearRequestCache 清空请求内去重缓存，请求结束时调用
+func (c *ExecutionContext) ClearRequestCache() {
+	c.fetchesMutex.Lock()
+	defer c.fetchesMutex.Unlock()
+	c.requestFetches = nil
+}
+
+// ServiceHeaders 单次上游调用返回的响应头
+type ServiceHeaders struct {
+	Service string
+	Headers map[string]string
+}
+
+// RecordUpstreamHeaders 记录一次上游调用的响应头，可并发调用
+func (c *ExecutionContext) RecordUpstreamHeaders(service string, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+
+	c.headersMutex.Lock()
+	defer c.headersMutex.Unlock()
+	c.upstreamHeaders = append(c.upstreamHeaders, ServiceHeaders{Service: service, Headers: headers})
+}
+
+// UpstreamHeaders 返回本次请求按记录顺序的上游响应头
+func (c *ExecutionContext) UpstreamHeaders() []ServiceHeaders {
+	c.headersMutex.Lock()
+	defer c.headersMutex.Unlock()
+	return append([]ServiceHeaders(nil), c.upstreamHeaders...)
+}
+
+// ServiceUsage 单个服务的上游调用次数和字节数，用于成本归因
+type ServiceUsage struct {
+	Calls         int64 `json:"calls"`
+	RequestBytes  int64 `json:"requestBytes"`
+	ResponseBytes int64 `json:"responseBytes"`
+}
+
+// RecordServiceUsage 累加一次服务调用的用量，可并发调用
+func (c *ExecutionContext) RecordServiceUsage(service string, requestBytes, responseBytes int64) {
+	c.usageMutex.Lock()
+	defer c.usageMutex.Unlock()
+	if c.serviceUsage == nil {
+		c.serviceUsage = make(map[string]ServiceUsage)
+	}
+	usage := c.serviceUsage[service]
+	usage.Calls++
+	usage.RequestBytes += requestBytes
+	usage.ResponseBytes += responseBytes
+	c.serviceUsage[service] = usage
+}
+
+// ServiceUsage 返回本次请求按服务统计的上游用量
+func (c *ExecutionContext) ServiceUsage() map[string]ServiceUsage {
+	c.usageMutex.Lock()
+	defer c.usageMutex.Unlock()
+	usage := make(map[string]ServiceUsage, len(c.serviceUsage))
+	for service, u := range c.serviceUsage {
+		usage[service] = u
+	}
+	return usage
+}
+
+// SubQueryTiming 单个子查询的执行时间，用于组装 tracing 数据
+type SubQueryTiming struct {
+	Service      string
+	ResponseKeys []string // 子查询返回的根字段响应键
+	Traceparent  string   // 子查询 span 的 traceparent
+	Start        time.Time
+	Duration     time.Duration
+}
+
+// RecordSubQueryTiming 记录子查询执行时间，可并发调用
+func (c *ExecutionContext) RecordSubQueryTiming(timing SubQueryTiming) {
+	c.timingMutex.Lock()
+	defer c.timingMutex.Unlock()
+	c.subQueryTimings = append(c.subQueryTimings, timing)
+}
+
+// SubQueryTimings 返回已记录的子查询执行时间
+func (c *ExecutionContext) SubQueryTimings() []SubQueryTiming {
+	c.timingMutex.Lock()
+	defer c.timingMutex.Unlock()
+	return append([]SubQueryTiming(nil), c.subQueryTimings...)
+}
+
+// AddResponseBytes 累加上游响应体字节数并返回当前总数
+func (c *ExecutionContext) AddResponseBytes(n int64) int64 {
+	return atomic.AddInt64(&c.responseBytes, n)
+}
+
+// ResponseBytes 返回已接收的上游响应体总字节数
+func (c *ExecutionContext) ResponseBytes() int64 {
+	return atomic.LoadInt64(&c.responseBytes)
 }
 
 // Metrics 表示性能指标
@@ -149,20 +628,23 @@ type SchemaInfo struct {
 	Version     string
 	Types       []TypeInfo
 	UpdatedAt   time.Time
+	RootTypes   map[string]string // 操作类型（query、mutation、subscription）到根类型名的映射，支持 schema 定义重命名的根类型
 }
 
 // TypeInfo 表示类型信息
 type TypeInfo struct {
-	Name   string
-	Kind   string
-	Fields []FieldInfo
+	Name       string
+	Kind       string
+	Fields     []FieldInfo
+	Directives map[string]map[string]interface{} // 类型上应用的指令及参数
 }
 
 // FieldInfo 表示字段信息
 type FieldInfo struct {
-	Name string
-	Type string
-	Args []ArgumentInfo
+	Name       string
+	Type       string
+	Args       []ArgumentInfo
+	Directives map[string]map[string]interface{} // 字段上应用的指令及参数
 }
 
 // ArgumentInfo 表示参数信息
@@ -205,8 +687,9 @@ const (
 
 // KeyDirective 表示 @key 指令
 type KeyDirective struct {
-	Fields     string `json:"fields"`     // 键字段选择集
-	Resolvable bool   `json:"resolvable"` // 是否可解析，默认为 true
+	Fields     string           `json:"fields"`              // 键字段选择集
+	Selection  []FieldSelection `json:"selection,omitempty"` // 解析后的键字段选择集
+	Resolvable bool             `json:"resolvable"`          // 是否可解析，默认为 true
 }
 
 // ExternalDirective 表示 @external 指令
@@ -216,12 +699,38 @@ type ExternalDirective struct {
 
 // RequiresDirective 表示 @requires 指令
 type RequiresDirective struct {
-	Fields string `json:"fields"` // 必需字段选择集
+	Fields    string           `json:"fields"`              // 必需字段选择集
+	Selection []FieldSelection `json:"selection,omitempty"` // 解析后的必需字段选择集
 }
 
 // ProvidesDirective 表示 @provides 指令
 type ProvidesDirective struct {
-	Fields string `json:"fields"` // 提供字段选择集
+	Fields    string           `json:"fields"`              // 提供字段选择集
+	Selection []FieldSelection `json:"selection,omitempty"` // 解析后的提供字段选择集
+}
+
+// LinkDirective 表示 Federation v2 的 @link 指令
+type LinkDirective struct {
+	URL     string            `json:"url"`               // 规范地址
+	Version string            `json:"version,omitempty"` // 联邦版本，例如 "2.3"
+	Imports []string          `json:"imports,omitempty"` // 导入的指令名（不含 @）
+	Aliases map[string]string `json:"aliases,omitempty"` // 别名 -> 原指令名
+}
+
+// IsFederationV2 是否为 Federation v2 模式
+func (l *LinkDirective) IsFederationV2() bool {
+	return l != nil && strings.HasPrefix(l.Version, "2")
+}
+
+// ResolveDirectiveName 将别名或命名空间形式的指令名还原为联邦指令名
+func (l *LinkDirective) ResolveDirectiveName(name string) string {
+	if l == nil {
+		return name
+	}
+	if original, ok := l.Aliases[name]; ok {
+		return original
+	}
+	return strings.TrimPrefix(name, "federation__")
 }
 
 // EntityDirectives 表示实体上的指令集合
@@ -236,10 +745,20 @@ type EntityDirectives struct {
 type FederatedEntity struct {
 	TypeName    string           `json:"typeName"`
 	ServiceName string           `json:"serviceName"`
+	Kind        EntityKind       `json:"kind,omitempty"`       // 对象或接口实体
+	Interfaces  []string         `json:"interfaces,omitempty"` // 实现的接口
 	Directives  EntityDirectives `json:"directives"`
 	Fields      []FederatedField `json:"fields"`
 }
 
+// EntityKind 实体类型种类
+type EntityKind string
+
+const (
+	EntityKindObject    EntityKind = "OBJECT"
+	EntityKindInterface EntityKind = "INTERFACE"
+)
+
 // FederatedField 表示联邦字段
 type FederatedField struct {
 	Name       string           `json:"name"`
@@ -267,6 +786,7 @@ type ServiceSchema struct {
 type RepresentationRequest struct {
 	TypeName       string                 `json:"__typename"`
 	Representation map[string]interface{} `json:"representation"`
+	Path           []interface{}          `json:"path,omitempty"` // 实体在联邦响应中的路径
 }
 
 // EntityResolution 表示实体解析信息
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// 滚动错误率窗口的默认参数
+const (
+	DefaultErrorRateWindow  = time.Minute
+	DefaultErrorRateBuckets = 6
+)
+
+// errorRateBucket 窗口中的单个时间桶
+type errorRateBucket struct {
+	epoch     int64 // 桶对应的时间片序号，与当前序号相差超过桶数即已过期
+	successes int64
+	failures  int64
+}
+
+// ErrorRateWindow 按固定数量时间桶统计的滚动错误率，内存占用与调用量无关，可并发使用
+type ErrorRateWindow struct {
+	width   time.Duration // 单个桶覆盖的时长
+	buckets []errorRateBucket
+	mutex   sync.Mutex
+}
+
+// NewErrorRateWindow 创建滚动错误率窗口，window 或 buckets <= 0 时使用默认值
+func NewErrorRateWindow(window time.Duration, buckets int) *ErrorRateWindow {
+	if window <= 0 {
+		window = DefaultErrorRateWindow
+	}
+	if buckets <= 0 {
+		buckets = DefaultErrorRateBuckets
+	}
+
+	width := window / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+
+	return &ErrorRateWindow{
+		width:   width,
+		buckets: make([]errorRateBucket, buckets),
+	}
+}
+
+// Record 记录一次调用结果
+func (w *ErrorRateWindow) Record(failed bool) {
+	w.recordAt(time.Now(), failed)
+}
+
+// Rate 返回窗口内的错误率和调用总数，没有调用时错误率为 0
+func (w *ErrorRateWindow) Rate() (float64, int64) {
+	return w.rateAt(time.Now())
+}
+
+// recordAt 在指定时间记录调用结果，桶已过期时先清零
+func (w *ErrorRateWindow) recordAt(now time.Time, failed bool) {
+	epoch := now.UnixNano() / int64(w.width)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	bucket := &w.buckets[epoch%int64(len(w.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = errorRateBucket{epoch: epoch}
+	}
+	if failed {
+		bucket.failures++
+	} else {
+		bucket.successes++
+	}
+}
+
+// rateAt 计算指定时间的窗口错误率，只统计未过期的桶
+func (w *ErrorRateWindow) rateAt(now time.Time) (float64, int64) {
+	epoch := now.UnixNano() / int64(w.width)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var successes, failures int64
+	for _, bucket := range w.buckets {
+		if bucket.epoch > epoch-int64(len(w.buckets)) && bucket.epoch <= epoch {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+
+	total := successes + failures
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(failures) / float64(total), total
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorRateWindow_RollingRate(t *testing.T) {
+	window := NewErrorRateWindow(time.Minute, 6)
+	start := time.Unix(0, 0)
+
+	// 第一个 10 秒桶：3 次成功、1 次失败
+	for _, failed := range []bool{false, true, false, false} {
+		window.recordAt(start, failed)
+	}
+	// 30 秒后：2 次失败
+	window.recordAt(start.Add(30*time.Second), true)
+	window.recordAt(start.Add(30*time.Second), true)
+
+	if rate, total := window.rateAt(start.Add(30 * time.Second)); total != 6 || rate != 0.5 {
+		t.Errorf("rate = %v over %d calls, want 0.5 over 6", rate, total)
+	}
+
+	// 第一个桶滑出窗口后只统计后面的失败
+	if rate, total := window.rateAt(start.Add(65 * time.Second)); total != 2 || rate != 1 {
+		t.Errorf("rate = %v over %d calls, want 1 over 2", rate, total)
+	}
+
+	// 复用同一个桶位置时先清零旧数据
+	window.recordAt(start.Add(60*time.Second), false)
+	if rate, total := window.rateAt(start.Add(60 * time.Second)); total != 3 || rate != 2.0/3 {
+		t.Errorf("rate = %v over %d calls, want 2/3 over 3", rate, total)
+	}
+
+	// 整个窗口过期后归零
+	if rate, total := window.rateAt(start.Add(10 * time.Minute)); total != 0 || rate != 0 {
+		t.Errorf("rate = %v over %d calls, want 0 over 0", rate, total)
+	}
+}
+
+func TestErrorRateWindow_Concurrent(t *testing.T) {
+	window := NewErrorRateWindow(0, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		failed := i%4 == 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			window.Record(failed)
+		}()
+	}
+	wg.Wait()
+
+	if rate, total := window.Rate(); total != 100 || rate != 0.25 {
+		t.Errorf("rate = %v over %d calls, want 0.25 over 100", rate, total)
+	}
+}
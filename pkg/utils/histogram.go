@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultSizeBuckets 响应大小直方图的默认桶上界（字节）：1 KiB 到 4 MiB，超出的计入 +Inf 桶
+var DefaultSizeBuckets = []int64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// HistogramBucket 直方图的累计桶，Count 为小于等于 UpperBound 的观测数，UpperBound 为 0 表示 +Inf
+type HistogramBucket struct {
+	UpperBound int64 `json:"le"`
+	Count      int64 `json:"count"`
+}
+
+// HistogramSnapshot 直方图快照
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int64             `json:"count"`
+	Sum     int64             `json:"sum"`
+}
+
+// Histogram 固定桶的整数直方图，内存占用与观测数量无关，可并发使用
+type Histogram struct {
+	bounds []int64
+	counts []int64 // 每个桶（非累计）的观测数，最后一个为 +Inf 桶
+	count  int64
+	sum    int64
+	mutex  sync.Mutex
+}
+
+// NewHistogram 按递增的桶上界创建直方图，bounds 为空时使用 DefaultSizeBuckets
+func NewHistogram(bounds []int64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultSizeBuckets
+	}
+
+	return &Histogram{
+		bounds: append([]int64(nil), bounds...),
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(value int64) {
+	index := sort.Search(len(h.bounds), func(i int) bool { return value <= h.bounds[i] })
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.counts[index]++
+	h.count++
+	h.sum += value
+}
+
+// Snapshot 返回累计桶形式的快照
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	buckets := make([]HistogramBucket, len(h.counts))
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		buckets[i].Count = cumulative
+		if i < len(h.bounds) {
+			buckets[i].UpperBound = h.bounds[i]
+		}
+	}
+
+	return HistogramSnapshot{Buckets: buckets, Count: h.count, Sum: h.sum}
+}
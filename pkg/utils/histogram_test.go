@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	histogram := NewHistogram([]int64{10, 100})
+	for _, value := range []int64{5, 10, 50, 1000} {
+		histogram.Observe(value)
+	}
+
+	expected := HistogramSnapshot{
+		Buckets: []HistogramBucket{{UpperBound: 10, Count: 2}, {UpperBound: 100, Count: 3}, {UpperBound: 0, Count: 4}},
+		Count:   4,
+		Sum:     1065,
+	}
+	if snapshot := histogram.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("Unexpected snapshot:\n got: %+v\nwant: %+v", snapshot, expected)
+	}
+
+	if buckets := len(NewHistogram(nil).Snapshot().Buckets); buckets != len(DefaultSizeBuckets)+1 {
+		t.Errorf("Expected default buckets plus +Inf, got %d", buckets)
+	}
+}
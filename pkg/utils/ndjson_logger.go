@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+	federationtypes "envoy-wasm-graphql-federation/pkg/types"
+)
+
+// 日志输出格式
+const (
+	LogFormatText   = "text"   // key=value 文本格式
+	LogFormatNDJSON = "ndjson" // 每条记录一行 JSON 对象
+)
+
+// NewLoggerWithFormat 按输出格式创建日志记录器，空值或未知格式使用文本格式
+func NewLoggerWithFormat(prefix, format string, debugEnabled bool) federationtypes.Logger {
+	if format == LogFormatNDJSON {
+		return NewNDJSONLogger(prefix, debugEnabled, nil)
+	}
+	return NewLoggerWithDebug(prefix, debugEnabled)
+}
+
+// NDJSONLogger 以 NDJSON 输出的日志记录器，每次调用写出一行 JSON 对象，
+// 数值和布尔字段保留原始类型，字符串中的控制字符经 SanitizeString 转义
+type NDJSONLogger struct {
+	prefix       string
+	debugEnabled bool
+	writer       io.Writer
+	mutex        sync.Mutex
+}
+
+// NewNDJSONLogger 创建 NDJSON 日志记录器，writer 为空时写到标准输出
+func NewNDJSONLogger(prefix string, debugEnabled bool, writer io.Writer) federationtypes.Logger {
+	if writer == nil {
+		writer = os.Stdout
+	}
+	return &NDJSONLogger{prefix: prefix, debugEnabled: debugEnabled, writer: writer}
+}
+
+// IsDebugEnabled 是否输出 debug 日志
+func (l *NDJSONLogger) IsDebugEnabled() bool {
+	return l.debugEnabled
+}
+
+// Debug 记录调试信息
+func (l *NDJSONLogger) Debug(msg string, fields ...interface{}) {
+	if !l.debugEnabled {
+		return
+	}
+	l.log("DEBUG", msg, fields...)
+}
+
+// Info 记录信息
+func (l *NDJSONLogger) Info(msg string, fields ...interface{}) {
+	l.log("INFO", msg, fields...)
+}
+
+// Warn 记录警告
+func (l *NDJSONLogger) Warn(msg string, fields ...interface{}) {
+	l.log("WARN", msg, fields...)
+}
+
+// Error 记录错误
+func (l *NDJSONLogger) Error(msg string, fields ...interface{}) {
+	l.log("ERROR", msg, fields...)
+}
+
+// Fatal 记录致命错误
+func (l *NDJSONLogger) Fatal(msg string, fields ...interface{}) {
+	l.log("FATAL", msg, fields...)
+}
+
+// log 组装单行记录并一次性写出，保证并发调用时行不交错
+func (l *NDJSONLogger) log(level, msg string, fields ...interface{}) {
+	buf := make([]byte, 0, 128)
+	buf = append(buf, `{"ts":`...)
+	buf = appendJSONString(buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf = append(buf, `,"level":`...)
+	buf = appendJSONString(buf, level)
+	buf = append(buf, `,"logger":`...)
+	buf = appendJSONString(buf, l.prefix)
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, msg)
+
+	if len(fields)%2 != 0 {
+		// 奇数个字段，最后一个作为值处理
+		fields = append(fields, "")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, fmt.Sprintf("%v", fields[i]))
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, fields[i+1])
+	}
+	buf = append(buf, '}', '\n')
+
+	l.mutex.Lock()
+	_, _ = l.writer.Write(buf)
+	l.mutex.Unlock()
+}
+
+// appendJSONValue 写出字段值，数值和布尔保持类型，其余转为字符串
+func appendJSONValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case float32:
+		return appendJSONFloat(buf, float64(v), 32)
+	case float64:
+		return appendJSONFloat(buf, v, 64)
+	case string:
+		return appendJSONString(buf, v)
+	case error:
+		return appendJSONString(buf, v.Error())
+	case fmt.Stringer:
+		// time.Duration 等类型输出可读形式
+		return appendJSONString(buf, v.String())
+	case map[string]interface{}, []interface{}, []string:
+		if encoded, err := jsonutil.Marshal(v); err == nil && jsonutil.Valid(encoded) {
+			return append(buf, encoded...)
+		}
+	}
+	return appendJSONString(buf, fmt.Sprintf("%v", value))
+}
+
+// appendJSONFloat 写出浮点数，NaN 和 Inf 不是合法 JSON 数值，按字符串输出
+func appendJSONFloat(buf []byte, value float64, bitSize int) []byte {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return appendJSONString(buf, strconv.FormatFloat(value, 'g', -1, bitSize))
+	}
+	return strconv.AppendFloat(buf, value, 'g', -1, bitSize)
+}
+
+// appendJSONString 写出 JSON 字符串；换行等控制字符先经 SanitizeString 转义为可见形式，
+// 其余控制字符和非法 UTF-8 按 JSON 规则转义
+func appendJSONString(buf []byte, s string) []byte {
+	s = SanitizeString(s)
+
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c < 0x20 || c == 0x7f:
+				buf = append(buf, fmt.Sprintf(`\u%04x`, c)...)
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
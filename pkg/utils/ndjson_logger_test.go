@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"envoy-wasm-graphql-federation/pkg/jsonutil"
+)
+
+func TestNDJSONLogger_OneValidLinePerCall(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewNDJSONLogger("test", true, &out)
+
+	logger.Debug("debug", "count", 3)
+	logger.Info("multi\nline\tmessage", "query", "{\n  a\r\n}\x01", "quote", `say "hi" \ bye`)
+	logger.Warn("odd fields", "dangling")
+	logger.Error("failed", "error", errors.New("boom\nagain"), "duration", 150*time.Millisecond)
+	logger.Fatal("no fields")
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d: %q", len(lines), out.String())
+	}
+
+	levels := []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	for i, line := range lines {
+		if !jsonutil.Valid([]byte(line)) {
+			t.Fatalf("line %d is not valid JSON: %s", i, line)
+		}
+
+		var record map[string]interface{}
+		if err := jsonutil.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %d: unmarshal failed: %v", i, err)
+		}
+		if record["level"] != levels[i] {
+			t.Errorf("line %d: expected level %s, got %v", i, levels[i], record["level"])
+		}
+		if record["logger"] != "test" {
+			t.Errorf("line %d: expected logger test, got %v", i, record["logger"])
+		}
+		if _, ok := record["ts"].(string); !ok {
+			t.Errorf("line %d: expected ts string, got %v", i, record["ts"])
+		}
+	}
+
+	if !strings.Contains(lines[1], `"msg":"multi\\nline\\tmessage"`) {
+		t.Errorf("expected sanitized message, got %s", lines[1])
+	}
+	if !strings.Contains(lines[1], `\u0001`) {
+		t.Errorf("expected remaining control characters to be escaped, got %s", lines[1])
+	}
+	if !strings.Contains(lines[2], `"dangling":""`) {
+		t.Errorf("expected dangling key with empty value, got %s", lines[2])
+	}
+	if !strings.Contains(lines[3], `"error":"boom\\nagain"`) || !strings.Contains(lines[3], `"duration":"150ms"`) {
+		t.Errorf("unexpected error record: %s", lines[3])
+	}
+}
+
+func TestNDJSONLogger_TypedFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewNDJSONLogger("test", true, &out)
+
+	logger.Info("typed",
+		"int", 42,
+		"int64", int64(-7),
+		"uint", uint32(9),
+		"float", 1.5,
+		"bool", true,
+		"nil", nil,
+		"string", "42",
+		"list", []string{"a", "b"},
+	)
+
+	line := strings.TrimSuffix(out.String(), "\n")
+	for _, fragment := range []string{
+		`"int":42`,
+		`"int64":-7`,
+		`"uint":9`,
+		`"float":1.5`,
+		`"bool":true`,
+		`"nil":null`,
+		`"string":"42"`,
+		`"list":["a","b"]`,
+	} {
+		if !strings.Contains(line, fragment) {
+			t.Errorf("expected %s in %s", fragment, line)
+		}
+	}
+}
+
+func TestNDJSONLogger_DebugDisabled(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewNDJSONLogger("test", false, &out)
+
+	logger.Debug("hidden", "key", "value")
+	if out.Len() != 0 {
+		t.Errorf("expected no output for disabled debug, got %q", out.String())
+	}
+	if IsDebugEnabled(logger) {
+		t.Error("expected IsDebugEnabled to report false")
+	}
+}
+
+func TestNewLoggerWithFormat(t *testing.T) {
+	if _, ok := NewLoggerWithFormat("test", LogFormatNDJSON, true).(*NDJSONLogger); !ok {
+		t.Error("expected NDJSON logger for ndjson format")
+	}
+	if _, ok := NewLoggerWithFormat("test", "", true).(*Logger); !ok {
+		t.Error("expected text logger for empty format")
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Quorum 法定数量，绝对数量（如 "3"）或百分比（如 "75%"）
+type Quorum struct {
+	Count   int     // 绝对数量，Percent 为 0 时使用
+	Percent float64 // 百分比，取值 (0, 100]
+}
+
+// ParseQuorum 解析法定数量，百分比以 % 结尾，空字符串表示不要求
+func ParseQuorum(value string) (Quorum, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Quorum{}, nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+		if err != nil || math.IsNaN(percent) || percent <= 0 || percent > 100 {
+			return Quorum{}, fmt.Errorf("invalid quorum percentage %q: must be in (0%%, 100%%]", value)
+		}
+		return Quorum{Percent: percent}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return Quorum{}, fmt.Errorf("invalid quorum %q: must be a non-negative integer or a percentage", value)
+	}
+	return Quorum{Count: count}, nil
+}
+
+// Required 返回 total 个成员中需要满足的数量，百分比向上取整，结果不超过 total
+func (q Quorum) Required(total int) int {
+	required := q.Count
+	if q.Percent > 0 {
+		required = int(math.Ceil(float64(total) * q.Percent / 100))
+	}
+	if required > total {
+		return total
+	}
+	return required
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestParseQuorum(t *testing.T) {
+	tests := []struct {
+		value    string
+		total    int
+		required int
+		wantErr  bool
+	}{
+		{value: "", total: 4, required: 0},
+		{value: "3", total: 4, required: 3},
+		{value: "6", total: 4, required: 4},
+		{value: "75%", total: 4, required: 3},
+		{value: "50%", total: 3, required: 2},
+		{value: "100%", total: 5, required: 5},
+		{value: "0%", wantErr: true},
+		{value: "120%", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "half", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		quorum, err := ParseQuorum(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQuorum(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err == nil && quorum.Required(tt.total) != tt.required {
+			t.Errorf("ParseQuorum(%q).Required(%d) = %d, want %d", tt.value, tt.total, quorum.Required(tt.total), tt.required)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "strings"
+
+// RedactedValue 脱敏后的占位值
+const RedactedValue = "[REDACTED]"
+
+// RedactVariables 返回将指定变量替换为占位值的副本，变量名不区分大小写
+func RedactVariables(variables map[string]interface{}, names []string) map[string]interface{} {
+	if len(variables) == 0 || len(names) == 0 {
+		return variables
+	}
+
+	redacted := make(map[string]interface{}, len(variables))
+	for key, value := range variables {
+		redacted[key] = value
+		for _, name := range names {
+			if strings.EqualFold(name, key) {
+				redacted[key] = RedactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// TraceparentHeader W3C Trace Context 的 traceparent 头部名称
+const TraceparentHeader = "traceparent"
+
+// TracestateHeader W3C Trace Context 的 tracestate 头部名称，随 traceparent 原样转发
+const TracestateHeader = "tracestate"
+
+// TraceContext 表示 W3C traceparent 中的追踪信息
+type TraceContext struct {
+	TraceID  string // 32 位小写十六进制
+	ParentID string // 16 位小写十六进制，当前 span 的 ID
+	Flags    string // 2 位十六进制追踪标志
+}
+
+// NewTraceContext 生成新的根追踪上下文并标记为采样。
+// 使用 math/rand 生成 ID，兼容 TinyGo，不依赖 crypto/rand
+func NewTraceContext() TraceContext {
+	return TraceContext{
+		TraceID:  newTraceID(),
+		ParentID: newSpanID(),
+		Flags:    "01",
+	}
+}
+
+// ParseTraceparent 解析 traceparent 头部，格式不合法或 ID 全零时返回 false。
+// 未知的更高版本只解析前四段，按 00 版本继续传播
+func ParseTraceparent(value string) (TraceContext, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || (len(value) > 55 && (value[:2] == "00" || value[55] != '-')) {
+		return TraceContext{}, false
+	}
+
+	version, traceID, parentID, flags := value[0:2], value[3:35], value[36:52], value[53:55]
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return TraceContext{}, false
+	}
+	if !isLowerHex(version) || version == "ff" || !isLowerHex(traceID) || !isLowerHex(parentID) || !isLowerHex(flags) {
+		return TraceContext{}, false
+	}
+	if isAllZero(traceID) || isAllZero(parentID) {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, ParentID: parentID, Flags: flags}, true
+}
+
+// Child 返回同一追踪下的子 span 上下文
+func (t TraceContext) Child() TraceContext {
+	return TraceContext{
+		TraceID:  t.TraceID,
+		ParentID: newSpanID(),
+		Flags:    t.Flags,
+	}
+}
+
+// String 按 00 版本格式化为 traceparent 头部值
+func (t TraceContext) String() string {
+	return "00-" + t.TraceID + "-" + t.ParentID + "-" + t.Flags
+}
+
+// newTraceID 生成非全零的 16 字节追踪 ID
+func newTraceID() string {
+	for {
+		high, low := rand.Uint64(), rand.Uint64()
+		if high != 0 || low != 0 {
+			return fmt.Sprintf("%016x%016x", high, low)
+		}
+	}
+}
+
+// newSpanID 生成非全零的 8 字节 span ID
+func newSpanID() string {
+	for {
+		if id := rand.Uint64(); id != 0 {
+			return fmt.Sprintf("%016x", id)
+		}
+	}
+}
+
+func isLowerHex(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAllZero(value string) bool {
+	return strings.Trim(value, "0") == ""
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+var traceparentPattern = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`)
+
+func TestNewTraceContext(t *testing.T) {
+	trace := NewTraceContext()
+	if !traceparentPattern.MatchString(trace.String()) {
+		t.Fatalf("Expected well-formed traceparent, got %q", trace.String())
+	}
+	if _, ok := ParseTraceparent(trace.String()); !ok {
+		t.Errorf("Expected generated traceparent %q to parse", trace.String())
+	}
+
+	child := trace.Child()
+	if child.TraceID != trace.TraceID || child.ParentID == trace.ParentID || child.Flags != trace.Flags {
+		t.Errorf("Expected child span of %s, got %s", trace, child)
+	}
+	if NewTraceContext().TraceID == trace.TraceID {
+		t.Error("Expected distinct trace IDs")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{" 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 ", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01", false},
+	}
+
+	for _, tt := range tests {
+		trace, ok := ParseTraceparent(tt.value)
+		if ok != tt.valid {
+			t.Errorf("ParseTraceparent(%q) valid = %v, want %v", tt.value, ok, tt.valid)
+		}
+		if ok && trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("ParseTraceparent(%q) traceID = %s", tt.value, trace.TraceID)
+		}
+	}
+}
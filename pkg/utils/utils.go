@@ -53,6 +53,44 @@ func parseQueryParam(query, name string) string {
 	return ""
 }
 
+// HasQueryParam 判断查询字符串中是否出现参数，支持不带值的形式（如 ?tracing）
+func HasQueryParam(query, name string) bool {
+	if query == "" || name == "" {
+		return false
+	}
+
+	for _, param := range strings.Split(query, "&") {
+		key := strings.SplitN(param, "=", 2)[0]
+		if strings.TrimSpace(key) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClusterName 从服务 endpoint 推导上游集群名称：去掉协议、路径和端口
+func ClusterName(endpoint string) string {
+	// 简化处理：移除http://或https://前缀
+	if strings.HasPrefix(endpoint, "http://") {
+		endpoint = endpoint[7:]
+	} else if strings.HasPrefix(endpoint, "https://") {
+		endpoint = endpoint[8:]
+	}
+
+	// 移除路径部分
+	if idx := strings.Index(endpoint, "/"); idx > 0 {
+		endpoint = endpoint[:idx]
+	}
+
+	// 移除端口号（如果有）
+	if idx := strings.Index(endpoint, ":"); idx > 0 {
+		endpoint = endpoint[:idx]
+	}
+
+	return endpoint
+}
+
 // IsValidURL 简单的URL格式验证（TinyGo兼容版本）
 func IsValidURL(urlStr string) bool {
 	if urlStr == "" {
@@ -105,18 +143,133 @@ func IsValidURL(urlStr string) bool {
 	return false
 }
 
+// IsValidAuthority 验证 host[:port] 形式的 HTTP authority（TinyGo兼容版本）
+func IsValidAuthority(authority string) bool {
+	if authority == "" || len(authority) > 255 {
+		return false
+	}
+
+	host := authority
+	port := ""
+	if strings.HasPrefix(authority, "[") {
+		// IPv6 字面量
+		end := strings.Index(authority, "]")
+		if end == -1 {
+			return false
+		}
+		host = authority[1:end]
+		rest := authority[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return false
+			}
+			port = rest[1:]
+			if port == "" {
+				return false
+			}
+		}
+		if host == "" || !strings.Contains(host, ":") {
+			return false
+		}
+		for _, char := range host {
+			if !((char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') ||
+				(char >= 'A' && char <= 'F') || char == ':' || char == '.') {
+				return false
+			}
+		}
+	} else {
+		if i := strings.LastIndex(authority, ":"); i != -1 {
+			host = authority[:i]
+			port = authority[i+1:]
+			if port == "" {
+				return false
+			}
+		}
+		if !isValidHostname(host) {
+			return false
+		}
+	}
+
+	if port != "" {
+		value := 0
+		for _, char := range port {
+			if char < '0' || char > '9' {
+				return false
+			}
+			value = value*10 + int(char-'0')
+			if value > 65535 {
+				return false
+			}
+		}
+		if value == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidHostname 验证主机名由合法的 DNS 标签组成
+func isValidHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, char := range label {
+			if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+				(char >= '0' && char <= '9') || char == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 // Logger 简单的日志记录器实现
 type Logger struct {
-	prefix string
+	prefix       string
+	debugEnabled bool
 }
 
 // NewLogger 创建新的日志记录器
 func NewLogger(prefix string) federationtypes.Logger {
-	return &Logger{prefix: prefix}
+	return &Logger{prefix: prefix, debugEnabled: true}
+}
+
+// NewLoggerWithDebug 创建可关闭 debug 输出的日志记录器
+func NewLoggerWithDebug(prefix string, debugEnabled bool) federationtypes.Logger {
+	return &Logger{prefix: prefix, debugEnabled: debugEnabled}
+}
+
+// IsDebugEnabled 是否输出 debug 日志
+func (l *Logger) IsDebugEnabled() bool {
+	return l.debugEnabled
+}
+
+// IsDebugEnabled 判断日志记录器是否输出 debug 日志，未实现 DebugLevelLogger 时视为启用
+func IsDebugEnabled(logger federationtypes.Logger) bool {
+	if logger == nil {
+		return false
+	}
+	if leveled, ok := logger.(federationtypes.DebugLevelLogger); ok {
+		return leveled.IsDebugEnabled()
+	}
+	return true
 }
 
 // Debug 记录调试信息
 func (l *Logger) Debug(msg string, fields ...interface{}) {
+	if !l.debugEnabled {
+		return
+	}
 	l.log("DEBUG", msg, fields...)
 }
 
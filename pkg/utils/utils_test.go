@@ -29,6 +29,15 @@ func TestGenerateRequestID(t *testing.T) {
 	}
 }
 
+func TestHasQueryParam(t *testing.T) {
+	if !HasQueryParam("tracing", "tracing") || !HasQueryParam("a=1&tracing=true", "tracing") {
+		t.Error("Expected tracing parameter to be found")
+	}
+	if HasQueryParam("tracingx=1&a=tracing", "tracing") || HasQueryParam("", "tracing") {
+		t.Error("Expected tracing parameter to be absent")
+	}
+}
+
 func TestGetQueryParam(t *testing.T) {
 	// 测试正常情况
 	query := "name=John&age=30&city=NewYork"
@@ -169,6 +178,20 @@ func TestNewLogger(t *testing.T) {
 	}
 }
 
+func TestIsDebugEnabled(t *testing.T) {
+	if !IsDebugEnabled(NewLogger("test")) {
+		t.Error("Expected debug to be enabled by default")
+	}
+
+	if IsDebugEnabled(NewLoggerWithDebug("test", false)) {
+		t.Error("Expected debug to be disabled")
+	}
+
+	if IsDebugEnabled(nil) {
+		t.Error("Expected nil logger to report debug disabled")
+	}
+}
+
 func TestLoggerMethods(t *testing.T) {
 	logger := NewLogger("test")
 
@@ -220,3 +243,19 @@ func TestFormatFields(t *testing.T) {
 		t.Errorf("Expected '%s', got '%s'", expected, result)
 	}
 }
+
+func TestIsValidAuthority(t *testing.T) {
+	valid := []string{"example.com", "users-service", "users.internal:8443", "10.0.0.1:80", "[::1]", "[2001:db8::1]:443"}
+	for _, authority := range valid {
+		if !IsValidAuthority(authority) {
+			t.Errorf("Expected %q to be valid", authority)
+		}
+	}
+
+	invalid := []string{"", "http://example.com", "example.com/path", "-bad.com", "bad..com", "host:", "host:0", "host:70000", "[::1", "[zz::1]", "user@host"}
+	for _, authority := range invalid {
+		if IsValidAuthority(authority) {
+			t.Errorf("Expected %q to be invalid", authority)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultWorkerPoolSize 默认工作协程数
+const DefaultWorkerPoolSize = 64
+
+// WorkerPool 固定大小的可复用工作协程池。
+// 没有空闲 worker 或池已关闭时任务在新启动的 goroutine 中执行：提交方不会被前一个任务阻塞而串行化
+// 后续任务，任务内再次提交时也不会互相等待造成死锁
+type WorkerPool struct {
+	size   int
+	slots  chan struct{} // 占用中的 worker，容量等于 worker 数
+	tasks  chan func()
+	closed chan struct{}
+	mutex  sync.RWMutex // 保证关闭后不再有任务入队
+	wg     sync.WaitGroup
+
+	pooled   int64 // 由 worker 执行的任务数
+	overflow int64 // 没有空闲 worker 时在新 goroutine 中执行的任务数
+}
+
+// WorkerPoolStats 协程池统计
+type WorkerPoolStats struct {
+	Size     int   `json:"size"`
+	Pooled   int64 `json:"pooled"`
+	Overflow int64 `json:"overflow"`
+}
+
+// NewWorkerPool 创建协程池，size <= 0 时使用默认大小
+func NewWorkerPool(size int) *WorkerPool {
+	if size <= 0 {
+		size = DefaultWorkerPoolSize
+	}
+
+	pool := &WorkerPool{
+		size:   size,
+		slots:  make(chan struct{}, size),
+		tasks:  make(chan func(), size),
+		closed: make(chan struct{}),
+	}
+
+	pool.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go pool.work()
+	}
+
+	return pool
+}
+
+// work worker 主循环，关闭后先执行完已入队的任务再退出
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case task := <-p.tasks:
+			p.run(task)
+		case <-p.closed:
+			for {
+				select {
+				case task := <-p.tasks:
+					p.run(task)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// run 执行任务并释放占用的 worker
+func (p *WorkerPool) run(task func()) {
+	defer func() { <-p.slots }()
+	task()
+}
+
+// Submit 提交任务，有空闲 worker 时交给 worker 执行，否则启动新的 goroutine 执行，不会阻塞提交方。
+// 先占用名额再入队，名额数等于 worker 数，入队的任务总有 worker 接手，
+// 不依赖 worker 恰好阻塞在接收上
+func (p *WorkerPool) Submit(task func()) {
+	if p.enqueue(task) {
+		atomic.AddInt64(&p.pooled, 1)
+		return
+	}
+
+	atomic.AddInt64(&p.overflow, 1)
+	go task()
+}
+
+// enqueue 尝试占用空闲 worker 并入队任务
+func (p *WorkerPool) enqueue(task func()) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	select {
+	case <-p.closed:
+		return false
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		p.tasks <- task
+		return true
+	default:
+		return false
+	}
+}
+
+// Size 返回 worker 数量
+func (p *WorkerPool) Size() int {
+	return p.size
+}
+
+// Stats 返回协程池统计
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	return WorkerPoolStats{
+		Size:     p.size,
+		Pooled:   atomic.LoadInt64(&p.pooled),
+		Overflow: atomic.LoadInt64(&p.overflow),
+	}
+}
+
+// Close 停止接收任务并等待 worker 完成已接收的任务，可重复调用
+func (p *WorkerPool) Close() {
+	p.mutex.Lock()
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+	p.mutex.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool_RoutesResultsByIndex(t *testing.T) {
+	pool := NewWorkerPool(2)
+	defer pool.Close()
+
+	const tasks = 32
+	results := make([]int, tasks)
+	var wg sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		index := i
+		wg.Add(1)
+		pool.Submit(func() {
+			defer wg.Done()
+			results[index] = index * index
+		})
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result != i*i {
+			t.Errorf("results[%d] = %d, want %d", i, result, i*i)
+		}
+	}
+
+	stats := pool.Stats()
+	if stats.Pooled+stats.Overflow != tasks {
+		t.Errorf("Expected %d executed tasks, got %+v", tasks, stats)
+	}
+}
+
+func TestWorkerPool_NestedSubmitDoesNotDeadlock(t *testing.T) {
+	pool := NewWorkerPool(1)
+	defer pool.Close()
+
+	var executed int32
+	var outer sync.WaitGroup
+	outer.Add(1)
+	pool.Submit(func() {
+		defer outer.Done()
+
+		// worker 全忙时内层任务在新 goroutine 中执行
+		var inner sync.WaitGroup
+		inner.Add(1)
+		pool.Submit(func() {
+			defer inner.Done()
+			atomic.AddInt32(&executed, 1)
+		})
+		inner.Wait()
+	})
+	outer.Wait()
+
+	if atomic.LoadInt32(&executed) != 1 {
+		t.Error("Expected nested task to run")
+	}
+}
+
+func TestWorkerPool_Close(t *testing.T) {
+	pool := NewWorkerPool(4)
+	pool.Close()
+	pool.Close()
+
+	done := make(chan struct{})
+	pool.Submit(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected task submitted after Close to run")
+	}
+}
+
+func TestWorkerPool_SaturatedSubmitDoesNotBlock(t *testing.T) {
+	pool := NewWorkerPool(1)
+	defer pool.Close()
+
+	// 唯一的 worker 被占用时，后续任务不在提交方执行，可以与之并发
+	release := make(chan struct{})
+	pool.Submit(func() { <-release })
+
+	started := make(chan struct{})
+	submitted := make(chan struct{})
+	go func() {
+		pool.Submit(func() {
+			close(started)
+			<-release
+		})
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Submit to return while the task is still running")
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Expected overflow task to run concurrently")
+	}
+	close(release)
+
+	if stats := pool.Stats(); stats.Overflow != 1 {
+		t.Errorf("Expected one overflow task, got %+v", stats)
+	}
+}
+
+// simulateSubQuery 模拟一次子查询的少量计算
+func simulateSubQuery() int {
+	sum := 0
+	for i := 0; i < 1000; i++ {
+		sum += i * i
+	}
+	return sum
+}
+
+// runRequest 模拟一个请求的并发子查询，按索引收集结果
+func runRequest(submit func(func()), subQueries int) {
+	results := make([]int, subQueries)
+	var wg sync.WaitGroup
+	for i := 0; i < subQueries; i++ {
+		index := i
+		wg.Add(1)
+		submit(func() {
+			defer wg.Done()
+			results[index] = simulateSubQuery()
+		})
+	}
+	wg.Wait()
+}
+
+func BenchmarkSubQueries_GoroutinePerCall(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			runRequest(func(task func()) { go task() }, 4)
+		}
+	})
+}
+
+func BenchmarkSubQueries_WorkerPool(b *testing.B) {
+	pool := NewWorkerPool(DefaultWorkerPoolSize)
+	defer pool.Close()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			runRequest(pool.Submit, 4)
+		}
+	})
+}
@@ -333,7 +333,7 @@ func testComponentIntegration(t *testing.T) {
 	}
 
 	// 测试优化
-	optimizedPlan, err := plannerInstance.OptimizePlan(plan)
+	optimizedPlan, err := plannerInstance.OptimizePlan(context.Background(), plan)
 	if err != nil {
 		t.Errorf("Plan optimization failed: %v", err)
 	}